@@ -0,0 +1,119 @@
+// +build linux
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"time"
+
+	"github.com/opencontainers/runc/libcontainer"
+	"github.com/opencontainers/runc/libcontainer/utils"
+	"github.com/urfave/cli"
+	"golang.org/x/sys/unix"
+)
+
+// attachTimeout is the maximum time to wait for the receiver of the console
+// socket of the container to send a terminal.
+const attachTimeout = 5 * time.Second
+
+var attachCommand = cli.Command{
+	Name:  "attach",
+	Usage: "get another terminal to a container",
+	ArgsUsage: `<container-id>
+
+Where "<container-id>" is the name for the instance of the container.`,
+	Description: `The attach command requests another terminal to a container created with
+--console-socket from the receiver of its console socket, and sends it to the
+given --console-socket, as runc create does.
+
+This requires the receiver of the console socket of the container to support
+attach requests (see ConsoleAttachRequest in libcontainer/utils), as recvtty
+does with --attach, in which case it's up to it to multiplex the new terminal
+with the one of the container.`,
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:  "console-socket",
+			Usage: "path to an AF_UNIX socket which will receive a file descriptor referencing the master end of the terminal",
+		},
+	},
+	Action: func(context *cli.Context) error {
+		if err := checkArgs(context, 1, exactArgs); err != nil {
+			return err
+		}
+		dest := context.String("console-socket")
+		if dest == "" {
+			return errors.New("--console-socket is required")
+		}
+		container, err := getContainer(context)
+		if err != nil {
+			return err
+		}
+		status, err := container.Status()
+		if err != nil {
+			return err
+		}
+		if status == libcontainer.Stopped {
+			return errors.New("cannot attach to a stopped container")
+		}
+		state, err := container.State()
+		if err != nil {
+			return err
+		}
+		src := utils.SearchLabels(state.Config.Labels, utils.ConsoleSocketLabel)
+		if src == "" {
+			return errors.New("the container has no console socket")
+		}
+		master, err := requestConsole(src)
+		if err != nil {
+			return fmt.Errorf("unable to get a terminal from %s: %w", src, err)
+		}
+		defer master.Close()
+		return sendConsole(dest, master)
+	},
+}
+
+// requestConsole requests a terminal from the receiver of the console socket
+// path, and returns its master.
+func requestConsole(path string) (*os.File, error) {
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	socket, err := conn.(*net.UnixConn).File()
+	if err != nil {
+		return nil, err
+	}
+	defer socket.Close()
+
+	if _, err := socket.Write([]byte(utils.ConsoleAttachRequest)); err != nil {
+		return nil, err
+	}
+	tv := unix.NsecToTimeval(attachTimeout.Nanoseconds())
+	if err := unix.SetsockoptTimeval(int(socket.Fd()), unix.SOL_SOCKET, unix.SO_RCVTIMEO, &tv); err != nil {
+		return nil, err
+	}
+	master, err := utils.RecvFd(socket)
+	if errors.Is(err, unix.EAGAIN) {
+		err = errors.New("no terminal received (the receiver may not support attach requests)")
+	}
+	return master, err
+}
+
+// sendConsole sends the terminal master to the console socket path.
+func sendConsole(path string, master *os.File) error {
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	socket, err := conn.(*net.UnixConn).File()
+	if err != nil {
+		return err
+	}
+	defer socket.Close()
+	return utils.SendFd(socket, master.Name(), master.Fd())
+}
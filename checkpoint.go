@@ -3,16 +3,19 @@
 package main
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"net"
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
 
 	criu "github.com/checkpoint-restore/go-criu/v5/rpc"
 	"github.com/opencontainers/runc/libcontainer"
 	"github.com/opencontainers/runc/libcontainer/userns"
+	"github.com/opencontainers/runc/libcontainer/utils"
 	"github.com/opencontainers/runtime-spec/specs-go"
 	"github.com/sirupsen/logrus"
 	"github.com/urfave/cli"
@@ -26,7 +29,24 @@ var checkpointCommand = cli.Command{
 
 Where "<container-id>" is the name for the instance of the container to be
 checkpointed.`,
-	Description: `The checkpoint command saves the state of the container instance.`,
+	Description: `The checkpoint command saves the state of the container instance.
+
+With --pre-dumps, the container is pre-dumped the given number of times
+before being dumped, to directories named predump-1, predump-2, ... under the
+image path, which are added to the ones already there. Each pre-dump only
+copies the memory pages dirtied since the previous one, and so does the final
+dump, which makes it shorter for live migration. The container is restored
+from the image path.
+
+Bind mounts of the config are checkpointed as external mounts. Other external
+resources, such as connections to a bind-mounted socket like
+/run/docker.sock, can be given with --external in the format of criu, and
+bind mounts not in the config with --ext-mount. They can also be set with the
+"org.opencontainers.runc.checkpoint.external" annotation of the spec, as a
+JSON array of strings, and the
+"org.opencontainers.runc.checkpoint.external-mounts" annotation, as a JSON
+object mapping the container paths of the mounts to their sources, which are
+used on restore.`,
 	Flags: []cli.Flag{
 		cli.StringFlag{Name: "image-path", Value: "", Usage: "path for saving criu image files"},
 		cli.StringFlag{Name: "work-path", Value: "", Usage: "path for saving work files and logs"},
@@ -43,6 +63,12 @@ checkpointed.`,
 		cli.StringFlag{Name: "manage-cgroups-mode", Value: "", Usage: "cgroups mode: 'soft' (default), 'full' and 'strict'"},
 		cli.StringSliceFlag{Name: "empty-ns", Usage: "create a namespace, but don't restore its properties"},
 		cli.BoolFlag{Name: "auto-dedup", Usage: "enable auto deduplication of memory images"},
+		cli.IntFlag{Name: "stream-fd", Value: -1, Usage: "stream the checkpoint images to this FD using criu-image-streamer"},
+		cli.IntFlag{Name: "pre-dumps", Usage: "pre-dump the container the given number of times before dumping it"},
+		cli.StringSliceFlag{Name: "macvlan", Usage: "checkpoint an external macvlan, as CONTAINER_IF=HOST_IF"},
+		cli.BoolFlag{Name: "external-netns", Usage: "checkpoint the network namespace as external, to be restored with --netns"},
+		cli.StringSliceFlag{Name: "external", Usage: "an external resource, in the format of criu --external (e.g. unix[INODE] or file[MNT_ID:INODE])"},
+		cli.StringSliceFlag{Name: "ext-mount", Usage: "checkpoint the bind mount at this container path as external"},
 	},
 	Action: func(context *cli.Context) error {
 		if err := checkArgs(context, 1, exactArgs); err != nil {
@@ -72,13 +98,38 @@ checkpointed.`,
 		// these are the mandatory criu options for a container
 		setPageServer(context, options)
 		setManageCgroupsMode(context, options)
+		if err := setNetworkOpts(context, options); err != nil {
+			return err
+		}
+		_, annotations := utils.Annotations(container.Config().Labels)
+		if err := setExternalOpts(context, options, annotations); err != nil {
+			return err
+		}
 		if err := setEmptyNsMask(context, options); err != nil {
 			return err
 		}
+		if n := context.Int("pre-dumps"); n > 0 {
+			return checkpointIteratively(container, options, n)
+		}
 		return container.Checkpoint(options)
 	},
 }
 
+// checkpointIteratively pre-dumps the container n times before dumping it.
+func checkpointIteratively(container libcontainer.Container, options *libcontainer.CriuOpts, n int) error {
+	if options.PreDump || options.ParentImage != "" || options.Stream != nil {
+		return errors.New("--pre-dumps can't be used with --pre-dump, --parent-path or --stream-fd")
+	}
+	ic, err := libcontainer.NewIterativeCheckpoint(container, *options)
+	if err != nil {
+		return err
+	}
+	if err := ic.PreDumps(n); err != nil {
+		return err
+	}
+	return ic.Dump()
+}
+
 func prepareImagePaths(context *cli.Context) (string, string, error) {
 	imagePath := context.String("image-path")
 	if imagePath == "" {
@@ -151,15 +202,104 @@ var namespaceMapping = map[specs.LinuxNamespaceType]int{
 	specs.NetworkNamespace: unix.CLONE_NEWNET,
 }
 
+// parseInterfacePairs parses CONTAINER_IF=HOST_IF values of the flag name.
+func parseInterfacePairs(context *cli.Context, name string) ([][2]string, error) {
+	var pairs [][2]string
+	for _, v := range context.StringSlice(name) {
+		kv := strings.SplitN(v, "=", 2)
+		if len(kv) != 2 || kv[0] == "" || kv[1] == "" {
+			return nil, fmt.Errorf("invalid --%s %q: must be CONTAINER_IF=HOST_IF", name, v)
+		}
+		pairs = append(pairs, [2]string{kv[0], kv[1]})
+	}
+	return pairs, nil
+}
+
+// setNetworkOpts sets the external network devices and namespace of options.
+func setNetworkOpts(context *cli.Context, options *libcontainer.CriuOpts) error {
+	veths, err := parseInterfacePairs(context, "veth-pair")
+	if err != nil {
+		return err
+	}
+	for _, p := range veths {
+		options.VethPairs = append(options.VethPairs, libcontainer.VethPairName{
+			ContainerInterfaceName: p[0],
+			HostInterfaceName:      p[1],
+		})
+	}
+	macvlans, err := parseInterfacePairs(context, "macvlan")
+	if err != nil {
+		return err
+	}
+	for _, p := range macvlans {
+		options.Macvlans = append(options.Macvlans, libcontainer.MacvlanName{
+			ContainerInterfaceName: p[0],
+			HostInterfaceName:      p[1],
+		})
+	}
+	options.ExternalNetNs = context.Bool("external-netns")
+	options.NetNsPath = context.String("netns")
+	return nil
+}
+
+// setExternalOpts sets the external resources and mounts of options, from
+// the annotations of the container and then the command line.
+func setExternalOpts(context *cli.Context, options *libcontainer.CriuOpts, annotations map[string]string) error {
+	if v, ok := annotations[libcontainer.CheckpointExternalAnnotation]; ok {
+		if err := json.Unmarshal([]byte(v), &options.External); err != nil {
+			return fmt.Errorf("invalid %s annotation: %w", libcontainer.CheckpointExternalAnnotation, err)
+		}
+	}
+	if v, ok := annotations[libcontainer.CheckpointExternalMountsAnnotation]; ok {
+		if err := json.Unmarshal([]byte(v), &options.ExternalMounts); err != nil {
+			return fmt.Errorf("invalid %s annotation: %w", libcontainer.CheckpointExternalMountsAnnotation, err)
+		}
+	}
+	options.External = append(options.External, context.StringSlice("external")...)
+	for _, v := range context.StringSlice("ext-mount") {
+		kv := strings.SplitN(v, "=", 2)
+		if !filepath.IsAbs(kv[0]) {
+			return fmt.Errorf("invalid --ext-mount %q: the container path must be absolute", v)
+		}
+		if options.ExternalMounts == nil {
+			options.ExternalMounts = make(map[string]string)
+		}
+		source := ""
+		if len(kv) == 2 {
+			source = kv[1]
+		}
+		options.ExternalMounts[kv[0]] = source
+	}
+	for dest := range options.ExternalMounts {
+		if !filepath.IsAbs(dest) {
+			return fmt.Errorf("invalid external mount %q: the container path must be absolute", dest)
+		}
+	}
+	return nil
+}
+
+// hasNetworkOpts returns whether the network of the container is to be
+// checkpointed or restored with the network options of options.
+func hasNetworkOpts(options *libcontainer.CriuOpts) bool {
+	return len(options.VethPairs) > 0 || len(options.Macvlans) > 0 || options.ExternalNetNs || options.NetNsPath != ""
+}
+
 func setEmptyNsMask(context *cli.Context, options *libcontainer.CriuOpts) error {
-	/* Runc doesn't manage network devices and their configuration */
-	nsmask := unix.CLONE_NEWNET
+	/* Runc doesn't manage network devices and their configuration,
+	   unless they are mapped with the network options */
+	nsmask := 0
+	if !hasNetworkOpts(options) {
+		nsmask = unix.CLONE_NEWNET
+	}
 
 	for _, ns := range context.StringSlice("empty-ns") {
 		f, exists := namespaceMapping[specs.LinuxNamespaceType(ns)]
 		if !exists {
 			return fmt.Errorf("namespace %q is not supported", ns)
 		}
+		if f == unix.CLONE_NEWNET && hasNetworkOpts(options) {
+			return errors.New("--empty-ns network can't be used with --veth-pair, --macvlan, --external-netns or --netns")
+		}
 		nsmask |= f
 	}
 
@@ -17,6 +17,7 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -28,6 +29,7 @@ import (
 	"github.com/containerd/console"
 	"github.com/opencontainers/runc/libcontainer/utils"
 	"github.com/urfave/cli"
+	"golang.org/x/sys/unix"
 )
 
 // version will be populated by the Makefile, read from
@@ -58,6 +60,12 @@ To use recvtty, just specify a socket path at which you want to receive
 terminals:
 
     $ recvtty [--mode <single|null>] socket.sock
+
+In single mode, with --attach, recvtty keeps listening on the socket for the
+requests of runc attach, and replies to each of them with a new terminal,
+multiplexed with the one of the container: the output of the container is
+copied to all the terminals, and the input of all of them is sent to the
+container.
 `
 )
 
@@ -66,7 +74,7 @@ func bail(err error) {
 	os.Exit(1)
 }
 
-func handleSingle(path string, noStdin bool) error {
+func handleSingle(path string, noStdin, attach bool) error {
 	// Open a socket.
 	ln, err := net.Listen("unix", path)
 	if err != nil {
@@ -83,7 +91,9 @@ func handleSingle(path string, noStdin bool) error {
 	defer conn.Close()
 
 	// Close ln, to allow for other instances to take over.
-	ln.Close()
+	if !attach {
+		ln.Close()
+	}
 
 	// Get the fd of the connection.
 	unixconn, ok := conn.(*net.UnixConn)
@@ -110,6 +120,13 @@ func handleSingle(path string, noStdin bool) error {
 		return err
 	}
 
+	var out io.Writer = os.Stdout
+	if attach {
+		m := &mux{c: c, out: os.Stdout}
+		out = m
+		go m.serve(ln)
+	}
+
 	// Copy from our stdio to the master fd.
 	var (
 		wg            sync.WaitGroup
@@ -117,7 +134,7 @@ func handleSingle(path string, noStdin bool) error {
 	)
 	wg.Add(1)
 	go func() {
-		_, outErr = io.Copy(os.Stdout, c)
+		_, outErr = io.Copy(out, c)
 		wg.Done()
 	}()
 	if !noStdin {
@@ -139,6 +156,103 @@ func handleSingle(path string, noStdin bool) error {
 	return inErr
 }
 
+// mux multiplexes the terminal of a container with the ones requested with
+// runc attach: it is the writer of the output of the container.
+type mux struct {
+	c   console.Console
+	out io.Writer
+
+	mu     sync.Mutex
+	slaves []*os.File
+}
+
+func (m *mux) Write(p []byte) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	slaves := m.slaves[:0]
+	for _, s := range m.slaves {
+		// Forget about the terminals which were closed.
+		if _, err := s.Write(p); err != nil {
+			s.Close()
+			continue
+		}
+		slaves = append(slaves, s)
+	}
+	m.slaves = slaves
+	return m.out.Write(p)
+}
+
+// serve replies to the runc attach requests received on ln with new
+// terminals.
+func (m *mux) serve(ln net.Listener) {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		go func(conn net.Conn) {
+			if err := m.attach(conn); err != nil {
+				fmt.Fprintf(os.Stderr, "[recvtty] attach failed: %v\n", err)
+			}
+		}(conn)
+	}
+}
+
+func (m *mux) attach(conn net.Conn) error {
+	defer conn.Close()
+	socket, err := conn.(*net.UnixConn).File()
+	if err != nil {
+		return err
+	}
+	defer socket.Close()
+
+	file, msg, err := utils.RecvFdOrMessage(socket)
+	if err != nil {
+		return err
+	}
+	if file != nil {
+		file.Close()
+		return errors.New("a terminal was already received")
+	}
+	if msg != utils.ConsoleAttachRequest {
+		return fmt.Errorf("unknown request %q", msg)
+	}
+
+	master, slavePath, err := console.NewPty()
+	if err != nil {
+		return err
+	}
+	defer master.Close()
+	slave, err := os.OpenFile(slavePath, os.O_RDWR|unix.O_NOCTTY, 0)
+	if err != nil {
+		return err
+	}
+	// The slave is only a pipe to the terminal of the container.
+	sc, err := console.ConsoleFromFile(slave)
+	if err != nil {
+		slave.Close()
+		return err
+	}
+	if err := sc.SetRaw(); err != nil {
+		slave.Close()
+		return err
+	}
+	if err := utils.SendFd(socket, master.Name(), master.Fd()); err != nil {
+		slave.Close()
+		return err
+	}
+
+	m.mu.Lock()
+	m.slaves = append(m.slaves, slave)
+	m.mu.Unlock()
+	// Copy the input of the new terminal to the container, until it's
+	// closed by the client.
+	go func() {
+		_, _ = io.Copy(m.c, slave)
+	}()
+	return nil
+}
+
 func handleNull(path string) error {
 	// Open a socket.
 	ln, err := net.Listen("unix", path)
@@ -212,6 +326,10 @@ func main() {
 			Name:  "no-stdin",
 			Usage: "Disable stdin handling (no-op for null mode)",
 		},
+		cli.BoolFlag{
+			Name:  "attach",
+			Usage: "Reply to the requests of runc attach with new terminals (single mode only)",
+		},
 	}
 
 	app.Action = func(ctx *cli.Context) error {
@@ -232,7 +350,7 @@ func main() {
 		noStdin := ctx.Bool("no-stdin")
 		switch ctx.String("mode") {
 		case "single":
-			if err := handleSingle(path, noStdin); err != nil {
+			if err := handleSingle(path, noStdin, ctx.Bool("attach")); err != nil {
 				return err
 			}
 		case "null":
@@ -1,10 +1,6 @@
 package main
 
-import (
-	"os"
-
-	"github.com/urfave/cli"
-)
+import "github.com/urfave/cli"
 
 var createCommand = cli.Command{
 	Name:  "create",
@@ -46,10 +42,22 @@ command(s) that get executed on start, edit the args parameter of the spec. See
 			Name:  "no-new-keyring",
 			Usage: "do not create a new session keyring for the container.  This will cause the container to inherit the calling processes session key",
 		},
+		cli.BoolFlag{
+			Name:  "sched-core",
+			Usage: "create a new core scheduling cookie for the container, so that no other tasks run on the SMT siblings of the cores it runs on",
+		},
+		cli.BoolFlag{
+			Name:  "selinux-mcs",
+			Usage: "allocate a unique SELinux MCS level to the container, if the spec has no process label",
+		},
 		cli.IntFlag{
 			Name:  "preserve-fds",
 			Usage: "Pass N additional file descriptors to the container (stdio + $LISTEN_FDS + N in total)",
 		},
+		cli.StringSliceFlag{
+			Name:  "device",
+			Usage: "inject the CDI device with the given fully qualified name (e.g. vendor.com/gpu=gpu0) into the container",
+		},
 	},
 	Action: func(context *cli.Context) error {
 		if err := checkArgs(context, 1, exactArgs); err != nil {
@@ -68,7 +76,7 @@ command(s) that get executed on start, edit the args parameter of the spec. See
 		}
 		// exit with the container's exit status so any external supervisor is
 		// notified of the exit with the correct exit status.
-		os.Exit(status)
+		exitWithStatus(status)
 		return nil
 	},
 }
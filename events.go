@@ -26,10 +26,45 @@ var eventsCommand = cli.Command{
 
 Where "<container-id>" is the name for the instance of the container.`,
 	Description: `The events command displays information about the container. By default the
-information is displayed once every 5 seconds.`,
+information is displayed once every 5 seconds.
+
+Besides the periodic "stats" events, an "oom" event is emitted every time the
+container hits its memory limit, and an "oom_kill" event (with the number of
+killed processes) every time the OOM killer kills a container process.
+
+With --pressure, a pressure stall information (PSI) trigger is registered on
+the container's cgroup, and a "pressure" event is emitted every time the tasks
+of the container are stalled on the resource for at least the threshold within
+the window. The trigger is given as <resource>=<some|full>,<threshold>/<window>,
+where resource is one of cpu, memory or io, for example "memory=some,150ms/1s".
+The window must be between 500ms and 10s. This option can be specified
+multiple times, and requires cgroup v2.
+
+If the container was created with the global --audit-devices option, a
+"device_denied" event (with the pid of the process, and the type, major and
+minor numbers and access of the device) is emitted every time a process of
+the container is denied access to a device. Only one "runc events" command
+gets each of these events. On cgroup v1, this requires the unified hierarchy
+to be mounted on /sys/fs/cgroup/unified.
+
+With --stats, --format openmetrics displays the stats in the OpenMetrics text
+format instead of JSON, so they can be scraped by Prometheus compatible
+collectors.
+
+With --device-stats-plugin, the stats of the devices of the container, such
+as GPUs, are added to its stats by the given program, e.g. one provided by
+the vendor of the devices. The program is run with the container id as its
+argument and the devices of the container as a JSON array on its stdin, and
+writes the stats of the devices it knows of to its stdout as a JSON array of
+objects with the "path", "major" and "minor" of the device and its "metrics",
+an object mapping the metric names to their values. This option can be
+specified multiple times.`,
 	Flags: []cli.Flag{
 		cli.DurationFlag{Name: "interval", Value: 5 * time.Second, Usage: "set the stats collection interval"},
 		cli.BoolFlag{Name: "stats", Usage: "display the container's stats then exit"},
+		cli.StringFlag{Name: "format, f", Value: "json", Usage: "select the output format of the stats (json or openmetrics)"},
+		cli.StringSliceFlag{Name: "pressure", Usage: "emit an event when a PSI trigger (e.g. memory=some,150ms/1s) fires"},
+		cli.StringSliceFlag{Name: "device-stats-plugin", Usage: "path to a program adding the stats of the devices of the container"},
 	},
 	Action: func(context *cli.Context) error {
 		if err := checkArgs(context, 1, exactArgs); err != nil {
@@ -43,6 +78,23 @@ information is displayed once every 5 seconds.`,
 		if duration <= 0 {
 			return errors.New("duration interval must be greater than 0")
 		}
+		switch context.String("format") {
+		case "json":
+		case "openmetrics":
+			if !context.Bool("stats") {
+				return errors.New("--format openmetrics can only be used with --stats")
+			}
+		default:
+			return errors.New("invalid format option")
+		}
+		var triggers []libcontainer.PSITrigger
+		for _, p := range context.StringSlice("pressure") {
+			t, err := libcontainer.ParsePSITrigger(p)
+			if err != nil {
+				return err
+			}
+			triggers = append(triggers, t)
+		}
 		status, err := container.Status()
 		if err != nil {
 			return err
@@ -70,6 +122,11 @@ information is displayed once every 5 seconds.`,
 			if err != nil {
 				return err
 			}
+			if context.String("format") == "openmetrics" {
+				close(events)
+				group.Wait()
+				return types.WriteOpenMetrics(os.Stdout, container.ID(), convertLibcontainerStats(s))
+			}
 			events <- &types.Event{Type: "stats", ID: container.ID(), Data: convertLibcontainerStats(s)}
 			close(events)
 			group.Wait()
@@ -89,8 +146,37 @@ information is displayed once every 5 seconds.`,
 		if err != nil {
 			return err
 		}
+		k, err := container.NotifyOOMKill()
+		if err != nil {
+			return err
+		}
+		var denied <-chan libcontainer.DeviceDeniedEvent
+		if cg := container.Config().Cgroups; cg != nil && cg.AuditDevices {
+			denied, err = container.NotifyDeviceDenied()
+			if err != nil {
+				return err
+			}
+		}
+		pressure := make(chan libcontainer.PSITrigger)
+		for _, t := range triggers {
+			p, err := container.NotifyPSI(t)
+			if err != nil {
+				return err
+			}
+			go func(t libcontainer.PSITrigger) {
+				for range p {
+					pressure <- t
+				}
+			}(t)
+		}
 		for {
 			select {
+			case ev, ok := <-k:
+				if ok {
+					events <- &types.Event{Type: "oom_kill", ID: container.ID(), Data: &types.OOMKill{Count: ev.Count, Total: ev.Total}}
+				} else {
+					k = nil
+				}
 			case _, ok := <-n:
 				if ok {
 					// this means an oom event was received, if it is !ok then
@@ -100,6 +186,14 @@ information is displayed once every 5 seconds.`,
 				} else {
 					n = nil
 				}
+			case ev, ok := <-denied:
+				if ok {
+					events <- &types.Event{Type: "device_denied", ID: container.ID(), Data: convertDeviceDenied(ev)}
+				} else {
+					denied = nil
+				}
+			case t := <-pressure:
+				events <- &types.Event{Type: "pressure", ID: container.ID(), Data: convertPSITrigger(t)}
 			case s := <-stats:
 				events <- &types.Event{Type: "stats", ID: container.ID(), Data: convertLibcontainerStats(s)}
 			}
@@ -113,6 +207,16 @@ information is displayed once every 5 seconds.`,
 	},
 }
 
+func convertDeviceDenied(ev libcontainer.DeviceDeniedEvent) *types.DeviceDenied {
+	return &types.DeviceDenied{
+		Pid:    ev.Pid,
+		Type:   string(ev.Type),
+		Major:  ev.Major,
+		Minor:  ev.Minor,
+		Access: string(ev.Permissions),
+	}
+}
+
 func convertLibcontainerStats(ls *libcontainer.Stats) *types.Stats {
 	cg := ls.CgroupStats
 	if cg == nil {
@@ -131,6 +235,9 @@ func convertLibcontainerStats(ls *libcontainer.Stats) *types.Stats {
 	s.CPU.Throttling.Periods = cg.CpuStats.ThrottlingData.Periods
 	s.CPU.Throttling.ThrottledPeriods = cg.CpuStats.ThrottlingData.ThrottledPeriods
 	s.CPU.Throttling.ThrottledTime = cg.CpuStats.ThrottlingData.ThrottledTime
+	s.CPU.Burst.BurstsPeriods = cg.CpuStats.BurstData.BurstsPeriods
+	s.CPU.Burst.BurstTime = cg.CpuStats.BurstData.BurstTime
+	s.CPU.PSI = convertPSI(cg.CpuStats.PSI)
 
 	s.CPUSet = types.CPUSet(cg.CPUSetStats)
 
@@ -138,8 +245,14 @@ func convertLibcontainerStats(ls *libcontainer.Stats) *types.Stats {
 	s.Memory.Kernel = convertMemoryEntry(cg.MemoryStats.KernelUsage)
 	s.Memory.KernelTCP = convertMemoryEntry(cg.MemoryStats.KernelTCPUsage)
 	s.Memory.Swap = convertMemoryEntry(cg.MemoryStats.SwapUsage)
+	s.Memory.SwapOnly = convertMemoryEntry(cg.MemoryStats.SwapOnlyUsage)
+	s.Memory.Zswap = convertMemoryEntry(cg.MemoryStats.ZswapUsage)
 	s.Memory.Usage = convertMemoryEntry(cg.MemoryStats.Usage)
 	s.Memory.Raw = cg.MemoryStats.Stats
+	s.Memory.PSI = convertPSI(cg.MemoryStats.PSI)
+	s.Memory.Events = convertMemoryEvents(cg.MemoryStats.Events)
+	s.Memory.EventsLocal = convertMemoryEvents(cg.MemoryStats.EventsLocal)
+	s.Memory.NUMA = convertPageUsageByNUMA(cg.MemoryStats.PageUsageByNUMA)
 
 	s.Blkio.IoServiceBytesRecursive = convertBlkioEntry(cg.BlkioStats.IoServiceBytesRecursive)
 	s.Blkio.IoServicedRecursive = convertBlkioEntry(cg.BlkioStats.IoServicedRecursive)
@@ -149,18 +262,34 @@ func convertLibcontainerStats(ls *libcontainer.Stats) *types.Stats {
 	s.Blkio.IoMergedRecursive = convertBlkioEntry(cg.BlkioStats.IoMergedRecursive)
 	s.Blkio.IoTimeRecursive = convertBlkioEntry(cg.BlkioStats.IoTimeRecursive)
 	s.Blkio.SectorsRecursive = convertBlkioEntry(cg.BlkioStats.SectorsRecursive)
+	s.Blkio.PSI = convertPSI(cg.BlkioStats.PSI)
+
+	s.Rdma.RdmaLimit = convertRdmaEntry(cg.RdmaStats.RdmaLimit)
+	s.Rdma.RdmaCurrent = convertRdmaEntry(cg.RdmaStats.RdmaCurrent)
 
 	s.Hugetlb = make(map[string]types.Hugetlb)
 	for k, v := range cg.HugetlbStats {
 		s.Hugetlb[k] = convertHugtlb(v)
 	}
 
+	if len(cg.MiscStats) > 0 {
+		s.Misc = make(map[string]types.Misc, len(cg.MiscStats))
+		for k, v := range cg.MiscStats {
+			s.Misc[k] = types.Misc(v)
+		}
+	}
+
 	if is := ls.IntelRdtStats; is != nil {
 		if intelrdt.IsCATEnabled() {
 			s.IntelRdt.L3CacheInfo = convertL3CacheInfo(is.L3CacheInfo)
 			s.IntelRdt.L3CacheSchemaRoot = is.L3CacheSchemaRoot
 			s.IntelRdt.L3CacheSchema = is.L3CacheSchema
 		}
+		if intelrdt.IsL2CATEnabled() {
+			s.IntelRdt.L2CacheInfo = convertL2CacheInfo(is.L2CacheInfo)
+			s.IntelRdt.L2CacheSchemaRoot = is.L2CacheSchemaRoot
+			s.IntelRdt.L2CacheSchema = is.L2CacheSchema
+		}
 		if intelrdt.IsMBAEnabled() {
 			s.IntelRdt.MemBwInfo = convertMemBwInfo(is.MemBwInfo)
 			s.IntelRdt.MemBwSchemaRoot = is.MemBwSchemaRoot
@@ -175,15 +304,44 @@ func convertLibcontainerStats(ls *libcontainer.Stats) *types.Stats {
 	}
 
 	s.NetworkInterfaces = ls.Interfaces
+
+	for _, d := range cg.DeviceStats {
+		s.Devices = append(s.Devices, types.DeviceStats(d))
+	}
 	return &s
 }
 
 func convertHugtlb(c cgroups.HugetlbStats) types.Hugetlb {
 	return types.Hugetlb{
-		Usage:   c.Usage,
-		Max:     c.MaxUsage,
-		Failcnt: c.Failcnt,
+		Usage:       c.Usage,
+		Max:         c.MaxUsage,
+		Failcnt:     c.Failcnt,
+		RsvdUsage:   c.RsvdUsage,
+		RsvdMax:     c.RsvdMaxUsage,
+		RsvdFailcnt: c.RsvdFailcnt,
+	}
+}
+
+// convertPageUsageByNUMA returns the memory usage by NUMA node, including the
+// descendant cgroups if known.
+func convertPageUsageByNUMA(p cgroups.PageUsageByNUMA) map[uint8]types.MemoryNUMA {
+	usage := p.Hierarchical
+	if usage.Total.Nodes == nil {
+		usage = p.PageUsageByNUMAInner
 	}
+	if usage.Total.Nodes == nil {
+		return nil
+	}
+	numa := make(map[uint8]types.MemoryNUMA, len(usage.Total.Nodes))
+	for n, total := range usage.Total.Nodes {
+		numa[n] = types.MemoryNUMA{
+			Total:       total,
+			Anon:        usage.Anon.Nodes[n],
+			File:        usage.File.Nodes[n],
+			Unevictable: usage.Unevictable.Nodes[n],
+		}
+	}
+	return numa
 }
 
 func convertMemoryEntry(c cgroups.MemoryData) types.MemoryEntry {
@@ -203,11 +361,55 @@ func convertBlkioEntry(c []cgroups.BlkioStatEntry) []types.BlkioEntry {
 	return out
 }
 
+func convertRdmaEntry(c []cgroups.RdmaEntry) []types.RdmaEntry {
+	var out []types.RdmaEntry
+	for _, e := range c {
+		out = append(out, types.RdmaEntry(e))
+	}
+	return out
+}
+
+func convertPSI(p *cgroups.PSIStats) *types.PSIStats {
+	if p == nil {
+		return nil
+	}
+	return &types.PSIStats{
+		Some: types.PSIData(p.Some),
+		Full: types.PSIData(p.Full),
+	}
+}
+
+func convertMemoryEvents(e *cgroups.MemoryEvents) *types.MemoryEvents {
+	if e == nil {
+		return nil
+	}
+	ev := types.MemoryEvents(*e)
+	return &ev
+}
+
+func convertPSITrigger(t libcontainer.PSITrigger) *types.Pressure {
+	p := &types.Pressure{
+		Resource:  t.Resource,
+		Type:      "some",
+		Threshold: uint64(t.Threshold.Microseconds()),
+		Window:    uint64(t.Window.Microseconds()),
+	}
+	if t.Full {
+		p.Type = "full"
+	}
+	return p
+}
+
 func convertL3CacheInfo(i *intelrdt.L3CacheInfo) *types.L3CacheInfo {
 	ci := types.L3CacheInfo(*i)
 	return &ci
 }
 
+func convertL2CacheInfo(i *intelrdt.L2CacheInfo) *types.L2CacheInfo {
+	ci := types.L2CacheInfo(*i)
+	return &ci
+}
+
 func convertMemBwInfo(i *intelrdt.MemBwInfo) *types.MemBwInfo {
 	mi := types.MemBwInfo(*i)
 	return &mi
@@ -3,13 +3,18 @@
 package main
 
 import (
+	"bufio"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
 
+	"github.com/docker/go-units"
 	"github.com/opencontainers/runc/libcontainer"
+	"github.com/opencontainers/runc/libcontainer/configs"
 	"github.com/opencontainers/runc/libcontainer/utils"
 	"github.com/opencontainers/runtime-spec/specs-go"
 	"github.com/urfave/cli"
@@ -42,13 +47,25 @@ following will output a list of processes running in the container:
 			Name:  "env, e",
 			Usage: "set environment variables",
 		},
+		cli.StringSliceFlag{
+			Name:  "env-file",
+			Usage: "read environment variables from a file, with one KEY=VALUE per line",
+		},
+		cli.StringSliceFlag{
+			Name:  "preserve-env",
+			Usage: "pass the environment variables of runc matching the given name, or shell pattern (e.g. 'AWS_*')",
+		},
 		cli.BoolFlag{
 			Name:  "tty, t",
 			Usage: "allocate a pseudo-TTY",
 		},
 		cli.StringFlag{
 			Name:  "user, u",
-			Usage: "UID (format: <uid>[:<gid>])",
+			Usage: "UID (format: <uid>[:<gid>]), or user name with --user-from-image (format: <uid|name>[:<gid|group>])",
+		},
+		cli.BoolFlag{
+			Name:  "user-from-image",
+			Usage: "resolve the user, its supplementary groups and HOME from the /etc/passwd and /etc/group files of the container",
 		},
 		cli.Int64SliceFlag{
 			Name:  "additional-gids, g",
@@ -93,6 +110,26 @@ following will output a list of processes running in the container:
 			Name:  "preserve-fds",
 			Usage: "Pass N additional file descriptors to the container (stdio + $LISTEN_FDS + N in total)",
 		},
+		cli.StringFlag{
+			Name:  "cgroup",
+			Usage: "run the process in the given child cgroup of the container (created if it does not exist), e.g. \"monitoring\" (cgroup v1 only)",
+		},
+		cli.StringFlag{
+			Name:  "cgroup-memory",
+			Usage: "memory limit (in bytes) of the child cgroup given with --cgroup",
+		},
+		cli.StringFlag{
+			Name:  "cgroup-cpu-share",
+			Usage: "CPU shares of the child cgroup given with --cgroup",
+		},
+		cli.StringFlag{
+			Name:  "cgroup-cpu-quota",
+			Usage: "CPU CFS hardcap limit (in usecs) of the child cgroup given with --cgroup",
+		},
+		cli.IntFlag{
+			Name:  "oom-score-adj",
+			Usage: "set the oom_score_adj of the process (-1000 to 1000), instead of the one of the container",
+		},
 	},
 	Action: func(context *cli.Context) error {
 		if err := checkArgs(context, 1, minArgs); err != nil {
@@ -103,7 +140,7 @@ following will output a list of processes running in the container:
 		}
 		status, err := execProcess(context)
 		if err == nil {
-			os.Exit(status)
+			exitWithStatus(status)
 		}
 		return fmt.Errorf("exec failed: %v", err)
 	},
@@ -142,10 +179,13 @@ func execProcess(context *cli.Context) (int, error) {
 		logLevel = "debug"
 	}
 
+	listenFDs, listenFDNames := inheritedListenFDs()
 	r := &runner{
 		enableSubreaper: false,
 		shouldDestroy:   false,
 		container:       container,
+		listenFDs:       listenFDs,
+		listenFDNames:   listenFDNames,
 		consoleSocket:   context.String("console-socket"),
 		detach:          detach,
 		pidFile:         context.String("pid-file"),
@@ -153,10 +193,59 @@ func execProcess(context *cli.Context) (int, error) {
 		init:            false,
 		preserveFDs:     context.Int("preserve-fds"),
 		logLevel:        logLevel,
+		subCgroup:       context.String("cgroup"),
+	}
+	if context.Bool("user-from-image") {
+		r.user = context.String("user")
+	}
+	if r.subCgroupResources, err = getSubCgroupResources(context); err != nil {
+		return -1, err
+	}
+	// Without a process file, the I/O priority of the container is used.
+	if path != "" {
+		ext, err := loadProcessExtensions(path)
+		if err != nil {
+			return -1, err
+		}
+		r.ioPriority = ext.IOPriority
 	}
 	return r.run(p)
 }
 
+// getSubCgroupResources returns the limits of the child cgroup given with
+// --cgroup, or nil if none are set.
+func getSubCgroupResources(context *cli.Context) (*configs.Resources, error) {
+	if context.String("cgroup-memory") == "" && context.String("cgroup-cpu-share") == "" && context.String("cgroup-cpu-quota") == "" {
+		return nil, nil
+	}
+	if context.String("cgroup") == "" {
+		return nil, errors.New("the limits of a child cgroup require --cgroup")
+	}
+	r := &configs.Resources{}
+	if val := context.String("cgroup-memory"); val != "" {
+		v, err := units.RAMInBytes(val)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value for cgroup-memory: %s", err)
+		}
+		r.Memory = v
+	}
+	if val := context.String("cgroup-cpu-share"); val != "" {
+		v, err := strconv.ParseUint(val, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value for cgroup-cpu-share: %s", err)
+		}
+		r.CpuShares = v
+	}
+	if val := context.String("cgroup-cpu-quota"); val != "" {
+		v, err := strconv.ParseInt(val, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value for cgroup-cpu-quota: %s", err)
+		}
+		r.CpuQuota = v
+	}
+	return r, nil
+}
+
 func getProcess(context *cli.Context, bundle string) (*specs.Process, error) {
 	if path := context.String("process"); path != "" {
 		f, err := os.Open(path)
@@ -171,6 +260,12 @@ func getProcess(context *cli.Context, bundle string) (*specs.Process, error) {
 		return &p, validateProcessSpec(&p)
 	}
 	// process via cli flags
+	// The environment files are read before changing to the bundle
+	// directory, so that their relative paths are the ones of the caller.
+	env, err := execEnv(context)
+	if err != nil {
+		return nil, err
+	}
 	if err := os.Chdir(bundle); err != nil {
 		return nil, err
 	}
@@ -200,7 +295,7 @@ func getProcess(context *cli.Context, bundle string) (*specs.Process, error) {
 		}
 	}
 	// append the passed env variables
-	p.Env = append(p.Env, context.StringSlice("env")...)
+	p.Env = append(p.Env, env...)
 
 	// set the tty
 	p.Terminal = false
@@ -210,8 +305,16 @@ func getProcess(context *cli.Context, bundle string) (*specs.Process, error) {
 	if context.IsSet("no-new-privs") {
 		p.NoNewPrivileges = context.Bool("no-new-privs")
 	}
+	if context.IsSet("oom-score-adj") {
+		adj := context.Int("oom-score-adj")
+		if adj < -1000 || adj > 1000 {
+			return nil, fmt.Errorf("invalid oom-score-adj %d, it must be between -1000 and 1000", adj)
+		}
+		p.OOMScoreAdj = &adj
+	}
 	// override the user, if passed
-	if context.String("user") != "" {
+	// With --user-from-image, the user is resolved by the runner.
+	if context.String("user") != "" && !context.Bool("user-from-image") {
 		u := strings.SplitN(context.String("user"), ":", 2)
 		if len(u) > 1 {
 			gid, err := strconv.Atoi(u[1])
@@ -234,3 +337,70 @@ func getProcess(context *cli.Context, bundle string) (*specs.Process, error) {
 	}
 	return p, validateProcessSpec(p)
 }
+
+// execEnv returns the environment variables to add to the one of the process,
+// in order of increasing precedence: those read from the --env-file files,
+// those of runc matching --preserve-env, and those given with --env.
+func execEnv(context *cli.Context) ([]string, error) {
+	var env []string
+	for _, path := range context.StringSlice("env-file") {
+		fileEnv, err := readEnvFile(path)
+		if err != nil {
+			return nil, err
+		}
+		env = append(env, fileEnv...)
+	}
+	if patterns := context.StringSlice("preserve-env"); len(patterns) > 0 {
+		for _, pattern := range patterns {
+			if _, err := filepath.Match(pattern, ""); err != nil {
+				return nil, fmt.Errorf("invalid --preserve-env pattern %q: %w", pattern, err)
+			}
+		}
+		for _, kv := range os.Environ() {
+			name := strings.SplitN(kv, "=", 2)[0]
+			for _, pattern := range patterns {
+				if ok, _ := filepath.Match(pattern, name); ok {
+					env = append(env, kv)
+					break
+				}
+			}
+		}
+	}
+	return append(env, context.StringSlice("env")...), nil
+}
+
+// readEnvFile reads the environment variables of the file path, which has one
+// KEY=VALUE per line. Empty lines and lines starting with # are ignored, and
+// a line with only a KEY passes the variable of runc, if it is set. Values are
+// taken as is, without removing quotes.
+func readEnvFile(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var env []string
+	s := bufio.NewScanner(f)
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		kv := strings.SplitN(line, "=", 2)
+		if kv[0] == "" || strings.ContainsAny(kv[0], " \t") {
+			return nil, fmt.Errorf("%s:%d: invalid variable name %q", path, n, kv[0])
+		}
+		if len(kv) == 1 {
+			if val, ok := os.LookupEnv(kv[0]); ok {
+				env = append(env, kv[0]+"="+val)
+			}
+			continue
+		}
+		env = append(env, line)
+	}
+	if err := s.Err(); err != nil {
+		return nil, fmt.Errorf("reading %s: %w", path, err)
+	}
+	return env, nil
+}
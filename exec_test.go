@@ -0,0 +1,85 @@
+// +build linux
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestReadEnvFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "runc-env-file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	defer setenv(t, "RUNC_TEST_ENV", "from runc")()
+	os.Unsetenv("RUNC_TEST_UNSET")
+
+	for _, tc := range []struct {
+		name    string
+		content string
+		env     []string
+		invalid bool
+	}{
+		{
+			name:    "empty",
+			content: "",
+		},
+		{
+			name:    "comments and blank lines",
+			content: "# comment\n\nA=1\n   \n  # indented comment\nB=2\n",
+			env:     []string{"A=1", "B=2"},
+		},
+		{
+			name:    "quotes are kept",
+			content: "A=\"quoted value\"\nB='single'\n",
+			env:     []string{"A=\"quoted value\"", "B='single'"},
+		},
+		{
+			name:    "values",
+			content: "A=\nB=x=y\n  C=trimmed  \nD=# not a comment\n",
+			env:     []string{"A=", "B=x=y", "C=trimmed", "D=# not a comment"},
+		},
+		{
+			name:    "no =",
+			content: "RUNC_TEST_ENV\nRUNC_TEST_UNSET\n",
+			env:     []string{"RUNC_TEST_ENV=from runc"},
+		},
+		{
+			name:    "no name",
+			content: "=value\n",
+			invalid: true,
+		},
+		{
+			name:    "space in name",
+			content: "A B=value\n",
+			invalid: true,
+		},
+	} {
+		path := filepath.Join(dir, "env")
+		if err := ioutil.WriteFile(path, []byte(tc.content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		env, err := readEnvFile(path)
+		if tc.invalid {
+			if err == nil {
+				t.Errorf("%s: expected an error, got %q", tc.name, env)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tc.name, err)
+		} else if !reflect.DeepEqual(env, tc.env) {
+			t.Errorf("%s: expected %q, got %q", tc.name, tc.env, env)
+		}
+	}
+
+	if _, err := readEnvFile(filepath.Join(dir, "nonexistent")); err == nil {
+		t.Error("expected an error reading a nonexistent file")
+	}
+}
@@ -0,0 +1,129 @@
+// +build linux
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/checkpoint-restore/go-criu/v5"
+	"github.com/opencontainers/runc/libcontainer"
+	"github.com/opencontainers/runc/libcontainer/apparmor"
+	"github.com/opencontainers/runc/libcontainer/capabilities"
+	"github.com/opencontainers/runc/libcontainer/cdi"
+	"github.com/opencontainers/runc/libcontainer/cgroups"
+	"github.com/opencontainers/runc/libcontainer/cgroups/systemd"
+	"github.com/opencontainers/runc/libcontainer/configs"
+	"github.com/opencontainers/runc/libcontainer/intelrdt"
+	"github.com/opencontainers/runc/libcontainer/seccomp"
+	"github.com/opencontainers/runc/libcontainer/specconv"
+	"github.com/opencontainers/runc/libcontainer/system"
+	"github.com/opencontainers/runc/types/features"
+	"github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/opencontainers/selinux/go-selinux"
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli"
+)
+
+var featuresCommand = cli.Command{
+	Name:      "features",
+	Usage:     "show the enabled features",
+	ArgsUsage: "",
+	Description: `Show the features of the runc binary and of the host, such as the supported
+namespaces, cgroup controllers and seccomp actions, as JSON.
+
+The output is meant to be consumed by higher level container engines, rather
+than them guessing the features from the runc version.`,
+	Action: func(context *cli.Context) error {
+		if err := checkArgs(context, 0, exactArgs); err != nil {
+			return err
+		}
+
+		feat := features.Features{
+			OCIVersionMin: "1.0.0",
+			OCIVersionMax: specs.Version,
+			Version:       version,
+			Hooks: []string{
+				string(configs.Prestart),
+				string(configs.CreateRuntime),
+				string(configs.CreateContainer),
+				string(configs.StartContainer),
+				string(configs.Poststart),
+				string(configs.Poststop),
+			},
+			Annotations: append([]string{
+				appArmorProfileFileAnnotation,
+				cdi.AnnotationPrefix,
+				"org.criu.config",
+				libcontainer.CheckpointExternalAnnotation,
+				libcontainer.CheckpointExternalMountsAnnotation,
+			}, specconv.KnownAnnotations()...),
+			Linux: &features.Linux{
+				Namespaces:     specconv.KnownNamespaces(),
+				Capabilities:   capabilities.KnownCapabilities(),
+				Cgroup:         cgroupFeatures(context),
+				Seccomp:        seccompFeatures(),
+				IDMappedMounts: system.IsIDMappedMountSupported(),
+				Checkpoint:     checkpointFeatures(context),
+				AppArmor:       &features.Enabled{Enabled: apparmor.IsEnabled()},
+				SELinux:        &features.Enabled{Enabled: selinux.GetEnabled()},
+				IntelRdt:       &features.Enabled{Enabled: intelrdt.IsCATEnabled() || intelrdt.IsMBAEnabled()},
+			},
+		}
+
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "    ")
+		return enc.Encode(feat)
+	},
+}
+
+func cgroupFeatures(context *cli.Context) *features.Cgroup {
+	cg := &features.Cgroup{
+		Version: 1,
+		Systemd: systemd.IsRunningSystemd(),
+	}
+	if cgroups.IsCgroup2UnifiedMode() {
+		cg.Version = 2
+	}
+
+	var (
+		controllers []string
+		err         error
+	)
+	rootless, _ := shouldUseRootlessCgroupManager(context)
+	if rootless && cg.Version == 2 && cg.Systemd {
+		controllers, err = systemd.DelegatedControllers()
+	} else {
+		controllers, err = cgroups.GetAllSubsystems()
+	}
+	if err != nil {
+		logrus.Debugf("unable to get the cgroup controllers: %v", err)
+	}
+	cg.Controllers = controllers
+	return cg
+}
+
+func seccompFeatures() *features.Seccomp {
+	major, minor, micro := seccomp.Version()
+	enabled := major+minor+micro > 0
+	s := &features.Seccomp{Enabled: enabled}
+	if enabled {
+		s.LibseccompVersion = fmt.Sprintf("%d.%d.%d", major, minor, micro)
+		s.Actions = seccomp.KnownActions()
+		s.Operators = seccomp.KnownOperators()
+		s.Archs = seccomp.KnownArchs()
+	}
+	return s
+}
+
+func checkpointFeatures(context *cli.Context) *features.Checkpoint {
+	c := criu.MakeCriu()
+	c.SetCriuPath(context.GlobalString("criu"))
+	v, err := c.GetCriuVersion()
+	if err != nil {
+		logrus.Debugf("unable to get the criu version: %v", err)
+		return &features.Checkpoint{}
+	}
+	return &features.Checkpoint{Enabled: true, CriuVersion: v}
+}
@@ -9,6 +9,7 @@ import (
 	"github.com/opencontainers/runc/libcontainer"
 	"github.com/opencontainers/runc/libcontainer/logs"
 	_ "github.com/opencontainers/runc/libcontainer/nsenter"
+	"github.com/opencontainers/runc/libcontainer/trace"
 	"github.com/sirupsen/logrus"
 	"github.com/urfave/cli"
 )
@@ -37,6 +38,9 @@ func init() {
 		if err != nil {
 			panic(fmt.Sprintf("libcontainer: failed to configure logging: %v", err))
 		}
+		if os.Getenv("_LIBCONTAINER_TRACE") != "" {
+			trace.InitForwarding(logs.ForwardSpan)
+		}
 		logrus.Debug("child process in init()")
 	}
 }
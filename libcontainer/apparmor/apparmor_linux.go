@@ -1,10 +1,13 @@
 package apparmor
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 	"io/ioutil"
 	"os"
+	"os/exec"
+	"strings"
 	"sync"
 
 	"github.com/opencontainers/runc/libcontainer/utils"
@@ -66,3 +69,28 @@ func ApplyProfile(name string) error {
 
 	return changeOnExec(name)
 }
+
+// LoadProfile loads the AppArmor profiles defined in the file at path into
+// the kernel (replacing the already loaded ones with the same names), using
+// apparmor_parser(8), and returns their names.
+func LoadProfile(path string) ([]string, error) {
+	names, err := runParser("--names", path)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := runParser("--replace", path); err != nil {
+		return nil, err
+	}
+	return strings.Fields(names), nil
+}
+
+func runParser(args ...string) (string, error) {
+	var stderr bytes.Buffer
+	cmd := exec.Command("apparmor_parser", args...)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("apparmor_parser %s failed: %w: %s", strings.Join(args, " "), err, strings.TrimSpace(stderr.String()))
+	}
+	return string(out), nil
+}
@@ -18,3 +18,7 @@ func ApplyProfile(name string) error {
 	}
 	return nil
 }
+
+func LoadProfile(path string) ([]string, error) {
+	return nil, ErrApparmorNotEnabled
+}
@@ -3,16 +3,17 @@
 package capabilities
 
 import (
+	"fmt"
+	"os"
 	"sort"
 	"strings"
 
 	"github.com/opencontainers/runc/libcontainer/configs"
 	"github.com/sirupsen/logrus"
 	"github.com/syndtr/gocapability/capability"
+	"golang.org/x/sys/unix"
 )
 
-const allCapabilityTypes = capability.CAPS | capability.BOUNDING | capability.AMBIENT
-
 var (
 	capabilityMap map[string]capability.Cap
 	capTypes      = []capability.CapType{
@@ -27,15 +28,12 @@ var (
 func init() {
 	capabilityMap = make(map[string]capability.Cap, capability.CAP_LAST_CAP+1)
 	for _, c := range capability.List() {
-		if c > capability.CAP_LAST_CAP {
-			continue
-		}
-		capabilityMap["CAP_"+strings.ToUpper(c.String())] = c
+		capabilityMap[capName(c)] = c
 	}
 }
 
 // New creates a new Caps from the given Capabilities config. Unknown Capabilities
-// or Capabilities that are unavailable in the current environment are ignored,
+// or Capabilities that are unavailable in the running kernel are ignored,
 // printing a warning instead.
 func New(capConfig *configs.Capabilities) (*Caps, error) {
 	var (
@@ -44,12 +42,13 @@ func New(capConfig *configs.Capabilities) (*Caps, error) {
 	)
 
 	unknownCaps := make(map[string]struct{})
+	unavailableCaps := make(map[string]struct{})
 	c.caps = map[capability.CapType][]capability.Cap{
-		capability.BOUNDING:    capSlice(capConfig.Bounding, unknownCaps),
-		capability.EFFECTIVE:   capSlice(capConfig.Effective, unknownCaps),
-		capability.INHERITABLE: capSlice(capConfig.Inheritable, unknownCaps),
-		capability.PERMITTED:   capSlice(capConfig.Permitted, unknownCaps),
-		capability.AMBIENT:     capSlice(capConfig.Ambient, unknownCaps),
+		capability.BOUNDING:    capSlice(capConfig.Bounding, unknownCaps, unavailableCaps),
+		capability.EFFECTIVE:   capSlice(capConfig.Effective, unknownCaps, unavailableCaps),
+		capability.INHERITABLE: capSlice(capConfig.Inheritable, unknownCaps, unavailableCaps),
+		capability.PERMITTED:   capSlice(capConfig.Permitted, unknownCaps, unavailableCaps),
+		capability.AMBIENT:     capSlice(capConfig.Ambient, unknownCaps, unavailableCaps),
 	}
 	if c.pid, err = capability.NewPid2(0); err != nil {
 		return nil, err
@@ -58,20 +57,71 @@ func New(capConfig *configs.Capabilities) (*Caps, error) {
 		return nil, err
 	}
 	if len(unknownCaps) > 0 {
-		logrus.Warn("ignoring unknown or unavailable capabilities: ", mapKeys(unknownCaps))
+		logrus.Warn("ignoring unknown capabilities: ", mapKeys(unknownCaps))
+	}
+	if len(unavailableCaps) > 0 {
+		logrus.Warn("ignoring capabilities unavailable in the running kernel: ", mapKeys(unavailableCaps))
 	}
+	c.caps[capability.AMBIENT] = c.raisableAmbient()
 	return &c, nil
 }
 
+// raisableAmbient returns the ambient capabilities, excluding the ones which
+// can't be raised as they are not both permitted and inheritable.
+func (c *Caps) raisableAmbient() []capability.Cap {
+	var out []capability.Cap
+	skipped := make(map[string]struct{})
+	for _, a := range c.caps[capability.AMBIENT] {
+		if hasCap(c.caps[capability.PERMITTED], a) && hasCap(c.caps[capability.INHERITABLE], a) {
+			out = append(out, a)
+		} else {
+			skipped[capName(a)] = struct{}{}
+		}
+	}
+	if len(skipped) > 0 {
+		logrus.Warn("ignoring ambient capabilities which are not both permitted and inheritable: ", mapKeys(skipped))
+	}
+	return out
+}
+
+func hasCap(caps []capability.Cap, c capability.Cap) bool {
+	for _, v := range caps {
+		if v == c {
+			return true
+		}
+	}
+	return false
+}
+
+// KnownCapabilities returns the names of the capabilities known to runc,
+// such as "CAP_CHOWN".
+func KnownCapabilities() []string {
+	res := make([]string, 0, len(capabilityMap))
+	for c := range capabilityMap {
+		res = append(res, c)
+	}
+	sort.Strings(res)
+	return res
+}
+
+func capName(c capability.Cap) string {
+	return "CAP_" + strings.ToUpper(c.String())
+}
+
 // capSlice converts the slice of capability names in caps, to their numeric
-// equivalent, and returns them as a slice. Unknown or unavailable capabilities
-// are not returned, but appended to unknownCaps.
-func capSlice(caps []string, unknownCaps map[string]struct{}) []capability.Cap {
+// equivalent, and returns them as a slice. Unknown capabilities, and the ones
+// which are newer than the running kernel, are not returned, but added to
+// unknownCaps and unavailableCaps respectively.
+func capSlice(caps []string, unknownCaps, unavailableCaps map[string]struct{}) []capability.Cap {
 	var out []capability.Cap
 	for _, c := range caps {
-		if v, ok := capabilityMap[c]; !ok {
+		v, ok := capabilityMap[c]
+		switch {
+		case !ok:
 			unknownCaps[c] = struct{}{}
-		} else {
+		case v > capability.CAP_LAST_CAP:
+			unavailableCaps[c] = struct{}{}
+		default:
 			out = append(out, v)
 		}
 	}
@@ -101,11 +151,45 @@ func (c *Caps) ApplyBoundingSet() error {
 	return c.pid.Apply(capability.BOUNDING)
 }
 
-// Apply sets all the capabilities for the current process in the config.
+// ApplyCaps sets all the capabilities for the current process in the config.
+// For a non-root user, it has to be called after changing the user (with
+// SECBIT_KEEP_CAPS set), so that the ambient capabilities are kept across
+// execve, without requiring file capabilities.
 func (c *Caps) ApplyCaps() error {
-	c.pid.Clear(allCapabilityTypes)
+	c.pid.Clear(capability.CAPS | capability.BOUNDS)
 	for _, g := range capTypes {
+		if g == capability.AMBIENT {
+			continue
+		}
 		c.pid.Set(g, c.caps[g]...)
 	}
-	return c.pid.Apply(allCapabilityTypes)
+	if err := c.pid.Apply(capability.CAPS | capability.BOUNDS); err != nil {
+		return err
+	}
+	return c.applyAmbient()
+}
+
+// applyAmbient sets the ambient capabilities, which have to be in the
+// permitted and inheritable sets already. Unlike the capability package,
+// errors are not ignored, so that a process does not silently run without
+// the capabilities it was configured with.
+func (c *Caps) applyAmbient() error {
+	ambient := c.caps[capability.AMBIENT]
+	err := unix.Prctl(unix.PR_CAP_AMBIENT, unix.PR_CAP_AMBIENT_CLEAR_ALL, 0, 0, 0)
+	if err == unix.EINVAL {
+		// Ambient capabilities are not supported (before Linux 4.3).
+		if len(ambient) > 0 {
+			logrus.Warn("ignoring ambient capabilities, as they are not supported by the kernel")
+		}
+		return nil
+	}
+	if err != nil {
+		return os.NewSyscallError("prctl PR_CAP_AMBIENT_CLEAR_ALL", err)
+	}
+	for _, a := range ambient {
+		if err := unix.Prctl(unix.PR_CAP_AMBIENT, unix.PR_CAP_AMBIENT_RAISE, uintptr(a), 0, 0); err != nil {
+			return fmt.Errorf("raise ambient capability %s: %w", capName(a), os.NewSyscallError("prctl PR_CAP_AMBIENT_RAISE", err))
+		}
+	}
+	return nil
 }
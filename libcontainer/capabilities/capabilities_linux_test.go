@@ -38,7 +38,7 @@ func TestNew(t *testing.T) {
 
 	expectedLogs := logrus.Entry{
 		Level:   logrus.WarnLevel,
-		Message: "ignoring unknown or unavailable capabilities: [CAP_UNKNOWN CAP_UNKNOWN2]",
+		Message: "ignoring unknown capabilities: [CAP_UNKNOWN CAP_UNKNOWN2]",
 	}
 
 	l := hook.LastEntry()
@@ -69,3 +69,57 @@ func TestNew(t *testing.T) {
 
 	hook.Reset()
 }
+
+func TestNewUnavailable(t *testing.T) {
+	// Pretend that the running kernel is older than CAP_SYSLOG.
+	lastCap := capability.CAP_LAST_CAP
+	capability.CAP_LAST_CAP = capability.CAP_MAC_ADMIN
+	defer func() { capability.CAP_LAST_CAP = lastCap }()
+
+	cs := []string{"CAP_CHOWN", "CAP_WAKE_ALARM", "CAP_SYSLOG"}
+	conf := configs.Capabilities{Bounding: cs}
+
+	hook := test.NewGlobal()
+	defer hook.Reset()
+
+	logrus.SetOutput(ioutil.Discard)
+	caps, err := New(&conf)
+	logrus.SetOutput(os.Stderr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "ignoring capabilities unavailable in the running kernel: [CAP_SYSLOG CAP_WAKE_ALARM]"
+	if l := hook.LastEntry(); l == nil || l.Message != expected {
+		t.Errorf("expected warning %q, got %+v", expected, l)
+	}
+	if b := caps.caps[capability.BOUNDING]; len(b) != 1 || b[0] != capability.CAP_CHOWN {
+		t.Errorf("expected only CAP_CHOWN in the bounding set, got %v", b)
+	}
+}
+
+func TestNewAmbient(t *testing.T) {
+	conf := configs.Capabilities{
+		Permitted:   []string{"CAP_CHOWN", "CAP_KILL", "CAP_NET_RAW"},
+		Inheritable: []string{"CAP_CHOWN", "CAP_KILL", "CAP_SETUID"},
+		Ambient:     []string{"CAP_CHOWN", "CAP_NET_RAW", "CAP_SETUID"},
+	}
+
+	hook := test.NewGlobal()
+	defer hook.Reset()
+
+	logrus.SetOutput(ioutil.Discard)
+	caps, err := New(&conf)
+	logrus.SetOutput(os.Stderr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "ignoring ambient capabilities which are not both permitted and inheritable: [CAP_NET_RAW CAP_SETUID]"
+	if l := hook.LastEntry(); l == nil || l.Message != expected {
+		t.Errorf("expected warning %q, got %+v", expected, l)
+	}
+	if a := caps.caps[capability.AMBIENT]; len(a) != 1 || a[0] != capability.CAP_CHOWN {
+		t.Errorf("expected only CAP_CHOWN in the ambient set, got %v", a)
+	}
+}
@@ -0,0 +1,391 @@
+// +build linux
+
+// Package cdi implements a minimal resolver for the Container Device
+// Interface (CDI), see https://github.com/container-orchestrated-devices/container-device-interface.
+//
+// CDI devices are referred to by their fully qualified names, such as
+// "vendor.com/gpu=gpu0", and are described by spec files installed on the
+// host (usually by the device vendor). Injecting a device into a container
+// applies the edits (device nodes, mounts, environment variables and hooks)
+// of the device to the OCI runtime spec of the container.
+//
+// Only JSON spec files are supported. The YAML ones are skipped with a
+// warning.
+package cdi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/sys/unix"
+)
+
+// AnnotationPrefix is the prefix of the annotations used to request CDI
+// devices. The value of such an annotation is a comma-separated list of
+// fully qualified device names.
+const AnnotationPrefix = "cdi.k8s.io/"
+
+// DefaultSpecDirs are the directories where CDI spec files are looked up by
+// default. Spec files in later directories take precedence.
+var DefaultSpecDirs = []string{"/etc/cdi", "/var/run/cdi"}
+
+// Spec is a CDI spec file.
+type Spec struct {
+	Version        string         `json:"cdiVersion"`
+	Kind           string         `json:"kind"`
+	Devices        []Device       `json:"devices"`
+	ContainerEdits ContainerEdits `json:"containerEdits,omitempty"`
+}
+
+// Device is a CDI device.
+type Device struct {
+	Name           string         `json:"name"`
+	ContainerEdits ContainerEdits `json:"containerEdits"`
+}
+
+// ContainerEdits are the edits to apply to the container when injecting a
+// device.
+type ContainerEdits struct {
+	Env         []string      `json:"env,omitempty"`
+	DeviceNodes []*DeviceNode `json:"deviceNodes,omitempty"`
+	Hooks       []*Hook       `json:"hooks,omitempty"`
+	Mounts      []*Mount      `json:"mounts,omitempty"`
+}
+
+// DeviceNode is a device node to create in the container. If Type, Major
+// and Minor are not set, they are taken from the host device at HostPath
+// (or Path, if HostPath is not set).
+type DeviceNode struct {
+	Path        string       `json:"path"`
+	HostPath    string       `json:"hostPath,omitempty"`
+	Type        string       `json:"type,omitempty"`
+	Major       int64        `json:"major,omitempty"`
+	Minor       int64        `json:"minor,omitempty"`
+	FileMode    *os.FileMode `json:"fileMode,omitempty"`
+	Permissions string       `json:"permissions,omitempty"`
+	UID         *uint32      `json:"uid,omitempty"`
+	GID         *uint32      `json:"gid,omitempty"`
+}
+
+// Hook is an OCI hook to run for the container.
+type Hook struct {
+	HookName string   `json:"hookName"`
+	Path     string   `json:"path"`
+	Args     []string `json:"args,omitempty"`
+	Env      []string `json:"env,omitempty"`
+	Timeout  *int     `json:"timeout,omitempty"`
+}
+
+// Mount is a mount to add to the container.
+type Mount struct {
+	HostPath      string   `json:"hostPath"`
+	ContainerPath string   `json:"containerPath"`
+	Options       []string `json:"options,omitempty"`
+	Type          string   `json:"type,omitempty"`
+}
+
+// Registry holds the devices of all the loaded CDI specs.
+type Registry struct {
+	devices map[string]*registryDevice
+}
+
+type registryDevice struct {
+	device *Device
+	spec   *Spec
+}
+
+// Load loads the CDI spec files from the given directories, which do not
+// have to exist. If no directories are given, DefaultSpecDirs are used.
+func Load(dirs ...string) (*Registry, error) {
+	if len(dirs) == 0 {
+		dirs = DefaultSpecDirs
+	}
+	r := &Registry{devices: make(map[string]*registryDevice)}
+	for _, dir := range dirs {
+		// The YAML spec files can't be read, so let the user know they
+		// are skipped, rather than having their devices reported as
+		// unknown without a word.
+		for _, pattern := range []string{"*.yaml", "*.yml"} {
+			skipped, err := filepath.Glob(filepath.Join(dir, pattern))
+			if err != nil {
+				return nil, err
+			}
+			for _, file := range skipped {
+				logrus.Warnf("skipping CDI spec %s: only JSON spec files are supported", file)
+			}
+		}
+		files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+		if err != nil {
+			return nil, err
+		}
+		sort.Strings(files)
+		for _, file := range files {
+			spec, err := readSpec(file)
+			if err != nil {
+				return nil, err
+			}
+			for i := range spec.Devices {
+				r.devices[spec.Kind+"="+spec.Devices[i].Name] = &registryDevice{
+					device: &spec.Devices[i],
+					spec:   spec,
+				}
+			}
+		}
+	}
+	return r, nil
+}
+
+func readSpec(path string) (*Spec, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var spec Spec
+	if err := json.Unmarshal(data, &spec); err != nil {
+		return nil, fmt.Errorf("invalid CDI spec %s: %w", path, err)
+	}
+	if !strings.Contains(spec.Kind, "/") {
+		return nil, fmt.Errorf("invalid CDI spec %s: invalid kind %q", path, spec.Kind)
+	}
+	for _, d := range spec.Devices {
+		if d.Name == "" {
+			return nil, fmt.Errorf("invalid CDI spec %s: device with no name", path)
+		}
+	}
+	return &spec, nil
+}
+
+// AnnotationDevices returns the fully qualified names of the CDI devices
+// requested by the annotations.
+func AnnotationDevices(annotations map[string]string) []string {
+	keys := make([]string, 0, len(annotations))
+	for key := range annotations {
+		if strings.HasPrefix(key, AnnotationPrefix) {
+			keys = append(keys, key)
+		}
+	}
+	// Make the order of the devices deterministic.
+	sort.Strings(keys)
+
+	var names []string
+	for _, key := range keys {
+		for _, name := range strings.Split(annotations[key], ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				names = append(names, name)
+			}
+		}
+	}
+	return names
+}
+
+// InjectDevices applies the edits of the given CDI devices (and of their
+// specs) to the OCI runtime spec.
+func (r *Registry) InjectDevices(spec *specs.Spec, names ...string) error {
+	var unresolved []string
+	applied := make(map[*Spec]bool)
+	for _, name := range names {
+		d, ok := r.devices[name]
+		if !ok {
+			unresolved = append(unresolved, name)
+			continue
+		}
+		if !applied[d.spec] {
+			if err := d.spec.ContainerEdits.apply(spec); err != nil {
+				return fmt.Errorf("CDI device %s: %w", name, err)
+			}
+			applied[d.spec] = true
+		}
+		if err := d.device.ContainerEdits.apply(spec); err != nil {
+			return fmt.Errorf("CDI device %s: %w", name, err)
+		}
+	}
+	if len(unresolved) > 0 {
+		return fmt.Errorf("unresolvable CDI devices: %s", strings.Join(unresolved, ", "))
+	}
+	return nil
+}
+
+func (e *ContainerEdits) apply(spec *specs.Spec) error {
+	if len(e.Env) > 0 {
+		if spec.Process == nil {
+			spec.Process = &specs.Process{}
+		}
+		spec.Process.Env = mergeEnv(spec.Process.Env, e.Env)
+	}
+
+	if len(e.DeviceNodes) > 0 {
+		if spec.Linux == nil {
+			spec.Linux = &specs.Linux{}
+		}
+		if spec.Linux.Resources == nil {
+			spec.Linux.Resources = &specs.LinuxResources{}
+		}
+	}
+	for _, d := range e.DeviceNodes {
+		dev, err := d.linuxDevice()
+		if err != nil {
+			return err
+		}
+		addDevice(spec.Linux, dev)
+		if dev.Type == "p" {
+			// There is no device cgroup access control for fifos.
+			continue
+		}
+		access := d.Permissions
+		if access == "" {
+			access = "rwm"
+		}
+		major, minor := dev.Major, dev.Minor
+		spec.Linux.Resources.Devices = append(spec.Linux.Resources.Devices, specs.LinuxDeviceCgroup{
+			Allow:  true,
+			Type:   dev.Type,
+			Major:  &major,
+			Minor:  &minor,
+			Access: access,
+		})
+	}
+
+	for _, m := range e.Mounts {
+		spec.Mounts = append(spec.Mounts, m.ociMount())
+	}
+
+	for _, h := range e.Hooks {
+		if err := addHook(spec, h); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// mergeEnv adds the variables in add to env, replacing the existing ones.
+func mergeEnv(env, add []string) []string {
+	for _, kv := range add {
+		key := strings.SplitN(kv, "=", 2)[0]
+		replaced := false
+		for i := range env {
+			if strings.SplitN(env[i], "=", 2)[0] == key {
+				env[i] = kv
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			env = append(env, kv)
+		}
+	}
+	return env
+}
+
+func (d *DeviceNode) linuxDevice() (specs.LinuxDevice, error) {
+	dev := specs.LinuxDevice{
+		Path:     d.Path,
+		Type:     d.Type,
+		Major:    d.Major,
+		Minor:    d.Minor,
+		FileMode: d.FileMode,
+		UID:      d.UID,
+		GID:      d.GID,
+	}
+	if d.Path == "" {
+		return dev, errors.New("device node with no path")
+	}
+	if dev.Type == "" || (dev.Major == 0 && dev.Minor == 0) {
+		hostPath := d.HostPath
+		if hostPath == "" {
+			hostPath = d.Path
+		}
+		var stat unix.Stat_t
+		if err := unix.Stat(hostPath, &stat); err != nil {
+			return dev, &os.PathError{Op: "stat", Path: hostPath, Err: err}
+		}
+		switch stat.Mode & unix.S_IFMT {
+		case unix.S_IFBLK:
+			dev.Type = "b"
+		case unix.S_IFCHR:
+			dev.Type = "c"
+		case unix.S_IFIFO:
+			dev.Type = "p"
+		default:
+			return dev, fmt.Errorf("%s is not a device node", hostPath)
+		}
+		dev.Major = int64(unix.Major(stat.Rdev))
+		dev.Minor = int64(unix.Minor(stat.Rdev))
+		if dev.FileMode == nil {
+			mode := os.FileMode(stat.Mode &^ unix.S_IFMT)
+			dev.FileMode = &mode
+		}
+	}
+	return dev, nil
+}
+
+// addDevice adds dev to the devices of the container, replacing the device
+// with the same path, if any.
+func addDevice(linux *specs.Linux, dev specs.LinuxDevice) {
+	for i := range linux.Devices {
+		if linux.Devices[i].Path == dev.Path {
+			linux.Devices[i] = dev
+			return
+		}
+	}
+	linux.Devices = append(linux.Devices, dev)
+}
+
+func (m *Mount) ociMount() specs.Mount {
+	mnt := specs.Mount{
+		Source:      m.HostPath,
+		Destination: m.ContainerPath,
+		Type:        m.Type,
+		Options:     m.Options,
+	}
+	if mnt.Type == "" || mnt.Type == "bind" {
+		mnt.Type = "bind"
+		bind := false
+		for _, o := range mnt.Options {
+			if o == "bind" || o == "rbind" {
+				bind = true
+				break
+			}
+		}
+		if !bind {
+			mnt.Options = append([]string{"bind"}, mnt.Options...)
+		}
+	}
+	return mnt
+}
+
+func addHook(spec *specs.Spec, h *Hook) error {
+	if spec.Hooks == nil {
+		spec.Hooks = &specs.Hooks{}
+	}
+	hook := specs.Hook{
+		Path:    h.Path,
+		Args:    h.Args,
+		Env:     h.Env,
+		Timeout: h.Timeout,
+	}
+	switch h.HookName {
+	case "prestart":
+		spec.Hooks.Prestart = append(spec.Hooks.Prestart, hook)
+	case "createRuntime":
+		spec.Hooks.CreateRuntime = append(spec.Hooks.CreateRuntime, hook)
+	case "createContainer":
+		spec.Hooks.CreateContainer = append(spec.Hooks.CreateContainer, hook)
+	case "startContainer":
+		spec.Hooks.StartContainer = append(spec.Hooks.StartContainer, hook)
+	case "poststart":
+		spec.Hooks.Poststart = append(spec.Hooks.Poststart, hook)
+	case "poststop":
+		spec.Hooks.Poststop = append(spec.Hooks.Poststop, hook)
+	default:
+		return fmt.Errorf("unknown hook name %q", h.HookName)
+	}
+	return nil
+}
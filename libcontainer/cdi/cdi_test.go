@@ -0,0 +1,125 @@
+// +build linux
+
+package cdi
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+)
+
+const testSpec = `{
+	"cdiVersion": "0.3.0",
+	"kind": "vendor.com/device",
+	"devices": [
+		{
+			"name": "null",
+			"containerEdits": {
+				"env": ["DEVICE=null"],
+				"deviceNodes": [{"path": "/dev/vendor-null", "hostPath": "/dev/null", "permissions": "rw"}],
+				"mounts": [{"hostPath": "/usr/lib/vendor", "containerPath": "/usr/lib/vendor", "options": ["ro"]}]
+			}
+		},
+		{
+			"name": "zero",
+			"containerEdits": {
+				"deviceNodes": [{"path": "/dev/vendor-zero", "type": "c", "major": 1, "minor": 5}]
+			}
+		}
+	],
+	"containerEdits": {
+		"env": ["VENDOR=1"],
+		"hooks": [{"hookName": "createContainer", "path": "/usr/bin/vendor-hook", "args": ["vendor-hook", "create"]}]
+	}
+}`
+
+func loadTestRegistry(t *testing.T) *Registry {
+	dir, err := ioutil.TempDir("", "cdi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := ioutil.WriteFile(filepath.Join(dir, "vendor.json"), []byte(testSpec), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	// The YAML spec files are skipped.
+	if err := ioutil.WriteFile(filepath.Join(dir, "other.yaml"), []byte("cdiVersion: 0.3.0\nkind: vendor.com/other\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	r, err := Load(dir, filepath.Join(dir, "nonexistent"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func TestInjectDevices(t *testing.T) {
+	r := loadTestRegistry(t)
+	spec := &specs.Spec{
+		Process: &specs.Process{Env: []string{"PATH=/bin", "DEVICE=none"}},
+	}
+	if err := r.InjectDevices(spec, "vendor.com/device=null", "vendor.com/device=zero"); err != nil {
+		t.Fatal(err)
+	}
+
+	expectedEnv := []string{"PATH=/bin", "DEVICE=null", "VENDOR=1"}
+	if !reflect.DeepEqual(spec.Process.Env, expectedEnv) {
+		t.Errorf("expected env %v, got %v", expectedEnv, spec.Process.Env)
+	}
+
+	if len(spec.Linux.Devices) != 2 {
+		t.Fatalf("expected 2 devices, got %+v", spec.Linux.Devices)
+	}
+	null := spec.Linux.Devices[0]
+	if null.Path != "/dev/vendor-null" || null.Type != "c" || null.Major != 1 || null.Minor != 3 {
+		t.Errorf("unexpected device %+v", null)
+	}
+	rules := spec.Linux.Resources.Devices
+	if len(rules) != 2 || !rules[0].Allow || rules[0].Access != "rw" || *rules[0].Minor != 3 || rules[1].Access != "rwm" || *rules[1].Minor != 5 {
+		t.Errorf("unexpected device rules %+v", rules)
+	}
+
+	expectedMount := specs.Mount{
+		Source:      "/usr/lib/vendor",
+		Destination: "/usr/lib/vendor",
+		Type:        "bind",
+		Options:     []string{"bind", "ro"},
+	}
+	if len(spec.Mounts) != 1 || !reflect.DeepEqual(spec.Mounts[0], expectedMount) {
+		t.Errorf("expected mount %+v, got %+v", expectedMount, spec.Mounts)
+	}
+
+	// The edits of the spec must only be applied once.
+	if len(spec.Hooks.CreateContainer) != 1 || spec.Hooks.CreateContainer[0].Path != "/usr/bin/vendor-hook" {
+		t.Errorf("unexpected createContainer hooks %+v", spec.Hooks.CreateContainer)
+	}
+}
+
+func TestInjectDevicesUnresolvable(t *testing.T) {
+	r := loadTestRegistry(t)
+	spec := &specs.Spec{}
+	err := r.InjectDevices(spec, "vendor.com/device=zero", "vendor.com/device=gpu0", "vendor.com/other=zero")
+	if err == nil {
+		t.Fatal("expected an error for unresolvable devices")
+	}
+	expected := "unresolvable CDI devices: vendor.com/device=gpu0, vendor.com/other=zero"
+	if err.Error() != expected {
+		t.Errorf("expected error %q, got %q", expected, err)
+	}
+}
+
+func TestAnnotationDevices(t *testing.T) {
+	annotations := map[string]string{
+		"cdi.k8s.io/vendor-b":    "vendor.com/device=b",
+		"cdi.k8s.io/vendor-a":    "vendor.com/device=a0, vendor.com/device=a1",
+		"org.example.annotation": "vendor.com/device=c",
+	}
+	expected := []string{"vendor.com/device=a0", "vendor.com/device=a1", "vendor.com/device=b"}
+	if names := AnnotationDevices(annotations); !reflect.DeepEqual(names, expected) {
+		t.Errorf("expected %v, got %v", expected, names)
+	}
+}
@@ -0,0 +1,28 @@
+// +build linux,go1.20
+
+package libcontainer
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// setCgroupFD makes cmd start the process in the cgroup referred to by fd,
+// using clone3(2) with CLONE_INTO_CGROUP (Linux 5.7+). It returns false if
+// this is not supported.
+func setCgroupFD(cmd *exec.Cmd, fd int) bool {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.UseCgroupFD = true
+	cmd.SysProcAttr.CgroupFD = fd
+	return true
+}
+
+// clearCgroupFD reverts setCgroupFD.
+func clearCgroupFD(cmd *exec.Cmd) {
+	if cmd.SysProcAttr != nil {
+		cmd.SysProcAttr.UseCgroupFD = false
+		cmd.SysProcAttr.CgroupFD = 0
+	}
+}
@@ -0,0 +1,13 @@
+// +build linux,!go1.20
+
+package libcontainer
+
+import "os/exec"
+
+// setCgroupFD is a no-op, as os/exec only supports CLONE_INTO_CGROUP
+// since Go 1.20.
+func setCgroupFD(_ *exec.Cmd, _ int) bool {
+	return false
+}
+
+func clearCgroupFD(_ *exec.Cmd) {}
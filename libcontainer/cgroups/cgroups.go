@@ -1,17 +1,86 @@
-// +build linux
-
 package cgroups
 
 import (
+	"context"
+	"errors"
+	"syscall"
+	"time"
+
 	"github.com/opencontainers/runc/libcontainer/configs"
 )
 
+// ErrUnsupported is returned by the methods of the Manager of the platforms
+// without cgroups, see NewUnsupportedManager.
+var ErrUnsupported = errors.New("cgroups are not supported on this platform")
+
+// ErrReclaimNotSupported is returned by Manager.Reclaim if proactive memory
+// reclaim is not available, which requires cgroup v2 and Linux 5.19+.
+var ErrReclaimNotSupported = errors.New("memory reclaim is not supported (requires cgroup v2 and Linux 5.19+)")
+
+// ErrFreezing is returned, wrapped, by Manager.Freeze and
+// Manager.FreezeContext if the cgroup could not be frozen in time, i.e. it
+// got stuck in the FREEZING state. This usually means that some of its tasks
+// are in an uninterruptible sleep, e.g. waiting for an unresponsive NFS
+// server. The cgroup is thawed back in that case.
+var ErrFreezing = errors.New("cgroup stuck in FREEZING state")
+
+// ErrRootless is matched (with errors.Is) by the errors caused by the
+// lack of permissions on cgroups in rootless mode, such as controllers which
+// are not delegated to the user.
+var ErrRootless = errors.New("rootless")
+
+// NewRootlessError returns err annotated with msg, which also matches
+// ErrRootless.
+func NewRootlessError(err error, msg string) error {
+	return &rootlessError{err: err, msg: msg}
+}
+
+type rootlessError struct {
+	err error
+	msg string
+}
+
+func (e *rootlessError) Error() string {
+	return e.msg + ": " + e.err.Error()
+}
+
+func (e *rootlessError) Unwrap() error {
+	return e.err
+}
+
+func (e *rootlessError) Is(target error) bool {
+	return target == ErrRootless
+}
+
+// FreezeSignalRetryTimeout is the maximum duration of the last attempt to
+// freeze a cgroup, made after sending FreezeOptions.Signal to its processes.
+const FreezeSignalRetryTimeout = time.Second
+
+// FreezeOptions are the options of Manager.FreezeContext.
+type FreezeOptions struct {
+	// Signal, if non-zero, is sent to all the processes of the cgroup if it
+	// got stuck in the FREEZING state (after thawing it), before a last
+	// attempt to freeze it, of up to FreezeSignalRetryTimeout. This gets
+	// the processes which handle the signal out of the syscall they are
+	// blocked in.
+	Signal syscall.Signal
+}
+
 type Manager interface {
 	// Apply creates a cgroup, if not yet created, and adds a process
 	// with the specified pid into that cgroup.  A special value of -1
 	// can be used to merely create a cgroup.
 	Apply(pid int) error
 
+	// ApplyContext is like Apply, except that it gives up once ctx is
+	// done, e.g. when waiting for systemd to create the unit.
+	ApplyContext(ctx context.Context, pid int) error
+
+	// CanCreateEmpty reports whether Apply with a pid of -1 creates the
+	// cgroup with no processes in it, so that a process can then be
+	// started right inside it (using CLONE_INTO_CGROUP on cgroup v2).
+	CanCreateEmpty() bool
+
 	// GetPids returns the PIDs of all processes inside the cgroup.
 	GetPids() ([]int, error)
 
@@ -22,12 +91,31 @@ type Manager interface {
 	// GetStats returns cgroups statistics.
 	GetStats() (*Stats, error)
 
+	// GetStatsFor is like GetStats, but only collects the statistics of
+	// the given controllers, which saves reading the files of the other
+	// ones. The names of cgroup v2 controllers ("cpu", "memory", "io",
+	// "pids", "hugetlb", "rdma", "misc") can be used with both cgroup
+	// versions; with cgroup v1, "cpu" includes the cpuacct subsystem, and
+	// the subsystem names can be used as well. If no controllers are
+	// given, all the statistics are collected.
+	GetStatsFor(controllers ...string) (*Stats, error)
+
 	// Freeze sets the freezer cgroup to the specified state.
 	Freeze(state configs.FreezerState) error
 
+	// FreezeContext is like Freeze, except that freezing gives up once ctx
+	// is done (a default timeout is used if ctx has no deadline), and that
+	// it can be retried after signaling the processes of the cgroup. opts
+	// may be nil.
+	FreezeContext(ctx context.Context, state configs.FreezerState, opts *FreezeOptions) error
+
 	// Destroy removes cgroup.
 	Destroy() error
 
+	// DestroyContext is like Destroy, except that it gives up waiting for
+	// the cgroup to be removed once ctx is done.
+	DestroyContext(ctx context.Context) error
+
 	// Path returns a cgroup path to the specified controller/subsystem.
 	// For cgroupv2, the argument is unused and can be empty.
 	Path(string) string
@@ -58,4 +146,9 @@ type Manager interface {
 
 	// OOMKillCount reports OOM kill count for the cgroup.
 	OOMKillCount() (uint64, error)
+
+	// Reclaim triggers a one-shot proactive reclaim of the specified
+	// amount of memory (in bytes) from the cgroup, without changing any
+	// of its limits.
+	Reclaim(bytes uint64) error
 }
@@ -1,3 +1,101 @@
 // +build !linux
 
 package cgroups
+
+import (
+	"context"
+
+	"github.com/opencontainers/runc/libcontainer/configs"
+)
+
+// IsCgroup2UnifiedMode returns false, as there are no cgroups.
+func IsCgroup2UnifiedMode() bool {
+	return false
+}
+
+// NewUnsupportedManager returns a Manager of the cgroup config, whose methods
+// fail with ErrUnsupported, so that the code using a Manager builds on the
+// platforms without cgroups.
+func NewUnsupportedManager(config *configs.Cgroup) Manager {
+	return &unsupportedManager{cgroups: config}
+}
+
+type unsupportedManager struct {
+	cgroups *configs.Cgroup
+}
+
+func (m *unsupportedManager) Apply(pid int) error {
+	return ErrUnsupported
+}
+
+func (m *unsupportedManager) ApplyContext(ctx context.Context, pid int) error {
+	return ErrUnsupported
+}
+
+func (m *unsupportedManager) GetPids() ([]int, error) {
+	return nil, ErrUnsupported
+}
+
+func (m *unsupportedManager) GetAllPids() ([]int, error) {
+	return nil, ErrUnsupported
+}
+
+func (m *unsupportedManager) GetStats() (*Stats, error) {
+	return nil, ErrUnsupported
+}
+
+func (m *unsupportedManager) GetStatsFor(controllers ...string) (*Stats, error) {
+	return nil, ErrUnsupported
+}
+
+func (m *unsupportedManager) Freeze(state configs.FreezerState) error {
+	return ErrUnsupported
+}
+
+func (m *unsupportedManager) FreezeContext(ctx context.Context, state configs.FreezerState, opts *FreezeOptions) error {
+	return ErrUnsupported
+}
+
+func (m *unsupportedManager) Destroy() error {
+	return ErrUnsupported
+}
+
+func (m *unsupportedManager) DestroyContext(ctx context.Context) error {
+	return ErrUnsupported
+}
+
+func (m *unsupportedManager) Path(string) string {
+	return ""
+}
+
+func (m *unsupportedManager) Set(r *configs.Resources) error {
+	return ErrUnsupported
+}
+
+func (m *unsupportedManager) GetPaths() map[string]string {
+	return nil
+}
+
+func (m *unsupportedManager) GetCgroups() (*configs.Cgroup, error) {
+	return m.cgroups, nil
+}
+
+func (m *unsupportedManager) GetFreezerState() (configs.FreezerState, error) {
+	return configs.Undefined, ErrUnsupported
+}
+
+func (m *unsupportedManager) Exists() bool {
+	return false
+}
+
+func (m *unsupportedManager) OOMKillCount() (uint64, error) {
+	return 0, ErrUnsupported
+}
+
+func (m *unsupportedManager) Reclaim(bytes uint64) error {
+	return ErrUnsupported
+}
+
+func (m *unsupportedManager) CanCreateEmpty() bool {
+	return false
+}
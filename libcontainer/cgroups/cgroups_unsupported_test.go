@@ -0,0 +1,30 @@
+// +build !linux
+
+package cgroups
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/opencontainers/runc/libcontainer/configs"
+)
+
+func TestUnsupportedManager(t *testing.T) {
+	config := &configs.Cgroup{Resources: &configs.Resources{Memory: 1 << 20}}
+	m := NewUnsupportedManager(config)
+	if err := m.Apply(-1); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("expected ErrUnsupported from Apply, got %v", err)
+	}
+	if err := m.Set(config.Resources); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("expected ErrUnsupported from Set, got %v", err)
+	}
+	if _, err := m.GetStats(); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("expected ErrUnsupported from GetStats, got %v", err)
+	}
+	if c, err := m.GetCgroups(); err != nil || c != config {
+		t.Errorf("expected the config from GetCgroups, got %+v, %v", c, err)
+	}
+	if m.Exists() {
+		t.Error("expected the cgroup not to exist")
+	}
+}
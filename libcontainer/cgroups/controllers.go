@@ -0,0 +1,85 @@
+// +build linux
+
+package cgroups
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/opencontainers/runc/libcontainer/configs"
+)
+
+// RequiredControllers returns the sorted cgroup controllers needed to apply
+// the resources r, named after the cgroup version of the host, including the
+// controllers of the interface files set in r.Unified. The "pseudo"
+// controllers (devices and freezer) are not included.
+func RequiredControllers(r *configs.Resources) []string {
+	return requiredControllers(r, IsCgroup2UnifiedMode())
+}
+
+func requiredControllers(r *configs.Resources, v2 bool) []string {
+	if r == nil {
+		return nil
+	}
+	set := make(map[string]struct{})
+	if r.Memory != 0 || r.MemoryReservation != 0 || r.MemorySwap != 0 ||
+		r.MemoryMin != 0 || r.MemoryLow != 0 || r.MemorySwapHigh != 0 ||
+		r.MemoryZswapMax != nil || r.MemoryZswapWriteback != nil || r.MemoryOOMGroup != nil ||
+		(!v2 && (r.OomKillDisable || r.MemorySwappiness != nil)) {
+		set["memory"] = struct{}{}
+	}
+	if r.CpuShares != 0 || r.CpuWeight != 0 || r.CpuQuota != 0 || r.CpuPeriod != 0 ||
+		r.CpuBurst != nil || r.CPUIdle != nil ||
+		(!v2 && (r.CpuRtRuntime != 0 || r.CpuRtPeriod != 0)) {
+		set["cpu"] = struct{}{}
+	}
+	if r.CpusetCpus != "" || r.CpusetMems != "" || r.CpusetPartition != "" {
+		set["cpuset"] = struct{}{}
+	}
+	if r.PidsLimit != 0 {
+		set["pids"] = struct{}{}
+	}
+	if r.BlkioWeight != 0 || r.BlkioLeafWeight != 0 || len(r.BlkioWeightDevice) > 0 ||
+		len(r.BlkioThrottleReadBpsDevice) > 0 || len(r.BlkioThrottleWriteBpsDevice) > 0 ||
+		len(r.BlkioThrottleReadIOPSDevice) > 0 || len(r.BlkioThrottleWriteIOPSDevice) > 0 {
+		if v2 {
+			set["io"] = struct{}{}
+		} else {
+			set["blkio"] = struct{}{}
+		}
+	}
+	if len(r.HugetlbLimit) > 0 {
+		set["hugetlb"] = struct{}{}
+	}
+	if len(r.Rdma) > 0 {
+		set["rdma"] = struct{}{}
+	}
+	if v2 {
+		// There is no cgroup v1 misc controller.
+		if len(r.Misc) > 0 {
+			set["misc"] = struct{}{}
+		}
+	} else {
+		// The net_cls and net_prio controllers don't exist in cgroup v2,
+		// where the network resources are ignored.
+		if r.NetClsClassid != 0 {
+			set["net_cls"] = struct{}{}
+		}
+		if len(r.NetPrioIfpriomap) > 0 {
+			set["net_prio"] = struct{}{}
+		}
+	}
+	for key := range r.Unified {
+		// The interface files are named after their controller, except
+		// for the cgroup core ones.
+		if i := strings.Index(key, "."); i > 0 && key[:i] != "cgroup" {
+			set[key[:i]] = struct{}{}
+		}
+	}
+	res := make([]string, 0, len(set))
+	for ctrl := range set {
+		res = append(res, ctrl)
+	}
+	sort.Strings(res)
+	return res
+}
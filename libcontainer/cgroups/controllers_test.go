@@ -0,0 +1,36 @@
+// +build linux
+
+package cgroups
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/opencontainers/runc/libcontainer/configs"
+)
+
+func TestRequiredControllers(t *testing.T) {
+	r := &configs.Resources{
+		Memory:        1 << 20,
+		PidsLimit:     10,
+		BlkioWeight:   100,
+		CpuRtRuntime:  1000,
+		NetClsClassid: 1,
+		Misc:          map[string]int64{"res_a": 1},
+		Unified:       map[string]string{"cgroup.freeze": "0", "memory.high": "max", "hugetlb.2MB.max": "0"},
+	}
+	for _, tc := range []struct {
+		v2       bool
+		expected []string
+	}{
+		{v2: false, expected: []string{"blkio", "cpu", "hugetlb", "memory", "net_cls", "pids"}},
+		{v2: true, expected: []string{"hugetlb", "io", "memory", "misc", "pids"}},
+	} {
+		if controllers := requiredControllers(r, tc.v2); !reflect.DeepEqual(controllers, tc.expected) {
+			t.Errorf("v2=%v: expected %v, got %v", tc.v2, tc.expected, controllers)
+		}
+	}
+	if controllers := requiredControllers(nil, true); len(controllers) != 0 {
+		t.Errorf("expected no controllers, got %v", controllers)
+	}
+}
@@ -0,0 +1,115 @@
+// +build linux
+
+package cgroups
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/opencontainers/runc/libcontainer/cgroups/fscommon"
+)
+
+// ParseCPUSetList parses a list of CPUs or memory nodes in the format of the
+// cpuset files, such as "0-3,8", into the sorted list of their numbers.
+func ParseCPUSetList(list string) ([]uint16, error) {
+	var extracted []uint16
+	list = strings.TrimSpace(list)
+	if list == "" {
+		return extracted, nil
+	}
+	for _, s := range strings.Split(list, ",") {
+		splitted := strings.SplitN(s, "-", 3)
+		switch len(splitted) {
+		case 3:
+			return extracted, fmt.Errorf("invalid cpuset list %q", list)
+		case 2:
+			min, err := strconv.ParseUint(splitted[0], 10, 16)
+			if err != nil {
+				return extracted, err
+			}
+			max, err := strconv.ParseUint(splitted[1], 10, 16)
+			if err != nil {
+				return extracted, err
+			}
+			if min > max {
+				return extracted, fmt.Errorf("invalid cpuset list %q", list)
+			}
+			for i := min; i <= max; i++ {
+				extracted = append(extracted, uint16(i))
+			}
+		case 1:
+			value, err := strconv.ParseUint(s, 10, 16)
+			if err != nil {
+				return extracted, err
+			}
+			extracted = append(extracted, uint16(value))
+		}
+	}
+	return extracted, nil
+}
+
+// FormatCPUSetList formats a list of CPUs or memory nodes in the format of
+// the cpuset files, with the consecutive numbers as ranges.
+func FormatCPUSetList(list []uint16) string {
+	var b strings.Builder
+	for i := 0; i < len(list); i++ {
+		j := i
+		for j+1 < len(list) && list[j+1] == list[j]+1 {
+			j++
+		}
+		if b.Len() > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(strconv.Itoa(int(list[i])))
+		if j > i {
+			b.WriteString("-" + strconv.Itoa(int(list[j])))
+		}
+		i = j
+	}
+	return b.String()
+}
+
+// CheckCPUSet checks that the CPUs or memory nodes (as given by what, either
+// "CPUs" or "memory nodes") of the requested list are in the available list,
+// returning an error listing the unavailable and available ones otherwise.
+func CheckCPUSet(what, requested, available string) error {
+	req, err := ParseCPUSetList(requested)
+	if err != nil {
+		return fmt.Errorf("invalid %s %q: %w", what, requested, err)
+	}
+	avail, err := ParseCPUSetList(available)
+	if err != nil {
+		return err
+	}
+	set := make(map[uint16]bool, len(avail))
+	for _, n := range avail {
+		set[n] = true
+	}
+	var missing []uint16
+	for _, n := range req {
+		if !set[n] {
+			missing = append(missing, n)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("invalid %s %q: %s %s are not available (available %s: %s)",
+			what, requested, what, FormatCPUSetList(missing), what, FormatCPUSetList(avail))
+	}
+	return nil
+}
+
+// CheckCPUSetFile checks the requested list against the one of the file of
+// the cgroup dir, such as the effective CPUs of the parent cgroup, if the file
+// exists.
+func CheckCPUSetFile(dir, file, what, requested string) error {
+	available, err := fscommon.ReadFile(dir, file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	return CheckCPUSet(what, requested, available)
+}
@@ -0,0 +1,78 @@
+// +build linux
+
+package cgroups
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseCPUSetList(t *testing.T) {
+	for _, tc := range []struct {
+		list     string
+		expected []uint16
+		isErr    bool
+	}{
+		{list: "", expected: nil},
+		{list: "\n", expected: nil},
+		{list: "0", expected: []uint16{0}},
+		{list: "0-2,7,12-14\n", expected: []uint16{0, 1, 2, 7, 12, 13, 14}},
+		{list: "3-3", expected: []uint16{3}},
+		{list: "0-3,*4^2", isErr: true},
+		{list: "8-7", isErr: true},
+		{list: "1-2-3", isErr: true},
+		{list: "65536", isErr: true},
+	} {
+		list, err := ParseCPUSetList(tc.list)
+		if tc.isErr {
+			if err == nil {
+				t.Errorf("%q: expected an error, got %v", tc.list, list)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", tc.list, err)
+			continue
+		}
+		if !reflect.DeepEqual(list, tc.expected) {
+			t.Errorf("%q: expected %v, got %v", tc.list, tc.expected, list)
+		}
+	}
+}
+
+func TestFormatCPUSetList(t *testing.T) {
+	for _, tc := range []struct {
+		list     []uint16
+		expected string
+	}{
+		{list: nil, expected: ""},
+		{list: []uint16{0}, expected: "0"},
+		{list: []uint16{0, 1}, expected: "0-1"},
+		{list: []uint16{0, 1, 2, 7, 12, 13, 14}, expected: "0-2,7,12-14"},
+		{list: []uint16{1, 3, 5}, expected: "1,3,5"},
+	} {
+		if list := FormatCPUSetList(tc.list); list != tc.expected {
+			t.Errorf("%v: expected %q, got %q", tc.list, tc.expected, list)
+		}
+	}
+}
+
+func TestCheckCPUSet(t *testing.T) {
+	if err := CheckCPUSet("CPUs", "0-1,3", "0-3"); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := CheckCPUSet("CPUs", "1-x", "0-3"); err == nil {
+		t.Error("expected an error for an invalid list")
+	}
+	err := CheckCPUSet("CPUs", "2-5,8", "0-3")
+	if err == nil {
+		t.Fatal("expected an error for unavailable CPUs")
+	}
+	// The error lists both the unavailable and the available CPUs.
+	for _, s := range []string{"CPUs 4-5,8 are not available", "available CPUs: 0-3"} {
+		if !strings.Contains(err.Error(), s) {
+			t.Errorf("expected %q in the error, got %q", s, err)
+		}
+	}
+}
@@ -0,0 +1,238 @@
+package ebpf
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sync/atomic"
+	"unsafe"
+
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/asm"
+	"github.com/opencontainers/runc/libcontainer/cgroups/ebpf/devicefilter"
+	"github.com/opencontainers/runc/libcontainer/devices"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// ringbufMapType is BPF_MAP_TYPE_RINGBUF (Linux 5.8+), which is not
+	// known to the vendored ebpf package yet.
+	ringbufMapType = ebpf.MapType(27)
+	// deviceAuditRingbufSize is the size of the ring buffers to which the
+	// denied device accesses are written, enough for thousands of records.
+	deviceAuditRingbufSize = 64 << 10
+
+	ringbufBusyBit    = 1 << 31
+	ringbufDiscardBit = 1 << 30
+	ringbufHeaderSize = 8
+)
+
+// DeniedDeviceAccess is an access to a device denied by a device filter
+// program auditing the denied accesses.
+type DeniedDeviceAccess struct {
+	// Pid is the pid of the process to which access was denied, in the
+	// initial pid namespace.
+	Pid         int
+	Type        devices.Type
+	Major       int64
+	Minor       int64
+	Permissions devices.Permissions
+}
+
+// deviceAuditRingbuf returns the ring buffer to which the device filter
+// programs in progs write the denied accesses, or a new one if there is none,
+// so that readers of the ring buffer keep getting them once the device filter
+// is replaced.
+func deviceAuditRingbuf(progs []*ebpf.Program) (*ebpf.Map, error) {
+	for _, prog := range progs {
+		m, err := findProgramMap(prog, ringbufMapType)
+		if err != nil {
+			return nil, err
+		}
+		if m != nil {
+			return m, nil
+		}
+	}
+	m, err := ebpf.NewMap(&ebpf.MapSpec{
+		Name:       "runc_dev_audit",
+		Type:       ringbufMapType,
+		MaxEntries: deviceAuditRingbufSize,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the device audit ring buffer (requires Linux 5.8+): %w", err)
+	}
+	return m, nil
+}
+
+// LoadAttachCgroupDeviceAudit installs the device filter program insts to
+// the cgroup dirFd in audit-only mode: the accesses it denies are written to
+// a ring buffer (see WatchDeniedDeviceAccesses), then allowed. This is for the
+// cgroup v1 hosts, where the access to the devices is enforced by the devices
+// controller, and dirFd is the cgroup of the container in the unified
+// hierarchy. It replaces the programs attached to dirFd, keeping their ring
+// buffer. This requires Linux 5.8+.
+func LoadAttachCgroupDeviceAudit(insts asm.Instructions, license string, dirFd int) error {
+	raiseMemlockLimit()
+	oldProgs, err := findAttachedCgroupPrograms(dirFd, unix.BPF_CGROUP_DEVICE)
+	if err != nil {
+		return err
+	}
+	ringbuf, err := deviceAuditRingbuf(oldProgs)
+	if err != nil {
+		return err
+	}
+	// Once loaded, the program keeps the ring buffer alive.
+	defer ringbuf.Close()
+	spec := &ebpf.ProgramSpec{
+		Type:         ebpf.CGroupDevice,
+		Instructions: devicefilter.AuditOnly(insts, ringbuf.FD()),
+		License:      license,
+	}
+	_, err = loadAttachDeviceFilter(spec, oldProgs, dirFd, "", FailOpen)
+	return err
+}
+
+// WatchDeniedDeviceAccesses calls fn for every access denied by the device
+// filter of the cgroup dirPath, which must have been installed with audit
+// enabled. Once the cgroup is removed, or an error occurs, done is called.
+// Only one watcher gets each denied access.
+func WatchDeniedDeviceAccesses(dirPath string, fn func(DeniedDeviceAccess), done func()) error {
+	dirFd, err := unix.Open(dirPath, unix.O_DIRECTORY|unix.O_RDONLY, 0)
+	if err != nil {
+		return &os.PathError{Op: "open", Path: dirPath, Err: err}
+	}
+	progs, err := findAttachedCgroupPrograms(dirFd, unix.BPF_CGROUP_DEVICE)
+	unix.Close(dirFd)
+	if err != nil {
+		return err
+	}
+	var m *ebpf.Map
+	for _, prog := range progs {
+		if m == nil {
+			m, err = findProgramMap(prog, ringbufMapType)
+			if err != nil {
+				return err
+			}
+		}
+		prog.Close()
+	}
+	if m == nil {
+		return errors.New("the device filter does not audit denied accesses")
+	}
+	r, err := newRingbufReader(m)
+	if err != nil {
+		m.Close()
+		return err
+	}
+	go func() {
+		defer func() {
+			r.close()
+			done()
+		}()
+		fds := []unix.PollFd{{Fd: int32(m.FD()), Events: unix.POLLIN}}
+		for {
+			r.read(func(record []byte) {
+				if len(record) < int(unsafe.Sizeof(devicefilter.DeniedAccess{})) {
+					return
+				}
+				fn(deniedDeviceAccess((*devicefilter.DeniedAccess)(unsafe.Pointer(&record[0]))))
+			})
+			// The ring buffer outlives the cgroup while we have it opened,
+			// so check for the cgroup every second.
+			n, err := unix.Poll(fds, 1000)
+			if err != nil && !errors.Is(err, unix.EINTR) {
+				logrus.Warnf("unable to poll the device audit ring buffer: %v", err)
+				return
+			}
+			if n == 0 {
+				if _, err := os.Stat(dirPath); os.IsNotExist(err) {
+					return
+				}
+			}
+		}
+	}()
+	return nil
+}
+
+func deniedDeviceAccess(a *devicefilter.DeniedAccess) DeniedDeviceAccess {
+	res := DeniedDeviceAccess{
+		Pid:   int(a.Pid),
+		Type:  devices.CharDevice,
+		Major: int64(a.Major),
+		Minor: int64(a.Minor),
+	}
+	if a.AccessType&0xFFFF == unix.BPF_DEVCG_DEV_BLOCK {
+		res.Type = devices.BlockDevice
+	}
+	access := a.AccessType >> 16
+	if access&unix.BPF_DEVCG_ACC_READ != 0 {
+		res.Permissions += "r"
+	}
+	if access&unix.BPF_DEVCG_ACC_WRITE != 0 {
+		res.Permissions += "w"
+	}
+	if access&unix.BPF_DEVCG_ACC_MKNOD != 0 {
+		res.Permissions += "m"
+	}
+	return res
+}
+
+// ringbufReader reads the records of a BPF ring buffer, which is mapped in
+// memory as a consumer page, then a producer page followed by the data
+// pages mapped twice, so that the records wrapping around are contiguous.
+type ringbufReader struct {
+	m        *ebpf.Map
+	consumer []byte
+	producer []byte
+	data     []byte
+	mask     uint64
+}
+
+func newRingbufReader(m *ebpf.Map) (*ringbufReader, error) {
+	page := os.Getpagesize()
+	size := int(m.MaxEntries())
+	consumer, err := unix.Mmap(m.FD(), 0, page, unix.PROT_READ|unix.PROT_WRITE, unix.MAP_SHARED)
+	if err != nil {
+		return nil, fmt.Errorf("unable to map the consumer page of the ring buffer: %w", err)
+	}
+	producer, err := unix.Mmap(m.FD(), int64(page), page+2*size, unix.PROT_READ, unix.MAP_SHARED)
+	if err != nil {
+		_ = unix.Munmap(consumer)
+		return nil, fmt.Errorf("unable to map the data pages of the ring buffer: %w", err)
+	}
+	return &ringbufReader{
+		m:        m,
+		consumer: consumer,
+		producer: producer,
+		data:     producer[page:],
+		mask:     uint64(size - 1),
+	}, nil
+}
+
+// read calls fn for every record available.
+func (r *ringbufReader) read(fn func([]byte)) {
+	consumerPos := (*uint64)(unsafe.Pointer(&r.consumer[0]))
+	producerPos := (*uint64)(unsafe.Pointer(&r.producer[0]))
+	cons := atomic.LoadUint64(consumerPos)
+	for cons < atomic.LoadUint64(producerPos) {
+		off := cons & r.mask
+		header := atomic.LoadUint32((*uint32)(unsafe.Pointer(&r.data[off])))
+		if header&ringbufBusyBit != 0 {
+			// The record is not committed yet.
+			break
+		}
+		n := uint64(header &^ (ringbufBusyBit | ringbufDiscardBit))
+		if header&ringbufDiscardBit == 0 {
+			fn(r.data[off+ringbufHeaderSize : off+ringbufHeaderSize+n])
+		}
+		cons += (n + ringbufHeaderSize + 7) &^ 7
+		atomic.StoreUint64(consumerPos, cons)
+	}
+}
+
+func (r *ringbufReader) close() {
+	_ = unix.Munmap(r.producer)
+	_ = unix.Munmap(r.consumer)
+	r.m.Close()
+}
@@ -0,0 +1,100 @@
+package ebpf
+
+import (
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/asm"
+)
+
+const (
+	// bandwidthProgName is the name of the bandwidth limiting program, used
+	// to tell it apart from other egress programs attached to the cgroup.
+	bandwidthProgName = "runc_net_bw"
+
+	// bandwidthHorizon is the maximum delay (in ns) of a packet; packets
+	// which would have to be delayed any longer are dropped.
+	bandwidthHorizon = 2e9
+
+	// skbTstampOffset is offsetof(struct __sk_buff, tstamp).
+	skbTstampOffset = 152
+)
+
+// bandwidthFilter returns the instructions of a cgroup_skb egress program,
+// which limits the egress bandwidth of a cgroup to rate (in bytes per
+// second) using EDT (Earliest Departure Time): each packet is assigned a
+// departure time (skb->tstamp) according to the rate, which is then enforced
+// by the fq qdisc of the egress network device. The departure time of the
+// next packet is kept in the single element of the nextMap array.
+func bandwidthFilter(nextMap *ebpf.Map, rate uint64) asm.Instructions {
+	return asm.Instructions{
+		// R6 = skb
+		asm.Mov.Reg(asm.R6, asm.R1),
+		// R7 = &nextMap[0]
+		asm.StoreImm(asm.RFP, -4, 0, asm.Word),
+		asm.Mov.Reg(asm.R2, asm.RFP),
+		asm.Add.Imm(asm.R2, -4),
+		asm.LoadMapPtr(asm.R1, nextMap.FD()),
+		asm.FnMapLookupElem.Call(),
+		asm.JEq.Imm(asm.R0, 0, "accept"),
+		asm.Mov.Reg(asm.R7, asm.R0),
+		// R8 = now
+		asm.FnKtimeGetNs.Call(),
+		asm.Mov.Reg(asm.R8, asm.R0),
+		// R9 = max(nextMap[0], now)
+		asm.LoadMem(asm.R9, asm.R7, 0, asm.DWord),
+		asm.JGE.Reg(asm.R9, asm.R8, "horizon"),
+		asm.Mov.Reg(asm.R9, asm.R8),
+		// Drop the packet if it is beyond the horizon.
+		asm.Mov.Reg(asm.R1, asm.R9).Sym("horizon"),
+		asm.Sub.Reg(asm.R1, asm.R8),
+		asm.LoadImm(asm.R2, bandwidthHorizon, asm.DWord),
+		asm.JGT.Reg(asm.R1, asm.R2, "drop"),
+		// R1 = skb->len * NSEC_PER_SEC / rate
+		asm.LoadMem(asm.R1, asm.R6, 0, asm.Word),
+		asm.Mul.Imm(asm.R1, 1e9),
+		asm.LoadImm(asm.R2, int64(rate), asm.DWord),
+		asm.Div.Reg(asm.R1, asm.R2),
+		// skb->tstamp = max(skb->tstamp, R9)
+		asm.LoadMem(asm.R2, asm.R6, skbTstampOffset, asm.DWord),
+		asm.JGE.Reg(asm.R2, asm.R9, "update"),
+		asm.StoreMem(asm.R6, skbTstampOffset, asm.R9, asm.DWord),
+		// nextMap[0] = R9 + R1
+		asm.Add.Reg(asm.R9, asm.R1).Sym("update"),
+		asm.StoreMem(asm.R7, 0, asm.R9, asm.DWord),
+		asm.Mov.Imm(asm.R0, 1).Sym("accept"),
+		asm.Return(),
+		asm.Mov.Imm(asm.R0, 0).Sym("drop"),
+		asm.Return(),
+	}
+}
+
+// SetCgroupBandwidthLimit limits the egress network bandwidth of the cgroup
+// dirFd to rate (in bytes per second), by attaching (or replacing) a
+// cgroup_skb egress eBPF program. If rate is 0, the program is removed.
+//
+// The limit is only enforced if the fq qdisc is used for the egress network
+// device, as the program merely sets the earliest departure time of packets.
+//
+// Requires the system to be running in cgroup2 unified-mode, and a kernel
+// which allows cgroup_skb programs to set skb->tstamp (Linux >= 5.1).
+func SetCgroupBandwidthLimit(dirFd int, rate uint64) error {
+	if rate == 0 {
+		return setNamedCgroupProgram(dirFd, ebpf.AttachCGroupInetEgress, bandwidthProgName, nil)
+	}
+	raiseMemlockLimit()
+	nextMap, err := ebpf.NewMap(&ebpf.MapSpec{
+		Type:       ebpf.Array,
+		KeySize:    4,
+		ValueSize:  8,
+		MaxEntries: 1,
+	})
+	if err != nil {
+		return err
+	}
+	// The map is referenced by the program, and thus kept alive by it.
+	defer nextMap.Close()
+	return setNamedCgroupProgram(dirFd, ebpf.AttachCGroupInetEgress, bandwidthProgName, &ebpf.ProgramSpec{
+		Type:         ebpf.CGroupSKB,
+		Instructions: bandwidthFilter(nextMap, rate),
+		License:      "Apache",
+	})
+}
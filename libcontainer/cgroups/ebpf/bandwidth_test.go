@@ -0,0 +1,47 @@
+package ebpf
+
+import (
+	"testing"
+
+	"github.com/cilium/ebpf"
+)
+
+func TestBandwidthFilter(t *testing.T) {
+	nextMap, err := ebpf.NewMap(&ebpf.MapSpec{
+		Type:       ebpf.Array,
+		KeySize:    4,
+		ValueSize:  8,
+		MaxEntries: 1,
+	})
+	if err != nil {
+		t.Skipf("unable to create eBPF map: %v", err)
+	}
+	defer nextMap.Close()
+	prog, err := ebpf.NewProgram(&ebpf.ProgramSpec{
+		Name:         bandwidthProgName,
+		Type:         ebpf.CGroupSKB,
+		Instructions: bandwidthFilter(nextMap, 1000),
+		License:      "Apache",
+	})
+	if err != nil {
+		t.Fatalf("program rejected: %v", err)
+	}
+	defer prog.Close()
+
+	// At 1000 bytes per second, each packet (100 bytes, less the Ethernet
+	// header) delays the next one by less than 100ms, so the first packets
+	// are accepted, and those beyond the 2s horizon are dropped.
+	pkt := make([]byte, 100)
+	for i := 0; i < 30; i++ {
+		ret, _, err := prog.Test(pkt)
+		if err != nil {
+			t.Skipf("unable to run eBPF program: %v", err)
+		}
+		if ret != 1 && i < 20 {
+			t.Fatalf("packet %d: expected to be accepted, got %d", i, ret)
+		}
+		if ret != 0 && i >= 25 {
+			t.Fatalf("packet %d: expected to be dropped, got %d", i, ret)
+		}
+	}
+}
@@ -9,6 +9,7 @@ package devicefilter
 import (
 	"math"
 	"strconv"
+	"unsafe"
 
 	"github.com/cilium/ebpf/asm"
 	devicesemulator "github.com/opencontainers/runc/libcontainer/cgroups/devices"
@@ -24,6 +25,29 @@ const (
 
 // DeviceFilter returns eBPF device filter program and its license string
 func DeviceFilter(rules []*devices.Rule) (asm.Instructions, string, error) {
+	cleanRules, defaultAllow, err := emulateRules(rules)
+	if err != nil {
+		return nil, "", err
+	}
+
+	p := &program{
+		defaultAllow: defaultAllow,
+	}
+	p.init()
+
+	for _, rule := range cleanRules {
+		if err := p.appendRule(rule); err != nil {
+			return nil, "", err
+		}
+	}
+	insts, err := p.finalize()
+	return insts, license, err
+}
+
+// emulateRules returns the minimum ruleset for rules (without the wildcard
+// rule setting the default action), and whether access to the devices is
+// allowed by default. All the rules returned have the opposite action.
+func emulateRules(rules []*devices.Rule) ([]*devices.Rule, bool, error) {
 	// Generate the minimum ruleset for the device rules we are given. While we
 	// don't care about minimum transitions in cgroupv2, using the emulator
 	// gives us a guarantee that the behaviour of devices filtering is the same
@@ -32,40 +56,69 @@ func DeviceFilter(rules []*devices.Rule) (asm.Instructions, string, error) {
 	emu := new(devicesemulator.Emulator)
 	for _, rule := range rules {
 		if err := emu.Apply(*rule); err != nil {
-			return nil, "", err
+			return nil, false, err
 		}
 	}
 	cleanRules, err := emu.Rules()
 	if err != nil {
-		return nil, "", err
-	}
-
-	p := &program{
-		defaultAllow: emu.IsBlacklist(),
+		return nil, false, err
 	}
-	p.init()
 
+	defaultAllow := emu.IsBlacklist()
+	var res []*devices.Rule
 	for idx, rule := range cleanRules {
 		if rule.Type == devices.WildcardDevice {
 			// We can safely skip over wildcard entries because there should
 			// only be one (at most) at the very start to instruct cgroupv1 to
 			// go into allow-list mode. However we do double-check this here.
-			if idx != 0 || rule.Allow != emu.IsBlacklist() {
-				return nil, "", errors.Errorf("[internal error] emulated cgroupv2 devices ruleset had bad wildcard at idx %v (%s)", idx, rule.CgroupString())
+			if idx != 0 || rule.Allow != defaultAllow {
+				return nil, false, errors.Errorf("[internal error] emulated cgroupv2 devices ruleset had bad wildcard at idx %v (%s)", idx, rule.CgroupString())
 			}
 			continue
 		}
-		if rule.Allow == p.defaultAllow {
+		if rule.Allow == defaultAllow {
 			// There should be no rules which have an action equal to the
 			// default action, the emulator removes those.
-			return nil, "", errors.Errorf("[internal error] emulated cgroupv2 devices ruleset had no-op rule at idx %v (%s)", idx, rule.CgroupString())
+			return nil, false, errors.Errorf("[internal error] emulated cgroupv2 devices ruleset had no-op rule at idx %v (%s)", idx, rule.CgroupString())
 		}
-		if err := p.appendRule(rule); err != nil {
-			return nil, "", err
+		res = append(res, rule)
+	}
+	return res, defaultAllow, nil
+}
+
+// bpfRule returns the eBPF device type and access of rule, which must not be
+// a wildcard ('a') rule.
+func bpfRule(rule *devices.Rule) (int32, int32, error) {
+	var bpfType int32
+	switch rule.Type {
+	case devices.CharDevice:
+		bpfType = int32(unix.BPF_DEVCG_DEV_CHAR)
+	case devices.BlockDevice:
+		bpfType = int32(unix.BPF_DEVCG_DEV_BLOCK)
+	default:
+		// We do not permit 'a', nor any other types we don't know about.
+		return 0, 0, errors.Errorf("invalid type %q", string(rule.Type))
+	}
+	if rule.Major > math.MaxUint32 {
+		return 0, 0, errors.Errorf("invalid major %d", rule.Major)
+	}
+	if rule.Minor > math.MaxUint32 {
+		return 0, 0, errors.Errorf("invalid minor %d", rule.Major)
+	}
+	bpfAccess := int32(0)
+	for _, r := range rule.Permissions {
+		switch r {
+		case 'r':
+			bpfAccess |= unix.BPF_DEVCG_ACC_READ
+		case 'w':
+			bpfAccess |= unix.BPF_DEVCG_ACC_WRITE
+		case 'm':
+			bpfAccess |= unix.BPF_DEVCG_ACC_MKNOD
+		default:
+			return 0, 0, errors.Errorf("unknown device access %v", r)
 		}
 	}
-	insts, err := p.finalize()
-	return insts, license, err
+	return bpfType, bpfAccess, nil
 }
 
 type program struct {
@@ -110,37 +163,12 @@ func (p *program) appendRule(rule *devices.Rule) error {
 		return errors.New("the program is finalized")
 	}
 
-	var bpfType int32
-	switch rule.Type {
-	case devices.CharDevice:
-		bpfType = int32(unix.BPF_DEVCG_DEV_CHAR)
-	case devices.BlockDevice:
-		bpfType = int32(unix.BPF_DEVCG_DEV_BLOCK)
-	default:
-		// We do not permit 'a', nor any other types we don't know about.
-		return errors.Errorf("invalid type %q", string(rule.Type))
-	}
-	if rule.Major > math.MaxUint32 {
-		return errors.Errorf("invalid major %d", rule.Major)
-	}
-	if rule.Minor > math.MaxUint32 {
-		return errors.Errorf("invalid minor %d", rule.Major)
+	bpfType, bpfAccess, err := bpfRule(rule)
+	if err != nil {
+		return err
 	}
 	hasMajor := rule.Major >= 0 // if not specified in OCI json, major is set to -1
 	hasMinor := rule.Minor >= 0
-	bpfAccess := int32(0)
-	for _, r := range rule.Permissions {
-		switch r {
-		case 'r':
-			bpfAccess |= unix.BPF_DEVCG_ACC_READ
-		case 'w':
-			bpfAccess |= unix.BPF_DEVCG_ACC_WRITE
-		case 'm':
-			bpfAccess |= unix.BPF_DEVCG_ACC_MKNOD
-		default:
-			return errors.Errorf("unknown device access %v", r)
-		}
-	}
 	// If the access is rwm, skip the check.
 	hasAccess := bpfAccess != (unix.BPF_DEVCG_ACC_READ | unix.BPF_DEVCG_ACC_WRITE | unix.BPF_DEVCG_ACC_MKNOD)
 
@@ -206,3 +234,214 @@ func acceptBlock(accept bool) asm.Instructions {
 		asm.Return(),
 	}
 }
+
+// DeviceKey is the key of the map consulted by the program returned by
+// MapProgram. It is the device type (BPF_DEVCG_DEV_*), and its major and
+// minor numbers, each of which can be Wildcard to match any number.
+//
+// The key with a zero Type is not a device: its value is the default action
+// (1 to allow access to the devices, 0 to deny it).
+type DeviceKey struct {
+	Type  uint32
+	Major uint32
+	Minor uint32
+}
+
+// Wildcard is the major or minor number of a DeviceKey matching any number.
+const Wildcard = ^uint32(0)
+
+// DefaultKey is the key of the default action in the map of MapProgram.
+var DefaultKey = DeviceKey{}
+
+// DeviceFilterMap returns the contents of the map consulted by the program
+// returned by MapProgram, implementing the same filter as the program
+// returned by DeviceFilter, and its license string. The value of the entries
+// is the access (BPF_DEVCG_ACC_*) of the devices matching their key.
+func DeviceFilterMap(rules []*devices.Rule) (map[DeviceKey]uint32, string, error) {
+	cleanRules, defaultAllow, err := emulateRules(rules)
+	if err != nil {
+		return nil, "", err
+	}
+	entries := make(map[DeviceKey]uint32, len(cleanRules)+1)
+	if defaultAllow {
+		entries[DefaultKey] = 1
+	} else {
+		entries[DefaultKey] = 0
+	}
+	for _, rule := range cleanRules {
+		bpfType, bpfAccess, err := bpfRule(rule)
+		if err != nil {
+			return nil, "", err
+		}
+		key := DeviceKey{Type: uint32(bpfType), Major: Wildcard, Minor: Wildcard}
+		if rule.Major >= 0 {
+			key.Major = uint32(rule.Major)
+		}
+		if rule.Minor >= 0 {
+			key.Minor = uint32(rule.Minor)
+		}
+		entries[key] = uint32(bpfAccess)
+	}
+	return entries, license, nil
+}
+
+// MapProgram returns a device filter program consulting the hash map of
+// DeviceKey to access mapFd (see DeviceFilterMap), rather than having the
+// rules in its instructions. The device is looked up in the map, with its
+// major and minor numbers or wildcards: if one of the entries found has
+// all the requested access, the access is granted unless it is by default,
+// and the other way around. If the map has no default action, access is
+// denied.
+func MapProgram(mapFd int) asm.Instructions {
+	// R6 <- ctx, R7 <- type, R8 <- access (these are kept across calls)
+	insts := asm.Instructions{
+		asm.Mov.Reg(asm.R6, asm.R1),
+		asm.LoadMem(asm.R7, asm.R6, 0, asm.Word),
+		asm.And.Imm32(asm.R7, 0xFFFF),
+		asm.LoadMem(asm.R8, asm.R6, 0, asm.Word),
+		asm.RSh.Imm32(asm.R8, 16),
+		// key <- {type, major, minor} (on the stack at R10-12)
+		asm.StoreMem(asm.R10, -12, asm.R7, asm.Word),
+		asm.LoadMem(asm.R1, asm.R6, 4, asm.Word),
+		asm.StoreMem(asm.R10, -8, asm.R1, asm.Word),
+		asm.LoadMem(asm.R1, asm.R6, 8, asm.Word),
+		asm.StoreMem(asm.R10, -4, asm.R1, asm.Word),
+	}
+	keys := []asm.Instructions{
+		// {type, major, minor}
+		nil,
+		// {type, major, *}
+		{asm.StoreImm(asm.R10, -4, -1, asm.Word)},
+		// {type, *, minor}
+		{
+			asm.StoreImm(asm.R10, -8, -1, asm.Word),
+			asm.LoadMem(asm.R1, asm.R6, 8, asm.Word),
+			asm.StoreMem(asm.R10, -4, asm.R1, asm.Word),
+		},
+		// {type, *, *}
+		{asm.StoreImm(asm.R10, -4, -1, asm.Word)},
+	}
+	for i, key := range keys {
+		nextBlockSym := "block-" + strconv.Itoa(i+1)
+		block := append(key, lookupMap(mapFd)...)
+		block = append(block,
+			// if (R0 == NULL) goto next
+			asm.JEq.Imm(asm.R0, 0, nextBlockSym),
+			// if (R8 & ^*R0 == 0 /* use R1 as a temp var */) goto match
+			asm.LoadMem(asm.R1, asm.R0, 0, asm.Word),
+			asm.Xor.Imm32(asm.R1, -1),
+			asm.And.Reg32(asm.R1, asm.R8),
+			asm.JEq.Imm(asm.R1, 0, "match"),
+		)
+		block[0] = block[0].Sym("block-" + strconv.Itoa(i))
+		insts = append(insts, block...)
+	}
+	insts = append(insts,
+		// R9 <- whether the device matched
+		asm.Mov.Imm32(asm.R9, 0).Sym("block-"+strconv.Itoa(len(keys))),
+		asm.Ja.Label("default"),
+		asm.Mov.Imm32(asm.R9, 1).Sym("match"),
+		// key <- the default key
+		asm.StoreImm(asm.R10, -12, 0, asm.Word).Sym("default"),
+		asm.StoreImm(asm.R10, -8, 0, asm.Word),
+		asm.StoreImm(asm.R10, -4, 0, asm.Word),
+	)
+	insts = append(insts, lookupMap(mapFd)...)
+	insts = append(insts,
+		// if (R0 == NULL) goto deny
+		asm.JEq.Imm(asm.R0, 0, "deny"),
+		// R0 <- (*R0 ^ R9) & 1
+		asm.LoadMem(asm.R0, asm.R0, 0, asm.Word),
+		asm.Xor.Reg32(asm.R0, asm.R9),
+		asm.And.Imm32(asm.R0, 1),
+		asm.Return(),
+	)
+	deny := acceptBlock(false)
+	deny[0] = deny[0].Sym("deny")
+	return append(insts, deny...)
+}
+
+// lookupMap looks the key at R10-12 up in the map mapFd, setting R0 to
+// the value found, or NULL.
+func lookupMap(mapFd int) asm.Instructions {
+	return asm.Instructions{
+		asm.LoadMapPtr(asm.R1, mapFd),
+		asm.Mov.Reg(asm.R2, asm.R10),
+		asm.Add.Imm(asm.R2, -12),
+		asm.FnMapLookupElem.Call(),
+	}
+}
+
+// DeniedAccess is the record written to the ring buffer of a program returned
+// by AuditDenials for every denied access.
+type DeniedAccess struct {
+	// AccessType is the access_type of struct bpf_cgroup_dev_ctx: the
+	// device type in the lower 16 bits, and the access in the upper ones.
+	AccessType uint32
+	Major      uint32
+	Minor      uint32
+	// Pid is the (host) pid of the process to which access was denied.
+	Pid uint32
+}
+
+// AuditDenials returns the device filter program insts, modified to write a
+// DeniedAccess to the ring buffer map ringbufFd every time it denies access
+// to a device. insts must not use the stack below R10-32.
+func AuditDenials(insts asm.Instructions, ringbufFd int) asm.Instructions {
+	return auditDenials(insts, ringbufFd, 0)
+}
+
+// AuditOnly is like AuditDenials, except that the returned program allows
+// the accesses which insts denies, once they are written to the ring buffer.
+// This is for the cgroup v1 hosts, where the devices controller enforces the
+// rules and the program is attached to the cgroup of the unified hierarchy,
+// so that the kernel runs it before checking the rules of the controller.
+func AuditOnly(insts asm.Instructions, ringbufFd int) asm.Instructions {
+	return auditDenials(insts, ringbufFd, 1)
+}
+
+func auditDenials(insts asm.Instructions, ringbufFd int, ret int32) asm.Instructions {
+	res := asm.Instructions{
+		// *(R10-32) <- ctx
+		asm.StoreMem(asm.R10, -32, asm.R1, asm.DWord),
+	}
+	for _, ins := range insts {
+		if ins.OpCode == asm.Return().OpCode {
+			// goto audit (with the return value in R0)
+			sym := ins.Symbol
+			ins = asm.Ja.Label("audit")
+			ins.Symbol = sym
+		}
+		res = append(res, ins)
+	}
+	return append(res,
+		// if (R0 != 0) goto exit
+		asm.JNE.Imm(asm.R0, 0, "exit").Sym("audit"),
+		// record <- {access_type, major, minor} (on the stack at R10-48)
+		asm.LoadMem(asm.R6, asm.R10, -32, asm.DWord),
+		asm.LoadMem(asm.R1, asm.R6, 0, asm.Word),
+		asm.StoreMem(asm.R10, -48, asm.R1, asm.Word),
+		asm.LoadMem(asm.R1, asm.R6, 4, asm.Word),
+		asm.StoreMem(asm.R10, -44, asm.R1, asm.Word),
+		asm.LoadMem(asm.R1, asm.R6, 8, asm.Word),
+		asm.StoreMem(asm.R10, -40, asm.R1, asm.Word),
+		// record.pid <- bpf_get_current_pid_tgid() >> 32
+		asm.FnGetCurrentPidTgid.Call(),
+		asm.RSh.Imm(asm.R0, 32),
+		asm.StoreMem(asm.R10, -36, asm.R0, asm.Word),
+		// bpf_ringbuf_output(ringbuf, &record, sizeof(record), 0)
+		asm.LoadMapPtr(asm.R1, ringbufFd),
+		asm.Mov.Reg(asm.R2, asm.R10),
+		asm.Add.Imm(asm.R2, -48),
+		asm.Mov.Imm(asm.R3, int32(unsafe.Sizeof(DeniedAccess{}))),
+		asm.Mov.Imm(asm.R4, 0),
+		fnRingbufOutput.Call(),
+		// R0 <- ret (0 to reject, 1 to accept)
+		asm.Mov.Imm32(asm.R0, ret),
+		asm.Return().Sym("exit"),
+	)
+}
+
+// fnRingbufOutput is bpf_ringbuf_output (Linux 5.8+), which is not known to
+// the vendored asm package yet.
+const fnRingbufOutput = asm.BuiltinFunc(130)
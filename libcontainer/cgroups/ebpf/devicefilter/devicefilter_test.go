@@ -1,9 +1,11 @@
 package devicefilter
 
 import (
+	"reflect"
 	"strings"
 	"testing"
 
+	"github.com/cilium/ebpf/asm"
 	"github.com/opencontainers/runc/libcontainer/devices"
 	"github.com/opencontainers/runc/libcontainer/specconv"
 )
@@ -258,3 +260,97 @@ block-1:
 `
 	testDeviceFilter(t, devices, expected)
 }
+
+func TestDeviceFilterMap(t *testing.T) {
+	rules := []*devices.Rule{
+		{
+			Type:        'c',
+			Major:       1,
+			Minor:       3,
+			Permissions: "rw",
+			Allow:       true,
+		},
+		{
+			Type:        'b',
+			Major:       8,
+			Minor:       -1,
+			Permissions: "rwm",
+			Allow:       true,
+		},
+	}
+	entries, _, err := DeviceFilterMap(rules)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[DeviceKey]uint32{
+		DefaultKey:                           0,
+		{Type: 2, Major: 1, Minor: 3}:        6,
+		{Type: 1, Major: 8, Minor: Wildcard}: 7,
+	}
+	if !reflect.DeepEqual(entries, expected) {
+		t.Fatalf("expected %+v, got %+v", expected, entries)
+	}
+
+	// Rules denying access when it is allowed by default.
+	rules = []*devices.Rule{
+		{
+			Type:        'a',
+			Major:       -1,
+			Minor:       -1,
+			Permissions: "rwm",
+			Allow:       true,
+		},
+		{
+			Type:        'c',
+			Major:       -1,
+			Minor:       5,
+			Permissions: "m",
+			Allow:       false,
+		},
+	}
+	entries, _, err = DeviceFilterMap(rules)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = map[DeviceKey]uint32{
+		DefaultKey:                           1,
+		{Type: 2, Major: Wildcard, Minor: 5}: 1,
+	}
+	if !reflect.DeepEqual(entries, expected) {
+		t.Fatalf("expected %+v, got %+v", expected, entries)
+	}
+}
+
+func TestAuditDenials(t *testing.T) {
+	insts, _, err := DeviceFilter(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	audited := AuditDenials(insts, 42)
+	for i, ins := range audited[:len(audited)-1] {
+		if ins.OpCode == asm.Return().OpCode {
+			t.Fatalf("unexpected exit at %d, before the audit:\n%v", i, audited)
+		}
+	}
+	if ins := audited[len(audited)-1]; ins.OpCode != asm.Return().OpCode || ins.Symbol != "exit" {
+		t.Fatalf("expected the program to end with the exit, got %v", ins)
+	}
+	if _, err := audited.SymbolOffsets(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAuditOnly(t *testing.T) {
+	insts, _, err := DeviceFilter(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	audited := AuditOnly(insts, 42)
+	// The denied accesses are allowed once recorded.
+	if ins := audited[len(audited)-2]; ins.OpCode != asm.Mov.Imm32(asm.R0, 1).OpCode || ins.Constant != 1 {
+		t.Fatalf("expected the denied accesses to be allowed, got %v", ins)
+	}
+	if _, err := audited.SymbolOffsets(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,300 @@
+package ebpf
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"runtime"
+	"unsafe"
+
+	"github.com/cilium/ebpf"
+	"github.com/opencontainers/runc/libcontainer/cgroups/ebpf/devicefilter"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/sys/unix"
+)
+
+// deviceFilterMapProgName is the name of the device filter programs
+// consulting a map, by which they are found on subsequent calls to
+// LoadAttachCgroupDeviceFilterMap (at most 15 characters).
+const deviceFilterMapProgName = "runc_device_map"
+
+// deviceFilterMapMinEntries is the minimum capacity of the maps of the device
+// filter programs, so that rules can be added without reloading them.
+const deviceFilterMapMinEntries = 256
+
+// deviceFilterMapPinPath returns the path at which the map of the device
+// filter program pinned at pinPath is pinned.
+func deviceFilterMapPinPath(pinPath string) string {
+	return pinPath + "_map"
+}
+
+// LoadAttachCgroupDeviceFilterMap installs the eBPF device filter program
+// consulting a map (see devicefilter.MapProgram) to the cgroup dirFd, with
+// entries as the contents of its map (see devicefilter.DeviceFilterMap).
+//
+// If such a program is attached to the cgroup already, its map is updated
+// in place, so that the program doesn't have to be replaced. Otherwise, or
+// if the default action changes or the map is too small for entries, a new
+// program and map are installed as with LoadAttachCgroupDeviceFilter. If
+// pinPath is not empty, the map is pinned along with the program, with a
+// "_map" suffix.
+func LoadAttachCgroupDeviceFilterMap(entries map[devicefilter.DeviceKey]uint32, license string, dirFd int, pinPath string, policy DetachPolicy, audit bool) (func() error, error) {
+	raiseMemlockLimit()
+	oldProgs, err := findAttachedCgroupPrograms(dirFd, unix.BPF_CGROUP_DEVICE)
+	if err != nil {
+		return nilCloser, err
+	}
+	if prog := findDeviceFilterMapProgram(oldProgs); prog != nil && auditsDenials(prog) == audit {
+		updated, err := updateDeviceFilterMap(prog, entries)
+		if err != nil {
+			return nilCloser, err
+		}
+		if updated {
+			closer := deviceFilterCloser(prog, nil, license, dirFd, pinPath, policy)
+			if pinPath != "" {
+				if err := pinDeviceFilterMap(prog, pinPath); err != nil {
+					return closer, err
+				}
+			}
+			return closer, nil
+		}
+	}
+
+	maxEntries := uint32(2 * len(entries))
+	if maxEntries < deviceFilterMapMinEntries {
+		maxEntries = deviceFilterMapMinEntries
+	}
+	m, err := ebpf.NewMap(&ebpf.MapSpec{
+		Name:       deviceFilterMapProgName,
+		Type:       ebpf.Hash,
+		KeySize:    uint32(unsafe.Sizeof(devicefilter.DeviceKey{})),
+		ValueSize:  4,
+		MaxEntries: maxEntries,
+		Flags:      unix.BPF_F_NO_PREALLOC,
+	})
+	if err != nil {
+		return nilCloser, fmt.Errorf("failed to create the device filter map: %w", err)
+	}
+	// Once loaded, the program keeps the map alive.
+	defer m.Close()
+	for key, value := range entries {
+		if err := m.Put(key, value); err != nil {
+			return nilCloser, fmt.Errorf("failed to add %+v to the device filter map: %w", key, err)
+		}
+	}
+	insts := devicefilter.MapProgram(m.FD())
+	if audit {
+		ringbuf, err := deviceAuditRingbuf(oldProgs)
+		if err != nil {
+			return nilCloser, err
+		}
+		defer ringbuf.Close()
+		insts = devicefilter.AuditDenials(insts, ringbuf.FD())
+	}
+	spec := &ebpf.ProgramSpec{
+		Name:         deviceFilterMapProgName,
+		Type:         ebpf.CGroupDevice,
+		Instructions: insts,
+		License:      license,
+	}
+	closer, err := loadAttachDeviceFilter(spec, oldProgs, dirFd, pinPath, policy)
+	if err != nil {
+		return closer, err
+	}
+	if pinPath != "" {
+		mapPinPath := deviceFilterMapPinPath(pinPath)
+		if err := m.Pin(mapPinPath); err != nil {
+			return closer, fmt.Errorf("failed to pin device filter map to %s: %w", mapPinPath, err)
+		}
+	}
+	return closer, nil
+}
+
+// findDeviceFilterMapProgram returns the device filter program consulting a
+// map among progs, if any.
+func findDeviceFilterMapProgram(progs []*ebpf.Program) *ebpf.Program {
+	for _, prog := range progs {
+		if info, err := prog.Info(); err == nil && info.Name == deviceFilterMapProgName {
+			return prog
+		}
+	}
+	return nil
+}
+
+// auditsDenials returns whether prog writes the accesses it denies to a ring
+// buffer.
+func auditsDenials(prog *ebpf.Program) bool {
+	m, err := findProgramMap(prog, ringbufMapType)
+	if err != nil || m == nil {
+		return false
+	}
+	m.Close()
+	return true
+}
+
+// updateDeviceFilterMap updates the map of the device filter program prog
+// to have entries as its contents. Entries are removed first when access to
+// the devices is denied by default, and added first otherwise, so that the
+// access granted in between is never more than before or after the update.
+// It returns false, without updating the map, if the default action is
+// changed or the map is too small, so that the program has to be replaced.
+func updateDeviceFilterMap(prog *ebpf.Program, entries map[devicefilter.DeviceKey]uint32) (bool, error) {
+	m, err := findProgramMap(prog, ebpf.Hash)
+	if err != nil {
+		return false, err
+	}
+	if m == nil {
+		return false, errors.New("the device filter program has no map")
+	}
+	defer m.Close()
+	if uint32(len(entries)) > m.MaxEntries() {
+		return false, nil
+	}
+	var defaultAllow uint32
+	if err := m.Lookup(devicefilter.DefaultKey, &defaultAllow); err != nil || defaultAllow != entries[devicefilter.DefaultKey] {
+		return false, nil
+	}
+
+	var (
+		key   devicefilter.DeviceKey
+		value uint32
+		stale []devicefilter.DeviceKey
+		cur   = make(map[devicefilter.DeviceKey]uint32)
+	)
+	iter := m.Iterate()
+	for iter.Next(&key, &value) {
+		cur[key] = value
+		if _, ok := entries[key]; !ok {
+			stale = append(stale, key)
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return false, fmt.Errorf("failed to iterate over the device filter map: %w", err)
+	}
+	remove := func() error {
+		for _, key := range stale {
+			if err := m.Delete(key); err != nil && !errors.Is(err, ebpf.ErrKeyNotExist) {
+				return fmt.Errorf("failed to remove %+v from the device filter map: %w", key, err)
+			}
+		}
+		return nil
+	}
+	add := func() error {
+		for key, value := range entries {
+			if v, ok := cur[key]; ok && v == value {
+				continue
+			}
+			if err := m.Put(key, value); err != nil {
+				return fmt.Errorf("failed to add %+v to the device filter map: %w", key, err)
+			}
+		}
+		return nil
+	}
+	steps := []func() error{remove, add}
+	if defaultAllow != 0 {
+		steps = []func() error{add, remove}
+	}
+	for _, step := range steps {
+		if err := step(); err != nil {
+			return false, err
+		}
+	}
+	logrus.Debugf("updated the device filter map in place (%d entries)", len(entries))
+	return true, nil
+}
+
+// findProgramMap returns the map of type typ used by prog, or nil if there
+// is none.
+func findProgramMap(prog *ebpf.Program, typ ebpf.MapType) (*ebpf.Map, error) {
+	ids, err := programMapIDs(prog)
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range ids {
+		m, err := ebpf.NewMapFromID(id)
+		if err != nil {
+			return nil, fmt.Errorf("cannot fetch map from id: %w", err)
+		}
+		if m.Type() == typ {
+			return m, nil
+		}
+		m.Close()
+	}
+	return nil, nil
+}
+
+// programMapIDs returns the ids of the maps used by prog.
+func programMapIDs(prog *ebpf.Program) ([]ebpf.MapID, error) {
+	// The beginning of struct bpf_prog_info, up to map_ids, which is not
+	// exposed by ebpf.ProgramInfo.
+	type bpfProgInfo struct {
+		Type            uint32
+		ID              uint32
+		Tag             [unix.BPF_TAG_SIZE]byte
+		JitedProgLen    uint32
+		XlatedProgLen   uint32
+		JitedProgInsns  uint64
+		XlatedProgInsns uint64
+		LoadTime        uint64
+		CreatedByUID    uint32
+		NrMapIDs        uint32
+		MapIDs          uint64 // __aligned_u64
+	}
+	type bpfAttrObjInfo struct {
+		BpfFd   uint32
+		InfoLen uint32
+		Info    uint64 // __aligned_u64
+	}
+
+	// The first call gets the number of maps, the second one their ids.
+	var mapIDs []uint32
+	for {
+		info := bpfProgInfo{NrMapIDs: uint32(len(mapIDs))}
+		if len(mapIDs) > 0 {
+			info.MapIDs = uint64(uintptr(unsafe.Pointer(&mapIDs[0])))
+		}
+		attr := bpfAttrObjInfo{
+			BpfFd:   uint32(prog.FD()),
+			InfoLen: uint32(unsafe.Sizeof(info)),
+			Info:    uint64(uintptr(unsafe.Pointer(&info))),
+		}
+		_, _, errno := unix.Syscall(unix.SYS_BPF,
+			uintptr(unix.BPF_OBJ_GET_INFO_BY_FD),
+			uintptr(unsafe.Pointer(&attr)),
+			unsafe.Sizeof(attr))
+		runtime.KeepAlive(prog)
+		runtime.KeepAlive(&info)
+		runtime.KeepAlive(mapIDs)
+		if errno != 0 {
+			return nil, fmt.Errorf("bpf_obj_get_info_by_fd failed: %w", errno)
+		}
+		if int(info.NrMapIDs) <= len(mapIDs) {
+			ids := make([]ebpf.MapID, info.NrMapIDs)
+			for i := range ids {
+				ids[i] = ebpf.MapID(mapIDs[i])
+			}
+			return ids, nil
+		}
+		mapIDs = make([]uint32, info.NrMapIDs)
+	}
+}
+
+// pinDeviceFilterMap pins prog at pinPath, and its map next to it.
+func pinDeviceFilterMap(prog *ebpf.Program, pinPath string) error {
+	if err := pinDeviceFilter(prog, pinPath); err != nil {
+		return err
+	}
+	m, err := findProgramMap(prog, ebpf.Hash)
+	if err != nil {
+		return err
+	}
+	if m == nil {
+		return errors.New("the device filter program has no map")
+	}
+	defer m.Close()
+	mapPinPath := deviceFilterMapPinPath(pinPath)
+	if err := m.Pin(mapPinPath); err != nil && !os.IsExist(err) {
+		return fmt.Errorf("failed to pin device filter map to %s: %w", mapPinPath, err)
+	}
+	return nil
+}
@@ -2,12 +2,16 @@ package ebpf
 
 import (
 	"fmt"
+	"os"
+	"path/filepath"
 	"runtime"
+	"sync"
 	"unsafe"
 
 	"github.com/cilium/ebpf"
 	"github.com/cilium/ebpf/asm"
 	"github.com/cilium/ebpf/link"
+	"github.com/opencontainers/runc/libcontainer/cgroups/ebpf/devicefilter"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 	"golang.org/x/sys/unix"
@@ -17,7 +21,9 @@ func nilCloser() error {
 	return nil
 }
 
-func findAttachedCgroupDeviceFilters(dirFd int) ([]*ebpf.Program, error) {
+// findAttachedCgroupPrograms returns the programs of the given attach type
+// (such as BPF_CGROUP_DEVICE) attached to the cgroup dirFd.
+func findAttachedCgroupPrograms(dirFd int, attachType uint32) ([]*ebpf.Program, error) {
 	type bpfAttrQuery struct {
 		TargetFd    uint32
 		AttachType  uint32
@@ -34,7 +40,7 @@ func findAttachedCgroupDeviceFilters(dirFd int) ([]*ebpf.Program, error) {
 		progIds := make([]uint32, size)
 		query := bpfAttrQuery{
 			TargetFd:   uint32(dirFd),
-			AttachType: uint32(unix.BPF_CGROUP_DEVICE),
+			AttachType: attachType,
 			ProgIds:    uint64(uintptr(unsafe.Pointer(&progIds[0]))),
 			ProgCnt:    uint32(len(progIds)),
 		}
@@ -52,7 +58,7 @@ func findAttachedCgroupDeviceFilters(dirFd int) ([]*ebpf.Program, error) {
 				retries++
 				continue
 			}
-			return nil, fmt.Errorf("bpf_prog_query(BPF_CGROUP_DEVICE) failed: %w", errno)
+			return nil, fmt.Errorf("bpf_prog_query(%d) failed: %w", attachType, errno)
 		}
 
 		// Convert the ids to program handles.
@@ -69,79 +75,416 @@ func findAttachedCgroupDeviceFilters(dirFd int) ([]*ebpf.Program, error) {
 		return programs, nil
 	}
 
-	return nil, errors.New("could not get complete list of CGROUP_DEVICE programs")
+	return nil, errors.New("could not get complete list of attached programs")
 }
 
-// LoadAttachCgroupDeviceFilter installs eBPF device filter program to /sys/fs/cgroup/<foo> directory.
-//
-// Requires the system to be running in cgroup2 unified-mode with kernel >= 4.15 .
-//
-// https://github.com/torvalds/linux/commit/ebc614f687369f9df99828572b1d85a7c2de3d92
-func LoadAttachCgroupDeviceFilter(insts asm.Instructions, license string, dirFd int) (func() error, error) {
-	// Increase `ulimit -l` limit to avoid BPF_PROG_LOAD error (#2167).
-	// This limit is not inherited into the container.
+// raiseMemlockLimit increases `ulimit -l` limit to avoid BPF_PROG_LOAD error
+// (#2167). This limit is not inherited into the container.
+func raiseMemlockLimit() {
 	memlockLimit := &unix.Rlimit{
 		Cur: unix.RLIM_INFINITY,
 		Max: unix.RLIM_INFINITY,
 	}
 	_ = unix.Setrlimit(unix.RLIMIT_MEMLOCK, memlockLimit)
+}
+
+// setNamedCgroupProgram attaches the program of spec (named name) to the
+// cgroup dirFd, replacing the program of the same name attached previously,
+// if any. This allows runc to manage its programs without disturbing those
+// attached by others (such as systemd). If spec is nil, the program is
+// removed.
+func setNamedCgroupProgram(dirFd int, attach ebpf.AttachType, name string, spec *ebpf.ProgramSpec) error {
+	// The name is truncated by the kernel (and cilium/ebpf), so a longer
+	// one would never match the one of the attached program.
+	if len(name) >= unix.BPF_OBJ_NAME_LEN {
+		return fmt.Errorf("eBPF program name %q is longer than %d characters", name, unix.BPF_OBJ_NAME_LEN-1)
+	}
+	progs, err := findAttachedCgroupPrograms(dirFd, uint32(attach))
+	if err != nil {
+		return err
+	}
+	defer func() {
+		for _, prog := range progs {
+			prog.Close()
+		}
+	}()
+	var oldProg *ebpf.Program
+	for _, prog := range progs {
+		if info, err := prog.Info(); err == nil && info.Name == name {
+			oldProg = prog
+			break
+		}
+	}
+	if spec == nil {
+		if oldProg == nil {
+			return nil
+		}
+		err := link.RawDetachProgram(link.RawDetachProgramOptions{
+			Target:  dirFd,
+			Program: oldProg,
+			Attach:  attach,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to call BPF_PROG_DETACH (%s): %w", name, err)
+		}
+		return nil
+	}
+
+	raiseMemlockLimit()
+	spec = spec.Copy()
+	spec.Name = name
+	prog, err := ebpf.NewProgram(spec)
+	if err != nil {
+		return err
+	}
+	// Once attached, the program is kept alive by the cgroup.
+	defer prog.Close()
+
+	var (
+		replaceProg *ebpf.Program
+		attachFlags uint32 = unix.BPF_F_ALLOW_MULTI
+	)
+	if oldProg != nil && haveBpfProgReplace() {
+		replaceProg = oldProg
+		attachFlags |= unix.BPF_F_REPLACE
+	}
+	err = link.RawAttachProgram(link.RawAttachProgramOptions{
+		Target:  dirFd,
+		Program: prog,
+		Replace: replaceProg,
+		Attach:  attach,
+		Flags:   attachFlags,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to call BPF_PROG_ATTACH (%s, BPF_F_ALLOW_MULTI): %w", name, err)
+	}
+	if oldProg != nil && replaceProg == nil {
+		err := link.RawDetachProgram(link.RawDetachProgramOptions{
+			Target:  dirFd,
+			Program: oldProg,
+			Attach:  attach,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to call BPF_PROG_DETACH (%s) on old program: %w", name, err)
+		}
+	}
+	return nil
+}
+
+var (
+	haveBpfProgReplaceOnce sync.Once
+	haveBpfProgReplaceBool bool
+)
+
+// haveBpfProgReplace checks whether BPF_F_REPLACE is supported by the kernel
+// (Linux 5.6+). Without it, the replace_bpf_fd attribute of BPF_PROG_ATTACH
+// is ignored, and the new program is attached alongside the old ones.
+func haveBpfProgReplace() bool {
+	haveBpfProgReplaceOnce.Do(func() {
+		prog, err := ebpf.NewProgram(&ebpf.ProgramSpec{
+			Type:    ebpf.CGroupDevice,
+			License: "MIT",
+			Instructions: asm.Instructions{
+				asm.Mov.Imm(asm.R0, 0),
+				asm.Return(),
+			},
+		})
+		if err != nil {
+			logrus.Debugf("checking for BPF_F_REPLACE support: ebpf.NewProgram failed: %v", err)
+			return
+		}
+		defer prog.Close()
+
+		type bpfAttrAttach struct {
+			TargetFd     uint32
+			AttachBpfFd  uint32
+			AttachType   uint32
+			AttachFlags  uint32
+			ReplaceBpfFd uint32
+		}
+		// Use an fd which is not a cgroup as the target: the kernel checks
+		// the flags first, failing with EINVAL if BPF_F_REPLACE is unknown,
+		// and only then the target, failing with EBADF.
+		attr := bpfAttrAttach{
+			TargetFd:    ^uint32(0),
+			AttachBpfFd: uint32(prog.FD()),
+			AttachType:  uint32(unix.BPF_CGROUP_DEVICE),
+			AttachFlags: unix.BPF_F_ALLOW_MULTI | unix.BPF_F_REPLACE,
+		}
+		_, _, errno := unix.Syscall(unix.SYS_BPF,
+			uintptr(unix.BPF_PROG_ATTACH),
+			uintptr(unsafe.Pointer(&attr)),
+			unsafe.Sizeof(attr))
+		runtime.KeepAlive(prog)
+		if errno == unix.EINVAL {
+			return
+		}
+		if errno != unix.EBADF {
+			logrus.Debugf("checking for BPF_F_REPLACE support: got unexpected (not EBADF or EINVAL) error: %v", errno)
+		}
+		haveBpfProgReplaceBool = true
+	})
+	return haveBpfProgReplaceBool
+}
+
+// loadPinnedDeviceFilter returns the program pinned at pinPath, provided it
+// is one of the attached programs in progs. This allows to reliably replace
+// the program previously installed by us, even if there are other programs
+// attached to the cgroup.
+func loadPinnedDeviceFilter(pinPath string, progs []*ebpf.Program) *ebpf.Program {
+	pinned, err := ebpf.LoadPinnedProgram(pinPath, nil)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			logrus.Warnf("unable to load pinned device filter program %s: %v", pinPath, err)
+		}
+		return nil
+	}
+	defer pinned.Close()
+	pinnedID, err := pinned.ID()
+	if err != nil {
+		return nil
+	}
+	for _, prog := range progs {
+		if id, err := prog.ID(); err == nil && id == pinnedID {
+			return prog
+		}
+	}
+	return nil
+}
+
+// pinDeviceFilter pins prog at pinPath, replacing the previously pinned
+// program (if any).
+func pinDeviceFilter(prog *ebpf.Program, pinPath string) error {
+	if err := os.MkdirAll(filepath.Dir(pinPath), 0o700); err != nil {
+		return err
+	}
+	if err := UnpinCgroupDeviceFilter(pinPath); err != nil {
+		return err
+	}
+	if err := prog.Pin(pinPath); err != nil {
+		return fmt.Errorf("failed to pin device filter program to %s (is bpffs mounted?): %w", pinPath, err)
+	}
+	return nil
+}
+
+// UnpinCgroupDeviceFilter removes the device filter program pinned at
+// pinPath, and its map (see LoadAttachCgroupDeviceFilterMap). It is not an
+// error if there is no such program.
+func UnpinCgroupDeviceFilter(pinPath string) error {
+	if pinPath == "" {
+		return nil
+	}
+	for _, path := range []string{pinPath, deviceFilterMapPinPath(pinPath)} {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// DetachPolicy is what the closer returned by LoadAttachCgroupDeviceFilter
+// leaves in effect once it has detached the device filter.
+type DetachPolicy int
+
+const (
+	// FailOpen leaves the cgroup without the device filter, so that all
+	// the devices can be accessed, unless other programs were attached
+	// since.
+	FailOpen DetachPolicy = iota
+	// FailClosed attaches back the programs the device filter replaced,
+	// before detaching it, so that the cgroup has a device filter at all
+	// times. If there were none, a filter denying access to all the
+	// devices is attached instead.
+	FailClosed
+)
+
+// LoadAttachCgroupDeviceFilter installs eBPF device filter program to /sys/fs/cgroup/<foo> directory.
+//
+// If pinPath is not empty, the program is also pinned at pinPath (which is
+// to be on bpffs, e.g. /sys/fs/bpf/runc/<root-hash>/<container-id>), so it
+// can be inspected using bpftool(8), and is replaced by subsequent calls
+// using the same pinPath.
+//
+// If installing the program fails once it has been attached, the programs it
+// replaced are attached back, and it is detached. The returned closer
+// detaches it, according to policy.
+//
+// If audit is true, the program writes the accesses it denies to a ring
+// buffer (see WatchDeniedDeviceAccesses), which is kept when the program is
+// replaced. This requires Linux 5.8+.
+//
+// Requires the system to be running in cgroup2 unified-mode with kernel >= 4.15 .
+//
+// https://github.com/torvalds/linux/commit/ebc614f687369f9df99828572b1d85a7c2de3d92
+func LoadAttachCgroupDeviceFilter(insts asm.Instructions, license string, dirFd int, pinPath string, policy DetachPolicy, audit bool) (func() error, error) {
+	raiseMemlockLimit()
 	// Get the list of existing programs.
-	oldProgs, err := findAttachedCgroupDeviceFilters(dirFd)
+	oldProgs, err := findAttachedCgroupPrograms(dirFd, unix.BPF_CGROUP_DEVICE)
 	if err != nil {
 		return nilCloser, err
 	}
+	if audit {
+		ringbuf, err := deviceAuditRingbuf(oldProgs)
+		if err != nil {
+			return nilCloser, err
+		}
+		// Once loaded, the program keeps the ring buffer alive.
+		defer ringbuf.Close()
+		insts = devicefilter.AuditDenials(insts, ringbuf.FD())
+	}
 	spec := &ebpf.ProgramSpec{
 		Type:         ebpf.CGroupDevice,
 		Instructions: insts,
 		License:      license,
 	}
+	return loadAttachDeviceFilter(spec, oldProgs, dirFd, pinPath, policy)
+}
+
+// loadAttachDeviceFilter loads the device filter program of spec, and
+// attaches it to the cgroup dirFd in place of oldProgs (see
+// LoadAttachCgroupDeviceFilter).
+func loadAttachDeviceFilter(spec *ebpf.ProgramSpec, oldProgs []*ebpf.Program, dirFd int, pinPath string, policy DetachPolicy) (func() error, error) {
 	prog, err := ebpf.NewProgram(spec)
 	if err != nil {
 		return nilCloser, err
 	}
-	// If there is only one old program, we can just replace it directly.
-	var replaceProg *ebpf.Program
-	if len(oldProgs) == 1 {
-		replaceProg = oldProgs[0]
+	// If there is only one old program, or the old program has been pinned
+	// by us, we can just replace it directly (atomically, so there is no
+	// window during which either both or none of the programs are in effect).
+	var (
+		replaceProg *ebpf.Program
+		attachFlags uint32 = unix.BPF_F_ALLOW_MULTI
+	)
+	if haveBpfProgReplace() {
+		if pinPath != "" {
+			replaceProg = loadPinnedDeviceFilter(pinPath, oldProgs)
+		}
+		if replaceProg == nil && len(oldProgs) == 1 {
+			replaceProg = oldProgs[0]
+		}
+		if replaceProg != nil {
+			attachFlags |= unix.BPF_F_REPLACE
+		}
 	}
 	err = link.RawAttachProgram(link.RawAttachProgramOptions{
 		Target:  dirFd,
 		Program: prog,
 		Replace: replaceProg,
 		Attach:  ebpf.AttachCGroupDevice,
-		Flags:   unix.BPF_F_ALLOW_MULTI,
+		Flags:   attachFlags,
 	})
 	if err != nil {
 		return nilCloser, fmt.Errorf("failed to call BPF_PROG_ATTACH (BPF_CGROUP_DEVICE, BPF_F_ALLOW_MULTI): %w", err)
 	}
-	closer := func() error {
+	closer := deviceFilterCloser(prog, oldProgs, spec.License, dirFd, pinPath, policy)
+	// If there was more than one old program, give a warning (since this
+	// really shouldn't happen with runc-managed cgroups). In any case, detach
+	// all the old programs, except the one that was replaced.
+	if len(oldProgs) > 1 {
+		logrus.Warnf("found more than one filter (%d) attached to a cgroup -- removing extra filters!", len(oldProgs))
+	}
+	for _, oldProg := range oldProgs {
+		if oldProg == replaceProg {
+			continue
+		}
 		err = link.RawDetachProgram(link.RawDetachProgramOptions{
 			Target:  dirFd,
-			Program: prog,
+			Program: oldProg,
 			Attach:  ebpf.AttachCGroupDevice,
 		})
 		if err != nil {
-			return fmt.Errorf("failed to call BPF_PROG_DETACH (BPF_CGROUP_DEVICE): %w", err)
+			err = fmt.Errorf("failed to call BPF_PROG_DETACH (BPF_CGROUP_DEVICE) on old filter program: %w", err)
+			break
 		}
-		// TODO: Should we attach the old filters back in this case? Otherwise
-		//       we fail-open on a security feature, which is a bit scary.
-		return nil
 	}
-	// If there was more than one old program, give a warning (since this
-	// really shouldn't happen with runc-managed cgroups) and then detach all
-	// the old programs.
-	if len(oldProgs) > 1 {
-		logrus.Warnf("found more than one filter (%d) attached to a cgroup -- removing extra filters!", len(oldProgs))
-		for _, oldProg := range oldProgs {
-			err = link.RawDetachProgram(link.RawDetachProgramOptions{
+	if err == nil && pinPath != "" {
+		err = pinDeviceFilter(prog, pinPath)
+	}
+	if err != nil {
+		// Go back to the old programs, rather than leaving some of them
+		// detached.
+		if err2 := restoreDeviceFilters(dirFd, prog, oldProgs); err2 != nil {
+			logrus.Warnf("unable to restore the old device filter programs: %v", err2)
+			return closer, err
+		}
+		return nilCloser, err
+	}
+	return closer, nil
+}
+
+// deviceFilterCloser returns the closer of the device filter prog attached
+// to the cgroup dirFd in place of oldProgs, which detaches it according to
+// policy.
+func deviceFilterCloser(prog *ebpf.Program, oldProgs []*ebpf.Program, license string, dirFd int, pinPath string, policy DetachPolicy) func() error {
+	return func() error {
+		if policy == FailClosed {
+			restore := oldProgs
+			if len(restore) == 0 {
+				denyAll, err := newDenyAllDeviceFilter(license)
+				if err != nil {
+					return err
+				}
+				defer denyAll.Close()
+				restore = []*ebpf.Program{denyAll}
+			}
+			if err := restoreDeviceFilters(dirFd, prog, restore); err != nil {
+				return err
+			}
+		} else {
+			err := link.RawDetachProgram(link.RawDetachProgramOptions{
 				Target:  dirFd,
-				Program: oldProg,
+				Program: prog,
 				Attach:  ebpf.AttachCGroupDevice,
 			})
 			if err != nil {
-				return closer, fmt.Errorf("failed to call BPF_PROG_DETACH (BPF_CGROUP_DEVICE) on old filter program: %w", err)
+				return fmt.Errorf("failed to call BPF_PROG_DETACH (BPF_CGROUP_DEVICE): %w", err)
 			}
 		}
+		if pinPath != "" {
+			if err := UnpinCgroupDeviceFilter(pinPath); err != nil {
+				return err
+			}
+		}
+		return nil
 	}
-	return closer, nil
+}
+
+// restoreDeviceFilters attaches progs (those which are not attached yet) to
+// the cgroup dirFd, and then detaches prog, so that the cgroup has a device
+// filter at all times.
+func restoreDeviceFilters(dirFd int, prog *ebpf.Program, progs []*ebpf.Program) error {
+	for _, p := range progs {
+		err := link.RawAttachProgram(link.RawAttachProgramOptions{
+			Target:  dirFd,
+			Program: p,
+			Attach:  ebpf.AttachCGroupDevice,
+			Flags:   unix.BPF_F_ALLOW_MULTI,
+		})
+		// A program can't be attached twice.
+		if err != nil && !errors.Is(err, unix.EEXIST) {
+			return fmt.Errorf("failed to call BPF_PROG_ATTACH (BPF_CGROUP_DEVICE, BPF_F_ALLOW_MULTI) on old filter program: %w", err)
+		}
+	}
+	err := link.RawDetachProgram(link.RawDetachProgramOptions{
+		Target:  dirFd,
+		Program: prog,
+		Attach:  ebpf.AttachCGroupDevice,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to call BPF_PROG_DETACH (BPF_CGROUP_DEVICE): %w", err)
+	}
+	return nil
+}
+
+// newDenyAllDeviceFilter returns a device filter program denying access to
+// all the devices.
+func newDenyAllDeviceFilter(license string) (*ebpf.Program, error) {
+	return ebpf.NewProgram(&ebpf.ProgramSpec{
+		Type:    ebpf.CGroupDevice,
+		License: license,
+		Instructions: asm.Instructions{
+			asm.Mov.Imm(asm.R0, 0),
+			asm.Return(),
+		},
+	})
 }
@@ -0,0 +1,314 @@
+package ebpf
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/asm"
+	"github.com/opencontainers/runc/libcontainer/cgroups/ebpf/devicefilter"
+	"github.com/opencontainers/runc/libcontainer/devices"
+	"golang.org/x/sys/unix"
+)
+
+// testCgroupFd returns a directory fd of a new cgroup v2 cgroup, and a
+// function to remove it.
+func testCgroupFd(t *testing.T) (int, func()) {
+	if os.Geteuid() != 0 {
+		t.Skip("requires root")
+	}
+	f, err := os.Open("/proc/self/mountinfo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	mountpoint := ""
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		fields := strings.Split(s.Text(), " - ")
+		if len(fields) == 2 && strings.HasPrefix(fields[1], "cgroup2 ") {
+			mountpoint = strings.Fields(fields[0])[4]
+			break
+		}
+	}
+	if mountpoint == "" {
+		t.Skip("requires cgroup v2")
+	}
+	dir, err := ioutil.TempDir(mountpoint, "runc-ebpf-test")
+	if err != nil {
+		t.Skipf("unable to create a cgroup: %v", err)
+	}
+	fd, err := unix.Open(dir, unix.O_DIRECTORY|unix.O_RDONLY, 0)
+	if err != nil {
+		os.Remove(dir)
+		t.Fatal(err)
+	}
+	return fd, func() {
+		unix.Close(fd)
+		os.Remove(dir)
+	}
+}
+
+// attachedDeviceFilters returns the ids of the device filters attached to
+// the cgroup dirFd.
+func attachedDeviceFilters(t *testing.T, dirFd int) []ebpf.ProgramID {
+	progs, err := findAttachedCgroupPrograms(dirFd, unix.BPF_CGROUP_DEVICE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []ebpf.ProgramID
+	for _, prog := range progs {
+		id, err := prog.ID()
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+		prog.Close()
+	}
+	return ids
+}
+
+func TestLoadAttachCgroupDeviceFilterPolicy(t *testing.T) {
+	dirFd, cleanup := testCgroupFd(t)
+	defer cleanup()
+
+	allowAll := asm.Instructions{asm.Mov.Imm(asm.R0, 1), asm.Return()}
+
+	// Without old programs, the cgroup is left without a device filter, or
+	// with one denying access to all the devices.
+	closer, err := LoadAttachCgroupDeviceFilter(allowAll, "Apache", dirFd, "", FailOpen, false)
+	if err != nil {
+		t.Skipf("unable to attach a device filter: %v", err)
+	}
+	if err := closer(); err != nil {
+		t.Fatal(err)
+	}
+	if ids := attachedDeviceFilters(t, dirFd); len(ids) != 0 {
+		t.Fatalf("expected no device filter, got %v", ids)
+	}
+	closer, err = LoadAttachCgroupDeviceFilter(allowAll, "Apache", dirFd, "", FailClosed, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := attachedDeviceFilters(t, dirFd)
+	if err := closer(); err != nil {
+		t.Fatal(err)
+	}
+	denyAll := attachedDeviceFilters(t, dirFd)
+	if len(denyAll) != 1 || denyAll[0] == old[0] {
+		t.Fatalf("expected the deny-all device filter, got %v", denyAll)
+	}
+
+	// The old programs are attached back.
+	closer, err = LoadAttachCgroupDeviceFilter(allowAll, "Apache", dirFd, "", FailClosed, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ids := attachedDeviceFilters(t, dirFd); len(ids) != 1 || ids[0] == denyAll[0] {
+		t.Fatalf("expected the new device filter, got %v", ids)
+	}
+	if err := closer(); err != nil {
+		t.Fatal(err)
+	}
+	if ids := attachedDeviceFilters(t, dirFd); len(ids) != 1 || ids[0] != denyAll[0] {
+		t.Fatalf("expected the old device filter %v, got %v", denyAll, ids)
+	}
+
+	// If the program can't be pinned, the old programs are attached back.
+	pinPath := filepath.Join("/proc/self/status", "filter")
+	if _, err := LoadAttachCgroupDeviceFilter(allowAll, "Apache", dirFd, pinPath, FailOpen, false); err == nil {
+		t.Fatal("expected an error pinning the device filter")
+	}
+	if ids := attachedDeviceFilters(t, dirFd); len(ids) != 1 || ids[0] != denyAll[0] {
+		t.Fatalf("expected the old device filter %v, got %v", denyAll, ids)
+	}
+}
+
+// canReadDevNull returns whether a process of the cgroup dirFd can read
+// /dev/null.
+func canReadDevNull(dirFd int) bool {
+	procs := fmt.Sprintf("/proc/%d/fd/%d/cgroup.procs", os.Getpid(), dirFd)
+	return exec.Command("sh", "-c", "echo $$ > "+procs+" && exec head -c0 /dev/null").Run() == nil
+}
+
+func TestLoadAttachCgroupDeviceFilterMap(t *testing.T) {
+	dirFd, cleanup := testCgroupFd(t)
+	defer cleanup()
+
+	load := func(rules ...*devices.Rule) (func() error, ebpf.ProgramID) {
+		t.Helper()
+		entries, license, err := devicefilter.DeviceFilterMap(rules)
+		if err != nil {
+			t.Fatal(err)
+		}
+		closer, err := LoadAttachCgroupDeviceFilterMap(entries, license, dirFd, "", FailOpen, false)
+		if err != nil {
+			t.Skipf("unable to attach a device filter: %v", err)
+		}
+		ids := attachedDeviceFilters(t, dirFd)
+		if len(ids) != 1 {
+			t.Fatalf("expected a single device filter, got %v", ids)
+		}
+		return closer, ids[0]
+	}
+	devNull := &devices.Rule{Type: devices.CharDevice, Major: 1, Minor: 3, Permissions: "rwm", Allow: true}
+	devZero := &devices.Rule{Type: devices.CharDevice, Major: 1, Minor: 5, Permissions: "rwm", Allow: true}
+
+	_, id := load(devNull)
+	if !canReadDevNull(dirFd) {
+		t.Fatal("expected /dev/null to be allowed")
+	}
+
+	// The map is updated in place.
+	_, newID := load(devZero)
+	if newID != id {
+		t.Fatalf("expected the device filter %v to be kept, got %v", id, newID)
+	}
+	if canReadDevNull(dirFd) {
+		t.Fatal("expected /dev/null to be denied")
+	}
+	progs, err := findAttachedCgroupPrograms(dirFd, unix.BPF_CGROUP_DEVICE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := findProgramMap(progs[0], ebpf.Hash)
+	if err != nil || m == nil {
+		t.Fatalf("unable to find the map of the device filter: %v", err)
+	}
+	defer m.Close()
+	var (
+		key   devicefilter.DeviceKey
+		value uint32
+		keys  []devicefilter.DeviceKey
+	)
+	for iter := m.Iterate(); iter.Next(&key, &value); {
+		keys = append(keys, key)
+	}
+	if len(keys) != 2 {
+		t.Fatalf("expected the default action and /dev/zero in the map, got %+v", keys)
+	}
+
+	// The program is replaced if the default action changes.
+	allowAll := &devices.Rule{Type: devices.WildcardDevice, Major: -1, Minor: -1, Permissions: "rwm", Allow: true}
+	closer, newID := load(allowAll)
+	if newID == id {
+		t.Fatalf("expected the device filter %v to be replaced", id)
+	}
+	if !canReadDevNull(dirFd) {
+		t.Fatal("expected /dev/null to be allowed")
+	}
+	if err := closer(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWatchDeniedDeviceAccesses(t *testing.T) {
+	dirFd, cleanup := testCgroupFd(t)
+	defer cleanup()
+
+	rules := []*devices.Rule{{Type: devices.CharDevice, Major: 1, Minor: 5, Permissions: "rwm", Allow: true}}
+	insts, license, err := devicefilter.DeviceFilter(rules)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadAttachCgroupDeviceFilter(insts, license, dirFd, "", FailOpen, true); err != nil {
+		t.Skipf("unable to attach an auditing device filter: %v", err)
+	}
+	ch := make(chan DeniedDeviceAccess, 10)
+	dirPath := fmt.Sprintf("/proc/%d/fd/%d", os.Getpid(), dirFd)
+	if err := WatchDeniedDeviceAccesses(dirPath, func(a DeniedDeviceAccess) { ch <- a }, func() {}); err != nil {
+		t.Fatal(err)
+	}
+	expectDenied := func() {
+		t.Helper()
+		if canReadDevNull(dirFd) {
+			t.Fatal("expected /dev/null to be denied")
+		}
+		select {
+		case a := <-ch:
+			if a.Type != devices.CharDevice || a.Major != 1 || a.Minor != 3 || a.Permissions != "r" || a.Pid <= 0 {
+				t.Errorf("unexpected denied access %+v", a)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("expected the denied access to /dev/null")
+		}
+	}
+	expectDenied()
+
+	// The ring buffer is kept when the device filter is replaced.
+	entries, license, err := devicefilter.DeviceFilterMap(rules)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadAttachCgroupDeviceFilterMap(entries, license, dirFd, "", FailOpen, true); err != nil {
+		t.Fatal(err)
+	}
+	expectDenied()
+}
+
+func TestLoadAttachCgroupDeviceAudit(t *testing.T) {
+	dirFd, cleanup := testCgroupFd(t)
+	defer cleanup()
+
+	rules := []*devices.Rule{{Type: devices.CharDevice, Major: 1, Minor: 5, Permissions: "rwm", Allow: true}}
+	insts, license, err := devicefilter.DeviceFilter(rules)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := LoadAttachCgroupDeviceAudit(insts, license, dirFd); err != nil {
+		t.Skipf("unable to attach a device audit: %v", err)
+	}
+	ch := make(chan DeniedDeviceAccess, 10)
+	dirPath := fmt.Sprintf("/proc/%d/fd/%d", os.Getpid(), dirFd)
+	if err := WatchDeniedDeviceAccesses(dirPath, func(a DeniedDeviceAccess) { ch <- a }, func() {}); err != nil {
+		t.Fatal(err)
+	}
+	// The access is recorded, but not denied.
+	if !canReadDevNull(dirFd) {
+		t.Fatal("expected /dev/null to be allowed")
+	}
+	select {
+	case a := <-ch:
+		if a.Type != devices.CharDevice || a.Major != 1 || a.Minor != 3 || a.Permissions != "r" {
+			t.Errorf("unexpected denied access %+v", a)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the audited access to /dev/null")
+	}
+}
+
+func TestSetNamedCgroupProgramFds(t *testing.T) {
+	dirFd, cleanup := testCgroupFd(t)
+	defer cleanup()
+
+	if err := SetCgroupSockCreateFilter(dirFd, []int{unix.AF_UNIX}); err != nil {
+		t.Skipf("unable to attach a socket creation filter: %v", err)
+	}
+	fds := func() int {
+		entries, err := ioutil.ReadDir("/proc/self/fd")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return len(entries)
+	}
+	// The attached programs found to be replaced are closed.
+	before := fds()
+	for i := 0; i < 5; i++ {
+		if err := SetCgroupSockCreateFilter(dirFd, []int{unix.AF_UNIX}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := SetCgroupSockCreateFilter(dirFd, nil); err != nil {
+		t.Fatal(err)
+	}
+	if after := fds(); after != before {
+		t.Errorf("expected %d open fds, got %d", before, after)
+	}
+}
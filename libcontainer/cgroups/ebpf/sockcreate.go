@@ -0,0 +1,60 @@
+package ebpf
+
+import (
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/asm"
+)
+
+const (
+	// sockCreateProgName is the name of the socket creation filter program,
+	// used to tell it apart from other programs attached to the cgroup (at
+	// most 15 characters).
+	sockCreateProgName = "runc_sock_af"
+
+	// bpfSockFamilyOffset is offsetof(struct bpf_sock, family).
+	bpfSockFamilyOffset = 4
+)
+
+// sockCreateFilter returns the instructions of a cgroup_sock program, which
+// only allows the creation of sockets of the given address families.
+func sockCreateFilter(families []int) asm.Instructions {
+	deny := asm.Instructions{
+		asm.Mov.Imm(asm.R0, 0),
+		asm.Return(),
+	}
+	if len(families) == 0 {
+		return deny
+	}
+	insts := asm.Instructions{
+		asm.LoadMem(asm.R2, asm.R1, bpfSockFamilyOffset, asm.Word),
+	}
+	for _, family := range families {
+		insts = append(insts, asm.JEq.Imm(asm.R2, int32(family), "allow"))
+	}
+	insts = append(insts, deny...)
+	return append(insts,
+		asm.Mov.Imm(asm.R0, 1).Sym("allow"),
+		asm.Return(),
+	)
+}
+
+// SetCgroupSockCreateFilter only allows the processes in the cgroup dirFd to
+// create sockets of the given address families (such as unix.AF_INET), by
+// attaching (or replacing) a BPF_CGROUP_INET_SOCK_CREATE eBPF program. If
+// families is nil, the program is removed.
+//
+// Note that the program is only run for AF_INET and AF_INET6 sockets, so the
+// other families must be denied with a seccomp filter for socket(2) (see
+// seccomp.RestrictAddressFamilies).
+//
+// Requires the system to be running in cgroup2 unified-mode.
+func SetCgroupSockCreateFilter(dirFd int, families []int) error {
+	if families == nil {
+		return setNamedCgroupProgram(dirFd, ebpf.AttachCGroupInetSockCreate, sockCreateProgName, nil)
+	}
+	return setNamedCgroupProgram(dirFd, ebpf.AttachCGroupInetSockCreate, sockCreateProgName, &ebpf.ProgramSpec{
+		Type:         ebpf.CGroupSock,
+		Instructions: sockCreateFilter(families),
+		License:      "Apache",
+	})
+}
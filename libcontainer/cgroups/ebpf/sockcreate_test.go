@@ -0,0 +1,42 @@
+package ebpf
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/cilium/ebpf"
+	"golang.org/x/sys/unix"
+)
+
+func TestSockCreateFilter(t *testing.T) {
+	for _, families := range [][]int{
+		{},
+		{unix.AF_INET, unix.AF_INET6, unix.AF_UNIX},
+	} {
+		prog, err := ebpf.NewProgram(&ebpf.ProgramSpec{
+			Name:         sockCreateProgName,
+			Type:         ebpf.CGroupSock,
+			Instructions: sockCreateFilter(families),
+			License:      "Apache",
+		})
+		if errors.Is(err, unix.EPERM) || errors.Is(err, unix.ENOTSUP) {
+			t.Skipf("unable to load eBPF program: %v", err)
+		}
+		if err != nil {
+			t.Fatalf("program rejected (families %v): %v", families, err)
+		}
+		prog.Close()
+	}
+}
+
+func TestProgramNames(t *testing.T) {
+	// The programs are found by their names, which the kernel truncates.
+	for _, name := range []string{sockCreateProgName, bandwidthProgName, deviceFilterMapProgName} {
+		if len(name) >= unix.BPF_OBJ_NAME_LEN {
+			t.Errorf("program name %q is too long", name)
+		}
+	}
+	if err := setNamedCgroupProgram(-1, ebpf.AttachCGroupInetSockCreate, "runc_sock_create", nil); err == nil {
+		t.Error("expected an error with a name of 16 characters")
+	}
+}
@@ -26,42 +26,48 @@ func (s *BlkioGroup) Apply(path string, d *cgroupData) error {
 }
 
 func (s *BlkioGroup) Set(path string, r *configs.Resources) error {
+	dir := fscommon.PinDir(path)
+	defer dir.Close()
+	return s.SetPinned(dir, r)
+}
+
+func (s *BlkioGroup) SetPinned(dir *fscommon.PinnedDir, r *configs.Resources) error {
 	if r.BlkioWeight != 0 {
-		if err := fscommon.WriteFile(path, "blkio.weight", strconv.FormatUint(uint64(r.BlkioWeight), 10)); err != nil {
+		if err := dir.WriteFile("blkio.weight", strconv.FormatUint(uint64(r.BlkioWeight), 10)); err != nil {
 			return err
 		}
 	}
 
 	if r.BlkioLeafWeight != 0 {
-		if err := fscommon.WriteFile(path, "blkio.leaf_weight", strconv.FormatUint(uint64(r.BlkioLeafWeight), 10)); err != nil {
+		if err := dir.WriteFile("blkio.leaf_weight", strconv.FormatUint(uint64(r.BlkioLeafWeight), 10)); err != nil {
 			return err
 		}
 	}
+	var weights, leafWeights []string
 	for _, wd := range r.BlkioWeightDevice {
-		if err := fscommon.WriteFile(path, "blkio.weight_device", wd.WeightString()); err != nil {
-			return err
-		}
-		if err := fscommon.WriteFile(path, "blkio.leaf_weight_device", wd.LeafWeightString()); err != nil {
-			return err
-		}
+		weights = append(weights, wd.WeightString())
+		leafWeights = append(leafWeights, wd.LeafWeightString())
 	}
-	for _, td := range r.BlkioThrottleReadBpsDevice {
-		if err := fscommon.WriteFile(path, "blkio.throttle.read_bps_device", td.String()); err != nil {
-			return err
-		}
+	if err := dir.WriteFileBatch("blkio.weight_device", weights); err != nil {
+		return err
 	}
-	for _, td := range r.BlkioThrottleWriteBpsDevice {
-		if err := fscommon.WriteFile(path, "blkio.throttle.write_bps_device", td.String()); err != nil {
-			return err
-		}
+	if err := dir.WriteFileBatch("blkio.leaf_weight_device", leafWeights); err != nil {
+		return err
 	}
-	for _, td := range r.BlkioThrottleReadIOPSDevice {
-		if err := fscommon.WriteFile(path, "blkio.throttle.read_iops_device", td.String()); err != nil {
-			return err
+	for _, t := range []struct {
+		file    string
+		devices []*configs.ThrottleDevice
+	}{
+		{"blkio.throttle.read_bps_device", r.BlkioThrottleReadBpsDevice},
+		{"blkio.throttle.write_bps_device", r.BlkioThrottleWriteBpsDevice},
+		{"blkio.throttle.read_iops_device", r.BlkioThrottleReadIOPSDevice},
+		{"blkio.throttle.write_iops_device", r.BlkioThrottleWriteIOPSDevice},
+	} {
+		data := make([]string, 0, len(t.devices))
+		for _, td := range t.devices {
+			data = append(data, td.String())
 		}
-	}
-	for _, td := range r.BlkioThrottleWriteIOPSDevice {
-		if err := fscommon.WriteFile(path, "blkio.throttle.write_iops_device", td.String()); err != nil {
+		if err := dir.WriteFileBatch(t.file, data); err != nil {
 			return err
 		}
 	}
@@ -104,9 +110,9 @@ func splitBlkioStatLine(r rune) bool {
 	return r == ' ' || r == ':'
 }
 
-func getBlkioStat(dir, file string) ([]cgroups.BlkioStatEntry, error) {
+func getBlkioStat(dir *fscommon.PinnedDir, file string) ([]cgroups.BlkioStatEntry, error) {
 	var blkioStats []cgroups.BlkioStatEntry
-	f, err := fscommon.OpenFile(dir, file, os.O_RDONLY)
+	f, err := dir.OpenFile(file, os.O_RDONLY)
 	if err != nil {
 		if os.IsNotExist(err) {
 			return blkioStats, nil
@@ -124,7 +130,7 @@ func getBlkioStat(dir, file string) ([]cgroups.BlkioStatEntry, error) {
 				// skip total line
 				continue
 			} else {
-				return nil, fmt.Errorf("Invalid line found while parsing %s/%s: %s", dir, file, sc.Text())
+				return nil, fmt.Errorf("Invalid line found while parsing %s/%s: %s", dir.Path(), file, sc.Text())
 			}
 		}
 
@@ -157,6 +163,12 @@ func getBlkioStat(dir, file string) ([]cgroups.BlkioStatEntry, error) {
 }
 
 func (s *BlkioGroup) GetStats(path string, stats *cgroups.Stats) error {
+	dir := fscommon.PinDir(path)
+	defer dir.Close()
+	return s.GetStatsPinned(dir, stats)
+}
+
+func (s *BlkioGroup) GetStatsPinned(dir *fscommon.PinnedDir, stats *cgroups.Stats) error {
 	type blkioStatInfo struct {
 		filename            string
 		blkioStatEntriesPtr *[]cgroups.BlkioStatEntry
@@ -272,7 +284,7 @@ func (s *BlkioGroup) GetStats(path string, stats *cgroups.Stats) error {
 
 	for _, statGroup := range orderedStats {
 		for i, statInfo := range statGroup {
-			if blkioStats, err = getBlkioStat(path, statInfo.filename); err != nil || blkioStats == nil {
+			if blkioStats, err = getBlkioStat(dir, statInfo.filename); err != nil || blkioStats == nil {
 				// if error occurs on first file, move to next group
 				if i == 0 {
 					break
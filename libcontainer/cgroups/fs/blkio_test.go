@@ -241,11 +241,9 @@ func TestBlkioSetMultipleWeightDevice(t *testing.T) {
 
 	wd1 := configs.NewWeightDevice(8, 0, 500, 0)
 	wd2 := configs.NewWeightDevice(8, 16, 500, 0)
-	// we cannot actually set and check both because normal ioutil.WriteFile
-	// when writing to cgroup file will overwrite the whole file content instead
-	// of updating it as the kernel is doing. Just check the second device
-	// is present will suffice for the test to ensure multiple writes are done.
-	weightDeviceAfter := wd2.WeightString()
+	// The values are written one by one to the same open file, which, unlike
+	// the cgroup file, appends them to each other. Check both are written.
+	weightDeviceAfter := wd1.WeightString() + wd2.WeightString()
 
 	helper.writeFileContents(map[string]string{
 		"blkio.weight_device": weightDeviceBefore,
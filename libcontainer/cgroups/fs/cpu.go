@@ -41,13 +41,19 @@ func (s *CpuGroup) Apply(path string, d *cgroupData) error {
 }
 
 func (s *CpuGroup) SetRtSched(path string, r *configs.Resources) error {
+	dir := fscommon.PinDir(path)
+	defer dir.Close()
+	return s.SetRtSchedPinned(dir, r)
+}
+
+func (s *CpuGroup) SetRtSchedPinned(dir *fscommon.PinnedDir, r *configs.Resources) error {
 	if r.CpuRtPeriod != 0 {
-		if err := fscommon.WriteFile(path, "cpu.rt_period_us", strconv.FormatUint(r.CpuRtPeriod, 10)); err != nil {
+		if err := dir.WriteFile("cpu.rt_period_us", strconv.FormatUint(r.CpuRtPeriod, 10)); err != nil {
 			return err
 		}
 	}
 	if r.CpuRtRuntime != 0 {
-		if err := fscommon.WriteFile(path, "cpu.rt_runtime_us", strconv.FormatInt(r.CpuRtRuntime, 10)); err != nil {
+		if err := dir.WriteFile("cpu.rt_runtime_us", strconv.FormatInt(r.CpuRtRuntime, 10)); err != nil {
 			return err
 		}
 	}
@@ -55,13 +61,19 @@ func (s *CpuGroup) SetRtSched(path string, r *configs.Resources) error {
 }
 
 func (s *CpuGroup) Set(path string, r *configs.Resources) error {
+	dir := fscommon.PinDir(path)
+	defer dir.Close()
+	return s.SetPinned(dir, r)
+}
+
+func (s *CpuGroup) SetPinned(dir *fscommon.PinnedDir, r *configs.Resources) error {
 	if r.CpuShares != 0 {
 		shares := r.CpuShares
-		if err := fscommon.WriteFile(path, "cpu.shares", strconv.FormatUint(shares, 10)); err != nil {
+		if err := dir.WriteFile("cpu.shares", strconv.FormatUint(shares, 10)); err != nil {
 			return err
 		}
 		// read it back
-		sharesRead, err := fscommon.GetCgroupParamUint(path, "cpu.shares")
+		sharesRead, err := dir.GetCgroupParamUint("cpu.shares")
 		if err != nil {
 			return err
 		}
@@ -72,21 +84,38 @@ func (s *CpuGroup) Set(path string, r *configs.Resources) error {
 			return fmt.Errorf("the minimum allowed cpu-shares is %d", sharesRead)
 		}
 	}
-	if r.CpuPeriod != 0 {
-		if err := fscommon.WriteFile(path, "cpu.cfs_period_us", strconv.FormatUint(r.CpuPeriod, 10)); err != nil {
-			return err
+	var setQuota func() error
+	if r.CpuPeriod != 0 || r.CpuQuota != 0 {
+		setQuota = func() error {
+			if r.CpuPeriod != 0 {
+				if err := dir.WriteFile("cpu.cfs_period_us", strconv.FormatUint(r.CpuPeriod, 10)); err != nil {
+					return err
+				}
+			}
+			if r.CpuQuota != 0 {
+				if err := dir.WriteFile("cpu.cfs_quota_us", strconv.FormatInt(r.CpuQuota, 10)); err != nil {
+					return err
+				}
+			}
+			return nil
 		}
 	}
-	if r.CpuQuota != 0 {
-		if err := fscommon.WriteFile(path, "cpu.cfs_quota_us", strconv.FormatInt(r.CpuQuota, 10)); err != nil {
-			return err
-		}
+	if err := fscommon.SetCPUQuotaAndBurst(r.CpuBurst, setQuota, func(burst string) error {
+		return dir.WriteFile("cpu.cfs_burst_us", burst)
+	}); err != nil {
+		return err
 	}
-	return s.SetRtSched(path, r)
+	return s.SetRtSchedPinned(dir, r)
 }
 
 func (s *CpuGroup) GetStats(path string, stats *cgroups.Stats) error {
-	f, err := fscommon.OpenFile(path, "cpu.stat", os.O_RDONLY)
+	dir := fscommon.PinDir(path)
+	defer dir.Close()
+	return s.GetStatsPinned(dir, stats)
+}
+
+func (s *CpuGroup) GetStatsPinned(dir *fscommon.PinnedDir, stats *cgroups.Stats) error {
+	f, err := dir.OpenFile("cpu.stat", os.O_RDONLY)
 	if err != nil {
 		if os.IsNotExist(err) {
 			return nil
@@ -110,6 +139,12 @@ func (s *CpuGroup) GetStats(path string, stats *cgroups.Stats) error {
 
 		case "throttled_time":
 			stats.CpuStats.ThrottlingData.ThrottledTime = v
+
+		case "nr_bursts":
+			stats.CpuStats.BurstData.BurstsPeriods = v
+
+		case "burst_time":
+			stats.CpuStats.BurstData.BurstTime = v
 		}
 	}
 	return nil
@@ -102,6 +102,38 @@ func TestCpuSetBandWidth(t *testing.T) {
 	}
 }
 
+func TestCpuSetBurst(t *testing.T) {
+	helper := NewCgroupTestUtil("cpu", t)
+	defer helper.cleanup()
+
+	const (
+		quota       = 50000
+		burstBefore = 0
+		burstAfter  = 20000
+	)
+
+	helper.writeFileContents(map[string]string{
+		"cpu.cfs_quota_us": strconv.Itoa(quota),
+		"cpu.cfs_burst_us": strconv.Itoa(burstBefore),
+	})
+
+	burst := uint64(burstAfter)
+	helper.CgroupData.config.Resources.CpuQuota = quota
+	helper.CgroupData.config.Resources.CpuBurst = &burst
+	cpu := &CpuGroup{}
+	if err := cpu.Set(helper.CgroupPath, helper.CgroupData.config.Resources); err != nil {
+		t.Fatal(err)
+	}
+
+	value, err := fscommon.GetCgroupParamUint(helper.CgroupPath, "cpu.cfs_burst_us")
+	if err != nil {
+		t.Fatalf("Failed to parse cpu.cfs_burst_us - %s", err)
+	}
+	if value != burstAfter {
+		t.Fatal("Got the wrong value, set cpu.cfs_burst_us failed.")
+	}
+}
+
 func TestCpuStats(t *testing.T) {
 	helper := NewCgroupTestUtil("cpu", t)
 	defer helper.cleanup()
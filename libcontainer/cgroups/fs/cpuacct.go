@@ -47,26 +47,36 @@ func (s *CpuacctGroup) Set(_ string, _ *configs.Resources) error {
 	return nil
 }
 
+func (s *CpuacctGroup) SetPinned(_ *fscommon.PinnedDir, _ *configs.Resources) error {
+	return nil
+}
+
 func (s *CpuacctGroup) GetStats(path string, stats *cgroups.Stats) error {
-	if !cgroups.PathExists(path) {
+	dir := fscommon.PinDir(path)
+	defer dir.Close()
+	return s.GetStatsPinned(dir, stats)
+}
+
+func (s *CpuacctGroup) GetStatsPinned(dir *fscommon.PinnedDir, stats *cgroups.Stats) error {
+	if !cgroups.PathExists(dir.Path()) {
 		return nil
 	}
-	userModeUsage, kernelModeUsage, err := getCpuUsageBreakdown(path)
+	userModeUsage, kernelModeUsage, err := getCpuUsageBreakdown(dir)
 	if err != nil {
 		return err
 	}
 
-	totalUsage, err := fscommon.GetCgroupParamUint(path, "cpuacct.usage")
+	totalUsage, err := dir.GetCgroupParamUint("cpuacct.usage")
 	if err != nil {
 		return err
 	}
 
-	percpuUsage, err := getPercpuUsage(path)
+	percpuUsage, err := getPercpuUsage(dir)
 	if err != nil {
 		return err
 	}
 
-	percpuUsageInKernelmode, percpuUsageInUsermode, err := getPercpuUsageInModes(path)
+	percpuUsageInKernelmode, percpuUsageInUsermode, err := getPercpuUsageInModes(dir)
 	if err != nil {
 		return err
 	}
@@ -81,7 +91,7 @@ func (s *CpuacctGroup) GetStats(path string, stats *cgroups.Stats) error {
 }
 
 // Returns user and kernel usage breakdown in nanoseconds.
-func getCpuUsageBreakdown(path string) (uint64, uint64, error) {
+func getCpuUsageBreakdown(dir *fscommon.PinnedDir) (uint64, uint64, error) {
 	var userModeUsage, kernelModeUsage uint64
 	const (
 		userField   = "user"
@@ -91,13 +101,13 @@ func getCpuUsageBreakdown(path string) (uint64, uint64, error) {
 	// Expected format:
 	// user <usage in ticks>
 	// system <usage in ticks>
-	data, err := fscommon.ReadFile(path, cgroupCpuacctStat)
+	data, err := dir.ReadFile(cgroupCpuacctStat)
 	if err != nil {
 		return 0, 0, err
 	}
 	fields := strings.Fields(data)
 	if len(fields) < 4 {
-		return 0, 0, fmt.Errorf("failure - %s is expected to have at least 4 fields", filepath.Join(path, cgroupCpuacctStat))
+		return 0, 0, fmt.Errorf("failure - %s is expected to have at least 4 fields", filepath.Join(dir.Path(), cgroupCpuacctStat))
 	}
 	if fields[0] != userField {
 		return 0, 0, fmt.Errorf("unexpected field %q in %q, expected %q", fields[0], cgroupCpuacctStat, userField)
@@ -115,9 +125,9 @@ func getCpuUsageBreakdown(path string) (uint64, uint64, error) {
 	return (userModeUsage * nanosecondsInSecond) / clockTicks, (kernelModeUsage * nanosecondsInSecond) / clockTicks, nil
 }
 
-func getPercpuUsage(path string) ([]uint64, error) {
+func getPercpuUsage(dir *fscommon.PinnedDir) ([]uint64, error) {
 	percpuUsage := []uint64{}
-	data, err := fscommon.ReadFile(path, "cpuacct.usage_percpu")
+	data, err := dir.ReadFile("cpuacct.usage_percpu")
 	if err != nil {
 		return percpuUsage, err
 	}
@@ -131,11 +141,11 @@ func getPercpuUsage(path string) ([]uint64, error) {
 	return percpuUsage, nil
 }
 
-func getPercpuUsageInModes(path string) ([]uint64, []uint64, error) {
+func getPercpuUsageInModes(dir *fscommon.PinnedDir) ([]uint64, []uint64, error) {
 	usageKernelMode := []uint64{}
 	usageUserMode := []uint64{}
 
-	file, err := fscommon.OpenFile(path, cgroupCpuacctUsageAll, os.O_RDONLY)
+	file, err := dir.OpenFile(cgroupCpuacctUsageAll, os.O_RDONLY)
 	if os.IsNotExist(err) {
 		return usageKernelMode, usageUserMode, nil
 	} else if err != nil {
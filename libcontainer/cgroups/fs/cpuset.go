@@ -6,8 +6,6 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
-	"strconv"
-	"strings"
 
 	"github.com/opencontainers/runc/libcontainer/cgroups"
 	"github.com/opencontainers/runc/libcontainer/cgroups/fscommon"
@@ -28,115 +26,120 @@ func (s *CpusetGroup) Apply(path string, d *cgroupData) error {
 }
 
 func (s *CpusetGroup) Set(path string, r *configs.Resources) error {
+	dir := fscommon.PinDir(path)
+	defer dir.Close()
+	return s.SetPinned(dir, r)
+}
+
+func (s *CpusetGroup) SetPinned(dir *fscommon.PinnedDir, r *configs.Resources) error {
+	// The CPUs and memory nodes are checked against the effective ones of
+	// the parent, as the kernel either fails with a bare EINVAL or silently
+	// ignores the unavailable ones.
+	parent := filepath.Dir(dir.Path())
 	if r.CpusetCpus != "" {
-		if err := fscommon.WriteFile(path, "cpuset.cpus", r.CpusetCpus); err != nil {
+		if err := cgroups.CheckCPUSetFile(parent, "cpuset.effective_cpus", "CPUs", r.CpusetCpus); err != nil {
+			return err
+		}
+		if err := dir.WriteFile("cpuset.cpus", r.CpusetCpus); err != nil {
 			return err
 		}
 	}
 	if r.CpusetMems != "" {
-		if err := fscommon.WriteFile(path, "cpuset.mems", r.CpusetMems); err != nil {
+		if err := cgroups.CheckCPUSetFile(parent, "cpuset.effective_mems", "memory nodes", r.CpusetMems); err != nil {
+			return err
+		}
+		if err := dir.WriteFile("cpuset.mems", r.CpusetMems); err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
-func getCpusetStat(path string, filename string) ([]uint16, error) {
-	var extracted []uint16
-	fileContent, err := fscommon.GetCgroupParamString(path, filename)
+func getCpusetStat(dir *fscommon.PinnedDir, filename string) ([]uint16, error) {
+	fileContent, err := dir.GetCgroupParamString(filename)
 	if err != nil {
-		return extracted, err
+		return nil, err
 	}
 	if len(fileContent) == 0 {
-		return extracted, fmt.Errorf("%s found to be empty", filepath.Join(path, filename))
-	}
-
-	for _, s := range strings.Split(fileContent, ",") {
-		splitted := strings.SplitN(s, "-", 3)
-		switch len(splitted) {
-		case 3:
-			return extracted, fmt.Errorf("invalid values in %s", filepath.Join(path, filename))
-		case 2:
-			min, err := strconv.ParseUint(splitted[0], 10, 16)
-			if err != nil {
-				return extracted, err
-			}
-			max, err := strconv.ParseUint(splitted[1], 10, 16)
-			if err != nil {
-				return extracted, err
-			}
-			if min > max {
-				return extracted, fmt.Errorf("invalid values in %s", filepath.Join(path, filename))
-			}
-			for i := min; i <= max; i++ {
-				extracted = append(extracted, uint16(i))
-			}
-		case 1:
-			value, err := strconv.ParseUint(s, 10, 16)
-			if err != nil {
-				return extracted, err
-			}
-			extracted = append(extracted, uint16(value))
-		}
+		return nil, fmt.Errorf("%s found to be empty", filepath.Join(dir.Path(), filename))
+	}
+	extracted, err := cgroups.ParseCPUSetList(fileContent)
+	if err != nil {
+		return extracted, fmt.Errorf("invalid values in %s: %w", filepath.Join(dir.Path(), filename), err)
 	}
-
 	return extracted, nil
 }
 
 func (s *CpusetGroup) GetStats(path string, stats *cgroups.Stats) error {
+	dir := fscommon.PinDir(path)
+	defer dir.Close()
+	return s.GetStatsPinned(dir, stats)
+}
+
+func (s *CpusetGroup) GetStatsPinned(dir *fscommon.PinnedDir, stats *cgroups.Stats) error {
 	var err error
 
-	stats.CPUSetStats.CPUs, err = getCpusetStat(path, "cpuset.cpus")
+	stats.CPUSetStats.CPUs, err = getCpusetStat(dir, "cpuset.cpus")
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	stats.CPUSetStats.CPUExclusive, err = dir.GetCgroupParamUint("cpuset.cpu_exclusive")
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	stats.CPUSetStats.Mems, err = getCpusetStat(dir, "cpuset.mems")
 	if err != nil && !errors.Is(err, os.ErrNotExist) {
 		return err
 	}
 
-	stats.CPUSetStats.CPUExclusive, err = fscommon.GetCgroupParamUint(path, "cpuset.cpu_exclusive")
+	stats.CPUSetStats.EffectiveCPUs, err = getCpusetStat(dir, "cpuset.effective_cpus")
 	if err != nil && !errors.Is(err, os.ErrNotExist) {
 		return err
 	}
 
-	stats.CPUSetStats.Mems, err = getCpusetStat(path, "cpuset.mems")
+	stats.CPUSetStats.EffectiveMems, err = getCpusetStat(dir, "cpuset.effective_mems")
 	if err != nil && !errors.Is(err, os.ErrNotExist) {
 		return err
 	}
 
-	stats.CPUSetStats.MemHardwall, err = fscommon.GetCgroupParamUint(path, "cpuset.mem_hardwall")
+	stats.CPUSetStats.MemHardwall, err = dir.GetCgroupParamUint("cpuset.mem_hardwall")
 	if err != nil && !errors.Is(err, os.ErrNotExist) {
 		return err
 	}
 
-	stats.CPUSetStats.MemExclusive, err = fscommon.GetCgroupParamUint(path, "cpuset.mem_exclusive")
+	stats.CPUSetStats.MemExclusive, err = dir.GetCgroupParamUint("cpuset.mem_exclusive")
 	if err != nil && !errors.Is(err, os.ErrNotExist) {
 		return err
 	}
 
-	stats.CPUSetStats.MemoryMigrate, err = fscommon.GetCgroupParamUint(path, "cpuset.memory_migrate")
+	stats.CPUSetStats.MemoryMigrate, err = dir.GetCgroupParamUint("cpuset.memory_migrate")
 	if err != nil && !errors.Is(err, os.ErrNotExist) {
 		return err
 	}
 
-	stats.CPUSetStats.MemorySpreadPage, err = fscommon.GetCgroupParamUint(path, "cpuset.memory_spread_page")
+	stats.CPUSetStats.MemorySpreadPage, err = dir.GetCgroupParamUint("cpuset.memory_spread_page")
 	if err != nil && !errors.Is(err, os.ErrNotExist) {
 		return err
 	}
 
-	stats.CPUSetStats.MemorySpreadSlab, err = fscommon.GetCgroupParamUint(path, "cpuset.memory_spread_slab")
+	stats.CPUSetStats.MemorySpreadSlab, err = dir.GetCgroupParamUint("cpuset.memory_spread_slab")
 	if err != nil && !errors.Is(err, os.ErrNotExist) {
 		return err
 	}
 
-	stats.CPUSetStats.MemoryPressure, err = fscommon.GetCgroupParamUint(path, "cpuset.memory_pressure")
+	stats.CPUSetStats.MemoryPressure, err = dir.GetCgroupParamUint("cpuset.memory_pressure")
 	if err != nil && !errors.Is(err, os.ErrNotExist) {
 		return err
 	}
 
-	stats.CPUSetStats.SchedLoadBalance, err = fscommon.GetCgroupParamUint(path, "cpuset.sched_load_balance")
+	stats.CPUSetStats.SchedLoadBalance, err = dir.GetCgroupParamUint("cpuset.sched_load_balance")
 	if err != nil && !errors.Is(err, os.ErrNotExist) {
 		return err
 	}
 
-	stats.CPUSetStats.SchedRelaxDomainLevel, err = fscommon.GetCgroupParamInt(path, "cpuset.sched_relax_domain_level")
+	stats.CPUSetStats.SchedRelaxDomainLevel, err = dir.GetCgroupParamInt("cpuset.sched_relax_domain_level")
 	if err != nil && !errors.Is(err, os.ErrNotExist) {
 		return err
 	}
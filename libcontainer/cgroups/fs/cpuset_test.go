@@ -4,6 +4,7 @@ package fs
 
 import (
 	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/opencontainers/runc/libcontainer/cgroups"
@@ -22,6 +23,8 @@ const (
 	memoryPressure        = "34377\n"
 	schedLoadBalance      = "1\n"
 	schedRelaxDomainLevel = "-1\n"
+	effectiveCpus         = "0-2,7\n"
+	effectiveMems         = "1-2\n"
 )
 
 var cpusetTestFiles = map[string]string{
@@ -36,6 +39,8 @@ var cpusetTestFiles = map[string]string{
 	"cpuset.memory_pressure":          memoryPressure,
 	"cpuset.sched_load_balance":       schedLoadBalance,
 	"cpuset.sched_relax_domain_level": schedRelaxDomainLevel,
+	"cpuset.effective_cpus":           effectiveCpus,
+	"cpuset.effective_mems":           effectiveMems,
 }
 
 func TestCPUSetSetCpus(t *testing.T) {
@@ -96,6 +101,41 @@ func TestCPUSetSetMems(t *testing.T) {
 	}
 }
 
+func TestCPUSetSetUnavailable(t *testing.T) {
+	helper := NewCgroupTestUtil("cpuset", t)
+	defer helper.cleanup()
+
+	// The parent of the cgroup is the root of the mock filesystem.
+	for file, contents := range map[string]string{
+		"cpuset.effective_cpus": "0-3\n",
+		"cpuset.effective_mems": "0\n",
+	} {
+		if err := fscommon.WriteFile(helper.CgroupData.root, file, contents); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cpuset := &CpusetGroup{}
+	r := helper.CgroupData.config.Resources
+	r.CpusetCpus = "2-5"
+	if err := cpuset.Set(helper.CgroupPath, r); err == nil {
+		t.Fatal("expected an error for unavailable CPUs")
+	} else if !strings.Contains(err.Error(), "available CPUs: 0-3") {
+		t.Fatalf("expected the available CPUs in the error, got %q", err)
+	}
+
+	r.CpusetCpus = "1-3"
+	r.CpusetMems = "1"
+	if err := cpuset.Set(helper.CgroupPath, r); err == nil {
+		t.Fatal("expected an error for unavailable memory nodes")
+	}
+
+	r.CpusetMems = "0"
+	if err := cpuset.Set(helper.CgroupPath, r); err != nil {
+		t.Fatal(err)
+	}
+}
+
 func TestCPUSetStatsCorrect(t *testing.T) {
 	helper := NewCgroupTestUtil("cpuset", t)
 	defer helper.cleanup()
@@ -118,7 +158,10 @@ func TestCPUSetStatsCorrect(t *testing.T) {
 		MemorySpreadSlab:      1,
 		MemoryPressure:        34377,
 		SchedLoadBalance:      1,
-		SchedRelaxDomainLevel: -1}
+		SchedRelaxDomainLevel: -1,
+		EffectiveCPUs:         []uint16{0, 1, 2, 7},
+		EffectiveMems:         []uint16{1, 2},
+	}
 	if !reflect.DeepEqual(expectedStats, actualStats.CPUSetStats) {
 		t.Fatalf("Expected Cpuset stats usage %#v but found %#v",
 			expectedStats, actualStats.CPUSetStats)
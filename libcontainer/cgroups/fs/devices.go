@@ -5,14 +5,18 @@ package fs
 import (
 	"bytes"
 	"errors"
+	"os"
 	"reflect"
 
 	"github.com/opencontainers/runc/libcontainer/cgroups"
 	cgroupdevices "github.com/opencontainers/runc/libcontainer/cgroups/devices"
+	"github.com/opencontainers/runc/libcontainer/cgroups/ebpf"
+	"github.com/opencontainers/runc/libcontainer/cgroups/ebpf/devicefilter"
 	"github.com/opencontainers/runc/libcontainer/cgroups/fscommon"
 	"github.com/opencontainers/runc/libcontainer/configs"
 	"github.com/opencontainers/runc/libcontainer/devices"
 	"github.com/opencontainers/runc/libcontainer/userns"
+	"golang.org/x/sys/unix"
 )
 
 type DevicesGroup struct {
@@ -35,8 +39,8 @@ func (s *DevicesGroup) Apply(path string, d *cgroupData) error {
 	return join(path, d.pid)
 }
 
-func loadEmulator(path string) (*cgroupdevices.Emulator, error) {
-	list, err := fscommon.ReadFile(path, "devices.list")
+func loadEmulator(dir *fscommon.PinnedDir) (*cgroupdevices.Emulator, error) {
+	list, err := dir.ReadFile("devices.list")
 	if err != nil {
 		return nil, err
 	}
@@ -55,13 +59,19 @@ func buildEmulator(rules []*devices.Rule) (*cgroupdevices.Emulator, error) {
 }
 
 func (s *DevicesGroup) Set(path string, r *configs.Resources) error {
+	dir := fscommon.PinDir(path)
+	defer dir.Close()
+	return s.SetPinned(dir, r)
+}
+
+func (s *DevicesGroup) SetPinned(dir *fscommon.PinnedDir, r *configs.Resources) error {
 	if userns.RunningInUserNS() || r.SkipDevices {
 		return nil
 	}
 
 	// Generate two emulators, one for the current state of the cgroup and one
 	// for the requested state by the user.
-	current, err := loadEmulator(path)
+	current, err := loadEmulator(dir)
 	if err != nil {
 		return err
 	}
@@ -81,7 +91,7 @@ func (s *DevicesGroup) Set(path string, r *configs.Resources) error {
 		if rule.Allow {
 			file = "devices.allow"
 		}
-		if err := fscommon.WriteFile(path, file, rule.CgroupString()); err != nil {
+		if err := dir.WriteFile(file, rule.CgroupString()); err != nil {
 			return err
 		}
 	}
@@ -93,7 +103,7 @@ func (s *DevicesGroup) Set(path string, r *configs.Resources) error {
 	// This safety-check is skipped for the unit tests because we cannot
 	// currently mock devices.list correctly.
 	if !s.testingSkipFinalCheck {
-		currentAfter, err := loadEmulator(path)
+		currentAfter, err := loadEmulator(dir)
 		if err != nil {
 			return err
 		}
@@ -109,3 +119,27 @@ func (s *DevicesGroup) Set(path string, r *configs.Resources) error {
 func (s *DevicesGroup) GetStats(path string, stats *cgroups.Stats) error {
 	return nil
 }
+
+func (s *DevicesGroup) GetStatsPinned(dir *fscommon.PinnedDir, stats *cgroups.Stats) error {
+	return nil
+}
+
+// SetDevicesAudit attaches a device filter program auditing the accesses
+// denied by the device rules of r to path, the cgroup of the container in the
+// unified hierarchy mounted in hybrid mode. The accesses are not denied by the
+// program, the rules being enforced by the devices controller.
+func SetDevicesAudit(path string, r *configs.Resources) error {
+	if r.SkipDevices {
+		return nil
+	}
+	insts, license, err := devicefilter.DeviceFilter(r.Devices)
+	if err != nil {
+		return err
+	}
+	dirFd, err := unix.Open(path, unix.O_DIRECTORY|unix.O_RDONLY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return &os.PathError{Op: "open", Path: path, Err: err}
+	}
+	defer unix.Close(dirFd)
+	return ebpf.LoadAttachCgroupDeviceAudit(insts, license, dirFd)
+}
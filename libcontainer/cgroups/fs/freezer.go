@@ -3,6 +3,7 @@
 package fs
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"os"
@@ -27,88 +28,127 @@ func (s *FreezerGroup) Apply(path string, d *cgroupData) error {
 	return join(path, d.pid)
 }
 
-func (s *FreezerGroup) Set(path string, r *configs.Resources) (Err error) {
-	switch r.Freezer {
+func (s *FreezerGroup) Set(path string, r *configs.Resources) error {
+	dir := fscommon.PinDir(path)
+	defer dir.Close()
+	return s.SetPinned(dir, r)
+}
+
+func (s *FreezerGroup) SetPinned(dir *fscommon.PinnedDir, r *configs.Resources) error {
+	return s.SetState(context.Background(), dir, r.Freezer, nil)
+}
+
+// SetState sets the freezer state of the cgroup dir. Freezing gives up once
+// ctx is done or, if ctx has no deadline, after a fixed number of attempts,
+// in which case the error wraps cgroups.ErrFreezing. opts may be nil.
+func (s *FreezerGroup) SetState(ctx context.Context, dir *fscommon.PinnedDir, state configs.FreezerState, opts *cgroups.FreezeOptions) (Err error) {
+	switch state {
 	case configs.Frozen:
 		defer func() {
 			if Err != nil {
 				// Freezing failed, and it is bad and dangerous
 				// to leave the cgroup in FROZEN or FREEZING
 				// state, so (try to) thaw it back.
-				_ = fscommon.WriteFile(path, "freezer.state", string(configs.Thawed))
+				_ = dir.WriteFile("freezer.state", string(configs.Thawed))
 			}
 		}()
 
-		// As per older kernel docs (freezer-subsystem.txt before
-		// kernel commit ef9fe980c6fcc1821), if FREEZING is seen,
-		// userspace should either retry or thaw. While current
-		// kernel cgroup v1 docs no longer mention a need to retry,
-		// even a recent kernel (v5.4, Ubuntu 20.04) can't reliably
-		// freeze a cgroup v1 while new processes keep appearing in it
-		// (either via fork/clone or by writing new PIDs to
-		// cgroup.procs).
-		//
-		// The numbers below are empirically chosen to have a decent
-		// chance to succeed in various scenarios ("runc pause/unpause
-		// with parallel runc exec" and "bare freeze/unfreeze on a very
-		// slow system"), tested on RHEL7 and Ubuntu 20.04 kernels.
-		//
-		// Adding any amount of sleep in between retries did not
-		// increase the chances of successful freeze in "pause/unpause
-		// with parallel exec" reproducer. OTOH, adding an occasional
-		// sleep helped for the case where the system is extremely slow
-		// (CentOS 7 VM on GHA CI).
-		//
-		// Alas, this is still a game of chances, since the real fix
-		// belong to the kernel (cgroup v2 do not have this bug).
-
-		for i := 0; i < 1000; i++ {
-			if i%50 == 49 {
-				// Occasional thaw and sleep improves
-				// the chances to succeed in freezing
-				// in case new processes keep appearing
-				// in the cgroup.
-				_ = fscommon.WriteFile(path, "freezer.state", string(configs.Thawed))
-				time.Sleep(10 * time.Millisecond)
-			}
-
-			if err := fscommon.WriteFile(path, "freezer.state", string(configs.Frozen)); err != nil {
+		err := freeze(ctx, dir)
+		if errors.Is(err, cgroups.ErrFreezing) && opts != nil && opts.Signal != 0 {
+			// The signal is only delivered to thawed tasks.
+			if err := dir.WriteFile("freezer.state", string(configs.Thawed)); err != nil {
 				return err
 			}
-
-			if i%25 == 24 {
-				// Occasional short sleep before reading
-				// the state back also improves the chances to
-				// succeed in freezing in case of a very slow
-				// system.
-				time.Sleep(10 * time.Microsecond)
-			}
-			state, err := fscommon.ReadFile(path, "freezer.state")
-			if err != nil {
+			logrus.Debugf("unable to freeze %s, retrying after sending signal %d to its processes", dir.Path(), opts.Signal)
+			if err := cgroups.SignalAllPids(dir.Path(), opts.Signal); err != nil {
 				return err
 			}
-			state = strings.TrimSpace(state)
-			switch state {
-			case "FREEZING":
-				continue
-			case string(configs.Frozen):
-				if i > 1 {
-					logrus.Debugf("frozen after %d retries", i)
-				}
-				return nil
-			default:
-				// should never happen
-				return fmt.Errorf("unexpected state %s while freezing", strings.TrimSpace(state))
-			}
+			ctx, cancel := context.WithTimeout(context.Background(), cgroups.FreezeSignalRetryTimeout)
+			defer cancel()
+			err = freeze(ctx, dir)
 		}
-		// Despite our best efforts, it got stuck in FREEZING.
-		return errors.New("unable to freeze")
+		return err
 	case configs.Thawed:
-		return fscommon.WriteFile(path, "freezer.state", string(configs.Thawed))
+		return dir.WriteFile("freezer.state", string(configs.Thawed))
 	case configs.Undefined:
 		return nil
 	default:
-		return fmt.Errorf("Invalid argument '%s' to freezer.state", string(r.Freezer))
+		return fmt.Errorf("Invalid argument '%s' to freezer.state", string(state))
+	}
+}
+
+func freeze(ctx context.Context, dir *fscommon.PinnedDir) error {
+	// As per older kernel docs (freezer-subsystem.txt before
+	// kernel commit ef9fe980c6fcc1821), if FREEZING is seen,
+	// userspace should either retry or thaw. While current
+	// kernel cgroup v1 docs no longer mention a need to retry,
+	// even a recent kernel (v5.4, Ubuntu 20.04) can't reliably
+	// freeze a cgroup v1 while new processes keep appearing in it
+	// (either via fork/clone or by writing new PIDs to
+	// cgroup.procs).
+	//
+	// The numbers below are empirically chosen to have a decent
+	// chance to succeed in various scenarios ("runc pause/unpause
+	// with parallel runc exec" and "bare freeze/unfreeze on a very
+	// slow system"), tested on RHEL7 and Ubuntu 20.04 kernels.
+	//
+	// Adding any amount of sleep in between retries did not
+	// increase the chances of successful freeze in "pause/unpause
+	// with parallel exec" reproducer. OTOH, adding an occasional
+	// sleep helped for the case where the system is extremely slow
+	// (CentOS 7 VM on GHA CI).
+	//
+	// Alas, this is still a game of chances, since the real fix
+	// belong to the kernel (cgroup v2 do not have this bug).
+	//
+	// If ctx has a deadline, the attempts go on until it's reached.
+	const maxIter = 1000
+	_, hasDeadline := ctx.Deadline()
+	for i := 0; ; i++ {
+		if err := ctx.Err(); err != nil {
+			return fmt.Errorf("%w: %v", cgroups.ErrFreezing, err)
+		}
+		if !hasDeadline && i == maxIter {
+			// Despite our best efforts, it got stuck in FREEZING.
+			return fmt.Errorf("%w after %d attempts", cgroups.ErrFreezing, i)
+		}
+		if i%50 == 49 {
+			// Occasional thaw and sleep improves
+			// the chances to succeed in freezing
+			// in case new processes keep appearing
+			// in the cgroup.
+			_ = dir.WriteFile("freezer.state", string(configs.Thawed))
+			time.Sleep(10 * time.Millisecond)
+		}
+
+		if err := dir.WriteFile("freezer.state", string(configs.Frozen)); err != nil {
+			return err
+		}
+
+		if i%25 == 24 {
+			// Occasional short sleep before reading
+			// the state back also improves the chances to
+			// succeed in freezing in case of a very slow
+			// system.
+			time.Sleep(10 * time.Microsecond)
+		}
+		state, err := dir.ReadFile("freezer.state")
+		if err != nil {
+			return err
+		}
+		state = strings.TrimSpace(state)
+		switch state {
+		case "FREEZING":
+			continue
+		case string(configs.Frozen):
+			if i > 1 {
+				logrus.Debugf("frozen after %d retries", i)
+			}
+			return nil
+		default:
+			// should never happen
+			return fmt.Errorf("unexpected state %s while freezing", strings.TrimSpace(state))
+		}
 	}
 }
 
@@ -116,9 +156,19 @@ func (s *FreezerGroup) GetStats(path string, stats *cgroups.Stats) error {
 	return nil
 }
 
+func (s *FreezerGroup) GetStatsPinned(dir *fscommon.PinnedDir, stats *cgroups.Stats) error {
+	return nil
+}
+
 func (s *FreezerGroup) GetState(path string) (configs.FreezerState, error) {
+	dir := fscommon.PinDir(path)
+	defer dir.Close()
+	return s.GetStatePinned(dir)
+}
+
+func (s *FreezerGroup) GetStatePinned(dir *fscommon.PinnedDir) (configs.FreezerState, error) {
 	for {
-		state, err := fscommon.ReadFile(path, "freezer.state")
+		state, err := dir.ReadFile("freezer.state")
 		if err != nil {
 			// If the kernel is too old, then we just treat the freezer as
 			// being in an "undefined" state.
@@ -3,8 +3,11 @@
 package fs
 
 import (
+	"context"
+	"errors"
 	"testing"
 
+	"github.com/opencontainers/runc/libcontainer/cgroups"
 	"github.com/opencontainers/runc/libcontainer/cgroups/fscommon"
 	"github.com/opencontainers/runc/libcontainer/configs"
 )
@@ -46,3 +49,31 @@ func TestFreezerSetInvalidState(t *testing.T) {
 		t.Fatal("Failed to return invalid argument error")
 	}
 }
+
+func TestFreezerSetStateCanceled(t *testing.T) {
+	helper := NewCgroupTestUtil("freezer", t)
+	defer helper.cleanup()
+
+	helper.writeFileContents(map[string]string{
+		"freezer.state": string(configs.Thawed),
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	freezer := &FreezerGroup{}
+	dir := fscommon.PinDir(helper.CgroupPath)
+	defer dir.Close()
+	err := freezer.SetState(ctx, dir, configs.Frozen, nil)
+	if !errors.Is(err, cgroups.ErrFreezing) {
+		t.Fatalf("expected ErrFreezing, got %v", err)
+	}
+
+	// The cgroup must be thawed back.
+	value, err := fscommon.GetCgroupParamString(helper.CgroupPath, "freezer.state")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value != string(configs.Thawed) {
+		t.Fatalf("expected freezer.state to be %s, got %s", configs.Thawed, value)
+	}
+}
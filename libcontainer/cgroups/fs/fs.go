@@ -3,6 +3,7 @@
 package fs
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -26,6 +27,7 @@ var (
 		&PidsGroup{},
 		&BlkioGroup{},
 		&HugetlbGroup{},
+		&RdmaGroup{},
 		&NetClsGroup{},
 		&NetPrioGroup{},
 		&PerfEventGroup{},
@@ -40,12 +42,12 @@ var errSubsystemDoesNotExist = errors.New("cgroup: subsystem does not exist")
 type subsystem interface {
 	// Name returns the name of the subsystem.
 	Name() string
-	// Returns the stats, as 'stats', corresponding to the cgroup under 'path'.
-	GetStats(path string, stats *cgroups.Stats) error
+	// Returns the stats, as 'stats', corresponding to the cgroup in 'dir'.
+	GetStatsPinned(dir *fscommon.PinnedDir, stats *cgroups.Stats) error
 	// Creates and joins the cgroup represented by 'cgroupData'.
 	Apply(path string, c *cgroupData) error
 	// Set sets the cgroup resources.
-	Set(path string, r *configs.Resources) error
+	SetPinned(dir *fscommon.PinnedDir, r *configs.Resources) error
 }
 
 type manager struct {
@@ -53,6 +55,8 @@ type manager struct {
 	cgroups  *configs.Cgroup
 	rootless bool // ignore permission-related errors
 	paths    map[string]string
+	// dirs caches the pinned paths.
+	dirs fscommon.DirCache
 }
 
 func NewManager(cg *configs.Cgroup, paths map[string]string, rootless bool) cgroups.Manager {
@@ -195,6 +199,8 @@ func (m *manager) Apply(pid int) (err error) {
 		return cgroups.ErrV1NoUnified
 	}
 
+	// The cgroups may be created again.
+	m.dirs.Reset()
 	m.paths = make(map[string]string)
 	if c.Paths != nil {
 		cgMap, err := cgroups.ParseCgroupFile("/proc/self/cgroup")
@@ -215,6 +221,7 @@ func (m *manager) Apply(pid int) (err error) {
 		return err
 	}
 
+	var found []subsystem
 	for _, sys := range subsystems {
 		p, err := d.path(sys.Name())
 		if err != nil {
@@ -226,29 +233,68 @@ func (m *manager) Apply(pid int) (err error) {
 			return err
 		}
 		m.paths[sys.Name()] = p
+		found = append(found, sys)
+	}
+
+	// The cgroups of the subsystems mounted in different hierarchies are
+	// created and joined concurrently. The co-mounted subsystems (such as
+	// cpu and cpuacct) share a directory, so they are applied serially.
+	errs := fscommon.RunGrouped(len(found), func(i int) string {
+		return m.paths[found[i].Name()]
+	}, func(i int) error {
+		return found[i].Apply(m.paths[found[i].Name()], d)
+	})
+	for i, err := range errs {
+		if err == nil {
+			continue
+		}
+		// In the case of rootless (including euid=0 in userns), where an
+		// explicit cgroup path hasn't been set, we don't bail on error in
+		// case of permission problems. Cases where limits have been set
+		// (and we couldn't create our own cgroup) are handled by Set.
+		if isIgnorableError(m.rootless, err) && m.cgroups.Path == "" {
+			delete(m.paths, found[i].Name())
+			continue
+		}
+		return err
+	}
 
-		if err := sys.Apply(p, d); err != nil {
-			// In the case of rootless (including euid=0 in userns), where an
-			// explicit cgroup path hasn't been set, we don't bail on error in
-			// case of permission problems. Cases where limits have been set
-			// (and we couldn't create our own cgroup) are handled by Set.
-			if isIgnorableError(m.rootless, err) && m.cgroups.Path == "" {
-				delete(m.paths, sys.Name())
-				continue
-			}
+	// The accesses to the devices are audited by a program attached to
+	// the cgroup of the container in the unified hierarchy.
+	if c.AuditDevices {
+		p, err := d.unifiedPath()
+		if err != nil {
 			return err
 		}
-
+		if err := join(p, pid); err != nil {
+			return err
+		}
+		m.paths[""] = p
 	}
 	return nil
 }
 
+// ApplyContext is like Apply. The cgroups are created directly, which is not
+// worth canceling, so ctx is only checked beforehand.
+func (m *manager) ApplyContext(ctx context.Context, pid int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return m.Apply(pid)
+}
+
+// DestroyContext is like Destroy, ctx being unused.
+func (m *manager) DestroyContext(_ context.Context) error {
+	return m.Destroy()
+}
+
 func (m *manager) Destroy() error {
 	if m.cgroups == nil || m.cgroups.Paths != nil {
 		return nil
 	}
 	m.mu.Lock()
 	defer m.mu.Unlock()
+	m.dirs.Reset()
 	return cgroups.RemovePaths(m.paths)
 }
 
@@ -259,21 +305,62 @@ func (m *manager) Path(subsys string) string {
 }
 
 func (m *manager) GetStats() (*cgroups.Stats, error) {
+	return m.GetStatsFor()
+}
+
+func (m *manager) GetStatsFor(controllers ...string) (*cgroups.Stats, error) {
+	want, err := StatsWanted(controllers)
+	if err != nil {
+		return nil, err
+	}
 	m.mu.Lock()
 	defer m.mu.Unlock()
 	stats := cgroups.NewStats()
 	for _, sys := range subsystems {
 		path := m.paths[sys.Name()]
-		if path == "" {
+		if path == "" || !want(sys.Name()) {
 			continue
 		}
-		if err := sys.GetStats(path, stats); err != nil {
+		if err := sys.GetStatsPinned(m.dirs.Get(path), stats); err != nil {
 			return nil, err
 		}
 	}
 	return stats, nil
 }
 
+// StatsWanted returns a function reporting whether the statistics of a
+// subsystem are to be collected by GetStatsFor(controllers...).
+func StatsWanted(controllers []string) (func(string) bool, error) {
+	if len(controllers) == 0 {
+		return func(string) bool { return true }, nil
+	}
+	wanted := make(map[string]bool, len(controllers))
+	for _, c := range controllers {
+		// Allow the names of the cgroup v2 controllers.
+		switch c {
+		case "io":
+			c = "blkio"
+		case "cpu":
+			wanted["cpuacct"] = true
+		case "misc":
+			// There is no cgroup v1 misc subsystem.
+			continue
+		}
+		found := false
+		for _, sys := range subsystems {
+			if sys.Name() == c {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown cgroup controller %q", c)
+		}
+		wanted[c] = true
+	}
+	return func(c string) bool { return wanted[c] }, nil
+}
+
 func (m *manager) Set(r *configs.Resources) error {
 	if r == nil {
 		return nil
@@ -290,30 +377,45 @@ func (m *manager) Set(r *configs.Resources) error {
 
 	m.mu.Lock()
 	defer m.mu.Unlock()
-	for _, sys := range subsystems {
-		path := m.paths[sys.Name()]
-		if err := sys.Set(path, r); err != nil {
-			if m.rootless && sys.Name() == "devices" {
-				continue
-			}
-			// When m.rootless is true, errors from the device subsystem are ignored because it is really not expected to work.
-			// However, errors from other subsystems are not ignored.
-			// see @test "runc create (rootless + limits + no cgrouppath + no permission) fails with informative error"
-			if path == "" {
-				// We never created a path for this cgroup, so we cannot set
-				// limits for it (though we have already tried at this point).
-				return fmt.Errorf("cannot set %s limit: container could not join or create cgroup", sys.Name())
-			}
-			return err
+	errs := fscommon.RunConcurrentlyExcept(len(subsystems), func(i int) bool {
+		return fscommon.SetSerially(subsystems[i].Name())
+	}, func(i int) error {
+		return subsystems[i].SetPinned(m.dirs.Get(m.paths[subsystems[i].Name()]), r)
+	})
+	for i, err := range errs {
+		if err == nil {
+			continue
+		}
+		sys := subsystems[i]
+		if m.rootless && sys.Name() == "devices" {
+			continue
+		}
+		// When m.rootless is true, errors from the device subsystem are ignored because it is really not expected to work.
+		// However, errors from other subsystems are not ignored.
+		// see @test "runc create (rootless + limits + no cgrouppath + no permission) fails with informative error"
+		if m.paths[sys.Name()] == "" {
+			// We never created a path for this cgroup, so we cannot set
+			// limits for it (though we have already tried at this point).
+			return fmt.Errorf("cannot set %s limit: container could not join or create cgroup", sys.Name())
 		}
+		return err
 	}
 
+	if p := m.paths[""]; p != "" && m.cgroups != nil && m.cgroups.AuditDevices {
+		if err := SetDevicesAudit(p, r); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
 // Freeze toggles the container's freezer cgroup depending on the state
 // provided
 func (m *manager) Freeze(state configs.FreezerState) error {
+	return m.FreezeContext(context.Background(), state, nil)
+}
+
+func (m *manager) FreezeContext(ctx context.Context, state configs.FreezerState, opts *cgroups.FreezeOptions) error {
 	path := m.Path("freezer")
 	if m.cgroups == nil || path == "" {
 		return errors.New("cannot toggle freezer: cgroups not configured for container")
@@ -322,7 +424,7 @@ func (m *manager) Freeze(state configs.FreezerState) error {
 	prevState := m.cgroups.Resources.Freezer
 	m.cgroups.Resources.Freezer = state
 	freezer := &FreezerGroup{}
-	if err := freezer.Set(path, m.cgroups.Resources); err != nil {
+	if err := freezer.SetState(ctx, m.dirs.Get(path), state, opts); err != nil {
 		m.cgroups.Resources.Freezer = prevState
 		return err
 	}
@@ -389,6 +491,43 @@ func (raw *cgroupData) path(subsystem string) (string, error) {
 	return filepath.Join(parentPath, raw.innerPath), nil
 }
 
+// unifiedPath returns the path of the cgroup in the unified hierarchy, which
+// is only mounted (on cgroups.HybridMountpoint) in hybrid mode.
+func (raw *cgroupData) unifiedPath() (string, error) {
+	if filepath.IsAbs(raw.innerPath) {
+		if !cgroups.IsCgroup2HybridMode() {
+			return "", fmt.Errorf("the unified hierarchy is not mounted on %s", cgroups.HybridMountpoint)
+		}
+		return filepath.Join(cgroups.HybridMountpoint, raw.innerPath), nil
+	}
+	own, err := cgroups.ParseCgroupFile("/proc/self/cgroup")
+	if err != nil {
+		return "", err
+	}
+	return cgroups.GetHybridCgroupPath(filepath.Join(own[""], raw.innerPath))
+}
+
+// Paths returns the paths of the cgroups Apply creates for c in the current
+// process, by subsystem, omitting the subsystems which are not mounted.
+func Paths(c *configs.Cgroup) (map[string]string, error) {
+	d, err := getCgroupData(c, 0)
+	if err != nil {
+		return nil, err
+	}
+	paths := make(map[string]string)
+	for _, sys := range subsystems {
+		p, err := d.path(sys.Name())
+		if err != nil {
+			if cgroups.IsNotFound(err) {
+				continue
+			}
+			return nil, err
+		}
+		paths[sys.Name()] = p
+	}
+	return paths, nil
+}
+
 func join(path string, pid int) error {
 	if path == "" {
 		return nil
@@ -416,7 +555,7 @@ func (m *manager) GetFreezerState() (configs.FreezerState, error) {
 		return configs.Undefined, nil
 	}
 	freezer := &FreezerGroup{}
-	return freezer.GetState(dir)
+	return freezer.GetStatePinned(m.dirs.Get(dir))
 }
 
 func (m *manager) Exists() bool {
@@ -436,3 +575,11 @@ func (m *manager) OOMKillCount() (uint64, error) {
 
 	return c, err
 }
+
+func (m *manager) Reclaim(_ uint64) error {
+	return cgroups.ErrReclaimNotSupported
+}
+
+func (m *manager) CanCreateEmpty() bool {
+	return true
+}
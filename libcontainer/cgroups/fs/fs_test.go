@@ -144,3 +144,38 @@ func BenchmarkGetStats(b *testing.B) {
 		b.Fatalf("stats: %+v", st)
 	}
 }
+
+func TestGetStatsFor(t *testing.T) {
+	pids := NewCgroupTestUtil("pids", t)
+	defer pids.cleanup()
+	pids.writeFileContents(map[string]string{
+		"pids.current": "1337",
+		"pids.max":     "max",
+	})
+	// The files of the other subsystems do not exist, so collecting their
+	// statistics fails.
+	cpuacct := NewCgroupTestUtil("cpuacct", t)
+	defer cpuacct.cleanup()
+	m := NewManager(&configs.Cgroup{}, map[string]string{
+		"pids":    pids.CgroupPath,
+		"cpuacct": cpuacct.CgroupPath,
+	}, false)
+
+	if _, err := m.GetStats(); err == nil {
+		t.Fatal("expected an error getting all the stats")
+	}
+	stats, err := m.GetStatsFor("pids")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.PidsStats.Current != 1337 {
+		t.Fatalf("Expected %d, got %d for pids.current", 1337, stats.PidsStats.Current)
+	}
+	// With cgroup v1, cpu includes the cpuacct subsystem.
+	if _, err := m.GetStatsFor("pids", "cpu"); err == nil {
+		t.Fatal("expected an error getting the cpu stats")
+	}
+	if _, err := m.GetStatsFor("foo"); err == nil {
+		t.Fatal("expected an error for an unknown controller")
+	}
+}
@@ -3,7 +3,9 @@
 package fs
 
 import (
+	"errors"
 	"fmt"
+	"os"
 	"strconv"
 
 	"github.com/opencontainers/runc/libcontainer/cgroups"
@@ -23,8 +25,30 @@ func (s *HugetlbGroup) Apply(path string, d *cgroupData) error {
 }
 
 func (s *HugetlbGroup) Set(path string, r *configs.Resources) error {
+	dir := fscommon.PinDir(path)
+	defer dir.Close()
+	return s.SetPinned(dir, r)
+}
+
+func (s *HugetlbGroup) SetPinned(dir *fscommon.PinnedDir, r *configs.Resources) error {
+	// The reservations are limited too (if the kernel supports their
+	// accounting), so that exceeding the limit makes mmap fail rather than
+	// the process be killed by SIGBUS when faulting a page in.
+	skipRsvd := false
 	for _, hugetlb := range r.HugetlbLimit {
-		if err := fscommon.WriteFile(path, "hugetlb."+hugetlb.Pagesize+".limit_in_bytes", strconv.FormatUint(hugetlb.Limit, 10)); err != nil {
+		prefix := "hugetlb." + hugetlb.Pagesize
+		val := strconv.FormatUint(hugetlb.Limit, 10)
+		if err := dir.WriteFile(prefix+".limit_in_bytes", val); err != nil {
+			return err
+		}
+		if skipRsvd {
+			continue
+		}
+		if err := dir.WriteFile(prefix+".rsvd.limit_in_bytes", val); err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				skipRsvd = true
+				continue
+			}
 			return err
 		}
 	}
@@ -33,34 +57,73 @@ func (s *HugetlbGroup) Set(path string, r *configs.Resources) error {
 }
 
 func (s *HugetlbGroup) GetStats(path string, stats *cgroups.Stats) error {
-	hugetlbStats := cgroups.HugetlbStats{}
-	if !cgroups.PathExists(path) {
+	dir := fscommon.PinDir(path)
+	defer dir.Close()
+	return s.GetStatsPinned(dir, stats)
+}
+
+func (s *HugetlbGroup) GetStatsPinned(dir *fscommon.PinnedDir, stats *cgroups.Stats) error {
+	if !cgroups.PathExists(dir.Path()) {
 		return nil
 	}
+	rsvd := true
 	for _, pageSize := range HugePageSizes {
+		hugetlbStats := cgroups.HugetlbStats{}
 		usage := "hugetlb." + pageSize + ".usage_in_bytes"
-		value, err := fscommon.GetCgroupParamUint(path, usage)
+		value, err := dir.GetCgroupParamUint(usage)
 		if err != nil {
 			return fmt.Errorf("failed to parse %s - %v", usage, err)
 		}
 		hugetlbStats.Usage = value
 
 		maxUsage := "hugetlb." + pageSize + ".max_usage_in_bytes"
-		value, err = fscommon.GetCgroupParamUint(path, maxUsage)
+		value, err = dir.GetCgroupParamUint(maxUsage)
 		if err != nil {
 			return fmt.Errorf("failed to parse %s - %v", maxUsage, err)
 		}
 		hugetlbStats.MaxUsage = value
 
 		failcnt := "hugetlb." + pageSize + ".failcnt"
-		value, err = fscommon.GetCgroupParamUint(path, failcnt)
+		value, err = dir.GetCgroupParamUint(failcnt)
 		if err != nil {
 			return fmt.Errorf("failed to parse %s - %v", failcnt, err)
 		}
 		hugetlbStats.Failcnt = value
 
+		if rsvd {
+			var err error
+			rsvd, err = getHugetlbRsvdStats(dir, pageSize, &hugetlbStats)
+			if err != nil {
+				return err
+			}
+		}
+
 		stats.HugetlbStats[pageSize] = hugetlbStats
 	}
 
 	return nil
 }
+
+// getHugetlbRsvdStats sets the reservation stats of the pages of pageSize in
+// stats, and returns false if the kernel doesn't account for reservations.
+func getHugetlbRsvdStats(dir *fscommon.PinnedDir, pageSize string, stats *cgroups.HugetlbStats) (bool, error) {
+	for _, f := range []struct {
+		name  string
+		value *uint64
+	}{
+		{"usage_in_bytes", &stats.RsvdUsage},
+		{"max_usage_in_bytes", &stats.RsvdMaxUsage},
+		{"failcnt", &stats.RsvdFailcnt},
+	} {
+		file := "hugetlb." + pageSize + ".rsvd." + f.name
+		value, err := dir.GetCgroupParamUint(file)
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				return false, nil
+			}
+			return false, fmt.Errorf("failed to parse %s - %v", file, err)
+		}
+		*f.value = value
+	}
+	return true, nil
+}
@@ -23,6 +23,11 @@ const (
 	limit    = "hugetlb.%s.limit_in_bytes"
 	maxUsage = "hugetlb.%s.max_usage_in_bytes"
 	failcnt  = "hugetlb.%s.failcnt"
+
+	rsvdUsage    = "hugetlb.%s.rsvd.usage_in_bytes"
+	rsvdLimit    = "hugetlb.%s.rsvd.limit_in_bytes"
+	rsvdMaxUsage = "hugetlb.%s.rsvd.max_usage_in_bytes"
+	rsvdFailcnt  = "hugetlb.%s.rsvd.failcnt"
 )
 
 func TestHugetlbSetHugetlb(t *testing.T) {
@@ -62,6 +67,15 @@ func TestHugetlbSetHugetlb(t *testing.T) {
 		if value != hugetlbAfter {
 			t.Fatalf("Set hugetlb.limit_in_bytes failed. Expected: %v, Got: %v", hugetlbAfter, value)
 		}
+
+		rsvdLimit := fmt.Sprintf(rsvdLimit, pageSize)
+		value, err = fscommon.GetCgroupParamUint(helper.CgroupPath, rsvdLimit)
+		if err != nil {
+			t.Fatalf("Failed to parse %s - %s", rsvdLimit, err)
+		}
+		if value != hugetlbAfter {
+			t.Fatalf("Set hugetlb.rsvd.limit_in_bytes failed. Expected: %v, Got: %v", hugetlbAfter, value)
+		}
 	}
 }
 
@@ -88,6 +102,39 @@ func TestHugetlbStats(t *testing.T) {
 	}
 }
 
+func TestHugetlbStatsRsvd(t *testing.T) {
+	helper := NewCgroupTestUtil("hugetlb", t)
+	defer helper.cleanup()
+	for _, pageSize := range HugePageSizes {
+		helper.writeFileContents(map[string]string{
+			fmt.Sprintf(usage, pageSize):        hugetlbUsageContents,
+			fmt.Sprintf(maxUsage, pageSize):     hugetlbMaxUsageContents,
+			fmt.Sprintf(failcnt, pageSize):      hugetlbFailcnt,
+			fmt.Sprintf(rsvdUsage, pageSize):    "1024\n",
+			fmt.Sprintf(rsvdMaxUsage, pageSize): "2048\n",
+			fmt.Sprintf(rsvdFailcnt, pageSize):  "3\n",
+		})
+	}
+
+	hugetlb := &HugetlbGroup{}
+	actualStats := *cgroups.NewStats()
+	err := hugetlb.GetStats(helper.CgroupPath, &actualStats)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedStats := cgroups.HugetlbStats{
+		Usage:        128,
+		MaxUsage:     256,
+		Failcnt:      100,
+		RsvdUsage:    1024,
+		RsvdMaxUsage: 2048,
+		RsvdFailcnt:  3,
+	}
+	for _, pageSize := range HugePageSizes {
+		expectHugetlbStatEquals(t, expectedStats, actualStats.HugetlbStats[pageSize])
+	}
+}
+
 func TestHugetlbStatsNoUsageFile(t *testing.T) {
 	helper := NewCgroupTestUtil("hugetlb", t)
 	defer helper.cleanup()
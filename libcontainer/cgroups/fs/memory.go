@@ -36,23 +36,23 @@ func (s *MemoryGroup) Apply(path string, d *cgroupData) (err error) {
 	return join(path, d.pid)
 }
 
-func setMemory(path string, val int64) error {
+func setMemory(dir *fscommon.PinnedDir, val int64) error {
 	if val == 0 {
 		return nil
 	}
 
-	err := fscommon.WriteFile(path, cgroupMemoryLimit, strconv.FormatInt(val, 10))
+	err := dir.WriteFile(cgroupMemoryLimit, strconv.FormatInt(val, 10))
 	if !errors.Is(err, unix.EBUSY) {
 		return err
 	}
 
 	// EBUSY means the kernel can't set new limit as it's too low
 	// (lower than the current usage). Return more specific error.
-	usage, err := fscommon.GetCgroupParamUint(path, cgroupMemoryUsage)
+	usage, err := dir.GetCgroupParamUint(cgroupMemoryUsage)
 	if err != nil {
 		return err
 	}
-	max, err := fscommon.GetCgroupParamUint(path, cgroupMemoryMaxUsage)
+	max, err := dir.GetCgroupParamUint(cgroupMemoryMaxUsage)
 	if err != nil {
 		return err
 	}
@@ -60,20 +60,20 @@ func setMemory(path string, val int64) error {
 	return errors.Errorf("unable to set memory limit to %d (current usage: %d, peak usage: %d)", val, usage, max)
 }
 
-func setSwap(path string, val int64) error {
+func setSwap(dir *fscommon.PinnedDir, val int64) error {
 	if val == 0 {
 		return nil
 	}
 
-	return fscommon.WriteFile(path, cgroupMemorySwapLimit, strconv.FormatInt(val, 10))
+	return dir.WriteFile(cgroupMemorySwapLimit, strconv.FormatInt(val, 10))
 }
 
-func setMemoryAndSwap(path string, r *configs.Resources) error {
+func setMemoryAndSwap(dir *fscommon.PinnedDir, r *configs.Resources) error {
 	// If the memory update is set to -1 and the swap is not explicitly
 	// set, we should also set swap to -1, it means unlimited memory.
 	if r.Memory == -1 && r.MemorySwap == 0 {
 		// Only set swap if it's enabled in kernel
-		if cgroups.PathExists(filepath.Join(path, cgroupMemorySwapLimit)) {
+		if cgroups.PathExists(filepath.Join(dir.Path(), cgroupMemorySwapLimit)) {
 			r.MemorySwap = -1
 		}
 	}
@@ -81,7 +81,7 @@ func setMemoryAndSwap(path string, r *configs.Resources) error {
 	// When memory and swap memory are both set, we need to handle the cases
 	// for updating container.
 	if r.Memory != 0 && r.MemorySwap != 0 {
-		curLimit, err := fscommon.GetCgroupParamUint(path, cgroupMemoryLimit)
+		curLimit, err := dir.GetCgroupParamUint(cgroupMemoryLimit)
 		if err != nil {
 			return err
 		}
@@ -90,20 +90,20 @@ func setMemoryAndSwap(path string, r *configs.Resources) error {
 		// for memory and swap memory, so it won't fail because the new
 		// value and the old value don't fit kernel's validation.
 		if r.MemorySwap == -1 || curLimit < uint64(r.MemorySwap) {
-			if err := setSwap(path, r.MemorySwap); err != nil {
+			if err := setSwap(dir, r.MemorySwap); err != nil {
 				return err
 			}
-			if err := setMemory(path, r.Memory); err != nil {
+			if err := setMemory(dir, r.Memory); err != nil {
 				return err
 			}
 			return nil
 		}
 	}
 
-	if err := setMemory(path, r.Memory); err != nil {
+	if err := setMemory(dir, r.Memory); err != nil {
 		return err
 	}
-	if err := setSwap(path, r.MemorySwap); err != nil {
+	if err := setSwap(dir, r.MemorySwap); err != nil {
 		return err
 	}
 
@@ -111,27 +111,33 @@ func setMemoryAndSwap(path string, r *configs.Resources) error {
 }
 
 func (s *MemoryGroup) Set(path string, r *configs.Resources) error {
-	if err := setMemoryAndSwap(path, r); err != nil {
+	dir := fscommon.PinDir(path)
+	defer dir.Close()
+	return s.SetPinned(dir, r)
+}
+
+func (s *MemoryGroup) SetPinned(dir *fscommon.PinnedDir, r *configs.Resources) error {
+	if err := setMemoryAndSwap(dir, r); err != nil {
 		return err
 	}
 
 	// ignore KernelMemory and KernelMemoryTCP
 
 	if r.MemoryReservation != 0 {
-		if err := fscommon.WriteFile(path, "memory.soft_limit_in_bytes", strconv.FormatInt(r.MemoryReservation, 10)); err != nil {
+		if err := dir.WriteFile("memory.soft_limit_in_bytes", strconv.FormatInt(r.MemoryReservation, 10)); err != nil {
 			return err
 		}
 	}
 
 	if r.OomKillDisable {
-		if err := fscommon.WriteFile(path, "memory.oom_control", "1"); err != nil {
+		if err := dir.WriteFile("memory.oom_control", "1"); err != nil {
 			return err
 		}
 	}
 	if r.MemorySwappiness == nil || int64(*r.MemorySwappiness) == -1 {
 		return nil
 	} else if *r.MemorySwappiness <= 100 {
-		if err := fscommon.WriteFile(path, "memory.swappiness", strconv.FormatUint(*r.MemorySwappiness, 10)); err != nil {
+		if err := dir.WriteFile("memory.swappiness", strconv.FormatUint(*r.MemorySwappiness, 10)); err != nil {
 			return err
 		}
 	} else {
@@ -142,8 +148,14 @@ func (s *MemoryGroup) Set(path string, r *configs.Resources) error {
 }
 
 func (s *MemoryGroup) GetStats(path string, stats *cgroups.Stats) error {
+	dir := fscommon.PinDir(path)
+	defer dir.Close()
+	return s.GetStatsPinned(dir, stats)
+}
+
+func (s *MemoryGroup) GetStatsPinned(dir *fscommon.PinnedDir, stats *cgroups.Stats) error {
 	// Set stats from memory.stat.
-	statsFile, err := fscommon.OpenFile(path, "memory.stat", os.O_RDONLY)
+	statsFile, err := dir.OpenFile("memory.stat", os.O_RDONLY)
 	if err != nil {
 		if os.IsNotExist(err) {
 			return nil
@@ -162,28 +174,37 @@ func (s *MemoryGroup) GetStats(path string, stats *cgroups.Stats) error {
 	}
 	stats.MemoryStats.Cache = stats.MemoryStats.Stats["cache"]
 
-	memoryUsage, err := getMemoryData(path, "")
+	memoryUsage, err := getMemoryData(dir, "")
 	if err != nil {
 		return err
 	}
 	stats.MemoryStats.Usage = memoryUsage
-	swapUsage, err := getMemoryData(path, "memsw")
+	// memory.oom_control has oom_kill since kernel 4.13.
+	oomKill, err := dir.GetValueByKey("memory.oom_control", "oom_kill")
+	if err != nil {
+		return err
+	}
+	stats.MemoryStats.Events = &cgroups.MemoryEvents{
+		Max:     memoryUsage.Failcnt,
+		OomKill: oomKill,
+	}
+	swapUsage, err := getMemoryData(dir, "memsw")
 	if err != nil {
 		return err
 	}
 	stats.MemoryStats.SwapUsage = swapUsage
-	kernelUsage, err := getMemoryData(path, "kmem")
+	kernelUsage, err := getMemoryData(dir, "kmem")
 	if err != nil {
 		return err
 	}
 	stats.MemoryStats.KernelUsage = kernelUsage
-	kernelTCPUsage, err := getMemoryData(path, "kmem.tcp")
+	kernelTCPUsage, err := getMemoryData(dir, "kmem.tcp")
 	if err != nil {
 		return err
 	}
 	stats.MemoryStats.KernelTCPUsage = kernelTCPUsage
 
-	value, err := fscommon.GetCgroupParamUint(path, "memory.use_hierarchy")
+	value, err := dir.GetCgroupParamUint("memory.use_hierarchy")
 	if err != nil {
 		return err
 	}
@@ -191,7 +212,7 @@ func (s *MemoryGroup) GetStats(path string, stats *cgroups.Stats) error {
 		stats.MemoryStats.UseHierarchy = true
 	}
 
-	pagesByNUMA, err := getPageUsageByNUMA(path)
+	pagesByNUMA, err := getPageUsageByNUMA(dir)
 	if err != nil {
 		return err
 	}
@@ -200,7 +221,7 @@ func (s *MemoryGroup) GetStats(path string, stats *cgroups.Stats) error {
 	return nil
 }
 
-func getMemoryData(path, name string) (cgroups.MemoryData, error) {
+func getMemoryData(dir *fscommon.PinnedDir, name string) (cgroups.MemoryData, error) {
 	memoryData := cgroups.MemoryData{}
 
 	moduleName := "memory"
@@ -214,7 +235,7 @@ func getMemoryData(path, name string) (cgroups.MemoryData, error) {
 		limit    = moduleName + ".limit_in_bytes"
 	)
 
-	value, err := fscommon.GetCgroupParamUint(path, usage)
+	value, err := dir.GetCgroupParamUint(usage)
 	if err != nil {
 		if name != "" && os.IsNotExist(err) {
 			// Ignore ENOENT as swap and kmem controllers
@@ -224,17 +245,17 @@ func getMemoryData(path, name string) (cgroups.MemoryData, error) {
 		return cgroups.MemoryData{}, fmt.Errorf("failed to parse %s - %v", usage, err)
 	}
 	memoryData.Usage = value
-	value, err = fscommon.GetCgroupParamUint(path, maxUsage)
+	value, err = dir.GetCgroupParamUint(maxUsage)
 	if err != nil {
 		return cgroups.MemoryData{}, fmt.Errorf("failed to parse %s - %v", maxUsage, err)
 	}
 	memoryData.MaxUsage = value
-	value, err = fscommon.GetCgroupParamUint(path, failcnt)
+	value, err = dir.GetCgroupParamUint(failcnt)
 	if err != nil {
 		return cgroups.MemoryData{}, fmt.Errorf("failed to parse %s - %v", failcnt, err)
 	}
 	memoryData.Failcnt = value
-	value, err = fscommon.GetCgroupParamUint(path, limit)
+	value, err = dir.GetCgroupParamUint(limit)
 	if err != nil {
 		return cgroups.MemoryData{}, fmt.Errorf("failed to parse %s - %v", limit, err)
 	}
@@ -243,14 +264,14 @@ func getMemoryData(path, name string) (cgroups.MemoryData, error) {
 	return memoryData, nil
 }
 
-func getPageUsageByNUMA(cgroupPath string) (cgroups.PageUsageByNUMA, error) {
+func getPageUsageByNUMA(dir *fscommon.PinnedDir) (cgroups.PageUsageByNUMA, error) {
 	const (
 		maxColumns = math.MaxUint8 + 1
 		filename   = "memory.numa_stat"
 	)
 	stats := cgroups.PageUsageByNUMA{}
 
-	file, err := fscommon.OpenFile(cgroupPath, filename, os.O_RDONLY)
+	file, err := dir.OpenFile(filename, os.O_RDONLY)
 	if os.IsNotExist(err) {
 		return stats, nil
 	} else if err != nil {
@@ -235,6 +235,7 @@ func TestMemoryStats(t *testing.T) {
 		"memory.kmem.limit_in_bytes":      memoryLimitContents,
 		"memory.use_hierarchy":            memoryUseHierarchyContents,
 		"memory.numa_stat":                memoryNUMAStatContents + memoryNUMAStatExtraContents,
+		"memory.oom_control":              "oom_kill_disable 0\nunder_oom 0\noom_kill 3\n",
 	})
 
 	memory := &MemoryGroup{}
@@ -244,6 +245,7 @@ func TestMemoryStats(t *testing.T) {
 		t.Fatal(err)
 	}
 	expectedStats := cgroups.MemoryStats{Cache: 512, Usage: cgroups.MemoryData{Usage: 2048, MaxUsage: 4096, Failcnt: 100, Limit: 8192}, SwapUsage: cgroups.MemoryData{Usage: 2048, MaxUsage: 4096, Failcnt: 100, Limit: 8192}, KernelUsage: cgroups.MemoryData{Usage: 2048, MaxUsage: 4096, Failcnt: 100, Limit: 8192}, Stats: map[string]uint64{"cache": 512, "rss": 1024}, UseHierarchy: true,
+		Events: &cgroups.MemoryEvents{Max: 100, OomKill: 3},
 		PageUsageByNUMA: cgroups.PageUsageByNUMA{
 			PageUsageByNUMAInner: cgroups.PageUsageByNUMAInner{
 				Total:       cgroups.PageStats{Total: 44611, Nodes: map[uint8]uint64{0: 32631, 1: 7501, 2: 1982, 3: 2497}},
@@ -435,7 +437,9 @@ func TestNoHierarchicalNumaStat(t *testing.T) {
 		"memory.numa_stat": memoryNUMAStatNoHierarchyContents + memoryNUMAStatExtraContents,
 	})
 
-	actualStats, err := getPageUsageByNUMA(helper.CgroupPath)
+	dir := fscommon.PinDir(helper.CgroupPath)
+	defer dir.Close()
+	actualStats, err := getPageUsageByNUMA(dir)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -482,12 +486,14 @@ anon=183 N0=12 badone
 	}
 	helper := NewCgroupTestUtil("memory", t)
 	defer helper.cleanup()
+	dir := fscommon.PinDir(helper.CgroupPath)
+	defer dir.Close()
 	for _, c := range memoryNUMAStatBadContents {
 		helper.writeFileContents(map[string]string{
 			"memory.numa_stat": c.contents,
 		})
 
-		_, err := getPageUsageByNUMA(helper.CgroupPath)
+		_, err := getPageUsageByNUMA(dir)
 		if err == nil {
 			t.Errorf("case %q: expected error, got nil", c.desc)
 		}
@@ -498,7 +504,9 @@ func TestWithoutNumaStat(t *testing.T) {
 	helper := NewCgroupTestUtil("memory", t)
 	defer helper.cleanup()
 
-	actualStats, err := getPageUsageByNUMA(helper.CgroupPath)
+	dir := fscommon.PinDir(helper.CgroupPath)
+	defer dir.Close()
+	actualStats, err := getPageUsageByNUMA(dir)
 	if err != nil {
 		t.Fatal(err)
 	}
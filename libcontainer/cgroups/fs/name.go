@@ -4,6 +4,7 @@ package fs
 
 import (
 	"github.com/opencontainers/runc/libcontainer/cgroups"
+	"github.com/opencontainers/runc/libcontainer/cgroups/fscommon"
 	"github.com/opencontainers/runc/libcontainer/configs"
 )
 
@@ -28,6 +29,14 @@ func (s *NameGroup) Set(_ string, _ *configs.Resources) error {
 	return nil
 }
 
+func (s *NameGroup) SetPinned(_ *fscommon.PinnedDir, _ *configs.Resources) error {
+	return nil
+}
+
 func (s *NameGroup) GetStats(path string, stats *cgroups.Stats) error {
 	return nil
 }
+
+func (s *NameGroup) GetStatsPinned(dir *fscommon.PinnedDir, stats *cgroups.Stats) error {
+	return nil
+}
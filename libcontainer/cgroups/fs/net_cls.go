@@ -22,8 +22,14 @@ func (s *NetClsGroup) Apply(path string, d *cgroupData) error {
 }
 
 func (s *NetClsGroup) Set(path string, r *configs.Resources) error {
+	dir := fscommon.PinDir(path)
+	defer dir.Close()
+	return s.SetPinned(dir, r)
+}
+
+func (s *NetClsGroup) SetPinned(dir *fscommon.PinnedDir, r *configs.Resources) error {
 	if r.NetClsClassid != 0 {
-		if err := fscommon.WriteFile(path, "net_cls.classid", strconv.FormatUint(uint64(r.NetClsClassid), 10)); err != nil {
+		if err := dir.WriteFile("net_cls.classid", strconv.FormatUint(uint64(r.NetClsClassid), 10)); err != nil {
 			return err
 		}
 	}
@@ -34,3 +40,7 @@ func (s *NetClsGroup) Set(path string, r *configs.Resources) error {
 func (s *NetClsGroup) GetStats(path string, stats *cgroups.Stats) error {
 	return nil
 }
+
+func (s *NetClsGroup) GetStatsPinned(dir *fscommon.PinnedDir, stats *cgroups.Stats) error {
+	return nil
+}
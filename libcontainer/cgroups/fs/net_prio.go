@@ -20,15 +20,24 @@ func (s *NetPrioGroup) Apply(path string, d *cgroupData) error {
 }
 
 func (s *NetPrioGroup) Set(path string, r *configs.Resources) error {
+	dir := fscommon.PinDir(path)
+	defer dir.Close()
+	return s.SetPinned(dir, r)
+}
+
+func (s *NetPrioGroup) SetPinned(dir *fscommon.PinnedDir, r *configs.Resources) error {
+	prioMaps := make([]string, 0, len(r.NetPrioIfpriomap))
 	for _, prioMap := range r.NetPrioIfpriomap {
-		if err := fscommon.WriteFile(path, "net_prio.ifpriomap", prioMap.CgroupString()); err != nil {
-			return err
-		}
+		prioMaps = append(prioMaps, prioMap.CgroupString())
 	}
 
-	return nil
+	return dir.WriteFileBatch("net_prio.ifpriomap", prioMaps)
 }
 
 func (s *NetPrioGroup) GetStats(path string, stats *cgroups.Stats) error {
 	return nil
 }
+
+func (s *NetPrioGroup) GetStatsPinned(dir *fscommon.PinnedDir, stats *cgroups.Stats) error {
+	return nil
+}
@@ -4,6 +4,7 @@ package fs
 
 import (
 	"github.com/opencontainers/runc/libcontainer/cgroups"
+	"github.com/opencontainers/runc/libcontainer/cgroups/fscommon"
 	"github.com/opencontainers/runc/libcontainer/configs"
 )
 
@@ -22,6 +23,14 @@ func (s *PerfEventGroup) Set(_ string, _ *configs.Resources) error {
 	return nil
 }
 
+func (s *PerfEventGroup) SetPinned(_ *fscommon.PinnedDir, _ *configs.Resources) error {
+	return nil
+}
+
 func (s *PerfEventGroup) GetStats(path string, stats *cgroups.Stats) error {
 	return nil
 }
+
+func (s *PerfEventGroup) GetStatsPinned(dir *fscommon.PinnedDir, stats *cgroups.Stats) error {
+	return nil
+}
@@ -24,6 +24,12 @@ func (s *PidsGroup) Apply(path string, d *cgroupData) error {
 }
 
 func (s *PidsGroup) Set(path string, r *configs.Resources) error {
+	dir := fscommon.PinDir(path)
+	defer dir.Close()
+	return s.SetPinned(dir, r)
+}
+
+func (s *PidsGroup) SetPinned(dir *fscommon.PinnedDir, r *configs.Resources) error {
 	if r.PidsLimit != 0 {
 		// "max" is the fallback value.
 		limit := "max"
@@ -32,7 +38,7 @@ func (s *PidsGroup) Set(path string, r *configs.Resources) error {
 			limit = strconv.FormatInt(r.PidsLimit, 10)
 		}
 
-		if err := fscommon.WriteFile(path, "pids.max", limit); err != nil {
+		if err := dir.WriteFile("pids.max", limit); err != nil {
 			return err
 		}
 	}
@@ -41,15 +47,21 @@ func (s *PidsGroup) Set(path string, r *configs.Resources) error {
 }
 
 func (s *PidsGroup) GetStats(path string, stats *cgroups.Stats) error {
-	if !cgroups.PathExists(path) {
+	dir := fscommon.PinDir(path)
+	defer dir.Close()
+	return s.GetStatsPinned(dir, stats)
+}
+
+func (s *PidsGroup) GetStatsPinned(dir *fscommon.PinnedDir, stats *cgroups.Stats) error {
+	if !cgroups.PathExists(dir.Path()) {
 		return nil
 	}
-	current, err := fscommon.GetCgroupParamUint(path, "pids.current")
+	current, err := dir.GetCgroupParamUint("pids.current")
 	if err != nil {
 		return fmt.Errorf("failed to parse pids.current - %s", err)
 	}
 
-	maxString, err := fscommon.GetCgroupParamString(path, "pids.max")
+	maxString, err := dir.GetCgroupParamString("pids.max")
 	if err != nil {
 		return fmt.Errorf("failed to parse pids.max - %s", err)
 	}
@@ -59,7 +71,7 @@ func (s *PidsGroup) GetStats(path string, stats *cgroups.Stats) error {
 	if maxString != "max" {
 		max, err = fscommon.ParseUint(maxString, 10, 64)
 		if err != nil {
-			return fmt.Errorf("failed to parse pids.max - unable to parse %q as a uint from Cgroup file %q", maxString, filepath.Join(path, "pids.max"))
+			return fmt.Errorf("failed to parse pids.max - unable to parse %q as a uint from Cgroup file %q", maxString, filepath.Join(dir.Path(), "pids.max"))
 		}
 	}
 
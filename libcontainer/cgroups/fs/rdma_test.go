@@ -0,0 +1,64 @@
+// +build linux
+
+package fs
+
+import (
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/opencontainers/runc/libcontainer/cgroups"
+	"github.com/opencontainers/runc/libcontainer/cgroups/fscommon"
+	"github.com/opencontainers/runc/libcontainer/configs"
+)
+
+func TestRdmaSet(t *testing.T) {
+	helper := NewCgroupTestUtil("rdma", t)
+	defer helper.cleanup()
+
+	handles := uint32(100)
+	helper.CgroupData.config.Resources.Rdma = map[string]configs.LinuxRdma{
+		"mlx5_1": {HcaHandles: &handles},
+	}
+	rdma := &RdmaGroup{}
+	if err := rdma.Set(helper.CgroupPath, helper.CgroupData.config.Resources); err != nil {
+		t.Fatal(err)
+	}
+
+	value, err := fscommon.GetCgroupParamString(helper.CgroupPath, "rdma.max")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value != "mlx5_1 hca_handle=100" {
+		t.Fatalf("Got the wrong value %q, set rdma.max failed.", value)
+	}
+}
+
+func TestRdmaStats(t *testing.T) {
+	helper := NewCgroupTestUtil("rdma", t)
+	defer helper.cleanup()
+
+	helper.writeFileContents(map[string]string{
+		"rdma.max":     "mlx4_0 hca_handle=2 hca_object=max\nocrdma1 hca_handle=3 hca_object=max\n",
+		"rdma.current": "mlx4_0 hca_handle=1 hca_object=20\nocrdma1 hca_handle=1 hca_object=23\n",
+	})
+
+	rdma := &RdmaGroup{}
+	actualStats := *cgroups.NewStats()
+	if err := rdma.GetStats(helper.CgroupPath, &actualStats); err != nil {
+		t.Fatal(err)
+	}
+	expected := cgroups.RdmaStats{
+		RdmaLimit: []cgroups.RdmaEntry{
+			{Device: "mlx4_0", HcaHandles: 2, HcaObjects: math.MaxUint32},
+			{Device: "ocrdma1", HcaHandles: 3, HcaObjects: math.MaxUint32},
+		},
+		RdmaCurrent: []cgroups.RdmaEntry{
+			{Device: "mlx4_0", HcaHandles: 1, HcaObjects: 20},
+			{Device: "ocrdma1", HcaHandles: 1, HcaObjects: 23},
+		},
+	}
+	if !reflect.DeepEqual(actualStats.RdmaStats, expected) {
+		t.Fatalf("Expected %+v, got %+v", expected, actualStats.RdmaStats)
+	}
+}
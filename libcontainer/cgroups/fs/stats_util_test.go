@@ -79,6 +79,9 @@ func expectMemoryStatEquals(t *testing.T, expected, actual cgroups.MemoryStats)
 	if expected.UseHierarchy != actual.UseHierarchy {
 		t.Errorf("Expected memory use hierarchy %v, but found %v\n", expected.UseHierarchy, actual.UseHierarchy)
 	}
+	if !reflect.DeepEqual(expected.Events, actual.Events) {
+		t.Errorf("Expected memory events %+v, but found %+v\n", expected.Events, actual.Events)
+	}
 
 	for key, expValue := range expected.Stats {
 		actValue, ok := actual.Stats[key]
@@ -13,42 +13,53 @@ import (
 )
 
 func isCpuSet(r *configs.Resources) bool {
-	return r.CpuWeight != 0 || r.CpuQuota != 0 || r.CpuPeriod != 0
+	return r.CpuWeight != 0 || r.CpuQuota != 0 || r.CpuPeriod != 0 || r.CpuBurst != nil || r.CPUIdle != nil
 }
 
-func setCpu(dirPath string, r *configs.Resources) error {
+func setCpu(dir *fscommon.PinnedDir, r *configs.Resources) error {
 	if !isCpuSet(r) {
 		return nil
 	}
 
 	// NOTE: .CpuShares is not used here. Conversion is the caller's responsibility.
 	if r.CpuWeight != 0 {
-		if err := fscommon.WriteFile(dirPath, "cpu.weight", strconv.FormatUint(r.CpuWeight, 10)); err != nil {
+		if err := dir.WriteFile("cpu.weight", strconv.FormatUint(r.CpuWeight, 10)); err != nil {
 			return err
 		}
 	}
 
-	if r.CpuQuota != 0 || r.CpuPeriod != 0 {
-		str := "max"
-		if r.CpuQuota > 0 {
-			str = strconv.FormatInt(r.CpuQuota, 10)
-		}
-		period := r.CpuPeriod
-		if period == 0 {
-			// This default value is documented in
-			// https://www.kernel.org/doc/html/latest/admin-guide/cgroup-v2.html
-			period = 100000
-		}
-		str += " " + strconv.FormatUint(period, 10)
-		if err := fscommon.WriteFile(dirPath, "cpu.max", str); err != nil {
+	// While cpu.idle is 1, cpu.weight is ignored by the kernel (and the
+	// weight is reported as the minimum), so it is written afterwards.
+	if r.CPUIdle != nil {
+		if err := dir.WriteFile("cpu.idle", strconv.FormatInt(*r.CPUIdle, 10)); err != nil {
 			return err
 		}
 	}
 
-	return nil
+	var setQuota func() error
+	if r.CpuQuota != 0 || r.CpuPeriod != 0 {
+		setQuota = func() error {
+			str := "max"
+			if r.CpuQuota > 0 {
+				str = strconv.FormatInt(r.CpuQuota, 10)
+			}
+			period := r.CpuPeriod
+			if period == 0 {
+				// This default value is documented in
+				// https://www.kernel.org/doc/html/latest/admin-guide/cgroup-v2.html
+				period = 100000
+			}
+			str += " " + strconv.FormatUint(period, 10)
+			return dir.WriteFile("cpu.max", str)
+		}
+	}
+	return fscommon.SetCPUQuotaAndBurst(r.CpuBurst, setQuota, func(burst string) error {
+		return dir.WriteFile("cpu.max.burst", burst)
+	})
 }
-func statCpu(dirPath string, stats *cgroups.Stats) error {
-	f, err := fscommon.OpenFile(dirPath, "cpu.stat", os.O_RDONLY)
+
+func statCpu(dir *fscommon.PinnedDir, stats *cgroups.Stats) error {
+	f, err := dir.OpenFile("cpu.stat", os.O_RDONLY)
 	if err != nil {
 		return err
 	}
@@ -78,6 +89,12 @@ func statCpu(dirPath string, stats *cgroups.Stats) error {
 
 		case "throttled_usec":
 			stats.CpuStats.ThrottlingData.ThrottledTime = v * 1000
+
+		case "nr_bursts":
+			stats.CpuStats.BurstData.BurstsPeriods = v
+
+		case "burst_usec":
+			stats.CpuStats.BurstData.BurstTime = v * 1000
 		}
 	}
 	return nil
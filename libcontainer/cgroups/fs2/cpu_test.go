@@ -0,0 +1,41 @@
+// +build linux
+
+package fs2
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/opencontainers/runc/libcontainer/cgroups/fscommon"
+	"github.com/opencontainers/runc/libcontainer/configs"
+)
+
+func TestSetCpuIdle(t *testing.T) {
+	fakeCgroupDir, err := ioutil.TempDir("", "runc-cpu-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(fakeCgroupDir)
+
+	idle := int64(1)
+	r := &configs.Resources{CpuWeight: 100, CPUIdle: &idle}
+	dir := fscommon.PinDir(fakeCgroupDir)
+	defer dir.Close()
+	if err := setCpu(dir, r); err != nil {
+		t.Fatal(err)
+	}
+	for file, expected := range map[string]string{
+		"cpu.weight": "100",
+		"cpu.idle":   "1",
+	} {
+		data, err := ioutil.ReadFile(filepath.Join(fakeCgroupDir, file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != expected {
+			t.Errorf("expected %s to be %q, got %q", file, expected, data)
+		}
+	}
+}
@@ -3,28 +3,124 @@
 package fs2
 
 import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/opencontainers/runc/libcontainer/cgroups"
 	"github.com/opencontainers/runc/libcontainer/cgroups/fscommon"
 	"github.com/opencontainers/runc/libcontainer/configs"
 )
 
 func isCpusetSet(r *configs.Resources) bool {
-	return r.CpusetCpus != "" || r.CpusetMems != ""
+	return r.CpusetCpus != "" || r.CpusetMems != "" || r.CpusetPartition != ""
 }
 
-func setCpuset(dirPath string, r *configs.Resources) error {
+func setCpuset(dir *fscommon.PinnedDir, r *configs.Resources) error {
 	if !isCpusetSet(r) {
 		return nil
 	}
 
+	// The CPUs and memory nodes are checked against the effective ones of
+	// the parent, as the kernel either fails with a bare EINVAL or silently
+	// ignores the unavailable ones.
+	parent := filepath.Dir(dir.Path())
 	if r.CpusetCpus != "" {
-		if err := fscommon.WriteFile(dirPath, "cpuset.cpus", r.CpusetCpus); err != nil {
+		// The CPUs of a partition root are taken away from the effective
+		// ones of its parent, so they are checked against the configured
+		// ones instead.
+		cpusFile := "cpuset.cpus.effective"
+		if state, err := dir.GetCgroupParamString("cpuset.cpus.partition"); err == nil && isValidPartitionRoot(state) {
+			cpusFile = "cpuset.cpus"
+		}
+		if err := cgroups.CheckCPUSetFile(parent, cpusFile, "CPUs", r.CpusetCpus); err != nil {
+			return err
+		}
+		if err := dir.WriteFile("cpuset.cpus", r.CpusetCpus); err != nil {
 			return err
 		}
 	}
 	if r.CpusetMems != "" {
-		if err := fscommon.WriteFile(dirPath, "cpuset.mems", r.CpusetMems); err != nil {
+		if err := cgroups.CheckCPUSetFile(parent, "cpuset.mems.effective", "memory nodes", r.CpusetMems); err != nil {
 			return err
 		}
+		if err := dir.WriteFile("cpuset.mems", r.CpusetMems); err != nil {
+			return err
+		}
+	}
+	if r.CpusetPartition != "" {
+		if err := setCpusetPartition(dir, r.CpusetPartition); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setCpusetPartition sets the cpuset partition type of the cgroup dirPath.
+// As the kernel accepts invalid partitions, reporting them as such in
+// cpuset.cpus.partition, the resulting state is checked afterwards.
+func setCpusetPartition(dir *fscommon.PinnedDir, partition string) error {
+	if partition != "member" {
+		// A partition root must be a child of a partition root, which the
+		// root cgroup always is.
+		if parent := filepath.Dir(dir.Path()); parent != UnifiedMountpoint {
+			state, err := fscommon.GetCgroupParamString(parent, "cpuset.cpus.partition")
+			if err != nil {
+				return err
+			}
+			if !isValidPartitionRoot(state) {
+				return fmt.Errorf("unable to make %s a cpuset partition: its parent is not a valid partition root (%s)", dir.Path(), state)
+			}
+		}
+	}
+	if err := dir.WriteFile("cpuset.cpus.partition", partition); err != nil {
+		return err
+	}
+	state, err := dir.GetCgroupParamString("cpuset.cpus.partition")
+	if err != nil {
+		return err
+	}
+	if strings.Contains(state, "invalid") {
+		return fmt.Errorf("cpuset partition of %s is invalid: %s", dir.Path(), state)
+	}
+	return nil
+}
+
+func isValidPartitionRoot(state string) bool {
+	return state == "root" || state == "isolated"
+}
+
+func statCpuset(dir *fscommon.PinnedDir, stats *cgroups.Stats) error {
+	for _, f := range []struct {
+		name  string
+		value *[]uint16
+	}{
+		{"cpuset.cpus", &stats.CPUSetStats.CPUs},
+		{"cpuset.mems", &stats.CPUSetStats.Mems},
+		{"cpuset.cpus.effective", &stats.CPUSetStats.EffectiveCPUs},
+		{"cpuset.mems.effective", &stats.CPUSetStats.EffectiveMems},
+	} {
+		list, err := dir.ReadFile(f.name)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return err
+		}
+		if *f.value, err = cgroups.ParseCPUSetList(list); err != nil {
+			return fmt.Errorf("invalid values in %s: %w", filepath.Join(dir.Path(), f.name), err)
+		}
+	}
+
+	// cpuset.cpus.partition is available since kernel 5.11.
+	partition, err := dir.GetCgroupParamString("cpuset.cpus.partition")
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
 	}
+	stats.CPUSetStats.Partition = partition
 	return nil
 }
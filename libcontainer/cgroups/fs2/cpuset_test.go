@@ -0,0 +1,147 @@
+// +build linux
+
+package fs2
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/opencontainers/runc/libcontainer/cgroups"
+	"github.com/opencontainers/runc/libcontainer/cgroups/fscommon"
+	"github.com/opencontainers/runc/libcontainer/configs"
+)
+
+func TestSetCpusetPartition(t *testing.T) {
+	parent, err := ioutil.TempDir("", "runc-cpuset-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(parent)
+	dir := filepath.Join(parent, "child")
+	if err := os.Mkdir(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	writeParent := func(state string) {
+		if err := ioutil.WriteFile(filepath.Join(parent, "cpuset.cpus.partition"), []byte(state+"\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	writeParent("member")
+	cgdir := fscommon.PinDir(dir)
+	defer cgdir.Close()
+	if err := setCpusetPartition(cgdir, "isolated"); err == nil {
+		t.Error("expected an error for a partition root with a member parent")
+	}
+	// Members can be anywhere.
+	if err := setCpusetPartition(cgdir, "member"); err != nil {
+		t.Fatal(err)
+	}
+
+	writeParent("root")
+	if err := setCpusetPartition(cgdir, "isolated"); err != nil {
+		t.Fatal(err)
+	}
+	var stats cgroups.Stats
+	if err := statCpuset(cgdir, &stats); err != nil {
+		t.Fatal(err)
+	}
+	if stats.CPUSetStats.Partition != "isolated" {
+		t.Errorf("expected partition %q, got %q", "isolated", stats.CPUSetStats.Partition)
+	}
+
+	// The kernel reports a partition it could not set up as invalid.
+	writeParent("root invalid (cpu list is empty)")
+	if err := setCpusetPartition(cgdir, "root"); err == nil {
+		t.Error("expected an error for an invalid parent partition")
+	}
+}
+
+func TestSetCpusetEffective(t *testing.T) {
+	parent, err := ioutil.TempDir("", "runc-cpuset-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(parent)
+	dir := filepath.Join(parent, "child")
+	if err := os.Mkdir(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for file, contents := range map[string]string{
+		"cpuset.cpus.effective": "0-3\n",
+		"cpuset.mems.effective": "0\n",
+	} {
+		if err := ioutil.WriteFile(filepath.Join(parent, file), []byte(contents), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cgdir := fscommon.PinDir(dir)
+	defer cgdir.Close()
+	if err := setCpuset(cgdir, &configs.Resources{CpusetCpus: "4"}); err == nil {
+		t.Error("expected an error for unavailable CPUs")
+	}
+	if err := setCpuset(cgdir, &configs.Resources{CpusetMems: "0-1"}); err == nil {
+		t.Error("expected an error for unavailable memory nodes")
+	}
+	if err := setCpuset(cgdir, &configs.Resources{CpusetCpus: "1-2", CpusetMems: "0"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// The kernel restricts the effective CPUs to the requested ones.
+	if err := ioutil.WriteFile(filepath.Join(dir, "cpuset.cpus.effective"), []byte("1-2\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	var stats cgroups.Stats
+	if err := statCpuset(cgdir, &stats); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(stats.CPUSetStats.CPUs, []uint16{1, 2}) {
+		t.Errorf("expected CPUs [1 2], got %v", stats.CPUSetStats.CPUs)
+	}
+	if !reflect.DeepEqual(stats.CPUSetStats.EffectiveCPUs, []uint16{1, 2}) {
+		t.Errorf("expected effective CPUs [1 2], got %v", stats.CPUSetStats.EffectiveCPUs)
+	}
+	if !reflect.DeepEqual(stats.CPUSetStats.Mems, []uint16{0}) {
+		t.Errorf("expected memory nodes [0], got %v", stats.CPUSetStats.Mems)
+	}
+	if stats.CPUSetStats.EffectiveMems != nil {
+		t.Errorf("expected no effective memory nodes, got %v", stats.CPUSetStats.EffectiveMems)
+	}
+}
+
+func TestSetCpusetPartitionRootCpus(t *testing.T) {
+	parent, err := ioutil.TempDir("", "runc-cpuset-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(parent)
+	dir := filepath.Join(parent, "child")
+	if err := os.Mkdir(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	// The CPUs of the partition root of the child are no longer effective
+	// in the parent.
+	for file, contents := range map[string]string{
+		filepath.Join(parent, "cpuset.cpus"):           "0-3\n",
+		filepath.Join(parent, "cpuset.cpus.effective"): "0-1\n",
+		filepath.Join(dir, "cpuset.cpus.partition"):    "root\n",
+	} {
+		if err := ioutil.WriteFile(file, []byte(contents), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cgdir := fscommon.PinDir(dir)
+	defer cgdir.Close()
+	if err := setCpuset(cgdir, &configs.Resources{CpusetCpus: "2-3"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := setCpuset(cgdir, &configs.Resources{CpusetCpus: "4"}); err == nil {
+		t.Error("expected an error for unavailable CPUs")
+	}
+}
@@ -1,13 +1,16 @@
 package fs2
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
 
+	"github.com/opencontainers/runc/libcontainer/cgroups"
 	"github.com/opencontainers/runc/libcontainer/cgroups/fscommon"
 	"github.com/opencontainers/runc/libcontainer/configs"
+	"golang.org/x/sys/unix"
 )
 
 func supportedControllers() (string, error) {
@@ -39,23 +42,10 @@ func needAnyControllers(r *configs.Resources) (bool, error) {
 		return ok
 	}
 
-	if isPidsSet(r) && have("pids") {
-		return true, nil
-	}
-	if isMemorySet(r) && have("memory") {
-		return true, nil
-	}
-	if isIoSet(r) && have("io") {
-		return true, nil
-	}
-	if isCpuSet(r) && have("cpu") {
-		return true, nil
-	}
-	if isCpusetSet(r) && have("cpuset") {
-		return true, nil
-	}
-	if isHugeTlbSet(r) && have("hugetlb") {
-		return true, nil
+	for _, ctr := range cgroups.RequiredControllers(r) {
+		if have(ctr) {
+			return true, nil
+		}
 	}
 
 	return false, nil
@@ -65,7 +55,7 @@ func needAnyControllers(r *configs.Resources) (bool, error) {
 // Refer to: http://man7.org/linux/man-pages/man7/cgroups.7.html
 // As at Linux 4.19, the following controllers are threaded: cpu, perf_event, and pids.
 func containsDomainController(r *configs.Resources) bool {
-	return isMemorySet(r) || isIoSet(r) || isCpuSet(r) || isHugeTlbSet(r)
+	return isMemorySet(r) || isIoSet(r) || isCpuSet(r) || isHugeTlbSet(r) || isMiscSet(r)
 }
 
 // CreateCgroupPath creates cgroupv2 path, enabling all the supported controllers.
@@ -83,8 +73,13 @@ func CreateCgroupPath(path string, c *configs.Cgroup) (Err error) {
 		cgTypeFile  = "cgroup.type"
 		cgStCtlFile = "cgroup.subtree_control"
 	)
-	ctrs := strings.Fields(content)
-	res := "+" + strings.Join(ctrs, " +")
+	rootCtrs := strings.Fields(content)
+	// The first failure to enable each controller, to report it if the
+	// controller is required.
+	failed := make(map[string]error)
+
+	// The ancestors created for the container.
+	var created []string
 
 	elements := strings.Split(path, "/")
 	elements = elements[3:]
@@ -97,6 +92,9 @@ func CreateCgroupPath(path string, c *configs.Cgroup) (Err error) {
 					return err
 				}
 			} else {
+				if i < len(elements)-1 {
+					created = append(created, current)
+				}
 				// If the directory was created, be sure it is not left around on errors.
 				current := current
 				defer func() {
@@ -136,17 +134,90 @@ func CreateCgroupPath(path string, c *configs.Cgroup) (Err error) {
 		}
 		// enable all supported controllers
 		if i < len(elements)-1 {
-			if err := fscommon.WriteFile(current, cgStCtlFile, res); err != nil {
+			ctrs := rootCtrs
+			if avail, err := fscommon.ReadFile(current, "cgroup.controllers"); err == nil {
+				ctrs = strings.Fields(avail)
+			}
+			if len(ctrs) == 0 {
+				continue
+			}
+			if err := fscommon.WriteFile(current, cgStCtlFile, "+"+strings.Join(ctrs, " +")); err != nil {
 				// try write one by one
-				allCtrs := strings.Split(res, " ")
-				for _, ctr := range allCtrs {
-					_ = fscommon.WriteFile(current, cgStCtlFile, ctr)
+				for _, ctr := range ctrs {
+					if err := fscommon.WriteFile(current, cgStCtlFile, "+"+ctr); err != nil {
+						if _, ok := failed[ctr]; !ok {
+							failed[ctr] = &enableError{ctr: ctr, parent: current, err: err}
+						}
+					}
 				}
 			}
 			// Some controllers might not be enabled when rootless or containerized,
-			// but we don't catch the error here. (Caught in setXXX() functions.)
+			// which is only an error if they are required (checked below).
 		}
 	}
 
+	if err := checkControllers(path, c.Resources, failed); err != nil {
+		return err
+	}
+	if len(created) > 0 {
+		c.CreatedParents = created
+	}
 	return nil
 }
+
+// enableError is the error of a controller which can't be enabled in the
+// cgroup.subtree_control file of a parent cgroup.
+type enableError struct {
+	ctr    string
+	parent string
+	err    error
+}
+
+func (e *enableError) Error() string {
+	switch {
+	case errors.Is(e.err, unix.EBUSY):
+		return fmt.Sprintf("the %s controller can't be enabled in %s, as it has processes (a cgroup with processes can't delegate domain controllers to its children): move them into a child cgroup, or create the container cgroup elsewhere", e.ctr, e.parent)
+	case errors.Is(e.err, unix.EACCES), errors.Is(e.err, unix.EPERM), errors.Is(e.err, unix.EROFS):
+		return fmt.Sprintf("the %s controller can't be enabled in %s, as the cgroup.subtree_control file is not writable (the controller is not delegated)", e.ctr, e.parent)
+	case errors.Is(e.err, unix.EOPNOTSUPP):
+		return fmt.Sprintf("the %s controller can't be enabled in %s, as it is a threaded cgroup", e.ctr, e.parent)
+	}
+	return fmt.Sprintf("the %s controller can't be enabled in %s: %v", e.ctr, e.parent, e.err)
+}
+
+func (e *enableError) Unwrap() error {
+	return e.err
+}
+
+// checkControllers returns an error if the controllers required by the
+// resources are not available in the cgroup at path, explaining why with the
+// failures to enable them in its parents.
+func checkControllers(path string, r *configs.Resources, failed map[string]error) error {
+	required := cgroups.RequiredControllers(r)
+	if len(required) == 0 {
+		return nil
+	}
+	content, err := fscommon.ReadFile(path, "cgroup.controllers")
+	if err != nil {
+		return err
+	}
+	avail := make(map[string]struct{})
+	for _, ctr := range strings.Fields(content) {
+		avail[ctr] = struct{}{}
+	}
+	var reasons []string
+	for _, ctr := range required {
+		if _, ok := avail[ctr]; ok {
+			continue
+		}
+		if err, ok := failed[ctr]; ok {
+			reasons = append(reasons, err.Error())
+		} else {
+			reasons = append(reasons, fmt.Sprintf("the %s controller is not available in %s", ctr, UnifiedMountpoint))
+		}
+	}
+	if len(reasons) == 0 {
+		return nil
+	}
+	return fmt.Errorf("cgroup %s lacks controllers required by the resources: %s", path, strings.Join(reasons, "; "))
+}
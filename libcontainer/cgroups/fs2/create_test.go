@@ -0,0 +1,48 @@
+// +build linux
+
+package fs2
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/opencontainers/runc/libcontainer/configs"
+	"golang.org/x/sys/unix"
+)
+
+func TestCheckControllers(t *testing.T) {
+	fakeCgroupDir, err := ioutil.TempDir("", "runc-create-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(fakeCgroupDir)
+	if err := ioutil.WriteFile(filepath.Join(fakeCgroupDir, "cgroup.controllers"), []byte("cpu pids\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	r := &configs.Resources{PidsLimit: 10, CpuWeight: 100}
+	if err := checkControllers(fakeCgroupDir, r, nil); err != nil {
+		t.Fatalf("unexpected error with the controllers available: %v", err)
+	}
+
+	r.Memory = 1 << 20
+	r.CpusetCpus = "0"
+	failed := map[string]error{
+		"memory": &enableError{ctr: "memory", parent: "/sys/fs/cgroup/ci", err: &os.PathError{Op: "write", Path: "cgroup.subtree_control", Err: unix.EBUSY}},
+	}
+	err = checkControllers(fakeCgroupDir, r, failed)
+	if err == nil {
+		t.Fatal("expected an error with the memory and cpuset controllers missing")
+	}
+	for _, s := range []string{
+		"the memory controller can't be enabled in /sys/fs/cgroup/ci, as it has processes",
+		"the cpuset controller is not available in /sys/fs/cgroup",
+	} {
+		if !strings.Contains(err.Error(), s) {
+			t.Errorf("expected the error to contain %q, got %q", s, err)
+		}
+	}
+}
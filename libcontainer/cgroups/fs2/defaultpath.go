@@ -23,6 +23,7 @@ import (
 	"path/filepath"
 	"strings"
 
+	"github.com/opencontainers/runc/libcontainer/cgroups"
 	"github.com/opencontainers/runc/libcontainer/configs"
 	libcontainerUtils "github.com/opencontainers/runc/libcontainer/utils"
 	"github.com/pkg/errors"
@@ -66,7 +67,10 @@ func _defaultDirPath(root, cgPath, cgParent, cgName string) (string, error) {
 	// The current user scope most probably has tasks in it already,
 	// making it impossible to enable controllers for its sub-cgroup.
 	// A parent cgroup (with no tasks in it) is what we need.
-	ownCgroup = filepath.Dir(ownCgroup)
+	ownCgroup, err = cgroups.UnifiedRelPath(filepath.Dir(ownCgroup))
+	if err != nil {
+		return "", err
+	}
 
 	return filepath.Join(root, ownCgroup, innerPath), nil
 }
@@ -54,21 +54,42 @@ func canSkipEBPFError(r *configs.Resources) bool {
 	return true
 }
 
-func setDevices(dirPath string, r *configs.Resources) error {
+// setDevices installs the device filter for r, as configured by cg: pinned
+// at its DeviceFilterPinPath unless empty, consulting a map of the allowed
+// devices (which is updated in place if possible) if DeviceFilterMap is
+// set, auditing the denied accesses if AuditDevices is set, and detached
+// with the fail-closed policy if DeviceFilterFailClosed is set, in which
+// case errors are never skipped.
+func setDevices(dirPath string, cg *configs.Cgroup, r *configs.Resources) error {
 	if r.SkipDevices {
 		return nil
 	}
-	insts, license, err := devicefilter.DeviceFilter(r.Devices)
-	if err != nil {
-		return err
-	}
 	dirFD, err := unix.Open(dirPath, unix.O_DIRECTORY|unix.O_RDONLY, 0600)
 	if err != nil {
 		return errors.Errorf("cannot get dir FD for %s", dirPath)
 	}
 	defer unix.Close(dirFD)
-	if _, err := ebpf.LoadAttachCgroupDeviceFilter(insts, license, dirFD); err != nil {
-		if !canSkipEBPFError(r) {
+	policy := ebpf.FailOpen
+	if cg.DeviceFilterFailClosed {
+		policy = ebpf.FailClosed
+	}
+	if cg.DeviceFilterMap {
+		entries, license, err := devicefilter.DeviceFilterMap(r.Devices)
+		if err != nil {
+			return err
+		}
+		_, err = ebpf.LoadAttachCgroupDeviceFilterMap(entries, license, dirFD, cg.DeviceFilterPinPath, policy, cg.AuditDevices)
+		if err != nil && (cg.DeviceFilterFailClosed || !canSkipEBPFError(r)) {
+			return err
+		}
+		return nil
+	}
+	insts, license, err := devicefilter.DeviceFilter(r.Devices)
+	if err != nil {
+		return err
+	}
+	if _, err := ebpf.LoadAttachCgroupDeviceFilter(insts, license, dirFD, cg.DeviceFilterPinPath, policy, cg.AuditDevices); err != nil {
+		if cg.DeviceFilterFailClosed || !canSkipEBPFError(r) {
 			return err
 		}
 	}
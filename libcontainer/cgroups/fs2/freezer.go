@@ -4,19 +4,26 @@ package fs2
 
 import (
 	"bufio"
+	"context"
 	stdErrors "errors"
 	"fmt"
 	"os"
 	"strings"
 	"time"
 
+	"github.com/opencontainers/runc/libcontainer/cgroups"
 	"github.com/opencontainers/runc/libcontainer/cgroups/fscommon"
 	"github.com/opencontainers/runc/libcontainer/configs"
 	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
 	"golang.org/x/sys/unix"
 )
 
-func setFreezer(dirPath string, state configs.FreezerState) error {
+// setFreezer sets the freezer state of the cgroup dir. Waiting for the
+// cgroup to be frozen gives up once ctx is done or, if ctx has no deadline,
+// after a default timeout, in which case the error wraps
+// cgroups.ErrFreezing. opts may be nil.
+func setFreezer(ctx context.Context, dir *fscommon.PinnedDir, state configs.FreezerState, opts *cgroups.FreezeOptions) error {
 	var stateStr string
 	switch state {
 	case configs.Undefined:
@@ -29,7 +36,7 @@ func setFreezer(dirPath string, state configs.FreezerState) error {
 		return errors.Errorf("invalid freezer state %q requested", state)
 	}
 
-	fd, err := fscommon.OpenFile(dirPath, "cgroup.freeze", unix.O_RDWR)
+	fd, err := dir.OpenFile("cgroup.freeze", unix.O_RDWR)
 	if err != nil {
 		// We can ignore this request as long as the user didn't ask us to
 		// freeze the container (since without the freezer cgroup, that's a
@@ -41,11 +48,35 @@ func setFreezer(dirPath string, state configs.FreezerState) error {
 	}
 	defer fd.Close()
 
+	err = writeFreezer(ctx, dir, fd, state, stateStr)
+	if state != configs.Frozen || !stdErrors.Is(err, cgroups.ErrFreezing) {
+		return err
+	}
+	// Don't leave the cgroup half frozen.
+	if _, err := fd.WriteString("0"); err != nil {
+		return err
+	}
+	if opts == nil || opts.Signal == 0 {
+		return err
+	}
+	logrus.Debugf("unable to freeze %s, retrying after sending signal %d to its processes", dir.Path(), opts.Signal)
+	if err := cgroups.SignalAllPids(dir.Path(), opts.Signal); err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), cgroups.FreezeSignalRetryTimeout)
+	defer cancel()
+	if err = writeFreezer(ctx, dir, fd, state, stateStr); stdErrors.Is(err, cgroups.ErrFreezing) {
+		_, _ = fd.WriteString("0")
+	}
+	return err
+}
+
+func writeFreezer(ctx context.Context, dir *fscommon.PinnedDir, fd *os.File, state configs.FreezerState, stateStr string) error {
 	if _, err := fd.WriteString(stateStr); err != nil {
 		return err
 	}
 	// Confirm that the cgroup did actually change states.
-	if actualState, err := readFreezer(dirPath, fd); err != nil {
+	if actualState, err := readFreezer(ctx, dir, fd); err != nil {
 		return err
 	} else if actualState != state {
 		return errors.Errorf(`expected "cgroup.freeze" to be in state %q but was in %q`, state, actualState)
@@ -53,8 +84,8 @@ func setFreezer(dirPath string, state configs.FreezerState) error {
 	return nil
 }
 
-func getFreezer(dirPath string) (configs.FreezerState, error) {
-	fd, err := fscommon.OpenFile(dirPath, "cgroup.freeze", unix.O_RDONLY)
+func getFreezer(dir *fscommon.PinnedDir) (configs.FreezerState, error) {
+	fd, err := dir.OpenFile("cgroup.freeze", unix.O_RDONLY)
 	if err != nil {
 		// If the kernel is too old, then we just treat the freezer as being in
 		// an "undefined" state.
@@ -65,10 +96,10 @@ func getFreezer(dirPath string) (configs.FreezerState, error) {
 	}
 	defer fd.Close()
 
-	return readFreezer(dirPath, fd)
+	return readFreezer(context.Background(), dir, fd)
 }
 
-func readFreezer(dirPath string, fd *os.File) (configs.FreezerState, error) {
+func readFreezer(ctx context.Context, dir *fscommon.PinnedDir, fd *os.File) (configs.FreezerState, error) {
 	if _, err := fd.Seek(0, 0); err != nil {
 		return configs.Undefined, err
 	}
@@ -80,15 +111,16 @@ func readFreezer(dirPath string, fd *os.File) (configs.FreezerState, error) {
 	case "0\n":
 		return configs.Thawed, nil
 	case "1\n":
-		return waitFrozen(dirPath)
+		return waitFrozen(ctx, dir)
 	default:
 		return configs.Undefined, errors.Errorf(`unknown "cgroup.freeze" state: %q`, state)
 	}
 }
 
-// waitFrozen polls cgroup.events until it sees "frozen 1" in it.
-func waitFrozen(dirPath string) (configs.FreezerState, error) {
-	fd, err := fscommon.OpenFile(dirPath, "cgroup.events", unix.O_RDONLY)
+// waitFrozen polls cgroup.events until it sees "frozen 1" in it, or until ctx
+// is done. If ctx has no deadline, it gives up after a default timeout.
+func waitFrozen(ctx context.Context, dir *fscommon.PinnedDir) (configs.FreezerState, error) {
+	fd, err := dir.OpenFile("cgroup.events", unix.O_RDONLY)
 	if err != nil {
 		return configs.Undefined, err
 	}
@@ -102,10 +134,11 @@ func waitFrozen(dirPath string) (configs.FreezerState, error) {
 		waitTime = 10 * time.Millisecond
 		maxIter  = 1000
 	)
+	_, hasDeadline := ctx.Deadline()
 	scanner := bufio.NewScanner(fd)
 	for i := 0; scanner.Scan(); {
-		if i == maxIter {
-			return configs.Undefined, fmt.Errorf("timeout of %s reached waiting for the cgroup to freeze", waitTime*maxIter)
+		if !hasDeadline && i == maxIter {
+			return configs.Undefined, fmt.Errorf("%w: timeout of %s reached waiting for the cgroup to freeze", cgroups.ErrFreezing, waitTime*maxIter)
 		}
 		line := scanner.Text()
 		val := strings.TrimPrefix(line, "frozen ")
@@ -116,7 +149,11 @@ func waitFrozen(dirPath string) (configs.FreezerState, error) {
 
 			i++
 			// wait, then re-read
-			time.Sleep(waitTime)
+			select {
+			case <-ctx.Done():
+				return configs.Undefined, fmt.Errorf("%w: %v", cgroups.ErrFreezing, ctx.Err())
+			case <-time.After(waitTime):
+			}
 			_, err := fd.Seek(0, 0)
 			if err != nil {
 				return configs.Undefined, err
@@ -0,0 +1,48 @@
+// +build linux
+
+package fs2
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/opencontainers/runc/libcontainer/cgroups"
+	"github.com/opencontainers/runc/libcontainer/cgroups/fscommon"
+	"github.com/opencontainers/runc/libcontainer/configs"
+)
+
+func TestSetFreezerStuck(t *testing.T) {
+	fakeCgroupDir, err := ioutil.TempDir("", "runc-freezer-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(fakeCgroupDir)
+
+	for file, data := range map[string]string{
+		"cgroup.freeze": "0\n",
+		// The kernel never reports the cgroup as frozen.
+		"cgroup.events": "populated 1\nfrozen 0\n",
+	} {
+		if err := ioutil.WriteFile(filepath.Join(fakeCgroupDir, file), []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	dir := fscommon.PinDir(fakeCgroupDir)
+	defer dir.Close()
+	err = setFreezer(ctx, dir, configs.Frozen, nil)
+	if !errors.Is(err, cgroups.ErrFreezing) {
+		t.Fatalf("expected ErrFreezing, got %v", err)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("expected setFreezer to give up after the context deadline, took %s", d)
+	}
+}
@@ -3,14 +3,18 @@
 package fs2
 
 import (
+	"context"
 	"fmt"
 	"os"
+	"path/filepath"
 	"strings"
 
 	"github.com/opencontainers/runc/libcontainer/cgroups"
+	"github.com/opencontainers/runc/libcontainer/cgroups/ebpf"
 	"github.com/opencontainers/runc/libcontainer/cgroups/fscommon"
 	"github.com/opencontainers/runc/libcontainer/configs"
 	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
 )
 
 type manager struct {
@@ -21,6 +25,8 @@ type manager struct {
 	// excludes pseudo-controllers ("devices" and "freezer").
 	controllers map[string]struct{}
 	rootless    bool
+	// dirs caches the pinned dirPath.
+	dirs fscommon.DirCache
 }
 
 // NewManager creates a manager for cgroup v2 unified hierarchy.
@@ -68,6 +74,8 @@ func (m *manager) getControllers() error {
 }
 
 func (m *manager) Apply(pid int) error {
+	// The cgroup may be created again.
+	m.dirs.Reset()
 	if err := CreateCgroupPath(m.dirPath, m.config); err != nil {
 		// Related tests:
 		// - "runc create (no limits + no cgrouppath + no permission) succeeds"
@@ -78,7 +86,7 @@ func (m *manager) Apply(pid int) error {
 				if blNeed, nErr := needAnyControllers(m.config.Resources); nErr == nil && !blNeed {
 					return nil
 				}
-				return errors.Wrap(err, "rootless needs no limits + no cgrouppath when no permission is granted for cgroups")
+				return cgroups.NewRootlessError(err, "rootless needs no limits + no cgrouppath when no permission is granted for cgroups")
 			}
 		}
 		return err
@@ -89,6 +97,15 @@ func (m *manager) Apply(pid int) error {
 	return nil
 }
 
+// ApplyContext is like Apply. The cgroup is created directly, which is not
+// worth canceling, so ctx is only checked beforehand.
+func (m *manager) ApplyContext(ctx context.Context, pid int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return m.Apply(pid)
+}
+
 func (m *manager) GetPids() ([]int, error) {
 	return cgroups.GetPids(m.dirPath)
 }
@@ -98,32 +115,85 @@ func (m *manager) GetAllPids() ([]int, error) {
 }
 
 func (m *manager) GetStats() (*cgroups.Stats, error) {
+	return m.GetStatsFor()
+}
+
+func (m *manager) GetStatsFor(controllers ...string) (*cgroups.Stats, error) {
+	want, err := statsWanted(controllers)
+	if err != nil {
+		return nil, err
+	}
 	var (
 		errs []error
 	)
 
 	st := cgroups.NewStats()
+	dir := m.dirs.Get(m.dirPath)
 
 	// pids (since kernel 4.5)
-	if err := statPids(m.dirPath, st); err != nil {
-		errs = append(errs, err)
+	if want("pids") {
+		if err := statPids(dir, st); err != nil {
+			errs = append(errs, err)
+		}
 	}
 	// memory (since kernel 4.5)
-	if err := statMemory(m.dirPath, st); err != nil && !os.IsNotExist(err) {
-		errs = append(errs, err)
+	if want("memory") {
+		if err := statMemory(dir, st); err != nil && !os.IsNotExist(err) {
+			errs = append(errs, err)
+		}
 	}
 	// io (since kernel 4.5)
-	if err := statIo(m.dirPath, st); err != nil && !os.IsNotExist(err) {
-		errs = append(errs, err)
+	if want("io") {
+		if err := statIo(dir, st); err != nil && !os.IsNotExist(err) {
+			errs = append(errs, err)
+		}
 	}
 	// cpu (since kernel 4.15)
 	// Note cpu.stat is available even if the controller is not enabled.
-	if err := statCpu(m.dirPath, st); err != nil && !os.IsNotExist(err) {
-		errs = append(errs, err)
+	if want("cpu") {
+		if err := statCpu(dir, st); err != nil && !os.IsNotExist(err) {
+			errs = append(errs, err)
+		}
 	}
 	// hugetlb (since kernel 5.6)
-	if err := statHugeTlb(m.dirPath, st); err != nil && !os.IsNotExist(err) {
-		errs = append(errs, err)
+	if want("hugetlb") {
+		if err := statHugeTlb(dir, st); err != nil && !os.IsNotExist(err) {
+			errs = append(errs, err)
+		}
+	}
+	// rdma (since kernel 4.11)
+	if want("rdma") {
+		if err := cgroups.GetRdmaStats(dir, st); err != nil && !os.IsNotExist(err) {
+			errs = append(errs, err)
+		}
+	}
+	// cpuset (since kernel 5.0)
+	if want("cpuset") {
+		if err := statCpuset(dir, st); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	// misc (since kernel 5.13)
+	if want("misc") {
+		if err := statMisc(dir, st); err != nil && !os.IsNotExist(err) {
+			errs = append(errs, err)
+		}
+	}
+	// PSI (since kernel 4.20)
+	if want("cpu") {
+		if st.CpuStats.PSI, err = statPSI(dir, "cpu.pressure"); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if want("memory") {
+		if st.MemoryStats.PSI, err = statPSI(dir, "memory.pressure"); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if want("io") {
+		if st.BlkioStats.PSI, err = statPSI(dir, "io.pressure"); err != nil {
+			errs = append(errs, err)
+		}
 	}
 	if len(errs) > 0 && !m.rootless {
 		return st, errors.Errorf("error while statting cgroup v2: %+v", errs)
@@ -131,8 +201,35 @@ func (m *manager) GetStats() (*cgroups.Stats, error) {
 	return st, nil
 }
 
+// statsWanted returns a function reporting whether the statistics of a
+// controller are to be collected by GetStatsFor(controllers...).
+func statsWanted(controllers []string) (func(string) bool, error) {
+	if len(controllers) == 0 {
+		return func(string) bool { return true }, nil
+	}
+	wanted := make(map[string]bool, len(controllers))
+	for _, c := range controllers {
+		// Allow the names of the cgroup v1 subsystems.
+		switch c {
+		case "cpuacct":
+			c = "cpu"
+		case "blkio":
+			c = "io"
+		case "pids", "memory", "io", "cpu", "cpuset", "hugetlb", "rdma", "misc":
+		default:
+			return nil, fmt.Errorf("unknown cgroup controller %q", c)
+		}
+		wanted[c] = true
+	}
+	return func(c string) bool { return wanted[c] }, nil
+}
+
 func (m *manager) Freeze(state configs.FreezerState) error {
-	if err := setFreezer(m.dirPath, state); err != nil {
+	return m.FreezeContext(context.Background(), state, nil)
+}
+
+func (m *manager) FreezeContext(ctx context.Context, state configs.FreezerState, opts *cgroups.FreezeOptions) error {
+	if err := setFreezer(ctx, m.dirs.Get(m.dirPath), state, opts); err != nil {
 		return err
 	}
 	m.config.Resources.Freezer = state
@@ -140,7 +237,19 @@ func (m *manager) Freeze(state configs.FreezerState) error {
 }
 
 func (m *manager) Destroy() error {
-	return cgroups.RemovePath(m.dirPath)
+	m.dirs.Reset()
+	if err := cgroups.RemovePath(m.dirPath); err != nil {
+		return err
+	}
+	if err := PropagateMemoryProtection(m.config.CreatedParents); err != nil {
+		logrus.Warnf("unable to revert the memory protection of the parent cgroups: %v", err)
+	}
+	return ebpf.UnpinCgroupDeviceFilter(m.config.DeviceFilterPinPath)
+}
+
+// DestroyContext is like Destroy, ctx being unused.
+func (m *manager) DestroyContext(_ context.Context) error {
+	return m.Destroy()
 }
 
 func (m *manager) Path(_ string) string {
@@ -151,70 +260,88 @@ func (m *manager) Set(r *configs.Resources) error {
 	if err := m.getControllers(); err != nil {
 		return err
 	}
+	dir := m.dirs.Get(m.dirPath)
 	// pids (since kernel 4.5)
-	if err := setPids(m.dirPath, r); err != nil {
+	if err := setPids(dir, r); err != nil {
 		return err
 	}
 	// memory (since kernel 4.5)
-	if err := setMemory(m.dirPath, r); err != nil {
+	if err := setMemory(dir, r); err != nil {
 		return err
 	}
+	if IsMemoryProtectionSet(r) {
+		if err := PropagateMemoryProtection(m.config.CreatedParents); err != nil {
+			logrus.Warnf("unable to propagate the memory protection to the parent cgroups, it may not be effective: %v", err)
+		}
+	}
 	// io (since kernel 4.5)
-	if err := setIo(m.dirPath, r); err != nil {
+	if err := setIo(dir, r); err != nil {
 		return err
 	}
 	// cpu (since kernel 4.15)
-	if err := setCpu(m.dirPath, r); err != nil {
+	if err := setCpu(dir, r); err != nil {
 		return err
 	}
 	// devices (since kernel 4.15, pseudo-controller)
 	//
-	// When m.rootless is true, errors from the device subsystem are ignored because it is really not expected to work.
+	// When m.rootless is true, errors from the device subsystem are ignored because it is really not expected to work
+	// (unless the device filter is required with DeviceFilterFailClosed).
 	// However, errors from other subsystems are not ignored.
 	// see @test "runc create (rootless + limits + no cgrouppath + no permission) fails with informative error"
-	if err := setDevices(m.dirPath, r); err != nil && !m.rootless {
+	if err := setDevices(m.dirPath, m.config, r); err != nil && (!m.rootless || m.config.DeviceFilterFailClosed) {
+		return err
+	}
+	// socket address families (since kernel 4.10, eBPF)
+	if err := setSockCreateFilter(m.dirPath, r); err != nil {
 		return err
 	}
 	// cpuset (since kernel 5.0)
-	if err := setCpuset(m.dirPath, r); err != nil {
+	if err := setCpuset(dir, r); err != nil {
 		return err
 	}
 	// hugetlb (since kernel 5.6)
-	if err := setHugeTlb(m.dirPath, r); err != nil {
+	if err := setHugeTlb(dir, r); err != nil {
+		return err
+	}
+	// rdma (since kernel 4.11)
+	if err := cgroups.SetRdma(dir, r); err != nil {
+		return err
+	}
+	// misc (since kernel 5.13)
+	if err := setMisc(dir, r); err != nil {
 		return err
 	}
 	// freezer (since kernel 5.2, pseudo-controller)
-	if err := setFreezer(m.dirPath, r.Freezer); err != nil {
+	if err := setFreezer(context.Background(), dir, r.Freezer, nil); err != nil {
 		return err
 	}
-	if err := m.setUnified(r.Unified); err != nil {
+	if err := m.setUnified(dir, r.Unified); err != nil {
 		return err
 	}
 	m.config.Resources = r
 	return nil
 }
 
-func (m *manager) setUnified(res map[string]string) error {
+func (m *manager) setUnified(dir *fscommon.PinnedDir, res map[string]string) error {
+	// Check all the keys first, so that nothing is written if any of
+	// them is invalid.
 	for k, v := range res {
-		if strings.Contains(k, "/") {
-			return fmt.Errorf("unified resource %q must be a file name (no slashes)", k)
+		if err := checkUnifiedKey(k, m.controllers); err != nil {
+			return &UnifiedError{Key: k, Value: v, Err: err}
 		}
-		if err := fscommon.WriteFile(m.dirPath, k, v); err != nil {
+	}
+	for k, v := range res {
+		if err := dir.WriteFile(k, v); err != nil {
 			errC := errors.Cause(err)
 			// Check for both EPERM and ENOENT since O_CREAT is used by WriteFile.
 			if errors.Is(errC, os.ErrPermission) || errors.Is(errC, os.ErrNotExist) {
-				// Check if a controller is available,
-				// to give more specific error if not.
-				sk := strings.SplitN(k, ".", 2)
-				if len(sk) != 2 {
-					return fmt.Errorf("unified resource %q must be in the form CONTROLLER.PARAMETER", k)
-				}
-				c := sk[0]
-				if _, ok := m.controllers[c]; !ok && c != "cgroup" {
-					return fmt.Errorf("unified resource %q can't be set: controller %q not available", k, c)
+				// Give a more specific error if the file is missing or
+				// read-only.
+				if err := checkUnifiedFile(m.dirPath, k); err != nil {
+					return &UnifiedError{Key: k, Value: v, Err: err}
 				}
 			}
-			return errors.Wrapf(err, "can't set unified resource %q", k)
+			return &UnifiedError{Key: k, Value: v, Err: fmt.Errorf("can't write to %s: %w", filepath.Join(m.dirPath, k), errC)}
 		}
 	}
 
@@ -232,7 +359,7 @@ func (m *manager) GetCgroups() (*configs.Cgroup, error) {
 }
 
 func (m *manager) GetFreezerState() (configs.FreezerState, error) {
-	return getFreezer(m.dirPath)
+	return getFreezer(m.dirs.Get(m.dirPath))
 }
 
 func (m *manager) Exists() bool {
@@ -251,3 +378,11 @@ func (m *manager) OOMKillCount() (uint64, error) {
 
 	return c, err
 }
+
+func (m *manager) Reclaim(bytes uint64) error {
+	return reclaimMemory(m.dirPath, bytes)
+}
+
+func (m *manager) CanCreateEmpty() bool {
+	return true
+}
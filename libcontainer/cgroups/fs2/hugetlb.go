@@ -3,6 +3,7 @@
 package fs2
 
 import (
+	"os"
 	"strconv"
 
 	"github.com/pkg/errors"
@@ -16,12 +17,28 @@ func isHugeTlbSet(r *configs.Resources) bool {
 	return len(r.HugetlbLimit) > 0
 }
 
-func setHugeTlb(dirPath string, r *configs.Resources) error {
+func setHugeTlb(dir *fscommon.PinnedDir, r *configs.Resources) error {
 	if !isHugeTlbSet(r) {
 		return nil
 	}
+	// The reservations are limited too (if the kernel supports their
+	// accounting), so that exceeding the limit makes mmap fail rather than
+	// the process be killed by SIGBUS when faulting a page in.
+	skipRsvd := false
 	for _, hugetlb := range r.HugetlbLimit {
-		if err := fscommon.WriteFile(dirPath, "hugetlb."+hugetlb.Pagesize+".max", strconv.FormatUint(hugetlb.Limit, 10)); err != nil {
+		prefix := "hugetlb." + hugetlb.Pagesize
+		val := strconv.FormatUint(hugetlb.Limit, 10)
+		if err := dir.WriteFile(prefix+".max", val); err != nil {
+			return err
+		}
+		if skipRsvd {
+			continue
+		}
+		if err := dir.WriteFile(prefix+".rsvd.max", val); err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				skipRsvd = true
+				continue
+			}
 			return err
 		}
 	}
@@ -29,27 +46,40 @@ func setHugeTlb(dirPath string, r *configs.Resources) error {
 	return nil
 }
 
-func statHugeTlb(dirPath string, stats *cgroups.Stats) error {
+func statHugeTlb(dir *fscommon.PinnedDir, stats *cgroups.Stats) error {
 	hugePageSizes, err := cgroups.GetHugePageSize()
 	if err != nil {
 		return errors.Wrap(err, "failed to fetch hugetlb info")
 	}
-	hugetlbStats := cgroups.HugetlbStats{}
-
+	rsvd := true
 	for _, pagesize := range hugePageSizes {
-		value, err := fscommon.GetCgroupParamUint(dirPath, "hugetlb."+pagesize+".current")
+		hugetlbStats := cgroups.HugetlbStats{}
+		value, err := dir.GetCgroupParamUint("hugetlb." + pagesize + ".current")
 		if err != nil {
 			return err
 		}
 		hugetlbStats.Usage = value
 
 		fileName := "hugetlb." + pagesize + ".events"
-		value, err = fscommon.GetValueByKey(dirPath, fileName, "max")
+		value, err = dir.GetValueByKey(fileName, "max")
 		if err != nil {
 			return errors.Wrap(err, "failed to read stats")
 		}
 		hugetlbStats.Failcnt = value
 
+		if rsvd {
+			// There are no reservation events, nor maximum usage.
+			value, err = dir.GetCgroupParamUint("hugetlb." + pagesize + ".rsvd.current")
+			switch {
+			case err == nil:
+				hugetlbStats.RsvdUsage = value
+			case errors.Is(err, os.ErrNotExist):
+				rsvd = false
+			default:
+				return err
+			}
+		}
+
 		stats.HugetlbStats[pagesize] = hugetlbStats
 	}
 
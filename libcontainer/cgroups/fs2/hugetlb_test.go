@@ -0,0 +1,85 @@
+// +build linux
+
+package fs2
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/opencontainers/runc/libcontainer/cgroups"
+	"github.com/opencontainers/runc/libcontainer/cgroups/fscommon"
+	"github.com/opencontainers/runc/libcontainer/configs"
+)
+
+func TestSetHugeTlb(t *testing.T) {
+	fakeCgroupDir, err := ioutil.TempDir("", "runc-hugetlb-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(fakeCgroupDir)
+
+	r := &configs.Resources{
+		HugetlbLimit: []*configs.HugepageLimit{{Pagesize: "2MB", Limit: 4194304}},
+	}
+	dir := fscommon.PinDir(fakeCgroupDir)
+	defer dir.Close()
+	if err := setHugeTlb(dir, r); err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range []string{"hugetlb.2MB.max", "hugetlb.2MB.rsvd.max"} {
+		data, err := ioutil.ReadFile(filepath.Join(fakeCgroupDir, file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != "4194304" {
+			t.Errorf("expected %s to be %q, got %q", file, "4194304", data)
+		}
+	}
+}
+
+func TestStatHugeTlb(t *testing.T) {
+	pageSizes, err := cgroups.GetHugePageSize()
+	if err != nil || len(pageSizes) == 0 {
+		t.Skip("no huge pages")
+	}
+	fakeCgroupDir, err := ioutil.TempDir("", "runc-hugetlb-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(fakeCgroupDir)
+
+	for i, pageSize := range pageSizes {
+		files := map[string]string{
+			"hugetlb." + pageSize + ".current": "128\n",
+			"hugetlb." + pageSize + ".events":  "max 2\n",
+		}
+		// Only the first page size has its reservations accounted for,
+		// to check the stats of the others don't get its values.
+		if i == 0 {
+			files["hugetlb."+pageSize+".rsvd.current"] = "1024\n"
+		}
+		for file, data := range files {
+			if err := ioutil.WriteFile(filepath.Join(fakeCgroupDir, file), []byte(data), 0o644); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	st := cgroups.NewStats()
+	dir := fscommon.PinDir(fakeCgroupDir)
+	defer dir.Close()
+	if err := statHugeTlb(dir, st); err != nil {
+		t.Fatal(err)
+	}
+	for i, pageSize := range pageSizes {
+		expected := cgroups.HugetlbStats{Usage: 128, Failcnt: 2}
+		if i == 0 {
+			expected.RsvdUsage = 1024
+		}
+		if st.HugetlbStats[pageSize] != expected {
+			t.Errorf("expected %s stats %+v, got %+v", pageSize, expected, st.HugetlbStats[pageSize])
+		}
+	}
+}
@@ -4,70 +4,107 @@ package fs2
 
 import (
 	"bufio"
+	"fmt"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
 
 	"github.com/opencontainers/runc/libcontainer/cgroups"
 	"github.com/opencontainers/runc/libcontainer/cgroups/fscommon"
 	"github.com/opencontainers/runc/libcontainer/configs"
+	"github.com/sirupsen/logrus"
 )
 
 func isIoSet(r *configs.Resources) bool {
 	return r.BlkioWeight != 0 ||
+		len(r.BlkioWeightDevice) > 0 ||
 		len(r.BlkioThrottleReadBpsDevice) > 0 ||
 		len(r.BlkioThrottleWriteBpsDevice) > 0 ||
 		len(r.BlkioThrottleReadIOPSDevice) > 0 ||
 		len(r.BlkioThrottleWriteIOPSDevice) > 0
 }
 
-func setIo(dirPath string, r *configs.Resources) error {
+// bfqWeightFile is the weight file of the bfq I/O scheduler. Its values use
+// the same range as the cgroup v1 blkio weights (10 to 1000), while the ones
+// of io.weight (1 to 10000) need to be converted.
+const bfqWeightFile = "io.bfq.weight"
+
+func setIo(dir *fscommon.PinnedDir, r *configs.Resources) error {
 	if !isIoSet(r) {
 		return nil
 	}
 
-	if r.BlkioWeight != 0 {
-		filename := "io.bfq.weight"
-		if err := fscommon.WriteFile(dirPath, filename,
-			strconv.FormatUint(uint64(r.BlkioWeight), 10)); err != nil {
-			// if io.bfq.weight does not exist, then bfq module is not loaded.
-			// Fallback to use io.weight with a conversion scheme
-			if !os.IsNotExist(err) {
-				return err
-			}
-			v := cgroups.ConvertBlkIOToIOWeightValue(r.BlkioWeight)
-			if err := fscommon.WriteFile(dirPath, "io.weight", strconv.FormatUint(v, 10)); err != nil {
-				return err
-			}
-		}
+	if r.BlkioLeafWeight != 0 {
+		logrus.Warn("blkio leaf weight is not supported on cgroup v2, ignoring")
 	}
-	for _, td := range r.BlkioThrottleReadBpsDevice {
-		if err := fscommon.WriteFile(dirPath, "io.max", td.StringName("rbps")); err != nil {
+	// If io.bfq.weight does not exist, then bfq module is not loaded,
+	// and io.weight is used with a conversion scheme.
+	bfq := cgroups.PathExists(filepath.Join(dir.Path(), bfqWeightFile))
+	if r.BlkioWeight != 0 {
+		if err := setIoWeight(dir, bfq, "", r.BlkioWeight); err != nil {
 			return err
 		}
 	}
-	for _, td := range r.BlkioThrottleWriteBpsDevice {
-		if err := fscommon.WriteFile(dirPath, "io.max", td.StringName("wbps")); err != nil {
+	for _, wd := range r.BlkioWeightDevice {
+		if wd.LeafWeight != 0 {
+			logrus.Warnf("blkio leaf weight for device %d:%d is not supported on cgroup v2, ignoring", wd.Major, wd.Minor)
+		}
+		if wd.Weight == 0 {
+			continue
+		}
+		dev := strconv.FormatInt(wd.Major, 10) + ":" + strconv.FormatInt(wd.Minor, 10) + " "
+		if err := setIoWeight(dir, bfq, dev, wd.Weight); err != nil {
 			return err
 		}
 	}
-	for _, td := range r.BlkioThrottleReadIOPSDevice {
-		if err := fscommon.WriteFile(dirPath, "io.max", td.StringName("riops")); err != nil {
-			return err
+	var limits []string
+	for _, t := range []struct {
+		key     string
+		devices []*configs.ThrottleDevice
+	}{
+		{"rbps", r.BlkioThrottleReadBpsDevice},
+		{"wbps", r.BlkioThrottleWriteBpsDevice},
+		{"riops", r.BlkioThrottleReadIOPSDevice},
+		{"wiops", r.BlkioThrottleWriteIOPSDevice},
+	} {
+		for _, td := range t.devices {
+			limits = append(limits, ioMaxString(td, t.key))
 		}
 	}
-	for _, td := range r.BlkioThrottleWriteIOPSDevice {
-		if err := fscommon.WriteFile(dirPath, "io.max", td.StringName("wiops")); err != nil {
+
+	return dir.WriteFileBatch("io.max", limits)
+}
+
+// setIoWeight sets the weight (in cgroup v1 blkio range) of the cgroup, or,
+// if dev ("MAJ:MIN ") is not empty, of the given device.
+func setIoWeight(dir *fscommon.PinnedDir, bfq bool, dev string, weight uint16) error {
+	if bfq {
+		err := dir.WriteFile(bfqWeightFile, dev+strconv.FormatUint(uint64(weight), 10))
+		if err == nil {
+			return nil
+		}
+		// Per-device bfq weights require Linux 5.4+.
+		if dev == "" {
 			return err
 		}
 	}
+	v := cgroups.ConvertBlkIOToIOWeightValue(weight)
+	return dir.WriteFile("io.weight", dev+strconv.FormatUint(v, 10))
+}
 
-	return nil
+// ioMaxString formats td as an io.max entry for the given key. As in cgroup
+// v1, a rate of 0 removes the limit.
+func ioMaxString(td *configs.ThrottleDevice, key string) string {
+	if td.Rate == 0 {
+		return fmt.Sprintf("%d:%d %s=max", td.Major, td.Minor, key)
+	}
+	return td.StringName(key)
 }
 
-func readCgroup2MapFile(dirPath string, name string) (map[string][]string, error) {
+func readCgroup2MapFile(dir *fscommon.PinnedDir, name string) (map[string][]string, error) {
 	ret := map[string][]string{}
-	f, err := fscommon.OpenFile(dirPath, name, os.O_RDONLY)
+	f, err := dir.OpenFile(name, os.O_RDONLY)
 	if err != nil {
 		return nil, err
 	}
@@ -87,10 +124,10 @@ func readCgroup2MapFile(dirPath string, name string) (map[string][]string, error
 	return ret, nil
 }
 
-func statIo(dirPath string, stats *cgroups.Stats) error {
+func statIo(dir *fscommon.PinnedDir, stats *cgroups.Stats) error {
 	// more details on the io.stat file format: https://www.kernel.org/doc/Documentation/cgroup-v2.txt
 	var ioServiceBytesRecursive []cgroups.BlkioStatEntry
-	values, err := readCgroup2MapFile(dirPath, "io.stat")
+	values, err := readCgroup2MapFile(dir, "io.stat")
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,77 @@
+// +build linux
+
+package fs2
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/opencontainers/runc/libcontainer/cgroups/fscommon"
+	"github.com/opencontainers/runc/libcontainer/configs"
+)
+
+func TestSetIo(t *testing.T) {
+	fakeCgroupDir, err := ioutil.TempDir("", "runc-io-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(fakeCgroupDir)
+
+	r := &configs.Resources{
+		BlkioWeightDevice: []*configs.WeightDevice{
+			configs.NewWeightDevice(8, 0, 500, 0),
+		},
+		BlkioThrottleWriteIOPSDevice: []*configs.ThrottleDevice{
+			configs.NewThrottleDevice(8, 0, 0),
+		},
+	}
+	dir := fscommon.PinDir(fakeCgroupDir)
+	defer dir.Close()
+	if err := setIo(dir, r); err != nil {
+		t.Fatal(err)
+	}
+
+	for file, expected := range map[string]string{
+		// No io.bfq.weight, so the weight is converted.
+		"io.weight": "8:0 4950",
+		// A rate of 0 removes the limit.
+		"io.max": "8:0 wiops=max",
+	} {
+		data, err := ioutil.ReadFile(filepath.Join(fakeCgroupDir, file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != expected {
+			t.Errorf("%s: expected %q, got %q", file, expected, data)
+		}
+	}
+}
+
+func TestSetIoBfq(t *testing.T) {
+	fakeCgroupDir, err := ioutil.TempDir("", "runc-io-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(fakeCgroupDir)
+
+	if err := ioutil.WriteFile(filepath.Join(fakeCgroupDir, bfqWeightFile), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	r := &configs.Resources{
+		BlkioWeight: 500,
+	}
+	dir := fscommon.PinDir(fakeCgroupDir)
+	defer dir.Close()
+	if err := setIo(dir, r); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(filepath.Join(fakeCgroupDir, bfqWeightFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "500" {
+		t.Errorf("expected %q, got %q", "500", data)
+	}
+}
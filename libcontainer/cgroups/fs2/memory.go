@@ -4,8 +4,10 @@ package fs2
 
 import (
 	"bufio"
+	"io/ioutil"
 	"math"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
 
@@ -34,10 +36,12 @@ func numToStr(value int64) (ret string) {
 }
 
 func isMemorySet(r *configs.Resources) bool {
-	return r.MemoryReservation != 0 || r.Memory != 0 || r.MemorySwap != 0
+	return r.MemoryReservation != 0 || r.Memory != 0 || r.MemorySwap != 0 ||
+		r.MemoryMin != 0 || r.MemoryLow != 0 || r.MemorySwapHigh != 0 || r.MemoryZswapMax != nil || r.MemoryZswapWriteback != nil ||
+		r.MemoryOOMGroup != nil
 }
 
-func setMemory(dirPath string, r *configs.Resources) error {
+func setMemory(dir *fscommon.PinnedDir, r *configs.Resources) error {
 	if !isMemorySet(r) {
 		return nil
 	}
@@ -52,31 +56,164 @@ func setMemory(dirPath string, r *configs.Resources) error {
 	}
 	// never write empty string to `memory.swap.max`, it means set to 0.
 	if swapStr != "" {
-		if err := fscommon.WriteFile(dirPath, "memory.swap.max", swapStr); err != nil {
+		if err := dir.WriteFile("memory.swap.max", swapStr); err != nil {
 			return err
 		}
 	}
 
 	if val := numToStr(r.Memory); val != "" {
-		if err := fscommon.WriteFile(dirPath, "memory.max", val); err != nil {
+		if err := dir.WriteFile("memory.max", val); err != nil {
 			return err
 		}
 	}
 
 	// cgroup.Resources.KernelMemory is ignored
 
-	if val := numToStr(r.MemoryReservation); val != "" {
-		if err := fscommon.WriteFile(dirPath, "memory.low", val); err != nil {
+	for _, p := range []struct {
+		file  string
+		value int64
+	}{
+		{"memory.min", r.MemoryMin},
+		{"memory.low", MemoryLow(r)},
+	} {
+		val := numToStr(p.value)
+		if val == "" {
+			continue
+		}
+		if err := dir.WriteFile(p.file, val); err != nil {
+			return err
+		}
+	}
+
+	if val := numToStr(r.MemorySwapHigh); val != "" {
+		if err := dir.WriteFile("memory.swap.high", val); err != nil {
 			return err
 		}
 	}
+	if r.MemoryZswapMax != nil {
+		val := "0"
+		if *r.MemoryZswapMax != 0 {
+			val = numToStr(*r.MemoryZswapMax)
+		}
+		if err := dir.WriteFile("memory.zswap.max", val); err != nil {
+			return err
+		}
+	}
+	if r.MemoryZswapWriteback != nil {
+		val := "0"
+		if *r.MemoryZswapWriteback {
+			val = "1"
+		}
+		if err := dir.WriteFile("memory.zswap.writeback", val); err != nil {
+			return err
+		}
+	}
+	if r.MemoryOOMGroup != nil {
+		val := "0"
+		if *r.MemoryOOMGroup {
+			val = "1"
+		}
+		if err := dir.WriteFile("memory.oom.group", val); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// MemoryLow returns the value of memory.low for r: MemoryLow if set, or
+// MemoryReservation otherwise.
+func MemoryLow(r *configs.Resources) int64 {
+	if r.MemoryLow != 0 {
+		return r.MemoryLow
+	}
+	return r.MemoryReservation
+}
+
+// IsMemoryProtectionSet returns whether r sets a memory protection, to be
+// propagated to the parents (see PropagateMemoryProtection).
+func IsMemoryProtectionSet(r *configs.Resources) bool {
+	return r.MemoryMin != 0 || MemoryLow(r) != 0
+}
+
+// PropagateMemoryProtection sets the memory protections (memory.min and
+// memory.low) of the parents, which are to be the ones created for the
+// container (see configs.Cgroup.CreatedParents), to the sum of the ones of
+// their children, from the bottom one, as the protection of a cgroup is
+// bounded by the ones of its ancestors. Once the cgroup of the container is
+// removed, this reverts the protections of the parents to the ones they had
+// before it was created. The parents which no longer exist are skipped.
+func PropagateMemoryProtection(parents []string) error {
+	for i := len(parents) - 1; i >= 0; i-- {
+		dir := parents[i]
+		if _, err := os.Stat(dir); os.IsNotExist(err) {
+			continue
+		}
+		for _, file := range []string{"memory.min", "memory.low"} {
+			sum, err := SumMemoryProtection(dir, file)
+			if err != nil {
+				return err
+			}
+			val := "max"
+			if sum != -1 {
+				val = strconv.FormatInt(sum, 10)
+			}
+			if err := fscommon.WriteFile(dir, file, val); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// SumMemoryProtection returns the sum of the memory protection file
+// (memory.min or memory.low) of the children of the cgroup dirPath, -1
+// meaning "max".
+func SumMemoryProtection(dirPath, file string) (int64, error) {
+	entries, err := ioutil.ReadDir(dirPath)
+	if err != nil {
+		return 0, err
+	}
+	var sum int64
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		// GetCgroupParamUint returns math.MaxUint64 for "max".
+		val, err := fscommon.GetCgroupParamUint(filepath.Join(dirPath, e.Name()), file)
+		if err != nil {
+			// The memory controller may not be enabled for the child.
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			return 0, err
+		}
+		if val > uint64(math.MaxInt64-sum) {
+			return -1, nil
+		}
+		sum += int64(val)
+	}
+	return sum, nil
+}
 
+func reclaimMemory(dirPath string, bytes uint64) error {
+	err := fscommon.WriteFile(dirPath, "memory.reclaim", strconv.FormatUint(bytes, 10))
+	if err != nil {
+		if _, statErr := os.Stat(filepath.Join(dirPath, "memory.reclaim")); os.IsNotExist(statErr) {
+			return cgroups.ErrReclaimNotSupported
+		}
+		// EAGAIN means less than the requested amount was reclaimed.
+		if errors.Is(err, unix.EAGAIN) {
+			return errors.Errorf("unable to reclaim %d bytes of memory", bytes)
+		}
+		return err
+	}
 	return nil
 }
 
-func statMemory(dirPath string, stats *cgroups.Stats) error {
+func statMemory(dir *fscommon.PinnedDir, stats *cgroups.Stats) error {
 	// Set stats from memory.stat.
-	statsFile, err := fscommon.OpenFile(dirPath, "memory.stat", os.O_RDONLY)
+	statsFile, err := dir.OpenFile("memory.stat", os.O_RDONLY)
 	if err != nil {
 		return err
 	}
@@ -95,9 +232,20 @@ func statMemory(dirPath string, stats *cgroups.Stats) error {
 	// cgroup v2 is always hierarchical.
 	stats.MemoryStats.UseHierarchy = true
 
-	memoryUsage, err := getMemoryDataV2(dirPath, "")
+	if stats.MemoryStats.Events, err = statMemoryEvents(dir, "memory.events"); err != nil {
+		return err
+	}
+	// memory.events.local is available since kernel 5.2.
+	if stats.MemoryStats.EventsLocal, err = statMemoryEvents(dir, "memory.events.local"); err != nil {
+		return err
+	}
+	if stats.MemoryStats.PageUsageByNUMA, err = getPageUsageByNUMAV2(dir); err != nil {
+		return err
+	}
+
+	memoryUsage, err := getMemoryDataV2(dir, "")
 	if err != nil {
-		if errors.Is(err, unix.ENOENT) && dirPath == UnifiedMountpoint {
+		if errors.Is(err, unix.ENOENT) && dir.Path() == UnifiedMountpoint {
 			// The root cgroup does not have memory.{current,max}
 			// so emulate those using data from /proc/meminfo.
 			return statsFromMeminfo(stats)
@@ -105,10 +253,15 @@ func statMemory(dirPath string, stats *cgroups.Stats) error {
 		return err
 	}
 	stats.MemoryStats.Usage = memoryUsage
-	swapUsage, err := getMemoryDataV2(dirPath, "swap")
+	swapUsage, err := getMemoryDataV2(dir, "swap")
 	if err != nil {
 		return err
 	}
+	stats.MemoryStats.SwapOnlyUsage = swapUsage
+	// memory.zswap.* are available since kernel 5.19.
+	if stats.MemoryStats.ZswapUsage, err = getMemoryDataV2(dir, "zswap"); err != nil {
+		return err
+	}
 	// As cgroup v1 reports SwapUsage values as mem+swap combined,
 	// while in cgroup v2 swap values do not include memory,
 	// report combined mem+swap for v1 compatibility.
@@ -121,7 +274,120 @@ func statMemory(dirPath string, stats *cgroups.Stats) error {
 	return nil
 }
 
-func getMemoryDataV2(path, name string) (cgroups.MemoryData, error) {
+// statMemoryEvents parses the memory.events(.local) file, returning nil if
+// it does not exist, as in the root cgroup.
+func statMemoryEvents(dir *fscommon.PinnedDir, file string) (*cgroups.MemoryEvents, error) {
+	content, err := dir.ReadFile(file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var events cgroups.MemoryEvents
+	for _, line := range strings.Split(content, "\n") {
+		if line == "" {
+			continue
+		}
+		k, v, err := fscommon.ParseKeyValue(line)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to parse %s (%q)", file, line)
+		}
+		switch k {
+		case "low":
+			events.Low = v
+		case "high":
+			events.High = v
+		case "max":
+			events.Max = v
+		case "oom":
+			events.Oom = v
+		case "oom_kill":
+			events.OomKill = v
+		}
+	}
+	return &events, nil
+}
+
+// getPageUsageByNUMAV2 parses memory.numa_stat (available since kernel 5.8)
+// into the page usage by NUMA node of the anon, file and unevictable memory,
+// converting the sizes to pages, as in cgroup v1.
+func getPageUsageByNUMAV2(dir *fscommon.PinnedDir) (cgroups.PageUsageByNUMA, error) {
+	const (
+		maxColumns = math.MaxUint8 + 1
+		filename   = "memory.numa_stat"
+	)
+	stats := cgroups.PageUsageByNUMA{}
+
+	file, err := dir.OpenFile(filename, os.O_RDONLY)
+	if os.IsNotExist(err) {
+		return stats, nil
+	} else if err != nil {
+		return stats, err
+	}
+	defer file.Close()
+
+	// The file format is documented in
+	// linux/Documentation/admin-guide/cgroup-v2.rst, and looks like this:
+	//
+	// anon N0=<node 0 bytes> N1=<node 1 bytes> ...
+	// file N0=<node 0 bytes> N1=<node 1 bytes> ...
+	// ...
+	pageSize := uint64(os.Getpagesize())
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := scanner.Text()
+		columns := strings.SplitN(line, " ", maxColumns)
+		var field *cgroups.PageStats
+		switch columns[0] {
+		case "anon":
+			field = &stats.Anon
+		case "file":
+			field = &stats.File
+		case "unevictable":
+			field = &stats.Unevictable
+		default:
+			continue
+		}
+		field.Nodes = map[uint8]uint64{}
+		for _, column := range columns[1:] {
+			byNode := strings.SplitN(column, "=", 2)
+			if len(byNode) < 2 || len(byNode[0]) < 2 || byNode[0][0] != 'N' {
+				return cgroups.PageUsageByNUMA{}, errors.Errorf("malformed line %q in %s", line, filename)
+			}
+			n, err := strconv.ParseUint(byNode[0][1:], 10, 8)
+			if err != nil {
+				return cgroups.PageUsageByNUMA{}, err
+			}
+			usage, err := strconv.ParseUint(byNode[1], 10, 64)
+			if err != nil {
+				return cgroups.PageUsageByNUMA{}, err
+			}
+			field.Nodes[uint8(n)] = usage / pageSize
+			field.Total += usage / pageSize
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return cgroups.PageUsageByNUMA{}, err
+	}
+
+	// As in cgroup v1, the total is the sum of the other counters.
+	if stats.Anon.Nodes != nil || stats.File.Nodes != nil || stats.Unevictable.Nodes != nil {
+		stats.Total.Nodes = map[uint8]uint64{}
+		for _, field := range []cgroups.PageStats{stats.Anon, stats.File, stats.Unevictable} {
+			stats.Total.Total += field.Total
+			for n, usage := range field.Nodes {
+				stats.Total.Nodes[n] += usage
+			}
+		}
+	}
+	// cgroup v2 is always hierarchical.
+	stats.Hierarchical = stats.PageUsageByNUMAInner
+
+	return stats, nil
+}
+
+func getMemoryDataV2(dir *fscommon.PinnedDir, name string) (cgroups.MemoryData, error) {
 	memoryData := cgroups.MemoryData{}
 
 	moduleName := "memory"
@@ -131,7 +397,7 @@ func getMemoryDataV2(path, name string) (cgroups.MemoryData, error) {
 	usage := moduleName + ".current"
 	limit := moduleName + ".max"
 
-	value, err := fscommon.GetCgroupParamUint(path, usage)
+	value, err := dir.GetCgroupParamUint(usage)
 	if err != nil {
 		if name != "" && os.IsNotExist(err) {
 			// Ignore EEXIST as there's no swap accounting
@@ -143,7 +409,7 @@ func getMemoryDataV2(path, name string) (cgroups.MemoryData, error) {
 	}
 	memoryData.Usage = value
 
-	value, err = fscommon.GetCgroupParamUint(path, limit)
+	value, err = dir.GetCgroupParamUint(limit)
 	if err != nil {
 		return cgroups.MemoryData{}, errors.Wrapf(err, "failed to parse %s", limit)
 	}
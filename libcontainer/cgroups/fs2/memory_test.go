@@ -0,0 +1,293 @@
+// +build linux
+
+package fs2
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/opencontainers/runc/libcontainer/cgroups"
+	"github.com/opencontainers/runc/libcontainer/cgroups/fscommon"
+	"github.com/opencontainers/runc/libcontainer/configs"
+)
+
+func TestReclaimMemory(t *testing.T) {
+	fakeCgroupDir, err := ioutil.TempDir("", "runc-memory-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(fakeCgroupDir)
+
+	if err := reclaimMemory(fakeCgroupDir, 4096); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(filepath.Join(fakeCgroupDir, "memory.reclaim"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "4096" {
+		t.Errorf("expected %q, got %q", "4096", data)
+	}
+}
+
+func TestStatMemoryEvents(t *testing.T) {
+	fakeCgroupDir, err := ioutil.TempDir("", "runc-memory-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(fakeCgroupDir)
+
+	const events = "low 1\nhigh 2\nmax 3\noom 4\noom_kill 5\noom_group_kill 0\n"
+	if err := ioutil.WriteFile(filepath.Join(fakeCgroupDir, "memory.events"), []byte(events), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	dir := fscommon.PinDir(fakeCgroupDir)
+	defer dir.Close()
+	got, err := statMemoryEvents(dir, "memory.events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := &cgroups.MemoryEvents{Low: 1, High: 2, Max: 3, Oom: 4, OomKill: 5}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %+v, got %+v", expected, got)
+	}
+
+	// memory.events.local is not available on older kernels.
+	got, err = statMemoryEvents(dir, "memory.events.local")
+	if err != nil || got != nil {
+		t.Errorf("expected no events and no error, got %+v, %v", got, err)
+	}
+}
+
+func TestGetPageUsageByNUMAV2(t *testing.T) {
+	fakeCgroupDir, err := ioutil.TempDir("", "runc-memory-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(fakeCgroupDir)
+
+	// memory.numa_stat is not available on older kernels.
+	dir := fscommon.PinDir(fakeCgroupDir)
+	defer dir.Close()
+	got, err := getPageUsageByNUMAV2(dir)
+	if err != nil || !reflect.DeepEqual(got, cgroups.PageUsageByNUMA{}) {
+		t.Errorf("expected no stats and no error, got %+v, %v", got, err)
+	}
+
+	p := uint64(os.Getpagesize())
+	numaStat := fmt.Sprintf("anon N0=%d N1=%d\nfile N0=%d N1=0\nkernel_stack N0=16384 N1=0\nunevictable N0=0 N1=%d\n", 3*p, 2*p, 10*p, p)
+	if err := ioutil.WriteFile(filepath.Join(fakeCgroupDir, "memory.numa_stat"), []byte(numaStat), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	got, err = getPageUsageByNUMAV2(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	inner := cgroups.PageUsageByNUMAInner{
+		Total:       cgroups.PageStats{Total: 16, Nodes: map[uint8]uint64{0: 13, 1: 3}},
+		Anon:        cgroups.PageStats{Total: 5, Nodes: map[uint8]uint64{0: 3, 1: 2}},
+		File:        cgroups.PageStats{Total: 10, Nodes: map[uint8]uint64{0: 10, 1: 0}},
+		Unevictable: cgroups.PageStats{Total: 1, Nodes: map[uint8]uint64{0: 0, 1: 1}},
+	}
+	expected := cgroups.PageUsageByNUMA{PageUsageByNUMAInner: inner, Hierarchical: inner}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %+v, got %+v", expected, got)
+	}
+}
+
+func TestSetMemorySwapOnlyLimits(t *testing.T) {
+	fakeCgroupDir, err := ioutil.TempDir("", "runc-memory-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(fakeCgroupDir)
+
+	zswapMax := int64(0)
+	writeback := false
+	r := &configs.Resources{
+		MemorySwapHigh:       -1,
+		MemoryZswapMax:       &zswapMax,
+		MemoryZswapWriteback: &writeback,
+	}
+	dir := fscommon.PinDir(fakeCgroupDir)
+	defer dir.Close()
+	if err := setMemory(dir, r); err != nil {
+		t.Fatal(err)
+	}
+	for file, expected := range map[string]string{
+		"memory.swap.high":       "max",
+		"memory.zswap.max":       "0",
+		"memory.zswap.writeback": "0",
+	} {
+		data, err := ioutil.ReadFile(filepath.Join(fakeCgroupDir, file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != expected {
+			t.Errorf("%s: expected %q, got %q", file, expected, data)
+		}
+	}
+	// No other limit is set.
+	if _, err := os.Stat(filepath.Join(fakeCgroupDir, "memory.max")); !os.IsNotExist(err) {
+		t.Errorf("expected memory.max not to be written, got %v", err)
+	}
+}
+
+func TestSetMemoryOOMGroup(t *testing.T) {
+	for _, oomGroup := range []bool{true, false} {
+		fakeCgroupDir, err := ioutil.TempDir("", "runc-memory-test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(fakeCgroupDir)
+
+		r := &configs.Resources{
+			MemoryOOMGroup: &oomGroup,
+		}
+		dir := fscommon.PinDir(fakeCgroupDir)
+		defer dir.Close()
+		if err := setMemory(dir, r); err != nil {
+			t.Fatal(err)
+		}
+		expected := "0"
+		if oomGroup {
+			expected = "1"
+		}
+		data, err := ioutil.ReadFile(filepath.Join(fakeCgroupDir, "memory.oom.group"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != expected {
+			t.Errorf("memory.oom.group: expected %q, got %q", expected, data)
+		}
+		// No other limit is set.
+		if _, err := os.Stat(filepath.Join(fakeCgroupDir, "memory.max")); !os.IsNotExist(err) {
+			t.Errorf("expected memory.max not to be written, got %v", err)
+		}
+	}
+}
+
+func TestSetMemoryProtection(t *testing.T) {
+	fakeCgroupDir, err := ioutil.TempDir("", "runc-memory-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(fakeCgroupDir)
+
+	r := &configs.Resources{
+		MemoryReservation: 1024,
+		MemoryMin:         4096,
+		MemoryLow:         8192,
+	}
+	dir := fscommon.PinDir(fakeCgroupDir)
+	defer dir.Close()
+	if err := setMemory(dir, r); err != nil {
+		t.Fatal(err)
+	}
+	for file, expected := range map[string]string{
+		"memory.min": "4096",
+		"memory.low": "8192",
+	} {
+		data, err := ioutil.ReadFile(filepath.Join(fakeCgroupDir, file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != expected {
+			t.Errorf("%s: expected %q, got %q", file, expected, data)
+		}
+	}
+}
+
+// writeFiles writes the files of a fake cgroup dir, creating it.
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for file, data := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, file), []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// checkFiles checks the content of the files of a fake cgroup dir.
+func checkFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for file, expected := range files {
+		data, err := ioutil.ReadFile(filepath.Join(dir, file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != expected {
+			t.Errorf("%s/%s: expected %q, got %q", dir, file, expected, data)
+		}
+	}
+}
+
+func TestPropagateMemoryProtection(t *testing.T) {
+	testMode := fscommon.TestMode
+	fscommon.TestMode = true
+	defer func() {
+		fscommon.TestMode = testMode
+	}()
+
+	root, err := ioutil.TempDir("", "runc-memory-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	// The parents created for the containers, which are siblings.
+	parents := []string{filepath.Join(root, "a"), filepath.Join(root, "a", "b")}
+	for _, dir := range parents {
+		writeFiles(t, dir, map[string]string{"memory.min": "0", "memory.low": "0"})
+	}
+	c1 := filepath.Join(parents[1], "c1")
+	writeFiles(t, c1, map[string]string{"memory.min": "4096", "memory.low": "8192"})
+	c2 := filepath.Join(parents[1], "c2")
+	writeFiles(t, c2, map[string]string{"memory.min": "1024", "memory.low": "max"})
+	// A child without the memory controller.
+	writeFiles(t, filepath.Join(parents[1], "other"), nil)
+
+	// The protections of the siblings are summed.
+	if err := PropagateMemoryProtection(parents); err != nil {
+		t.Fatal(err)
+	}
+	for _, dir := range parents {
+		checkFiles(t, dir, map[string]string{"memory.min": "5120", "memory.low": "max"})
+	}
+
+	// Once the containers are destroyed, the protections of the parents
+	// are reverted.
+	if err := os.RemoveAll(c2); err != nil {
+		t.Fatal(err)
+	}
+	if err := PropagateMemoryProtection(parents); err != nil {
+		t.Fatal(err)
+	}
+	for _, dir := range parents {
+		checkFiles(t, dir, map[string]string{"memory.min": "4096", "memory.low": "8192"})
+	}
+	if err := os.RemoveAll(c1); err != nil {
+		t.Fatal(err)
+	}
+	if err := PropagateMemoryProtection(parents); err != nil {
+		t.Fatal(err)
+	}
+	for _, dir := range parents {
+		checkFiles(t, dir, map[string]string{"memory.min": "0", "memory.low": "0"})
+	}
+
+	// The parents which no longer exist are skipped.
+	if err := os.RemoveAll(parents[0]); err != nil {
+		t.Fatal(err)
+	}
+	if err := PropagateMemoryProtection(parents); err != nil {
+		t.Fatal(err)
+	}
+}
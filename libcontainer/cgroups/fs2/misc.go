@@ -0,0 +1,104 @@
+// +build linux
+
+package fs2
+
+import (
+	"bufio"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/opencontainers/runc/libcontainer/cgroups"
+	"github.com/opencontainers/runc/libcontainer/cgroups/fscommon"
+	"github.com/opencontainers/runc/libcontainer/configs"
+	"github.com/pkg/errors"
+)
+
+func isMiscSet(r *configs.Resources) bool {
+	return len(r.Misc) > 0
+}
+
+func setMisc(dir *fscommon.PinnedDir, r *configs.Resources) error {
+	if !isMiscSet(r) {
+		return nil
+	}
+	// Sort the resource names so the order of writes is deterministic.
+	names := make([]string, 0, len(r.Misc))
+	for name := range r.Misc {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		val := "max"
+		if limit := r.Misc[name]; limit != -1 {
+			val = strconv.FormatInt(limit, 10)
+		}
+		if err := dir.WriteFile("misc.max", name+" "+val); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// readMiscFile parses a flat keyed misc.* file, calling fn for every entry.
+func readMiscFile(dir *fscommon.PinnedDir, file string, fn func(key string, value uint64)) error {
+	f, err := dir.OpenFile(file, os.O_RDONLY)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		parts := strings.Fields(sc.Text())
+		if len(parts) != 2 {
+			return errors.Errorf("failed to parse %s: invalid line %q", file, sc.Text())
+		}
+		value := uint64(math.MaxUint64)
+		if parts[1] != "max" {
+			value, err = fscommon.ParseUint(parts[1], 10, 64)
+			if err != nil {
+				return errors.Wrapf(err, "failed to parse %s", file)
+			}
+		}
+		fn(parts[0], value)
+	}
+	return sc.Err()
+}
+
+func statMisc(dir *fscommon.PinnedDir, stats *cgroups.Stats) error {
+	if err := readMiscFile(dir, "misc.current", func(name string, v uint64) {
+		s := stats.MiscStats[name]
+		s.Usage = v
+		stats.MiscStats[name] = s
+	}); err != nil {
+		return err
+	}
+	if err := readMiscFile(dir, "misc.max", func(name string, v uint64) {
+		s := stats.MiscStats[name]
+		s.Limit = v
+		stats.MiscStats[name] = s
+	}); err != nil {
+		return err
+	}
+	// misc.events is available since kernel 5.14.
+	err := readMiscFile(dir, "misc.events", func(key string, v uint64) {
+		// The keys are in the "<name>.max" format.
+		name := strings.TrimSuffix(key, ".max")
+		if name == key {
+			return
+		}
+		s := stats.MiscStats[name]
+		s.Events = v
+		stats.MiscStats[name] = s
+	})
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return nil
+}
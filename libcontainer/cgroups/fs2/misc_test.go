@@ -0,0 +1,72 @@
+// +build linux
+
+package fs2
+
+import (
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/opencontainers/runc/libcontainer/cgroups"
+	"github.com/opencontainers/runc/libcontainer/cgroups/fscommon"
+	"github.com/opencontainers/runc/libcontainer/configs"
+)
+
+func TestSetMisc(t *testing.T) {
+	fakeCgroupDir, err := ioutil.TempDir("", "runc-misc-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(fakeCgroupDir)
+
+	r := &configs.Resources{
+		Misc: map[string]int64{"sev_es": -1},
+	}
+	dir := fscommon.PinDir(fakeCgroupDir)
+	defer dir.Close()
+	if err := setMisc(dir, r); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(filepath.Join(fakeCgroupDir, "misc.max"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "sev_es max" {
+		t.Errorf("expected %q, got %q", "sev_es max", data)
+	}
+}
+
+func TestStatMisc(t *testing.T) {
+	fakeCgroupDir, err := ioutil.TempDir("", "runc-misc-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(fakeCgroupDir)
+
+	for file, data := range map[string]string{
+		"misc.current": "sev 2\nsev_es 0\n",
+		"misc.max":     "sev 10\nsev_es max\n",
+		"misc.events":  "sev.max 3\nsev_es.max 0\n",
+	} {
+		if err := ioutil.WriteFile(filepath.Join(fakeCgroupDir, file), []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	st := cgroups.NewStats()
+	dir := fscommon.PinDir(fakeCgroupDir)
+	defer dir.Close()
+	if err := statMisc(dir, st); err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]cgroups.MiscStats{
+		"sev":    {Usage: 2, Limit: 10, Events: 3},
+		"sev_es": {Usage: 0, Limit: math.MaxUint64, Events: 0},
+	}
+	if !reflect.DeepEqual(st.MiscStats, expected) {
+		t.Errorf("expected %+v, got %+v", expected, st.MiscStats)
+	}
+}
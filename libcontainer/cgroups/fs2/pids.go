@@ -18,12 +18,12 @@ func isPidsSet(r *configs.Resources) bool {
 	return r.PidsLimit != 0
 }
 
-func setPids(dirPath string, r *configs.Resources) error {
+func setPids(dir *fscommon.PinnedDir, r *configs.Resources) error {
 	if !isPidsSet(r) {
 		return nil
 	}
 	if val := numToStr(r.PidsLimit); val != "" {
-		if err := fscommon.WriteFile(dirPath, "pids.max", val); err != nil {
+		if err := dir.WriteFile("pids.max", val); err != nil {
 			return err
 		}
 	}
@@ -31,12 +31,12 @@ func setPids(dirPath string, r *configs.Resources) error {
 	return nil
 }
 
-func statPidsFromCgroupProcs(dirPath string, stats *cgroups.Stats) error {
+func statPidsFromCgroupProcs(dir *fscommon.PinnedDir, stats *cgroups.Stats) error {
 	// if the controller is not enabled, let's read PIDS from cgroups.procs
 	// (or threads if cgroup.threads is enabled)
-	contents, err := fscommon.ReadFile(dirPath, "cgroup.procs")
+	contents, err := dir.ReadFile("cgroup.procs")
 	if errors.Is(err, unix.ENOTSUP) {
-		contents, err = fscommon.ReadFile(dirPath, "cgroup.threads")
+		contents, err = dir.ReadFile("cgroup.threads")
 	}
 	if err != nil {
 		return err
@@ -47,16 +47,16 @@ func statPidsFromCgroupProcs(dirPath string, stats *cgroups.Stats) error {
 	return nil
 }
 
-func statPids(dirPath string, stats *cgroups.Stats) error {
-	current, err := fscommon.GetCgroupParamUint(dirPath, "pids.current")
+func statPids(dir *fscommon.PinnedDir, stats *cgroups.Stats) error {
+	current, err := dir.GetCgroupParamUint("pids.current")
 	if err != nil {
 		if os.IsNotExist(err) {
-			return statPidsFromCgroupProcs(dirPath, stats)
+			return statPidsFromCgroupProcs(dir, stats)
 		}
 		return errors.Wrap(err, "failed to parse pids.current")
 	}
 
-	maxString, err := fscommon.GetCgroupParamString(dirPath, "pids.max")
+	maxString, err := dir.GetCgroupParamString("pids.max")
 	if err != nil {
 		return errors.Wrap(err, "failed to parse pids.max")
 	}
@@ -67,7 +67,7 @@ func statPids(dirPath string, stats *cgroups.Stats) error {
 		max, err = fscommon.ParseUint(maxString, 10, 64)
 		if err != nil {
 			return errors.Wrapf(err, "failed to parse pids.max - unable to parse %q as a uint from Cgroup file %q",
-				maxString, filepath.Join(dirPath, "pids.max"))
+				maxString, filepath.Join(dir.Path(), "pids.max"))
 		}
 	}
 
@@ -0,0 +1,99 @@
+// +build linux
+
+package fs2
+
+import (
+	"bufio"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/opencontainers/runc/libcontainer/cgroups"
+	"github.com/opencontainers/runc/libcontainer/cgroups/fscommon"
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+)
+
+// statPSI reads a {cpu,memory,io}.pressure file. If PSI is not available
+// (kernel < 4.20, CONFIG_PSI is not set, or it is disabled with psi=0), nil
+// stats are returned.
+func statPSI(dir *fscommon.PinnedDir, file string) (*cgroups.PSIStats, error) {
+	f, err := dir.OpenFile(file, os.O_RDONLY)
+	if err != nil {
+		if psiNotSupported(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	var psistats cgroups.PSIStats
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		parts := strings.Fields(sc.Text())
+		if len(parts) == 0 {
+			continue
+		}
+		var pv *cgroups.PSIData
+		switch parts[0] {
+		case "some":
+			pv = &psistats.Some
+		case "full":
+			pv = &psistats.Full
+		}
+		if pv != nil {
+			*pv, err = parsePSIData(parts[1:])
+			if err != nil {
+				return nil, errors.Wrapf(err, "failed to parse %s", file)
+			}
+		}
+	}
+	if err := sc.Err(); err != nil {
+		if psiNotSupported(err) {
+			return nil, nil
+		}
+		return nil, errors.Wrapf(err, "failed to read %s", file)
+	}
+	return &psistats, nil
+}
+
+// psiNotSupported reports whether err means that PSI is not available. With
+// psi=0, the pressure files exist, but reading them fails with EOPNOTSUPP.
+func psiNotSupported(err error) bool {
+	return os.IsNotExist(err) || errors.Is(err, unix.ENOTSUP) || errors.Is(err, unix.EOPNOTSUPP)
+}
+
+// parsePSIData parses the fields of a "some" or "full" line, for example,
+// "avg10=0.00 avg60=0.00 avg300=0.00 total=0".
+func parsePSIData(psi []string) (cgroups.PSIData, error) {
+	data := cgroups.PSIData{}
+	for _, f := range psi {
+		kv := strings.SplitN(f, "=", 2)
+		if len(kv) != 2 {
+			return data, errors.Errorf("invalid psi data: %q", f)
+		}
+		var pv *float64
+		switch kv[0] {
+		case "avg10":
+			pv = &data.Avg10
+		case "avg60":
+			pv = &data.Avg60
+		case "avg300":
+			pv = &data.Avg300
+		case "total":
+			v, err := strconv.ParseUint(kv[1], 10, 64)
+			if err != nil {
+				return data, errors.Wrapf(err, "invalid %s PSI value", kv[0])
+			}
+			data.Total = v
+		}
+		if pv != nil {
+			v, err := strconv.ParseFloat(kv[1], 64)
+			if err != nil {
+				return data, errors.Wrapf(err, "invalid %s PSI value", kv[0])
+			}
+			*pv = v
+		}
+	}
+	return data, nil
+}
@@ -0,0 +1,103 @@
+// +build linux
+
+package fs2
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/opencontainers/runc/libcontainer/cgroups"
+	"github.com/opencontainers/runc/libcontainer/cgroups/fscommon"
+	"golang.org/x/sys/unix"
+)
+
+func init() {
+	fscommon.TestMode = true
+}
+
+func TestStatCPUPSI(t *testing.T) {
+	const examplePSIData = `some avg10=1.71 avg60=2.36 avg300=2.57 total=230548833
+full avg10=1.00 avg60=1.01 avg300=1.00 total=157622356`
+
+	fakeCgroupDir, err := ioutil.TempDir("", "runc-psi-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(fakeCgroupDir)
+	statPath := filepath.Join(fakeCgroupDir, "cpu.pressure")
+	if err := ioutil.WriteFile(statPath, []byte(examplePSIData), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	dir := fscommon.PinDir(fakeCgroupDir)
+	defer dir.Close()
+	st, err := statPSI(dir, "cpu.pressure")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := &cgroups.PSIStats{
+		Some: cgroups.PSIData{
+			Avg10:  1.71,
+			Avg60:  2.36,
+			Avg300: 2.57,
+			Total:  230548833,
+		},
+		Full: cgroups.PSIData{
+			Avg10:  1.00,
+			Avg60:  1.01,
+			Avg300: 1.00,
+			Total:  157622356,
+		},
+	}
+	if !reflect.DeepEqual(st, expected) {
+		t.Errorf("expected %+v, got %+v", expected, st)
+	}
+}
+
+func TestStatPSINotExist(t *testing.T) {
+	fakeCgroupDir, err := ioutil.TempDir("", "runc-psi-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(fakeCgroupDir)
+
+	dir := fscommon.PinDir(fakeCgroupDir)
+	defer dir.Close()
+	st, err := statPSI(dir, "memory.pressure")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st != nil {
+		t.Errorf("expected nil stats, got %+v", st)
+	}
+}
+
+func TestParsePSIDataInvalid(t *testing.T) {
+	for _, in := range [][]string{
+		{"avg10"},
+		{"avg10=abc"},
+		{"total=-1"},
+	} {
+		if _, err := parsePSIData(in); err == nil {
+			t.Errorf("%q: expected error, got nil", in)
+		}
+	}
+}
+
+func TestPSINotSupported(t *testing.T) {
+	for _, tc := range []struct {
+		err      error
+		expected bool
+	}{
+		{&os.PathError{Op: "open", Path: "cpu.pressure", Err: unix.ENOENT}, true},
+		{&os.PathError{Op: "read", Path: "cpu.pressure", Err: unix.EOPNOTSUPP}, true},
+		{&os.PathError{Op: "read", Path: "cpu.pressure", Err: unix.EIO}, false},
+	} {
+		if got := psiNotSupported(tc.err); got != tc.expected {
+			t.Errorf("psiNotSupported(%v): expected %v, got %v", tc.err, tc.expected, got)
+		}
+	}
+}
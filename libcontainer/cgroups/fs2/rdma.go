@@ -0,0 +1,11 @@
+// +build linux
+
+package fs2
+
+import (
+	"github.com/opencontainers/runc/libcontainer/configs"
+)
+
+func isRdmaSet(r *configs.Resources) bool {
+	return len(r.Rdma) > 0
+}
@@ -0,0 +1,25 @@
+// +build linux
+
+package fs2
+
+import (
+	"os"
+
+	"github.com/opencontainers/runc/libcontainer/cgroups/ebpf"
+	"github.com/opencontainers/runc/libcontainer/configs"
+	"golang.org/x/sys/unix"
+)
+
+// setSockCreateFilter restricts the address families of the sockets which
+// can be created in the cgroup, if requested.
+func setSockCreateFilter(dirPath string, r *configs.Resources) error {
+	if r.AllowedAddressFamilies == nil {
+		return nil
+	}
+	dirFD, err := unix.Open(dirPath, unix.O_DIRECTORY|unix.O_RDONLY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return &os.PathError{Op: "open", Path: dirPath, Err: err}
+	}
+	defer unix.Close(dirFD) //nolint: errcheck
+	return ebpf.SetCgroupSockCreateFilter(dirFD, r.AllowedAddressFamilies)
+}
@@ -0,0 +1,123 @@
+// +build linux
+
+package fs2
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/opencontainers/runc/libcontainer/cgroups"
+	"github.com/opencontainers/runc/libcontainer/cgroups/fscommon"
+)
+
+// UnifiedError is the error for a key of Resources.Unified which can't be
+// set.
+type UnifiedError struct {
+	Key   string
+	Value string
+	Err   error
+}
+
+func (e *UnifiedError) Error() string {
+	return fmt.Sprintf("unified resource %q (value %q): %v", e.Key, e.Value, e.Err)
+}
+
+func (e *UnifiedError) Unwrap() error {
+	return e.Err
+}
+
+// CheckUnified checks, without writing anything, whether the keys of
+// Resources.Unified res can be set in the cgroup dirPath, and returns the
+// errors for those which can't, sorted by key. The cgroup does not have to
+// exist yet, in which case the controllers are checked against its nearest
+// existing ancestor.
+//
+// Only the key is checked: whether the value is accepted is only known to
+// the kernel once it's written.
+func CheckUnified(dirPath string, res map[string]string) []*UnifiedError {
+	keys := make([]string, 0, len(res))
+	for k := range res {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var (
+		errs        []*UnifiedError
+		controllers map[string]struct{}
+		ctrlErr     error
+		exists      = cgroups.PathExists(dirPath)
+	)
+	for _, k := range keys {
+		if controllers == nil && ctrlErr == nil {
+			controllers, ctrlErr = availableControllers(dirPath)
+		}
+		err := ctrlErr
+		if err == nil {
+			err = checkUnifiedKey(k, controllers)
+		}
+		if err == nil && exists {
+			err = checkUnifiedFile(dirPath, k)
+		}
+		if err != nil {
+			errs = append(errs, &UnifiedError{Key: k, Value: res[k], Err: err})
+		}
+	}
+	return errs
+}
+
+// checkUnifiedKey checks that k is the name of an interface file of either
+// the cgroup core or one of the controllers. A nil controllers map disables
+// the controller check.
+func checkUnifiedKey(k string, controllers map[string]struct{}) error {
+	if strings.Contains(k, "/") {
+		return errors.New("must be a file name (no slashes)")
+	}
+	sk := strings.SplitN(k, ".", 2)
+	if len(sk) != 2 || sk[0] == "" || sk[1] == "" {
+		return errors.New("must be in the form CONTROLLER.PARAMETER")
+	}
+	if c := sk[0]; controllers != nil && c != "cgroup" {
+		if _, ok := controllers[c]; !ok {
+			return fmt.Errorf("controller %q not available (not in cgroup.controllers)", c)
+		}
+	}
+	return nil
+}
+
+func checkUnifiedFile(dirPath, k string) error {
+	path := filepath.Join(dirPath, k)
+	fi, err := os.Stat(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("no such file %s", path)
+		}
+		return err
+	}
+	if fi.Mode().Perm()&0o222 == 0 {
+		return fmt.Errorf("file %s is read-only", path)
+	}
+	return nil
+}
+
+// availableControllers returns the controllers listed in cgroup.controllers
+// of dirPath, or of its nearest existing ancestor.
+func availableControllers(dirPath string) (map[string]struct{}, error) {
+	for dir := dirPath; ; dir = filepath.Dir(dir) {
+		data, err := fscommon.ReadFile(dir, "cgroup.controllers")
+		if err == nil {
+			fields := strings.Fields(data)
+			controllers := make(map[string]struct{}, len(fields))
+			for _, c := range fields {
+				controllers[c] = struct{}{}
+			}
+			return controllers, nil
+		}
+		if !os.IsNotExist(err) || dir == UnifiedMountpoint || dir == filepath.Dir(dir) {
+			return nil, err
+		}
+	}
+}
@@ -0,0 +1,67 @@
+// +build linux
+
+package fs2
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCheckUnified(t *testing.T) {
+	parent, err := ioutil.TempDir("", "runc-unified-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(parent)
+	dir := filepath.Join(parent, "child")
+
+	files := map[string]os.FileMode{
+		"cgroup.controllers": 0o444,
+		"memory.high":        0o644,
+		"memory.current":     0o444,
+	}
+	if err := ioutil.WriteFile(filepath.Join(parent, "cgroup.controllers"), []byte("cpu memory pids\n"), 0o444); err != nil {
+		t.Fatal(err)
+	}
+	res := map[string]string{
+		"memory.high":    "1000",
+		"memory.current": "1",
+		"memory.foo":     "1",
+		"io.max":         "8:0 rbps=1",
+		"../cpu.max":     "max",
+		"nodot":          "1",
+	}
+
+	// The cgroup does not exist yet: only the keys and the controllers
+	// of the parent are checked.
+	expected := []string{"../cpu.max", "io.max", "nodot"}
+	check := func() {
+		t.Helper()
+		errs := CheckUnified(dir, res)
+		if len(errs) != len(expected) {
+			t.Fatalf("expected errors for %v, got %v", expected, errs)
+		}
+		for i, err := range errs {
+			if err.Key != expected[i] {
+				t.Errorf("expected an error for %q, got %v", expected[i], err)
+			}
+		}
+	}
+	check()
+
+	if err := os.Mkdir(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for name, mode := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), nil, mode); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "cgroup.controllers"), []byte("memory\n"), 0o444); err != nil {
+		t.Fatal(err)
+	}
+	expected = []string{"../cpu.max", "io.max", "memory.current", "memory.foo", "nodot"}
+	check()
+}
@@ -18,6 +18,41 @@ func WriteFile(dir, file, data string) error {
 	if err != nil {
 		return err
 	}
+	return writeFile(fd, data)
+}
+
+// WriteFile is like the WriteFile function, for a file in the directory.
+func (d *PinnedDir) WriteFile(file, data string) error {
+	fd, err := d.OpenFile(file, unix.O_WRONLY)
+	if err != nil {
+		return err
+	}
+	return writeFile(fd, data)
+}
+
+// WriteFileBatch writes each of data to a cgroup file in the directory,
+// opening the file only once, which saves syscalls when a lot of values are
+// written to the same file, such as per-device limits. The values are written
+// by separate write(2) calls rather than a single writev(2), as the kernel
+// handles the data written at once as a single value.
+func (d *PinnedDir) WriteFileBatch(file string, data []string) error {
+	if len(data) == 0 {
+		return nil
+	}
+	fd, err := d.OpenFile(file, unix.O_WRONLY)
+	if err != nil {
+		return err
+	}
+	defer fd.Close()
+	for _, v := range data {
+		if err := retryingWriteFile(fd, v); err != nil {
+			return errors.Wrapf(err, "failed to write %q", v)
+		}
+	}
+	return nil
+}
+
+func writeFile(fd *os.File, data string) error {
 	defer fd.Close()
 	if err := retryingWriteFile(fd, data); err != nil {
 		return errors.Wrapf(err, "failed to write %q", data)
@@ -32,10 +67,23 @@ func ReadFile(dir, file string) (string, error) {
 	if err != nil {
 		return "", err
 	}
+	return readFile(fd)
+}
+
+// ReadFile is like the ReadFile function, for a file in the directory.
+func (d *PinnedDir) ReadFile(file string) (string, error) {
+	fd, err := d.OpenFile(file, unix.O_RDONLY)
+	if err != nil {
+		return "", err
+	}
+	return readFile(fd)
+}
+
+func readFile(fd *os.File) (string, error) {
 	defer fd.Close()
 	var buf bytes.Buffer
 
-	_, err = buf.ReadFrom(fd)
+	_, err := buf.ReadFrom(fd)
 	return buf.String(), err
 }
 
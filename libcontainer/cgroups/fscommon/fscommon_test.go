@@ -40,3 +40,132 @@ func TestWriteCgroupFileHandlesInterrupt(t *testing.T) {
 		}
 	}
 }
+
+func TestPinDir(t *testing.T) {
+	const memoryCgroupMount = "/sys/fs/cgroup/memory"
+	if _, err := os.Stat(memoryCgroupMount); err != nil {
+		// most probably cgroupv2
+		t.Skip(err)
+	}
+	if err := prepareOpenat2(); err != nil {
+		t.Skip(err)
+	}
+
+	cgroupName := fmt.Sprintf("test-pin-%d", time.Now().Nanosecond())
+	cgroupPath := filepath.Join(memoryCgroupMount, cgroupName)
+	if err := os.Mkdir(cgroupPath, 0755); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(cgroupPath)
+
+	dir := PinDir(cgroupPath)
+	defer dir.Close()
+	// A cgroup v1 directory can be renamed, which the pinned directory
+	// must follow.
+	renamedPath := cgroupPath + "-renamed"
+	if err := os.Rename(cgroupPath, renamedPath); err != nil {
+		t.Skip(err)
+	}
+	defer os.Remove(renamedPath)
+	if err := dir.WriteFile("memory.limit_in_bytes", "12345678"); err != nil {
+		t.Fatal(err)
+	}
+
+	value, err := GetCgroupParamUint(renamedPath, "memory.limit_in_bytes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The limit is rounded down to a multiple of the page size.
+	if value == 0 || value > 12345678 || value < 12345678-uint64(os.Getpagesize()) {
+		t.Errorf("expected a limit of about 12345678, got %d", value)
+	}
+	// The pinned directory is only used through dir.
+	if _, err := ReadFile(cgroupPath, "memory.limit_in_bytes"); !os.IsNotExist(err) {
+		t.Errorf("expected a not exist error, got %v", err)
+	}
+}
+
+func TestWriteFileBatch(t *testing.T) {
+	const memoryCgroupMount = "/sys/fs/cgroup/memory"
+	if _, err := os.Stat(memoryCgroupMount); err != nil {
+		// most probably cgroupv2
+		t.Skip(err)
+	}
+
+	cgroupName := fmt.Sprintf("test-batch-%d", time.Now().Nanosecond())
+	cgroupPath := filepath.Join(memoryCgroupMount, cgroupName)
+	if err := os.Mkdir(cgroupPath, 0755); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(cgroupPath)
+
+	dir := PinDir(cgroupPath)
+	defer dir.Close()
+	// Had the values been written at once, the limit would be set to
+	// 1234567823456789 instead.
+	if err := dir.WriteFileBatch("memory.limit_in_bytes", []string{"12345678", "23456789"}); err != nil {
+		t.Fatal(err)
+	}
+
+	value, err := GetCgroupParamUint(cgroupPath, "memory.limit_in_bytes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The limit is rounded down to a multiple of the page size.
+	if value == 0 || value > 23456789 || value < 23456789-uint64(os.Getpagesize()) {
+		t.Errorf("expected a limit of about 23456789, got %d", value)
+	}
+
+	if err := dir.WriteFileBatch("memory.limit_in_bytes", []string{"12345678", "invalid"}); err == nil {
+		t.Error("expected an error writing an invalid value")
+	}
+}
+
+func TestDirCache(t *testing.T) {
+	const memoryCgroupMount = "/sys/fs/cgroup/memory"
+	if _, err := os.Stat(memoryCgroupMount); err != nil {
+		// most probably cgroupv2
+		t.Skip(err)
+	}
+	if err := prepareOpenat2(); err != nil {
+		t.Skip(err)
+	}
+
+	cgroupName := fmt.Sprintf("test-dircache-%d", time.Now().Nanosecond())
+	cgroupPath := filepath.Join(memoryCgroupMount, cgroupName)
+	if err := os.Mkdir(cgroupPath, 0755); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(cgroupPath)
+
+	var c DirCache
+	dir := c.Get(cgroupPath)
+	if dir.dir == nil {
+		t.Fatalf("%s is not pinned", cgroupPath)
+	}
+	if c.Get(cgroupPath) != dir {
+		t.Fatal("expected the pinned directory to be cached")
+	}
+
+	// Once the cgroup is created again, the cached directory is the
+	// removed one, until the cache is reset.
+	if err := os.Remove(cgroupPath); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(cgroupPath, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Get(cgroupPath).ReadFile("memory.limit_in_bytes"); err == nil {
+		t.Fatal("expected an error reading a file of the removed cgroup")
+	}
+	c.Reset()
+	if dir.dir == nil {
+		t.Error("expected Reset to leave the cached directories open")
+	}
+	if c.Get(cgroupPath) == dir {
+		t.Fatal("expected Reset to drop the cached directories")
+	}
+	if _, err := c.Get(cgroupPath).ReadFile("memory.limit_in_bytes"); err != nil {
+		t.Fatal(err)
+	}
+}
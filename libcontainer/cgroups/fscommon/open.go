@@ -2,6 +2,7 @@ package fscommon
 
 import (
 	"os"
+	"runtime"
 	"strings"
 	"sync"
 
@@ -92,6 +93,119 @@ func OpenFile(dir, file string, flags int) (*os.File, error) {
 	return os.NewFile(uintptr(fd), cgroupfsPrefix+relname), nil
 }
 
+// PinnedDir is a cgroup directory opened by PinDir, so that the files in it
+// are opened relative to the directory fd (using openat2 with
+// RESOLVE_BENEATH), rather than resolving the full path of the directory
+// again for every file. This saves path lookups when a lot of files are
+// accessed, such as in the Set and GetStats methods of cgroup managers, and
+// makes sure all of them are in the same directory even if it is replaced
+// in the meantime.
+//
+// The directory fd is only used by the methods of the PinnedDir, so it is
+// up to the caller to pass it to the code accessing the files, and to close
+// it once done (unless it is owned by a DirCache).
+type PinnedDir struct {
+	path string
+	// dir is nil if the directory is not pinned. It is an *os.File rather
+	// than a plain fd, so that it is closed once unreachable, as is the case
+	// for the directories dropped by a DirCache (see Reset).
+	dir *os.File
+}
+
+// PinDir opens the cgroup directory path. If it can't be opened, or if
+// openat2(2) is not available, the methods of the returned PinnedDir open
+// the files by their full path, like OpenFile.
+func PinDir(path string) *PinnedDir {
+	d := &PinnedDir{path: path}
+	if prepareOpenat2() != nil {
+		return d
+	}
+	reldir := strings.TrimPrefix(path, cgroupfsPrefix)
+	if len(reldir) == len(path) {
+		return d
+	}
+	fd, err := unix.Openat2(cgroupFd, reldir, &unix.OpenHow{
+		Resolve: resolveFlags,
+		Flags:   unix.O_DIRECTORY | unix.O_PATH | unix.O_CLOEXEC,
+	})
+	if err == nil {
+		d.dir = os.NewFile(uintptr(fd), path)
+	}
+	return d
+}
+
+// Path returns the path of the directory.
+func (d *PinnedDir) Path() string {
+	return d.path
+}
+
+// Close closes the directory fd. The PinnedDir must not be used afterwards.
+func (d *PinnedDir) Close() {
+	if d.dir != nil {
+		_ = d.dir.Close()
+		d.dir = nil
+	}
+}
+
+// OpenFile is like the OpenFile function, for a file in the directory.
+func (d *PinnedDir) OpenFile(file string, flags int) (*os.File, error) {
+	if d.dir == nil {
+		return OpenFile(d.path, file, flags)
+	}
+	fd, err := unix.Openat2(int(d.dir.Fd()), file, &unix.OpenHow{
+		// The file is always directly in the directory.
+		Resolve: unix.RESOLVE_BENEATH | unix.RESOLVE_NO_MAGICLINKS | unix.RESOLVE_NO_SYMLINKS | unix.RESOLVE_NO_XDEV,
+		Flags:   uint64(flags) | unix.O_CLOEXEC,
+	})
+	runtime.KeepAlive(d.dir)
+	if err != nil {
+		return nil, &os.PathError{Op: "openat2", Path: d.path + "/" + file, Err: err}
+	}
+	return os.NewFile(uintptr(fd), d.path+"/"+file), nil
+}
+
+// DirCache caches the pinned cgroup directories of a cgroup manager, so
+// that they are opened once rather than in every Set or GetStats call. As
+// the cached directories would no longer be the ones at their paths once
+// the cgroups are removed and created again, the manager resets the cache
+// in Apply and Destroy.
+//
+// The zero value is an empty cache. It is safe for concurrent use.
+type DirCache struct {
+	mu   sync.Mutex
+	dirs map[string]*PinnedDir
+}
+
+// Get returns the pinned directory path, pinning it if it is not cached
+// yet. The returned PinnedDir is owned by the cache, and must not be
+// closed by the caller.
+func (c *DirCache) Get(path string) *PinnedDir {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if d, ok := c.dirs[path]; ok {
+		return d
+	}
+	d := PinDir(path)
+	// A directory which can't be pinned (it may not exist yet) is not
+	// cached, so that pinning it is tried again next time.
+	if d.dir != nil {
+		if c.dirs == nil {
+			c.dirs = make(map[string]*PinnedDir)
+		}
+		c.dirs[path] = d
+	}
+	return d
+}
+
+// Reset drops all the cached directories. They are not closed, as they
+// may still be used by concurrent calls (the ones returned by Get remain
+// valid), but rather once they are unreachable.
+func (c *DirCache) Reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.dirs = nil
+}
+
 var errNotCgroupfs = errors.New("not a cgroup file")
 
 // openFallback is used when openat2(2) is not available. It checks the opened
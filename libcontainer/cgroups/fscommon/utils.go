@@ -6,8 +6,12 @@ import (
 	"errors"
 	"fmt"
 	"math"
+	"os"
 	"strconv"
 	"strings"
+	"sync"
+
+	"golang.org/x/sys/unix"
 )
 
 var (
@@ -61,8 +65,21 @@ func GetValueByKey(path, file, key string) (uint64, error) {
 	if err != nil {
 		return 0, err
 	}
+	return getValueByKey(content, key)
+}
+
+// GetValueByKey is like the GetValueByKey function, for a file in the
+// directory.
+func (d *PinnedDir) GetValueByKey(file, key string) (uint64, error) {
+	content, err := d.ReadFile(file)
+	if err != nil {
+		return 0, err
+	}
+	return getValueByKey(content, key)
+}
 
-	lines := strings.Split(string(content), "\n")
+func getValueByKey(content, key string) (uint64, error) {
+	lines := strings.Split(content, "\n")
 	for _, line := range lines {
 		arr := strings.Split(line, " ")
 		if len(arr) == 2 && arr[0] == key {
@@ -80,7 +97,20 @@ func GetCgroupParamUint(path, file string) (uint64, error) {
 	if err != nil {
 		return 0, err
 	}
-	contents = strings.TrimSpace(contents)
+	return parseCgroupParamUint(contents, path, file)
+}
+
+// GetCgroupParamUint is like the GetCgroupParamUint function, for a file in
+// the directory.
+func (d *PinnedDir) GetCgroupParamUint(file string) (uint64, error) {
+	contents, err := d.GetCgroupParamString(file)
+	if err != nil {
+		return 0, err
+	}
+	return parseCgroupParamUint(contents, d.path, file)
+}
+
+func parseCgroupParamUint(contents, path, file string) (uint64, error) {
 	if contents == "max" {
 		return math.MaxUint64, nil
 	}
@@ -95,11 +125,24 @@ func GetCgroupParamUint(path, file string) (uint64, error) {
 // GetCgroupParamInt reads a single int64 value from specified cgroup file.
 // If the value read is "max", the math.MaxInt64 is returned.
 func GetCgroupParamInt(path, file string) (int64, error) {
-	contents, err := ReadFile(path, file)
+	contents, err := GetCgroupParamString(path, file)
 	if err != nil {
 		return 0, err
 	}
-	contents = strings.TrimSpace(contents)
+	return parseCgroupParamInt(contents, path, file)
+}
+
+// GetCgroupParamInt is like the GetCgroupParamInt function, for a file in
+// the directory.
+func (d *PinnedDir) GetCgroupParamInt(file string) (int64, error) {
+	contents, err := d.GetCgroupParamString(file)
+	if err != nil {
+		return 0, err
+	}
+	return parseCgroupParamInt(contents, d.path, file)
+}
+
+func parseCgroupParamInt(contents, path, file string) (int64, error) {
 	if contents == "max" {
 		return math.MaxInt64, nil
 	}
@@ -120,3 +163,121 @@ func GetCgroupParamString(path, file string) (string, error) {
 
 	return strings.TrimSpace(contents), nil
 }
+
+// GetCgroupParamString is like the GetCgroupParamString function, for a
+// file in the directory.
+func (d *PinnedDir) GetCgroupParamString(file string) (string, error) {
+	contents, err := d.ReadFile(file)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(contents), nil
+}
+
+// RunConcurrently calls fn(i) for each i in [0, n) concurrently, and
+// returns the errors of the calls, indexed by i. This is meant to be used
+// for operations on cgroup v1 subsystems, which are independent from each
+// other; the callers can handle the errors in order, as if the calls were
+// made serially.
+func RunConcurrently(n int, fn func(i int) error) []error {
+	errs := make([]error, n)
+	var wg sync.WaitGroup
+	wg.Add(n)
+	for i := 0; i < n; i++ {
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = fn(i)
+		}(i)
+	}
+	wg.Wait()
+	return errs
+}
+
+// RunGrouped is like RunConcurrently, except that the calls for which
+// group(i) returns the same value are made serially, in order. This is meant
+// for the operations on co-mounted cgroup v1 subsystems (such as cpu and
+// cpuacct), which share a directory and so may interfere with each other.
+func RunGrouped(n int, group func(i int) string, fn func(i int) error) []error {
+	var (
+		keys   []string
+		groups = make(map[string][]int)
+	)
+	for i := 0; i < n; i++ {
+		k := group(i)
+		if _, ok := groups[k]; !ok {
+			keys = append(keys, k)
+		}
+		groups[k] = append(groups[k], i)
+	}
+	errs := make([]error, n)
+	RunConcurrently(len(keys), func(g int) error {
+		for _, i := range groups[keys[g]] {
+			errs[i] = fn(i)
+		}
+		return nil
+	})
+	return errs
+}
+
+// RunConcurrentlyExcept is like RunConcurrently, except that the calls for
+// which serial(i) is true are made serially, in order, after the others.
+func RunConcurrentlyExcept(n int, serial func(i int) bool, fn func(i int) error) []error {
+	errs := RunConcurrently(n, func(i int) error {
+		if serial(i) {
+			return nil
+		}
+		return fn(i)
+	})
+	for i := 0; i < n; i++ {
+		if serial(i) {
+			errs[i] = fn(i)
+		}
+	}
+	return errs
+}
+
+// SetSerially reports whether the resources of a cgroup v1 subsystem have to
+// be set after the ones of the other subsystems, rather than concurrently:
+// updating the devices rules briefly denies all the devices, and the freezer
+// state must be set once the other resources are.
+func SetSerially(subsystem string) bool {
+	return subsystem == "devices" || subsystem == "freezer"
+}
+
+// SetCPUQuotaAndBurst sets the CPU quota by calling setQuota (nil if the
+// quota is left unchanged), and the CPU burst (if not nil) by calling
+// writeBurst, in the order accepted by the kernel, which requires the burst
+// to be not greater than the quota. When the quota is decreased, the burst
+// must be written first, while it must be written last when the quota is
+// increased, so the burst is written first, and if it is rejected (with
+// EINVAL), written again once the quota is set.
+func SetCPUQuotaAndBurst(burst *uint64, setQuota func() error, writeBurst func(string) error) error {
+	var (
+		value string
+		retry bool
+	)
+	if burst != nil {
+		value = strconv.FormatUint(*burst, 10)
+		if err := writeBurst(value); err != nil {
+			switch {
+			case os.IsNotExist(err) && *burst == 0:
+				// Kernels < 5.14 do not support the burst; ignore
+				// this unless a non-zero burst is requested.
+			case setQuota != nil && errors.Is(err, unix.EINVAL):
+				retry = true
+			default:
+				return err
+			}
+		}
+	}
+	if setQuota != nil {
+		if err := setQuota(); err != nil {
+			return err
+		}
+	}
+	if retry {
+		return writeBurst(value)
+	}
+	return nil
+}
@@ -3,12 +3,16 @@
 package fscommon
 
 import (
+	"errors"
 	"io/ioutil"
 	"math"
 	"os"
 	"path/filepath"
 	"strconv"
+	"sync"
 	"testing"
+
+	"golang.org/x/sys/unix"
 )
 
 const (
@@ -99,3 +103,152 @@ func TestGetCgroupParamsInt(t *testing.T) {
 		t.Fatal("Expecting error, got none")
 	}
 }
+
+func TestRunConcurrently(t *testing.T) {
+	const n = 10
+	var called [n]bool
+	errs := RunConcurrently(n, func(i int) error {
+		called[i] = true
+		if i%3 == 0 {
+			return errors.New(strconv.Itoa(i))
+		}
+		return nil
+	})
+	if len(errs) != n {
+		t.Fatalf("expected %d errors, got %d", n, len(errs))
+	}
+	for i, err := range errs {
+		if !called[i] {
+			t.Errorf("fn(%d) was not called", i)
+		}
+		if i%3 == 0 {
+			if err == nil || err.Error() != strconv.Itoa(i) {
+				t.Errorf("expected error %d, got %v", i, err)
+			}
+		} else if err != nil {
+			t.Errorf("expected no error for %d, got %v", i, err)
+		}
+	}
+}
+
+func TestRunGrouped(t *testing.T) {
+	const n = 10
+	var (
+		mu    sync.Mutex
+		calls = make(map[int][]int)
+	)
+	group := func(i int) string { return strconv.Itoa(i % 3) }
+	errs := RunGrouped(n, group, func(i int) error {
+		mu.Lock()
+		calls[i%3] = append(calls[i%3], i)
+		mu.Unlock()
+		if i == 4 {
+			return errors.New("4")
+		}
+		return nil
+	})
+	for g, c := range calls {
+		for j := 1; j < len(c); j++ {
+			if c[j-1] > c[j] {
+				t.Errorf("expected the calls of group %d to be made in order, got %v", g, c)
+			}
+		}
+	}
+	if l := len(calls[0]) + len(calls[1]) + len(calls[2]); l != n {
+		t.Fatalf("expected %d calls, got %d", n, l)
+	}
+	for i, err := range errs {
+		if (err != nil) != (i == 4) {
+			t.Errorf("unexpected error for %d: %v", i, err)
+		}
+	}
+}
+
+func TestRunConcurrentlyExcept(t *testing.T) {
+	const n = 10
+	var (
+		mu    sync.Mutex
+		calls []int
+	)
+	serial := func(i int) bool { return i == 2 || i == 5 }
+	errs := RunConcurrentlyExcept(n, serial, func(i int) error {
+		mu.Lock()
+		calls = append(calls, i)
+		mu.Unlock()
+		if i == 5 {
+			return errors.New("5")
+		}
+		return nil
+	})
+	if len(calls) != n {
+		t.Fatalf("expected %d calls, got %v", n, calls)
+	}
+	if calls[n-2] != 2 || calls[n-1] != 5 {
+		t.Errorf("expected the serial calls to be made last and in order, got %v", calls)
+	}
+	for i, err := range errs {
+		if (err != nil) != (i == 5) {
+			t.Errorf("unexpected error for %d: %v", i, err)
+		}
+	}
+}
+
+func TestSetCPUQuotaAndBurst(t *testing.T) {
+	testCases := []struct {
+		name          string
+		quota, burst  uint64
+		newQuota      uint64 // 0 if the quota is left unchanged
+		newBurst      uint64
+		expectedErr   bool
+		expectedQuota uint64
+		expectedBurst uint64
+	}{
+		{name: "quota increase", quota: 50000, newQuota: 200000, newBurst: 100000, expectedQuota: 200000, expectedBurst: 100000},
+		{name: "quota decrease", quota: 200000, burst: 100000, newQuota: 50000, newBurst: 20000, expectedQuota: 50000, expectedBurst: 20000},
+		{name: "burst only", quota: 200000, burst: 20000, newBurst: 100000, expectedQuota: 200000, expectedBurst: 100000},
+		{name: "burst only above quota", quota: 50000, newBurst: 100000, expectedErr: true, expectedQuota: 50000},
+		{name: "burst above new quota", quota: 50000, newQuota: 80000, newBurst: 100000, expectedErr: true, expectedQuota: 80000},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// Emulate the kernel, which rejects a burst greater than the
+			// quota, and a quota smaller than the burst.
+			quota, burst := tc.quota, tc.burst
+			var setQuota func() error
+			if tc.newQuota != 0 {
+				setQuota = func() error {
+					if tc.newQuota < burst {
+						return &os.PathError{Op: "write", Path: "cpu.max", Err: unix.EINVAL}
+					}
+					quota = tc.newQuota
+					return nil
+				}
+			}
+			writeBurst := func(v string) error {
+				b, err := strconv.ParseUint(v, 10, 64)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if b > quota {
+					return &os.PathError{Op: "write", Path: "cpu.max.burst", Err: unix.EINVAL}
+				}
+				burst = b
+				return nil
+			}
+			err := SetCPUQuotaAndBurst(&tc.newBurst, setQuota, writeBurst)
+			if tc.expectedErr {
+				if err == nil {
+					t.Fatal("expected an error, got none")
+				}
+			} else if err != nil {
+				t.Fatal(err)
+			}
+			if quota != tc.expectedQuota {
+				t.Errorf("expected quota %d, got %d", tc.expectedQuota, quota)
+			}
+			if !tc.expectedErr && burst != tc.expectedBurst {
+				t.Errorf("expected burst %d, got %d", tc.expectedBurst, burst)
+			}
+		})
+	}
+}
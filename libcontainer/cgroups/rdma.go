@@ -0,0 +1,109 @@
+// +build linux
+
+package cgroups
+
+import (
+	"bufio"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/opencontainers/runc/libcontainer/cgroups/fscommon"
+	"github.com/opencontainers/runc/libcontainer/configs"
+	"github.com/pkg/errors"
+)
+
+// SetRdma writes r.Rdma limits to the rdma.max file in dir.
+// The file format is the same for cgroup v1 and v2.
+func SetRdma(dir *fscommon.PinnedDir, r *configs.Resources) error {
+	if len(r.Rdma) == 0 {
+		return nil
+	}
+	// Sort the device names so the order of writes is deterministic.
+	devs := make([]string, 0, len(r.Rdma))
+	for dev := range r.Rdma {
+		devs = append(devs, dev)
+	}
+	sort.Strings(devs)
+
+	for _, dev := range devs {
+		limits := r.Rdma[dev]
+		line := dev
+		if limits.HcaHandles != nil {
+			line += " hca_handle=" + strconv.FormatUint(uint64(*limits.HcaHandles), 10)
+		}
+		if limits.HcaObjects != nil {
+			line += " hca_object=" + strconv.FormatUint(uint64(*limits.HcaObjects), 10)
+		}
+		if line == dev {
+			continue
+		}
+		if err := dir.WriteFile("rdma.max", line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetRdmaStats reads the rdma.max and rdma.current files in dir into stats.
+func GetRdmaStats(dir *fscommon.PinnedDir, stats *Stats) error {
+	limits, err := parseRdmaFile(dir, "rdma.max")
+	if err != nil {
+		return err
+	}
+	current, err := parseRdmaFile(dir, "rdma.current")
+	if err != nil {
+		return err
+	}
+	stats.RdmaStats = RdmaStats{
+		RdmaLimit:   limits,
+		RdmaCurrent: current,
+	}
+	return nil
+}
+
+// parseRdmaFile parses rdma.max or rdma.current file, e.g.
+// "mlx4_0 hca_handle=2 hca_object=max".
+func parseRdmaFile(dir *fscommon.PinnedDir, file string) ([]RdmaEntry, error) {
+	f, err := dir.OpenFile(file, os.O_RDONLY)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []RdmaEntry
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		parts := strings.Fields(sc.Text())
+		if len(parts) == 0 {
+			continue
+		}
+		entry := RdmaEntry{Device: parts[0]}
+		for _, kv := range parts[1:] {
+			p := strings.SplitN(kv, "=", 2)
+			if len(p) != 2 {
+				return nil, errors.Errorf("failed to parse %s: invalid entry %q", file, kv)
+			}
+			v := uint64(math.MaxUint32)
+			if p[1] != "max" {
+				v, err = strconv.ParseUint(p[1], 10, 32)
+				if err != nil {
+					return nil, errors.Wrapf(err, "failed to parse %s", file)
+				}
+			}
+			switch p[0] {
+			case "hca_handle":
+				entry.HcaHandles = uint32(v)
+			case "hca_object":
+				entry.HcaObjects = uint32(v)
+			}
+		}
+		entries = append(entries, entry)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
@@ -1,5 +1,3 @@
-// +build linux
-
 package cgroups
 
 type ThrottlingData struct {
@@ -34,9 +32,39 @@ type CpuUsage struct {
 	UsageInUsermode uint64 `json:"usage_in_usermode"`
 }
 
+// PSIData is a single line of a cgroup v2 pressure stall information file.
+type PSIData struct {
+	// Share of time (in percent) some or all tasks were stalled, averaged
+	// over the last 10, 60 and 300 seconds.
+	Avg10  float64 `json:"avg10"`
+	Avg60  float64 `json:"avg60"`
+	Avg300 float64 `json:"avg300"`
+	// Total stall time.
+	// Units: microseconds.
+	Total uint64 `json:"total"`
+}
+
+// PSIStats holds the "some" and "full" lines of a cgroup v2
+// {cpu,memory,io}.pressure file.
+type PSIStats struct {
+	Some PSIData `json:"some,omitempty"`
+	Full PSIData `json:"full,omitempty"`
+}
+
+type BurstData struct {
+	// Number of periods in which bandwidth burst occurred.
+	BurstsPeriods uint64 `json:"bursts_periods,omitempty"`
+	// Cumulative wall-time that any CPU has used above quota in respective periods.
+	// Units: nanoseconds.
+	BurstTime uint64 `json:"burst_time,omitempty"`
+}
+
 type CpuStats struct {
 	CpuUsage       CpuUsage       `json:"cpu_usage,omitempty"`
 	ThrottlingData ThrottlingData `json:"throttling_data,omitempty"`
+	BurstData      BurstData      `json:"burst_data,omitempty"`
+	// pressure stall information (cgroup v2 only)
+	PSI *PSIStats `json:"psi,omitempty"`
 }
 
 type CPUSetStats struct {
@@ -64,6 +92,13 @@ type CPUSetStats struct {
 	SchedLoadBalance uint64 `json:"sched_load_balance"`
 	// sched_relax_domain_level
 	SchedRelaxDomainLevel int64 `json:"sched_relax_domain_level"`
+	// state of the cpuset partition, such as "member", "root" or
+	// "root invalid (reason)" (cgroup v2 only)
+	Partition string `json:"partition,omitempty"`
+	// List of the CPUs and memory nodes actually granted to the cpuset,
+	// which are those of its parent, restricted to the ones requested
+	EffectiveCPUs []uint16 `json:"effective_cpus,omitempty"`
+	EffectiveMems []uint16 `json:"effective_mems,omitempty"`
 }
 
 type MemoryData struct {
@@ -80,6 +115,10 @@ type MemoryStats struct {
 	Usage MemoryData `json:"usage,omitempty"`
 	// usage of memory + swap
 	SwapUsage MemoryData `json:"swap_usage,omitempty"`
+	// usage of swap only, excluding memory (cgroup v2 only)
+	SwapOnlyUsage MemoryData `json:"swap_only_usage,omitempty"`
+	// usage of the zswap pool (cgroup v2 only)
+	ZswapUsage MemoryData `json:"zswap_usage,omitempty"`
 	// usage of kernel memory
 	KernelUsage MemoryData `json:"kernel_usage,omitempty"`
 	// usage of kernel TCP memory
@@ -91,6 +130,30 @@ type MemoryStats struct {
 	UseHierarchy bool `json:"use_hierarchy"`
 
 	Stats map[string]uint64 `json:"stats,omitempty"`
+	// pressure stall information (cgroup v2 only)
+	PSI *PSIStats `json:"psi,omitempty"`
+	// memory events of the cgroup, including the ones of its descendants
+	Events *MemoryEvents `json:"events,omitempty"`
+	// memory events of the cgroup only (cgroup v2 only)
+	EventsLocal *MemoryEvents `json:"events_local,omitempty"`
+}
+
+// MemoryEvents are the memory event counters of a cgroup. With cgroup v1,
+// only Max (from memory.failcnt) and OomKill are available.
+type MemoryEvents struct {
+	// number of times the cgroup was reclaimed even though its usage was
+	// under the low boundary
+	Low uint64 `json:"low"`
+	// number of times the usage went over the high boundary, and the
+	// processes of the cgroup were throttled
+	High uint64 `json:"high"`
+	// number of times the usage was about to go over the limit
+	Max uint64 `json:"max"`
+	// number of times the usage reached the limit and the OOM killer was
+	// about to be invoked
+	Oom uint64 `json:"oom"`
+	// number of processes killed by the OOM killer
+	OomKill uint64 `json:"oom_kill"`
 }
 
 type PageUsageByNUMA struct {
@@ -135,6 +198,8 @@ type BlkioStats struct {
 	IoMergedRecursive       []BlkioStatEntry `json:"io_merged_recursive,omitempty"`
 	IoTimeRecursive         []BlkioStatEntry `json:"io_time_recursive,omitempty"`
 	SectorsRecursive        []BlkioStatEntry `json:"sectors_recursive,omitempty"`
+	// pressure stall information (cgroup v2 only)
+	PSI *PSIStats `json:"psi,omitempty"`
 }
 
 type HugetlbStats struct {
@@ -144,6 +209,45 @@ type HugetlbStats struct {
 	MaxUsage uint64 `json:"max_usage,omitempty"`
 	// number of times hugetlb usage allocation failure.
 	Failcnt uint64 `json:"failcnt"`
+	// usage, maximum usage and number of failures of the reservations of
+	// hugetlb pages (made by mmap and shmget before the pages are faulted),
+	// if the kernel supports their accounting (Linux 5.7+).
+	RsvdUsage    uint64 `json:"rsvd_usage,omitempty"`
+	RsvdMaxUsage uint64 `json:"rsvd_max_usage,omitempty"`
+	RsvdFailcnt  uint64 `json:"rsvd_failcnt,omitempty"`
+}
+
+type RdmaEntry struct {
+	Device     string `json:"device,omitempty"`
+	HcaHandles uint32 `json:"hca_handles,omitempty"`
+	HcaObjects uint32 `json:"hca_objects,omitempty"`
+}
+
+type RdmaStats struct {
+	RdmaLimit   []RdmaEntry `json:"rdma_limit,omitempty"`
+	RdmaCurrent []RdmaEntry `json:"rdma_current,omitempty"`
+}
+
+type MiscStats struct {
+	// current resource usage
+	Usage uint64 `json:"usage,omitempty"`
+	// resource limit, math.MaxUint64 means "max"
+	Limit uint64 `json:"limit,omitempty"`
+	// number of times the resource usage was about to go over the limit
+	Events uint64 `json:"events,omitempty"`
+}
+
+// DeviceStats are the stats of a device granted to the container, such as a
+// GPU, as contributed by a device stats provider.
+type DeviceStats struct {
+	// Provider is the name of the provider of the stats, e.g. "nvidia".
+	Provider string `json:"provider,omitempty"`
+	Path     string `json:"path,omitempty"`
+	Major    int64  `json:"major"`
+	Minor    int64  `json:"minor"`
+	// Metrics are the values of the metrics of the device by name, e.g.
+	// "utilization_percent" or "memory_used_bytes".
+	Metrics map[string]uint64 `json:"metrics,omitempty"`
 }
 
 type Stats struct {
@@ -152,12 +256,19 @@ type Stats struct {
 	MemoryStats MemoryStats `json:"memory_stats,omitempty"`
 	PidsStats   PidsStats   `json:"pids_stats,omitempty"`
 	BlkioStats  BlkioStats  `json:"blkio_stats,omitempty"`
+	RdmaStats   RdmaStats   `json:"rdma_stats,omitempty"`
 	// the map is in the format "size of hugepage: stats of the hugepage"
 	HugetlbStats map[string]HugetlbStats `json:"hugetlb_stats,omitempty"`
+	// the map is in the format "misc resource name: stats of the resource"
+	MiscStats map[string]MiscStats `json:"misc_stats,omitempty"`
+	// the stats of the devices of the container, contributed by the device
+	// stats providers
+	DeviceStats []DeviceStats `json:"device_stats,omitempty"`
 }
 
 func NewStats() *Stats {
 	memoryStats := MemoryStats{Stats: make(map[string]uint64)}
 	hugetlbStats := make(map[string]HugetlbStats)
-	return &Stats{MemoryStats: memoryStats, HugetlbStats: hugetlbStats}
+	miscStats := make(map[string]MiscStats)
+	return &Stats{MemoryStats: memoryStats, HugetlbStats: hugetlbStats, MiscStats: miscStats}
 }
@@ -294,6 +294,54 @@ func newProp(name string, units interface{}) systemdDbus.Property {
 	}
 }
 
+// ioDeviceValue is a per-device value of systemd BlockIO* and IO* unit
+// properties (D-Bus signature "a(st)").
+type ioDeviceValue struct {
+	Path  string
+	Value uint64
+}
+
+// blockDevicePath returns a path systemd can use to refer to a block device.
+func blockDevicePath(major, minor int64) string {
+	return fmt.Sprintf("/dev/block/%d:%d", major, minor)
+}
+
+// addIoThrottleProperty adds a per-device throttle property. As in cgroup v1,
+// a rate of 0 removes the limit.
+func addIoThrottleProperty(props *[]systemdDbus.Property, name string, devices []*configs.ThrottleDevice) {
+	if len(devices) == 0 {
+		return
+	}
+	values := make([]ioDeviceValue, 0, len(devices))
+	for _, td := range devices {
+		rate := td.Rate
+		if rate == 0 {
+			rate = math.MaxUint64
+		}
+		values = append(values, ioDeviceValue{blockDevicePath(td.Major, td.Minor), rate})
+	}
+	*props = append(*props, newProp(name, values))
+}
+
+// addIoWeightProperty adds a per-device weight property, using convert (if
+// not nil) to convert weights from the cgroup v1 blkio range.
+func addIoWeightProperty(props *[]systemdDbus.Property, name string, devices []*configs.WeightDevice, convert func(uint16) uint64) {
+	var values []ioDeviceValue
+	for _, wd := range devices {
+		if wd.Weight == 0 {
+			continue
+		}
+		weight := uint64(wd.Weight)
+		if convert != nil {
+			weight = convert(wd.Weight)
+		}
+		values = append(values, ioDeviceValue{blockDevicePath(wd.Major, wd.Minor), weight})
+	}
+	if len(values) != 0 {
+		*props = append(*props, newProp(name, values))
+	}
+}
+
 func getUnitName(c *configs.Cgroup) string {
 	// by default, we create a scope unless the user explicitly asks for a slice.
 	if !strings.HasSuffix(c.Name, ".slice") {
@@ -318,10 +366,12 @@ func isUnitExists(err error) bool {
 	return isDbusError(err, "org.freedesktop.systemd1.UnitExists")
 }
 
-func startUnit(cm *dbusConnManager, unitName string, properties []systemdDbus.Property) error {
+// startUnit starts the transient unit unitName, and waits for it to be
+// started, until a timeout or ctx is done.
+func startUnit(ctx context.Context, cm *dbusConnManager, unitName string, properties []systemdDbus.Property) error {
 	statusChan := make(chan string, 1)
 	err := cm.retryOnDisconnect(func(c *systemdDbus.Conn) error {
-		_, err := c.StartTransientUnitContext(context.TODO(), unitName, "replace", properties, statusChan)
+		_, err := c.StartTransientUnitContext(ctx, unitName, "replace", properties, statusChan)
 		return err
 	})
 	if err == nil {
@@ -339,6 +389,9 @@ func startUnit(cm *dbusConnManager, unitName string, properties []systemdDbus.Pr
 		case <-timeout.C:
 			resetFailedUnit(cm, unitName)
 			return errors.New("Timeout waiting for systemd to create " + unitName)
+		case <-ctx.Done():
+			resetFailedUnit(cm, unitName)
+			return errors.Wrap(ctx.Err(), "waiting for systemd to create "+unitName)
 		}
 	} else if !isUnitExists(err) {
 		return err
@@ -347,10 +400,12 @@ func startUnit(cm *dbusConnManager, unitName string, properties []systemdDbus.Pr
 	return nil
 }
 
-func stopUnit(cm *dbusConnManager, unitName string) error {
+// stopUnit stops the unit unitName, and waits for it to be stopped, until a
+// timeout or ctx is done.
+func stopUnit(ctx context.Context, cm *dbusConnManager, unitName string) error {
 	statusChan := make(chan string, 1)
 	err := cm.retryOnDisconnect(func(c *systemdDbus.Conn) error {
-		_, err := c.StopUnitContext(context.TODO(), unitName, "replace", statusChan)
+		_, err := c.StopUnitContext(ctx, unitName, "replace", statusChan)
 		return err
 	})
 	if err == nil {
@@ -366,6 +421,8 @@ func stopUnit(cm *dbusConnManager, unitName string) error {
 			}
 		case <-timeout.C:
 			return errors.New("Timed out while waiting for systemd to remove " + unitName)
+		case <-ctx.Done():
+			return errors.Wrap(ctx.Err(), "waiting for systemd to remove "+unitName)
 		}
 	}
 	return nil
@@ -437,9 +494,14 @@ func addCpuQuota(cm *dbusConnManager, properties *[]systemdDbus.Property, quota
 		if sdVer >= 242 {
 			*properties = append(*properties,
 				newProp("CPUQuotaPeriodUSec", period))
-		} else {
-			logrus.Debugf("systemd v%d is too old to support CPUQuotaPeriodSec "+
-				" (setting will still be applied to cgroupfs)", sdVer)
+		} else if period != defCPUQuotaPeriod {
+			// The period is still applied to cgroupfs, but systemd
+			// resets it to its default whenever it applies the CPU
+			// quota of the unit, e.g. on daemon-reload. The quota
+			// is converted below so that the ratio is kept.
+			logrus.Warnf("systemd v%d is too old to support CPUQuotaPeriodSec: "+
+				"the CPU quota period of %dus is applied to cgroupfs only, and may be "+
+				"reset by systemd to %dus", sdVer, period, defCPUQuotaPeriod)
 		}
 	}
 	if quota != 0 || period != 0 {
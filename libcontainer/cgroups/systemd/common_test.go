@@ -0,0 +1,96 @@
+// +build linux
+
+package systemd
+
+import (
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	systemdDbus "github.com/coreos/go-systemd/v22/dbus"
+	"github.com/opencontainers/runc/libcontainer/cgroups/fscommon"
+	"github.com/opencontainers/runc/libcontainer/configs"
+)
+
+func findProp(props []systemdDbus.Property, name string) interface{} {
+	for _, p := range props {
+		if p.Name == name {
+			return p.Value.Value()
+		}
+	}
+	return nil
+}
+
+func TestIoProperties(t *testing.T) {
+	r := &configs.Resources{
+		BlkioWeight: 500,
+		BlkioWeightDevice: []*configs.WeightDevice{
+			configs.NewWeightDevice(8, 0, 100, 0),
+			// Only a leaf weight, ignored.
+			configs.NewWeightDevice(8, 16, 0, 100),
+		},
+		BlkioThrottleReadBpsDevice: []*configs.ThrottleDevice{
+			configs.NewThrottleDevice(8, 0, 1048576),
+		},
+		BlkioThrottleWriteIOPSDevice: []*configs.ThrottleDevice{
+			configs.NewThrottleDevice(8, 0, 0),
+		},
+	}
+
+	v1, err := genV1ResourcesProperties(r, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v2, err := genV2ResourcesProperties(r, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		props    []systemdDbus.Property
+		name     string
+		expected interface{}
+	}{
+		{v1, "BlockIOWeight", uint64(500)},
+		{v1, "BlockIODeviceWeight", []ioDeviceValue{{"/dev/block/8:0", 100}}},
+		{v1, "BlockIOReadBandwidth", []ioDeviceValue{{"/dev/block/8:0", 1048576}}},
+		{v1, "BlockIOWriteBandwidth", nil},
+		{v2, "IOWeight", uint64(4950)},
+		{v2, "IODeviceWeight", []ioDeviceValue{{"/dev/block/8:0", 910}}},
+		{v2, "IOReadBandwidthMax", []ioDeviceValue{{"/dev/block/8:0", 1048576}}},
+		{v2, "IOWriteIOPSMax", []ioDeviceValue{{"/dev/block/8:0", math.MaxUint64}}},
+		{v2, "IOReadIOPSMax", nil},
+	} {
+		if value := findProp(tc.props, tc.name); !reflect.DeepEqual(value, tc.expected) {
+			t.Errorf("%s: expected %v, got %v", tc.name, tc.expected, value)
+		}
+	}
+}
+
+func TestCheckDelegation(t *testing.T) {
+	testMode := fscommon.TestMode
+	fscommon.TestMode = true
+	defer func() {
+		fscommon.TestMode = testMode
+	}()
+	dir, err := ioutil.TempDir("", "runc-systemd-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := ioutil.WriteFile(filepath.Join(dir, "cgroup.controllers"), []byte("memory pids\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	r := &configs.Resources{Memory: 1 << 20, PidsLimit: 10}
+	if err := checkDelegation(dir, r); err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+	r.CpuWeight = 100
+	if err := checkDelegation(dir, r); err == nil {
+		t.Error("expected an error for the cpu controller, got nil")
+	}
+}
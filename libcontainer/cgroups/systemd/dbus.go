@@ -4,10 +4,26 @@ package systemd
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"io"
 	"sync"
+	"time"
 
 	systemdDbus "github.com/coreos/go-systemd/v22/dbus"
 	dbus "github.com/godbus/dbus/v5"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// dbusMaxRetries is the maximum number of reconnection attempts made
+	// by retryOnDisconnect.
+	dbusMaxRetries = 6
+	// dbusRetryDelay is the initial delay between reconnection attempts,
+	// doubled after each attempt. With dbusMaxRetries, systemd (or
+	// dbus-daemon) has about 3 seconds to come back after a restart.
+	dbusRetryDelay = 100 * time.Millisecond
 )
 
 var (
@@ -76,21 +92,52 @@ func (d *dbusConnManager) resetConnection(conn *systemdDbus.Conn) {
 	}
 }
 
-var errDbusConnClosed = dbus.ErrClosed.Error()
+// isDbusConnClosed returns true if err means that the dbus connection is
+// closed or broken, for example because systemd has been re-executed
+// (systemctl daemon-reexec) or dbus-daemon has been restarted.
+func isDbusConnClosed(err error) bool {
+	if err == nil {
+		return false
+	}
+	return errors.Is(err, dbus.ErrClosed) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, unix.ECONNRESET) ||
+		errors.Is(err, unix.EPIPE) ||
+		isDbusError(err, "org.freedesktop.DBus.Error.Disconnected")
+}
 
 // retryOnDisconnect calls op, and if the error it returns is about closed dbus
 // connection, the connection is re-established and the op is retried. This helps
 // with the situation when dbus is restarted and we have a stale connection.
+//
+// As systemd (or dbus-daemon) may not be ready to accept connections right
+// after a restart, reconnection is retried with an exponential backoff.
 func (d *dbusConnManager) retryOnDisconnect(op func(*systemdDbus.Conn) error) error {
-	for {
+	var reconnecting bool
+	delay := dbusRetryDelay
+	for attempt := 0; ; attempt++ {
 		conn, err := d.getConnection()
-		if err != nil {
+		if err == nil {
+			err = op(conn)
+			if !isDbusConnClosed(err) {
+				return err
+			}
+			d.resetConnection(conn)
+			if !reconnecting {
+				// Reconnect right away, as most likely it is
+				// just the connection that went stale.
+				reconnecting = true
+				continue
+			}
+		} else if !reconnecting {
+			// There was no connection to begin with.
 			return err
 		}
-		err = op(conn)
-		if !isDbusError(err, errDbusConnClosed) {
-			return err
+		if attempt >= dbusMaxRetries {
+			return fmt.Errorf("dbus connection lost, giving up after %d attempts: %w", attempt+1, err)
 		}
-		d.resetConnection(conn)
+		logrus.Debugf("dbus connection lost (%v), retrying in %v", err, delay)
+		time.Sleep(delay)
+		delay *= 2
 	}
 }
@@ -0,0 +1,37 @@
+// +build linux
+
+package systemd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"testing"
+
+	dbus "github.com/godbus/dbus/v5"
+	"golang.org/x/sys/unix"
+)
+
+func TestIsDbusConnClosed(t *testing.T) {
+	testCases := []struct {
+		err    error
+		closed bool
+	}{
+		{nil, false},
+		{errors.New("some error"), false},
+		{dbus.ErrClosed, true},
+		{fmt.Errorf("wrapped: %w", dbus.ErrClosed), true},
+		{io.EOF, true},
+		{&net.OpError{Op: "write", Net: "unix", Err: os.NewSyscallError("write", unix.EPIPE)}, true},
+		{&net.OpError{Op: "read", Net: "unix", Err: os.NewSyscallError("read", unix.ECONNRESET)}, true},
+		{&dbus.Error{Name: "org.freedesktop.DBus.Error.Disconnected"}, true},
+		{&dbus.Error{Name: "org.freedesktop.systemd1.UnitExists"}, false},
+	}
+	for _, tc := range testCases {
+		if closed := isDbusConnClosed(tc.err); closed != tc.closed {
+			t.Errorf("isDbusConnClosed(%v): expected %v, got %v", tc.err, tc.closed, closed)
+		}
+	}
+}
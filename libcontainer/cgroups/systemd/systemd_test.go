@@ -1,6 +1,7 @@
 package systemd
 
 import (
+	"reflect"
 	"testing"
 )
 
@@ -30,3 +31,33 @@ func TestSystemdVersion(t *testing.T) {
 		}
 	}
 }
+
+func TestMissingControllers(t *testing.T) {
+	delegated := []string{"cpuset", "cpu", "io", "memory", "pids"}
+	for _, tc := range []struct {
+		needed, missing []string
+	}{
+		{nil, nil},
+		{[]string{"memory", "pids"}, nil},
+		{[]string{"pids", "hugetlb", "cpu", "rdma"}, []string{"hugetlb", "rdma"}},
+	} {
+		if missing := missingControllers(tc.needed, delegated); !reflect.DeepEqual(missing, tc.missing) {
+			t.Errorf("missingControllers(%v); want %v; got %v", tc.needed, tc.missing, missing)
+		}
+	}
+}
+
+func TestPermyriadToUint32Scale(t *testing.T) {
+	for _, tc := range []struct {
+		permyriad uint32
+		expected  uint32
+	}{
+		{0, 0},
+		{5000, 2147483648},
+		{10000, 4294967295},
+	} {
+		if v := permyriadToUint32Scale(tc.permyriad); v != tc.expected {
+			t.Errorf("permyriadToUint32Scale(%d); want %d; got %d", tc.permyriad, tc.expected, v)
+		}
+	}
+}
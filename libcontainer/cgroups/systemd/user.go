@@ -18,33 +18,65 @@ import (
 )
 
 // newUserSystemdDbus creates a connection for systemd user-instance.
+//
+// If possible, the connection is made directly to the private socket of
+// the user instance (like systemctl --user does), so that no session bus
+// (dbus-daemon or dbus-broker) is required. Otherwise, the session bus is
+// used.
 func newUserSystemdDbus() (*systemdDbus.Conn, error) {
-	addr, err := DetectUserDbusSessionBusAddress()
+	uid, err := DetectUID()
 	if err != nil {
 		return nil, err
 	}
-	uid, err := DetectUID()
+	if path := userSystemdPrivateSocket(uid); path != "" {
+		return systemdDbus.NewConnection(func() (*dbus.Conn, error) {
+			// We skip Hello when talking directly to systemd.
+			return dialUserDbus("unix:path="+path, uid, false)
+		})
+	}
+	addr, err := DetectUserDbusSessionBusAddress()
 	if err != nil {
-		return nil, err
+		return nil, errors.Wrap(err, "unable to connect to the systemd user instance (make sure the user has a systemd session, e.g. using `loginctl enable-linger`)")
 	}
-
 	return systemdDbus.NewConnection(func() (*dbus.Conn, error) {
-		conn, err := dbus.Dial(addr)
-		if err != nil {
-			return nil, errors.Wrapf(err, "error while dialing %q", addr)
-		}
-		methods := []dbus.Auth{dbus.AuthExternal(strconv.Itoa(uid))}
-		err = conn.Auth(methods)
-		if err != nil {
-			conn.Close()
-			return nil, errors.Wrapf(err, "error while authenticating connection, address=%q, UID=%d", addr, uid)
-		}
+		return dialUserDbus(addr, uid, true)
+	})
+}
+
+func dialUserDbus(addr string, uid int, hello bool) (*dbus.Conn, error) {
+	conn, err := dbus.Dial(addr)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error while dialing %q", addr)
+	}
+	methods := []dbus.Auth{dbus.AuthExternal(strconv.Itoa(uid))}
+	err = conn.Auth(methods)
+	if err != nil {
+		conn.Close()
+		return nil, errors.Wrapf(err, "error while authenticating connection, address=%q, UID=%d", addr, uid)
+	}
+	if hello {
 		if err = conn.Hello(); err != nil {
 			conn.Close()
 			return nil, errors.Wrapf(err, "error while sending Hello message, address=%q, UID=%d", addr, uid)
 		}
-		return conn, nil
-	})
+	}
+	return conn, nil
+}
+
+// userSystemdPrivateSocket returns the path to the private socket of the
+// systemd user instance of uid, or an empty string if it does not exist.
+func userSystemdPrivateSocket(uid int) string {
+	dirs := []string{"/run/user/" + strconv.Itoa(uid)}
+	if xdr := os.Getenv("XDG_RUNTIME_DIR"); xdr != "" {
+		dirs = append([]string{xdr}, dirs...)
+	}
+	for _, dir := range dirs {
+		path := filepath.Join(dir, "systemd", "private")
+		if fi, err := os.Stat(path); err == nil && fi.Mode()&os.ModeSocket != 0 {
+			return path
+		}
+	}
+	return ""
 }
 
 // DetectUID detects UID from the OwnerUID field of `busctl --user status`
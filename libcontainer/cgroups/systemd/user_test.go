@@ -0,0 +1,41 @@
+// +build linux
+
+package systemd
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestUserSystemdPrivateSocket(t *testing.T) {
+	dir, err := ioutil.TempDir("", "runc-systemd-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer os.Setenv("XDG_RUNTIME_DIR", os.Getenv("XDG_RUNTIME_DIR"))
+	os.Setenv("XDG_RUNTIME_DIR", dir)
+
+	// Use a uid for which /run/user/<uid> surely does not exist.
+	const uid = 1 << 30
+	if path := userSystemdPrivateSocket(uid); path != "" {
+		t.Fatalf("expected no socket, got %q", path)
+	}
+
+	sock := filepath.Join(dir, "systemd", "private")
+	if err := os.MkdirAll(filepath.Dir(sock), 0755); err != nil {
+		t.Fatal(err)
+	}
+	l, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	if path := userSystemdPrivateSocket(uid); path != sock {
+		t.Fatalf("expected %q, got %q", sock, path)
+	}
+}
@@ -3,7 +3,7 @@
 package systemd
 
 import (
-	"errors"
+	"context"
 	"os"
 	"path/filepath"
 	"strings"
@@ -12,6 +12,7 @@ import (
 	systemdDbus "github.com/coreos/go-systemd/v22/dbus"
 	"github.com/opencontainers/runc/libcontainer/cgroups"
 	"github.com/opencontainers/runc/libcontainer/cgroups/fs"
+	"github.com/opencontainers/runc/libcontainer/cgroups/fscommon"
 	"github.com/opencontainers/runc/libcontainer/configs"
 	"github.com/sirupsen/logrus"
 )
@@ -21,6 +22,8 @@ type legacyManager struct {
 	cgroups *configs.Cgroup
 	paths   map[string]string
 	dbus    *dbusConnManager
+	// dirs caches the pinned paths.
+	dirs fscommon.DirCache
 }
 
 func NewLegacyManager(cg *configs.Cgroup, paths map[string]string) cgroups.Manager {
@@ -34,13 +37,13 @@ func NewLegacyManager(cg *configs.Cgroup, paths map[string]string) cgroups.Manag
 type subsystem interface {
 	// Name returns the name of the subsystem.
 	Name() string
-	// Returns the stats, as 'stats', corresponding to the cgroup under 'path'.
-	GetStats(path string, stats *cgroups.Stats) error
+	// Returns the stats, as 'stats', corresponding to the cgroup in 'dir'.
+	GetStatsPinned(dir *fscommon.PinnedDir, stats *cgroups.Stats) error
 	// Set sets cgroup resource limits.
-	Set(path string, r *configs.Resources) error
+	SetPinned(dir *fscommon.PinnedDir, r *configs.Resources) error
 }
 
-var errSubsystemDoesNotExist = errors.New("cgroup: subsystem does not exist")
+var errSubsystemDoesNotExist = cgroups.ErrV1NoController
 
 var legacySubsystems = []subsystem{
 	&fs.CpusetGroup{},
@@ -51,6 +54,7 @@ var legacySubsystems = []subsystem{
 	&fs.PidsGroup{},
 	&fs.BlkioGroup{},
 	&fs.HugetlbGroup{},
+	&fs.RdmaGroup{},
 	&fs.PerfEventGroup{},
 	&fs.FreezerGroup{},
 	&fs.NetPrioGroup{},
@@ -61,11 +65,13 @@ var legacySubsystems = []subsystem{
 func genV1ResourcesProperties(r *configs.Resources, cm *dbusConnManager) ([]systemdDbus.Property, error) {
 	var properties []systemdDbus.Property
 
-	deviceProperties, err := generateDeviceProperties(r.Devices)
-	if err != nil {
-		return nil, err
+	if !r.SkipDevices {
+		deviceProperties, err := generateDeviceProperties(r.Devices)
+		if err != nil {
+			return nil, err
+		}
+		properties = append(properties, deviceProperties...)
 	}
-	properties = append(properties, deviceProperties...)
 
 	if r.Memory != 0 {
 		properties = append(properties,
@@ -83,13 +89,18 @@ func genV1ResourcesProperties(r *configs.Resources, cm *dbusConnManager) ([]syst
 		properties = append(properties,
 			newProp("BlockIOWeight", uint64(r.BlkioWeight)))
 	}
+	addIoWeightProperty(&properties, "BlockIODeviceWeight", r.BlkioWeightDevice, nil)
+	addIoThrottleProperty(&properties, "BlockIOReadBandwidth", r.BlkioThrottleReadBpsDevice)
+	addIoThrottleProperty(&properties, "BlockIOWriteBandwidth", r.BlkioThrottleWriteBpsDevice)
+	// NOTE: systemd has no BlockIO* unit properties for IOPS limits, so
+	// these are only applied to cgroupfs (by fs manager's Set).
 
 	if r.PidsLimit > 0 || r.PidsLimit == -1 {
 		properties = append(properties,
 			newProp("TasksMax", uint64(r.PidsLimit)))
 	}
 
-	err = addCpuset(cm, &properties, r.CpusetCpus, r.CpusetMems)
+	err := addCpuset(cm, &properties, r.CpusetCpus, r.CpusetMems)
 	if err != nil {
 		return nil, err
 	}
@@ -98,6 +109,10 @@ func genV1ResourcesProperties(r *configs.Resources, cm *dbusConnManager) ([]syst
 }
 
 func (m *legacyManager) Apply(pid int) error {
+	return m.ApplyContext(context.Background(), pid)
+}
+
+func (m *legacyManager) ApplyContext(ctx context.Context, pid int) error {
 	var (
 		c          = m.cgroups
 		unitName   = getUnitName(c)
@@ -111,6 +126,8 @@ func (m *legacyManager) Apply(pid int) error {
 
 	m.mu.Lock()
 	defer m.mu.Unlock()
+	// The cgroups may be created again.
+	m.dirs.Reset()
 	if c.Paths != nil {
 		paths := make(map[string]string)
 		cgMap, err := cgroups.ParseCgroupFile("/proc/self/cgroup")
@@ -167,7 +184,7 @@ func (m *legacyManager) Apply(pid int) error {
 
 	properties = append(properties, c.SystemdProps...)
 
-	if err := startUnit(m.dbus, unitName, properties); err != nil {
+	if err := startUnit(ctx, m.dbus, unitName, properties); err != nil {
 		return err
 	}
 
@@ -189,6 +206,15 @@ func (m *legacyManager) Apply(pid int) error {
 		}
 		paths[s.Name()] = subsystemPath
 	}
+	// The accesses to the devices are audited by a program attached to
+	// the cgroup of the container in the unified hierarchy.
+	if c.AuditDevices {
+		unifiedPath, err := getUnifiedPath(c)
+		if err != nil {
+			return err
+		}
+		paths[""] = unifiedPath
+	}
 	m.paths = paths
 
 	if err := m.joinCgroups(pid); err != nil {
@@ -199,13 +225,18 @@ func (m *legacyManager) Apply(pid int) error {
 }
 
 func (m *legacyManager) Destroy() error {
+	return m.DestroyContext(context.Background())
+}
+
+func (m *legacyManager) DestroyContext(ctx context.Context) error {
 	if m.cgroups.Paths != nil {
 		return nil
 	}
 	m.mu.Lock()
 	defer m.mu.Unlock()
+	m.dirs.Reset()
 
-	stopErr := stopUnit(m.dbus, getUnitName(m.cgroups))
+	stopErr := stopUnit(ctx, m.dbus, getUnitName(m.cgroups))
 
 	// Both on success and on error, cleanup all the cgroups
 	// we are aware of, as some of them were created directly
@@ -223,28 +254,35 @@ func (m *legacyManager) Path(subsys string) string {
 	return m.paths[subsys]
 }
 
+// joinCgroups creates and joins the cgroups of all the subsystems (except
+// name=systemd) concurrently, except for the co-mounted ones, which share a
+// directory and are joined serially.
 func (m *legacyManager) joinCgroups(pid int) error {
-	for _, sys := range legacySubsystems {
-		name := sys.Name()
+	errs := fscommon.RunGrouped(len(legacySubsystems), func(i int) string {
+		return m.paths[legacySubsystems[i].Name()]
+	}, func(i int) error {
+		name := legacySubsystems[i].Name()
+		path, ok := m.paths[name]
+		if !ok {
+			return nil
+		}
 		switch name {
 		case "name=systemd":
 			// let systemd handle this
 		case "cpuset":
-			if path, ok := m.paths[name]; ok {
-				s := &fs.CpusetGroup{}
-				if err := s.ApplyDir(path, m.cgroups.Resources, pid); err != nil {
-					return err
-				}
-			}
+			s := &fs.CpusetGroup{}
+			return s.ApplyDir(path, m.cgroups.Resources, pid)
 		default:
-			if path, ok := m.paths[name]; ok {
-				if err := os.MkdirAll(path, 0755); err != nil {
-					return err
-				}
-				if err := cgroups.WriteCgroupProc(path, pid); err != nil {
-					return err
-				}
+			if err := os.MkdirAll(path, 0755); err != nil {
+				return err
 			}
+			return cgroups.WriteCgroupProc(path, pid)
+		}
+		return nil
+	})
+	for _, err := range errs {
+		if err != nil {
+			return err
 		}
 	}
 
@@ -252,7 +290,7 @@ func (m *legacyManager) joinCgroups(pid int) error {
 }
 
 func getSubsystemPath(c *configs.Cgroup, subsystem string) (string, error) {
-	mountpoint, err := cgroups.FindCgroupMountpoint("", subsystem)
+	mountpoint, root, err := cgroups.FindCgroupMountpointAndRoot("", subsystem)
 	if err != nil {
 		return "", err
 	}
@@ -261,6 +299,38 @@ func getSubsystemPath(c *configs.Cgroup, subsystem string) (string, error) {
 	if err != nil {
 		return "", err
 	}
+	cgroup, err := getUnitCgroup(c, initPath)
+	if err != nil {
+		return "", err
+	}
+
+	// Only a part of the hierarchy can be mounted, such as in a container
+	// without its own cgroup namespace.
+	path, err := cgroups.MountRelPath(root, cgroup)
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(mountpoint, path), nil
+}
+
+// getUnifiedPath returns the path of the cgroup of the unit in the unified
+// hierarchy, which is only mounted (on cgroups.HybridMountpoint) in hybrid
+// mode, and where systemd creates it along with the ones of the controllers.
+func getUnifiedPath(c *configs.Cgroup) (string, error) {
+	initCgroups, err := cgroups.ParseCgroupFile("/proc/1/cgroup")
+	if err != nil {
+		return "", err
+	}
+	cgroup, err := getUnitCgroup(c, initCgroups[""])
+	if err != nil {
+		return "", err
+	}
+	return cgroups.GetHybridCgroupPath(cgroup)
+}
+
+// getUnitCgroup returns the cgroup of the unit, given the one of pid 1.
+func getUnitCgroup(c *configs.Cgroup, initPath string) (string, error) {
 	// if pid 1 is systemd 226 or later, it will be in init.scope, not the root
 	initPath = strings.TrimSuffix(filepath.Clean(initPath), "init.scope")
 
@@ -269,15 +339,19 @@ func getSubsystemPath(c *configs.Cgroup, subsystem string) (string, error) {
 		slice = c.Parent
 	}
 
-	slice, err = ExpandSlice(slice)
+	slice, err := ExpandSlice(slice)
 	if err != nil {
 		return "", err
 	}
 
-	return filepath.Join(mountpoint, initPath, slice, getUnitName(c)), nil
+	return filepath.Join(initPath, slice, getUnitName(c)), nil
 }
 
 func (m *legacyManager) Freeze(state configs.FreezerState) error {
+	return m.FreezeContext(context.Background(), state, nil)
+}
+
+func (m *legacyManager) FreezeContext(ctx context.Context, state configs.FreezerState, opts *cgroups.FreezeOptions) error {
 	path, ok := m.paths["freezer"]
 	if !ok {
 		return errSubsystemDoesNotExist
@@ -285,7 +359,7 @@ func (m *legacyManager) Freeze(state configs.FreezerState) error {
 	prevState := m.cgroups.Resources.Freezer
 	m.cgroups.Resources.Freezer = state
 	freezer := &fs.FreezerGroup{}
-	if err := freezer.Set(path, m.cgroups.Resources); err != nil {
+	if err := freezer.SetState(ctx, m.dirs.Get(path), state, opts); err != nil {
 		m.cgroups.Resources.Freezer = prevState
 		return err
 	}
@@ -309,15 +383,23 @@ func (m *legacyManager) GetAllPids() ([]int, error) {
 }
 
 func (m *legacyManager) GetStats() (*cgroups.Stats, error) {
+	return m.GetStatsFor()
+}
+
+func (m *legacyManager) GetStatsFor(controllers ...string) (*cgroups.Stats, error) {
+	want, err := fs.StatsWanted(controllers)
+	if err != nil {
+		return nil, err
+	}
 	m.mu.Lock()
 	defer m.mu.Unlock()
 	stats := cgroups.NewStats()
 	for _, sys := range legacySubsystems {
 		path := m.paths[sys.Name()]
-		if path == "" {
+		if path == "" || !want(sys.Name()) {
 			continue
 		}
-		if err := sys.GetStats(path, stats); err != nil {
+		if err := sys.GetStatsPinned(m.dirs.Get(path), stats); err != nil {
 			return nil, err
 		}
 	}
@@ -345,8 +427,9 @@ func (m *legacyManager) Set(r *configs.Resources) error {
 	// (unlike our fs driver, they will happily write deny-all rules to running
 	// containers). So we freeze the container to avoid them hitting the cgroup
 	// error. But if the freezer cgroup isn't supported, we just warn about it.
+	// This is not needed if the device rules are not to be (re)applied.
 	targetFreezerState := configs.Undefined
-	if !m.cgroups.SkipDevices {
+	if !m.cgroups.SkipDevices && !r.SkipDevices {
 		// Figure out the current freezer state, so we can revert to it after we
 		// temporarily freeze the container.
 		targetFreezerState, err = m.GetFreezerState()
@@ -371,17 +454,27 @@ func (m *legacyManager) Set(r *configs.Resources) error {
 	// with the freezer setting in the configuration.
 	_ = m.Freeze(targetFreezerState)
 
-	for _, sys := range legacySubsystems {
+	errs := fscommon.RunConcurrentlyExcept(len(legacySubsystems), func(i int) bool {
+		return fscommon.SetSerially(legacySubsystems[i].Name())
+	}, func(i int) error {
 		// Get the subsystem path, but don't error out for not found cgroups.
-		path, ok := m.paths[sys.Name()]
+		path, ok := m.paths[legacySubsystems[i].Name()]
 		if !ok {
-			continue
+			return nil
 		}
-		if err := sys.Set(path, r); err != nil {
+		return legacySubsystems[i].SetPinned(m.dirs.Get(path), r)
+	})
+	for _, err := range errs {
+		if err != nil {
 			return err
 		}
 	}
 
+	if path := m.paths[""]; path != "" && m.cgroups.AuditDevices {
+		if err := fs.SetDevicesAudit(path, r); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
@@ -401,7 +494,7 @@ func (m *legacyManager) GetFreezerState() (configs.FreezerState, error) {
 		return configs.Undefined, nil
 	}
 	freezer := &fs.FreezerGroup{}
-	return freezer.GetState(path)
+	return freezer.GetStatePinned(m.dirs.Get(path))
 }
 
 func (m *legacyManager) Exists() bool {
@@ -411,3 +504,13 @@ func (m *legacyManager) Exists() bool {
 func (m *legacyManager) OOMKillCount() (uint64, error) {
 	return fs.OOMKillCount(m.Path("memory"))
 }
+
+func (m *legacyManager) Reclaim(_ uint64) error {
+	return cgroups.ErrReclaimNotSupported
+}
+
+// CanCreateEmpty returns false, as systemd refuses to start a scope with no
+// processes in it.
+func (m *legacyManager) CanCreateEmpty() bool {
+	return false
+}
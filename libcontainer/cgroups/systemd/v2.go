@@ -3,6 +3,7 @@
 package systemd
 
 import (
+	"context"
 	"fmt"
 	"math"
 	"os"
@@ -14,7 +15,9 @@ import (
 	systemdDbus "github.com/coreos/go-systemd/v22/dbus"
 	securejoin "github.com/cyphar/filepath-securejoin"
 	"github.com/opencontainers/runc/libcontainer/cgroups"
+	"github.com/opencontainers/runc/libcontainer/cgroups/ebpf"
 	"github.com/opencontainers/runc/libcontainer/cgroups/fs2"
+	"github.com/opencontainers/runc/libcontainer/cgroups/fscommon"
 	"github.com/opencontainers/runc/libcontainer/configs"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
@@ -27,6 +30,9 @@ type unifiedManager struct {
 	path     string
 	rootless bool
 	dbus     *dbusConnManager
+	// fsMgr is the fs2 manager of path, which is kept so that it can
+	// reuse the cgroup directory it has pinned.
+	fsMgr cgroups.Manager
 }
 
 func NewUnifiedManager(config *configs.Cgroup, path string, rootless bool) cgroups.Manager {
@@ -172,19 +178,25 @@ func genV2ResourcesProperties(r *configs.Resources, cm *dbusConnManager) ([]syst
 	//       aren't the end of the world, but it is a bit concerning. However
 	//       it's unclear if systemd removes all eBPF programs attached when
 	//       doing SetUnitProperties...
-	deviceProperties, err := generateDeviceProperties(r.Devices)
-	if err != nil {
-		return nil, err
+	if !r.SkipDevices {
+		deviceProperties, err := generateDeviceProperties(r.Devices)
+		if err != nil {
+			return nil, err
+		}
+		properties = append(properties, deviceProperties...)
 	}
-	properties = append(properties, deviceProperties...)
 
 	if r.Memory != 0 {
 		properties = append(properties,
 			newProp("MemoryMax", uint64(r.Memory)))
 	}
-	if r.MemoryReservation != 0 {
+	if r.MemoryMin != 0 {
+		properties = append(properties,
+			newProp("MemoryMin", uint64(r.MemoryMin)))
+	}
+	if low := fs2.MemoryLow(r); low != 0 {
 		properties = append(properties,
-			newProp("MemoryLow", uint64(r.MemoryReservation)))
+			newProp("MemoryLow", uint64(low)))
 	}
 
 	swap, err := cgroups.ConvertMemorySwapToCgroupV2Value(r.MemorySwap, r.Memory)
@@ -196,18 +208,42 @@ func genV2ResourcesProperties(r *configs.Resources, cm *dbusConnManager) ([]syst
 			newProp("MemorySwapMax", uint64(swap)))
 	}
 
-	if r.CpuWeight != 0 {
+	addManagedOOM(cm, &properties, r)
+
+	if r.CPUIdle != nil && *r.CPUIdle == 1 {
+		// systemd maps CPUWeight=idle (a weight of 0) to cpu.idle since v252.
+		if sdVer := systemdVersion(cm); sdVer >= 252 {
+			properties = append(properties,
+				newProp("CPUWeight", uint64(0)))
+		} else {
+			logrus.Debugf("systemd v%d is too old to support CPUWeight=idle"+
+				" (setting will still be applied to cgroupfs)", sdVer)
+		}
+	} else if r.CpuWeight != 0 {
 		properties = append(properties,
 			newProp("CPUWeight", r.CpuWeight))
 	}
 
 	addCpuQuota(cm, &properties, r.CpuQuota, r.CpuPeriod)
 
+	// NOTE: systemd has no unit property for cpu.max.burst, so
+	// r.CpuBurst is only applied to cgroupfs (by fs2 manager's Set).
+
 	if r.PidsLimit > 0 || r.PidsLimit == -1 {
 		properties = append(properties,
 			newProp("TasksMax", uint64(r.PidsLimit)))
 	}
 
+	if r.BlkioWeight != 0 {
+		properties = append(properties,
+			newProp("IOWeight", cgroups.ConvertBlkIOToIOWeightValue(r.BlkioWeight)))
+	}
+	addIoWeightProperty(&properties, "IODeviceWeight", r.BlkioWeightDevice, cgroups.ConvertBlkIOToIOWeightValue)
+	addIoThrottleProperty(&properties, "IOReadBandwidthMax", r.BlkioThrottleReadBpsDevice)
+	addIoThrottleProperty(&properties, "IOWriteBandwidthMax", r.BlkioThrottleWriteBpsDevice)
+	addIoThrottleProperty(&properties, "IOReadIOPSMax", r.BlkioThrottleReadIOPSDevice)
+	addIoThrottleProperty(&properties, "IOWriteIOPSMax", r.BlkioThrottleWriteIOPSDevice)
+
 	err = addCpuset(cm, &properties, r.CpusetCpus, r.CpusetMems)
 	if err != nil {
 		return nil, err
@@ -227,7 +263,46 @@ func genV2ResourcesProperties(r *configs.Resources, cm *dbusConnManager) ([]syst
 	return properties, nil
 }
 
+// addManagedOOM adds the properties configuring systemd-oomd for the unit.
+// Unlike the other resources, they have no cgroupfs equivalent, so they are
+// not applied at all by a systemd too old to support them.
+func addManagedOOM(cm *dbusConnManager, properties *[]systemdDbus.Property, r *configs.Resources) {
+	if r.ManagedOOMMemoryPressure != "" {
+		// systemd supports ManagedOOMMemoryPressure since v247.
+		if sdVer := systemdVersion(cm); sdVer >= 247 {
+			*properties = append(*properties,
+				newProp("ManagedOOMMemoryPressure", r.ManagedOOMMemoryPressure))
+		} else {
+			logrus.Warnf("systemd v%d is too old to support ManagedOOMMemoryPressure, "+
+				"systemd-oomd is not configured for the container", sdVer)
+		}
+	}
+	if r.ManagedOOMMemoryPressureLimit != nil {
+		// systemd supports ManagedOOMMemoryPressureLimit since v248 (v247
+		// had a ManagedOOMMemoryPressureLimitPercent property instead).
+		if sdVer := systemdVersion(cm); sdVer >= 248 {
+			*properties = append(*properties,
+				newProp("ManagedOOMMemoryPressureLimit", permyriadToUint32Scale(*r.ManagedOOMMemoryPressureLimit)))
+		} else {
+			logrus.Warnf("systemd v%d is too old to support ManagedOOMMemoryPressureLimit, "+
+				"the default limit of systemd-oomd is used for the container", sdVer)
+		}
+	}
+}
+
+// permyriadToUint32Scale converts a permyriad to the scale of the uint32
+// range, in which systemd takes the ManagedOOMMemoryPressureLimit property.
+func permyriadToUint32Scale(p uint32) uint32 {
+	return uint32((uint64(p)*math.MaxUint32 + 5000) / 10000)
+}
+
 func (m *unifiedManager) Apply(pid int) error {
+	return m.ApplyContext(context.Background(), pid)
+}
+
+func (m *unifiedManager) ApplyContext(ctx context.Context, pid int) error {
+	// The cgroup may be created again.
+	m.resetFsManager()
 	var (
 		c          = m.cgroups
 		unitName   = getUnitName(c)
@@ -265,6 +340,15 @@ func (m *unifiedManager) Apply(pid int) error {
 	if !strings.HasSuffix(unitName, ".slice") {
 		// Assume scopes always support delegation.
 		properties = append(properties, newProp("Delegate", true))
+		if m.rootless {
+			ctrs, err := m.requestControllers(c.Resources)
+			if err != nil {
+				return err
+			}
+			if len(ctrs) != 0 {
+				properties = append(properties, newProp("DelegateControllers", ctrs))
+			}
+		}
 	}
 
 	// Always enable accounting, this gets us the same behaviour as the fs implementation,
@@ -282,12 +366,22 @@ func (m *unifiedManager) Apply(pid int) error {
 
 	properties = append(properties, c.SystemdProps...)
 
-	if err := startUnit(m.dbus, unitName, properties); err != nil {
+	if err := m.initPath(); err != nil {
+		return err
+	}
+	created := m.missingSlices()
+
+	if err := startUnit(ctx, m.dbus, unitName, properties); err != nil {
 		return errors.Wrapf(err, "error while starting unit %q with properties %+v", unitName, properties)
 	}
+	if len(created) > 0 {
+		c.CreatedParents = created
+	}
 
-	if err := m.initPath(); err != nil {
-		return err
+	if m.rootless {
+		if err := checkDelegation(m.path, c.Resources); err != nil {
+			return err
+		}
 	}
 	if err := fs2.CreateCgroupPath(m.path, m.cgroups); err != nil {
 		return err
@@ -295,15 +389,107 @@ func (m *unifiedManager) Apply(pid int) error {
 	return nil
 }
 
+// requestControllers returns the controllers to explicitly request from the
+// systemd user instance for the unit, which are the ones needed to apply r.
+//
+// The controllers must have been delegated to the user instance itself (by
+// the Delegate= setting of user@.service) for it to be able to delegate them
+// further, so this fails early if they were not, rather than letting the
+// limits be silently ignored or a "permission denied" error happen later.
+func (m *unifiedManager) requestControllers(r *configs.Resources) ([]string, error) {
+	ctrs := cgroups.RequiredControllers(r)
+	if len(ctrs) == 0 {
+		return nil, nil
+	}
+	delegated, err := delegatedControllers(m.dbus)
+	if err != nil {
+		return nil, err
+	}
+	if missing := missingControllers(ctrs, delegated); len(missing) != 0 {
+		return nil, fmt.Errorf("%w: cgroup controller(s) %s not delegated to the systemd user instance "+
+			"(check the Delegate= setting of user@.service)", cgroups.ErrRootless, strings.Join(missing, ", "))
+	}
+	return ctrs, nil
+}
+
+// checkDelegation returns an error if any of the controllers needed to apply
+// r are not delegated to the unit (created by systemd user instance) at
+// path, rather than letting a "permission denied" error happen later.
+//
+// This can happen even if the controllers were delegated to the user
+// instance, if its systemd version does not support them.
+func checkDelegation(path string, r *configs.Resources) error {
+	content, err := fscommon.ReadFile(path, "cgroup.controllers")
+	if err != nil {
+		return err
+	}
+	if missing := missingControllers(cgroups.RequiredControllers(r), strings.Fields(content)); len(missing) != 0 {
+		return fmt.Errorf("%w: cgroup controller(s) %s not delegated by the systemd user instance "+
+			"(is systemd too old to delegate them?)", cgroups.ErrRootless, strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// missingControllers returns the controllers in needed not in avail.
+func missingControllers(needed, avail []string) []string {
+	have := make(map[string]struct{}, len(avail))
+	for _, ctr := range avail {
+		have[ctr] = struct{}{}
+	}
+	var missing []string
+	for _, ctr := range needed {
+		if _, ok := have[ctr]; !ok {
+			missing = append(missing, ctr)
+		}
+	}
+	return missing
+}
+
+// delegatedControllers returns the controllers available in the cgroup of
+// the systemd instance, i.e. the ones it is able to delegate.
+func delegatedControllers(cm *dbusConnManager) ([]string, error) {
+	managerCG, err := getManagerProperty(cm, "ControlGroup")
+	if err != nil {
+		return nil, err
+	}
+	rel, err := cgroups.UnifiedRelPath(managerCG)
+	if err != nil {
+		return nil, err
+	}
+	path, err := securejoin.SecureJoin(fs2.UnifiedMountpoint, rel)
+	if err != nil {
+		return nil, err
+	}
+	content, err := fscommon.ReadFile(path, "cgroup.controllers")
+	if err != nil {
+		return nil, err
+	}
+	return strings.Fields(content), nil
+}
+
+// DelegatedControllers returns the cgroup v2 controllers delegated to the
+// systemd user instance of the current user, i.e. the ones that can be used
+// to apply resource limits to rootless containers.
+//
+// It must not be used in a process which uses the systemd system instance.
+func DelegatedControllers() ([]string, error) {
+	return delegatedControllers(newDbusConnManager(true))
+}
+
 func (m *unifiedManager) Destroy() error {
+	return m.DestroyContext(context.Background())
+}
+
+func (m *unifiedManager) DestroyContext(ctx context.Context) error {
 	if m.cgroups.Paths != nil {
 		return nil
 	}
+	m.resetFsManager()
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
 	unitName := getUnitName(m.cgroups)
-	if err := stopUnit(m.dbus, unitName); err != nil {
+	if err := stopUnit(ctx, m.dbus, unitName); err != nil {
 		return err
 	}
 
@@ -312,8 +498,11 @@ func (m *unifiedManager) Destroy() error {
 	if err != nil && !os.IsNotExist(err) {
 		return err
 	}
+	if err := m.setSliceMemoryProtection(); err != nil {
+		logrus.Warnf("unable to revert the memory protection of the parent slices: %v", err)
+	}
 
-	return nil
+	return ebpf.UnpinCgroupDeviceFilter(m.cgroups.DeviceFilterPinPath)
 }
 
 func (m *unifiedManager) Path(_ string) string {
@@ -362,7 +551,12 @@ func (m *unifiedManager) initPath() error {
 	}
 
 	c := m.cgroups
-	path := filepath.Join(sliceFull, getUnitName(c))
+	// The cgroups of systemd are in its cgroup namespace, in which only a
+	// part of the hierarchy can be mounted.
+	path, err := cgroups.UnifiedRelPath(filepath.Join(sliceFull, getUnitName(c)))
+	if err != nil {
+		return err
+	}
 	path, err = securejoin.SecureJoin(fs2.UnifiedMountpoint, path)
 	if err != nil {
 		return err
@@ -379,15 +573,36 @@ func (m *unifiedManager) fsManager() (cgroups.Manager, error) {
 	if err := m.initPath(); err != nil {
 		return nil, err
 	}
-	return fs2.NewManager(m.cgroups, m.path, m.rootless)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.fsMgr == nil {
+		fsMgr, err := fs2.NewManager(m.cgroups, m.path, m.rootless)
+		if err != nil {
+			return nil, err
+		}
+		m.fsMgr = fsMgr
+	}
+	return m.fsMgr, nil
+}
+
+// resetFsManager drops the fs2 manager, so that the cgroup directory is
+// pinned again on the next use.
+func (m *unifiedManager) resetFsManager() {
+	m.mu.Lock()
+	m.fsMgr = nil
+	m.mu.Unlock()
 }
 
 func (m *unifiedManager) Freeze(state configs.FreezerState) error {
+	return m.FreezeContext(context.Background(), state, nil)
+}
+
+func (m *unifiedManager) FreezeContext(ctx context.Context, state configs.FreezerState, opts *cgroups.FreezeOptions) error {
 	fsMgr, err := m.fsManager()
 	if err != nil {
 		return err
 	}
-	return fsMgr.Freeze(state)
+	return fsMgr.FreezeContext(ctx, state, opts)
 }
 
 func (m *unifiedManager) GetPids() ([]int, error) {
@@ -412,6 +627,14 @@ func (m *unifiedManager) GetStats() (*cgroups.Stats, error) {
 	return fsMgr.GetStats()
 }
 
+func (m *unifiedManager) GetStatsFor(controllers ...string) (*cgroups.Stats, error) {
+	fsMgr, err := m.fsManager()
+	if err != nil {
+		return nil, err
+	}
+	return fsMgr.GetStatsFor(controllers...)
+}
+
 func (m *unifiedManager) Set(r *configs.Resources) error {
 	properties, err := genV2ResourcesProperties(r, m.dbus)
 	if err != nil {
@@ -424,8 +647,9 @@ func (m *unifiedManager) Set(r *configs.Resources) error {
 	// (unlike our fs driver, they will happily write deny-all rules to running
 	// containers). So we freeze the container to avoid them hitting the cgroup
 	// error. But if the freezer cgroup isn't supported, we just warn about it.
+	// This is not needed if the device rules are not to be (re)applied.
 	targetFreezerState := configs.Undefined
-	if !m.cgroups.SkipDevices {
+	if !m.cgroups.SkipDevices && !r.SkipDevices {
 		// Figure out the current freezer state, so we can revert to it after we
 		// temporarily freeze the container.
 		targetFreezerState, err = m.GetFreezerState()
@@ -454,7 +678,61 @@ func (m *unifiedManager) Set(r *configs.Resources) error {
 	if err != nil {
 		return err
 	}
-	return fsMgr.Set(r)
+	if err := fsMgr.Set(r); err != nil {
+		return err
+	}
+	if fs2.IsMemoryProtectionSet(r) {
+		if err := m.setSliceMemoryProtection(); err != nil {
+			logrus.Warnf("unable to propagate the memory protection to the parent slices, it may not be effective: %v", err)
+		}
+	}
+	return nil
+}
+
+// missingSlices returns the directories of the slices containing the unit
+// which don't exist yet, and are thus created for it, from the topmost one.
+func (m *unifiedManager) missingSlices() []string {
+	var dirs []string
+	for dir := filepath.Dir(m.path); strings.HasSuffix(dir, ".slice"); dir = filepath.Dir(dir) {
+		if _, err := os.Stat(dir); err == nil {
+			break
+		}
+		dirs = append([]string{dir}, dirs...)
+	}
+	return dirs
+}
+
+// setSliceMemoryProtection sets MemoryMin and MemoryLow of the slices
+// created for the unit (see configs.Cgroup.CreatedParents) to the sum of the
+// ones of their children (see fs2.PropagateMemoryProtection), so that
+// systemd keeps them.
+func (m *unifiedManager) setSliceMemoryProtection() error {
+	parents := m.cgroups.CreatedParents
+	if err := fs2.PropagateMemoryProtection(parents); err != nil {
+		return err
+	}
+	for _, dir := range parents {
+		if _, err := os.Stat(dir); os.IsNotExist(err) {
+			continue
+		}
+		var properties []systemdDbus.Property
+		for _, p := range []struct{ file, property string }{
+			{"memory.min", "MemoryMin"},
+			{"memory.low", "MemoryLow"},
+		} {
+			// This is math.MaxUint64 for "max", which is "infinity"
+			// for systemd.
+			val, err := fscommon.GetCgroupParamUint(dir, p.file)
+			if err != nil {
+				return err
+			}
+			properties = append(properties, newProp(p.property, val))
+		}
+		if err := setUnitProperties(m.dbus, filepath.Base(dir), properties...); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 func (m *unifiedManager) GetPaths() map[string]string {
@@ -486,3 +764,17 @@ func (m *unifiedManager) OOMKillCount() (uint64, error) {
 	}
 	return fsMgr.OOMKillCount()
 }
+
+func (m *unifiedManager) Reclaim(bytes uint64) error {
+	fsMgr, err := m.fsManager()
+	if err != nil {
+		return err
+	}
+	return fsMgr.Reclaim(bytes)
+}
+
+// CanCreateEmpty returns false, as systemd refuses to start a scope with no
+// processes in it.
+func (m *unifiedManager) CanCreateEmpty() bool {
+	return false
+}
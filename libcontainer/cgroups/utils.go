@@ -15,6 +15,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/moby/sys/mountinfo"
 	"github.com/opencontainers/runc/libcontainer/cgroups/fscommon"
 	"github.com/opencontainers/runc/libcontainer/userns"
 	"github.com/sirupsen/logrus"
@@ -23,12 +24,17 @@ import (
 
 const (
 	CgroupProcesses   = "cgroup.procs"
+	CgroupThreads     = "cgroup.threads"
 	unifiedMountpoint = "/sys/fs/cgroup"
 )
 
 var (
 	isUnifiedOnce sync.Once
 	isUnified     bool
+
+	unifiedRootOnce sync.Once
+	unifiedRoot     string
+	unifiedRootErr  error
 )
 
 // IsCgroup2UnifiedMode returns whether we are running in cgroup v2 unified mode.
@@ -50,6 +56,60 @@ func IsCgroup2UnifiedMode() bool {
 	return isUnified
 }
 
+// getUnifiedRoot returns the cgroup mounted on /sys/fs/cgroup on cgroup v2,
+// as seen in the cgroup namespace of the current process.
+func getUnifiedRoot() (string, error) {
+	unifiedRootOnce.Do(func() {
+		mounts, err := mountinfo.GetMounts(func(m *mountinfo.Info) (bool, bool) {
+			return m.Mountpoint != unifiedMountpoint || m.FSType != "cgroup2", false
+		})
+		if err != nil {
+			unifiedRootErr = err
+			return
+		}
+		unifiedRoot = "/"
+		// The last mount is the visible one.
+		if len(mounts) > 0 {
+			unifiedRoot = mounts[len(mounts)-1].Root
+		}
+	})
+	return unifiedRoot, unifiedRootErr
+}
+
+// UnifiedRelPath returns the path, relative to /sys/fs/cgroup, of a cgroup
+// v2 cgroup as seen in the cgroup namespace of the current process (such as
+// in /proc/self/cgroup). Only a part of the hierarchy can be mounted on
+// /sys/fs/cgroup, such as in a container without its own cgroup namespace.
+func UnifiedRelPath(cgroup string) (string, error) {
+	root, err := getUnifiedRoot()
+	if err != nil {
+		return "", err
+	}
+	return MountRelPath(root, cgroup)
+}
+
+// MountRelPath returns the path of a cgroup relative to root, the root of
+// the cgroup mount of its hierarchy, both as seen in the cgroup namespace of
+// the current process, or an error if the cgroup is not in the mount.
+func MountRelPath(root, cgroup string) (string, error) {
+	// The kernel shows the cgroups out of the cgroup namespace relative to
+	// its root, i.e. starting with "/..", which can't be resolved.
+	if cgroup == "/.." || strings.HasPrefix(cgroup, "/../") {
+		return "", fmt.Errorf("cgroup %s is out of the cgroup namespace", cgroup)
+	}
+	if root == "/.." || strings.HasPrefix(root, "/../") {
+		return "", fmt.Errorf("the cgroup %s mounted is out of the cgroup namespace, the cgroup filesystem should be mounted in the cgroup namespace", root)
+	}
+	rel, err := filepath.Rel(root, cgroup)
+	if err != nil {
+		return "", err
+	}
+	if rel == ".." || strings.HasPrefix(rel, "../") {
+		return "", fmt.Errorf("cgroup %s is not in the cgroup %s mounted", cgroup, root)
+	}
+	return rel, nil
+}
+
 type Mount struct {
 	Mountpoint string
 	Root       string
@@ -355,6 +415,12 @@ func GetAllPids(path string) ([]int, error) {
 		}
 		cPids, err := readProcsFile(p)
 		if err != nil {
+			// On cgroup v2, cgroup.procs can't be read in threaded
+			// cgroups, the processes of which are listed in their
+			// threaded domain.
+			if errors.Is(err, unix.EOPNOTSUPP) {
+				return nil
+			}
 			return err
 		}
 		pids = append(pids, cPids...)
@@ -363,6 +429,49 @@ func GetAllPids(path string) ([]int, error) {
 	return pids, err
 }
 
+// GetAllThreads returns the ids of the threads of the threaded cgroups (of
+// cgroup v2) at path and under it, by cgroup directory.
+func GetAllThreads(path string) (map[string][]int, error) {
+	threads := map[string][]int{}
+	err := filepath.Walk(path, func(p string, info os.FileInfo, iErr error) error {
+		if iErr != nil {
+			return iErr
+		}
+		if info.IsDir() || info.Name() != CgroupThreads {
+			return nil
+		}
+		dir := filepath.Dir(p)
+		typ, err := ioutil.ReadFile(filepath.Join(dir, "cgroup.type"))
+		if err != nil || strings.TrimSpace(string(typ)) != "threaded" {
+			return nil
+		}
+		tids, err := readProcsFile(p)
+		if err != nil {
+			return err
+		}
+		if len(tids) > 0 {
+			threads[dir] = tids
+		}
+		return nil
+	})
+	return threads, err
+}
+
+// SignalAllPids sends sig to all the processes of the cgroup at path and of
+// its subcgroups. The processes which exited in the meantime are ignored.
+func SignalAllPids(path string, sig unix.Signal) error {
+	pids, err := GetAllPids(path)
+	if err != nil {
+		return err
+	}
+	for _, pid := range pids {
+		if err := unix.Kill(pid, sig); err != nil && err != unix.ESRCH {
+			return fmt.Errorf("unable to signal pid %d: %w", pid, err)
+		}
+	}
+	return nil
+}
+
 // WriteCgroupProc writes the specified pid into the cgroup's cgroup.procs file
 func WriteCgroupProc(dir string, pid int) error {
 	// Normally dir should not be empty, one case is that cgroup subsystem
@@ -450,3 +559,35 @@ func ConvertBlkIOToIOWeightValue(blkIoWeight uint16) uint64 {
 	}
 	return uint64(1 + (uint64(blkIoWeight)-10)*9999/990)
 }
+
+// ParsePermyriad parses a percentage with up to two decimals, such as "60%"
+// or "99.5%", as used by systemd-oomd, and returns it in permyriad.
+func ParsePermyriad(s string) (uint32, error) {
+	v := strings.TrimSuffix(s, "%")
+	if v == s {
+		return 0, fmt.Errorf("invalid percentage %q: must end with %%", s)
+	}
+	parts := strings.SplitN(v, ".", 2)
+	whole, err := strconv.ParseUint(parts[0], 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid percentage %q", s)
+	}
+	var frac uint64
+	if len(parts) == 2 {
+		if len(parts[1]) == 0 || len(parts[1]) > 2 {
+			return 0, fmt.Errorf("invalid percentage %q: at most two decimals are supported", s)
+		}
+		frac, err = strconv.ParseUint(parts[1], 10, 32)
+		if err != nil {
+			return 0, fmt.Errorf("invalid percentage %q", s)
+		}
+		if len(parts[1]) == 1 {
+			frac *= 10
+		}
+	}
+	p := whole*100 + frac
+	if p > 10000 {
+		return 0, fmt.Errorf("invalid percentage %q: must be at most 100%%", s)
+	}
+	return uint32(p), nil
+}
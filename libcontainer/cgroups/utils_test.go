@@ -4,13 +4,18 @@ package cgroups
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"reflect"
 	"strings"
 	"testing"
 
 	"github.com/moby/sys/mountinfo"
 	"github.com/sirupsen/logrus"
+	"golang.org/x/sys/unix"
 )
 
 const fedoraMountinfo = `15 35 0:3 / /proc rw,nosuid,nodev,noexec,relatime shared:5 - proc proc rw
@@ -656,3 +661,113 @@ func TestConvertBlkIOToIOWeightValue(t *testing.T) {
 		}
 	}
 }
+
+func TestGetAllThreads(t *testing.T) {
+	root, err := ioutil.TempDir("", "TestGetAllThreads")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	for dir, files := range map[string]map[string]string{
+		"":           {"cgroup.type": "domain threaded\n", CgroupProcesses: "10\n", CgroupThreads: "10\n"},
+		"workers":    {"cgroup.type": "threaded\n", CgroupThreads: "11\n12\n"},
+		"workers/io": {"cgroup.type": "threaded\n", CgroupThreads: ""},
+	} {
+		if err := os.MkdirAll(filepath.Join(root, dir), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		for name, data := range files {
+			if err := ioutil.WriteFile(filepath.Join(root, dir, name), []byte(data), 0o644); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	threads, err := GetAllThreads(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string][]int{filepath.Join(root, "workers"): {11, 12}}
+	if !reflect.DeepEqual(threads, expected) {
+		t.Fatalf("expected %v, got %v", expected, threads)
+	}
+}
+
+func TestErrorSentinels(t *testing.T) {
+	err := fmt.Errorf("applying the cgroup: %w", NewNotFoundError("memory"))
+	if !errors.Is(err, ErrV1NoController) || !IsNotFound(err) {
+		t.Errorf("expected %v to match ErrV1NoController", err)
+	}
+	err = NewRootlessError(unix.EACCES, "rootless needs no limits")
+	if !errors.Is(err, ErrRootless) || !errors.Is(err, unix.EACCES) {
+		t.Errorf("expected %v to match ErrRootless and EACCES", err)
+	}
+	if err.Error() != "rootless needs no limits: permission denied" {
+		t.Errorf("unexpected message %q", err)
+	}
+}
+
+func TestMountRelPath(t *testing.T) {
+	for _, tc := range []struct {
+		root, cgroup string
+		expected     string
+		err          bool
+	}{
+		{root: "/", cgroup: "/user.slice/session-1.scope", expected: "user.slice/session-1.scope"},
+		{root: "/", cgroup: "/", expected: "."},
+		// A part of the hierarchy is mounted, in a container without its own
+		// cgroup namespace.
+		{root: "/docker/abc", cgroup: "/docker/abc/nested", expected: "nested"},
+		{root: "/docker/abc", cgroup: "/docker/def", err: true},
+		{root: "/docker/abc", cgroup: "/docker", err: true},
+		// The cgroup, or the mount, is out of the cgroup namespace.
+		{root: "/", cgroup: "/../abc", err: true},
+		{root: "/../..", cgroup: "/", err: true},
+	} {
+		rel, err := MountRelPath(tc.root, tc.cgroup)
+		if tc.err {
+			if err == nil {
+				t.Errorf("%s in %s: expected an error, got %q", tc.cgroup, tc.root, rel)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s in %s: unexpected error: %v", tc.cgroup, tc.root, err)
+		} else if rel != tc.expected {
+			t.Errorf("%s in %s: expected %q, got %q", tc.cgroup, tc.root, tc.expected, rel)
+		}
+	}
+}
+
+func TestParsePermyriad(t *testing.T) {
+	for _, tc := range []struct {
+		in       string
+		expected uint32
+		err      bool
+	}{
+		{in: "0%", expected: 0},
+		{in: "60%", expected: 6000},
+		{in: "99.5%", expected: 9950},
+		{in: "12.34%", expected: 1234},
+		{in: "100%", expected: 10000},
+		{in: "100.01%", err: true},
+		{in: "1.234%", err: true},
+		{in: "60", err: true},
+		{in: "-1%", err: true},
+		{in: ".5%", err: true},
+		{in: "5.%", err: true},
+	} {
+		p, err := ParsePermyriad(tc.in)
+		if tc.err {
+			if err == nil {
+				t.Errorf("%q: expected an error, got %d", tc.in, p)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", tc.in, err)
+		} else if p != tc.expected {
+			t.Errorf("%q: expected %d, got %d", tc.in, tc.expected, p)
+		}
+	}
+}
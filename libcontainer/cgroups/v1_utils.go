@@ -1,3 +1,5 @@
+// +build linux
+
 package cgroups
 
 import (
@@ -20,15 +22,31 @@ import (
 const (
 	CgroupNamePrefix = "name="
 	defaultPrefix    = "/sys/fs/cgroup"
+
+	// HybridMountpoint is where the unified (cgroup v2) hierarchy, with no
+	// controllers, is mounted along with the cgroup v1 hierarchies in the
+	// so-called hybrid mode.
+	HybridMountpoint = "/sys/fs/cgroup/unified"
 )
 
 var (
 	errUnified     = errors.New("not implemented for cgroup v2 unified hierarchy")
 	ErrV1NoUnified = errors.New("invalid configuration: cannot use unified on cgroup v1")
+	// ErrV1NoController is matched (with errors.Is) by the errors caused by
+	// a cgroup v1 controller (subsystem) which is not mounted, or not used
+	// by the container, such as NotFoundError.
+	ErrV1NoController = errors.New("cgroup: subsystem does not exist")
 
 	readMountinfoOnce sync.Once
 	readMountinfoErr  error
 	cgroupMountinfo   []*mountinfo.Info
+
+	isHybridOnce sync.Once
+	isHybrid     bool
+
+	hybridRootOnce sync.Once
+	hybridRoot     string
+	hybridRootErr  error
 )
 
 type NotFoundError struct {
@@ -39,6 +57,11 @@ func (e *NotFoundError) Error() string {
 	return fmt.Sprintf("mountpoint for %s not found", e.Subsystem)
 }
 
+// Is reports whether target is ErrV1NoController.
+func (e *NotFoundError) Is(target error) bool {
+	return target == ErrV1NoController
+}
+
 func NewNotFoundError(sub string) error {
 	return &NotFoundError{
 		Subsystem: sub,
@@ -46,11 +69,8 @@ func NewNotFoundError(sub string) error {
 }
 
 func IsNotFound(err error) bool {
-	if err == nil {
-		return false
-	}
-	_, ok := err.(*NotFoundError)
-	return ok
+	var nfErr *NotFoundError
+	return errors.As(err, &nfErr)
 }
 
 func tryDefaultPath(cgroupPath, subsystem string) string {
@@ -110,6 +130,54 @@ func readCgroupMountinfo() ([]*mountinfo.Info, error) {
 	return cgroupMountinfo, readMountinfoErr
 }
 
+// IsCgroup2HybridMode returns whether we are running in cgroup v1 with the
+// unified hierarchy mounted on HybridMountpoint.
+func IsCgroup2HybridMode() bool {
+	isHybridOnce.Do(func() {
+		if IsCgroup2UnifiedMode() {
+			return
+		}
+		var st unix.Statfs_t
+		if err := unix.Statfs(HybridMountpoint, &st); err != nil {
+			return
+		}
+		isHybrid = st.Type == unix.CGROUP2_SUPER_MAGIC
+	})
+	return isHybrid
+}
+
+// GetHybridCgroupPath returns the path under HybridMountpoint of the cgroup
+// of the unified hierarchy, given as in /proc/PID/cgroup.
+func GetHybridCgroupPath(cgroup string) (string, error) {
+	if !IsCgroup2HybridMode() {
+		return "", fmt.Errorf("the unified hierarchy is not mounted on %s", HybridMountpoint)
+	}
+	hybridRootOnce.Do(func() {
+		mounts, err := mountinfo.GetMounts(func(m *mountinfo.Info) (bool, bool) {
+			return m.Mountpoint != HybridMountpoint || m.FSType != "cgroup2", false
+		})
+		if err != nil {
+			hybridRootErr = err
+			return
+		}
+		hybridRoot = "/"
+		// The last mount is the visible one.
+		if len(mounts) > 0 {
+			hybridRoot = mounts[len(mounts)-1].Root
+		}
+	})
+	if hybridRootErr != nil {
+		return "", hybridRootErr
+	}
+	// Only a part of the hierarchy can be mounted, such as in a container
+	// without its own cgroup namespace.
+	rel, err := MountRelPath(hybridRoot, cgroup)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(HybridMountpoint, rel), nil
+}
+
 // https://www.kernel.org/doc/Documentation/cgroup-v1/cgroups.txt
 func FindCgroupMountpoint(cgroupPath, subsystem string) (string, error) {
 	if IsCgroup2UnifiedMode() {
@@ -258,7 +326,7 @@ func getCgroupPathHelper(subsystem, cgroup string) (string, error) {
 
 	// This is needed for nested containers, because in /proc/self/cgroup we
 	// see paths from host, which don't exist in container.
-	relCgroup, err := filepath.Rel(root, cgroup)
+	relCgroup, err := MountRelPath(root, cgroup)
 	if err != nil {
 		return "", err
 	}
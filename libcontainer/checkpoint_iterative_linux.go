@@ -0,0 +1,121 @@
+// +build linux
+
+package libcontainer
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// preDumpPrefix is the prefix of the directories of the pre-dumps of an
+// IterativeCheckpoint, which are followed by the number of the iteration.
+const preDumpPrefix = "predump-"
+
+// IterativeCheckpoint checkpoints a container iteratively, as done for live
+// migration: a chain of pre-dumps copies the memory of the container while it
+// keeps running, each one copying only the pages dirtied since the previous
+// one, so that the final dump, during which the container is frozen, is
+// short.
+//
+// The images of the final dump are written to Opts.ImagesDirectory, from
+// which the container can be restored, and the ones of the pre-dumps to
+// predump-1, predump-2, ... under it.
+type IterativeCheckpoint struct {
+	// Opts are the options of all the iterations, except for PreDump and
+	// ParentImage, which are set for each of them. If WorkDirectory is
+	// set, the pre-dumps use the predump-<n> directories under it.
+	Opts CriuOpts
+
+	container  interface{ Checkpoint(*CriuOpts) error }
+	iterations int
+	dumped     bool
+}
+
+// NewIterativeCheckpoint returns an IterativeCheckpoint of the container. The
+// pre-dumps already in opts.ImagesDirectory (for example done by another
+// process) are counted as its first iterations, so that the next pre-dump
+// or the final dump uses the last one as parent.
+func NewIterativeCheckpoint(c Container, opts CriuOpts) (*IterativeCheckpoint, error) {
+	if opts.ImagesDirectory == "" {
+		return nil, errors.New("invalid directory to save checkpoint")
+	}
+	if opts.PreDump || opts.ParentImage != "" {
+		return nil, errors.New("PreDump and ParentImage are set by the iterative checkpoint")
+	}
+	if err := os.MkdirAll(opts.ImagesDirectory, 0o700); err != nil {
+		return nil, err
+	}
+	ic := &IterativeCheckpoint{Opts: opts, container: c}
+	for {
+		fi, err := os.Stat(filepath.Join(opts.ImagesDirectory, preDumpDir(ic.iterations+1)))
+		if err != nil || !fi.IsDir() {
+			break
+		}
+		ic.iterations++
+	}
+	return ic, nil
+}
+
+func preDumpDir(iteration int) string {
+	return preDumpPrefix + strconv.Itoa(iteration)
+}
+
+// Iterations returns the number of pre-dumps done so far.
+func (ic *IterativeCheckpoint) Iterations() int {
+	return ic.iterations
+}
+
+// PreDump pre-dumps the container, tracking the pages it dirties from then
+// on, and returns the directory of the images of the pre-dump.
+func (ic *IterativeCheckpoint) PreDump() (string, error) {
+	if ic.dumped {
+		return "", errors.New("the container was already dumped")
+	}
+	opts := ic.Opts
+	dir := preDumpDir(ic.iterations + 1)
+	opts.ImagesDirectory = filepath.Join(ic.Opts.ImagesDirectory, dir)
+	if ic.Opts.WorkDirectory != "" {
+		opts.WorkDirectory = filepath.Join(ic.Opts.WorkDirectory, dir)
+	}
+	opts.PreDump = true
+	if ic.iterations > 0 {
+		// The parent is relative to the images directory.
+		opts.ParentImage = filepath.Join("..", preDumpDir(ic.iterations))
+	}
+	if err := ic.container.Checkpoint(&opts); err != nil {
+		return "", fmt.Errorf("pre-dump %d: %w", ic.iterations+1, err)
+	}
+	ic.iterations++
+	return opts.ImagesDirectory, nil
+}
+
+// PreDumps runs n pre-dumps in a row.
+func (ic *IterativeCheckpoint) PreDumps(n int) error {
+	for i := 0; i < n; i++ {
+		if _, err := ic.PreDump(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Dump does the final dump of the container, copying only the pages dirtied
+// since the last pre-dump, if any. Unless Opts.LeaveRunning is set, the
+// processes of the container are killed once they are dumped.
+func (ic *IterativeCheckpoint) Dump() error {
+	if ic.dumped {
+		return errors.New("the container was already dumped")
+	}
+	opts := ic.Opts
+	if ic.iterations > 0 {
+		opts.ParentImage = preDumpDir(ic.iterations)
+	}
+	if err := ic.container.Checkpoint(&opts); err != nil {
+		return err
+	}
+	ic.dumped = true
+	return nil
+}
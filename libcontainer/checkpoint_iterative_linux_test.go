@@ -0,0 +1,60 @@
+package libcontainer
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// fakeCheckpointer records the checkpoints, creating their images
+// directories.
+type fakeCheckpointer struct {
+	opts []CriuOpts
+}
+
+func (f *fakeCheckpointer) Checkpoint(opts *CriuOpts) error {
+	f.opts = append(f.opts, *opts)
+	return os.MkdirAll(opts.ImagesDirectory, 0o700)
+}
+
+func TestIterativeCheckpoint(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestIterativeCheckpoint")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	// A pre-dump done by another process.
+	if err := os.Mkdir(filepath.Join(dir, "predump-1"), 0o700); err != nil {
+		t.Fatal(err)
+	}
+
+	ic, err := NewIterativeCheckpoint(nil, CriuOpts{ImagesDirectory: dir, LeaveRunning: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ic.Iterations() != 1 {
+		t.Fatalf("expected 1 iteration, got %d", ic.Iterations())
+	}
+	f := &fakeCheckpointer{}
+	ic.container = f
+	if err := ic.PreDumps(2); err != nil {
+		t.Fatal(err)
+	}
+	if err := ic.Dump(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ic.PreDump(); err == nil {
+		t.Fatal("expected an error pre-dumping a dumped container")
+	}
+
+	expected := []CriuOpts{
+		{ImagesDirectory: filepath.Join(dir, "predump-2"), ParentImage: "../predump-1", PreDump: true, LeaveRunning: true},
+		{ImagesDirectory: filepath.Join(dir, "predump-3"), ParentImage: "../predump-2", PreDump: true, LeaveRunning: true},
+		{ImagesDirectory: dir, ParentImage: "predump-3", LeaveRunning: true},
+	}
+	if !reflect.DeepEqual(f.opts, expected) {
+		t.Fatalf("expected checkpoints\n%+v\ngot\n%+v", expected, f.opts)
+	}
+}
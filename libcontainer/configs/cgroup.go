@@ -0,0 +1,239 @@
+package configs
+
+import "github.com/opencontainers/runc/libcontainer/devices"
+
+type FreezerState string
+
+const (
+	Undefined FreezerState = ""
+	Frozen    FreezerState = "FROZEN"
+	Thawed    FreezerState = "THAWED"
+)
+
+type Cgroup struct {
+	// Deprecated, use Path instead
+	Name string `json:"name,omitempty"`
+
+	// name of parent of cgroup or slice
+	// Deprecated, use Path instead
+	Parent string `json:"parent,omitempty"`
+
+	// Path specifies the path to cgroups that are created and/or joined by the container.
+	// The path is assumed to be relative to the host system cgroup mountpoint.
+	Path string `json:"path"`
+
+	// ScopePrefix describes prefix for the scope name
+	ScopePrefix string `json:"scope_prefix"`
+
+	// Paths represent the absolute cgroups paths to join.
+	// This takes precedence over Path.
+	Paths map[string]string
+
+	// Resources contains various cgroups settings to apply
+	*Resources
+
+	// Systemd tells if systemd is used to manage cgroups.
+	Systemd bool `json:"systemd,omitempty"`
+
+	// SystemdProps are any additional properties for systemd,
+	// derived from org.systemd.property.xxx annotations.
+	// Ignored unless systemd is used for managing cgroups.
+	SystemdProps []SystemdProperty `json:"-"`
+
+	// DeviceFilterPinPath, if set, is the path on bpffs at which the eBPF
+	// device filter program is pinned. Ignored unless cgroup v2 is used.
+	DeviceFilterPinPath string `json:"device_filter_pin_path,omitempty"`
+
+	// DeviceFilterMap, if true, makes the eBPF device filter program consult
+	// a map of the allowed devices, which is updated in place when the
+	// device rules are changed. Ignored unless cgroup v2 is used.
+	DeviceFilterMap bool `json:"device_filter_map,omitempty"`
+
+	// DeviceFilterFailClosed, if true, makes the eBPF device filter program
+	// mandatory: errors installing it are not ignored (as they are for
+	// rootless containers, or if all the device accesses are allowed), and
+	// once it is detached, the programs it replaced, or a program denying
+	// access to all the devices, are attached in its place. Ignored unless
+	// cgroup v2 is used.
+	DeviceFilterFailClosed bool `json:"device_filter_fail_closed,omitempty"`
+
+	// AuditDevices, if true, makes the eBPF device filter program record
+	// the device accesses it denies, which can be watched (see
+	// Container.NotifyDeviceDenied). On cgroup v1, this requires the
+	// unified hierarchy to be mounted on /sys/fs/cgroup/unified (the hybrid
+	// mode), where a program recording the accesses denied by the device
+	// rules is attached to the cgroup of the container.
+	AuditDevices bool `json:"audit_devices,omitempty"`
+
+	// CreatedParents are the directories of the ancestor cgroups (or
+	// systemd slices) which were created for the container, from the
+	// topmost one. The memory protections of the container are propagated
+	// to them, and reverted when it is destroyed. Set by the cgroup v2
+	// managers.
+	CreatedParents []string `json:"created_parents,omitempty"`
+}
+
+type Resources struct {
+	// Devices is the set of access rules for devices in the container.
+	Devices []*devices.Rule `json:"devices"`
+
+	// Memory limit (in bytes)
+	Memory int64 `json:"memory"`
+
+	// Memory reservation or soft_limit (in bytes)
+	MemoryReservation int64 `json:"memory_reservation"`
+
+	// Total memory usage (memory + swap); set `-1` to enable unlimited swap
+	MemorySwap int64 `json:"memory_swap"`
+
+	// CPU shares (relative weight vs. other containers)
+	CpuShares uint64 `json:"cpu_shares"`
+
+	// CPU hardcap limit (in usecs). Allowed cpu time in a given period.
+	CpuQuota int64 `json:"cpu_quota"`
+
+	// CPU period to be used for hardcapping (in usecs). 0 to use system default.
+	CpuPeriod uint64 `json:"cpu_period"`
+
+	// CPU burst, i.e. the maximum accumulated run time (in usecs) a cgroup
+	// can use above its quota in a given period. Requires kernel >= 5.14.
+	// nil means "not set"; 0 disables burst.
+	CpuBurst *uint64 `json:"cpu_burst,omitempty"`
+
+	// CPUIdle, if set to 1, makes the cgroup SCHED_IDLE, i.e. it only gets
+	// the CPU time not used by non-idle cgroups of its siblings. 0 resets it.
+	// nil means "not set". This is cgroup v2 only, and requires kernel >= 5.15.
+	CPUIdle *int64 `json:"cpu_idle,omitempty"`
+
+	// How many time CPU will use in realtime scheduling (in usecs).
+	CpuRtRuntime int64 `json:"cpu_rt_quota"`
+
+	// CPU period to be used for realtime scheduling (in usecs).
+	CpuRtPeriod uint64 `json:"cpu_rt_period"`
+
+	// CPU to use
+	CpusetCpus string `json:"cpuset_cpus"`
+
+	// MEM to use
+	CpusetMems string `json:"cpuset_mems"`
+
+	// CpusetPartition is the type of the cpuset partition of the cgroup:
+	// "member" (the default), "root" or "isolated" (a partition root
+	// without load balancing). A partition root has exclusive use of its
+	// CPUs. Used on cgroup v2 only.
+	CpusetPartition string `json:"cpuset_partition,omitempty"`
+
+	// Process limit; set <= `0' to disable limit.
+	PidsLimit int64 `json:"pids_limit"`
+
+	// Specifies per cgroup weight, range is from 10 to 1000.
+	BlkioWeight uint16 `json:"blkio_weight"`
+
+	// Specifies tasks' weight in the given cgroup while competing with the cgroup's child cgroups, range is from 10 to 1000, cfq scheduler only
+	BlkioLeafWeight uint16 `json:"blkio_leaf_weight"`
+
+	// Weight per cgroup per device, can override BlkioWeight.
+	BlkioWeightDevice []*WeightDevice `json:"blkio_weight_device"`
+
+	// IO read rate limit per cgroup per device, bytes per second.
+	BlkioThrottleReadBpsDevice []*ThrottleDevice `json:"blkio_throttle_read_bps_device"`
+
+	// IO write rate limit per cgroup per device, bytes per second.
+	BlkioThrottleWriteBpsDevice []*ThrottleDevice `json:"blkio_throttle_write_bps_device"`
+
+	// IO read rate limit per cgroup per device, IO per second.
+	BlkioThrottleReadIOPSDevice []*ThrottleDevice `json:"blkio_throttle_read_iops_device"`
+
+	// IO write rate limit per cgroup per device, IO per second.
+	BlkioThrottleWriteIOPSDevice []*ThrottleDevice `json:"blkio_throttle_write_iops_device"`
+
+	// set the freeze value for the process
+	Freezer FreezerState `json:"freezer"`
+
+	// Hugetlb limit (in bytes)
+	HugetlbLimit []*HugepageLimit `json:"hugetlb_limit"`
+
+	// Whether to disable OOM Killer
+	OomKillDisable bool `json:"oom_kill_disable"`
+
+	// Tuning swappiness behaviour per cgroup
+	MemorySwappiness *uint64 `json:"memory_swappiness"`
+
+	// Set priority of network traffic for container
+	NetPrioIfpriomap []*IfPrioMap `json:"net_prio_ifpriomap"`
+
+	// Set class identifier for container's network packets
+	NetClsClassid uint32 `json:"net_cls_classid_u"`
+
+	// Rdma resource restriction configuration, keyed by device name.
+	Rdma map[string]LinuxRdma `json:"rdma"`
+
+	// Used on cgroups v2:
+
+	// CpuWeight sets a proportional bandwidth limit.
+	CpuWeight uint64 `json:"cpu_weight"`
+
+	// Unified is cgroupv2-only key-value map.
+	Unified map[string]string `json:"unified"`
+
+	// MemoryMin is the hard memory protection (in bytes): the memory
+	// usage of the cgroup under this amount is never reclaimed. 0 means
+	// "not set", and -1 means "max".
+	MemoryMin int64 `json:"memory_min,omitempty"`
+
+	// MemoryLow is the best-effort memory protection (in bytes): the memory
+	// usage of the cgroup under this amount is only reclaimed if there is
+	// no unprotected memory to reclaim. It takes precedence over
+	// MemoryReservation, which is also converted to memory.low. 0 means
+	// "not set", and -1 means "max".
+	MemoryLow int64 `json:"memory_low,omitempty"`
+
+	// MemorySwapHigh is the swap usage throttle limit (in bytes). Unlike
+	// MemorySwap, it only accounts for swap, not memory. 0 means "not set",
+	// and -1 means "max".
+	MemorySwapHigh int64 `json:"memory_swap_high,omitempty"`
+
+	// MemoryZswapMax is the maximum size of the zswap pool (in bytes).
+	// nil means "not set", 0 disables zswap, and -1 means "max".
+	MemoryZswapMax *int64 `json:"memory_zswap_max,omitempty"`
+
+	// MemoryZswapWriteback controls whether the pages evicted from the zswap
+	// pool are written back to swap (requires kernel >= 6.8). nil means
+	// "not set".
+	MemoryZswapWriteback *bool `json:"memory_zswap_writeback,omitempty"`
+
+	// MemoryOOMGroup makes the OOM killer kill all the processes of the
+	// cgroup together, rather than some of them only (memory.oom.group).
+	// nil means "not set". Used on cgroup v2 only.
+	MemoryOOMGroup *bool `json:"memory_oom_group,omitempty"`
+
+	// ManagedOOMMemoryPressure is the action of systemd-oomd when the memory
+	// pressure of the cgroup exceeds its limit: "kill" to kill the processes
+	// of the descendant cgroup with the most reclaim activity, or "auto".
+	// Used with the systemd cgroup driver on cgroup v2 only.
+	ManagedOOMMemoryPressure string `json:"managed_oom_memory_pressure,omitempty"`
+
+	// ManagedOOMMemoryPressureLimit is the memory pressure limit of
+	// systemd-oomd, in permyriad (hundredths of a percent), 0 meaning the
+	// default limit of systemd-oomd. nil means "not set". Used with the
+	// systemd cgroup driver on cgroup v2 only.
+	ManagedOOMMemoryPressureLimit *uint32 `json:"managed_oom_memory_pressure_limit,omitempty"`
+
+	// Misc is a map of misc controller resource names (e.g. "sev",
+	// "sev_es") to their limits. A value of -1 means "max" (no limit).
+	// Used on cgroup v2 only.
+	Misc map[string]int64 `json:"misc,omitempty"`
+
+	// AllowedAddressFamilies, if not nil, is the list of address families
+	// (such as AF_INET) of the sockets which can be created in the cgroup,
+	// enforced by a seccomp filter of the container processes and, for the
+	// inet families, by an eBPF program. Used on cgroup v2 only.
+	AllowedAddressFamilies []int `json:"allowed_address_families"`
+
+	// SkipDevices allows to skip configuring device permissions.
+	// Used by e.g. kubelet while creating a parent cgroup (kubepods)
+	// common for many containers.
+	//
+	// NOTE it is impossible to start a container which has this flag set.
+	SkipDevices bool `json:"skip_devices"`
+}
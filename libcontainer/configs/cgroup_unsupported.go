@@ -2,7 +2,9 @@
 
 package configs
 
-// TODO Windows: This can ultimately be entirely factored out on Windows as
-// cgroups are a Unix-specific construct.
-type Cgroup struct {
+// SystemdProperty is a property of the systemd unit of a container. There is
+// no systemd cgroup driver on this platform, so it is never used.
+type SystemdProperty struct {
+	Name  string
+	Value interface{}
 }
@@ -2,6 +2,7 @@ package configs
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"os/exec"
@@ -26,6 +27,72 @@ type IDMap struct {
 	Size        int `json:"size"`
 }
 
+// TimeOffset is the offset of a clock of the time namespace.
+type TimeOffset struct {
+	Secs     int64  `json:"secs"`
+	Nanosecs uint32 `json:"nanosecs"`
+}
+
+// Scheduler represents the scheduling attributes of the container's init
+// process, see sched_setattr(2).
+type Scheduler struct {
+	// Policy is the scheduling policy, such as "SCHED_FIFO".
+	Policy string `json:"policy"`
+
+	// Nice is the nice value, for SCHED_OTHER and SCHED_BATCH.
+	Nice int32 `json:"nice,omitempty"`
+
+	// Priority is the static priority, for SCHED_FIFO and SCHED_RR.
+	Priority int32 `json:"priority,omitempty"`
+
+	// Flags are the scheduling flags, such as "SCHED_FLAG_RESET_ON_FORK".
+	Flags []string `json:"flags,omitempty"`
+
+	// Runtime, Deadline and Period (in nanoseconds) are the parameters
+	// of SCHED_DEADLINE.
+	Runtime  uint64 `json:"runtime,omitempty"`
+	Deadline uint64 `json:"deadline,omitempty"`
+	Period   uint64 `json:"period,omitempty"`
+}
+
+// Linux execution domains, see personality(2).
+const (
+	PerLinux   = 0x0000
+	PerLinux32 = 0x0008
+)
+
+// LinuxPersonality represents the Linux execution domain of the container's
+// processes.
+type LinuxPersonality struct {
+	// Domain is the execution domain, such as PerLinux32.
+	Domain int `json:"domain"`
+}
+
+// IOPriority represents the I/O scheduling class and priority of a process,
+// see ioprio_set(2).
+type IOPriority struct {
+	// Class is the I/O scheduling class, such as "IOPRIO_CLASS_IDLE".
+	Class string `json:"class"`
+
+	// Priority is the priority level within the class, from 0 (highest)
+	// to 7 (lowest). It is ignored by IOPRIO_CLASS_IDLE.
+	Priority int `json:"priority"`
+}
+
+// MemoryPolicy represents the default NUMA memory policy of the container's
+// init process, see set_mempolicy(2).
+type MemoryPolicy struct {
+	// Mode is the policy mode, such as "MPOL_BIND".
+	Mode string `json:"mode"`
+
+	// Nodes is the list of the memory nodes of the policy, in the format of
+	// cpuset.mems, such as "0-1,3".
+	Nodes string `json:"nodes,omitempty"`
+
+	// Flags are the mode flags, such as "MPOL_F_STATIC_NODES".
+	Flags []string `json:"flags,omitempty"`
+}
+
 // Seccomp represents syscall restrictions
 // By default, only the native architecture of the kernel is allowed to be used
 // for syscalls. Additional architectures can be added by specifying them in
@@ -35,6 +102,30 @@ type Seccomp struct {
 	Architectures   []string   `json:"architectures"`
 	Syscalls        []*Syscall `json:"syscalls"`
 	DefaultErrnoRet *uint      `json:"default_errno_ret"`
+	// ListenerPath is the path of a unix socket to which the seccomp
+	// notify fd is sent (along with the container process state), if
+	// any of the syscalls use the Notify action.
+	ListenerPath string `json:"listener_path,omitempty"`
+	// ListenerMetadata is opaque data passed to the seccomp agent
+	// listening on ListenerPath.
+	ListenerMetadata string `json:"listener_metadata,omitempty"`
+}
+
+// IsNotifyUsed returns whether any of the seccomp rules use the Notify
+// action, meaning a seccomp notify fd has to be obtained for the filter.
+func (s *Seccomp) IsNotifyUsed() bool {
+	if s == nil {
+		return false
+	}
+	if s.DefaultAction == Notify {
+		return true
+	}
+	for _, call := range s.Syscalls {
+		if call != nil && call.Action == Notify {
+			return true
+		}
+	}
+	return false
 }
 
 // Action is taken upon rule match in Seccomp
@@ -47,6 +138,7 @@ const (
 	Allow
 	Trace
 	Log
+	Notify
 )
 
 // Operator is a comparison operator to be used when matching syscall arguments in Seccomp
@@ -94,6 +186,11 @@ type Config struct {
 	// Path to a directory containing the container's root filesystem.
 	Rootfs string `json:"rootfs"`
 
+	// RootfsIDMapping, if set, makes the container's root filesystem an
+	// idmapped mount. It is set from the org.opencontainers.runc.rootfs.idmap
+	// annotation of the spec.
+	RootfsIDMapping *MountIDMapping `json:"rootfs_id_mapping,omitempty"`
+
 	// Umask is the umask to use inside of the container.
 	Umask *uint32 `json:"umask"`
 
@@ -130,6 +227,12 @@ type Config struct {
 	// Routes can be specified to create entries in the route table as the container is started
 	Routes []*Route `json:"routes"`
 
+	// PortForwards are the ports of the host passed to the init process of
+	// the container as listening sockets, using the socket activation
+	// protocol ($LISTEN_FDS), rather than forwarded by a networking helper.
+	// Their container port is the host port.
+	PortForwards []PortForward `json:"port_forwards,omitempty"`
+
 	// Cgroups specifies specific cgroup settings for the various subsystems that the container is
 	// placed into to limit the resources the container has available
 	Cgroups *Cgroup `json:"cgroups"`
@@ -159,6 +262,33 @@ type Config struct {
 	// GidMappings is an array of Group ID mappings for User Namespaces
 	GidMappings []IDMap `json:"gid_mappings"`
 
+	// Scheduler specifies the scheduling attributes of the init process.
+	// If it is unset, the scheduling attributes of runc are inherited.
+	Scheduler *Scheduler `json:"scheduler,omitempty"`
+
+	// SchedCore specifies whether to create a new core scheduling cookie
+	// for the container. Its processes (including the ones executed later)
+	// then never run concurrently with other tasks on the SMT siblings of
+	// a core.
+	SchedCore bool `json:"sched_core,omitempty"`
+
+	// Personality specifies the Linux execution domain of the container's
+	// processes. If it is unset, the personality of runc is inherited.
+	Personality *LinuxPersonality `json:"personality,omitempty"`
+
+	// IOPriority specifies the I/O priority of the container's processes.
+	// If it is unset, the I/O priority of runc is inherited.
+	IOPriority *IOPriority `json:"io_priority,omitempty"`
+
+	// MemoryPolicy specifies the NUMA memory policy of the init process,
+	// which is inherited by its children. If it is unset, the memory policy
+	// of runc is inherited.
+	MemoryPolicy *MemoryPolicy `json:"memory_policy,omitempty"`
+
+	// TimeOffsets specifies the offsets of the clocks ("monotonic" and
+	// "boottime") of a new time namespace.
+	TimeOffsets map[string]TimeOffset `json:"time_offsets,omitempty"`
+
 	// MaskPaths specifies paths within the container's rootfs to mask over with a bind
 	// mount pointing to /dev/null as to prevent reads of the file.
 	MaskPaths []string `json:"mask_paths"`
@@ -242,6 +372,16 @@ const (
 	// Poststop commands are executed after the container init process exits.
 	// Poststop commands are called in the Runtime Namespace.
 	Poststop HookName = "poststop"
+
+	// PostCheckpoint commands are executed after the container has been
+	// successfully checkpointed. They are not part of the runtime-spec.
+	// PostCheckpoint commands are called in the Runtime Namespace.
+	PostCheckpoint HookName = "postCheckpoint"
+
+	// PreRestore commands are executed before the container is restored
+	// from a checkpoint. They are not part of the runtime-spec.
+	// PreRestore commands are called in the Runtime Namespace.
+	PreRestore HookName = "preRestore"
 )
 
 type Capabilities struct {
@@ -258,13 +398,56 @@ type Capabilities struct {
 }
 
 func (hooks HookList) RunHooks(state *specs.State) error {
+	return hooks.RunHooksContext(context.Background(), state)
+}
+
+// RunHooksContext is like RunHooks, except that once ctx is done, the command
+// hook being run is killed, and the remaining hooks are not run.
+func (hooks HookList) RunHooksContext(ctx context.Context, state *specs.State) error {
+	_, err := hooks.RunHooksWithResults(ctx, "", state)
+	return err
+}
+
+// RunHooksWithResults is like RunHooksContext, but also returns the results
+// of the command hooks which were run, including the failed one, if any.
+func (hooks HookList) RunHooksWithResults(ctx context.Context, name HookName, state *specs.State) ([]HookResult, error) {
+	var results []HookResult
 	for i, h := range hooks {
-		if err := h.Run(state); err != nil {
-			return errors.Wrapf(err, "Running hook #%d:", i)
+		if err := ctx.Err(); err != nil {
+			return results, errors.Wrapf(err, "Running hook #%d:", i)
+		}
+		var err error
+		if cmd, ok := h.(CommandHook); ok {
+			var res HookResult
+			res, err = cmd.RunWithResultContext(ctx, state)
+			res.Name = name
+			results = append(results, res)
+		} else {
+			err = h.Run(state)
+		}
+		if err != nil {
+			return results, errors.Wrapf(err, "Running hook #%d:", i)
 		}
 	}
 
-	return nil
+	return results, nil
+}
+
+// HookOutputLimit is the maximum number of bytes of the stdout and stderr
+// of a hook kept in its HookResult.
+const HookOutputLimit = 4096
+
+// HookResult is the outcome of a command hook.
+type HookResult struct {
+	Name     HookName  `json:"name"`
+	Path     string    `json:"path"`
+	Started  time.Time `json:"started"`
+	ExitCode int       `json:"exit_code"`
+	Stdout   string    `json:"stdout,omitempty"`
+	Stderr   string    `json:"stderr,omitempty"`
+	// Error is set if the hook failed to start, exited with a non-zero
+	// status, or ran past its timeout.
+	Error string `json:"error,omitempty"`
 }
 
 func (hooks *Hooks) UnmarshalJSON(b []byte) error {
@@ -303,14 +486,21 @@ func (hooks *Hooks) MarshalJSON() ([]byte, error) {
 		return serializableHooks
 	}
 
-	return json.Marshal(map[string]interface{}{
+	m := map[string]interface{}{
 		"prestart":        serialize((*hooks)[Prestart]),
 		"createRuntime":   serialize((*hooks)[CreateRuntime]),
 		"createContainer": serialize((*hooks)[CreateContainer]),
 		"startContainer":  serialize((*hooks)[StartContainer]),
 		"poststart":       serialize((*hooks)[Poststart]),
 		"poststop":        serialize((*hooks)[Poststop]),
-	})
+	}
+	// The non-standard hooks are only serialized when set.
+	for _, name := range []HookName{PostCheckpoint, PreRestore} {
+		if len((*hooks)[name]) > 0 {
+			m[string(name)] = serialize((*hooks)[name])
+		}
+	}
+	return json.Marshal(m)
 }
 
 type Hook interface {
@@ -353,29 +543,46 @@ type CommandHook struct {
 }
 
 func (c Command) Run(s *specs.State) error {
+	_, err := c.RunWithResult(s)
+	return err
+}
+
+// RunWithResult runs the hook, and returns its result, with the output
+// truncated to HookOutputLimit bytes.
+func (c Command) RunWithResult(s *specs.State) (HookResult, error) {
+	return c.RunWithResultContext(context.Background(), s)
+}
+
+// RunWithResultContext is like RunWithResult, except that the hook is killed
+// once ctx is done, as on timeout.
+func (c Command) RunWithResultContext(ctx context.Context, s *specs.State) (HookResult, error) {
+	res := HookResult{Path: c.Path, Started: time.Now().UTC(), ExitCode: -1}
 	b, err := json.Marshal(s)
 	if err != nil {
-		return err
+		res.Error = err.Error()
+		return res, err
 	}
-	var stdout, stderr bytes.Buffer
+	stdout := &limitedBuffer{limit: HookOutputLimit}
+	stderr := &limitedBuffer{limit: HookOutputLimit}
 	cmd := exec.Cmd{
 		Path:   c.Path,
 		Args:   c.Args,
 		Env:    c.Env,
 		Stdin:  bytes.NewReader(b),
-		Stdout: &stdout,
-		Stderr: &stderr,
+		Stdout: stdout,
+		Stderr: stderr,
 	}
+	// Run the hook in its own process group, so that any process it
+	// spawns can be killed along with it on timeout. Otherwise, a leftover
+	// child holding the output pipes would keep cmd.Wait from returning.
+	setProcessGroup(&cmd)
 	if err := cmd.Start(); err != nil {
-		return err
+		res.Error = err.Error()
+		return res, err
 	}
 	errC := make(chan error, 1)
 	go func() {
-		err := cmd.Wait()
-		if err != nil {
-			err = fmt.Errorf("error running hook: %v, stdout: %s, stderr: %s", err, stdout.String(), stderr.String())
-		}
-		errC <- err
+		errC <- cmd.Wait()
 	}()
 	var timerCh <-chan time.Time
 	if c.Timeout != nil {
@@ -384,11 +591,45 @@ func (c Command) Run(s *specs.State) error {
 		timerCh = timer.C
 	}
 	select {
-	case err := <-errC:
-		return err
+	case err = <-errC:
+		if err != nil {
+			err = fmt.Errorf("error running hook: %v", err)
+		}
 	case <-timerCh:
-		_ = cmd.Process.Kill()
+		killProcessGroup(cmd.Process)
+		<-errC
+		err = fmt.Errorf("hook ran past specified timeout of %.1fs", c.Timeout.Seconds())
+	case <-ctx.Done():
+		killProcessGroup(cmd.Process)
 		<-errC
-		return fmt.Errorf("hook ran past specified timeout of %.1fs", c.Timeout.Seconds())
+		err = fmt.Errorf("hook was canceled: %w", ctx.Err())
+	}
+	res.ExitCode = cmd.ProcessState.ExitCode()
+	res.Stdout, res.Stderr = stdout.String(), stderr.String()
+	if err != nil {
+		res.Error = err.Error()
+		return res, fmt.Errorf("%w, stdout: %s, stderr: %s", err, res.Stdout, res.Stderr)
 	}
+	return res, nil
+}
+
+// limitedBuffer is a buffer which silently discards the data written past
+// limit bytes.
+type limitedBuffer struct {
+	buf   bytes.Buffer
+	limit int
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if n := b.limit - b.buf.Len(); n < len(p) {
+		if n > 0 {
+			b.buf.Write(p[:n])
+		}
+		return len(p), nil
+	}
+	return b.buf.Write(p)
+}
+
+func (b *limitedBuffer) String() string {
+	return b.buf.String()
 }
@@ -1,11 +1,14 @@
 package configs_test
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"reflect"
+	"strings"
 	"testing"
 	"time"
 
@@ -13,6 +16,15 @@ import (
 	"github.com/opencontainers/runtime-spec/specs-go"
 )
 
+var hookNameList = []configs.HookName{
+	configs.Prestart,
+	configs.CreateRuntime,
+	configs.CreateContainer,
+	configs.StartContainer,
+	configs.Poststart,
+	configs.Poststop,
+}
+
 func TestUnmarshalHooks(t *testing.T) {
 	timeout := time.Second
 
@@ -29,7 +41,7 @@ func TestUnmarshalHooks(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	for _, hookName := range configs.HookNameList {
+	for _, hookName := range hookNameList {
 		hooks := configs.Hooks{}
 		err = hooks.UnmarshalJSON([]byte(fmt.Sprintf(`{"%s" :[%s]}`, hookName, hookJson)))
 		if err != nil {
@@ -227,3 +239,142 @@ func TestCommandHookRunTimeout(t *testing.T) {
 		t.Error("Expected error to occur but it was nil")
 	}
 }
+
+func TestCommandHookRunTimeoutKillsChildren(t *testing.T) {
+	state := &specs.State{
+		Version: "1",
+		ID:      "1",
+		Status:  "created",
+		Pid:     1,
+		Bundle:  "/bundle",
+	}
+	timeout := 100 * time.Millisecond
+
+	// The background sleep inherits the output pipes of the hook, so Run
+	// would not return before it exits, unless it is killed too.
+	cmdHook := configs.NewCommandHook(configs.Command{
+		Path:    "/bin/sh",
+		Args:    []string{"/bin/sh", "-c", "echo started; sleep 10 & wait"},
+		Timeout: &timeout,
+	})
+
+	start := time.Now()
+	err := cmdHook.Run(state)
+	if err == nil {
+		t.Fatal("Expected error to occur but it was nil")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Expected the hook to be killed on timeout, but Run took %s", elapsed)
+	}
+	if !strings.Contains(err.Error(), "started") {
+		t.Errorf("Expected the error to contain the hook output, got %v", err)
+	}
+}
+
+func TestRunHooksContextCanceled(t *testing.T) {
+	state := &specs.State{
+		Version: "1",
+		ID:      "1",
+		Status:  "created",
+		Pid:     1,
+		Bundle:  "/bundle",
+	}
+	funcHookRun := false
+	hooks := configs.HookList{
+		configs.NewCommandHook(configs.Command{
+			Path: "/bin/sh",
+			Args: []string{"/bin/sh", "-c", "sleep 10 & wait"},
+		}),
+		configs.NewFunctionHook(func(*specs.State) error {
+			funcHookRun = true
+			return nil
+		}),
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err := hooks.RunHooksContext(ctx, state)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected the hook to be canceled, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Expected the hook to be killed once canceled, but it took %s", elapsed)
+	}
+	if funcHookRun {
+		t.Error("Expected the remaining hooks not to be run")
+	}
+}
+
+func TestRunHooksWithResults(t *testing.T) {
+	state := &specs.State{
+		Version: "1",
+		ID:      "1",
+		Status:  "created",
+		Pid:     1,
+		Bundle:  "/bundle",
+	}
+	funcHookRun := false
+	hooks := configs.HookList{
+		configs.NewCommandHook(configs.Command{
+			Path: "/bin/sh",
+			Args: []string{"/bin/sh", "-c", fmt.Sprintf("head -c %d /dev/zero | tr '\\0' x; echo err >&2", configs.HookOutputLimit+100)},
+		}),
+		configs.NewFunctionHook(func(*specs.State) error {
+			funcHookRun = true
+			return nil
+		}),
+		configs.NewCommandHook(configs.Command{
+			Path: "/bin/sh",
+			Args: []string{"/bin/sh", "-c", "echo failed; exit 3"},
+		}),
+		configs.NewCommandHook(configs.Command{
+			Path: "/bin/true",
+			Args: []string{"/bin/true"},
+		}),
+	}
+
+	results, err := hooks.RunHooksWithResults(context.Background(), configs.Poststart, state)
+	if err == nil {
+		t.Fatal("Expected error to occur but it was nil")
+	}
+	if !funcHookRun {
+		t.Error("Expected the function hook to be run")
+	}
+	if len(results) != 2 {
+		t.Fatalf("Expected 2 results, got %+v", results)
+	}
+	if r := results[0]; r.Name != configs.Poststart || r.ExitCode != 0 || r.Error != "" || r.Stderr != "err\n" {
+		t.Errorf("Unexpected result of the first hook: %+v", r)
+	}
+	if l := len(results[0].Stdout); l != configs.HookOutputLimit {
+		t.Errorf("Expected the output to be truncated to %d bytes, got %d", configs.HookOutputLimit, l)
+	}
+	if r := results[1]; r.ExitCode != 3 || r.Stdout != "failed\n" || r.Error == "" {
+		t.Errorf("Unexpected result of the failed hook: %+v", r)
+	}
+}
+
+func TestMarshalUnmarshalNonStandardHooks(t *testing.T) {
+	hookCmd := configs.NewCommandHook(configs.Command{
+		Path: "/var/vcap/hooks/hook",
+		Args: []string{"--pid=123"},
+	})
+
+	hook := configs.Hooks{
+		configs.PostCheckpoint: configs.HookList{hookCmd},
+		configs.PreRestore:     configs.HookList{hookCmd},
+	}
+	hooks, err := hook.MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	umMhook := configs.Hooks{}
+	if err := umMhook.UnmarshalJSON(hooks); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(umMhook, hook) {
+		t.Errorf("Expected hooks %+v to equal %+v", umMhook, hook)
+	}
+}
@@ -0,0 +1,24 @@
+package configs
+
+import (
+	"os"
+	"os/exec"
+
+	"golang.org/x/sys/unix"
+)
+
+// setProcessGroup makes cmd run in a new process group.
+func setProcessGroup(cmd *exec.Cmd) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &unix.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Setpgid = true
+}
+
+// killProcessGroup kills the process group led by p, which must have been
+// started with setProcessGroup.
+func killProcessGroup(p *os.Process) {
+	if err := unix.Kill(-p.Pid, unix.SIGKILL); err != nil {
+		_ = p.Kill()
+	}
+}
@@ -0,0 +1,15 @@
+// +build !linux
+
+package configs
+
+import (
+	"os"
+	"os/exec"
+)
+
+func setProcessGroup(cmd *exec.Cmd) {
+}
+
+func killProcessGroup(p *os.Process) {
+	_ = p.Kill()
+}
@@ -3,11 +3,33 @@ package configs
 type IntelRdt struct {
 	// The schema for L3 cache id and capacity bitmask (CBM)
 	// Format: "L3:<cache_id0>=<cbm0>;<cache_id1>=<cbm1>;..."
+	// If CDP is enabled, it has separate "L3CODE:" and "L3DATA:" lines.
 	L3CacheSchema string `json:"l3_cache_schema,omitempty"`
 
+	// The schema for L2 cache id and capacity bitmask (CBM)
+	// Format: "L2:<cache_id0>=<cbm0>;<cache_id1>=<cbm1>;..."
+	// If L2 CDP is enabled, it has separate "L2CODE:" and "L2DATA:" lines.
+	L2CacheSchema string `json:"l2_cache_schema,omitempty"`
+
 	// The schema of memory bandwidth per L3 cache id
 	// Format: "MB:<cache_id0>=bandwidth0;<cache_id1>=bandwidth1;..."
 	// The unit of memory bandwidth is specified in "percentages" by
 	// default, and in "MBps" if MBA Software Controller is enabled.
 	MemBwSchema string `json:"memBwSchema,omitempty"`
+
+	// EnableCMT enables the Cache Monitoring Technology (llc_occupancy)
+	// statistics. If no schema is set, the container is placed in a
+	// monitoring group of the root (default) group.
+	EnableCMT bool `json:"enable_cmt,omitempty"`
+
+	// EnableMBM enables the Memory Bandwidth Monitoring (mbm_total_bytes
+	// and mbm_local_bytes) statistics. If no schema is set, the container
+	// is placed in a monitoring group of the root (default) group.
+	EnableMBM bool `json:"enable_mbm,omitempty"`
+}
+
+// IsMonitoringOnly reports whether only the monitoring features are used,
+// i.e. no cache or memory bandwidth allocation is done.
+func (i *IntelRdt) IsMonitoringOnly() bool {
+	return i.L3CacheSchema == "" && i.L2CacheSchema == "" && i.MemBwSchema == "" && (i.EnableCMT || i.EnableMBM)
 }
@@ -0,0 +1,26 @@
+package configs
+
+import (
+	"fmt"
+
+	"github.com/opencontainers/runc/libcontainer/system"
+)
+
+var ioprioClasses = map[string]int{
+	"IOPRIO_CLASS_RT":   system.IOPRIO_CLASS_RT,
+	"IOPRIO_CLASS_BE":   system.IOPRIO_CLASS_BE,
+	"IOPRIO_CLASS_IDLE": system.IOPRIO_CLASS_IDLE,
+}
+
+// Ioprio validates the I/O priority, and converts it to the value used by
+// ioprio_set(2).
+func (p *IOPriority) Ioprio() (int, error) {
+	class, ok := ioprioClasses[p.Class]
+	if !ok {
+		return 0, fmt.Errorf("invalid I/O priority class %q", p.Class)
+	}
+	if p.Priority < 0 || p.Priority > 7 {
+		return 0, fmt.Errorf("invalid I/O priority %d: must be between 0 and 7", p.Priority)
+	}
+	return system.IoprioValue(class, p.Priority), nil
+}
@@ -0,0 +1,108 @@
+package configs
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/opencontainers/runc/libcontainer/system"
+)
+
+var mempolicyModes = map[string]int{
+	"MPOL_DEFAULT":             system.MPOL_DEFAULT,
+	"MPOL_PREFERRED":           system.MPOL_PREFERRED,
+	"MPOL_BIND":                system.MPOL_BIND,
+	"MPOL_INTERLEAVE":          system.MPOL_INTERLEAVE,
+	"MPOL_LOCAL":               system.MPOL_LOCAL,
+	"MPOL_PREFERRED_MANY":      system.MPOL_PREFERRED_MANY,
+	"MPOL_WEIGHTED_INTERLEAVE": system.MPOL_WEIGHTED_INTERLEAVE,
+}
+
+var mempolicyFlags = map[string]int{
+	"MPOL_F_STATIC_NODES":   system.MPOL_F_STATIC_NODES,
+	"MPOL_F_RELATIVE_NODES": system.MPOL_F_RELATIVE_NODES,
+	"MPOL_F_NUMA_BALANCING": system.MPOL_F_NUMA_BALANCING,
+}
+
+// maxNumaNodes is the maximum number of memory nodes of the kernel
+// (MAX_NUMNODES with the largest CONFIG_NODES_SHIFT).
+const maxNumaNodes = 1024
+
+// ToMempolicy validates the memory policy, and converts it to the mode (with
+// the flags) and the node mask of set_mempolicy(2).
+func (p *MemoryPolicy) ToMempolicy() (int, []uint64, error) {
+	mode, ok := mempolicyModes[p.Mode]
+	if !ok {
+		return 0, nil, fmt.Errorf("invalid memory policy mode %q", p.Mode)
+	}
+	var flags int
+	for _, f := range p.Flags {
+		flag, ok := mempolicyFlags[f]
+		if !ok {
+			return 0, nil, fmt.Errorf("invalid memory policy flag %q", f)
+		}
+		flags |= flag
+	}
+	nodes, err := parseNodeMask(p.Nodes)
+	if err != nil {
+		return 0, nil, fmt.Errorf("invalid memory policy nodes %q: %w", p.Nodes, err)
+	}
+
+	switch mode {
+	case system.MPOL_DEFAULT, system.MPOL_LOCAL:
+		if nodes != nil || flags != 0 {
+			return 0, nil, fmt.Errorf("nodes and flags can't be set for %s", p.Mode)
+		}
+	case system.MPOL_PREFERRED:
+		// No nodes means the local node, which is only allowed without
+		// the node flags.
+		if nodes == nil && flags != 0 {
+			return 0, nil, fmt.Errorf("nodes must be set for %s with flags", p.Mode)
+		}
+	default:
+		if nodes == nil {
+			return 0, nil, fmt.Errorf("nodes must be set for %s", p.Mode)
+		}
+	}
+	if flags&system.MPOL_F_STATIC_NODES != 0 && flags&system.MPOL_F_RELATIVE_NODES != 0 {
+		return 0, nil, errors.New("MPOL_F_STATIC_NODES and MPOL_F_RELATIVE_NODES are mutually exclusive")
+	}
+	if flags&system.MPOL_F_NUMA_BALANCING != 0 && mode != system.MPOL_BIND {
+		return 0, nil, fmt.Errorf("MPOL_F_NUMA_BALANCING can only be set for MPOL_BIND, not %s", p.Mode)
+	}
+
+	return mode | flags, nodes, nil
+}
+
+// parseNodeMask parses a list of memory nodes, such as "0-1,3", into a node
+// mask, or nil if the list is empty.
+func parseNodeMask(list string) ([]uint64, error) {
+	if list == "" {
+		return nil, nil
+	}
+	var mask []uint64
+	for _, s := range strings.Split(list, ",") {
+		bounds := strings.SplitN(s, "-", 2)
+		min, err := strconv.ParseUint(bounds[0], 10, 16)
+		if err != nil {
+			return nil, err
+		}
+		max := min
+		if len(bounds) == 2 {
+			if max, err = strconv.ParseUint(bounds[1], 10, 16); err != nil {
+				return nil, err
+			}
+		}
+		if min > max || max >= maxNumaNodes {
+			return nil, fmt.Errorf("invalid range %q", s)
+		}
+		for n := min; n <= max; n++ {
+			for uint64(len(mask)) <= n/64 {
+				mask = append(mask, 0)
+			}
+			mask[n/64] |= 1 << (n % 64)
+		}
+	}
+	return mask, nil
+}
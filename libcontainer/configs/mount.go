@@ -36,4 +36,32 @@ type Mount struct {
 
 	// Optional Command to be run after Source is mounted.
 	PostmountCmds []Command `json:"postmount_cmds"`
+
+	// IDMapping, if set, makes a bind mount an idmapped mount.
+	IDMapping *MountIDMapping `json:"id_mapping,omitempty"`
+
+	// RecAttr, if set, are the mount attributes to be applied to a bind
+	// mount and all its submounts.
+	RecAttr *MountRecAttr `json:"rec_attr,omitempty"`
+}
+
+// MountRecAttr is a set of mount attributes (MOUNT_ATTR_* flags) to set or
+// clear recursively using mount_setattr(2).
+type MountRecAttr struct {
+	AttrSet uint64 `json:"attr_set"`
+	AttrClr uint64 `json:"attr_clr"`
+}
+
+// MountIDMapping describes the id mapping of an idmapped mount.
+type MountIDMapping struct {
+	// UIDMappings and GIDMappings are the mappings to apply to the mount.
+	// If both are empty, the mappings of the container's user namespace
+	// are used.
+	UIDMappings []IDMap `json:"uid_mappings,omitempty"`
+	GIDMappings []IDMap `json:"gid_mappings,omitempty"`
+}
+
+// IsIDMapped reports whether the mount is an idmapped mount.
+func (m *Mount) IsIDMapped() bool {
+	return m.IDMapping != nil
 }
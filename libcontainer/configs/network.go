@@ -1,17 +1,26 @@
 package configs
 
+import (
+	"fmt"
+	"net"
+)
+
 // Network defines configuration for a container's networking stack
 //
 // The network configuration can be omitted from a container causing the
 // container to be setup with the host's networking stack
 type Network struct {
-	// Type sets the networks type, commonly veth and loopback
+	// Type sets the networks type, either loopback, veth (a veth pair, one
+	// end of which resides on the host), netdev (an existing interface of
+	// the host, moved into the container), or pasta or slirp4netns (a tap
+	// interface connected to the host by the user-mode networking helper of
+	// that name, which also works in rootless containers)
 	Type string `json:"type"`
 
 	// Name of the network interface
 	Name string `json:"name"`
 
-	// The bridge to use.
+	// The bridge to attach the host end of a veth pair to, if any.
 	Bridge string `json:"bridge"`
 
 	// MacAddress contains the MAC address to set on the network interface
@@ -40,7 +49,7 @@ type Network struct {
 	TxQueueLen int `json:"txqueuelen"`
 
 	// HostInterfaceName is a unique name of a veth pair that resides on in the host interface of the
-	// container.
+	// container. For netdev, it is the name of the host interface to move into the container.
 	HostInterfaceName string `json:"host_interface_name"`
 
 	// HairpinMode specifies if hairpin NAT should be enabled on the virtual interface
@@ -48,6 +57,40 @@ type Network struct {
 	// Note: This is unsupported on some systems.
 	// Note: This does not apply to loopback interfaces.
 	HairpinMode bool `json:"hairpin_mode"`
+
+	// BandwidthLimit sets the egress bandwidth limit (in bytes per second),
+	// enforced by an eBPF program attached to the container cgroup (cgroup
+	// v2 only). As the program applies to all the traffic of the container,
+	// the lowest non-zero limit of all the networks is used.
+	// Note: This requires the fq qdisc to be used for the egress device.
+	BandwidthLimit uint64 `json:"bandwidth_limit,omitempty"`
+
+	// PortForwards are the ports of the host forwarded to the container by
+	// the networking helper, for the pasta and slirp4netns types.
+	PortForwards []PortForward `json:"port_forwards,omitempty"`
+}
+
+// PortForward represents a port of the host forwarded to a port of the
+// container.
+type PortForward struct {
+	// Protocol is either "tcp" or "udp".
+	Protocol string `json:"protocol"`
+
+	// HostIP is the address of the host to listen on, all of them if empty.
+	HostIP string `json:"host_ip,omitempty"`
+
+	HostPort      uint16 `json:"host_port"`
+	ContainerPort uint16 `json:"container_port"`
+}
+
+// String returns the port forward in the format
+// "[HOST_IP:]HOST_PORT:CONTAINER_PORT/PROTOCOL".
+func (pf PortForward) String() string {
+	s := fmt.Sprintf("%d:%d/%s", pf.HostPort, pf.ContainerPort, pf.Protocol)
+	if pf.HostIP != "" {
+		s = net.JoinHostPort(pf.HostIP, s)
+	}
+	return s
 }
 
 // Routes can be specified to create entries in the route table as the container is started
@@ -0,0 +1,78 @@
+package configs
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/opencontainers/runc/libcontainer/system"
+)
+
+var schedPolicies = map[string]uint32{
+	"SCHED_OTHER":    system.SCHED_OTHER,
+	"SCHED_FIFO":     system.SCHED_FIFO,
+	"SCHED_RR":       system.SCHED_RR,
+	"SCHED_BATCH":    system.SCHED_BATCH,
+	"SCHED_IDLE":     system.SCHED_IDLE,
+	"SCHED_DEADLINE": system.SCHED_DEADLINE,
+}
+
+var schedFlags = map[string]uint64{
+	"SCHED_FLAG_RESET_ON_FORK":  system.SCHED_FLAG_RESET_ON_FORK,
+	"SCHED_FLAG_RECLAIM":        system.SCHED_FLAG_RECLAIM,
+	"SCHED_FLAG_DL_OVERRUN":     system.SCHED_FLAG_DL_OVERRUN,
+	"SCHED_FLAG_KEEP_POLICY":    system.SCHED_FLAG_KEEP_POLICY,
+	"SCHED_FLAG_KEEP_PARAMS":    system.SCHED_FLAG_KEEP_PARAMS,
+	"SCHED_FLAG_UTIL_CLAMP_MIN": system.SCHED_FLAG_UTIL_CLAMP_MIN,
+	"SCHED_FLAG_UTIL_CLAMP_MAX": system.SCHED_FLAG_UTIL_CLAMP_MAX,
+}
+
+// ToSchedAttr validates the scheduling attributes, and converts them to the
+// sched_attr of sched_setattr(2).
+func (s *Scheduler) ToSchedAttr() (*system.SchedAttr, error) {
+	policy, ok := schedPolicies[s.Policy]
+	if !ok {
+		return nil, fmt.Errorf("invalid scheduling policy %q", s.Policy)
+	}
+	var flags uint64
+	for _, f := range s.Flags {
+		flag, ok := schedFlags[f]
+		if !ok {
+			return nil, fmt.Errorf("invalid scheduling flag %q", f)
+		}
+		flags |= flag
+	}
+
+	if s.Nice < -20 || s.Nice > 19 {
+		return nil, fmt.Errorf("invalid nice value %d: must be between -20 and 19", s.Nice)
+	}
+	switch policy {
+	case system.SCHED_FIFO, system.SCHED_RR:
+		if s.Priority < 1 || s.Priority > 99 {
+			return nil, fmt.Errorf("invalid priority %d for %s: must be between 1 and 99", s.Priority, s.Policy)
+		}
+	default:
+		if s.Priority != 0 {
+			return nil, fmt.Errorf("priority can't be set for %s", s.Policy)
+		}
+	}
+	if policy == system.SCHED_DEADLINE {
+		if s.Runtime == 0 || s.Deadline == 0 {
+			return nil, errors.New("runtime and deadline must be set for SCHED_DEADLINE")
+		}
+		if s.Runtime > s.Deadline || (s.Period != 0 && s.Deadline > s.Period) {
+			return nil, errors.New("runtime <= deadline <= period must hold for SCHED_DEADLINE")
+		}
+	} else if s.Runtime != 0 || s.Deadline != 0 || s.Period != 0 {
+		return nil, fmt.Errorf("runtime, deadline and period can only be set for SCHED_DEADLINE, not %s", s.Policy)
+	}
+
+	return &system.SchedAttr{
+		Policy:   policy,
+		Flags:    flags,
+		Nice:     s.Nice,
+		Priority: uint32(s.Priority),
+		Runtime:  s.Runtime,
+		Deadline: s.Deadline,
+		Period:   s.Period,
+	}, nil
+}
@@ -3,6 +3,7 @@ package validate
 import (
 	"errors"
 	"fmt"
+	"net"
 	"os"
 	"path/filepath"
 	"strings"
@@ -11,6 +12,7 @@ import (
 	"github.com/opencontainers/runc/libcontainer/cgroups"
 	"github.com/opencontainers/runc/libcontainer/configs"
 	"github.com/opencontainers/runc/libcontainer/intelrdt"
+	"github.com/opencontainers/runc/libcontainer/system"
 	selinux "github.com/opencontainers/selinux/go-selinux"
 	"golang.org/x/sys/unix"
 )
@@ -26,30 +28,99 @@ func New() Validator {
 type ConfigValidator struct {
 }
 
-type check func(config *configs.Config) error
+// Finding is a problem found in a config by one of the checks of Validate.
+type Finding struct {
+	// Check is the name of the check which found the problem, e.g.
+	// "rootfs", "network", "mounts" or "cgroups".
+	Check string
+	// Err is the problem.
+	Err error
+}
 
-func (v *ConfigValidator) Validate(config *configs.Config) error {
-	checks := []check{
-		v.rootfs,
-		v.network,
-		v.hostname,
-		v.security,
-		v.usernamespace,
-		v.cgroupnamespace,
-		v.sysctl,
-		v.intelrdt,
-		v.rootlessEUID,
-		v.mounts,
-	}
-	for _, c := range checks {
-		if err := c(config); err != nil {
-			return err
+func (f *Finding) Error() string {
+	return f.Err.Error()
+}
+
+func (f *Finding) Unwrap() error {
+	return f.Err
+}
+
+// Findings are the problems found in a config by Validate. As an error, it
+// reports all of them.
+type Findings []*Finding
+
+func (f Findings) Error() string {
+	msgs := make([]string, len(f))
+	for i, finding := range f {
+		msgs[i] = finding.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Is reports whether any of the findings matches target, for errors.Is.
+func (f Findings) Is(target error) bool {
+	for _, finding := range f {
+		if errors.Is(finding, target) {
+			return true
 		}
 	}
-	if err := v.cgroups(config); err != nil {
-		return err
+	return false
+}
+
+// As finds the first of the findings that matches target, for errors.As.
+func (f Findings) As(target interface{}) bool {
+	for _, finding := range f {
+		if errors.As(finding, target) {
+			return true
+		}
+	}
+	return false
+}
+
+type check struct {
+	name string
+	run  func(config *configs.Config) error
+}
+
+func (v *ConfigValidator) checks() []check {
+	return []check{
+		{"rootfs", v.rootfs},
+		{"network", v.network},
+		{"hostname", v.hostname},
+		{"security", v.security},
+		{"usernamespace", v.usernamespace},
+		{"cgroupnamespace", v.cgroupnamespace},
+		{"timenamespace", v.timenamespace},
+		{"sysctl", v.sysctl},
+		{"intelrdt", v.intelrdt},
+		{"rootless", v.rootlessEUID},
+		{"mounts", v.mounts},
+		{"seccomp", v.seccomp},
+		{"scheduler", v.scheduler},
+		{"ioPriority", v.ioPriority},
+		{"memoryPolicy", v.memoryPolicy},
+		{"hooks", v.hooks},
+		{"cgroups", v.cgroups},
+	}
+}
+
+// Validate runs all the checks of config, and returns the problems found, if
+// any. Each check reports the first problem it finds.
+func Validate(config *configs.Config) Findings {
+	var findings Findings
+	for _, c := range (&ConfigValidator{}).checks() {
+		if err := c.run(config); err != nil {
+			findings = append(findings, &Finding{Check: c.name, Err: err})
+		}
 	}
+	return findings
+}
 
+// Validate returns the Findings of config, if there are any.
+func (v *ConfigValidator) Validate(config *configs.Config) error {
+	if findings := Validate(config); len(findings) > 0 {
+		return findings
+	}
 	return nil
 }
 
@@ -81,6 +152,149 @@ func (v *ConfigValidator) network(config *configs.Config) error {
 			return errors.New("unable to apply network settings without a private NET namespace")
 		}
 	}
+	names := make(map[string]bool)
+	helpers := 0
+	for _, n := range config.Networks {
+		if n.BandwidthLimit != 0 && !cgroups.IsCgroup2UnifiedMode() {
+			return errors.New("network bandwidth limit requires cgroup v2")
+		}
+		if err := checkNetwork(n); err != nil {
+			return fmt.Errorf("%s network %s: %w", n.Type, n.Name, err)
+		}
+		if n.Type == "loopback" {
+			continue
+		}
+		if n.Type == "pasta" || n.Type == "slirp4netns" {
+			if helpers++; helpers > 1 {
+				return errors.New("only one pasta or slirp4netns network can be used")
+			}
+			continue
+		}
+		// The interfaces are set up in the network namespace of the host.
+		if config.RootlessEUID {
+			return fmt.Errorf("%s network %s can't be used in rootless containers", n.Type, n.Name)
+		}
+		name := n.Name
+		if name == "" {
+			name = n.HostInterfaceName
+		}
+		if names[name] {
+			return fmt.Errorf("duplicate network interface %s", name)
+		}
+		names[name] = true
+	}
+	if len(config.PortForwards) > 0 {
+		if helpers > 0 {
+			return errors.New("port forwards can't be passed as sockets along with a pasta or slirp4netns network")
+		}
+		if err := checkPortForwards(config.PortForwards); err != nil {
+			return err
+		}
+		for _, pf := range config.PortForwards {
+			// The sockets are bound in the network namespace of the host.
+			if pf.ContainerPort != pf.HostPort {
+				return fmt.Errorf("port forward %s passed as a socket must use the host port in the container", pf)
+			}
+		}
+	}
+	for _, r := range config.Routes {
+		if r.Destination != "" {
+			if _, _, err := net.ParseCIDR(r.Destination); err != nil {
+				return fmt.Errorf("invalid route destination %q: %w", r.Destination, err)
+			}
+		}
+		for _, ip := range []string{r.Source, r.Gateway} {
+			if ip != "" && net.ParseIP(ip) == nil {
+				return fmt.Errorf("invalid route address %q", ip)
+			}
+		}
+		if r.Gateway == "" && r.InterfaceName == "" {
+			return fmt.Errorf("route to %q requires a gateway or an interface", r.Destination)
+		}
+	}
+	return nil
+}
+
+// checkPortForwards validates the port forwards of a networking helper, or
+// those passed as sockets.
+func checkPortForwards(forwards []configs.PortForward) error {
+	type hostPort struct {
+		protocol, ip string
+		port         uint16
+	}
+	seen := make(map[hostPort]bool)
+	for _, pf := range forwards {
+		if pf.Protocol != "tcp" && pf.Protocol != "udp" {
+			return fmt.Errorf("invalid port forward protocol %q", pf.Protocol)
+		}
+		if pf.HostPort == 0 || pf.ContainerPort == 0 {
+			return errors.New("port forwards require a host and a container port")
+		}
+		if pf.HostIP != "" && net.ParseIP(pf.HostIP) == nil {
+			return fmt.Errorf("invalid port forward host address %q", pf.HostIP)
+		}
+		hp := hostPort{pf.Protocol, pf.HostIP, pf.HostPort}
+		if seen[hp] {
+			return fmt.Errorf("duplicate port forward %s", pf)
+		}
+		seen[hp] = true
+	}
+	return nil
+}
+
+// checkNetwork validates the interface names and the addresses of a network.
+func checkNetwork(n *configs.Network) error {
+	switch n.Type {
+	case "loopback":
+		return nil
+	case "veth":
+		if n.Name == "" || n.HostInterfaceName == "" {
+			return errors.New("name and host interface name are required")
+		}
+	case "netdev":
+		if n.HostInterfaceName == "" {
+			return errors.New("host interface name is required")
+		}
+	case "pasta", "slirp4netns":
+		// The networking helpers configure the interface on their own.
+		if n.HostInterfaceName != "" || n.Bridge != "" || n.MacAddress != "" ||
+			n.Address != "" || n.IPv6Address != "" || n.Gateway != "" || n.IPv6Gateway != "" {
+			return errors.New("only the name and the mtu can be set")
+		}
+		if len(n.Name) > 15 || strings.ContainsAny(n.Name, "/ :") {
+			return fmt.Errorf("invalid interface name %q", n.Name)
+		}
+		return checkPortForwards(n.PortForwards)
+	default:
+		return fmt.Errorf("unknown network type %q", n.Type)
+	}
+	if len(n.PortForwards) > 0 {
+		return errors.New("port forwards require a pasta or slirp4netns network")
+	}
+	for _, name := range []string{n.Name, n.HostInterfaceName} {
+		// IFNAMSIZ, including the terminating null byte.
+		if len(name) > 15 || strings.ContainsAny(name, "/ :") {
+			return fmt.Errorf("invalid interface name %q", name)
+		}
+	}
+	for _, a := range []string{n.Address, n.IPv6Address} {
+		if a == "" {
+			continue
+		}
+		if _, _, err := net.ParseCIDR(a); err != nil {
+			return fmt.Errorf("invalid address %q: %w", a, err)
+		}
+	}
+	for _, g := range []string{n.Gateway, n.IPv6Gateway} {
+		if g != "" && net.ParseIP(g) == nil {
+			return fmt.Errorf("invalid gateway %q", g)
+		}
+	}
+	if n.MacAddress != "" {
+		if _, err := net.ParseMAC(n.MacAddress); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
@@ -126,6 +340,30 @@ func (v *ConfigValidator) cgroupnamespace(config *configs.Config) error {
 	return nil
 }
 
+// timenamespace validates the time namespace and its clock offsets.
+func (v *ConfigValidator) timenamespace(config *configs.Config) error {
+	if config.Namespaces.Contains(configs.NEWTIME) {
+		if _, err := os.Stat("/proc/self/timens_offsets"); os.IsNotExist(err) {
+			return errors.New("time namespaces aren't enabled in the kernel")
+		}
+	}
+	if len(config.TimeOffsets) == 0 {
+		return nil
+	}
+	if !config.Namespaces.Contains(configs.NEWTIME) || config.Namespaces.PathOf(configs.NEWTIME) != "" {
+		return errors.New("time offsets can only be set with a new time namespace")
+	}
+	for clock, offset := range config.TimeOffsets {
+		if clock != "monotonic" && clock != "boottime" {
+			return fmt.Errorf("invalid time offset clock %q", clock)
+		}
+		if offset.Nanosecs >= 1e9 {
+			return fmt.Errorf("invalid time offset for %s: nanosecs must be less than 1e9", clock)
+		}
+	}
+	return nil
+}
+
 // sysctl validates that the specified sysctl keys are valid or not.
 // /proc/sys isn't completely namespaced and depending on which namespaces
 // are specified, a subset of sysctls are permitted.
@@ -196,18 +434,37 @@ func (v *ConfigValidator) sysctl(config *configs.Config) error {
 
 func (v *ConfigValidator) intelrdt(config *configs.Config) error {
 	if config.IntelRdt != nil {
-		if !intelrdt.IsCATEnabled() && !intelrdt.IsMBAEnabled() {
+		if config.IntelRdt.EnableCMT && !intelrdt.IsCMTEnabled() {
+			return errors.New("intelRdt.enableCMT is specified in config, but Intel RDT/CMT is not enabled")
+		}
+		if config.IntelRdt.EnableMBM && !intelrdt.IsMBMEnabled() {
+			return errors.New("intelRdt.enableMBM is specified in config, but Intel RDT/MBM is not enabled")
+		}
+		if config.IntelRdt.IsMonitoringOnly() {
+			return nil
+		}
+
+		if !intelrdt.IsCATEnabled() && !intelrdt.IsL2CATEnabled() && !intelrdt.IsMBAEnabled() {
 			return errors.New("intelRdt is specified in config, but Intel RDT is not supported or enabled")
 		}
 
 		if !intelrdt.IsCATEnabled() && config.IntelRdt.L3CacheSchema != "" {
 			return errors.New("intelRdt.l3CacheSchema is specified in config, but Intel RDT/CAT is not enabled")
 		}
+		if !intelrdt.IsL2CATEnabled() && config.IntelRdt.L2CacheSchema != "" {
+			return errors.New("intelRdt.l2CacheSchema is specified in config, but Intel RDT/L2 CAT is not enabled")
+		}
+		if !intelrdt.IsCDPEnabled() && strings.Contains(config.IntelRdt.L3CacheSchema, "L3CODE:") {
+			return errors.New("intelRdt.l3CacheSchema has code and data schemas, but Intel RDT/CDP is not enabled")
+		}
+		if !intelrdt.IsL2CDPEnabled() && strings.Contains(config.IntelRdt.L2CacheSchema, "L2CODE:") {
+			return errors.New("intelRdt.l2CacheSchema has code and data schemas, but Intel RDT/L2 CDP is not enabled")
+		}
 		if !intelrdt.IsMBAEnabled() && config.IntelRdt.MemBwSchema != "" {
 			return errors.New("intelRdt.memBwSchema is specified in config, but Intel RDT/MBA is not enabled")
 		}
 
-		if intelrdt.IsCATEnabled() && config.IntelRdt.L3CacheSchema == "" {
+		if intelrdt.IsCATEnabled() && config.IntelRdt.L3CacheSchema == "" && config.IntelRdt.L2CacheSchema == "" {
 			return errors.New("Intel RDT/CAT is enabled and intelRdt is specified in config, but intelRdt.l3CacheSchema is empty")
 		}
 		if intelrdt.IsMBAEnabled() && config.IntelRdt.MemBwSchema == "" {
@@ -228,6 +485,12 @@ func (v *ConfigValidator) cgroups(config *configs.Config) error {
 		return fmt.Errorf("cgroup: either Path or Name and Parent should be used, got %+v", c)
 	}
 
+	// The devices controller of cgroup v1 can't report denied accesses,
+	// which are audited in the unified hierarchy instead.
+	if c.AuditDevices && !cgroups.IsCgroup2UnifiedMode() && !cgroups.IsCgroup2HybridMode() {
+		return fmt.Errorf("cgroup: auditing device accesses requires cgroup v2, or the unified hierarchy mounted on %s", cgroups.HybridMountpoint)
+	}
+
 	r := c.Resources
 	if r == nil {
 		return nil
@@ -238,12 +501,94 @@ func (v *ConfigValidator) cgroups(config *configs.Config) error {
 	}
 
 	if cgroups.IsCgroup2UnifiedMode() {
-		_, err := cgroups.ConvertMemorySwapToCgroupV2Value(r.MemorySwap, r.Memory)
+		swap, err := cgroups.ConvertMemorySwapToCgroupV2Value(r.MemorySwap, r.Memory)
 		if err != nil {
 			return err
 		}
+		if err := checkMemoryV2Limits(r, swap); err != nil {
+			return err
+		}
+	} else if r.MemorySwapHigh != 0 || r.MemoryZswapMax != nil || r.MemoryZswapWriteback != nil {
+		return errors.New("invalid configuration: swap high and zswap limits are only supported on cgroup v2")
+	} else if r.MemoryOOMGroup != nil {
+		return errors.New("invalid configuration: memory OOM group is only supported on cgroup v2")
+	} else if r.CPUIdle != nil {
+		return errors.New("invalid configuration: cpu idle is only supported on cgroup v2")
+	} else if r.CpusetPartition != "" {
+		return errors.New("invalid configuration: cpuset partitions are only supported on cgroup v2")
+	} else if r.MemoryMin != 0 || r.MemoryLow != 0 {
+		return errors.New("invalid configuration: memory min and low protections are only supported on cgroup v2")
+	} else if len(r.Misc) > 0 {
+		return errors.New("invalid configuration: misc controller is only supported on cgroup v2")
+	} else if r.AllowedAddressFamilies != nil {
+		return errors.New("invalid configuration: allowed address families are only supported on cgroup v2")
+	}
+
+	if r.CPUIdle != nil && *r.CPUIdle != 0 && *r.CPUIdle != 1 {
+		return fmt.Errorf("invalid cpu idle value %d: must be 0 or 1", *r.CPUIdle)
+	}
+
+	switch r.CpusetPartition {
+	case "", "member":
+	case "root", "isolated":
+		if r.CpusetCpus == "" {
+			return fmt.Errorf("invalid configuration: cpuset partition %q requires cpuset cpus to be set", r.CpusetPartition)
+		}
+	default:
+		return fmt.Errorf("invalid cpuset partition %q", r.CpusetPartition)
+	}
+
+	for _, family := range r.AllowedAddressFamilies {
+		if family <= 0 || family >= unix.AF_MAX {
+			return fmt.Errorf("invalid address family %d", family)
+		}
 	}
 
+	for name, limit := range r.Misc {
+		if name == "" || strings.ContainsAny(name, " \t\n/") {
+			return fmt.Errorf("invalid misc resource name %q", name)
+		}
+		if limit < -1 {
+			return fmt.Errorf("invalid misc resource %q limit %d", name, limit)
+		}
+	}
+
+	if r.ManagedOOMMemoryPressure != "" || r.ManagedOOMMemoryPressureLimit != nil {
+		// systemd-oomd is configured with the properties of the unit of the
+		// container, and only monitors cgroup v2.
+		if !c.Systemd || !cgroups.IsCgroup2UnifiedMode() {
+			return errors.New("invalid configuration: systemd-oomd settings require the systemd cgroup driver on cgroup v2")
+		}
+		switch r.ManagedOOMMemoryPressure {
+		case "", "auto", "kill":
+		default:
+			return fmt.Errorf("invalid managed OOM memory pressure %q: must be auto or kill", r.ManagedOOMMemoryPressure)
+		}
+		if l := r.ManagedOOMMemoryPressureLimit; l != nil && *l > 10000 {
+			return fmt.Errorf("invalid managed OOM memory pressure limit %d: must be at most 10000 (100%%)", *l)
+		}
+	}
+
+	return nil
+}
+
+// checkMemoryV2Limits validates the cgroup v2 only memory limits of r. The
+// swap-only limits are checked against swap, the swap-only equivalent of
+// r.MemorySwap (which accounts for memory + swap).
+func checkMemoryV2Limits(r *configs.Resources, swap int64) error {
+	if r.MemoryMin < -1 || r.MemoryLow < -1 {
+		return fmt.Errorf("invalid memory protection (min %d, low %d)", r.MemoryMin, r.MemoryLow)
+	}
+	if r.MemorySwapHigh < -1 {
+		return fmt.Errorf("invalid memory swap high %d", r.MemorySwapHigh)
+	}
+	if r.MemoryZswapMax != nil && *r.MemoryZswapMax < -1 {
+		return fmt.Errorf("invalid memory zswap max %d", *r.MemoryZswapMax)
+	}
+	if swap > 0 && r.MemorySwapHigh > swap {
+		return fmt.Errorf("invalid memory swap high %d: greater than the swap limit %d (memory swap %d minus memory %d)",
+			r.MemorySwapHigh, swap, r.MemorySwap, r.Memory)
+	}
 	return nil
 }
 
@@ -252,8 +597,116 @@ func (v *ConfigValidator) mounts(config *configs.Config) error {
 		if !filepath.IsAbs(m.Destination) {
 			return fmt.Errorf("invalid mount %+v: mount destination not absolute", m)
 		}
+		if m.IsIDMapped() {
+			if m.Device != "bind" {
+				return fmt.Errorf("invalid mount %+v: idmapping is only supported for bind mounts", m)
+			}
+			if err := checkIDMapping(config, m.IDMapping); err != nil {
+				return fmt.Errorf("invalid mount %+v: %w", m, err)
+			}
+		}
+		if m.RecAttr != nil {
+			if m.Device != "bind" {
+				return fmt.Errorf("invalid mount %+v: recursive mount attributes are only supported for bind mounts", m)
+			}
+			if !system.IsMountSetattrSupported() {
+				return fmt.Errorf("invalid mount %+v: recursive mount attributes require mount_setattr(2) (Linux 5.12+)", m)
+			}
+		}
 	}
+	if config.RootfsIDMapping != nil {
+		if err := checkIDMapping(config, config.RootfsIDMapping); err != nil {
+			return fmt.Errorf("invalid rootfs idmapping: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func (v *ConfigValidator) seccomp(config *configs.Config) error {
+	s := config.Seccomp
+	if !s.IsNotifyUsed() {
+		return nil
+	}
+	// With the default action set to Notify, even the syscalls required
+	// to pass the notify fd to the agent would block forever.
+	if s.DefaultAction == configs.Notify {
+		return errors.New("seccomp: SCMP_ACT_NOTIFY cannot be used as the default action")
+	}
+	for _, call := range s.Syscalls {
+		if call != nil && call.Action == configs.Notify && call.Name == "write" {
+			return errors.New("seccomp: SCMP_ACT_NOTIFY cannot be used for the write syscall")
+		}
+	}
+	if s.ListenerPath == "" {
+		return errors.New("seccomp: listenerPath is required when SCMP_ACT_NOTIFY is used")
+	}
+	return nil
+}
+
+// scheduler validates the scheduling attributes of the init process.
+func (v *ConfigValidator) scheduler(config *configs.Config) error {
+	if config.Scheduler == nil {
+		return nil
+	}
+	if _, err := config.Scheduler.ToSchedAttr(); err != nil {
+		return fmt.Errorf("scheduler: %w", err)
+	}
+	return nil
+}
+
+// ioPriority validates the I/O priority of the container's processes.
+func (v *ConfigValidator) ioPriority(config *configs.Config) error {
+	if config.IOPriority == nil {
+		return nil
+	}
+	if _, err := config.IOPriority.Ioprio(); err != nil {
+		return fmt.Errorf("ioPriority: %w", err)
+	}
+	return nil
+}
+
+// memoryPolicy validates the memory policy of the init process.
+func (v *ConfigValidator) memoryPolicy(config *configs.Config) error {
+	if config.MemoryPolicy == nil {
+		return nil
+	}
+	if _, _, err := config.MemoryPolicy.ToMempolicy(); err != nil {
+		return fmt.Errorf("memoryPolicy: %w", err)
+	}
+	return nil
+}
+
+// hooks validates the timeouts of the hooks, which must be positive.
+func (v *ConfigValidator) hooks(config *configs.Config) error {
+	for name, hooks := range config.Hooks {
+		for _, h := range hooks {
+			cmd, ok := h.(configs.CommandHook)
+			if !ok || cmd.Timeout == nil {
+				continue
+			}
+			if *cmd.Timeout <= 0 {
+				return fmt.Errorf("hooks: %s hook %s: timeout must be greater than zero", name, cmd.Path)
+			}
+		}
+	}
+	return nil
+}
 
+// checkIDMapping validates the id mapping of an idmapped mount.
+func checkIDMapping(config *configs.Config, m *configs.MountIDMapping) error {
+	if !config.Namespaces.Contains(configs.NEWUSER) {
+		return errors.New("idmapped mounts require a user namespace")
+	}
+	if config.RootlessEUID {
+		return errors.New("idmapped mounts are not supported for rootless containers")
+	}
+	if (len(m.UIDMappings) == 0) != (len(m.GIDMappings) == 0) {
+		return errors.New("both uid and gid mappings must be either set or empty")
+	}
+	if !system.IsIDMappedMountSupported() {
+		return errors.New("idmapped mounts are not supported by the kernel")
+	}
 	return nil
 }
 
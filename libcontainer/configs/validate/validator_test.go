@@ -1,11 +1,16 @@
 package validate_test
 
 import (
+	"errors"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/opencontainers/runc/libcontainer/cgroups"
 	"github.com/opencontainers/runc/libcontainer/configs"
 	"github.com/opencontainers/runc/libcontainer/configs/validate"
 	"golang.org/x/sys/unix"
@@ -257,6 +262,127 @@ func TestValidateSysctlWithSameNs(t *testing.T) {
 	}
 }
 
+func TestValidateNetworks(t *testing.T) {
+	testCases := []struct {
+		name     string
+		networks []*configs.Network
+		routes   []*configs.Route
+		ports    []configs.PortForward
+		isErr    bool
+	}{
+		{
+			name: "veth and netdev",
+			networks: []*configs.Network{
+				{Type: "loopback"},
+				{Type: "veth", Name: "eth0", HostInterfaceName: "veth1234", Address: "10.0.0.2/24", Gateway: "10.0.0.1"},
+				{Type: "netdev", HostInterfaceName: "eth1", IPv6Address: "fd00::2/64"},
+			},
+			routes: []*configs.Route{
+				{Destination: "10.1.0.0/16", Gateway: "10.0.0.254"},
+				{Destination: "10.2.0.0/16", InterfaceName: "eth0"},
+			},
+		},
+		{name: "unknown type", networks: []*configs.Network{{Type: "bridge", Name: "eth0"}}, isErr: true},
+		{name: "veth without host name", networks: []*configs.Network{{Type: "veth", Name: "eth0"}}, isErr: true},
+		{name: "netdev without host name", networks: []*configs.Network{{Type: "netdev", Name: "eth0"}}, isErr: true},
+		{
+			name:     "long name",
+			networks: []*configs.Network{{Type: "veth", Name: "eth0", HostInterfaceName: "averylonginterfacename"}},
+			isErr:    true,
+		},
+		{
+			name:     "invalid address",
+			networks: []*configs.Network{{Type: "veth", Name: "eth0", HostInterfaceName: "veth0", Address: "10.0.0.2"}},
+			isErr:    true,
+		},
+		{
+			name:     "invalid gateway",
+			networks: []*configs.Network{{Type: "netdev", HostInterfaceName: "eth1", Gateway: "10.0.0"}},
+			isErr:    true,
+		},
+		{
+			name: "duplicate name",
+			networks: []*configs.Network{
+				{Type: "netdev", HostInterfaceName: "eth0"},
+				{Type: "veth", Name: "eth0", HostInterfaceName: "veth0"},
+			},
+			isErr: true,
+		},
+		{
+			name: "slirp4netns",
+			networks: []*configs.Network{
+				{Type: "slirp4netns", PortForwards: []configs.PortForward{{Protocol: "tcp", HostPort: 8080, ContainerPort: 80}}},
+			},
+		},
+		{name: "pasta with address", networks: []*configs.Network{{Type: "pasta", Address: "10.0.0.2/24"}}, isErr: true},
+		{
+			name:     "pasta and slirp4netns",
+			networks: []*configs.Network{{Type: "pasta"}, {Type: "slirp4netns"}},
+			isErr:    true,
+		},
+		{
+			name: "invalid port forward",
+			networks: []*configs.Network{
+				{Type: "pasta", PortForwards: []configs.PortForward{{Protocol: "sctp", HostPort: 8080, ContainerPort: 80}}},
+			},
+			isErr: true,
+		},
+		{
+			name: "port forward without helper",
+			networks: []*configs.Network{
+				{Type: "veth", Name: "eth0", HostInterfaceName: "veth0", PortForwards: []configs.PortForward{{Protocol: "tcp", HostPort: 8080, ContainerPort: 80}}},
+			},
+			isErr: true,
+		},
+		{
+			name: "duplicate port forward",
+			networks: []*configs.Network{
+				{Type: "slirp4netns", PortForwards: []configs.PortForward{
+					{Protocol: "tcp", HostPort: 8080, ContainerPort: 80},
+					{Protocol: "tcp", HostPort: 8080, ContainerPort: 8080},
+				}},
+			},
+			isErr: true,
+		},
+		{name: "port forward socket", ports: []configs.PortForward{{Protocol: "udp", HostIP: "::1", HostPort: 53, ContainerPort: 53}}},
+		{
+			name:  "port forward socket with another container port",
+			ports: []configs.PortForward{{Protocol: "tcp", HostPort: 8080, ContainerPort: 80}},
+			isErr: true,
+		},
+		{
+			name:     "port forward socket with helper",
+			networks: []*configs.Network{{Type: "pasta"}},
+			ports:    []configs.PortForward{{Protocol: "tcp", HostPort: 8080, ContainerPort: 8080}},
+			isErr:    true,
+		},
+		{name: "invalid route destination", routes: []*configs.Route{{Destination: "10.1.0.0", Gateway: "10.0.0.1"}}, isErr: true},
+		{name: "route without gateway or interface", routes: []*configs.Route{{Destination: "10.1.0.0/16"}}, isErr: true},
+	}
+
+	validator := validate.New()
+	for _, tc := range testCases {
+		config := &configs.Config{
+			Rootfs: "/var",
+			Namespaces: configs.Namespaces(
+				[]configs.Namespace{
+					{Type: configs.NEWNET},
+				},
+			),
+			Networks:     tc.networks,
+			Routes:       tc.routes,
+			PortForwards: tc.ports,
+		}
+		err := validator.Validate(config)
+		if tc.isErr && err == nil {
+			t.Errorf("%s: expected error, got nil", tc.name)
+		}
+		if !tc.isErr && err != nil {
+			t.Errorf("%s: expected nil, got error %v", tc.name, err)
+		}
+	}
+}
+
 func TestValidateSysctlWithBindHostNetNS(t *testing.T) {
 	if os.Getuid() != 0 {
 		t.Skip("requires root")
@@ -350,3 +476,476 @@ func TestValidateMounts(t *testing.T) {
 		}
 	}
 }
+
+func TestValidateIDMappedMounts(t *testing.T) {
+	testCases := []struct {
+		device string
+		userns bool
+		idmap  configs.MountIDMapping
+	}{
+		// Not a bind mount.
+		{device: "tmpfs", userns: true},
+		// No user namespace.
+		{device: "bind", userns: false},
+		// Only uid mappings.
+		{
+			device: "bind",
+			userns: true,
+			idmap: configs.MountIDMapping{
+				UIDMappings: []configs.IDMap{{ContainerID: 0, HostID: 1000, Size: 1}},
+			},
+		},
+	}
+
+	validator := validate.New()
+
+	for _, tc := range testCases {
+		config := &configs.Config{
+			Rootfs: "/var",
+			Mounts: []*configs.Mount{
+				{
+					Device:      tc.device,
+					Source:      "/src",
+					Destination: "/dest",
+					IDMapping:   &tc.idmap,
+				},
+			},
+		}
+		if tc.userns {
+			config.Namespaces = configs.Namespaces{{Type: configs.NEWUSER}}
+			config.UidMappings = []configs.IDMap{{ContainerID: 0, HostID: 1000, Size: 1}}
+			config.GidMappings = []configs.IDMap{{ContainerID: 0, HostID: 1000, Size: 1}}
+		}
+
+		if err := validator.Validate(config); err == nil {
+			t.Errorf("mount %+v: expected error, got nil", tc)
+		}
+	}
+}
+
+func TestValidateSeccompNotify(t *testing.T) {
+	testCases := []struct {
+		seccomp configs.Seccomp
+		isErr   bool
+	}{
+		{
+			seccomp: configs.Seccomp{
+				DefaultAction: configs.Allow,
+				Syscalls:      []*configs.Syscall{{Name: "mount", Action: configs.Notify}},
+				ListenerPath:  "/run/seccomp-agent.sock",
+			},
+		},
+		// No listener path.
+		{
+			seccomp: configs.Seccomp{
+				DefaultAction: configs.Allow,
+				Syscalls:      []*configs.Syscall{{Name: "mount", Action: configs.Notify}},
+			},
+			isErr: true,
+		},
+		// Notify as the default action.
+		{
+			seccomp: configs.Seccomp{
+				DefaultAction: configs.Notify,
+				ListenerPath:  "/run/seccomp-agent.sock",
+			},
+			isErr: true,
+		},
+		// Notify for write(2).
+		{
+			seccomp: configs.Seccomp{
+				DefaultAction: configs.Allow,
+				Syscalls:      []*configs.Syscall{{Name: "write", Action: configs.Notify}},
+				ListenerPath:  "/run/seccomp-agent.sock",
+			},
+			isErr: true,
+		},
+	}
+
+	validator := validate.New()
+
+	for _, tc := range testCases {
+		config := &configs.Config{
+			Rootfs:  "/var",
+			Seccomp: &tc.seccomp,
+		}
+
+		err := validator.Validate(config)
+		if tc.isErr && err == nil {
+			t.Errorf("seccomp %+v: expected error, got nil", tc.seccomp)
+		}
+		if !tc.isErr && err != nil {
+			t.Errorf("seccomp %+v: expected nil, got error %v", tc.seccomp, err)
+		}
+	}
+}
+
+func TestValidateAuditDevices(t *testing.T) {
+	config := &configs.Config{
+		Rootfs: "/var",
+		Cgroups: &configs.Cgroup{
+			AuditDevices: true,
+			Resources:    &configs.Resources{},
+		},
+	}
+
+	validator := validate.New()
+	err := validator.Validate(config)
+	supported := cgroups.IsCgroup2UnifiedMode() || cgroups.IsCgroup2HybridMode()
+	if supported && err != nil {
+		t.Errorf("expected nil, got error %v", err)
+	}
+	if !supported && err == nil {
+		t.Error("expected error on cgroup v1 without the unified hierarchy, got nil")
+	}
+}
+
+func TestValidateManagedOOM(t *testing.T) {
+	limit := uint32(6000)
+	config := &configs.Config{
+		Rootfs: "/var",
+		Cgroups: &configs.Cgroup{
+			Systemd: true,
+			Resources: &configs.Resources{
+				ManagedOOMMemoryPressure:      "kill",
+				ManagedOOMMemoryPressureLimit: &limit,
+			},
+		},
+	}
+
+	validator := validate.New()
+	err := validator.Validate(config)
+	if cgroups.IsCgroup2UnifiedMode() && err != nil {
+		t.Errorf("expected nil, got error %v", err)
+	}
+	if !cgroups.IsCgroup2UnifiedMode() && err == nil {
+		t.Error("expected error on cgroup v1, got nil")
+	}
+
+	for _, r := range []configs.Resources{
+		{ManagedOOMMemoryPressure: "stop"},
+		{ManagedOOMMemoryPressureLimit: func() *uint32 { l := uint32(10001); return &l }()},
+	} {
+		r := r
+		config.Cgroups.Resources = &r
+		if err := validator.Validate(config); err == nil {
+			t.Errorf("expected error for %+v, got nil", r)
+		}
+	}
+
+	// systemd-oomd is configured with the systemd cgroup driver only.
+	config.Cgroups.Systemd = false
+	config.Cgroups.Resources = &configs.Resources{ManagedOOMMemoryPressure: "kill"}
+	if err := validator.Validate(config); err == nil {
+		t.Error("expected error with the cgroupfs driver, got nil")
+	}
+}
+
+func TestValidateAllowedAddressFamilies(t *testing.T) {
+	testCases := []struct {
+		families []int
+		isErr    bool
+	}{
+		{families: []int{unix.AF_INET, unix.AF_INET6, unix.AF_UNIX}},
+		{families: []int{}},
+		{families: []int{-1}, isErr: true},
+		{families: []int{unix.AF_INET, unix.AF_MAX}, isErr: true},
+	}
+
+	validator := validate.New()
+
+	for _, tc := range testCases {
+		config := &configs.Config{
+			Rootfs: "/var",
+			Cgroups: &configs.Cgroup{
+				Resources: &configs.Resources{
+					AllowedAddressFamilies: tc.families,
+				},
+			},
+		}
+
+		err := validator.Validate(config)
+		if !cgroups.IsCgroup2UnifiedMode() {
+			if err == nil {
+				t.Errorf("families %v: expected error on cgroup v1, got nil", tc.families)
+			}
+			continue
+		}
+		if tc.isErr && err == nil {
+			t.Errorf("families %v: expected error, got nil", tc.families)
+		}
+		if !tc.isErr && err != nil {
+			t.Errorf("families %v: expected nil, got error %v", tc.families, err)
+		}
+	}
+}
+
+func TestValidateTimeNamespace(t *testing.T) {
+	if _, err := os.Stat("/proc/self/timens_offsets"); os.IsNotExist(err) {
+		t.Skip("Test requires timens.")
+	}
+	testCases := []struct {
+		name    string
+		nsPath  string
+		noNs    bool
+		offsets map[string]configs.TimeOffset
+		isErr   bool
+	}{
+		{name: "no offsets"},
+		{
+			name:    "offsets",
+			offsets: map[string]configs.TimeOffset{"monotonic": {Secs: 3600}, "boottime": {Secs: -10, Nanosecs: 500}},
+		},
+		{
+			name:    "offsets without timens",
+			noNs:    true,
+			offsets: map[string]configs.TimeOffset{"monotonic": {Secs: 3600}},
+			isErr:   true,
+		},
+		{
+			name:    "offsets with timens path",
+			nsPath:  "/proc/1/ns/time",
+			offsets: map[string]configs.TimeOffset{"monotonic": {Secs: 3600}},
+			isErr:   true,
+		},
+		{
+			name:    "invalid clock",
+			offsets: map[string]configs.TimeOffset{"realtime": {Secs: 3600}},
+			isErr:   true,
+		},
+		{
+			name:    "invalid nanosecs",
+			offsets: map[string]configs.TimeOffset{"boottime": {Nanosecs: 1e9}},
+			isErr:   true,
+		},
+	}
+
+	validator := validate.New()
+	for _, tc := range testCases {
+		config := &configs.Config{
+			Rootfs:      "/var",
+			TimeOffsets: tc.offsets,
+		}
+		if !tc.noNs {
+			config.Namespaces.Add(configs.NEWTIME, tc.nsPath)
+		}
+		err := validator.Validate(config)
+		if tc.isErr && err == nil {
+			t.Errorf("%s: expected error, got nil", tc.name)
+		}
+		if !tc.isErr && err != nil {
+			t.Errorf("%s: expected nil, got error %v", tc.name, err)
+		}
+	}
+}
+
+func TestValidateScheduler(t *testing.T) {
+	testCases := []struct {
+		name      string
+		scheduler configs.Scheduler
+		isErr     bool
+	}{
+		{name: "other", scheduler: configs.Scheduler{Policy: "SCHED_OTHER", Nice: -5}},
+		{name: "fifo", scheduler: configs.Scheduler{Policy: "SCHED_FIFO", Priority: 10, Flags: []string{"SCHED_FLAG_RESET_ON_FORK"}}},
+		{
+			name:      "deadline",
+			scheduler: configs.Scheduler{Policy: "SCHED_DEADLINE", Runtime: 1000000, Deadline: 2000000, Period: 2000000},
+		},
+		{name: "invalid policy", scheduler: configs.Scheduler{Policy: "SCHED_ISO"}, isErr: true},
+		{name: "invalid flag", scheduler: configs.Scheduler{Policy: "SCHED_OTHER", Flags: []string{"SCHED_FLAG_FOO"}}, isErr: true},
+		{name: "invalid nice", scheduler: configs.Scheduler{Policy: "SCHED_BATCH", Nice: 20}, isErr: true},
+		{name: "rr without priority", scheduler: configs.Scheduler{Policy: "SCHED_RR"}, isErr: true},
+		{name: "idle with priority", scheduler: configs.Scheduler{Policy: "SCHED_IDLE", Priority: 1}, isErr: true},
+		{
+			name:      "deadline without runtime",
+			scheduler: configs.Scheduler{Policy: "SCHED_DEADLINE", Deadline: 2000000},
+			isErr:     true,
+		},
+		{
+			name:      "deadline greater than period",
+			scheduler: configs.Scheduler{Policy: "SCHED_DEADLINE", Runtime: 1000000, Deadline: 3000000, Period: 2000000},
+			isErr:     true,
+		},
+		{
+			name:      "runtime without deadline policy",
+			scheduler: configs.Scheduler{Policy: "SCHED_FIFO", Priority: 10, Runtime: 1000000},
+			isErr:     true,
+		},
+	}
+
+	validator := validate.New()
+	for _, tc := range testCases {
+		tc := tc
+		config := &configs.Config{
+			Rootfs:    "/var",
+			Scheduler: &tc.scheduler,
+		}
+		err := validator.Validate(config)
+		if tc.isErr && err == nil {
+			t.Errorf("%s: expected error, got nil", tc.name)
+		}
+		if !tc.isErr && err != nil {
+			t.Errorf("%s: expected nil, got error %v", tc.name, err)
+		}
+	}
+}
+
+func TestValidateIOPriority(t *testing.T) {
+	testCases := []struct {
+		ioprio configs.IOPriority
+		isErr  bool
+	}{
+		{ioprio: configs.IOPriority{Class: "IOPRIO_CLASS_RT", Priority: 0}},
+		{ioprio: configs.IOPriority{Class: "IOPRIO_CLASS_BE", Priority: 7}},
+		{ioprio: configs.IOPriority{Class: "IOPRIO_CLASS_IDLE"}},
+		{ioprio: configs.IOPriority{Class: "IOPRIO_CLASS_NONE"}, isErr: true},
+		{ioprio: configs.IOPriority{Class: "IOPRIO_CLASS_BE", Priority: 8}, isErr: true},
+		{ioprio: configs.IOPriority{Class: "IOPRIO_CLASS_BE", Priority: -1}, isErr: true},
+	}
+
+	validator := validate.New()
+	for _, tc := range testCases {
+		tc := tc
+		config := &configs.Config{
+			Rootfs:     "/var",
+			IOPriority: &tc.ioprio,
+		}
+		err := validator.Validate(config)
+		if tc.isErr && err == nil {
+			t.Errorf("%+v: expected error, got nil", tc.ioprio)
+		}
+		if !tc.isErr && err != nil {
+			t.Errorf("%+v: expected nil, got error %v", tc.ioprio, err)
+		}
+	}
+}
+
+func TestValidateMemoryPolicy(t *testing.T) {
+	testCases := []struct {
+		name   string
+		policy configs.MemoryPolicy
+		isErr  bool
+	}{
+		{name: "bind", policy: configs.MemoryPolicy{Mode: "MPOL_BIND", Nodes: "0-1,3"}},
+		{name: "interleave", policy: configs.MemoryPolicy{Mode: "MPOL_INTERLEAVE", Nodes: "0", Flags: []string{"MPOL_F_STATIC_NODES"}}},
+		{name: "preferred local", policy: configs.MemoryPolicy{Mode: "MPOL_PREFERRED"}},
+		{name: "default", policy: configs.MemoryPolicy{Mode: "MPOL_DEFAULT"}},
+		{name: "balancing", policy: configs.MemoryPolicy{Mode: "MPOL_BIND", Nodes: "1", Flags: []string{"MPOL_F_NUMA_BALANCING"}}},
+		{name: "invalid mode", policy: configs.MemoryPolicy{Mode: "MPOL_FOO", Nodes: "0"}, isErr: true},
+		{name: "invalid flag", policy: configs.MemoryPolicy{Mode: "MPOL_BIND", Nodes: "0", Flags: []string{"MPOL_F_FOO"}}, isErr: true},
+		{name: "invalid nodes", policy: configs.MemoryPolicy{Mode: "MPOL_BIND", Nodes: "1-0"}, isErr: true},
+		{name: "too many nodes", policy: configs.MemoryPolicy{Mode: "MPOL_BIND", Nodes: "1024"}, isErr: true},
+		{name: "bind without nodes", policy: configs.MemoryPolicy{Mode: "MPOL_BIND"}, isErr: true},
+		{name: "local with nodes", policy: configs.MemoryPolicy{Mode: "MPOL_LOCAL", Nodes: "0"}, isErr: true},
+		{
+			name:   "preferred local with flags",
+			policy: configs.MemoryPolicy{Mode: "MPOL_PREFERRED", Flags: []string{"MPOL_F_RELATIVE_NODES"}},
+			isErr:  true,
+		},
+		{
+			name:   "static and relative",
+			policy: configs.MemoryPolicy{Mode: "MPOL_BIND", Nodes: "0", Flags: []string{"MPOL_F_STATIC_NODES", "MPOL_F_RELATIVE_NODES"}},
+			isErr:  true,
+		},
+		{
+			name:   "balancing without bind",
+			policy: configs.MemoryPolicy{Mode: "MPOL_INTERLEAVE", Nodes: "0", Flags: []string{"MPOL_F_NUMA_BALANCING"}},
+			isErr:  true,
+		},
+	}
+
+	validator := validate.New()
+	for _, tc := range testCases {
+		tc := tc
+		config := &configs.Config{
+			Rootfs:       "/var",
+			MemoryPolicy: &tc.policy,
+		}
+		err := validator.Validate(config)
+		if tc.isErr && err == nil {
+			t.Errorf("%s: expected error, got nil", tc.name)
+		}
+		if !tc.isErr && err != nil {
+			t.Errorf("%s: expected nil, got error %v", tc.name, err)
+		}
+	}
+}
+
+func TestValidateHookTimeout(t *testing.T) {
+	testCases := []struct {
+		timeout time.Duration
+		isErr   bool
+	}{
+		{timeout: time.Second},
+		{timeout: 0, isErr: true},
+		{timeout: -time.Second, isErr: true},
+	}
+
+	validator := validate.New()
+	for _, tc := range testCases {
+		tc := tc
+		config := &configs.Config{
+			Rootfs: "/var",
+			Hooks: configs.Hooks{
+				configs.Prestart: configs.HookList{configs.NewCommandHook(configs.Command{
+					Path:    "/bin/true",
+					Timeout: &tc.timeout,
+				})},
+			},
+		}
+		err := validator.Validate(config)
+		if tc.isErr && err == nil {
+			t.Errorf("%v: expected error, got nil", tc.timeout)
+		}
+		if !tc.isErr && err != nil {
+			t.Errorf("%v: expected nil, got error %v", tc.timeout, err)
+		}
+	}
+}
+
+func TestValidateFindings(t *testing.T) {
+	timeout := time.Duration(0)
+	config := &configs.Config{
+		Rootfs:     "/var",
+		Namespaces: []configs.Namespace{},
+		Hostname:   "runc",
+		Networks:   []*configs.Network{{Type: "loopback"}},
+		Hooks: configs.Hooks{
+			configs.Prestart: configs.HookList{configs.NewCommandHook(configs.Command{
+				Path:    "/bin/true",
+				Timeout: &timeout,
+			})},
+		},
+	}
+
+	findings := validate.Validate(config)
+	var checks []string
+	for _, f := range findings {
+		checks = append(checks, f.Check)
+	}
+	expected := []string{"network", "hostname", "hooks"}
+	if !reflect.DeepEqual(checks, expected) {
+		t.Fatalf("expected findings of the checks %q, got %+v", expected, findings)
+	}
+
+	// All the findings are reported by the validator.
+	err := validate.New().Validate(config)
+	var errFindings validate.Findings
+	if !errors.As(err, &errFindings) || len(errFindings) != len(findings) {
+		t.Fatalf("expected the findings as error, got %v", err)
+	}
+	if !errors.As(err, new(*validate.Finding)) {
+		t.Errorf("expected a finding in %v", err)
+	}
+	if !errors.Is(err, errFindings[len(errFindings)-1].Err) {
+		t.Errorf("expected %v in %v", errFindings[len(errFindings)-1].Err, err)
+	}
+	if msg := err.Error(); strings.Count(msg, "; ") != len(findings)-1 {
+		t.Errorf("expected all the findings in the error, got %q", msg)
+	}
+
+	config.Networks, config.Hostname, config.Hooks = nil, "", nil
+	if findings := validate.Validate(config); findings != nil {
+		t.Errorf("expected no findings, got %v", findings)
+	}
+}
@@ -5,6 +5,7 @@
 package libcontainer
 
 import (
+	"context"
 	"os"
 	"time"
 
@@ -130,6 +131,11 @@ type BaseContainer interface {
 	// SystemError - System error.
 	Start(process *Process) (err error)
 
+	// StartContext is like Start, except that starting the process gives up
+	// once ctx is done: the process is killed, the hooks being run are
+	// killed, and the error wraps ctx.Err().
+	StartContext(ctx context.Context, process *Process) (err error)
+
 	// Run immediately starts the process inside the container.  Returns error if process
 	// fails to start.  It does not block waiting for the exec fifo  after start returns but
 	// opens the fifo after start returns.
@@ -141,6 +147,10 @@ type BaseContainer interface {
 	// SystemError - System error.
 	Run(process *Process) (err error)
 
+	// RunContext is like Run, except that it gives up once ctx is done, as
+	// StartContext and ExecContext do.
+	RunContext(ctx context.Context, process *Process) (err error)
+
 	// Destroys the container, if its in a valid state, after killing any
 	// remaining running processes.
 	//
@@ -156,6 +166,11 @@ type BaseContainer interface {
 	// SystemError - System error.
 	Destroy() error
 
+	// DestroyContext is like Destroy, except that it gives up waiting for
+	// the cgroup manager and killing the poststop hooks once ctx is done, in
+	// which case the container may have to be destroyed again.
+	DestroyContext(ctx context.Context) error
+
 	// Signal sends the provided signal code to the container's initial process.
 	//
 	// If all is specified the signal is sent to all processes in the container
@@ -170,4 +185,8 @@ type BaseContainer interface {
 	// errors:
 	// SystemError - System error.
 	Exec() error
+
+	// ExecContext is like Exec, except that it gives up waiting for the
+	// user process to be executed once ctx is done.
+	ExecContext(ctx context.Context) error
 }
@@ -4,6 +4,7 @@ package libcontainer
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -14,6 +15,7 @@ import (
 	"os/exec"
 	"path/filepath"
 	"reflect"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -21,9 +23,12 @@ import (
 
 	securejoin "github.com/cyphar/filepath-securejoin"
 	"github.com/opencontainers/runc/libcontainer/cgroups"
+	"github.com/opencontainers/runc/libcontainer/cgroups/fs"
 	"github.com/opencontainers/runc/libcontainer/configs"
+	"github.com/opencontainers/runc/libcontainer/devices"
 	"github.com/opencontainers/runc/libcontainer/intelrdt"
 	"github.com/opencontainers/runc/libcontainer/system"
+	"github.com/opencontainers/runc/libcontainer/trace"
 	"github.com/opencontainers/runc/libcontainer/utils"
 	"github.com/opencontainers/runtime-spec/specs-go"
 
@@ -56,12 +61,30 @@ type linuxContainer struct {
 	state                containerState
 	created              time.Time
 	fifo                 *os.File
+	// deviceRules is a copy of the device rules in effect, or nil if unknown.
+	deviceRules []*devices.Rule
+	// netBandwidth is the network bandwidth limit in effect.
+	netBandwidth uint64
+	// hookResults are the results of the hooks run by runc so far.
+	hookResults []configs.HookResult
+	// stateStore persists the state of the container.
+	stateStore StateStore
+	// deviceStats are the providers of the stats of the devices.
+	deviceStats []DeviceStatsProvider
 }
 
 // State represents a running container's state
 type State struct {
 	BaseState
 
+	// Version is the StateVersion of the schema of the state, or 0 for the
+	// states written before it was versioned.
+	Version int `json:"state_version,omitempty"`
+
+	// CompatVersion is the oldest StateVersion able to load the state (see
+	// StateCompatVersion).
+	CompatVersion int `json:"state_compat_version,omitempty"`
+
 	// Platform specific fields below here
 
 	// Specified if the container was started under the rootless mode.
@@ -85,6 +108,11 @@ type State struct {
 
 	// Intel RDT "resource control" filesystem path
 	IntelRdtPath string `json:"intel_rdt_path"`
+
+	// HookResults are the results of the prestart, createRuntime and
+	// poststart hooks, in the order they were run. The hooks run in the
+	// container (createContainer and startContainer) are not recorded.
+	HookResults []configs.HookResult `json:"hook_results,omitempty"`
 }
 
 // Container is a libcontainer container object.
@@ -103,12 +131,22 @@ type Container interface {
 	// Systemerror - System error.
 	Checkpoint(criuOpts *CriuOpts) error
 
+	// CheckpointContext is like Checkpoint, except that criu(8) and the
+	// hooks are killed once ctx is done, in which case the container may
+	// have been left frozen (see Resume).
+	CheckpointContext(ctx context.Context, criuOpts *CriuOpts) error
+
 	// Restore restores the checkpointed container to a running state using the criu(8) utility.
 	//
 	// errors:
 	// Systemerror - System error.
 	Restore(process *Process, criuOpts *CriuOpts) error
 
+	// RestoreContext is like Restore, except that criu(8) and the hooks are
+	// killed once ctx is done, in which case the container should be
+	// destroyed.
+	RestoreContext(ctx context.Context, process *Process, criuOpts *CriuOpts) error
+
 	// If the Container state is RUNNING or CREATED, sets the Container state to PAUSING and pauses
 	// the execution of any user processes. Asynchronously, when the container finished being paused the
 	// state is changed to PAUSED.
@@ -120,6 +158,11 @@ type Container interface {
 	// Systemerror - System error.
 	Pause() error
 
+	// PauseContext is like Pause, except that it gives up once ctx is done,
+	// in which case the error wraps cgroups.ErrFreezing (see
+	// cgroups.FreezeOptions for opts, which may be nil).
+	PauseContext(ctx context.Context, opts *cgroups.FreezeOptions) error
+
 	// If the Container state is PAUSED, resumes the execution of any user processes in the
 	// Container before setting the Container state to RUNNING.
 	// If the Container state is RUNNING, do nothing.
@@ -136,11 +179,57 @@ type Container interface {
 	// Systemerror - System error.
 	NotifyOOM() (<-chan struct{}, error)
 
+	// NotifyOOMKill returns a read-only channel on which an OOMKillEvent is sent
+	// every time the OOM killer kills one or more processes of the container.
+	// The channel is closed once the container's cgroup is gone.
+	//
+	// errors:
+	// Systemerror - System error.
+	NotifyOOMKill() (<-chan OOMKillEvent, error)
+
 	// NotifyMemoryPressure returns a read-only channel signaling when the container reaches a given pressure level
 	//
 	// errors:
 	// Systemerror - System error.
 	NotifyMemoryPressure(level PressureLevel) (<-chan struct{}, error)
+
+	// NotifyPSI registers a pressure stall information (PSI) trigger on the
+	// container's cgroup, and returns a read-only channel on which an event
+	// is sent every time the trigger fires. The channel is closed once the
+	// container's cgroup is removed. This requires cgroup v2.
+	//
+	// errors:
+	// Systemerror - System error.
+	NotifyPSI(trigger PSITrigger) (<-chan struct{}, error)
+
+	// NotifyDeviceDenied returns a read-only channel on which an event is
+	// sent every time a process of the container is denied access to a
+	// device. The channel is closed once the container's cgroup is removed.
+	// This requires the container to be created with Cgroups.AuditDevices
+	// set.
+	//
+	// errors:
+	// Systemerror - System error.
+	NotifyDeviceDenied() (<-chan DeviceDeniedEvent, error)
+
+	// ReclaimMemory triggers a one-shot proactive reclaim of the given
+	// amount of memory (in bytes) from the container, without changing
+	// its memory limits. This requires cgroup v2 and Linux 5.19+.
+	//
+	// errors:
+	// ContainerNotRunning - Container not running or created,
+	// Systemerror - System error.
+	ReclaimMemory(bytes uint64) error
+
+	// ExitNotify returns a read-only channel which is closed once the
+	// container's init process exits. Unlike waiting on the process, this
+	// also works for containers started by another process. This requires
+	// Linux 5.3+.
+	//
+	// errors:
+	// ContainerNotRunning - Container not running or created,
+	// Systemerror - System error.
+	ExitNotify() (<-chan struct{}, error)
 }
 
 // ID returns the container's unique ID
@@ -197,6 +286,7 @@ func (c *linuxContainer) Stats() (*Stats, error) {
 	if stats.CgroupStats, err = c.cgroupManager.GetStats(); err != nil {
 		return stats, newSystemErrorWithCause(err, "getting container stats from cgroups")
 	}
+	stats.CgroupStats.DeviceStats = c.getDeviceStats()
 	if c.intelRdtManager != nil {
 		if stats.IntelRdtStats, err = c.intelRdtManager.GetStats(); err != nil {
 			return stats, newSystemErrorWithCause(err, "getting container's Intel RDT stats")
@@ -225,32 +315,131 @@ func (c *linuxContainer) Set(config configs.Config) error {
 	if status == Stopped {
 		return newGenericError(errors.New("container not running"), ContainerNotRunning)
 	}
-	if err := c.cgroupManager.Set(config.Cgroups.Resources); err != nil {
-		// Set configs back
+	added, removed, err := c.portForwardChanges(&config)
+	if err != nil {
+		return newSystemErrorWithCause(err, "updating port forwards")
+	}
+	// The rlimits are set first, as they are the only ones which are not
+	// reverted if setting the other configs fails.
+	if rlimits := changedRlimits(c.config.Rlimits, config.Rlimits); len(rlimits) > 0 {
+		if err := setupRlimits(rlimits, c.initProcess.pid()); err != nil {
+			return newSystemErrorWithCause(err, "setting rlimits of the init process")
+		}
+	}
+	netBandwidth := netBandwidthLimit(config.Networks)
+	// rollback sets the configs back once setting the new ones failed, and
+	// returns err.
+	rollback := func(err error) error {
 		if err2 := c.cgroupManager.Set(c.config.Cgroups.Resources); err2 != nil {
 			logrus.Warnf("Setting back cgroup configs failed due to error: %v, your state.json and actual configs might be inconsistent.", err2)
 		}
+		if c.intelRdtManager != nil {
+			if err2 := c.intelRdtManager.Set(c.config); err2 != nil {
+				logrus.Warnf("Setting back intelrdt configs failed due to error: %v, your state.json and actual configs might be inconsistent.", err2)
+			}
+		}
+		if netBandwidth != c.netBandwidth {
+			if err2 := setNetBandwidthLimit(c.cgroupManager.Path(""), c.netBandwidth); err2 != nil {
+				logrus.Warnf("Setting back network bandwidth limit failed due to error: %v, your state.json and actual configs might be inconsistent.", err2)
+			}
+		}
 		return err
 	}
+	if err := c.cgroupManager.Set(skipUnchangedDevices(config.Cgroups.Resources, c.deviceRules)); err != nil {
+		return rollback(err)
+	}
 	if c.intelRdtManager != nil {
 		if err := c.intelRdtManager.Set(&config); err != nil {
-			// Set configs back
-			if err2 := c.cgroupManager.Set(c.config.Cgroups.Resources); err2 != nil {
-				logrus.Warnf("Setting back cgroup configs failed due to error: %v, your state.json and actual configs might be inconsistent.", err2)
-			}
-			if err2 := c.intelRdtManager.Set(c.config); err2 != nil {
-				logrus.Warnf("Setting back intelrdt configs failed due to error: %v, your state.json and actual configs might be inconsistent.", err2)
-			}
-			return err
+			return rollback(err)
+		}
+	}
+	// The network bandwidth limit is set once the cgroup configs are, so
+	// that it is not left in effect if setting them fails.
+	if netBandwidth != c.netBandwidth {
+		if err := setNetBandwidthLimit(c.cgroupManager.Path(""), netBandwidth); err != nil {
+			return rollback(newSystemErrorWithCause(err, "setting network bandwidth limit"))
 		}
 	}
+	// The port forwards are updated last, like the network bandwidth limit.
+	// setPortForwards undoes its own changes if it fails.
+	if err := c.setPortForwards(added, removed); err != nil {
+		return rollback(newSystemErrorWithCause(err, "updating port forwards"))
+	}
 	// After config setting succeed, update config and states
 	c.config = &config
+	c.deviceRules = appliedDeviceRules(&config)
+	c.netBandwidth = netBandwidth
 	_, err = c.updateState(nil)
 	return err
 }
 
+// changedRlimits returns the rlimits of limits which are not in old, or
+// are set to different values in old.
+func changedRlimits(old, limits []configs.Rlimit) []configs.Rlimit {
+	var changed []configs.Rlimit
+next:
+	for _, l := range limits {
+		for _, o := range old {
+			if o == l {
+				continue next
+			}
+		}
+		changed = append(changed, l)
+	}
+	return changed
+}
+
+// copyDeviceRules returns a deep copy of rules, which is never nil. A copy
+// is needed as the container configuration is usually modified in place
+// before being passed to Set.
+func copyDeviceRules(rules []*devices.Rule) []*devices.Rule {
+	cp := make([]*devices.Rule, 0, len(rules))
+	for _, rule := range rules {
+		r := *rule
+		cp = append(cp, &r)
+	}
+	return cp
+}
+
+// appliedDeviceRules returns a copy of the device rules from config, or nil
+// if there are no cgroup resources in config.
+func appliedDeviceRules(config *configs.Config) []*devices.Rule {
+	if config.Cgroups == nil || config.Cgroups.Resources == nil {
+		return nil
+	}
+	return copyDeviceRules(config.Cgroups.Resources.Devices)
+}
+
+// skipUnchangedDevices returns r, or a copy of it with SkipDevices set if
+// its device rules are the same as the rules currently in effect (applied).
+// This avoids needlessly replacing the device filter (and, with systemd,
+// freezing the container) on every update.
+func skipUnchangedDevices(r *configs.Resources, applied []*devices.Rule) *configs.Resources {
+	if r.SkipDevices || applied == nil || !sameDeviceRules(r.Devices, applied) {
+		return r
+	}
+	skip := *r
+	skip.SkipDevices = true
+	return &skip
+}
+
+func sameDeviceRules(a, b []*devices.Rule) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !reflect.DeepEqual(a[i], b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
 func (c *linuxContainer) Start(process *Process) error {
+	return c.StartContext(context.Background(), process)
+}
+
+func (c *linuxContainer) StartContext(ctx context.Context, process *Process) error {
 	c.m.Lock()
 	defer c.m.Unlock()
 	if c.config.Cgroups.Resources.SkipDevices {
@@ -261,7 +450,7 @@ func (c *linuxContainer) Start(process *Process) error {
 			return err
 		}
 	}
-	if err := c.start(process); err != nil {
+	if err := c.start(ctx, process); err != nil {
 		if process.Init {
 			c.deleteExecFifo()
 		}
@@ -271,22 +460,30 @@ func (c *linuxContainer) Start(process *Process) error {
 }
 
 func (c *linuxContainer) Run(process *Process) error {
-	if err := c.Start(process); err != nil {
+	return c.RunContext(context.Background(), process)
+}
+
+func (c *linuxContainer) RunContext(ctx context.Context, process *Process) error {
+	if err := c.StartContext(ctx, process); err != nil {
 		return err
 	}
 	if process.Init {
-		return c.exec()
+		return c.exec(ctx)
 	}
 	return nil
 }
 
 func (c *linuxContainer) Exec() error {
+	return c.ExecContext(context.Background())
+}
+
+func (c *linuxContainer) ExecContext(ctx context.Context) error {
 	c.m.Lock()
 	defer c.m.Unlock()
-	return c.exec()
+	return c.exec(ctx)
 }
 
-func (c *linuxContainer) exec() error {
+func (c *linuxContainer) exec(ctx context.Context) error {
 	path := filepath.Join(c.root, execFifoFilename)
 	pid := c.initProcess.pid()
 	blockingFifoOpenCh := awaitFifoOpen(path)
@@ -295,6 +492,13 @@ func (c *linuxContainer) exec() error {
 		case result := <-blockingFifoOpenCh:
 			return handleFifoResult(result)
 
+		case <-ctx.Done():
+			// The user process may have been executed in the meantime.
+			if err := handleFifoResult(cancelFifoOpen(path, blockingFifoOpenCh)); err == nil {
+				return nil
+			}
+			return ctx.Err()
+
 		case <-time.After(time.Millisecond * 100):
 			stat, err := system.Stat(pid)
 			if err != nil || stat.State == system.Zombie {
@@ -315,7 +519,7 @@ func readFromExecFifo(execFifo io.Reader) error {
 		return err
 	}
 	if len(data) <= 0 {
-		return errors.New("cannot start an already running container")
+		return newGenericError(errors.New("cannot start an already running container"), ContainerNotStopped)
 	}
 	return nil
 }
@@ -329,6 +533,23 @@ func awaitFifoOpen(path string) <-chan openResult {
 	return fifoOpened
 }
 
+// cancelFifoOpen unblocks the opening of the exec fifo for reading by
+// awaitFifoOpen, by opening it for writing for a moment, which does not let
+// init proceed, and returns the result.
+func cancelFifoOpen(path string, fifoOpened <-chan openResult) openResult {
+	for {
+		// This fails until the fifo is being opened for reading.
+		if f, err := os.OpenFile(path, os.O_WRONLY|unix.O_NONBLOCK, 0); err == nil {
+			f.Close()
+		}
+		select {
+		case result := <-fifoOpened:
+			return result
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
+
 func fifoOpen(path string, block bool) openResult {
 	flags := os.O_RDONLY
 	if !block {
@@ -358,7 +579,7 @@ type openResult struct {
 	err  error
 }
 
-func (c *linuxContainer) start(process *Process) (retErr error) {
+func (c *linuxContainer) start(ctx context.Context, process *Process) (retErr error) {
 	parent, err := c.newParentProcess(process)
 	if err != nil {
 		return newSystemErrorWithCause(err, "creating new parent process")
@@ -376,7 +597,11 @@ func (c *linuxContainer) start(process *Process) (retErr error) {
 		}()
 	}
 
-	if err := parent.start(); err != nil {
+	if err := parent.start(ctx); err != nil {
+		// Report the cancellation rather than how it made start fail.
+		if ctx.Err() != nil {
+			err = ctx.Err()
+		}
 		return newSystemErrorWithCause(err, "starting container process")
 	}
 
@@ -388,7 +613,13 @@ func (c *linuxContainer) start(process *Process) (retErr error) {
 				return err
 			}
 
-			if err := c.config.Hooks[configs.Poststart].RunHooks(s); err != nil {
+			err = c.runHooks(ctx, configs.Poststart, s)
+			// Save the results of the hooks, so that they can be examined
+			// with runc state, even if one of them failed.
+			if _, serr := c.updateState(nil); serr != nil {
+				logrus.Warnf("unable to save the poststart hook results: %v", serr)
+			}
+			if err != nil {
 				if err := ignoreTerminateErrors(parent.terminate()); err != nil {
 					logrus.Warn(errorsf.Wrapf(err, "Running Poststart hook"))
 				}
@@ -399,6 +630,25 @@ func (c *linuxContainer) start(process *Process) (retErr error) {
 	return nil
 }
 
+// runHooks runs the hooks name, and records the results of the command hooks,
+// to be saved with the state of the container.
+func (c *linuxContainer) runHooks(ctx context.Context, name configs.HookName, s *specs.State) error {
+	results, err := runHookList(ctx, c.config.Hooks[name], name, s)
+	c.hookResults = append(c.hookResults, results...)
+	return err
+}
+
+// runHookList runs the hooks name, traced as a single span.
+func runHookList(ctx context.Context, hooks configs.HookList, name configs.HookName, s *specs.State) ([]configs.HookResult, error) {
+	if len(hooks) == 0 {
+		return nil, nil
+	}
+	span := trace.Start("hooks")
+	span.SetAttribute("hook.name", string(name))
+	defer span.Finish()
+	return hooks.RunHooksWithResults(ctx, name, s)
+}
+
 func (c *linuxContainer) Signal(s os.Signal, all bool) error {
 	c.m.Lock()
 	defer c.m.Unlock()
@@ -527,6 +777,9 @@ func (c *linuxContainer) commandTemplate(p *Process, childInitPipe *os.File, chi
 		"_LIBCONTAINER_LOGPIPE="+strconv.Itoa(stdioFdCount+len(cmd.ExtraFiles)-1),
 		"_LIBCONTAINER_LOGLEVEL="+p.LogLevel,
 	)
+	if trace.Enabled() {
+		cmd.Env = append(cmd.Env, "_LIBCONTAINER_TRACE=1")
+	}
 
 	// NOTE: when running a container with no PID namespace and the parent process spawning the container is
 	// PID1 the pdeathsig is being delivered to the container's init process by the kernel for some reason
@@ -546,7 +799,7 @@ func (c *linuxContainer) newInitProcess(p *Process, cmd *exec.Cmd, messageSockPa
 		}
 	}
 	_, sharePidns := nsMaps[configs.NEWPID]
-	data, err := c.bootstrapData(c.config.Namespaces.CloneFlags(), nsMaps)
+	data, err := c.bootstrapData(c.config.Namespaces.CloneFlags(), nsMaps, c.config.OomScoreAdj)
 	if err != nil {
 		return nil, err
 	}
@@ -572,15 +825,40 @@ func (c *linuxContainer) newSetnsProcess(p *Process, cmd *exec.Cmd, messageSockP
 	if err != nil {
 		return nil, newSystemErrorWithCause(err, "getting container's current state")
 	}
+	oomScoreAdj := c.config.OomScoreAdj
+	if p.OomScoreAdj != nil {
+		oomScoreAdj = p.OomScoreAdj
+	}
 	// for setns process, we don't have to set cloneflags as the process namespaces
 	// will only be set via setns syscall
-	data, err := c.bootstrapData(0, state.NamespacePaths)
+	data, err := c.bootstrapData(0, state.NamespacePaths, oomScoreAdj)
 	if err != nil {
 		return nil, err
 	}
+	cgroupPaths := state.CgroupPaths
+	if p.Cgroup != "" {
+		// With cgroup v2, the controllers can't be enabled for the child
+		// cgroups of the cgroup of the container while its init runs in
+		// it (the "no internal processes" rule), so its child cgroups
+		// could neither be limited nor account for their processes.
+		if cgroups.IsCgroup2UnifiedMode() {
+			return nil, fmt.Errorf("unable to use cgroup %q: child cgroups are only supported on cgroup v1", p.Cgroup)
+		}
+		if cgroupPaths, err = subCgroupPaths(cgroupPaths, p.Cgroup); err != nil {
+			return nil, err
+		}
+		if p.CgroupResources != nil {
+			m := fs.NewManager(&configs.Cgroup{Resources: p.CgroupResources}, cgroupPaths, c.config.RootlessCgroups)
+			if err := m.Set(p.CgroupResources); err != nil {
+				return nil, fmt.Errorf("unable to set the limits of cgroup %q: %w", p.Cgroup, err)
+			}
+		}
+	} else if p.CgroupResources != nil {
+		return nil, errors.New("unable to set cgroup limits without a child cgroup")
+	}
 	return &setnsProcess{
 		cmd:             cmd,
-		cgroupPaths:     state.CgroupPaths,
+		cgroupPaths:     cgroupPaths,
 		rootlessCgroups: c.config.RootlessCgroups,
 		intelRdtPath:    state.IntelRdtPath,
 		messageSockPair: messageSockPair,
@@ -590,9 +868,31 @@ func (c *linuxContainer) newSetnsProcess(p *Process, cmd *exec.Cmd, messageSockP
 		process:         p,
 		bootstrapData:   data,
 		initProcessPid:  state.InitProcessPid,
+		container:       c,
 	}, nil
 }
 
+// subCgroupPaths returns the paths of the child cgroup sub of the cgroups of
+// the container, paths, creating it if it does not exist.
+func subCgroupPaths(paths map[string]string, sub string) (map[string]string, error) {
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("unable to use cgroup %q: the container has no cgroup", sub)
+	}
+	clean := filepath.Clean(sub)
+	if filepath.IsAbs(clean) || clean == "." || clean == ".." || strings.HasPrefix(clean, "../") {
+		return nil, fmt.Errorf("invalid cgroup %q: must be a relative path within the cgroup of the container", sub)
+	}
+	subPaths := make(map[string]string, len(paths))
+	for name, path := range paths {
+		subPath := filepath.Join(path, clean)
+		if err := os.MkdirAll(subPath, 0o755); err != nil {
+			return nil, fmt.Errorf("unable to create cgroup %q: %w", sub, err)
+		}
+		subPaths[name] = subPath
+	}
+	return subPaths, nil
+}
+
 func (c *linuxContainer) newInitConfig(process *Process) *initConfig {
 	cfg := &initConfig{
 		Config:           c.config,
@@ -610,6 +910,7 @@ func (c *linuxContainer) newInitConfig(process *Process) *initConfig {
 		AppArmorProfile:  c.config.AppArmorProfile,
 		ProcessLabel:     c.config.ProcessLabel,
 		Rlimits:          c.config.Rlimits,
+		IOPriority:       c.config.IOPriority,
 		CreateConsole:    process.ConsoleSocket != nil,
 		ConsoleWidth:     process.ConsoleWidth,
 		ConsoleHeight:    process.ConsoleHeight,
@@ -626,6 +927,9 @@ func (c *linuxContainer) newInitConfig(process *Process) *initConfig {
 	if len(process.Rlimits) > 0 {
 		cfg.Rlimits = process.Rlimits
 	}
+	if process.IOPriority != nil {
+		cfg.IOPriority = process.IOPriority
+	}
 	if cgroups.IsCgroup2UnifiedMode() {
 		cfg.Cgroup2Path = c.cgroupManager.Path("")
 	}
@@ -634,12 +938,22 @@ func (c *linuxContainer) newInitConfig(process *Process) *initConfig {
 }
 
 func (c *linuxContainer) Destroy() error {
+	return c.DestroyContext(context.Background())
+}
+
+func (c *linuxContainer) DestroyContext(ctx context.Context) error {
 	c.m.Lock()
 	defer c.m.Unlock()
-	return c.state.destroy()
+	span := trace.Start("container destroy")
+	defer span.Finish()
+	return c.state.destroy(ctx)
 }
 
 func (c *linuxContainer) Pause() error {
+	return c.PauseContext(context.Background(), nil)
+}
+
+func (c *linuxContainer) PauseContext(ctx context.Context, opts *cgroups.FreezeOptions) error {
 	c.m.Lock()
 	defer c.m.Unlock()
 	status, err := c.currentStatus()
@@ -648,7 +962,7 @@ func (c *linuxContainer) Pause() error {
 	}
 	switch status {
 	case Running, Created:
-		if err := c.cgroupManager.Freeze(configs.Frozen); err != nil {
+		if err := c.cgroupManager.FreezeContext(ctx, configs.Frozen, opts); err != nil {
 			return err
 		}
 		return c.state.transition(&pausedState{
@@ -688,6 +1002,18 @@ func (c *linuxContainer) NotifyOOM() (<-chan struct{}, error) {
 	return notifyOnOOM(path)
 }
 
+func (c *linuxContainer) NotifyOOMKill() (<-chan OOMKillEvent, error) {
+	// XXX(cyphar): This requires cgroups.
+	if c.config.RootlessCgroups {
+		logrus.Warn("getting OOM kill notifications may fail if you don't have the full access to cgroups")
+	}
+	path := c.cgroupManager.Path("memory")
+	if cgroups.IsCgroup2UnifiedMode() {
+		return notifyOnOOMKillV2(path)
+	}
+	return notifyOnOOMKill(path)
+}
+
 func (c *linuxContainer) NotifyMemoryPressure(level PressureLevel) (<-chan struct{}, error) {
 	// XXX(cyphar): This requires cgroups.
 	if c.config.RootlessCgroups {
@@ -696,9 +1022,58 @@ func (c *linuxContainer) NotifyMemoryPressure(level PressureLevel) (<-chan struc
 	return notifyMemoryPressure(c.cgroupManager.Path("memory"), level)
 }
 
+func (c *linuxContainer) NotifyPSI(trigger PSITrigger) (<-chan struct{}, error) {
+	if !cgroups.IsCgroup2UnifiedMode() {
+		return nil, newGenericError(errors.New("PSI triggers require cgroup v2"), SystemError)
+	}
+	return notifyOnPSI(c.cgroupManager.Path(""), trigger)
+}
+
+func (c *linuxContainer) NotifyDeviceDenied() (<-chan DeviceDeniedEvent, error) {
+	if c.config.Cgroups == nil || !c.config.Cgroups.AuditDevices {
+		return nil, newGenericError(errors.New("auditing device accesses is not enabled"), SystemError)
+	}
+	// On cgroup v1, this is the cgroup in the unified hierarchy.
+	path := c.cgroupManager.Path("")
+	if path == "" {
+		return nil, newGenericError(errors.New("the container has no cgroup in the unified hierarchy"), SystemError)
+	}
+	return notifyOnDeviceDenied(path)
+}
+
+func (c *linuxContainer) ReclaimMemory(bytes uint64) error {
+	c.m.Lock()
+	defer c.m.Unlock()
+	status, err := c.currentStatus()
+	if err != nil {
+		return err
+	}
+	if status == Stopped {
+		return newGenericError(errors.New("container not running"), ContainerNotRunning)
+	}
+	return c.cgroupManager.Reclaim(bytes)
+}
+
+func (c *linuxContainer) ExitNotify() (<-chan struct{}, error) {
+	c.m.Lock()
+	defer c.m.Unlock()
+	status, err := c.currentStatus()
+	if err != nil {
+		return nil, err
+	}
+	if status == Stopped {
+		return nil, newGenericError(errors.New("container not running"), ContainerNotRunning)
+	}
+	ch, err := notifyOnExit(c.initProcess.pid(), c.initProcessStartTime)
+	if err != nil {
+		return nil, newSystemErrorWithCause(err, "getting exit notifications")
+	}
+	return ch, nil
+}
+
 var criuFeatures *criurpc.CriuFeatures
 
-func (c *linuxContainer) checkCriuFeatures(criuOpts *CriuOpts, rpcOpts *criurpc.CriuOpts, criuFeat *criurpc.CriuFeatures) error {
+func (c *linuxContainer) checkCriuFeatures(ctx context.Context, criuOpts *CriuOpts, rpcOpts *criurpc.CriuOpts, criuFeat *criurpc.CriuFeatures) error {
 
 	t := criurpc.CriuReqType_FEATURE_CHECK
 
@@ -715,7 +1090,7 @@ func (c *linuxContainer) checkCriuFeatures(criuOpts *CriuOpts, rpcOpts *criurpc.
 		Features: criuFeat,
 	}
 
-	err := c.criuSwrk(nil, req, criuOpts, nil)
+	err := c.criuSwrk(ctx, nil, req, criuOpts, nil)
 	if err != nil {
 		logrus.Debugf("%s", err)
 		return errors.New("CRIU feature check failed")
@@ -858,12 +1233,40 @@ func criuNsToKey(t configs.NamespaceType) string {
 	return "extRoot" + strings.Title(configs.NsName(t)) + "NS"
 }
 
-func (c *linuxContainer) handleCheckpointingExternalNamespaces(rpcOpts *criurpc.CriuOpts, t configs.NamespaceType) error {
+// checkCriuNetworkOpts checks that the network options of criuOpts can be
+// used with the container and criu.
+func (c *linuxContainer) checkCriuNetworkOpts(criuOpts *CriuOpts) error {
+	if !criuOpts.ExternalNetNs && criuOpts.NetNsPath == "" {
+		return nil
+	}
+	if !c.config.Namespaces.Contains(configs.NEWNET) {
+		return errors.New("the container has no network namespace to be external")
+	}
+	if !c.criuSupportsExtNS(configs.NEWNET) {
+		return errors.New("external network namespaces require criu 3.11.0 or later")
+	}
+	return nil
+}
+
+// criuExternalMacvlans appends the external macvlans of criuOpts to rpcOpts,
+// as --external macvlan[<container interface>]:<host interface>.
+func criuExternalMacvlans(rpcOpts *criurpc.CriuOpts, criuOpts *CriuOpts) {
+	for _, m := range criuOpts.Macvlans {
+		rpcOpts.External = append(rpcOpts.External, fmt.Sprintf("macvlan[%s]:%s", m.ContainerInterfaceName, m.HostInterfaceName))
+	}
+}
+
+func (c *linuxContainer) handleCheckpointingExternalNamespaces(rpcOpts *criurpc.CriuOpts, criuOpts *CriuOpts, t configs.NamespaceType) error {
 	if !c.criuSupportsExtNS(t) {
 		return nil
 	}
 
 	nsPath := c.config.Namespaces.PathOf(t)
+	if nsPath == "" && t == configs.NEWNET && criuOpts.ExternalNetNs {
+		// The namespace was created by runc, but is still to be
+		// restored as an external one.
+		nsPath = fmt.Sprintf("/proc/%d/ns/net", c.initProcess.pid())
+	}
 	if nsPath == "" {
 		return nil
 	}
@@ -880,7 +1283,7 @@ func (c *linuxContainer) handleCheckpointingExternalNamespaces(rpcOpts *criurpc.
 	return nil
 }
 
-func (c *linuxContainer) handleRestoringNamespaces(rpcOpts *criurpc.CriuOpts, extraFiles *[]*os.File) error {
+func (c *linuxContainer) handleRestoringNamespaces(rpcOpts *criurpc.CriuOpts, criuOpts *CriuOpts, extraFiles *[]*os.File) error {
 	for _, ns := range c.config.Namespaces {
 		switch ns.Type {
 		case configs.NEWNET, configs.NEWPID:
@@ -890,7 +1293,7 @@ func (c *linuxContainer) handleRestoringNamespaces(rpcOpts *criurpc.CriuOpts, ex
 			// will expect that the namespace exists during restore.
 			// This basically means that CRIU will ignore the namespace
 			// and expect it to be setup correctly.
-			if err := c.handleRestoringExternalNamespaces(rpcOpts, extraFiles, ns.Type); err != nil {
+			if err := c.handleRestoringExternalNamespaces(rpcOpts, criuOpts, extraFiles, ns.Type); err != nil {
 				return err
 			}
 		default:
@@ -904,8 +1307,6 @@ func (c *linuxContainer) handleRestoringNamespaces(rpcOpts *criurpc.CriuOpts, ex
 				// CRIU has no code to handle NEWCGROUP
 				return fmt.Errorf("Do not know how to handle namespace %v", ns.Type)
 			}
-			// CRIU has code to handle NEWTIME, but it does not seem to be defined in runc
-
 			// CRIU will issue a warning for NEWUSER:
 			// criu/namespaces.c: 'join-ns with user-namespace is not fully tested and dangerous'
 			rpcOpts.JoinNs = append(rpcOpts.JoinNs, &criurpc.JoinNamespace{
@@ -918,12 +1319,15 @@ func (c *linuxContainer) handleRestoringNamespaces(rpcOpts *criurpc.CriuOpts, ex
 	return nil
 }
 
-func (c *linuxContainer) handleRestoringExternalNamespaces(rpcOpts *criurpc.CriuOpts, extraFiles *[]*os.File, t configs.NamespaceType) error {
+func (c *linuxContainer) handleRestoringExternalNamespaces(rpcOpts *criurpc.CriuOpts, criuOpts *CriuOpts, extraFiles *[]*os.File, t configs.NamespaceType) error {
 	if !c.criuSupportsExtNS(t) {
 		return nil
 	}
 
 	nsPath := c.config.Namespaces.PathOf(t)
+	if t == configs.NEWNET && criuOpts.NetNsPath != "" {
+		nsPath = criuOpts.NetNsPath
+	}
 	if nsPath == "" {
 		return nil
 	}
@@ -950,6 +1354,10 @@ func (c *linuxContainer) handleRestoringExternalNamespaces(rpcOpts *criurpc.Criu
 }
 
 func (c *linuxContainer) Checkpoint(criuOpts *CriuOpts) error {
+	return c.CheckpointContext(context.Background(), criuOpts)
+}
+
+func (c *linuxContainer) CheckpointContext(ctx context.Context, criuOpts *CriuOpts) error {
 	c.m.Lock()
 	defer c.m.Unlock()
 
@@ -967,6 +1375,17 @@ func (c *linuxContainer) Checkpoint(criuOpts *CriuOpts) error {
 	if criuOpts.ImagesDirectory == "" {
 		return errors.New("invalid directory to save checkpoint")
 	}
+	if criuOpts.NetNsPath != "" {
+		return errors.New("a network namespace path can only be used to restore")
+	}
+	if err := c.checkCriuNetworkOpts(criuOpts); err != nil {
+		return err
+	}
+	if criuOpts.Stream != nil {
+		if err := validateCriuStream(criuOpts); err != nil {
+			return err
+		}
+	}
 
 	// Since a container can be C/R'ed multiple times,
 	// the checkpoint directory may already exist.
@@ -1015,6 +1434,11 @@ func (c *linuxContainer) Checkpoint(criuOpts *CriuOpts) error {
 	}
 
 	c.handleCriuConfigurationFile(&rpcOpts)
+	if criuOpts.Stream != nil {
+		if err := setCriuStreamMode(&rpcOpts, criuOpts.WorkDirectory); err != nil {
+			return err
+		}
+	}
 
 	// If the container is running in a network namespace and has
 	// a path to the network namespace configured, we will dump
@@ -1022,15 +1446,18 @@ func (c *linuxContainer) Checkpoint(criuOpts *CriuOpts) error {
 	// will expect that the namespace exists during restore.
 	// This basically means that CRIU will ignore the namespace
 	// and expect to be setup correctly.
-	if err := c.handleCheckpointingExternalNamespaces(&rpcOpts, configs.NEWNET); err != nil {
+	if err := c.handleCheckpointingExternalNamespaces(&rpcOpts, criuOpts, configs.NEWNET); err != nil {
 		return err
 	}
 
 	// Same for possible external PID namespaces
-	if err := c.handleCheckpointingExternalNamespaces(&rpcOpts, configs.NEWPID); err != nil {
+	if err := c.handleCheckpointingExternalNamespaces(&rpcOpts, criuOpts, configs.NEWPID); err != nil {
 		return err
 	}
 
+	criuExternalMacvlans(&rpcOpts, criuOpts)
+	rpcOpts.External = append(rpcOpts.External, criuOpts.External...)
+
 	// CRIU can use cgroup freezer; when rpcOpts.FreezeCgroup
 	// is not set, CRIU uses ptrace() to pause the processes.
 	// Note cgroup v2 freezer is only supported since CRIU release 3.14.
@@ -1053,6 +1480,12 @@ func (c *linuxContainer) Checkpoint(criuOpts *CriuOpts) error {
 		rpcOpts.ParentImg = proto.String(criuOpts.ParentImage)
 		rpcOpts.TrackMem = proto.Bool(true)
 	}
+	// The pages dirtied after a pre-dump (including the first one, which
+	// has no parent) must be tracked for the next iteration to copy only
+	// them.
+	if criuOpts.PreDump {
+		rpcOpts.TrackMem = proto.Bool(true)
+	}
 
 	// append optional manage cgroups mode
 	if criuOpts.ManageCgroupsMode != 0 {
@@ -1066,7 +1499,7 @@ func (c *linuxContainer) Checkpoint(criuOpts *CriuOpts) error {
 			MemTrack: proto.Bool(true),
 		}
 
-		if err := c.checkCriuFeatures(criuOpts, &rpcOpts, &feat); err != nil {
+		if err := c.checkCriuFeatures(ctx, criuOpts, &rpcOpts, &feat); err != nil {
 			return err
 		}
 
@@ -1080,7 +1513,7 @@ func (c *linuxContainer) Checkpoint(criuOpts *CriuOpts) error {
 		feat := criurpc.CriuFeatures{
 			LazyPages: proto.Bool(true),
 		}
-		if err := c.checkCriuFeatures(criuOpts, &rpcOpts, &feat); err != nil {
+		if err := c.checkCriuFeatures(ctx, criuOpts, &rpcOpts, &feat); err != nil {
 			return err
 		}
 
@@ -1131,6 +1564,12 @@ func (c *linuxContainer) Checkpoint(criuOpts *CriuOpts) error {
 			}
 		}
 
+		for _, dest := range sortedExternalMounts(criuOpts) {
+			if !c.hasBindMount(dest) {
+				c.addCriuDumpMount(req, &configs.Mount{Destination: dest})
+			}
+		}
+
 		if err := c.addMaskPaths(req); err != nil {
 			return err
 		}
@@ -1152,10 +1591,66 @@ func (c *linuxContainer) Checkpoint(criuOpts *CriuOpts) error {
 		}
 	}
 
-	err = c.criuSwrk(nil, req, criuOpts, nil)
+	if criuOpts.Stream != nil {
+		// The file descriptors info is not a CRIU image, so it has to be
+		// added to the stream explicitly.
+		streamer, err := startCriuStreamer("capture", criuOpts.ImagesDirectory, criuOpts.Stream, descriptorsFilename)
+		if err != nil {
+			return err
+		}
+		if err := c.criuSwrk(ctx, nil, req, criuOpts, nil); err != nil {
+			streamer.kill()
+			return err
+		}
+		if err := streamer.wait(); err != nil {
+			return err
+		}
+		return c.runCheckpointHooks(ctx, configs.PostCheckpoint, criuOpts)
+	}
+
+	err = c.criuSwrk(ctx, nil, req, criuOpts, nil)
 	if err != nil {
 		return err
 	}
+	if criuOpts.PreDump {
+		return nil
+	}
+	return c.runCheckpointHooks(ctx, configs.PostCheckpoint, criuOpts)
+}
+
+// CheckpointImagePathAnnotation is the annotation of the state passed to the
+// postCheckpoint and preRestore hooks, set to the path of the checkpoint
+// images directory.
+const CheckpointImagePathAnnotation = "org.opencontainers.runc.checkpoint.image-path"
+
+// Annotations of the spec to set the External and ExternalMounts of the
+// CriuOpts used to checkpoint and restore the container, as a JSON array of
+// strings and a JSON object mapping the destinations of the mounts to their
+// sources.
+const (
+	CheckpointExternalAnnotation       = "org.opencontainers.runc.checkpoint.external"
+	CheckpointExternalMountsAnnotation = "org.opencontainers.runc.checkpoint.external-mounts"
+)
+
+// runCheckpointHooks runs the (non-standard) postCheckpoint or preRestore
+// hooks name, with the images directory of criuOpts in the state annotations.
+func (c *linuxContainer) runCheckpointHooks(ctx context.Context, name configs.HookName, criuOpts *CriuOpts) error {
+	if len(c.config.Hooks[name]) == 0 {
+		return nil
+	}
+	s, err := c.currentOCIState()
+	if err != nil {
+		return err
+	}
+	annotations := make(map[string]string, len(s.Annotations)+1)
+	for k, v := range s.Annotations {
+		annotations[k] = v
+	}
+	annotations[CheckpointImagePathAnnotation] = criuOpts.ImagesDirectory
+	s.Annotations = annotations
+	if err := c.runHooks(ctx, name, s); err != nil {
+		return fmt.Errorf("running %s hooks: %w", name, err)
+	}
 	return nil
 }
 
@@ -1168,6 +1663,57 @@ func (c *linuxContainer) addCriuRestoreMount(req *criurpc.CriuReq, m *configs.Mo
 	req.Opts.ExtMnt = append(req.Opts.ExtMnt, extMnt)
 }
 
+// sortedExternalMounts returns the destinations of the external mounts of
+// criuOpts, sorted so that the parent mounts come first.
+func sortedExternalMounts(criuOpts *CriuOpts) []string {
+	dests := make([]string, 0, len(criuOpts.ExternalMounts))
+	for dest := range criuOpts.ExternalMounts {
+		dests = append(dests, dest)
+	}
+	sort.Strings(dests)
+	return dests
+}
+
+// hasBindMount returns whether the config of the container has a bind mount
+// to dest.
+func (c *linuxContainer) hasBindMount(dest string) bool {
+	for _, m := range c.config.Mounts {
+		if m.Device == "bind" && m.Destination == dest {
+			return true
+		}
+	}
+	return false
+}
+
+// criuRestoreMounts returns the mounts of the container to restore, with the
+// sources of the bind mounts replaced by the ones of the external mounts of
+// criuOpts, followed by the other external mounts.
+func (c *linuxContainer) criuRestoreMounts(criuOpts *CriuOpts) []*configs.Mount {
+	if len(criuOpts.ExternalMounts) == 0 {
+		return c.config.Mounts
+	}
+	mounts := make([]*configs.Mount, 0, len(c.config.Mounts)+len(criuOpts.ExternalMounts))
+	for _, m := range c.config.Mounts {
+		if source, ok := criuOpts.ExternalMounts[m.Destination]; ok && m.Device == "bind" && source != "" {
+			mm := *m
+			mm.Source = source
+			m = &mm
+		}
+		mounts = append(mounts, m)
+	}
+	for _, dest := range sortedExternalMounts(criuOpts) {
+		if source := criuOpts.ExternalMounts[dest]; source != "" && !c.hasBindMount(dest) {
+			mounts = append(mounts, &configs.Mount{
+				Source:      source,
+				Destination: dest,
+				Device:      "bind",
+				Flags:       unix.MS_BIND | unix.MS_REC,
+			})
+		}
+	}
+	return mounts
+}
+
 func (c *linuxContainer) restoreNetwork(req *criurpc.CriuReq, criuOpts *CriuOpts) {
 	for _, iface := range c.config.Networks {
 		switch iface.Type {
@@ -1299,6 +1845,10 @@ func (c *linuxContainer) prepareCriuRestoreMounts(mounts []*configs.Mount) error
 }
 
 func (c *linuxContainer) Restore(process *Process, criuOpts *CriuOpts) error {
+	return c.RestoreContext(context.Background(), process, criuOpts)
+}
+
+func (c *linuxContainer) RestoreContext(ctx context.Context, process *Process, criuOpts *CriuOpts) error {
 	c.m.Lock()
 	defer c.m.Unlock()
 
@@ -1329,11 +1879,52 @@ func (c *linuxContainer) Restore(process *Process, criuOpts *CriuOpts) error {
 	if criuOpts.ImagesDirectory == "" {
 		return errors.New("invalid directory to restore checkpoint")
 	}
+	if err := c.checkCriuNetworkOpts(criuOpts); err != nil {
+		return err
+	}
+	// Run the preRestore hooks before accessing the images, so that they
+	// can be used to fetch them.
+	if err := c.runCheckpointHooks(ctx, configs.PreRestore, criuOpts); err != nil {
+		return err
+	}
 	imageDir, err := os.Open(criuOpts.ImagesDirectory)
 	if err != nil {
 		return err
 	}
 	defer imageDir.Close()
+	var (
+		streamer      *criuStreamer
+		killLazyPages func()
+	)
+	if criuOpts.Stream != nil {
+		if err := validateCriuStream(criuOpts); err != nil {
+			return err
+		}
+		// The images (and the file descriptors info) are served from
+		// the stream.
+		streamer, err = startCriuStreamer("serve", criuOpts.ImagesDirectory, criuOpts.Stream)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if streamer != nil {
+				streamer.kill()
+			}
+		}()
+	}
+	if criuOpts.LazyPages && criuOpts.PageServer.Address != "" && criuOpts.PageServer.Port != 0 {
+		// Post-copy migration: the memory pages are fetched on demand
+		// from the page server on the source host by the lazy-pages daemon.
+		killLazyPages, err = c.startCriuLazyPages(criuOpts)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if killLazyPages != nil {
+				killLazyPages()
+			}
+		}()
+	}
 	// CRIU has a few requirements for a root directory:
 	// * it must be a mount point
 	// * its parent must not be overmounted
@@ -1378,19 +1969,27 @@ func (c *linuxContainer) Restore(process *Process, criuOpts *CriuOpts) error {
 	}
 
 	c.handleCriuConfigurationFile(req.Opts)
+	if criuOpts.Stream != nil {
+		if err := setCriuStreamMode(req.Opts, criuOpts.WorkDirectory); err != nil {
+			return err
+		}
+	}
 
-	if err := c.handleRestoringNamespaces(req.Opts, &extraFiles); err != nil {
+	if err := c.handleRestoringNamespaces(req.Opts, criuOpts, &extraFiles); err != nil {
 		return err
 	}
+	criuExternalMacvlans(req.Opts, criuOpts)
+	req.Opts.External = append(req.Opts.External, criuOpts.External...)
 
+	mounts := c.criuRestoreMounts(criuOpts)
 	// This will modify the rootfs of the container in the same way runc
 	// modifies the container during initial creation.
-	if err := c.prepareCriuRestoreMounts(c.config.Mounts); err != nil {
+	if err := c.prepareCriuRestoreMounts(mounts); err != nil {
 		return err
 	}
 
 	hasCgroupns := c.config.Namespaces.Contains(configs.NEWCGROUP)
-	for _, m := range c.config.Mounts {
+	for _, m := range mounts {
 		switch m.Device {
 		case "bind":
 			c.addCriuRestoreMount(req, m)
@@ -1448,24 +2047,33 @@ func (c *linuxContainer) Restore(process *Process, criuOpts *CriuOpts) error {
 			req.Opts.InheritFd = append(req.Opts.InheritFd, inheritFd)
 		}
 	}
-	err = c.criuSwrk(process, req, criuOpts, extraFiles)
+	err = c.criuSwrk(ctx, process, req, criuOpts, extraFiles)
 
 	// Now that CRIU is done let's close all opened FDs CRIU needed.
 	for _, fd := range extraFiles {
 		fd.Close()
 	}
 
+	if err == nil && streamer != nil {
+		err = streamer.wait()
+		streamer = nil
+	}
+	if err == nil {
+		// The lazy-pages daemon keeps serving the pages of the restored
+		// processes, until all of them are transferred.
+		killLazyPages = nil
+	}
 	return err
 }
 
-func (c *linuxContainer) criuApplyCgroups(pid int, req *criurpc.CriuReq) error {
+func (c *linuxContainer) criuApplyCgroups(ctx context.Context, pid int, req *criurpc.CriuReq) error {
 	// need to apply cgroups only on restore
 	if req.GetType() != criurpc.CriuReqType_RESTORE {
 		return nil
 	}
 
 	// XXX: Do we need to deal with this case? AFAIK criu still requires root.
-	if err := c.cgroupManager.Apply(pid); err != nil {
+	if err := c.cgroupManager.ApplyContext(ctx, pid); err != nil {
 		return err
 	}
 
@@ -1495,7 +2103,59 @@ func (c *linuxContainer) criuApplyCgroups(pid int, req *criurpc.CriuReq) error {
 	return nil
 }
 
-func (c *linuxContainer) criuSwrk(process *Process, req *criurpc.CriuReq, opts *CriuOpts, extraFiles []*os.File) error {
+// criuLazyPagesSocket is the name of the socket created by the CRIU
+// lazy-pages daemon in the work directory.
+const criuLazyPagesSocket = "lazy-pages.socket"
+
+// startCriuLazyPages starts the CRIU lazy-pages daemon, which serves page
+// faults of the restored processes by fetching the pages from the page
+// server, and waits for it to be ready. The daemon exits by itself once all
+// the pages are transferred; the returned function kills it and waits for
+// it, if the restore fails.
+func (c *linuxContainer) startCriuLazyPages(criuOpts *CriuOpts) (func(), error) {
+	socket := filepath.Join(criuOpts.WorkDirectory, criuLazyPagesSocket)
+	// A stale socket may be left over from a previous restore.
+	if err := os.Remove(socket); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	cmd := exec.Command(c.criuPath, "lazy-pages",
+		"--page-server",
+		"--address", criuOpts.PageServer.Address,
+		"--port", strconv.Itoa(int(criuOpts.PageServer.Port)),
+		"--images-dir", criuOpts.ImagesDirectory,
+		"--work-dir", criuOpts.WorkDirectory,
+		"--log-file", "lazy-pages.log",
+		"-v4")
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("starting criu lazy-pages: %w", err)
+	}
+	exited := make(chan error, 1)
+	go func() {
+		exited <- cmd.Wait()
+	}()
+	kill := func() {
+		_ = cmd.Process.Kill()
+		<-exited
+	}
+
+	const timeout = 10 * time.Second
+	for deadline := time.Now().Add(timeout); time.Now().Before(deadline); {
+		select {
+		case err := <-exited:
+			return nil, fmt.Errorf("criu lazy-pages exited prematurely (%v), see %s for details",
+				err, filepath.Join(criuOpts.WorkDirectory, "lazy-pages.log"))
+		case <-time.After(50 * time.Millisecond):
+		}
+		if _, err := os.Stat(socket); err == nil {
+			logrus.Debugf("criu lazy-pages (pid %d) is ready", cmd.Process.Pid)
+			return kill, nil
+		}
+	}
+	kill()
+	return nil, fmt.Errorf("timeout waiting for criu lazy-pages to start after %s", timeout)
+}
+
+func (c *linuxContainer) criuSwrk(ctx context.Context, process *Process, req *criurpc.CriuReq, opts *CriuOpts, extraFiles []*os.File) (retErr error) {
 	fds, err := unix.Socketpair(unix.AF_LOCAL, unix.SOCK_SEQPACKET|unix.SOCK_CLOEXEC, 0)
 	if err != nil {
 		return err
@@ -1547,6 +2207,16 @@ func (c *linuxContainer) criuSwrk(process *Process, req *criurpc.CriuReq, opts *
 	// cmd.Process will be replaced by a restored init.
 	criuProcess := cmd.Process
 
+	// Kill CRIU once ctx is done, which makes reading its responses fail.
+	defer afterDone(ctx, func() {
+		_ = criuProcess.Kill()
+	})()
+	defer func() {
+		if retErr != nil && ctx.Err() != nil {
+			retErr = fmt.Errorf("criu was killed: %w", ctx.Err())
+		}
+	}()
+
 	var criuProcessState *os.ProcessState
 	defer func() {
 		if criuProcessState == nil {
@@ -1558,7 +2228,7 @@ func (c *linuxContainer) criuSwrk(process *Process, req *criurpc.CriuReq, opts *
 		}
 	}()
 
-	if err := c.criuApplyCgroups(criuProcess.Pid, req); err != nil {
+	if err := c.criuApplyCgroups(ctx, criuProcess.Pid, req); err != nil {
 		return err
 	}
 
@@ -1638,7 +2308,7 @@ func (c *linuxContainer) criuSwrk(process *Process, req *criurpc.CriuReq, opts *
 			logrus.Debugf("Feature check says: %s", resp)
 			criuFeatures = resp.GetFeatures()
 		case t == criurpc.CriuReqType_NOTIFY:
-			if err := c.criuNotifications(resp, process, cmd, opts, extFds, oob[:oobn]); err != nil {
+			if err := c.criuNotifications(ctx, resp, process, cmd, opts, extFds, oob[:oobn]); err != nil {
 				return err
 			}
 			t = criurpc.CriuReqType_NOTIFY
@@ -1714,7 +2384,7 @@ func unlockNetwork(config *configs.Config) error {
 	return nil
 }
 
-func (c *linuxContainer) criuNotifications(resp *criurpc.CriuResp, process *Process, cmd *exec.Cmd, opts *CriuOpts, fds []string, oob []byte) error {
+func (c *linuxContainer) criuNotifications(ctx context.Context, resp *criurpc.CriuResp, process *Process, cmd *exec.Cmd, opts *CriuOpts, fds []string, oob []byte) error {
 	notify := resp.GetNotify()
 	if notify == nil {
 		return fmt.Errorf("invalid response: %s", resp.String())
@@ -1744,10 +2414,10 @@ func (c *linuxContainer) criuNotifications(resp *criurpc.CriuResp, process *Proc
 			}
 			s.Pid = int(notify.GetPid())
 
-			if err := c.config.Hooks[configs.Prestart].RunHooks(s); err != nil {
+			if err := c.runHooks(ctx, configs.Prestart, s); err != nil {
 				return err
 			}
-			if err := c.config.Hooks[configs.CreateRuntime].RunHooks(s); err != nil {
+			if err := c.runHooks(ctx, configs.CreateRuntime, s); err != nil {
 				return err
 			}
 		}
@@ -1827,30 +2497,9 @@ func (c *linuxContainer) updateState(process parentProcess) (*State, error) {
 	return state, nil
 }
 
-func (c *linuxContainer) saveState(s *State) (retErr error) {
-	tmpFile, err := ioutil.TempFile(c.root, "state-")
-	if err != nil {
-		return err
-	}
-
-	defer func() {
-		if retErr != nil {
-			tmpFile.Close()
-			os.Remove(tmpFile.Name())
-		}
-	}()
-
-	err = utils.WriteJSON(tmpFile, s)
-	if err != nil {
-		return err
-	}
-	err = tmpFile.Close()
-	if err != nil {
-		return err
-	}
-
-	stateFilePath := filepath.Join(c.root, stateFilename)
-	return os.Rename(tmpFile.Name(), stateFilePath)
+func (c *linuxContainer) saveState(s *State) error {
+	s.Version, s.CompatVersion = StateVersion, StateCompatVersion
+	return c.stateStore.Save(c.id, s)
 }
 
 func (c *linuxContainer) currentStatus() (Status, error) {
@@ -1938,6 +2587,7 @@ func (c *linuxContainer) currentState() (*State, error) {
 		IntelRdtPath:        intelRdtPath,
 		NamespacePaths:      make(map[configs.NamespaceType]string),
 		ExternalDescriptors: externalDescriptors,
+		HookResults:         c.hookResults,
 	}
 	if pid > 0 {
 		for _, ns := range c.config.Namespaces {
@@ -2027,7 +2677,7 @@ func encodeIDMapping(idMap []configs.IDMap) ([]byte, error) {
 // such as one that uses nsenter package to bootstrap the container's
 // init process correctly, i.e. with correct namespaces, uid/gid
 // mapping etc.
-func (c *linuxContainer) bootstrapData(cloneFlags uintptr, nsMaps map[configs.NamespaceType]string) (io.Reader, error) {
+func (c *linuxContainer) bootstrapData(cloneFlags uintptr, nsMaps map[configs.NamespaceType]string, oomScoreAdj *int) (io.Reader, error) {
 	// create the netlink message
 	r := nl.NewNetlinkRequest(int(InitMsg), 0)
 
@@ -2052,6 +2702,9 @@ func (c *linuxContainer) bootstrapData(cloneFlags uintptr, nsMaps map[configs.Na
 	// write namespace paths only when we are not joining an existing user ns
 	_, joinExistingUser := nsMaps[configs.NEWUSER]
 	if !joinExistingUser {
+		if err := checkIDMappings(c.config, c.newuidmapPath, c.newgidmapPath); err != nil {
+			return nil, err
+		}
 		// write uid mappings
 		if len(c.config.UidMappings) > 0 {
 			if c.config.RootlessEUID && c.newuidmapPath != "" {
@@ -2095,11 +2748,19 @@ func (c *linuxContainer) bootstrapData(cloneFlags uintptr, nsMaps map[configs.Na
 		}
 	}
 
-	if c.config.OomScoreAdj != nil {
+	if oomScoreAdj != nil {
 		// write oom_score_adj
 		r.AddData(&Bytemsg{
 			Type:  OomScoreAdjAttr,
-			Value: []byte(strconv.Itoa(*c.config.OomScoreAdj)),
+			Value: []byte(strconv.Itoa(*oomScoreAdj)),
+		})
+	}
+
+	// write the time namespace offsets
+	if len(c.config.TimeOffsets) > 0 && cloneFlags&unix.CLONE_NEWTIME != 0 {
+		r.AddData(&Bytemsg{
+			Type:  TimeOffsetsAttr,
+			Value: []byte(timeOffsets(c.config.TimeOffsets)),
 		})
 	}
 
@@ -2112,6 +2773,22 @@ func (c *linuxContainer) bootstrapData(cloneFlags uintptr, nsMaps map[configs.Na
 	return bytes.NewReader(r.Serialize()), nil
 }
 
+// timeOffsets returns the clock offsets of a time namespace in the format of
+// /proc/<pid>/timens_offsets.
+func timeOffsets(offsets map[string]configs.TimeOffset) string {
+	clocks := make([]string, 0, len(offsets))
+	for clock := range offsets {
+		clocks = append(clocks, clock)
+	}
+	sort.Strings(clocks)
+	lines := make([]string, 0, len(clocks))
+	for _, clock := range clocks {
+		o := offsets[clock]
+		lines = append(lines, fmt.Sprintf("%s %d %d", clock, o.Secs, o.Nanosecs))
+	}
+	return strings.Join(lines, "\n")
+}
+
 // ignoreTerminateErrors returns nil if the given err matches an error known
 // to indicate that the terminate occurred successfully or err was nil, otherwise
 // err is returned unaltered.
@@ -3,15 +3,22 @@
 package libcontainer
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"os"
+	"path/filepath"
+	"reflect"
 	"testing"
+	"time"
 
 	"github.com/opencontainers/runc/libcontainer/cgroups"
 	"github.com/opencontainers/runc/libcontainer/configs"
+	"github.com/opencontainers/runc/libcontainer/devices"
 	"github.com/opencontainers/runc/libcontainer/intelrdt"
 	"github.com/opencontainers/runc/libcontainer/system"
+	"golang.org/x/sys/unix"
 )
 
 type mockCgroupManager struct {
@@ -38,10 +45,18 @@ func (m *mockCgroupManager) GetStats() (*cgroups.Stats, error) {
 	return m.stats, nil
 }
 
+func (m *mockCgroupManager) GetStatsFor(_ ...string) (*cgroups.Stats, error) {
+	return m.stats, nil
+}
+
 func (m *mockCgroupManager) Apply(pid int) error {
 	return nil
 }
 
+func (m *mockCgroupManager) ApplyContext(_ context.Context, _ int) error {
+	return nil
+}
+
 func (m *mockCgroupManager) Set(_ *configs.Resources) error {
 	return nil
 }
@@ -50,6 +65,10 @@ func (m *mockCgroupManager) Destroy() error {
 	return nil
 }
 
+func (m *mockCgroupManager) DestroyContext(_ context.Context) error {
+	return nil
+}
+
 func (m *mockCgroupManager) Exists() bool {
 	_, err := os.Lstat(m.Path("devices"))
 	return err == nil
@@ -59,6 +78,14 @@ func (m *mockCgroupManager) OOMKillCount() (uint64, error) {
 	return 0, nil
 }
 
+func (m *mockCgroupManager) Reclaim(_ uint64) error {
+	return nil
+}
+
+func (m *mockCgroupManager) CanCreateEmpty() bool {
+	return false
+}
+
 func (m *mockCgroupManager) GetPaths() map[string]string {
 	return m.paths
 }
@@ -71,6 +98,10 @@ func (m *mockCgroupManager) Freeze(state configs.FreezerState) error {
 	return nil
 }
 
+func (m *mockCgroupManager) FreezeContext(_ context.Context, _ configs.FreezerState, _ *cgroups.FreezeOptions) error {
+	return nil
+}
+
 func (m *mockCgroupManager) GetCgroups() (*configs.Cgroup, error) {
 	return nil, nil
 }
@@ -120,7 +151,7 @@ func (m *mockProcess) startTime() (uint64, error) {
 	return m.started, nil
 }
 
-func (m *mockProcess) start() error {
+func (m *mockProcess) start(_ context.Context) error {
 	return nil
 }
 
@@ -346,10 +377,15 @@ func TestGetContainerStateAfterUpdate(t *testing.T) {
 		t.Fatal(err)
 	}
 	defer os.RemoveAll(rootDir)
+	containerRoot := filepath.Join(rootDir, "myid")
+	if err := os.Mkdir(containerRoot, 0o700); err != nil {
+		t.Fatal(err)
+	}
 
 	container := &linuxContainer{
-		root: rootDir,
-		id:   "myid",
+		root:       containerRoot,
+		id:         "myid",
+		stateStore: &FileStateStore{Root: rootDir},
 		config: &configs.Config{
 			Namespaces: []configs.Namespace{
 				{Type: configs.NEWPID},
@@ -401,3 +437,149 @@ func TestGetContainerStateAfterUpdate(t *testing.T) {
 		t.Fatalf("expected Memory to be 2048 but received %q", state.Config.Cgroups.Memory)
 	}
 }
+
+func TestSkipUnchangedDevices(t *testing.T) {
+	rules := []*devices.Rule{
+		{Type: devices.CharDevice, Major: 1, Minor: 3, Permissions: "rwm", Allow: true},
+	}
+	r := &configs.Resources{Devices: rules, Memory: 1024}
+	applied := copyDeviceRules(rules)
+
+	if res := skipUnchangedDevices(r, nil); res != r {
+		t.Fatal("expected device rules to be applied if the current ones are unknown")
+	}
+
+	res := skipUnchangedDevices(r, applied)
+	if !res.SkipDevices || res.Memory != 1024 {
+		t.Fatalf("expected unchanged device rules to be skipped, got %+v", res)
+	}
+	if r.SkipDevices {
+		t.Fatal("the original resources must not be modified")
+	}
+
+	// Modify the rules in place, as "runc update" does with the config.
+	rules[0].Permissions = "rw"
+	if res := skipUnchangedDevices(r, applied); res.SkipDevices {
+		t.Fatal("expected changed device rules to be applied")
+	}
+	r.Devices = nil
+	if res := skipUnchangedDevices(r, applied); res.SkipDevices {
+		t.Fatal("expected removed device rules to be applied")
+	}
+}
+
+func TestChangedRlimits(t *testing.T) {
+	old := []configs.Rlimit{
+		{Type: unix.RLIMIT_NOFILE, Soft: 1024, Hard: 1024},
+		{Type: unix.RLIMIT_NPROC, Soft: 100, Hard: 100},
+	}
+	limits := []configs.Rlimit{
+		{Type: unix.RLIMIT_NOFILE, Soft: 1024, Hard: 4096},
+		{Type: unix.RLIMIT_NPROC, Soft: 100, Hard: 100},
+		{Type: unix.RLIMIT_MEMLOCK, Soft: 65536, Hard: 65536},
+	}
+
+	changed := changedRlimits(old, limits)
+	expected := []configs.Rlimit{limits[0], limits[2]}
+	if !reflect.DeepEqual(changed, expected) {
+		t.Fatalf("expected %+v, got %+v", expected, changed)
+	}
+	if changed := changedRlimits(old, old); len(changed) != 0 {
+		t.Fatalf("expected no changed rlimits, got %+v", changed)
+	}
+}
+
+func TestSubCgroupPaths(t *testing.T) {
+	dir, err := ioutil.TempDir("", "runc-subcgroup-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	paths := map[string]string{
+		"cpu":    filepath.Join(dir, "cpu", "ct"),
+		"memory": filepath.Join(dir, "memory", "ct"),
+	}
+	subPaths, err := subCgroupPaths(paths, "monitoring")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, path := range paths {
+		expected := filepath.Join(path, "monitoring")
+		if subPaths[name] != expected {
+			t.Errorf("expected %s path %q, got %q", name, expected, subPaths[name])
+		}
+		if fi, err := os.Stat(expected); err != nil || !fi.IsDir() {
+			t.Errorf("expected %q to be created: %v", expected, err)
+		}
+	}
+
+	for _, sub := range []string{"..", "../other", "a/../../other", "/abs", "."} {
+		if _, err := subCgroupPaths(paths, sub); err == nil {
+			t.Errorf("expected an error for %q", sub)
+		}
+	}
+	if _, err := subCgroupPaths(nil, "monitoring"); err == nil {
+		t.Error("expected an error for a container without cgroups")
+	}
+}
+
+func TestCriuRestoreMounts(t *testing.T) {
+	proc := &configs.Mount{Source: "proc", Destination: "/proc", Device: "proc"}
+	sock := &configs.Mount{Source: "/run/a.sock", Destination: "/run/app.sock", Device: "bind", Flags: unix.MS_BIND}
+	container := &linuxContainer{
+		config: &configs.Config{Mounts: []*configs.Mount{proc, sock}},
+	}
+
+	mounts := container.criuRestoreMounts(&CriuOpts{})
+	if !reflect.DeepEqual(mounts, container.config.Mounts) {
+		t.Fatalf("expected the mounts of the config, got %+v", mounts)
+	}
+
+	mounts = container.criuRestoreMounts(&CriuOpts{ExternalMounts: map[string]string{
+		"/run/app.sock": "/run/b.sock",
+		"/data":         "/srv/data",
+		"/cache":        "",
+	}})
+	expected := []*configs.Mount{
+		proc,
+		{Source: "/run/b.sock", Destination: "/run/app.sock", Device: "bind", Flags: unix.MS_BIND},
+		{Source: "/srv/data", Destination: "/data", Device: "bind", Flags: unix.MS_BIND | unix.MS_REC},
+	}
+	if !reflect.DeepEqual(mounts, expected) {
+		t.Fatalf("expected mounts %+v, got %+v", expected, mounts)
+	}
+	if sock.Source != "/run/a.sock" {
+		t.Fatalf("the config was modified: %+v", sock)
+	}
+}
+
+func TestExecContextCanceled(t *testing.T) {
+	dir, err := ioutil.TempDir("", "runc-exec-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	fifo := filepath.Join(dir, execFifoFilename)
+	if err := unix.Mkfifo(fifo, 0o622); err != nil {
+		t.Fatal(err)
+	}
+	container := &linuxContainer{
+		root:        dir,
+		config:      &configs.Config{},
+		initProcess: &mockProcess{_pid: os.Getpid()},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if err := container.ExecContext(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected exec to be canceled, got %v", err)
+	}
+	// The fifo was left for runc start, and is not being opened anymore.
+	if _, err := os.Stat(fifo); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.OpenFile(fifo, os.O_WRONLY|unix.O_NONBLOCK, 0); !errors.Is(err, unix.ENXIO) {
+		t.Fatalf("expected no reader of the fifo, got %v", err)
+	}
+}
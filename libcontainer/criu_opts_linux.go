@@ -1,6 +1,10 @@
 package libcontainer
 
-import criu "github.com/checkpoint-restore/go-criu/v5/rpc"
+import (
+	"os"
+
+	criu "github.com/checkpoint-restore/go-criu/v5/rpc"
+)
 
 type CriuPageServerInfo struct {
 	Address string // IP address of CRIU page server
@@ -12,6 +16,13 @@ type VethPairName struct {
 	HostInterfaceName      string
 }
 
+// MacvlanName maps a macvlan device of the container to the host device
+// it is attached to.
+type MacvlanName struct {
+	ContainerInterfaceName string
+	HostInterfaceName      string
+}
+
 type CriuOpts struct {
 	ImagesDirectory         string             // directory for storing image files
 	WorkDirectory           string             // directory to cd and write logs/pidfiles/stats to
@@ -24,9 +35,15 @@ type CriuOpts struct {
 	PreDump                 bool               // call criu predump to perform iterative checkpoint
 	PageServer              CriuPageServerInfo // allow to dump to criu page server
 	VethPairs               []VethPairName     // pass the veth to criu when restore
+	Macvlans                []MacvlanName      // external macvlans to checkpoint and restore
+	ExternalNetNs           bool               // checkpoint the network namespace as external
+	NetNsPath               string             // restore into this existing network namespace
+	External                []string           // external resources, in the format of criu --external
+	ExternalMounts          map[string]string  // external bind mounts not in the config, or whose source changes on restore, by destination
 	ManageCgroupsMode       criu.CriuCgMode    // dump or restore cgroup mode
 	EmptyNs                 uint32             // don't c/r properties for namespace from this mask
 	AutoDedup               bool               // auto deduplication for incremental dumps
 	LazyPages               bool               // restore memory pages lazily using userfaultfd
 	StatusFd                int                // fd for feedback when lazy server is ready
+	Stream                  *os.File           // stream images to/from this file using criu-image-streamer
 }
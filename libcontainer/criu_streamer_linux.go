@@ -0,0 +1,140 @@
+// +build linux
+
+package libcontainer
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+
+	criurpc "github.com/checkpoint-restore/go-criu/v5/rpc"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/protobuf/proto"
+)
+
+// criuStreamer is a criu-image-streamer process, which either captures the
+// checkpoint images written by CRIU into a stream, or serves them to CRIU
+// from a stream, so that the images never touch the disk.
+type criuStreamer struct {
+	cmd    *exec.Cmd
+	exited chan error
+}
+
+// startCriuStreamer starts criu-image-streamer in the given mode ("capture"
+// or "serve") using imagesDir for its socket, and waits for it to be ready.
+// Files in extFiles are added to (when capturing) or extracted from (when
+// serving) the stream alongside the CRIU images.
+func startCriuStreamer(mode, imagesDir string, stream *os.File, extFiles ...string) (*criuStreamer, error) {
+	path, err := exec.LookPath("criu-image-streamer")
+	if err != nil {
+		return nil, err
+	}
+	socket := filepath.Join(imagesDir, "streamer-"+mode+".sock")
+	if err := os.Remove(socket); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	args := []string{"--images-dir", imagesDir}
+	cmd := exec.Command(path)
+	switch mode {
+	case "capture":
+		cmd.Stdout = stream
+		for _, name := range extFiles {
+			f, err := os.Open(filepath.Join(imagesDir, name))
+			if err != nil {
+				return nil, err
+			}
+			defer f.Close()
+			// ExtraFiles start at fd 3.
+			fd := 3 + len(cmd.ExtraFiles)
+			cmd.ExtraFiles = append(cmd.ExtraFiles, f)
+			args = append(args, "--ext-file-fds", fmt.Sprintf("%s:%d", name, fd))
+		}
+	case "serve":
+		cmd.Stdin = stream
+	default:
+		return nil, fmt.Errorf("invalid criu-image-streamer mode %q", mode)
+	}
+	cmd.Args = append(append(cmd.Args, args...), mode)
+	cmd.Stderr = os.Stderr
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("starting criu-image-streamer: %w", err)
+	}
+	s := &criuStreamer{
+		cmd:    cmd,
+		exited: make(chan error, 1),
+	}
+	go func() {
+		s.exited <- cmd.Wait()
+	}()
+
+	// Once the socket is created, the streamer is ready to talk to CRIU
+	// (and, when serving, has extracted the external files).
+	const timeout = 10 * time.Second
+	for deadline := time.Now().Add(timeout); time.Now().Before(deadline); {
+		select {
+		case err := <-s.exited:
+			return nil, fmt.Errorf("criu-image-streamer exited prematurely: %v", err)
+		case <-time.After(20 * time.Millisecond):
+		}
+		if _, err := os.Stat(socket); err == nil {
+			logrus.Debugf("criu-image-streamer (%s, pid %d) is ready", mode, cmd.Process.Pid)
+			return s, nil
+		}
+	}
+	s.kill()
+	return nil, fmt.Errorf("timeout waiting for criu-image-streamer to start after %s", timeout)
+}
+
+// wait waits for the streamer to finish.
+func (s *criuStreamer) wait() error {
+	if err := <-s.exited; err != nil {
+		return fmt.Errorf("criu-image-streamer: %w", err)
+	}
+	return nil
+}
+
+// kill terminates the streamer, e.g. if CRIU has failed.
+func (s *criuStreamer) kill() {
+	_ = s.cmd.Process.Kill()
+	<-s.exited
+}
+
+// validateCriuStream checks that criuOpts can be used with image streaming.
+func validateCriuStream(criuOpts *CriuOpts) error {
+	switch {
+	case criuOpts.PreDump:
+		return errors.New("image streaming can't be used with pre-dump")
+	case criuOpts.ParentImage != "":
+		return errors.New("image streaming can't be used with parent images")
+	case criuOpts.LazyPages:
+		return errors.New("image streaming can't be used with lazy pages")
+	}
+	return nil
+}
+
+// setCriuStreamMode enables the CRIU streaming mode. As it is not (yet)
+// available as an RPC option, a CRIU configuration file with the "stream"
+// option (added to the existing configuration, if any) is used.
+func setCriuStreamMode(rpcOpts *criurpc.CriuOpts, workDir string) error {
+	var conf []byte
+	if rpcOpts.ConfigFile != nil {
+		var err error
+		conf, err = ioutil.ReadFile(*rpcOpts.ConfigFile)
+		if err != nil {
+			return err
+		}
+		conf = append(conf, '\n')
+	}
+	conf = append(conf, "stream\n"...)
+	path := filepath.Join(workDir, "runc-stream.conf")
+	if err := ioutil.WriteFile(path, conf, 0600); err != nil {
+		return err
+	}
+	rpcOpts.ConfigFile = proto.String(path)
+	return nil
+}
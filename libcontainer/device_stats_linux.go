@@ -0,0 +1,93 @@
+// +build linux
+
+package libcontainer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/opencontainers/runc/libcontainer/cgroups"
+	"github.com/opencontainers/runc/libcontainer/devices"
+	"github.com/sirupsen/logrus"
+)
+
+// DeviceStatsProvider contributes the stats of devices, such as the GPUs of
+// a vendor, to the stats of the containers they are granted to.
+type DeviceStatsProvider interface {
+	// Name returns the name of the provider, e.g. "nvidia".
+	Name() string
+	// DeviceStats returns the stats of the devices it knows of among the
+	// devices of the container id, and ignores the others.
+	DeviceStats(id string, devices []*devices.Device) ([]cgroups.DeviceStats, error)
+}
+
+// deviceStatsTimeout is the time given to a CommandDeviceStatsProvider to
+// return the stats.
+const deviceStatsTimeout = 10 * time.Second
+
+// CommandDeviceStatsProvider is a DeviceStatsProvider running an external
+// program, such as one provided by a device vendor. The program is run with
+// the container id as its argument and the devices of the container as a
+// JSON array on its stdin, and writes the stats of the devices it knows of
+// as a JSON array of cgroups.DeviceStats to its stdout.
+type CommandDeviceStatsProvider struct {
+	// Path is the path of the program.
+	Path string
+}
+
+// Name returns the base name of the program.
+func (p *CommandDeviceStatsProvider) Name() string {
+	return filepath.Base(p.Path)
+}
+
+func (p *CommandDeviceStatsProvider) DeviceStats(id string, devices []*devices.Device) ([]cgroups.DeviceStats, error) {
+	in, err := json.Marshal(devices)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), deviceStatsTimeout)
+	defer cancel()
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, p.Path, id)
+	cmd.Stdin = bytes.NewReader(in)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("%w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	var stats []cgroups.DeviceStats
+	if err := json.Unmarshal(stdout.Bytes(), &stats); err != nil {
+		return nil, fmt.Errorf("invalid device stats: %w", err)
+	}
+	return stats, nil
+}
+
+// getDeviceStats returns the stats of the devices of the container given by
+// its device stats providers. The providers failing are only logged, so that
+// they don't prevent the other stats from being returned.
+func (c *linuxContainer) getDeviceStats() []cgroups.DeviceStats {
+	if len(c.deviceStats) == 0 || len(c.config.Devices) == 0 {
+		return nil
+	}
+	var all []cgroups.DeviceStats
+	for _, p := range c.deviceStats {
+		stats, err := p.DeviceStats(c.id, c.config.Devices)
+		if err != nil {
+			logrus.Warnf("getting the device stats of %s: %v", p.Name(), err)
+			continue
+		}
+		for _, s := range stats {
+			if s.Provider == "" {
+				s.Provider = p.Name()
+			}
+			all = append(all, s)
+		}
+	}
+	return all
+}
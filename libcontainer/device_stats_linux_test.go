@@ -0,0 +1,92 @@
+// +build linux
+
+package libcontainer
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/opencontainers/runc/libcontainer/cgroups"
+	"github.com/opencontainers/runc/libcontainer/configs"
+	"github.com/opencontainers/runc/libcontainer/devices"
+)
+
+type mockDeviceStatsProvider struct {
+	name  string
+	stats []cgroups.DeviceStats
+	err   error
+}
+
+func (p *mockDeviceStatsProvider) Name() string {
+	return p.name
+}
+
+func (p *mockDeviceStatsProvider) DeviceStats(id string, devices []*devices.Device) ([]cgroups.DeviceStats, error) {
+	return p.stats, p.err
+}
+
+func TestGetContainerDeviceStats(t *testing.T) {
+	gpu := cgroups.DeviceStats{Path: "/dev/gpu0", Major: 195, Minor: 0, Metrics: map[string]uint64{"memory_used_bytes": 1024}}
+	container := &linuxContainer{
+		id: "myid",
+		config: &configs.Config{
+			Devices: []*devices.Device{{Path: "/dev/gpu0", Rule: devices.Rule{Type: devices.CharDevice, Major: 195, Minor: 0}}},
+		},
+		cgroupManager: &mockCgroupManager{stats: &cgroups.Stats{}},
+		deviceStats: []DeviceStatsProvider{
+			&mockDeviceStatsProvider{name: "broken", err: errors.New("no driver")},
+			&mockDeviceStatsProvider{name: "gpu", stats: []cgroups.DeviceStats{gpu}},
+		},
+	}
+	stats, err := container.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	gpu.Provider = "gpu"
+	expected := []cgroups.DeviceStats{gpu}
+	if !reflect.DeepEqual(stats.CgroupStats.DeviceStats, expected) {
+		t.Fatalf("expected device stats %+v, got %+v", expected, stats.CgroupStats.DeviceStats)
+	}
+}
+
+func TestCommandDeviceStatsProvider(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestCommandDeviceStatsProvider")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	// The plugin reports the first device it is given, for the container
+	// given as its argument.
+	plugin := filepath.Join(dir, "vendor")
+	script := `#!/bin/sh
+path=$(grep -o '"path":"[^"]*"' | head -n 1 | cut -d '"' -f 4)
+echo "[{\"path\": \"$path\", \"major\": 1, \"minor\": 2, \"metrics\": {\"$1\": 42}}]"
+`
+	if err := ioutil.WriteFile(plugin, []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	p := &CommandDeviceStatsProvider{Path: plugin}
+	if p.Name() != "vendor" {
+		t.Fatalf("expected name vendor, got %q", p.Name())
+	}
+	stats, err := p.DeviceStats("myid", []*devices.Device{{Path: "/dev/accel0"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []cgroups.DeviceStats{{Path: "/dev/accel0", Major: 1, Minor: 2, Metrics: map[string]uint64{"myid": 42}}}
+	if !reflect.DeepEqual(stats, expected) {
+		t.Fatalf("expected device stats %+v, got %+v", expected, stats)
+	}
+
+	if err := ioutil.WriteFile(plugin, []byte("#!/bin/sh\necho oops >&2\nexit 1\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.DeviceStats("myid", nil); err == nil {
+		t.Fatal("expected an error from the failing plugin")
+	}
+}
@@ -0,0 +1,9 @@
+// +build windows
+
+package devices
+
+import "errors"
+
+func mkDev(d *Rule) (uint64, error) {
+	return 0, errors.New("cannot mkdev() device on this platform")
+}
@@ -1,6 +1,9 @@
 package libcontainer
 
-import "io"
+import (
+	"errors"
+	"io"
+)
 
 // ErrorCode is the API error code type.
 type ErrorCode int
@@ -56,7 +59,54 @@ func (c ErrorCode) String() string {
 	}
 }
 
-// Error is the API error type.
+// Sentinel errors matching (with errors.Is) the API errors of the
+// corresponding codes, so that callers can check for them without relying on
+// the error messages, e.g. errors.Is(err, libcontainer.ErrNotRunning).
+var (
+	ErrExist         = errors.New("container with given ID already exists")
+	ErrInvalidID     = errors.New("invalid container ID format")
+	ErrNotExist      = errors.New("container does not exist")
+	ErrPaused        = errors.New("container paused")
+	ErrRunning       = errors.New("container still running")
+	ErrNotRunning    = errors.New("container not running")
+	ErrNotPaused     = errors.New("container not paused")
+	ErrNoProcessOps  = errors.New("no process operations")
+	ErrConfigInvalid = errors.New("invalid configuration")
+	ErrConsoleExists = errors.New("console exists for process")
+)
+
+// sentinel returns the sentinel error of the code, or nil if there is none
+// (SystemError).
+func (c ErrorCode) sentinel() error {
+	switch c {
+	case IdInUse:
+		return ErrExist
+	case InvalidIdFormat:
+		return ErrInvalidID
+	case ContainerNotExists:
+		return ErrNotExist
+	case ContainerPaused:
+		return ErrPaused
+	case ContainerNotStopped:
+		return ErrRunning
+	case ContainerNotRunning:
+		return ErrNotRunning
+	case ContainerNotPaused:
+		return ErrNotPaused
+	case NoProcessOps:
+		return ErrNoProcessOps
+	case ConfigInvalid:
+		return ErrConfigInvalid
+	case ConsoleExists:
+		return ErrConsoleExists
+	default:
+		return nil
+	}
+}
+
+// Error is the API error type. It matches the sentinel error of its code
+// (such as ErrNotRunning for ContainerNotRunning) with errors.Is, and
+// unwraps to the underlying error, if any.
 type Error interface {
 	error
 
@@ -21,15 +21,30 @@ type Factory interface {
 	// Systemerror - System error
 	//
 	// On error, any partially created container parts are cleaned up (the operation is atomic).
-	Create(id string, config *configs.Config) (Container, error)
+	//
+	// The options override the ones of the factory for this container, e.g.
+	// WithCgroupManager or WithCriuPath. They are not saved with the state of
+	// the container, so Load must be given the same ones.
+	Create(id string, config *configs.Config, options ...func(*LinuxFactory) error) (Container, error)
 
 	// Load takes an ID for an existing container and returns the container information
 	// from the state.  This presents a read only view of the container.
 	//
+	// The options override the ones of the factory for this container, as
+	// for Create.
+	//
 	// errors:
 	// Path does not exist
 	// System error
-	Load(id string) (Container, error)
+	Load(id string, options ...func(*LinuxFactory) error) (Container, error)
+
+	// List returns the containers for which filter returns true, or all of
+	// them if filter is nil, sorted by ID. The containers which can't be
+	// loaded (such as the ones being created or destroyed) are skipped.
+	//
+	// errors:
+	// System error
+	List(filter func(Container) bool) ([]Container, error)
 
 	// StartInitialization is an internal API to libcontainer used during the reexec of the
 	// container.
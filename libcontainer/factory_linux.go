@@ -3,8 +3,8 @@
 package libcontainer
 
 import (
-	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 	"regexp"
@@ -21,7 +21,9 @@ import (
 	"github.com/opencontainers/runc/libcontainer/configs/validate"
 	"github.com/opencontainers/runc/libcontainer/intelrdt"
 	"github.com/opencontainers/runc/libcontainer/utils"
+	"github.com/opencontainers/selinux/go-selinux"
 	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
 
 	"golang.org/x/sys/unix"
 )
@@ -70,6 +72,7 @@ func getUnifiedPath(paths map[string]string) string {
 }
 
 func systemdCgroupV2(l *LinuxFactory, rootless bool) error {
+	l.systemdCgroups = true
 	l.NewCgroupsManager = func(config *configs.Cgroup, paths map[string]string) cgroups.Manager {
 		return systemd.NewUnifiedManager(config, getUnifiedPath(paths), rootless)
 	}
@@ -77,16 +80,23 @@ func systemdCgroupV2(l *LinuxFactory, rootless bool) error {
 }
 
 // SystemdCgroups is an options func to configure a LinuxFactory to return
-// containers that use systemd to create and manage cgroups.
+// containers that use systemd to create and manage cgroups. If not running
+// as root, the systemd user instance is used (see RootlessSystemdCgroups).
 func SystemdCgroups(l *LinuxFactory) error {
 	if !systemd.IsRunningSystemd() {
 		return fmt.Errorf("systemd not running on this host, can't use systemd as cgroups manager")
 	}
 
+	// The system instance of systemd can't be used by unprivileged users.
+	if os.Geteuid() != 0 {
+		return RootlessSystemdCgroups(l)
+	}
+
 	if cgroups.IsCgroup2UnifiedMode() {
 		return systemdCgroupV2(l, false)
 	}
 
+	l.systemdCgroups = true
 	l.NewCgroupsManager = func(config *configs.Cgroup, paths map[string]string) cgroups.Manager {
 		return systemd.NewLegacyManager(config, paths)
 	}
@@ -118,6 +128,7 @@ func cgroupfs2(l *LinuxFactory, rootless bool) error {
 }
 
 func cgroupfs(l *LinuxFactory, rootless bool) error {
+	l.systemdCgroups = false
 	if cgroups.IsCgroup2UnifiedMode() {
 		return cgroupfs2(l, rootless)
 	}
@@ -144,11 +155,46 @@ func RootlessCgroupfs(l *LinuxFactory) error {
 	return cgroupfs(l, true)
 }
 
+// WithRootlessCgroups is an options func to configure a LinuxFactory to
+// return containers that use the rootless version of the cgroup manager set
+// by a previous option, Cgroupfs (the default) or SystemdCgroups.
+func WithRootlessCgroups(l *LinuxFactory) error {
+	if l.systemdCgroups {
+		return RootlessSystemdCgroups(l)
+	}
+	return RootlessCgroupfs(l)
+}
+
+// WithCgroupManager returns an options func to configure a LinuxFactory to
+// return containers that use the cgroup managers returned by newManager,
+// which is given the cgroup config of the container and, when a container is
+// loaded, the paths of its cgroups.
+func WithCgroupManager(newManager func(config *configs.Cgroup, paths map[string]string) cgroups.Manager) func(*LinuxFactory) error {
+	return func(l *LinuxFactory) error {
+		if newManager == nil {
+			return errors.New("nil cgroup manager constructor")
+		}
+		l.systemdCgroups = false
+		l.NewCgroupsManager = newManager
+		return nil
+	}
+}
+
+// WithIntelRdt returns an options func to configure a LinuxFactory to return
+// containers that use the Intel RDT managers returned by newManager, or none
+// if it is nil (see IntelRdtFs for the default one).
+func WithIntelRdt(newManager func(config *configs.Config, id string, path string) intelrdt.Manager) func(*LinuxFactory) error {
+	return func(l *LinuxFactory) error {
+		l.NewIntelRdtManager = newManager
+		return nil
+	}
+}
+
 // IntelRdtfs is an options func to configure a LinuxFactory to return
 // containers that use the Intel RDT "resource control" filesystem to
 // create and manage Intel RDT resources (e.g., L3 cache, memory bandwidth).
 func IntelRdtFs(l *LinuxFactory) error {
-	if !intelrdt.IsCATEnabled() && !intelrdt.IsMBAEnabled() {
+	if !intelrdt.IsCATEnabled() && !intelrdt.IsL2CATEnabled() && !intelrdt.IsMBAEnabled() && !intelrdt.IsCMTEnabled() && !intelrdt.IsMBMEnabled() {
 		l.NewIntelRdtManager = nil
 	} else {
 		l.NewIntelRdtManager = func(config *configs.Config, id string, path string) intelrdt.Manager {
@@ -172,15 +218,50 @@ func TmpfsRoot(l *LinuxFactory) error {
 	return nil
 }
 
-// CriuPath returns an option func to configure a LinuxFactory with the
-// provided criupath
-func CriuPath(criupath string) func(*LinuxFactory) error {
+// SELinuxMCS is an options func to configure a LinuxFactory to allocate a
+// unique SELinux MCS level (pair of categories) to each container created
+// without a process label, as container-selinux does for container engines.
+func SELinuxMCS(l *LinuxFactory) error {
+	l.SELinuxMCS = true
+	return nil
+}
+
+// WithStateStore returns an option func to configure a LinuxFactory to
+// persist the states of the containers with the given StateStore.
+func WithStateStore(s StateStore) func(*LinuxFactory) error {
+	return func(l *LinuxFactory) error {
+		l.StateStore = s
+		return nil
+	}
+}
+
+// WithDeviceStatsProviders returns an option func to configure a LinuxFactory
+// to add the stats of the devices of the containers given by the providers
+// to their stats.
+func WithDeviceStatsProviders(providers ...DeviceStatsProvider) func(*LinuxFactory) error {
+	return func(l *LinuxFactory) error {
+		l.DeviceStatsProviders = append(l.DeviceStatsProviders, providers...)
+		return nil
+	}
+}
+
+// WithCriuPath returns an option func to configure a LinuxFactory to return
+// containers checkpointed and restored with the criu binary at path.
+func WithCriuPath(path string) func(*LinuxFactory) error {
 	return func(l *LinuxFactory) error {
-		l.CriuPath = criupath
+		l.CriuPath = path
 		return nil
 	}
 }
 
+// CriuPath returns an option func to configure a LinuxFactory with the
+// provided criupath
+//
+// Deprecated: use WithCriuPath.
+func CriuPath(criupath string) func(*LinuxFactory) error {
+	return WithCriuPath(criupath)
+}
+
 // New returns a linux based container factory based in the root directory and
 // configures the factory with the provided option funcs.
 func New(root string, options ...func(*LinuxFactory) error) (Factory, error) {
@@ -190,11 +271,12 @@ func New(root string, options ...func(*LinuxFactory) error) (Factory, error) {
 		}
 	}
 	l := &LinuxFactory{
-		Root:      root,
-		InitPath:  "/proc/self/exe",
-		InitArgs:  []string{os.Args[0], "init"},
-		Validator: validate.New(),
-		CriuPath:  "criu",
+		Root:       root,
+		InitPath:   "/proc/self/exe",
+		InitArgs:   []string{os.Args[0], "init"},
+		Validator:  validate.New(),
+		CriuPath:   "criu",
+		StateStore: &FileStateStore{Root: root},
 	}
 
 	if err := Cgroupfs(l); err != nil {
@@ -242,15 +324,60 @@ type LinuxFactory struct {
 
 	// NewIntelRdtManager returns an initialized Intel RDT manager for a single container.
 	NewIntelRdtManager func(config *configs.Config, id string, path string) intelrdt.Manager
+
+	// SELinuxMCS allocates unique SELinux labels to containers created
+	// without a process label.
+	SELinuxMCS bool
+
+	// StateStore persists the states of the containers.
+	StateStore StateStore
+
+	// DeviceStatsProviders contribute the stats of the devices of the
+	// containers to their stats.
+	DeviceStatsProviders []DeviceStatsProvider
+
+	// systemdCgroups is whether NewCgroupsManager returns the systemd
+	// cgroup managers, for WithRootlessCgroups.
+	systemdCgroups bool
+}
+
+// withOptions returns a copy of the factory configured with the provided
+// option funcs, or the factory itself if there are none.
+func (l *LinuxFactory) withOptions(options []func(*LinuxFactory) error) (*LinuxFactory, error) {
+	if len(options) == 0 {
+		return l, nil
+	}
+	f := *l
+	// Don't let the options append to the slices of the factory.
+	f.InitArgs = f.InitArgs[:len(f.InitArgs):len(f.InitArgs)]
+	f.DeviceStatsProviders = f.DeviceStatsProviders[:len(f.DeviceStatsProviders):len(f.DeviceStatsProviders)]
+	for _, opt := range options {
+		if opt == nil {
+			continue
+		}
+		if err := opt(&f); err != nil {
+			return nil, newGenericError(err, ConfigInvalid)
+		}
+	}
+	return &f, nil
 }
 
-func (l *LinuxFactory) Create(id string, config *configs.Config) (Container, error) {
+func (l *LinuxFactory) Create(id string, config *configs.Config, options ...func(*LinuxFactory) error) (Container, error) {
+	l, err := l.withOptions(options)
+	if err != nil {
+		return nil, err
+	}
 	if l.Root == "" {
 		return nil, newGenericError(fmt.Errorf("invalid root"), ConfigInvalid)
 	}
 	if err := l.validateID(id); err != nil {
 		return nil, err
 	}
+	if l.SELinuxMCS && config.ProcessLabel == "" {
+		if err := l.allocateLabels(config); err != nil {
+			return nil, newGenericError(err, SystemError)
+		}
+	}
 	if err := l.Validator.Validate(config); err != nil {
 		return nil, newGenericError(err, ConfigInvalid)
 	}
@@ -279,15 +406,23 @@ func (l *LinuxFactory) Create(id string, config *configs.Config) (Container, err
 		newuidmapPath: l.NewuidmapPath,
 		newgidmapPath: l.NewgidmapPath,
 		cgroupManager: l.NewCgroupsManager(config.Cgroups, nil),
+		stateStore:    l.StateStore,
+		deviceStats:   l.DeviceStatsProviders,
 	}
 	if l.NewIntelRdtManager != nil {
 		c.intelRdtManager = l.NewIntelRdtManager(config, id, "")
 	}
+	c.deviceRules = appliedDeviceRules(config)
+	c.netBandwidth = netBandwidthLimit(config.Networks)
 	c.state = &stoppedState{c: c}
 	return c, nil
 }
 
-func (l *LinuxFactory) Load(id string) (Container, error) {
+func (l *LinuxFactory) Load(id string, options ...func(*LinuxFactory) error) (Container, error) {
+	l, err := l.withOptions(options)
+	if err != nil {
+		return nil, err
+	}
 	if l.Root == "" {
 		return nil, newGenericError(fmt.Errorf("invalid root"), ConfigInvalid)
 	}
@@ -299,7 +434,7 @@ func (l *LinuxFactory) Load(id string) (Container, error) {
 	if err != nil {
 		return nil, err
 	}
-	state, err := l.loadState(containerRoot, id)
+	state, err := l.loadState(id)
 	if err != nil {
 		return nil, err
 	}
@@ -321,10 +456,15 @@ func (l *LinuxFactory) Load(id string) (Container, error) {
 		cgroupManager:        l.NewCgroupsManager(state.Config.Cgroups, state.CgroupPaths),
 		root:                 containerRoot,
 		created:              state.Created,
+		hookResults:          state.HookResults,
+		stateStore:           l.StateStore,
+		deviceStats:          l.DeviceStatsProviders,
 	}
 	if l.NewIntelRdtManager != nil {
 		c.intelRdtManager = l.NewIntelRdtManager(&state.Config, id, state.IntelRdtPath)
 	}
+	c.deviceRules = appliedDeviceRules(&state.Config)
+	c.netBandwidth = netBandwidthLimit(state.Config.Networks)
 	c.state = &loadedState{c: c}
 	if err := c.refreshState(); err != nil {
 		return nil, err
@@ -332,6 +472,31 @@ func (l *LinuxFactory) Load(id string) (Container, error) {
 	return c, nil
 }
 
+func (l *LinuxFactory) List(filter func(Container) bool) ([]Container, error) {
+	if l.Root == "" {
+		return nil, newGenericError(fmt.Errorf("invalid root"), ConfigInvalid)
+	}
+	dirs, err := ioutil.ReadDir(l.Root)
+	if err != nil {
+		return nil, newGenericError(err, SystemError)
+	}
+	var containers []Container
+	for _, d := range dirs {
+		if !d.IsDir() {
+			continue
+		}
+		c, err := l.Load(d.Name())
+		if err != nil {
+			logrus.Warnf("unable to load container %s: %v", d.Name(), err)
+			continue
+		}
+		if filter == nil || filter(c) {
+			containers = append(containers, c)
+		}
+	}
+	return containers, nil
+}
+
 func (l *LinuxFactory) Type() string {
 	return "libcontainer"
 }
@@ -406,26 +571,59 @@ func (l *LinuxFactory) StartInitialization() (err error) {
 	return i.Init()
 }
 
-func (l *LinuxFactory) loadState(root, id string) (*State, error) {
-	stateFilePath, err := securejoin.SecureJoin(root, stateFilename)
-	if err != nil {
-		return nil, err
-	}
-	f, err := os.Open(stateFilePath)
+func (l *LinuxFactory) loadState(id string) (*State, error) {
+	state, err := l.StateStore.Load(id)
 	if err != nil {
-		if os.IsNotExist(err) {
+		if errors.Is(err, os.ErrNotExist) {
 			return nil, newGenericError(fmt.Errorf("container %q does not exist", id), ContainerNotExists)
 		}
 		return nil, newGenericError(err, SystemError)
 	}
-	defer f.Close()
-	var state *State
-	if err := json.NewDecoder(f).Decode(&state); err != nil {
-		return nil, newGenericError(err, SystemError)
+	if err := migrateState(state); err != nil {
+		return nil, newGenericError(fmt.Errorf("container %q: %w", id, err), SystemError)
 	}
 	return state, nil
 }
 
+// allocateLabels sets the process and mount labels of config to the default
+// SELinux container labels, with an MCS level which is not used by any other
+// container of the factory.
+func (l *LinuxFactory) allocateLabels(config *configs.Config) error {
+	if !selinux.GetEnabled() {
+		return nil
+	}
+	// The allocated levels are only tracked in memory, so the ones of the
+	// existing containers have to be reserved first.
+	dirs, err := ioutil.ReadDir(l.Root)
+	if err != nil {
+		return err
+	}
+	for _, d := range dirs {
+		if !d.IsDir() {
+			continue
+		}
+		state, err := l.loadState(d.Name())
+		if err != nil {
+			// The container is being created or destroyed.
+			continue
+		}
+		selinux.ReserveLabel(state.Config.ProcessLabel)
+	}
+
+	processLabel, mountLabel := selinux.ContainerLabels()
+	if processLabel == "" {
+		// There are no container labels in the policy.
+		return nil
+	}
+	config.ProcessLabel = processLabel
+	if config.MountLabel == "" {
+		config.MountLabel = mountLabel
+		return nil
+	}
+	config.MountLabel, err = selinux.CopyLevel(processLabel, config.MountLabel)
+	return err
+}
+
 func (l *LinuxFactory) validateID(id string) error {
 	if !idRegex.MatchString(id) || string(os.PathSeparator)+id != utils.CleanPath(string(os.PathSeparator)+id) {
 		return newGenericError(fmt.Errorf("invalid id format: %v", id), InvalidIdFormat)
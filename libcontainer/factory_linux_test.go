@@ -10,9 +10,12 @@ import (
 	"testing"
 
 	"github.com/moby/sys/mountinfo"
+	"github.com/opencontainers/runc/libcontainer/cgroups"
+	"github.com/opencontainers/runc/libcontainer/cgroups/systemd"
 	"github.com/opencontainers/runc/libcontainer/configs"
 	"github.com/opencontainers/runc/libcontainer/utils"
 	"github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/opencontainers/selinux/go-selinux"
 
 	"golang.org/x/sys/unix"
 )
@@ -51,6 +54,47 @@ func TestFactoryNew(t *testing.T) {
 	}
 }
 
+func TestFactoryCgroupManagerCanCreateEmpty(t *testing.T) {
+	root, rerr := newTestRoot()
+	if rerr != nil {
+		t.Fatal(rerr)
+	}
+	defer os.RemoveAll(root)
+
+	for _, tc := range []struct {
+		name    string
+		option  func(*LinuxFactory) error
+		systemd bool
+	}{
+		{name: "cgroupfs", option: Cgroupfs},
+		{name: "systemd", option: SystemdCgroups, systemd: true},
+	} {
+		if tc.systemd && !systemd.IsRunningSystemd() {
+			t.Logf("%s: systemd is not running", tc.name)
+			continue
+		}
+		factory, err := New(root, tc.option)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		// The config only tells the systemd cgroup manager is used when
+		// created by specconv, which is not the case here.
+		config := &configs.Cgroup{
+			Name:      "runc-test",
+			Parent:    "system.slice",
+			Resources: &configs.Resources{},
+		}
+		if tc.systemd {
+			config.ScopePrefix = "runc"
+		}
+		m := factory.(*LinuxFactory).NewCgroupsManager(config, nil)
+		// systemd can't create a scope with no processes in it.
+		if m.CanCreateEmpty() == tc.systemd {
+			t.Errorf("%s: expected CanCreateEmpty to be %v", tc.name, !tc.systemd)
+		}
+	}
+}
+
 func TestFactoryNewIntelRdt(t *testing.T) {
 	root, rerr := newTestRoot()
 	if rerr != nil {
@@ -77,6 +121,45 @@ func TestFactoryNewIntelRdt(t *testing.T) {
 	}
 }
 
+func TestFactoryCreateWithOptions(t *testing.T) {
+	root, err := newTestRoot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	factory, err := New(root, Cgroupfs, CriuPath("criu"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	manager := &mockCgroupManager{}
+	config := &configs.Config{Rootfs: "/var", Cgroups: &configs.Cgroup{Resources: &configs.Resources{}}}
+	container, err := factory.Create("test", config,
+		WithCriuPath("/opt/criu/criu"),
+		WithCgroupManager(func(*configs.Cgroup, map[string]string) cgroups.Manager { return manager }),
+		WithIntelRdt(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := container.(*linuxContainer)
+	if c.criuPath != "/opt/criu/criu" {
+		t.Errorf("expected the criu path of the options, got %q", c.criuPath)
+	}
+	if c.cgroupManager != manager {
+		t.Errorf("expected the cgroup manager of the options, got %T", c.cgroupManager)
+	}
+	if c.intelRdtManager != nil {
+		t.Errorf("expected no Intel RDT manager, got %T", c.intelRdtManager)
+	}
+	// The factory itself is unchanged.
+	if lfactory := factory.(*LinuxFactory); lfactory.CriuPath != "criu" {
+		t.Errorf("expected the criu path of the factory to be unchanged, got %q", lfactory.CriuPath)
+	}
+
+	if _, err := factory.Create("test2", config, WithCgroupManager(nil)); err == nil {
+		t.Error("expected an error with a nil cgroup manager")
+	}
+}
+
 func TestFactoryNewTmpfs(t *testing.T) {
 	root, rerr := newTestRoot()
 	if rerr != nil {
@@ -217,6 +300,115 @@ func TestFactoryLoadContainer(t *testing.T) {
 	}
 }
 
+func TestFactoryList(t *testing.T) {
+	root, err := newTestRoot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root) //nolint: errcheck
+	for _, id := range []string{"2", "1", "3"} {
+		state := &State{
+			BaseState: BaseState{
+				ID:     id,
+				Config: configs.Config{Rootfs: "/" + id},
+			},
+		}
+		if err := os.Mkdir(filepath.Join(root, id), 0o700); err != nil {
+			t.Fatal(err)
+		}
+		if err := marshal(filepath.Join(root, id, stateFilename), state); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// A container being created, without a state yet.
+	if err := os.Mkdir(filepath.Join(root, "4"), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	factory, err := New(root, Cgroupfs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	containers, err := factory.List(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for _, c := range containers {
+		ids = append(ids, c.ID())
+	}
+	if !reflect.DeepEqual(ids, []string{"1", "2", "3"}) {
+		t.Fatalf("expected containers 1, 2 and 3, got %v", ids)
+	}
+
+	containers, err = factory.List(func(c Container) bool {
+		return c.Config().Rootfs != "/2"
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(containers) != 2 || containers[0].ID() != "1" || containers[1].ID() != "3" {
+		t.Fatalf("expected containers 1 and 3, got %v", containers)
+	}
+}
+
+func TestFactorySELinuxMCS(t *testing.T) {
+	root, err := newTestRoot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root) //nolint: errcheck
+	factory, err := New(root, Cgroupfs, SELinuxMCS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lfactory := factory.(*LinuxFactory)
+	if !lfactory.SELinuxMCS {
+		t.Fatal("expected SELinux MCS allocation to be enabled")
+	}
+
+	// An existing container, the level of which must not be allocated again.
+	existing := &State{
+		BaseState: BaseState{
+			Config: configs.Config{ProcessLabel: "system_u:system_r:container_t:s0:c1,c2"},
+		},
+	}
+	if err := os.Mkdir(filepath.Join(root, "1"), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	if err := marshal(filepath.Join(root, "1", stateFilename), existing); err != nil {
+		t.Fatal(err)
+	}
+
+	config := &configs.Config{}
+	if err := lfactory.allocateLabels(config); err != nil {
+		t.Fatal(err)
+	}
+	if !selinux.GetEnabled() {
+		if config.ProcessLabel != "" || config.MountLabel != "" {
+			t.Fatalf("expected no labels without SELinux, got %q and %q", config.ProcessLabel, config.MountLabel)
+		}
+		return
+	}
+	if config.ProcessLabel == "" {
+		t.Skip("Test requires SELinux container labels.")
+	}
+	pcon, err := selinux.NewContext(config.ProcessLabel)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mcon, err := selinux.NewContext(config.MountLabel)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pcon["level"] != mcon["level"] {
+		t.Errorf("expected the same level for the process and mount labels, got %q and %q", config.ProcessLabel, config.MountLabel)
+	}
+	if pcon["level"] == "s0:c1,c2" {
+		t.Errorf("expected a level different from the existing container's one, got %q", pcon["level"])
+	}
+}
+
 func marshal(path string, v interface{}) error {
 	f, err := os.Create(path)
 	if err != nil {
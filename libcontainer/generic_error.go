@@ -83,6 +83,17 @@ func (e *genericError) Error() string {
 	return fmt.Sprintf("%s:%d: %s caused: %s", frame.File, frame.Line, e.Cause, e.Message)
 }
 
+// Unwrap returns the underlying error.
+func (e *genericError) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether target is the sentinel error of the code of e.
+func (e *genericError) Is(target error) bool {
+	s := e.ECode.sentinel()
+	return s != nil && target == s
+}
+
 func (e *genericError) Code() ErrorCode {
 	return e.ECode
 }
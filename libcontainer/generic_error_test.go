@@ -1,9 +1,12 @@
 package libcontainer
 
 import (
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"testing"
+
+	"golang.org/x/sys/unix"
 )
 
 func TestErrorDetail(t *testing.T) {
@@ -20,6 +23,30 @@ func TestErrorWithCode(t *testing.T) {
 	}
 }
 
+func TestErrorIs(t *testing.T) {
+	err := newGenericError(errors.New("container not running"), ContainerNotRunning)
+	if !errors.Is(err, ErrNotRunning) {
+		t.Errorf("expected %v to match ErrNotRunning", err)
+	}
+	if !errors.Is(fmt.Errorf("unable to exec: %w", err), ErrNotRunning) {
+		t.Errorf("expected the wrapped %v to match ErrNotRunning", err)
+	}
+	if errors.Is(err, ErrPaused) {
+		t.Errorf("expected %v not to match ErrPaused", err)
+	}
+
+	// System errors match no sentinel error, but their underlying error.
+	err = newSystemErrorWithCause(unix.EPERM, "setting up the container")
+	for _, sentinel := range []error{ErrExist, ErrNotExist, ErrRunning, ErrNotRunning} {
+		if errors.Is(err, sentinel) {
+			t.Errorf("expected %v not to match %v", err, sentinel)
+		}
+	}
+	if !errors.Is(err, unix.EPERM) {
+		t.Errorf("expected %v to match EPERM", err)
+	}
+}
+
 func TestErrorWithError(t *testing.T) {
 	cc := []struct {
 		errmsg string
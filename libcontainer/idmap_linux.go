@@ -0,0 +1,170 @@
+// +build linux
+
+package libcontainer
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+
+	"github.com/opencontainers/runc/libcontainer/configs"
+	"github.com/opencontainers/runc/libcontainer/system"
+	"github.com/opencontainers/runc/libcontainer/utils"
+	"golang.org/x/sys/unix"
+)
+
+// idmapSource is the source of an idmapped mount. An idmapped mount can only
+// be created by a process privileged in the user namespace which owns the
+// source mount, so it is prepared by the parent (runc create) and passed to
+// container init as a detached mount, to be moved to its place.
+type idmapSource struct {
+	path      string
+	mapping   *configs.MountIDMapping
+	recursive bool
+	// mount is nil for the container root filesystem.
+	mount *configs.Mount
+}
+
+// idmapSources returns the sources of all idmapped mounts in config, in the
+// order they are sent from the parent to container init.
+func idmapSources(config *configs.Config) []idmapSource {
+	var srcs []idmapSource
+	if config.RootfsIDMapping != nil {
+		srcs = append(srcs, idmapSource{
+			path:      config.Rootfs,
+			mapping:   config.RootfsIDMapping,
+			recursive: true,
+		})
+	}
+	for _, m := range config.Mounts {
+		if m.IsIDMapped() {
+			srcs = append(srcs, idmapSource{
+				path:      m.Source,
+				mapping:   m.IDMapping,
+				recursive: m.Flags&unix.MS_REC != 0,
+				mount:     m,
+			})
+		}
+	}
+	return srcs
+}
+
+// openIDMappedMount creates a detached idmapped mount of src, using either
+// the mappings of the user namespace of pid, or the ones from src.mapping
+// if set.
+func openIDMappedMount(src idmapSource, pid int) (_ *os.File, Err error) {
+	usernsPath := fmt.Sprintf("/proc/%d/ns/user", pid)
+	if len(src.mapping.UIDMappings) != 0 {
+		proc, err := startUsernsProcess(src.mapping)
+		if err != nil {
+			return nil, fmt.Errorf("creating user namespace for idmapped mount: %w", err)
+		}
+		defer func() {
+			_ = proc.Kill()
+			_, _ = proc.Wait()
+		}()
+		usernsPath = fmt.Sprintf("/proc/%d/ns/user", proc.Pid)
+	}
+	usernsFd, err := unix.Open(usernsPath, unix.O_RDONLY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, &os.PathError{Op: "open", Path: usernsPath, Err: err}
+	}
+	defer unix.Close(usernsFd) //nolint: errcheck
+
+	flags := uint(system.OPEN_TREE_CLONE | system.OPEN_TREE_CLOEXEC)
+	attrFlags := uint(unix.AT_EMPTY_PATH)
+	if src.recursive {
+		flags |= system.AT_RECURSIVE
+		attrFlags |= system.AT_RECURSIVE
+	}
+	fd, err := system.OpenTree(unix.AT_FDCWD, src.path, flags)
+	if err != nil {
+		return nil, err
+	}
+	mnt := os.NewFile(uintptr(fd), src.path)
+	defer func() {
+		if Err != nil {
+			mnt.Close()
+		}
+	}()
+	attr := &system.MountAttr{
+		AttrSet:  system.MOUNT_ATTR_IDMAP,
+		UsernsFd: uint64(usernsFd),
+	}
+	if err := system.MountSetattr(fd, "", attrFlags, attr); err != nil {
+		return nil, err
+	}
+	return mnt, nil
+}
+
+// startUsernsProcess starts a process in a new user namespace with the
+// given mappings. The process is stopped before it runs any code (as it is
+// traced), and its only use is to provide the user namespace.
+func startUsernsProcess(m *configs.MountIDMapping) (*os.Process, error) {
+	return os.StartProcess("/proc/self/exe", []string{"runc:[IDMAP]"}, &os.ProcAttr{
+		Sys: &syscall.SysProcAttr{
+			Cloneflags:  unix.CLONE_NEWUSER,
+			UidMappings: toSysProcIDMap(m.UIDMappings),
+			GidMappings: toSysProcIDMap(m.GIDMappings),
+			Ptrace:      true,
+		},
+	})
+}
+
+func toSysProcIDMap(idmap []configs.IDMap) []syscall.SysProcIDMap {
+	res := make([]syscall.SysProcIDMap, 0, len(idmap))
+	for _, m := range idmap {
+		res = append(res, syscall.SysProcIDMap{
+			ContainerID: m.ContainerID,
+			HostID:      m.HostID,
+			Size:        m.Size,
+		})
+	}
+	return res
+}
+
+// sendIDMappedMounts creates all idmapped mounts for the container with
+// init pid, and sends them over the pipe.
+func sendIDMappedMounts(pipe *os.File, config *configs.Config, pid int) error {
+	for _, src := range idmapSources(config) {
+		mnt, err := openIDMappedMount(src, pid)
+		if err != nil {
+			return fmt.Errorf("creating idmapped mount of %q: %w", src.path, err)
+		}
+		err = utils.SendFd(pipe, mnt.Name(), mnt.Fd())
+		mnt.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// recvIDMappedMounts requests the idmapped mounts from the parent and
+// receives them. The returned files are in the same order as idmapSources.
+func recvIDMappedMounts(pipe *os.File, config *configs.Config) ([]*os.File, error) {
+	srcs := idmapSources(config)
+	if len(srcs) == 0 {
+		return nil, nil
+	}
+	if err := writeSync(pipe, procIDMappedMounts); err != nil {
+		return nil, err
+	}
+	files := make([]*os.File, 0, len(srcs))
+	for range srcs {
+		f, err := utils.RecvFd(pipe)
+		if err != nil {
+			for _, f := range files {
+				f.Close()
+			}
+			return nil, fmt.Errorf("receiving idmapped mount: %w", err)
+		}
+		files = append(files, f)
+	}
+	return files, nil
+}
+
+// moveMount moves a detached mount to dest.
+func moveMount(mnt *os.File, dest string) error {
+	return system.MoveMount(int(mnt.Fd()), "", unix.AT_FDCWD, dest, system.MOVE_MOUNT_F_EMPTY_PATH)
+}
@@ -10,13 +10,16 @@ import (
 	"io/ioutil"
 	"net"
 	"os"
+	"strconv"
 	"strings"
 	"unsafe"
 
 	"github.com/containerd/console"
 	"github.com/opencontainers/runc/libcontainer/capabilities"
 	"github.com/opencontainers/runc/libcontainer/cgroups"
+	"github.com/opencontainers/runc/libcontainer/cgroups/fscommon"
 	"github.com/opencontainers/runc/libcontainer/configs"
+	"github.com/opencontainers/runc/libcontainer/seccomp"
 	"github.com/opencontainers/runc/libcontainer/system"
 	"github.com/opencontainers/runc/libcontainer/user"
 	"github.com/opencontainers/runc/libcontainer/utils"
@@ -46,6 +49,10 @@ type network struct {
 	// TempVethPeerName is a unique temporary veth peer name that was placed into
 	// the container's namespace.
 	TempVethPeerName string `json:"temp_veth_peer_name"`
+
+	// stateDir is the state directory of the container, where the
+	// networking helpers keep their files.
+	stateDir string
 }
 
 // initConfig is used for transferring parameters from Exec() to Init()
@@ -64,6 +71,7 @@ type initConfig struct {
 	PassedFilesCount int                   `json:"passed_files_count"`
 	ContainerId      string                `json:"containerid"`
 	Rlimits          []configs.Rlimit      `json:"rlimits"`
+	IOPriority       *configs.IOPriority   `json:"io_priority,omitempty"`
 	CreateConsole    bool                  `json:"create_console"`
 	ConsoleWidth     uint16                `json:"console_width"`
 	ConsoleHeight    uint16                `json:"console_height"`
@@ -85,6 +93,9 @@ func newContainerInit(t initType, pipe *os.File, consoleSocket *os.File, fifoFd,
 	if err := populateProcessEnvironment(config.Env); err != nil {
 		return nil, err
 	}
+	if err := setListenPid(); err != nil {
+		return nil, err
+	}
 	switch t {
 	case initSetns:
 		return &linuxSetnsInit{
@@ -121,6 +132,16 @@ func populateProcessEnvironment(env []string) error {
 	return nil
 }
 
+// setListenPid sets $LISTEN_PID, for the socket activation protocol, to the
+// pid of the process in its pid namespace, which is only known once it is
+// running in the container, if it is passed sockets ($LISTEN_FDS).
+func setListenPid() error {
+	if os.Getenv("LISTEN_FDS") == "" {
+		return nil
+	}
+	return os.Setenv("LISTEN_PID", strconv.Itoa(unix.Getpid()))
+}
+
 // finalizeNamespace drops the caps, sets the correct user
 // and working dir, and closes any leaked file descriptors
 // before executing the command inside the namespace
@@ -288,10 +309,17 @@ func setupUser(config *initConfig) error {
 
 	var addGroups []int
 	if len(config.AdditionalGroups) > 0 {
-		addGroups, err = user.GetAdditionalGroupsPath(config.AdditionalGroups, groupPath)
+		var unknown []string
+		addGroups, unknown, err = user.LookupAdditionalGroupsPath(config.AdditionalGroups, groupPath)
 		if err != nil {
 			return err
 		}
+		// The groups may only be known to NSS modules of the host (such as
+		// LDAP), which can't be used from the container, so rather than
+		// failing, let the user know they were not set.
+		if len(unknown) != 0 {
+			logrus.Warnf("ignoring additional groups not found in %s: %s", groupPath, strings.Join(unknown, ", "))
+		}
 	}
 
 	// Rather than just erroring out later in setuid(2) and setgid(2), check
@@ -406,39 +434,52 @@ func setupNetwork(config *initConfig) error {
 			return err
 		}
 		if err := strategy.initialize(config); err != nil {
-			return err
+			return fmt.Errorf("%s: %w", networkName(&config.Network), err)
 		}
 	}
 	return nil
 }
 
+// setupRoute adds the routes of the config inside the container. The omitted
+// destination, source and gateway of a route use their defaults, i.e. a
+// default route, the preferred source of the kernel, and no gateway.
 func setupRoute(config *configs.Config) error {
 	for _, config := range config.Routes {
-		_, dst, err := net.ParseCIDR(config.Destination)
-		if err != nil {
-			return err
+		route := &netlink.Route{
+			Scope: netlink.SCOPE_UNIVERSE,
 		}
-		src := net.ParseIP(config.Source)
-		if src == nil {
-			return fmt.Errorf("Invalid source for route: %s", config.Source)
+		if config.Destination != "" {
+			_, dst, err := net.ParseCIDR(config.Destination)
+			if err != nil {
+				return err
+			}
+			route.Dst = dst
 		}
-		gw := net.ParseIP(config.Gateway)
-		if gw == nil {
-			return fmt.Errorf("Invalid gateway for route: %s", config.Gateway)
+		if config.Source != "" {
+			route.Src = net.ParseIP(config.Source)
+			if route.Src == nil {
+				return fmt.Errorf("Invalid source for route: %s", config.Source)
+			}
 		}
-		l, err := netlink.LinkByName(config.InterfaceName)
-		if err != nil {
-			return err
+		if config.Gateway != "" {
+			route.Gw = net.ParseIP(config.Gateway)
+			if route.Gw == nil {
+				return fmt.Errorf("Invalid gateway for route: %s", config.Gateway)
+			}
 		}
-		route := &netlink.Route{
-			Scope:     netlink.SCOPE_UNIVERSE,
-			Dst:       dst,
-			Src:       src,
-			Gw:        gw,
-			LinkIndex: l.Attrs().Index,
+		if config.InterfaceName != "" {
+			l, err := netlink.LinkByName(config.InterfaceName)
+			if err != nil {
+				return err
+			}
+			route.LinkIndex = l.Attrs().Index
+		}
+		if route.Gw == nil {
+			// Without a gateway, the destination is directly reachable.
+			route.Scope = netlink.SCOPE_LINK
 		}
 		if err := netlink.RouteAdd(route); err != nil {
-			return err
+			return fmt.Errorf("error adding route to %s: %w", config.Destination, err)
 		}
 	}
 	return nil
@@ -453,6 +494,59 @@ func setupRlimits(limits []configs.Rlimit, pid int) error {
 	return nil
 }
 
+// setIOPriority sets the I/O priority of the calling thread, which is
+// inherited by the process across execve.
+func setIOPriority(ioprio *configs.IOPriority) error {
+	if ioprio == nil {
+		return nil
+	}
+	value, err := ioprio.Ioprio()
+	if err != nil {
+		return err
+	}
+	if err := system.IoprioSet(system.IOPRIO_WHO_PROCESS, 0, value); err != nil {
+		return fmt.Errorf("error setting I/O priority: %w", err)
+	}
+	return nil
+}
+
+// setMemoryPolicy sets the memory policy of the calling thread, which is
+// inherited by the process across execve.
+func setMemoryPolicy(policy *configs.MemoryPolicy) error {
+	if policy == nil {
+		return nil
+	}
+	mode, nodes, err := policy.ToMempolicy()
+	if err != nil {
+		return err
+	}
+	if err := system.SetMempolicy(mode, nodes); err != nil {
+		return fmt.Errorf("error setting memory policy: %w", err)
+	}
+	return nil
+}
+
+// restrictAddressFamilies denies the creation of sockets of the address
+// families not allowed by the config with a seccomp filter, which unlike the
+// eBPF program of the cgroup (only run for AF_INET and AF_INET6 sockets)
+// applies to all the families. As the other seccomp filters, it requires
+// either NoNewPrivileges or CAP_SYS_ADMIN, so it is installed before the
+// capabilities are dropped.
+func restrictAddressFamilies(config *configs.Config) error {
+	if config.Cgroups == nil || config.Cgroups.Resources == nil || config.Cgroups.Resources.AllowedAddressFamilies == nil {
+		return nil
+	}
+	return seccomp.RestrictAddressFamilies(config.Cgroups.Resources.AllowedAddressFamilies)
+}
+
+// setupPersonality sets the Linux execution domain of the calling process.
+func setupPersonality(config *configs.Config) error {
+	if config.Personality == nil {
+		return nil
+	}
+	return system.SetLinuxPersonality(config.Personality.Domain)
+}
+
 const _P_PID = 1
 
 //nolint:structcheck,unused
@@ -494,36 +588,29 @@ func isNoChildren(err error) bool {
 }
 
 // signalAllProcesses freezes then iterates over all the processes inside the
-// manager's cgroups sending the signal s to them.
+// manager's cgroups sending the signal s to them. With cgroup v2, SIGKILL is
+// sent using cgroup.kill instead, if available (since kernel 5.14).
 // If s is SIGKILL then it will wait for each process to exit.
 // For all other signals it will check if the process is ready to report its
 // exit status and only if it is will a wait be performed.
 func signalAllProcesses(m cgroups.Manager, s os.Signal) error {
-	var procs []*os.Process
-	if err := m.Freeze(configs.Frozen); err != nil {
-		logrus.Warn(err)
-	}
-	pids, err := m.GetAllPids()
-	if err != nil {
-		if err := m.Freeze(configs.Thawed); err != nil {
-			logrus.Warn(err)
+	var (
+		procs  []*os.Process
+		killed bool
+		err    error
+	)
+	if s == unix.SIGKILL {
+		procs, killed, err = killCgroup(m)
+		if err != nil {
+			return err
 		}
-		return err
 	}
-	for _, pid := range pids {
-		p, err := os.FindProcess(pid)
+	if !killed {
+		procs, err = signalFrozen(m, s)
 		if err != nil {
-			logrus.Warn(err)
-			continue
-		}
-		procs = append(procs, p)
-		if err := p.Signal(s); err != nil {
-			logrus.Warn(err)
+			return err
 		}
 	}
-	if err := m.Freeze(configs.Thawed); err != nil {
-		logrus.Warn(err)
-	}
 
 	subreaper, err := system.GetSubreaper()
 	if err != nil {
@@ -563,3 +650,75 @@ func signalAllProcesses(m cgroups.Manager, s os.Signal) error {
 	}
 	return nil
 }
+
+// signalFrozen sends the signal s to all the processes inside the manager's
+// cgroups, which are frozen in the meantime, so that they can't fork, and
+// returns them.
+func signalFrozen(m cgroups.Manager, s os.Signal) ([]*os.Process, error) {
+	var procs []*os.Process
+	if err := m.Freeze(configs.Frozen); err != nil {
+		logrus.Warn(err)
+	}
+	pids, err := m.GetAllPids()
+	if err != nil {
+		if err := m.Freeze(configs.Thawed); err != nil {
+			logrus.Warn(err)
+		}
+		return nil, err
+	}
+	for _, pid := range pids {
+		p, err := os.FindProcess(pid)
+		if err != nil {
+			logrus.Warn(err)
+			continue
+		}
+		procs = append(procs, p)
+		if err := p.Signal(s); err != nil {
+			logrus.Warn(err)
+		}
+	}
+	if err := m.Freeze(configs.Thawed); err != nil {
+		logrus.Warn(err)
+	}
+	return procs, nil
+}
+
+// killCgroup kills all the processes inside the manager's cgroup at once by
+// writing to cgroup.kill, which, unlike signalling the processes one by one,
+// can't be raced by forks. The processes, as listed before killing them (so
+// that the children of the current process can be waited for), are
+// returned. The second return value is false if cgroup.kill is not
+// available (or can't be written to, as in rootless mode).
+func killCgroup(m cgroups.Manager) ([]*os.Process, bool, error) {
+	if !cgroups.IsCgroup2UnifiedMode() {
+		return nil, false, nil
+	}
+	return killCgroupDir(m, m.Path(""))
+}
+
+// killCgroupDir is killCgroup for the cgroup v2 directory path of m.
+func killCgroupDir(m cgroups.Manager, path string) ([]*os.Process, bool, error) {
+	if path == "" {
+		return nil, false, nil
+	}
+	pids, err := m.GetAllPids()
+	if err != nil {
+		return nil, false, err
+	}
+	if err := fscommon.WriteFile(path, "cgroup.kill", "1"); err != nil {
+		if errors.Is(err, os.ErrNotExist) || errors.Is(err, os.ErrPermission) {
+			return nil, false, nil
+		}
+		return nil, false, err
+	}
+	procs := make([]*os.Process, 0, len(pids))
+	for _, pid := range pids {
+		p, err := os.FindProcess(pid)
+		if err != nil {
+			logrus.Warn(err)
+			continue
+		}
+		procs = append(procs, p)
+	}
+	return procs, true, nil
+}
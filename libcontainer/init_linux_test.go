@@ -0,0 +1,73 @@
+// +build linux
+
+package libcontainer
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/opencontainers/runc/libcontainer/cgroups/fscommon"
+)
+
+func TestKillCgroupDir(t *testing.T) {
+	testMode := fscommon.TestMode
+	fscommon.TestMode = true
+	defer func() {
+		fscommon.TestMode = testMode
+	}()
+
+	dir, err := ioutil.TempDir("", "runc-kill-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	pids := []int{os.Getpid()}
+	m := &mockCgroupManager{allPids: pids, paths: map[string]string{"": dir}}
+	procs, killed, err := killCgroupDir(m, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !killed {
+		t.Fatal("expected the cgroup to be killed using cgroup.kill")
+	}
+	data, err := ioutil.ReadFile(filepath.Join(dir, "cgroup.kill"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "1" {
+		t.Errorf("expected 1 to be written to cgroup.kill, got %q", data)
+	}
+	if len(procs) != len(pids) || procs[0].Pid != pids[0] {
+		t.Errorf("expected the processes %v, got %v", pids, procs)
+	}
+}
+
+func TestKillCgroupDirUnavailable(t *testing.T) {
+	testMode := fscommon.TestMode
+	fscommon.TestMode = true
+	defer func() {
+		fscommon.TestMode = testMode
+	}()
+
+	dir, err := ioutil.TempDir("", "runc-kill-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// cgroup.kill can't be written (here, the cgroup does not exist), so
+	// the processes are to be signalled one by one.
+	for _, path := range []string{"", filepath.Join(dir, "nonexistent")} {
+		m := &mockCgroupManager{allPids: []int{os.Getpid()}, paths: map[string]string{"": path}}
+		procs, killed, err := killCgroupDir(m, path)
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", path, err)
+		}
+		if killed || procs != nil {
+			t.Errorf("%q: expected the cgroup not to be killed, got %v, %v", path, killed, procs)
+		}
+	}
+}
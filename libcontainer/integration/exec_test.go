@@ -5,19 +5,23 @@ import (
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
+	"net"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"reflect"
+	"runtime"
 	"strconv"
 	"strings"
 	"syscall"
 	"testing"
+	"unsafe"
 
 	"github.com/opencontainers/runc/libcontainer"
 	"github.com/opencontainers/runc/libcontainer/cgroups"
 	"github.com/opencontainers/runc/libcontainer/cgroups/systemd"
 	"github.com/opencontainers/runc/libcontainer/configs"
+	"github.com/opencontainers/runc/libcontainer/system"
 	"github.com/opencontainers/runtime-spec/specs-go"
 
 	"golang.org/x/sys/unix"
@@ -450,6 +454,61 @@ func TestProcessCaps(t *testing.T) {
 	}
 }
 
+func TestProcessAmbientCaps(t *testing.T) {
+	if testing.Short() {
+		return
+	}
+
+	rootfs, err := newRootfs()
+	ok(t, err)
+	defer remove(rootfs)
+
+	config := newTemplateConfig(t, &tParam{rootfs: rootfs})
+
+	container, err := newContainer(t, config)
+	ok(t, err)
+	defer destroyContainer(container)
+
+	// A non-root user keeps its ambient capabilities across execve,
+	// without any file capabilities.
+	var stdout bytes.Buffer
+	pconfig := libcontainer.Process{
+		Cwd:    "/",
+		Args:   []string{"cat", "/proc/self/status"},
+		Env:    standardEnvironment,
+		User:   "1000:1000",
+		Stdout: &stdout,
+		Capabilities: &configs.Capabilities{
+			Bounding:    []string{"CAP_NET_BIND_SERVICE", "CAP_KILL"},
+			Permitted:   []string{"CAP_NET_BIND_SERVICE", "CAP_KILL"},
+			Inheritable: []string{"CAP_NET_BIND_SERVICE", "CAP_KILL"},
+			Effective:   []string{"CAP_NET_BIND_SERVICE", "CAP_KILL"},
+			Ambient:     []string{"CAP_NET_BIND_SERVICE"},
+		},
+		Init: true,
+	}
+	err = container.Run(&pconfig)
+	ok(t, err)
+	waitProcess(&pconfig, t)
+
+	caps := make(map[string]uint64)
+	for _, line := range strings.Split(stdout.String(), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 2 && strings.HasPrefix(fields[0], "Cap") {
+			v, err := strconv.ParseUint(fields[1], 16, 64)
+			ok(t, err)
+			caps[strings.TrimSuffix(fields[0], ":")] = v
+		}
+	}
+	const netBindServiceMask = 1 << unix.CAP_NET_BIND_SERVICE
+	if caps["CapAmb"] != netBindServiceMask {
+		t.Errorf("expected ambient capabilities %#x, got %#x", netBindServiceMask, caps["CapAmb"])
+	}
+	if caps["CapEff"] != netBindServiceMask || caps["CapPrm"] != netBindServiceMask {
+		t.Errorf("expected CAP_NET_BIND_SERVICE only to be effective and permitted, got %#x and %#x", caps["CapEff"], caps["CapPrm"])
+	}
+}
+
 func TestAdditionalGroups(t *testing.T) {
 	if testing.Short() {
 		return
@@ -910,6 +969,70 @@ func TestPassExtraFiles(t *testing.T) {
 	}
 }
 
+func TestPassListenFDs(t *testing.T) {
+	if testing.Short() {
+		return
+	}
+
+	rootfs, err := newRootfs()
+	ok(t, err)
+	defer remove(rootfs)
+
+	config := newTemplateConfig(t, &tParam{rootfs: rootfs})
+
+	container, err := newContainer(t, config)
+	ok(t, err)
+	defer destroyContainer(container)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	ok(t, err)
+	defer l.Close()
+	sock, err := l.(*net.TCPListener).File()
+	ok(t, err)
+	defer sock.Close()
+
+	// LISTEN_PID is the pid of the process in the container, for the init
+	// process as well as for the processes executed in the container.
+	stdinR, stdinW, err := os.Pipe()
+	ok(t, err)
+	var stdout bytes.Buffer
+	process := libcontainer.Process{
+		Cwd:        "/",
+		Args:       []string{"sh", "-c", "echo -n $LISTEN_PID $$; cat"},
+		Env:        []string{"PATH=/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin", "LISTEN_FDS=1", "LISTEN_PID=0"},
+		ExtraFiles: []*os.File{sock},
+		Stdin:      stdinR,
+		Stdout:     &stdout,
+		Init:       true,
+	}
+	err = container.Run(&process)
+	stdinR.Close()
+	defer stdinW.Close()
+	ok(t, err)
+
+	var execout bytes.Buffer
+	execProcess := libcontainer.Process{
+		Cwd:        "/",
+		Args:       []string{"sh", "-c", "echo -n $LISTEN_PID $$"},
+		Env:        []string{"PATH=/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin", "LISTEN_FDS=1", "LISTEN_PID=0"},
+		ExtraFiles: []*os.File{sock},
+		Stdout:     &execout,
+	}
+	err = container.Run(&execProcess)
+	ok(t, err)
+	waitProcess(&execProcess, t)
+
+	stdinW.Close()
+	waitProcess(&process, t)
+
+	if out := stdout.String(); out != "1 1" {
+		t.Fatalf("expected LISTEN_PID of the init process to be 1, got %q", out)
+	}
+	if pids := strings.Fields(execout.String()); len(pids) != 2 || pids[0] != pids[1] {
+		t.Fatalf("expected LISTEN_PID of the executed process to be its pid, got %q", execout.String())
+	}
+}
+
 func TestMountCmds(t *testing.T) {
 	if testing.Short() {
 		return
@@ -1916,6 +2039,271 @@ func TestCGROUPHost(t *testing.T) {
 	}
 }
 
+func TestTimeNamespace(t *testing.T) {
+	if _, err := os.Stat("/proc/self/timens_offsets"); os.IsNotExist(err) {
+		t.Skip("Test requires timens.")
+	}
+	if testing.Short() {
+		return
+	}
+
+	rootfs, err := newRootfs()
+	ok(t, err)
+	defer remove(rootfs)
+
+	config := newTemplateConfig(t, &tParam{rootfs: rootfs})
+	config.Namespaces.Add(configs.NEWTIME, "")
+	config.TimeOffsets = map[string]configs.TimeOffset{
+		"monotonic": {Secs: 3600},
+		"boottime":  {Secs: 7200, Nanosecs: 500},
+	}
+	buffers, exitCode, err := runContainer(t, config, "", "cat", "/proc/self/timens_offsets")
+	ok(t, err)
+
+	if exitCode != 0 {
+		t.Fatalf("exit code not 0. code %d stderr %q", exitCode, buffers.Stderr)
+	}
+
+	offsets := make(map[string]string)
+	for _, line := range strings.Split(strings.TrimSpace(buffers.Stdout.String()), "\n") {
+		if fields := strings.Fields(line); len(fields) == 3 {
+			offsets[fields[0]] = fields[1] + " " + fields[2]
+		}
+	}
+	if offsets["monotonic"] != "3600 0" || offsets["boottime"] != "7200 500" {
+		t.Fatalf("unexpected time namespace offsets %q", buffers.Stdout.String())
+	}
+}
+
+func TestScheduler(t *testing.T) {
+	if testing.Short() {
+		return
+	}
+
+	rootfs, err := newRootfs()
+	ok(t, err)
+	defer remove(rootfs)
+
+	config := newTemplateConfig(t, &tParam{rootfs: rootfs})
+	config.Scheduler = &configs.Scheduler{
+		Policy: "SCHED_BATCH",
+		Nice:   5,
+	}
+	buffers, exitCode, err := runContainer(t, config, "", "cat", "/proc/self/stat")
+	ok(t, err)
+
+	if exitCode != 0 {
+		t.Fatalf("exit code not 0. code %d stderr %q", exitCode, buffers.Stderr)
+	}
+
+	// The fields following the command name, starting with the state (3).
+	stat := buffers.Stdout.String()
+	fields := strings.Fields(stat[strings.LastIndex(stat, ")")+1:])
+	if len(fields) < 39 {
+		t.Fatalf("unexpected /proc/self/stat %q", stat)
+	}
+	if nice, policy := fields[16], fields[38]; nice != "5" || policy != "3" {
+		t.Fatalf("expected nice 5 and policy SCHED_BATCH (3), got nice %s and policy %s", nice, policy)
+	}
+}
+
+func TestIOPriority(t *testing.T) {
+	if testing.Short() {
+		return
+	}
+
+	rootfs, err := newRootfs()
+	ok(t, err)
+	defer remove(rootfs)
+
+	config := newTemplateConfig(t, &tParam{rootfs: rootfs})
+	config.IOPriority = &configs.IOPriority{Class: "IOPRIO_CLASS_IDLE"}
+
+	container, err := newContainer(t, config)
+	ok(t, err)
+	defer destroyContainer(container)
+
+	ioprio := func(p *libcontainer.Process) int {
+		pid, err := p.Pid()
+		ok(t, err)
+		value, _, errno := unix.Syscall(unix.SYS_IOPRIO_GET, system.IOPRIO_WHO_PROCESS, uintptr(pid), 0)
+		if errno != 0 {
+			t.Fatalf("ioprio_get: %v", errno)
+		}
+		return int(value)
+	}
+
+	stdinR, stdinW, err := os.Pipe()
+	ok(t, err)
+	pconfig := &libcontainer.Process{
+		Cwd:   "/",
+		Args:  []string{"cat"},
+		Env:   standardEnvironment,
+		Stdin: stdinR,
+		Init:  true,
+	}
+	err = container.Run(pconfig)
+	_ = stdinR.Close()
+	defer stdinW.Close() //nolint: errcheck
+	ok(t, err)
+	if value, expected := ioprio(pconfig), system.IoprioValue(system.IOPRIO_CLASS_IDLE, 0); value != expected {
+		t.Errorf("expected init I/O priority %#x, got %#x", expected, value)
+	}
+
+	// The I/O priority of the container can be overridden for exec'd processes.
+	stdinR2, stdinW2, err := os.Pipe()
+	ok(t, err)
+	pconfig2 := &libcontainer.Process{
+		Cwd:        "/",
+		Args:       []string{"cat"},
+		Env:        standardEnvironment,
+		Stdin:      stdinR2,
+		IOPriority: &configs.IOPriority{Class: "IOPRIO_CLASS_BE", Priority: 6},
+	}
+	err = container.Run(pconfig2)
+	_ = stdinR2.Close()
+	defer stdinW2.Close() //nolint: errcheck
+	ok(t, err)
+	if value, expected := ioprio(pconfig2), system.IoprioValue(system.IOPRIO_CLASS_BE, 6); value != expected {
+		t.Errorf("expected exec I/O priority %#x, got %#x", expected, value)
+	}
+
+	_ = stdinW2.Close()
+	waitProcess(pconfig2, t)
+	_ = stdinW.Close()
+	waitProcess(pconfig, t)
+}
+
+func schedCoreCookie(pid int) (uint64, error) {
+	var cookie uint64
+	err := unix.Prctl(system.PR_SCHED_CORE, system.PR_SCHED_CORE_GET, uintptr(pid), system.PIDTYPE_PID, uintptr(unsafe.Pointer(&cookie)))
+	return cookie, err
+}
+
+func TestSchedCore(t *testing.T) {
+	if _, err := schedCoreCookie(0); err != nil {
+		t.Skipf("Test requires core scheduling: %v", err)
+	}
+	if testing.Short() {
+		return
+	}
+
+	rootfs, err := newRootfs()
+	ok(t, err)
+	defer remove(rootfs)
+
+	config := newTemplateConfig(t, &tParam{rootfs: rootfs})
+	config.SchedCore = true
+
+	container, err := newContainer(t, config)
+	ok(t, err)
+	defer destroyContainer(container)
+
+	stdinR, stdinW, err := os.Pipe()
+	ok(t, err)
+	pconfig := &libcontainer.Process{
+		Cwd:   "/",
+		Args:  []string{"cat"},
+		Env:   standardEnvironment,
+		Stdin: stdinR,
+		Init:  true,
+	}
+	err = container.Run(pconfig)
+	_ = stdinR.Close()
+	defer stdinW.Close() //nolint: errcheck
+	ok(t, err)
+	pid, err := pconfig.Pid()
+	ok(t, err)
+	cookie, err := schedCoreCookie(pid)
+	ok(t, err)
+	if cookie == 0 {
+		t.Fatal("expected a core scheduling cookie for the init process")
+	}
+	if own, err := schedCoreCookie(0); err != nil || own == cookie {
+		t.Fatalf("expected the cookie of the container to differ from the test's one (err: %v)", err)
+	}
+
+	// Processes executed in the container must share its cookie.
+	stdinR2, stdinW2, err := os.Pipe()
+	ok(t, err)
+	pconfig2 := &libcontainer.Process{
+		Cwd:   "/",
+		Args:  []string{"cat"},
+		Env:   standardEnvironment,
+		Stdin: stdinR2,
+	}
+	err = container.Run(pconfig2)
+	_ = stdinR2.Close()
+	defer stdinW2.Close() //nolint: errcheck
+	ok(t, err)
+	pid2, err := pconfig2.Pid()
+	ok(t, err)
+	cookie2, err := schedCoreCookie(pid2)
+	ok(t, err)
+	if cookie2 != cookie {
+		t.Errorf("expected the exec'd process to have cookie %#x, got %#x", cookie, cookie2)
+	}
+
+	_ = stdinW2.Close()
+	waitProcess(pconfig2, t)
+	_ = stdinW.Close()
+	waitProcess(pconfig, t)
+}
+
+func TestPersonality(t *testing.T) {
+	if runtime.GOARCH != "amd64" {
+		t.Skip("Test requires amd64.")
+	}
+	if testing.Short() {
+		return
+	}
+
+	rootfs, err := newRootfs()
+	ok(t, err)
+	defer remove(rootfs)
+
+	config := newTemplateConfig(t, &tParam{rootfs: rootfs})
+	config.Personality = &configs.LinuxPersonality{Domain: configs.PerLinux32}
+	buffers, exitCode, err := runContainer(t, config, "", "uname", "-m")
+	ok(t, err)
+
+	if exitCode != 0 {
+		t.Fatalf("exit code not 0. code %d stderr %q", exitCode, buffers.Stderr)
+	}
+	if machine := strings.TrimSpace(buffers.Stdout.String()); machine != "i686" {
+		t.Fatalf("expected machine i686, got %q", machine)
+	}
+}
+
+func TestMemoryPolicy(t *testing.T) {
+	if testing.Short() {
+		return
+	}
+	if _, err := os.Stat("/proc/self/numa_maps"); err != nil {
+		t.Skip("NUMA is not supported")
+	}
+
+	rootfs, err := newRootfs()
+	ok(t, err)
+	defer remove(rootfs)
+
+	config := newTemplateConfig(t, &tParam{rootfs: rootfs})
+	config.MemoryPolicy = &configs.MemoryPolicy{
+		Mode:  "MPOL_INTERLEAVE",
+		Nodes: "0",
+	}
+	buffers, exitCode, err := runContainer(t, config, "", "cat", "/proc/self/numa_maps")
+	ok(t, err)
+
+	if exitCode != 0 {
+		t.Fatalf("exit code not 0. code %d stderr %q", exitCode, buffers.Stderr)
+	}
+	// The policy of each mapping follows its address.
+	if out := buffers.Stdout.String(); !strings.Contains(out, " interleave:0 ") {
+		t.Fatalf("expected the interleave:0 policy, got %q", out)
+	}
+}
+
 func TestFdLeaks(t *testing.T) {
 	testFdLeaks(t, false)
 }
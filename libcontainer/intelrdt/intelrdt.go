@@ -191,6 +191,13 @@ var (
 
 	// The flag to indicate if Intel RDT/CAT is enabled
 	catEnabled bool
+	// The flag to indicate if Intel RDT/CDP (L3 CAT with separate code and
+	// data schemas) is enabled
+	cdpEnabled bool
+	// The flag to indicate if Intel RDT/L2 CAT is enabled
+	l2CatEnabled bool
+	// The flag to indicate if Intel RDT/L2 CDP is enabled
+	l2CdpEnabled bool
 	// The flag to indicate if Intel RDT/MBA is enabled
 	mbaEnabled bool
 	// The flag to indicate if Intel RDT/MBA Software Controller is enabled
@@ -225,9 +232,23 @@ func featuresInit() {
 		// "resource control" filesystem. Intel RDT sub-features can be
 		// selectively disabled or enabled by kernel command line
 		// (e.g., rdt=!l3cat,mba) in 4.14 and newer kernel
+		//
+		// With CDP enabled (e.g. "mount -t resctrl resctrl -o cdp"), there
+		// are separate L3CODE and L3DATA resources instead of L3.
 		if flagsSet.CAT {
 			if _, err := os.Stat(filepath.Join(intelRdtRoot, "info", "L3")); err == nil {
 				catEnabled = true
+			} else if _, err := os.Stat(filepath.Join(intelRdtRoot, "info", "L3CODE")); err == nil {
+				catEnabled = true
+				cdpEnabled = true
+			}
+		}
+		if flagsSet.L2CAT {
+			if _, err := os.Stat(filepath.Join(intelRdtRoot, "info", "L2")); err == nil {
+				l2CatEnabled = true
+			} else if _, err := os.Stat(filepath.Join(intelRdtRoot, "info", "L2CODE")); err == nil {
+				l2CatEnabled = true
+				l2CdpEnabled = true
 			}
 		}
 		if mbaScEnabled {
@@ -315,8 +336,9 @@ func isIntelRdtMounted() bool {
 }
 
 type cpuInfoFlags struct {
-	CAT bool // Cache Allocation Technology
-	MBA bool // Memory Bandwidth Allocation
+	CAT   bool // Cache Allocation Technology
+	L2CAT bool // L2 Cache Allocation Technology
+	MBA   bool // Memory Bandwidth Allocation
 
 	// Memory Bandwidth Monitoring related.
 	MBMTotal bool
@@ -346,6 +368,8 @@ func parseCpuInfoFile(path string) (cpuInfoFlags, error) {
 				switch flag {
 				case "cat_l3":
 					infoFlags.CAT = true
+				case "cat_l2":
+					infoFlags.L2CAT = true
 				case "mba":
 					infoFlags.MBA = true
 				case "cqm_mbm_total":
@@ -431,34 +455,53 @@ func getIntelRdtData(c *configs.Config, pid int) (*intelRdtData, error) {
 	}, nil
 }
 
-// Get the read-only L3 cache information
-func getL3CacheInfo() (*L3CacheInfo, error) {
-	l3CacheInfo := &L3CacheInfo{}
+// Get the read-only cache information of the given resource (e.g. "L3")
+func getCacheInfo(resource string) (*L3CacheInfo, error) {
+	cacheInfo := &L3CacheInfo{}
 
 	rootPath, err := getIntelRdtRoot()
 	if err != nil {
-		return l3CacheInfo, err
+		return cacheInfo, err
 	}
 
-	path := filepath.Join(rootPath, "info", "L3")
+	path := filepath.Join(rootPath, "info", resource)
 	cbmMask, err := getIntelRdtParamString(path, "cbm_mask")
 	if err != nil {
-		return l3CacheInfo, err
+		return cacheInfo, err
 	}
 	minCbmBits, err := getIntelRdtParamUint(path, "min_cbm_bits")
 	if err != nil {
-		return l3CacheInfo, err
+		return cacheInfo, err
 	}
 	numClosids, err := getIntelRdtParamUint(path, "num_closids")
 	if err != nil {
-		return l3CacheInfo, err
+		return cacheInfo, err
 	}
 
-	l3CacheInfo.CbmMask = cbmMask
-	l3CacheInfo.MinCbmBits = minCbmBits
-	l3CacheInfo.NumClosids = numClosids
+	cacheInfo.CbmMask = cbmMask
+	cacheInfo.MinCbmBits = minCbmBits
+	cacheInfo.NumClosids = numClosids
 
-	return l3CacheInfo, nil
+	return cacheInfo, nil
+}
+
+// Get the read-only L3 cache information
+func getL3CacheInfo() (*L3CacheInfo, error) {
+	if IsCDPEnabled() {
+		// The code and data resources share the same properties.
+		return getCacheInfo("L3CODE")
+	}
+	return getCacheInfo("L3")
+}
+
+// Get the read-only L2 cache information
+func getL2CacheInfo() (*L2CacheInfo, error) {
+	resource := "L2"
+	if IsL2CDPEnabled() {
+		resource = "L2CODE"
+	}
+	info, err := getCacheInfo(resource)
+	return (*L2CacheInfo)(info), err
 }
 
 // Get the read-only memory bandwidth information
@@ -539,6 +582,24 @@ func IsMBAEnabled() bool {
 	return mbaEnabled
 }
 
+// Check if Intel RDT/CDP is enabled
+func IsCDPEnabled() bool {
+	featuresInit()
+	return cdpEnabled
+}
+
+// Check if Intel RDT/L2 CAT is enabled
+func IsL2CATEnabled() bool {
+	featuresInit()
+	return l2CatEnabled
+}
+
+// Check if Intel RDT/L2 CDP is enabled
+func IsL2CDPEnabled() bool {
+	featuresInit()
+	return l2CdpEnabled
+}
+
 // Check if Intel RDT/MBA Software Controller is enabled
 func IsMBAScEnabled() bool {
 	featuresInit()
@@ -556,6 +617,16 @@ func GetIntelRdtPath(id string) (string, error) {
 	return path, nil
 }
 
+// groupName returns the name of the 'container_id' group relative to the
+// root of Intel RDT "resource control" filesystem. A monitoring group is
+// used if no allocation is done.
+func (m *intelRdtManager) groupName() string {
+	if m.config.IntelRdt != nil && m.config.IntelRdt.IsMonitoringOnly() {
+		return filepath.Join("mon_groups", m.id)
+	}
+	return m.id
+}
+
 // Applies Intel RDT configuration to the process with the specified pid
 func (m *intelRdtManager) Apply(pid int) (err error) {
 	// If intelRdt is not specified in config, we do nothing
@@ -569,7 +640,7 @@ func (m *intelRdtManager) Apply(pid int) (err error) {
 
 	m.mu.Lock()
 	defer m.mu.Unlock()
-	path, err := d.join(m.id)
+	path, err := d.join(m.groupName())
 	if err != nil {
 		return err
 	}
@@ -593,7 +664,7 @@ func (m *intelRdtManager) Destroy() error {
 // restore the object later
 func (m *intelRdtManager) GetPath() string {
 	if m.path == "" {
-		m.path, _ = GetIntelRdtPath(m.id)
+		m.path, _ = GetIntelRdtPath(m.groupName())
 	}
 	return m.path
 }
@@ -609,6 +680,14 @@ func (m *intelRdtManager) GetStats() (*Stats, error) {
 	defer m.mu.Unlock()
 	stats := NewStats()
 
+	containerPath := m.GetPath()
+	if m.config.IntelRdt.IsMonitoringOnly() {
+		if err := getMonitoringStats(containerPath, stats); err != nil {
+			return nil, err
+		}
+		return stats, nil
+	}
+
 	rootPath, err := getIntelRdtRoot()
 	if err != nil {
 		return nil, err
@@ -621,7 +700,6 @@ func (m *intelRdtManager) GetStats() (*Stats, error) {
 	schemaRootStrings := strings.Split(tmpRootStrings, "\n")
 
 	// The L3 cache and memory bandwidth schemata in 'container_id' group
-	containerPath := m.GetPath()
 	tmpStrings, err := getIntelRdtParamString(containerPath, "schemata")
 	if err != nil {
 		return nil, err
@@ -637,18 +715,25 @@ func (m *intelRdtManager) GetStats() (*Stats, error) {
 		stats.L3CacheInfo = l3CacheInfo
 
 		// The read-only L3 cache schema in root
-		for _, schemaRoot := range schemaRootStrings {
-			if strings.Contains(schemaRoot, "L3") {
-				stats.L3CacheSchemaRoot = strings.TrimSpace(schemaRoot)
-			}
-		}
+		stats.L3CacheSchemaRoot = getSchema(schemaRootStrings, "L3", "L3CODE", "L3DATA")
 
 		// The L3 cache schema in 'container_id' group
-		for _, schema := range schemaStrings {
-			if strings.Contains(schema, "L3") {
-				stats.L3CacheSchema = strings.TrimSpace(schema)
-			}
+		stats.L3CacheSchema = getSchema(schemaStrings, "L3", "L3CODE", "L3DATA")
+	}
+
+	if IsL2CATEnabled() {
+		// The read-only L2 cache information
+		l2CacheInfo, err := getL2CacheInfo()
+		if err != nil {
+			return nil, err
 		}
+		stats.L2CacheInfo = l2CacheInfo
+
+		// The read-only L2 cache schema in root
+		stats.L2CacheSchemaRoot = getSchema(schemaRootStrings, "L2", "L2CODE", "L2DATA")
+
+		// The L2 cache schema in 'container_id' group
+		stats.L2CacheSchema = getSchema(schemaStrings, "L2", "L2CODE", "L2DATA")
 	}
 
 	if IsMBAEnabled() {
@@ -684,6 +769,22 @@ func (m *intelRdtManager) GetStats() (*Stats, error) {
 	return stats, nil
 }
 
+// getSchema returns the lines of schemata for the given resources (e.g. "L3"),
+// joined by newlines.
+func getSchema(schemata []string, resources ...string) string {
+	var lines []string
+	for _, line := range schemata {
+		line = strings.TrimSpace(line)
+		for _, res := range resources {
+			if strings.HasPrefix(line, res+":") {
+				lines = append(lines, line)
+				break
+			}
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
 // Set Intel RDT "resource control" filesystem as configured.
 func (m *intelRdtManager) Set(container *configs.Config) error {
 	// About L3 cache schema:
@@ -731,28 +832,37 @@ func (m *intelRdtManager) Set(container *configs.Config) error {
 	// For example, on a two-socket machine, the schema line could be
 	// "MB:0=5000;1=7000" which means 5000 MBps memory bandwidth limit on
 	// socket 0 and 7000 MBps memory bandwidth limit on socket 1.
+	//
+	//
+	// About L2 cache schema:
+	// It is the same as L3 cache schema, but for L2 cache, e.g.:
+	// 	L2:0=f;1=f0
+	//
+	//
+	// About CDP (Code and Data Prioritization):
+	// If CDP is enabled through mount option "-o cdp" (or "-o cdpl2" for
+	// L2 cache), there are separate schemas for code and data instead of
+	// a single one for the cache, e.g.:
+	// 	L3CODE:0=ff;1=ff
+	// 	L3DATA:0=f0;1=f0
+	// Both schema lines are then specified in the L3 (or L2) cache schema,
+	// separated by a newline.
 	if container.IntelRdt != nil {
 		path := m.GetPath()
-		l3CacheSchema := container.IntelRdt.L3CacheSchema
-		memBwSchema := container.IntelRdt.MemBwSchema
-
-		// Write a single joint schema string to schemata file
-		if l3CacheSchema != "" && memBwSchema != "" {
-			if err := writeFile(path, "schemata", l3CacheSchema+"\n"+memBwSchema); err != nil {
-				return NewLastCmdError(err)
+		var schemata []string
+		for _, schema := range []string{
+			container.IntelRdt.L3CacheSchema,
+			container.IntelRdt.L2CacheSchema,
+			container.IntelRdt.MemBwSchema,
+		} {
+			if schema != "" {
+				schemata = append(schemata, schema)
 			}
 		}
 
-		// Write only L3 cache schema string to schemata file
-		if l3CacheSchema != "" && memBwSchema == "" {
-			if err := writeFile(path, "schemata", l3CacheSchema); err != nil {
-				return NewLastCmdError(err)
-			}
-		}
-
-		// Write only memory bandwidth schema string to schemata file
-		if l3CacheSchema == "" && memBwSchema != "" {
-			if err := writeFile(path, "schemata", memBwSchema); err != nil {
+		// Write a single joint schema string to schemata file
+		if len(schemata) > 0 {
+			if err := writeFile(path, "schemata", strings.Join(schemata, "\n")); err != nil {
 				return NewLastCmdError(err)
 			}
 		}
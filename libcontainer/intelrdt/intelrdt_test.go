@@ -43,6 +43,64 @@ func TestIntelRdtSetL3CacheSchema(t *testing.T) {
 	}
 }
 
+func TestIntelRdtSetL2CacheSchema(t *testing.T) {
+	if !IsL2CATEnabled() {
+		return
+	}
+
+	helper := NewIntelRdtTestUtil(t)
+	defer helper.cleanup()
+
+	const (
+		l2CacheSchemaBefore = "L2:0=f;1=f0"
+		l2CacheSchemeAfter  = "L2:0=f0;1=f"
+	)
+
+	helper.writeFileContents(map[string]string{
+		"schemata": l2CacheSchemaBefore + "\n",
+	})
+
+	helper.IntelRdtData.config.IntelRdt.L2CacheSchema = l2CacheSchemeAfter
+	intelrdt := NewManager(helper.IntelRdtData.config, "", helper.IntelRdtPath)
+	if err := intelrdt.Set(helper.IntelRdtData.config); err != nil {
+		t.Fatal(err)
+	}
+
+	tmpStrings, err := getIntelRdtParamString(helper.IntelRdtPath, "schemata")
+	if err != nil {
+		t.Fatalf("Failed to parse file 'schemata' - %s", err)
+	}
+	values := strings.Split(tmpStrings, "\n")
+	value := values[0]
+
+	if value != l2CacheSchemeAfter {
+		t.Fatal("Got the wrong value, set 'schemata' failed.")
+	}
+}
+
+func TestGetSchema(t *testing.T) {
+	schemata := []string{
+		"    L3CODE:0=ff;1=ff",
+		"    L3DATA:0=f0;1=f0",
+		"        L2:0=f;1=f",
+		"        MB:0=100;1=100",
+	}
+	testCases := []struct {
+		resources []string
+		expected  string
+	}{
+		{[]string{"L3", "L3CODE", "L3DATA"}, "L3CODE:0=ff;1=ff\nL3DATA:0=f0;1=f0"},
+		{[]string{"L2", "L2CODE", "L2DATA"}, "L2:0=f;1=f"},
+		{[]string{"MB"}, "MB:0=100;1=100"},
+		{[]string{"L3"}, ""},
+	}
+	for _, tc := range testCases {
+		if schema := getSchema(schemata, tc.resources...); schema != tc.expected {
+			t.Errorf("getSchema(%v): expected %q, got %q", tc.resources, tc.expected, schema)
+		}
+	}
+}
+
 func TestIntelRdtSetMemBwSchema(t *testing.T) {
 	if !IsMBAEnabled() {
 		return
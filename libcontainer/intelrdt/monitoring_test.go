@@ -7,6 +7,8 @@ import (
 	"strconv"
 	"strings"
 	"testing"
+
+	"github.com/opencontainers/runc/libcontainer/configs"
 )
 
 func TestParseMonFeatures(t *testing.T) {
@@ -116,3 +118,42 @@ func TestGetMonitoringStats(t *testing.T) {
 		}
 	})
 }
+
+func TestGetStatsMonitoringOnly(t *testing.T) {
+	enabledMonFeatures.mbmTotalBytes = true
+	enabledMonFeatures.mbmLocalBytes = false
+	enabledMonFeatures.llcOccupancy = true
+	mbmEnabled = true
+	cmtEnabled = true
+
+	mockedL3_MON, err := mockResctrlL3_MON([]string{"mon_l3_00"}, map[string]uint64{
+		"mbm_total_bytes": 1024,
+		"llc_occupancy":   2048,
+	})
+	defer os.RemoveAll(mockedL3_MON)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config := &configs.Config{
+		IntelRdt: &configs.IntelRdt{EnableCMT: true, EnableMBM: true},
+	}
+	m := NewManager(config, "foo", mockedL3_MON).(*intelRdtManager)
+	if name := m.groupName(); name != filepath.Join("mon_groups", "foo") {
+		t.Fatalf("expected a monitoring group, got %q", name)
+	}
+	// There is no schemata file in a monitoring group.
+	stats, err := m.GetStats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(*stats.MBMStats) != 1 || (*stats.MBMStats)[0].MBMTotalBytes != 1024 {
+		t.Errorf("unexpected MBM stats: %+v", *stats.MBMStats)
+	}
+	if len(*stats.CMTStats) != 1 || (*stats.CMTStats)[0].LLCOccupancy != 2048 {
+		t.Errorf("unexpected CMT stats: %+v", *stats.CMTStats)
+	}
+	if stats.L3CacheSchema != "" || stats.MemBwSchema != "" {
+		t.Errorf("expected no schemata, got %+v", stats)
+	}
+}
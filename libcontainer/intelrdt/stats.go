@@ -8,6 +8,12 @@ type L3CacheInfo struct {
 	NumClosids uint64 `json:"num_closids,omitempty"`
 }
 
+type L2CacheInfo struct {
+	CbmMask    string `json:"cbm_mask,omitempty"`
+	MinCbmBits uint64 `json:"min_cbm_bits,omitempty"`
+	NumClosids uint64 `json:"num_closids,omitempty"`
+}
+
 type MemBwInfo struct {
 	BandwidthGran uint64 `json:"bandwidth_gran,omitempty"`
 	DelayLinear   uint64 `json:"delay_linear,omitempty"`
@@ -38,6 +44,15 @@ type Stats struct {
 	// The L3 cache schema in 'container_id' group
 	L3CacheSchema string `json:"l3_cache_schema,omitempty"`
 
+	// The read-only L2 cache information
+	L2CacheInfo *L2CacheInfo `json:"l2_cache_info,omitempty"`
+
+	// The read-only L2 cache schema in root
+	L2CacheSchemaRoot string `json:"l2_cache_schema_root,omitempty"`
+
+	// The L2 cache schema in 'container_id' group
+	L2CacheSchema string `json:"l2_cache_schema,omitempty"`
+
 	// The read-only memory bandwidth information
 	MemBwInfo *MemBwInfo `json:"mem_bw_info,omitempty"`
 
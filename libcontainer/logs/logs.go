@@ -6,7 +6,11 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"strconv"
 	"sync"
+	"time"
+
+	"github.com/opencontainers/runc/libcontainer/trace"
 
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
@@ -17,6 +21,10 @@ var (
 	// loggingConfigured will be set once logging has been configured via invoking `ConfigureLogging`.
 	// Subsequent invocations of `ConfigureLogging` would be no-op
 	loggingConfigured = false
+
+	fieldsMutex sync.RWMutex
+	// fields are added to all the log entries by fieldsHook.
+	fields = logrus.Fields{}
 )
 
 type Config struct {
@@ -52,21 +60,91 @@ func processEntry(text []byte) {
 		return
 	}
 
-	var jl struct {
-		Level string `json:"level"`
-		Msg   string `json:"msg"`
-	}
+	var jl map[string]interface{}
 	if err := json.Unmarshal(text, &jl); err != nil {
 		logrus.Errorf("failed to decode %q to json: %v", text, err)
 		return
 	}
 
-	lvl, err := logrus.ParseLevel(jl.Level)
+	level, _ := jl["level"].(string)
+	lvl, err := logrus.ParseLevel(level)
 	if err != nil {
-		logrus.Errorf("failed to parse log level %q: %v", jl.Level, err)
+		logrus.Errorf("failed to parse log level %q: %v", level, err)
 		return
 	}
-	logrus.StandardLogger().Logf(lvl, jl.Msg)
+	if name, ok := jl["span"].(string); ok {
+		recordSpan(name, jl)
+		return
+	}
+	msg, _ := jl["msg"].(string)
+	// Keep the other fields of the entry (such as the nsexec stage), except
+	// for the ones set by the logger itself.
+	for _, key := range []string{"level", "msg", "time", "func", "file"} {
+		delete(jl, key)
+	}
+	logrus.WithFields(logrus.Fields(jl)).Log(lvl, msg)
+}
+
+// ForwardSpan logs the span s, so that it is recorded by the ForwardLogs of
+// the parent process rather than logged. It is meant to be used by runc init
+// with trace.InitForwarding.
+func ForwardSpan(s *trace.Span) {
+	f := logrus.Fields{
+		"span":      s.Name,
+		"spanStart": strconv.FormatInt(s.Start.UnixNano(), 10),
+		"spanEnd":   strconv.FormatInt(s.End.UnixNano(), 10),
+	}
+	if len(s.Attributes) > 0 {
+		f["spanAttributes"] = s.Attributes
+	}
+	logrus.WithFields(f).Info("span")
+}
+
+func recordSpan(name string, jl map[string]interface{}) {
+	s := &trace.Span{Name: name}
+	for key, t := range map[string]*time.Time{"spanStart": &s.Start, "spanEnd": &s.End} {
+		v, _ := jl[key].(string)
+		ns, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			logrus.Errorf("failed to parse %s %q of span %q: %v", key, v, name, err)
+			return
+		}
+		*t = time.Unix(0, ns)
+	}
+	if attrs, ok := jl["spanAttributes"].(map[string]interface{}); ok {
+		for k, v := range attrs {
+			s.SetAttribute(k, fmt.Sprint(v))
+		}
+	}
+	trace.Record(s)
+}
+
+// AddFields adds the given fields to all the subsequent log entries,
+// including the ones forwarded by ForwardLogs, unless they already have
+// fields with the same keys.
+func AddFields(f logrus.Fields) {
+	fieldsMutex.Lock()
+	defer fieldsMutex.Unlock()
+	for k, v := range f {
+		fields[k] = v
+	}
+}
+
+type fieldsHook struct{}
+
+func (fieldsHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (fieldsHook) Fire(entry *logrus.Entry) error {
+	fieldsMutex.RLock()
+	defer fieldsMutex.RUnlock()
+	for k, v := range fields {
+		if _, ok := entry.Data[k]; !ok {
+			entry.Data[k] = v
+		}
+	}
+	return nil
 }
 
 func ConfigureLogging(config Config) error {
@@ -79,6 +157,7 @@ func ConfigureLogging(config Config) error {
 
 	logrus.SetLevel(config.LogLevel)
 	logrus.SetReportCaller(config.LogCaller)
+	logrus.AddHook(fieldsHook{})
 
 	// XXX: while 0 is a valid fd (usually stdin), here we assume
 	// that we never deliberately set LogPipeFd to 0.
@@ -20,6 +20,19 @@ func TestLoggingToFile(t *testing.T) {
 	check(t, l, "kitten")
 }
 
+func TestLogForwardingFields(t *testing.T) {
+	l := runLogForwarding(t)
+	defer l.cleanup()
+	defer func() { fields = logrus.Fields{} }()
+
+	AddFields(logrus.Fields{"op": "parent", "container": "kitten"})
+	logToLogWriter(t, l, `{"level": "info","msg":"purr","stage":"nsexec-1","op":"child"}`)
+	finish(t, l)
+	check(t, l, `"container":"kitten"`)
+	check(t, l, `"op":"child"`)
+	check(t, l, `"stage":"nsexec-1"`)
+}
+
 func TestLogForwardingDoesNotStopOnJsonDecodeErr(t *testing.T) {
 	l := runLogForwarding(t)
 	defer l.cleanup()
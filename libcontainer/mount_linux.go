@@ -0,0 +1,192 @@
+// +build linux
+
+package libcontainer
+
+import (
+	"errors"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/opencontainers/runc/libcontainer/system"
+	"golang.org/x/sys/unix"
+)
+
+// errNoMountAPI means that a mount can't be done using the new mount API,
+// and mount(2) has to be used instead.
+var errNoMountAPI = errors.New("new mount API not available")
+
+// mountAttrs maps mount(2) flags to the mount attributes of fsmount(2).
+var mountAttrs = map[uintptr]uint{
+	unix.MS_RDONLY:      system.MOUNT_ATTR_RDONLY,
+	unix.MS_NOSUID:      system.MOUNT_ATTR_NOSUID,
+	unix.MS_NODEV:       system.MOUNT_ATTR_NODEV,
+	unix.MS_NOEXEC:      system.MOUNT_ATTR_NOEXEC,
+	unix.MS_NOATIME:     system.MOUNT_ATTR_NOATIME,
+	unix.MS_STRICTATIME: system.MOUNT_ATTR_STRICTATIME,
+	unix.MS_NODIRATIME:  system.MOUNT_ATTR_NODIRATIME,
+	unix.MS_RELATIME:    0, // The default.
+}
+
+// sbFlags maps mount(2) flags to the superblock flags of fsconfig(2).
+var sbFlags = map[uintptr]string{
+	unix.MS_RDONLY:      "ro",
+	unix.MS_SYNCHRONOUS: "sync",
+	unix.MS_DIRSYNC:     "dirsync",
+	unix.MS_LAZYTIME:    "lazytime",
+	unix.MS_MANDLOCK:    "mand",
+}
+
+// mountTo is like mount(2), except it uses the new mount API (Linux 5.2+)
+// where possible: the filesystem (or the bind mount source) is set up as a
+// detached mount first, which is then atomically attached to target using
+// move_mount(2). Mounts which can't be expressed using the new API, as well
+// as all mounts on older kernels, are done using mount(2).
+func mountTo(source, target, fstype string, flags uintptr, data string) error {
+	err := mountDetached(source, target, fstype, flags, data)
+	if err == errNoMountAPI {
+		return unix.Mount(source, target, fstype, flags, data)
+	}
+	return err
+}
+
+func mountDetached(source, target, fstype string, flags uintptr, data string) error {
+	if flags&unix.MS_REMOUNT != 0 {
+		return errNoMountAPI
+	}
+	var (
+		mfd int
+		err error
+	)
+	if flags&unix.MS_BIND != 0 {
+		mfd, err = openBindMount(source, flags)
+	} else {
+		mfd, err = openFsMount(source, fstype, flags, data)
+	}
+	if err != nil {
+		return err
+	}
+	defer unix.Close(mfd) //nolint: errcheck
+
+	// move_mount(2) fails with EINVAL when the target is a magic link of
+	// /proc/self/fd (as given by utils.WithProcfd), so the file descriptor
+	// is used as the target instead.
+	if fd, ok := procfdTarget(target); ok {
+		err = system.MoveMount(mfd, "", fd, "", system.MOVE_MOUNT_F_EMPTY_PATH|system.MOVE_MOUNT_T_EMPTY_PATH)
+	} else {
+		err = system.MoveMount(mfd, "", unix.AT_FDCWD, target, system.MOVE_MOUNT_F_EMPTY_PATH)
+	}
+	// Unlike mount(2), move_mount(2) fails with EINVAL rather than ENOTDIR
+	// when binding a file onto a directory (or vice versa), which callers
+	// such as maskPath rely on.
+	if errors.Is(err, unix.EINVAL) && flags&unix.MS_BIND != 0 && isDir(source) != isDir(target) {
+		return &os.PathError{Op: "move_mount", Path: target, Err: unix.ENOTDIR}
+	}
+	return err
+}
+
+func isDir(path string) bool {
+	fi, err := os.Stat(path)
+	return err == nil && fi.IsDir()
+}
+
+// procfdTarget returns the file descriptor of target, if it is a
+// /proc/self/fd path.
+func procfdTarget(target string) (int, bool) {
+	const prefix = "/proc/self/fd/"
+	if !strings.HasPrefix(target, prefix) {
+		return -1, false
+	}
+	fd, err := strconv.Atoi(target[len(prefix):])
+	if err != nil || fd < 0 {
+		return -1, false
+	}
+	return fd, true
+}
+
+// openBindMount returns a detached bind mount of source. As with mount(2),
+// all flags except MS_REC are ignored for bind mounts.
+func openBindMount(source string, flags uintptr) (int, error) {
+	oflags := uint(system.OPEN_TREE_CLONE | system.OPEN_TREE_CLOEXEC)
+	if flags&unix.MS_REC != 0 {
+		oflags |= system.AT_RECURSIVE
+	}
+	fd, err := system.OpenTree(unix.AT_FDCWD, source, oflags)
+	if isNoMountAPI(err) {
+		return -1, errNoMountAPI
+	}
+	return fd, err
+}
+
+// openFsMount returns a detached mount of a new fstype filesystem instance.
+func openFsMount(source, fstype string, flags uintptr, data string) (int, error) {
+	var attrs uint
+	var opts []string
+	for f := uintptr(1); f != 0 && f <= flags; f <<= 1 {
+		if flags&f == 0 || f == unix.MS_REC {
+			continue
+		}
+		attr, isAttr := mountAttrs[f]
+		opt, isOpt := sbFlags[f]
+		if !isAttr && !isOpt {
+			return -1, errNoMountAPI
+		}
+		attrs |= attr
+		if isOpt {
+			opts = append(opts, opt)
+		}
+	}
+	// Quoted values (such as SELinux contexts) may contain commas, and are
+	// unquoted by mount(2) but not by fsconfig(2).
+	if strings.ContainsAny(data, `"'`) {
+		return -1, errNoMountAPI
+	}
+
+	fsfd, err := system.Fsopen(fstype, system.FSOPEN_CLOEXEC)
+	if err != nil {
+		if isNoMountAPI(err) {
+			return -1, errNoMountAPI
+		}
+		return -1, err
+	}
+	defer unix.Close(fsfd) //nolint: errcheck
+
+	if source != "" {
+		if err := system.Fsconfig(fsfd, system.FSCONFIG_SET_STRING, "source", source); err != nil {
+			return -1, err
+		}
+	}
+	for _, opt := range opts {
+		if err := system.Fsconfig(fsfd, system.FSCONFIG_SET_FLAG, opt, ""); err != nil {
+			return -1, err
+		}
+	}
+	for _, opt := range strings.Split(data, ",") {
+		if opt == "" {
+			continue
+		}
+		kv := strings.SplitN(opt, "=", 2)
+		if len(kv) == 2 && kv[1] == "" {
+			return -1, errNoMountAPI
+		}
+		if len(kv) == 1 {
+			err = system.Fsconfig(fsfd, system.FSCONFIG_SET_FLAG, kv[0], "")
+		} else {
+			err = system.Fsconfig(fsfd, system.FSCONFIG_SET_STRING, kv[0], kv[1])
+		}
+		if err != nil {
+			return -1, err
+		}
+	}
+	if err := system.Fsconfig(fsfd, system.FSCONFIG_CMD_CREATE, "", ""); err != nil {
+		return -1, err
+	}
+	return system.Fsmount(fsfd, system.FSMOUNT_CLOEXEC, attrs)
+}
+
+// isNoMountAPI reports whether err means the new mount API is not
+// available, either because the kernel is too old, or because the syscalls
+// are blocked by a seccomp filter (as is often the case in containers).
+func isNoMountAPI(err error) bool {
+	return errors.Is(err, unix.ENOSYS) || errors.Is(err, unix.EPERM)
+}
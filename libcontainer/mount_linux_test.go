@@ -0,0 +1,109 @@
+// +build linux
+
+package libcontainer
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/moby/sys/mountinfo"
+	"github.com/opencontainers/runc/libcontainer/utils"
+	"golang.org/x/sys/unix"
+)
+
+func TestMountTo(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("test requires root")
+	}
+	dir, err := ioutil.TempDir("", "runc-mount-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := mountTo("tmpfs", dir, "tmpfs", unix.MS_NOSUID|unix.MS_RDONLY, "size=1m,mode=700"); err != nil {
+		t.Fatal(err)
+	}
+	defer unix.Unmount(dir, unix.MNT_DETACH) //nolint: errcheck
+
+	mounts, err := mountinfo.GetMounts(mountinfo.SingleEntryFilter(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mounts) != 1 {
+		t.Fatalf("expected 1 mount at %s, got %d", dir, len(mounts))
+	}
+	m := mounts[0]
+	if m.FSType != "tmpfs" {
+		t.Errorf("expected tmpfs, got %q", m.FSType)
+	}
+	for _, opt := range []string{"ro", "nosuid"} {
+		if !hasOption(m.Options, opt) {
+			t.Errorf("expected %q in mount options %q", opt, m.Options)
+		}
+	}
+	if !hasOption(m.VFSOptions, "mode=700") {
+		t.Errorf("expected mode=700 in superblock options %q", m.VFSOptions)
+	}
+}
+
+func TestMountToProcfd(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("test requires root")
+	}
+	dir, err := ioutil.TempDir("", "runc-mount-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	err = utils.WithProcfd(dir, "/", func(procfd string) error {
+		return mountTo("tmpfs", procfd, "tmpfs", 0, "size=1m")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer unix.Unmount(dir, unix.MNT_DETACH) //nolint: errcheck
+
+	mounts, err := mountinfo.GetMounts(mountinfo.SingleEntryFilter(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mounts) != 1 || mounts[0].FSType != "tmpfs" {
+		t.Fatalf("expected a tmpfs mount at %s, got %+v", dir, mounts)
+	}
+}
+
+func TestMountToBindNotDir(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("test requires root")
+	}
+	dir, err := ioutil.TempDir("", "runc-mount-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// maskPath relies on binding a file onto a directory failing with
+	// ENOTDIR, as it does with mount(2).
+	err = mountTo("/dev/null", dir, "", unix.MS_BIND, "")
+	if err == nil {
+		unix.Unmount(dir, unix.MNT_DETACH) //nolint: errcheck
+		t.Fatal("expected an error binding a file onto a directory")
+	}
+	if !errors.Is(err, unix.ENOTDIR) {
+		t.Fatalf("expected ENOTDIR, got %v", err)
+	}
+}
+
+func hasOption(opts, opt string) bool {
+	for _, o := range strings.Split(opts, ",") {
+		if o == opt {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,477 @@
+// +build linux
+
+package libcontainer
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/opencontainers/runc/libcontainer/configs"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/sys/unix"
+)
+
+// networkHelperTimeout is how long to wait for a networking helper to set up
+// the network of the container.
+const networkHelperTimeout = 10 * time.Second
+
+// isNetworkHelper reports whether the network type tpe is set up by a
+// user-mode networking helper, which keeps running along with the container.
+func isNetworkHelper(tpe string) bool {
+	return tpe == "pasta" || tpe == "slirp4netns"
+}
+
+// pasta is a network strategy that connects the container to the network of
+// the host using pasta(1), which copies the addresses and routes of the host
+// into the container. It is run by the user running runc, so that it works in
+// rootless containers.
+type pasta struct {
+}
+
+func (h *pasta) create(n *network, nspid int) error {
+	path, err := exec.LookPath("pasta")
+	if err != nil {
+		return err
+	}
+	logFile, err := os.Create(filepath.Join(n.stateDir, "pasta.log"))
+	if err != nil {
+		return err
+	}
+	defer logFile.Close()
+
+	// pasta forks into the background once the network is set up, so the
+	// output goes to a file rather than to pipes, which the background
+	// process would keep open.
+	cmd := exec.Command(path, pastaArgs(&n.Network, networkHelperPidFile(n.stateDir, "pasta"), nspid)...)
+	cmd.Stdout = logFile
+	cmd.Stderr = logFile
+	if err := runWithTimeout(cmd, networkHelperTimeout); err != nil {
+		return networkHelperError("pasta", err, logFile.Name())
+	}
+	return nil
+}
+
+// pastaArgs returns the arguments of pasta to set up the network namespace
+// of the process nspid.
+func pastaArgs(n *configs.Network, pidFile string, nspid int) []string {
+	args := []string{"--config-net", "--pid", pidFile}
+	if n.Name != "" {
+		args = append(args, "--ns-ifname", n.Name)
+	}
+	if n.Mtu != 0 {
+		args = append(args, "--mtu", strconv.Itoa(n.Mtu))
+	}
+	// Unless some ports are given, nothing is forwarded, as the default of
+	// pasta is to forward all the ports the container listens to.
+	for _, proto := range []string{"tcp", "udp"} {
+		var ports []string
+		for _, pf := range n.PortForwards {
+			if pf.Protocol != proto {
+				continue
+			}
+			port := fmt.Sprintf("%d:%d", pf.HostPort, pf.ContainerPort)
+			if pf.HostIP != "" {
+				port = pf.HostIP + "/" + port
+			}
+			ports = append(ports, port)
+		}
+		if len(ports) == 0 {
+			ports = []string{"none"}
+		}
+		for _, port := range ports {
+			args = append(args, "--"+proto+"-ports", port)
+		}
+	}
+	return append(args, strconv.Itoa(nspid))
+}
+
+func (h *pasta) remove(n *network, nspid int) error {
+	return stopNetworkHelper(n.stateDir, "pasta")
+}
+
+func (h *pasta) initialize(n *network) error {
+	return nil
+}
+
+func (h *pasta) attach(n *configs.Network) error {
+	return nil
+}
+
+func (h *pasta) detach(n *configs.Network) error {
+	return nil
+}
+
+// slirp4netns is a network strategy that connects the container to the
+// network of the host using slirp4netns(1), with a tap interface ("tap0" by
+// default) in the 10.0.2.0/24 network. It is run by the user running runc, so
+// that it works in rootless containers.
+type slirp4netns struct {
+}
+
+func (h *slirp4netns) create(n *network, nspid int) error {
+	path, err := exec.LookPath("slirp4netns")
+	if err != nil {
+		return err
+	}
+	logFile, err := os.Create(filepath.Join(n.stateDir, "slirp4netns.log"))
+	if err != nil {
+		return err
+	}
+	defer logFile.Close()
+	readyR, readyW, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	defer readyR.Close()
+
+	// The API socket is always enabled, so that the port forwards can be
+	// updated while the container is running.
+	apiSocket := slirp4netnsAPISocket(n.stateDir)
+	// slirp4netns keeps running in the foreground, so it is started in its
+	// own session, to outlive runc.
+	cmd := exec.Command(path, slirp4netnsArgs(&n.Network, apiSocket, nspid)...)
+	cmd.ExtraFiles = []*os.File{readyW}
+	cmd.Stdout = logFile
+	cmd.Stderr = logFile
+	cmd.SysProcAttr = &unix.SysProcAttr{Setsid: true}
+	err = cmd.Start()
+	readyW.Close()
+	if err != nil {
+		return err
+	}
+	if err := waitReady(readyR, networkHelperTimeout); err != nil {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+		return networkHelperError("slirp4netns", err, logFile.Name())
+	}
+	pidFile := networkHelperPidFile(n.stateDir, "slirp4netns")
+	if err := ioutil.WriteFile(pidFile, []byte(strconv.Itoa(cmd.Process.Pid)), 0o600); err != nil {
+		_ = cmd.Process.Kill()
+		return err
+	}
+	_ = cmd.Process.Release()
+
+	for _, pf := range n.PortForwards {
+		if err := slirp4netnsAddHostfwd(apiSocket, pf); err != nil {
+			_ = stopNetworkHelper(n.stateDir, "slirp4netns")
+			return err
+		}
+	}
+	return nil
+}
+
+// slirp4netnsArgs returns the arguments of slirp4netns to set up the network
+// namespace of the process nspid, with the API socket apiSocket. The file
+// descriptor 3 is the ready one.
+func slirp4netnsArgs(n *configs.Network, apiSocket string, nspid int) []string {
+	mtu := n.Mtu
+	if mtu == 0 {
+		mtu = 65520
+	}
+	name := n.Name
+	if name == "" {
+		name = "tap0"
+	}
+	return []string{
+		"--configure", "--mtu", strconv.Itoa(mtu), "--ready-fd", "3", "--disable-host-loopback",
+		"--api-socket", apiSocket, strconv.Itoa(nspid), name,
+	}
+}
+
+// slirp4netnsAPISocket returns the path of the API socket of slirp4netns, in
+// the state directory of the container.
+func slirp4netnsAPISocket(stateDir string) string {
+	return filepath.Join(stateDir, "slirp4netns.sock")
+}
+
+// slirp4netnsHostfwd is a port forward of the API of slirp4netns.
+type slirp4netnsHostfwd struct {
+	ID        int    `json:"id,omitempty"`
+	Proto     string `json:"proto"`
+	HostAddr  string `json:"host_addr,omitempty"`
+	HostPort  uint16 `json:"host_port"`
+	GuestPort uint16 `json:"guest_port"`
+}
+
+// slirp4netnsAddHostfwd forwards a port of the host to the container, using
+// the API socket of slirp4netns.
+func slirp4netnsAddHostfwd(apiSocket string, pf configs.PortForward) error {
+	args := slirp4netnsHostfwd{
+		Proto:     pf.Protocol,
+		HostAddr:  pf.HostIP,
+		HostPort:  pf.HostPort,
+		GuestPort: pf.ContainerPort,
+	}
+	if err := slirp4netnsRequest(apiSocket, "add_hostfwd", args, nil); err != nil {
+		return fmt.Errorf("error forwarding port %s: %w", pf, err)
+	}
+	return nil
+}
+
+// slirp4netnsRemoveHostfwd stops forwarding a port of the host to the
+// container, using the API socket of slirp4netns.
+func slirp4netnsRemoveHostfwd(apiSocket string, pf configs.PortForward) error {
+	var list struct {
+		Entries []slirp4netnsHostfwd `json:"entries"`
+	}
+	if err := slirp4netnsRequest(apiSocket, "list_hostfwd", nil, &list); err != nil {
+		return fmt.Errorf("error listing forwarded ports: %w", err)
+	}
+	for _, e := range list.Entries {
+		// slirp4netns reports the unspecified address if none was given.
+		hostAddr := e.HostAddr
+		if hostAddr == "0.0.0.0" {
+			hostAddr = ""
+		}
+		if e.Proto != pf.Protocol || hostAddr != pf.HostIP || e.HostPort != pf.HostPort || e.GuestPort != pf.ContainerPort {
+			continue
+		}
+		args := struct {
+			ID int `json:"id"`
+		}{e.ID}
+		if err := slirp4netnsRequest(apiSocket, "remove_hostfwd", args, nil); err != nil {
+			return fmt.Errorf("error removing port forward %s: %w", pf, err)
+		}
+	}
+	return nil
+}
+
+// slirp4netnsRequest executes a command of the API of slirp4netns, with the
+// arguments args if not nil, and decodes its result into result if not nil.
+func slirp4netnsRequest(apiSocket, execute string, args, result interface{}) error {
+	req, err := json.Marshal(struct {
+		Execute   string      `json:"execute"`
+		Arguments interface{} `json:"arguments,omitempty"`
+	}{execute, args})
+	if err != nil {
+		return err
+	}
+	conn, err := net.DialTimeout("unix", apiSocket, networkHelperTimeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if err := conn.SetDeadline(time.Now().Add(networkHelperTimeout)); err != nil {
+		return err
+	}
+	if _, err := conn.Write(req); err != nil {
+		return err
+	}
+	// slirp4netns handles a single request per connection.
+	if err := conn.(*net.UnixConn).CloseWrite(); err != nil {
+		return err
+	}
+	var resp struct {
+		Return json.RawMessage `json:"return"`
+		Error  *struct {
+			Desc string `json:"desc"`
+		} `json:"error"`
+	}
+	if err := json.NewDecoder(conn).Decode(&resp); err != nil {
+		return fmt.Errorf("invalid response of slirp4netns: %w", err)
+	}
+	if resp.Error != nil {
+		return errors.New(resp.Error.Desc)
+	}
+	if result != nil {
+		if err := json.Unmarshal(resp.Return, result); err != nil {
+			return fmt.Errorf("invalid response of slirp4netns: %w", err)
+		}
+	}
+	return nil
+}
+
+func (h *slirp4netns) remove(n *network, nspid int) error {
+	return stopNetworkHelper(n.stateDir, "slirp4netns")
+}
+
+func (h *slirp4netns) initialize(n *network) error {
+	return nil
+}
+
+func (h *slirp4netns) attach(n *configs.Network) error {
+	return nil
+}
+
+func (h *slirp4netns) detach(n *configs.Network) error {
+	return nil
+}
+
+// helperNetwork returns the pasta or slirp4netns network of networks, if any.
+func helperNetwork(networks []*configs.Network) *configs.Network {
+	for _, n := range networks {
+		if isNetworkHelper(n.Type) {
+			return n
+		}
+	}
+	return nil
+}
+
+// portForwardChanges returns the ports forwarded to the running container
+// by config but not by its current config, and the other way around. Only
+// the ports forwarded by slirp4netns can be updated.
+func (c *linuxContainer) portForwardChanges(config *configs.Config) (added, removed []configs.PortForward, err error) {
+	if len(diffPortForwards(config.PortForwards, c.config.PortForwards)) > 0 ||
+		len(diffPortForwards(c.config.PortForwards, config.PortForwards)) > 0 {
+		return nil, nil, errors.New("the ports passed to the container as sockets can't be updated")
+	}
+	n, old := helperNetwork(config.Networks), helperNetwork(c.config.Networks)
+	if n == nil || old == nil {
+		return nil, nil, nil
+	}
+	added = diffPortForwards(n.PortForwards, old.PortForwards)
+	removed = diffPortForwards(old.PortForwards, n.PortForwards)
+	if len(added) == 0 && len(removed) == 0 {
+		return nil, nil, nil
+	}
+	if n.Type != "slirp4netns" {
+		return nil, nil, fmt.Errorf("the ports forwarded by %s can't be updated while the container is running", n.Type)
+	}
+	return added, removed, nil
+}
+
+// setPortForwards stops forwarding the removed ports to the running
+// container, and starts forwarding the added ones. If this fails, the ports
+// already removed or added are added or removed back, so that the ports
+// forwarded by slirp4netns still match the config of the container.
+func (c *linuxContainer) setPortForwards(added, removed []configs.PortForward) (err error) {
+	if len(added) == 0 && len(removed) == 0 {
+		return nil
+	}
+	apiSocket := slirp4netnsAPISocket(c.root)
+	var undo []func() error
+	defer func() {
+		if err == nil {
+			return
+		}
+		for i := len(undo) - 1; i >= 0; i-- {
+			if err2 := undo[i](); err2 != nil {
+				logrus.Warnf("Setting back port forwards failed due to error: %v, your state.json and actual configs might be inconsistent.", err2)
+			}
+		}
+	}()
+	for _, pf := range removed {
+		if err := slirp4netnsRemoveHostfwd(apiSocket, pf); err != nil {
+			return err
+		}
+		pf := pf
+		undo = append(undo, func() error { return slirp4netnsAddHostfwd(apiSocket, pf) })
+	}
+	for _, pf := range added {
+		if err := slirp4netnsAddHostfwd(apiSocket, pf); err != nil {
+			return err
+		}
+		pf := pf
+		undo = append(undo, func() error { return slirp4netnsRemoveHostfwd(apiSocket, pf) })
+	}
+	return nil
+}
+
+// diffPortForwards returns the port forwards of a which are not in b.
+func diffPortForwards(a, b []configs.PortForward) []configs.PortForward {
+	var diff []configs.PortForward
+next:
+	for _, pf := range a {
+		for _, o := range b {
+			if pf == o {
+				continue next
+			}
+		}
+		diff = append(diff, pf)
+	}
+	return diff
+}
+
+// networkHelperPidFile returns the path of the pid file of the networking
+// helper of type tpe, in the state directory of the container.
+func networkHelperPidFile(stateDir, tpe string) string {
+	return filepath.Join(stateDir, tpe+".pid")
+}
+
+// stopNetworkHelper terminates the networking helper of type tpe recorded in
+// the state directory of the container, if it is still running.
+func stopNetworkHelper(stateDir, tpe string) error {
+	pidFile := networkHelperPidFile(stateDir, tpe)
+	data, err := ioutil.ReadFile(pidFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	defer os.Remove(pidFile)
+	pid, err := strconv.Atoi(string(bytes.TrimSpace(data)))
+	if err != nil {
+		return fmt.Errorf("invalid pid file %s: %w", pidFile, err)
+	}
+	// The pid may have been reused if the helper exited on its own (such as
+	// once the network namespace was gone), and pasta may run as a variant
+	// such as pasta.avx2.
+	comm, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/comm", pid))
+	if err != nil || !strings.HasPrefix(string(comm), tpe) {
+		return nil
+	}
+	if err := unix.Kill(pid, unix.SIGTERM); err != nil && err != unix.ESRCH {
+		return fmt.Errorf("error stopping %s: %w", tpe, err)
+	}
+	return nil
+}
+
+// stopNetworkHelpers terminates the networking helpers of the container.
+func stopNetworkHelpers(c *linuxContainer) error {
+	for _, n := range c.config.Networks {
+		if isNetworkHelper(n.Type) {
+			if err := stopNetworkHelper(c.root, n.Type); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// runWithTimeout runs cmd, and kills it if it does not exit in time.
+func runWithTimeout(cmd *exec.Cmd, timeout time.Duration) error {
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	timer := time.AfterFunc(timeout, func() {
+		_ = cmd.Process.Kill()
+	})
+	defer timer.Stop()
+	return cmd.Wait()
+}
+
+// waitReady waits for a byte to be written to the ready pipe r.
+func waitReady(r *os.File, timeout time.Duration) error {
+	if err := r.SetReadDeadline(time.Now().Add(timeout)); err != nil {
+		return err
+	}
+	b := make([]byte, 1)
+	if _, err := r.Read(b); err != nil {
+		if os.IsTimeout(err) {
+			return errors.New("timed out waiting for the network to be set up")
+		}
+		return errors.New("exited before setting up the network")
+	}
+	return nil
+}
+
+// networkHelperError returns the error of the networking helper name, along
+// with the last line of its log file.
+func networkHelperError(name string, err error, logPath string) error {
+	if data, _ := ioutil.ReadFile(logPath); len(data) > 0 {
+		lines := strings.Split(string(bytes.TrimSpace(data)), "\n")
+		return fmt.Errorf("%s: %w: %s", name, err, lines[len(lines)-1])
+	}
+	return fmt.Errorf("%s: %w", name, err)
+}
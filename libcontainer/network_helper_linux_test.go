@@ -0,0 +1,269 @@
+// +build linux
+
+package libcontainer
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/opencontainers/runc/libcontainer/configs"
+)
+
+func TestPastaArgs(t *testing.T) {
+	n := &configs.Network{
+		Type: "pasta",
+		Name: "eth0",
+		PortForwards: []configs.PortForward{
+			{Protocol: "tcp", HostPort: 8080, ContainerPort: 80},
+			{Protocol: "tcp", HostIP: "127.0.0.1", HostPort: 8443, ContainerPort: 443},
+		},
+	}
+	expected := []string{
+		"--config-net", "--pid", "/run/pasta.pid", "--ns-ifname", "eth0",
+		"--tcp-ports", "8080:80", "--tcp-ports", "127.0.0.1/8443:443", "--udp-ports", "none",
+		"1234",
+	}
+	if args := pastaArgs(n, "/run/pasta.pid", 1234); !reflect.DeepEqual(args, expected) {
+		t.Errorf("expected %q, got %q", expected, args)
+	}
+}
+
+func TestSlirp4netnsArgs(t *testing.T) {
+	n := &configs.Network{Type: "slirp4netns", Name: "eth0", Mtu: 1500}
+	expected := []string{
+		"--configure", "--mtu", "1500", "--ready-fd", "3", "--disable-host-loopback",
+		"--api-socket", "/run/slirp.sock", "1234", "eth0",
+	}
+	if args := slirp4netnsArgs(n, "/run/slirp.sock", 1234); !reflect.DeepEqual(args, expected) {
+		t.Errorf("expected %q, got %q", expected, args)
+	}
+}
+
+func TestSlirp4netnsAddHostfwd(t *testing.T) {
+	dir, err := ioutil.TempDir("", "runc-slirp4netns-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	sock := filepath.Join(dir, "api.sock")
+	l, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	reqCh := make(chan map[string]interface{}, 2)
+	go func() {
+		for _, resp := range []string{`{"return": {"id": 1}}`, `{"error": {"desc": "bad request"}}`} {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			var req map[string]interface{}
+			_ = json.NewDecoder(conn).Decode(&req)
+			reqCh <- req
+			_, _ = conn.Write([]byte(resp))
+			conn.Close()
+		}
+	}()
+
+	pf := configs.PortForward{Protocol: "udp", HostPort: 5353, ContainerPort: 53}
+	if err := slirp4netnsAddHostfwd(sock, pf); err != nil {
+		t.Fatal(err)
+	}
+	req := <-reqCh
+	args, _ := req["arguments"].(map[string]interface{})
+	if req["execute"] != "add_hostfwd" || args["proto"] != "udp" || args["host_port"] != 5353.0 || args["guest_port"] != 53.0 {
+		t.Errorf("unexpected request %v", req)
+	}
+
+	err = slirp4netnsAddHostfwd(sock, pf)
+	if err == nil || !strings.Contains(err.Error(), "bad request") {
+		t.Errorf("expected the error of slirp4netns, got %v", err)
+	}
+}
+
+func TestSlirp4netnsNetwork(t *testing.T) {
+	dir, err := ioutil.TempDir("", "runc-slirp4netns-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// A fake slirp4netns, which is ready once it recorded its arguments.
+	script := "#!/bin/sh\necho \"$@\" > " + filepath.Join(dir, "args") + "\necho 1 >&3\nwhile :; do sleep 1; done\n"
+	if err := ioutil.WriteFile(filepath.Join(dir, "slirp4netns"), []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	path := os.Getenv("PATH")
+	os.Setenv("PATH", dir+":"+path)
+	defer os.Setenv("PATH", path)
+
+	n := &network{
+		Network:  configs.Network{Type: "slirp4netns"},
+		stateDir: dir,
+	}
+	h := &slirp4netns{}
+	if err := h.create(n, 1234); err != nil {
+		t.Fatal(err)
+	}
+	args, err := ioutil.ReadFile(filepath.Join(dir, "args"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(strings.TrimSpace(string(args)), "1234 tap0") {
+		t.Errorf("unexpected arguments %q", args)
+	}
+	data, err := ioutil.ReadFile(networkHelperPidFile(dir, "slirp4netns"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pid, err := strconv.Atoi(string(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := h.remove(n, 1234); err != nil {
+		t.Fatal(err)
+	}
+	// The helper was released, so it is never reaped, and remains a zombie
+	// once stopped.
+	for i := 0; i < 100; i++ {
+		stat, err := ioutil.ReadFile("/proc/" + strconv.Itoa(pid) + "/stat")
+		if err != nil || strings.Contains(string(stat), ") Z ") {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("expected slirp4netns to be stopped")
+}
+
+func TestSlirp4netnsNetworkExited(t *testing.T) {
+	dir, err := ioutil.TempDir("", "runc-slirp4netns-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	script := "#!/bin/sh\necho 'cannot join the network namespace' >&2\nexit 1\n"
+	if err := ioutil.WriteFile(filepath.Join(dir, "slirp4netns"), []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	path := os.Getenv("PATH")
+	os.Setenv("PATH", dir+":"+path)
+	defer os.Setenv("PATH", path)
+
+	n := &network{
+		Network:  configs.Network{Type: "slirp4netns"},
+		stateDir: dir,
+	}
+	err = (&slirp4netns{}).create(n, 1234)
+	if err == nil || !strings.Contains(err.Error(), "cannot join the network namespace") {
+		t.Fatalf("expected the error of slirp4netns, got %v", err)
+	}
+}
+
+func TestSetPortForwards(t *testing.T) {
+	dir, err := ioutil.TempDir("", "runc-slirp4netns-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	l, err := net.Listen("unix", slirp4netnsAPISocket(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	// A fake API of slirp4netns, with a single port forward, which fails
+	// to forward the host port 9090.
+	reqCh := make(chan string, 10)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			var req struct {
+				Execute   string             `json:"execute"`
+				Arguments slirp4netnsHostfwd `json:"arguments"`
+			}
+			_ = json.NewDecoder(conn).Decode(&req)
+			reqCh <- req.Execute
+			resp := `{"return": {}}`
+			switch {
+			case req.Execute == "list_hostfwd":
+				resp = `{"return": {"entries": [{"id": 4, "proto": "tcp", "host_addr": "0.0.0.0", "host_port": 8080, "guest_addr": "10.0.2.100", "guest_port": 80}]}}`
+			case req.Execute == "add_hostfwd" && req.Arguments.HostPort == 9090:
+				resp = `{"error": {"desc": "bad request: add_hostfwd: failed to expose port"}}`
+			}
+			_, _ = conn.Write([]byte(resp))
+			conn.Close()
+		}
+	}()
+	requests := func() []string {
+		var reqs []string
+		for len(reqCh) > 0 {
+			reqs = append(reqs, <-reqCh)
+		}
+		return reqs
+	}
+
+	old := configs.PortForward{Protocol: "tcp", HostPort: 8080, ContainerPort: 80}
+	c := &linuxContainer{
+		root: dir,
+		config: &configs.Config{
+			Networks: []*configs.Network{{Type: "slirp4netns", PortForwards: []configs.PortForward{old}}},
+		},
+	}
+	config := &configs.Config{
+		Networks: []*configs.Network{
+			{Type: "slirp4netns", PortForwards: []configs.PortForward{{Protocol: "udp", HostPort: 5353, ContainerPort: 53}}},
+		},
+	}
+	added, removed, err := c.portForwardChanges(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.setPortForwards(added, removed); err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"list_hostfwd", "remove_hostfwd", "add_hostfwd"}
+	if reqs := requests(); !reflect.DeepEqual(reqs, expected) {
+		t.Errorf("expected the requests %q, got %q", expected, reqs)
+	}
+
+	// If forwarding a port fails, the ports already removed and added are
+	// added and removed back (the fake API doesn't list the added port, so
+	// there is nothing to remove).
+	added = append(added, configs.PortForward{Protocol: "tcp", HostPort: 9090, ContainerPort: 90})
+	if err := c.setPortForwards(added, removed); err == nil {
+		t.Fatal("expected an error forwarding the host port 9090")
+	}
+	expected = []string{
+		"list_hostfwd", "remove_hostfwd", "add_hostfwd", "add_hostfwd",
+		"list_hostfwd", "add_hostfwd",
+	}
+	if reqs := requests(); !reflect.DeepEqual(reqs, expected) {
+		t.Errorf("expected the requests %q, got %q", expected, reqs)
+	}
+
+	// The ports forwarded by pasta, or passed as sockets, can't be updated.
+	c.config.Networks[0].Type = "pasta"
+	config.Networks[0].Type = "pasta"
+	if _, _, err := c.portForwardChanges(config); err == nil {
+		t.Error("expected an error updating the ports of pasta")
+	}
+	config = &configs.Config{PortForwards: []configs.PortForward{{Protocol: "tcp", HostPort: 80, ContainerPort: 80}}}
+	if _, _, err := c.portForwardChanges(config); err == nil {
+		t.Error("expected an error updating the ports passed as sockets")
+	}
+}
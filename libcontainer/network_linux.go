@@ -4,24 +4,44 @@ package libcontainer
 
 import (
 	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"io/ioutil"
+	"net"
+	"os"
 	"path/filepath"
+	"runtime"
 	"strconv"
 
+	"github.com/opencontainers/runc/libcontainer/cgroups"
+	"github.com/opencontainers/runc/libcontainer/cgroups/ebpf"
 	"github.com/opencontainers/runc/libcontainer/configs"
 	"github.com/opencontainers/runc/types"
 	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
 )
 
 var strategies = map[string]networkStrategy{
 	"loopback": &loopback{},
+	"veth":     &veth{},
+	"netdev":   &netdev{},
+
+	"pasta":       &pasta{},
+	"slirp4netns": &slirp4netns{},
 }
 
 // networkStrategy represents a specific network configuration for
 // a container's networking stack
 type networkStrategy interface {
+	// create sets up the interface on the host, and moves it into the
+	// network namespace of the process nspid.
 	create(*network, int) error
+	// remove undoes create, if the container (whose init is nspid) could
+	// not be started.
+	remove(*network, int) error
+	// initialize configures the interface inside the container.
 	initialize(*network) error
 	detach(*configs.Network) error
 	attach(*configs.Network) error
@@ -37,6 +57,15 @@ func getStrategy(tpe string) (networkStrategy, error) {
 	return s, nil
 }
 
+// networkName returns the description of a network for the errors, such as
+// "veth network eth0".
+func networkName(n *configs.Network) string {
+	if n.Name == "" {
+		return n.Type + " network"
+	}
+	return n.Type + " network " + n.Name
+}
+
 // Returns the network statistics for the network interfaces represented by the NetworkRuntimeInfo.
 func getNetworkInterfaceStats(interfaceName string) (*types.NetworkInterface, error) {
 	out := &types.NetworkInterface{Name: interfaceName}
@@ -90,6 +119,10 @@ func (l *loopback) create(n *network, nspid int) error {
 	return nil
 }
 
+func (l *loopback) remove(n *network, nspid int) error {
+	return nil
+}
+
 func (l *loopback) initialize(config *network) error {
 	return netlink.LinkSetUp(&netlink.Device{LinkAttrs: netlink.LinkAttrs{Name: "lo"}})
 }
@@ -101,3 +134,299 @@ func (l *loopback) attach(n *configs.Network) (err error) {
 func (l *loopback) detach(n *configs.Network) (err error) {
 	return nil
 }
+
+// veth is a network strategy that creates a veth pair, one end of which
+// resides on the host (attached to a bridge, if any), and the other is placed
+// inside the container's namespace.
+type veth struct {
+}
+
+func (v *veth) create(n *network, nspid int) (err error) {
+	tmpName, err := tempVethPeerName()
+	if err != nil {
+		return err
+	}
+	n.TempVethPeerName = tmpName
+	veth := &netlink.Veth{
+		LinkAttrs: netlink.LinkAttrs{
+			Name:   n.HostInterfaceName,
+			MTU:    n.Mtu,
+			TxQLen: n.TxQueueLen,
+		},
+		PeerName: n.TempVethPeerName,
+	}
+	if err := netlink.LinkAdd(veth); err != nil {
+		return fmt.Errorf("error creating veth pair %s: %w", n.HostInterfaceName, err)
+	}
+	defer func() {
+		if err != nil {
+			_ = netlink.LinkDel(veth)
+		}
+	}()
+	if err := v.attach(&n.Network); err != nil {
+		return err
+	}
+	child, err := netlink.LinkByName(n.TempVethPeerName)
+	if err != nil {
+		return err
+	}
+	return netlink.LinkSetNsPid(child, nspid)
+}
+
+func (v *veth) remove(n *network, nspid int) error {
+	// Removing the host end also removes the peer, wherever it is.
+	host, err := netlink.LinkByName(n.HostInterfaceName)
+	if err != nil {
+		return err
+	}
+	return netlink.LinkDel(host)
+}
+
+func (v *veth) initialize(n *network) error {
+	if n.TempVethPeerName == "" {
+		return errors.New("veth peer is not specified")
+	}
+	child, err := netlink.LinkByName(n.TempVethPeerName)
+	if err != nil {
+		return err
+	}
+	if err := netlink.LinkSetName(child, n.Name); err != nil {
+		return fmt.Errorf("error renaming %s to %s: %w", n.TempVethPeerName, n.Name, err)
+	}
+	return configureInterface(n)
+}
+
+// attach a container network interface to an external network
+func (v *veth) attach(n *configs.Network) error {
+	host, err := netlink.LinkByName(n.HostInterfaceName)
+	if err != nil {
+		return err
+	}
+	if n.Bridge != "" {
+		brl, err := netlink.LinkByName(n.Bridge)
+		if err != nil {
+			return fmt.Errorf("bridge %s: %w", n.Bridge, err)
+		}
+		br, ok := brl.(*netlink.Bridge)
+		if !ok {
+			return fmt.Errorf("%s is not a bridge but a %s", n.Bridge, brl.Type())
+		}
+		if err := netlink.LinkSetMaster(host, br); err != nil {
+			return err
+		}
+		if n.HairpinMode {
+			if err := netlink.LinkSetHairpin(host, true); err != nil {
+				return err
+			}
+		}
+	}
+	return netlink.LinkSetUp(host)
+}
+
+// detach a container network interface from its bridge, if any
+func (v *veth) detach(n *configs.Network) error {
+	if n.Bridge == "" {
+		return nil
+	}
+	host, err := netlink.LinkByName(n.HostInterfaceName)
+	if err != nil {
+		return err
+	}
+	return netlink.LinkSetNoMaster(host)
+}
+
+// tempVethPeerName returns a random name for the container end of a veth
+// pair, which must not clash with the host interfaces until it is renamed
+// inside the container.
+func tempVethPeerName() (string, error) {
+	b := make([]byte, 4)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "veth" + hex.EncodeToString(b)[:7], nil
+}
+
+// netdev is a network strategy that moves an existing interface of the host
+// (such as a physical interface, a macvlan or a SR-IOV virtual function)
+// into the container's namespace.
+type netdev struct {
+}
+
+func (d *netdev) create(n *network, nspid int) error {
+	link, err := netlink.LinkByName(n.HostInterfaceName)
+	if err != nil {
+		return err
+	}
+	if err := netlink.LinkSetNsPid(link, nspid); err != nil {
+		return fmt.Errorf("error moving %s to the container: %w", n.HostInterfaceName, err)
+	}
+	return nil
+}
+
+func (d *netdev) remove(n *network, nspid int) error {
+	// Only physical interfaces return to the host once the network
+	// namespace of the container is destroyed, while the virtual ones are
+	// destroyed along with it, so the interface is moved back explicitly.
+	containerNs, err := os.Open(fmt.Sprintf("/proc/%d/ns/net", nspid))
+	if err != nil {
+		return err
+	}
+	defer containerNs.Close()
+
+	// The network namespace can only be joined by a dedicated thread,
+	// which is terminated afterwards.
+	errCh := make(chan error, 1)
+	go func() {
+		// The thread is intentionally never unlocked, so that it exits
+		// along with the goroutine instead of being reused in the
+		// network namespace of the container.
+		runtime.LockOSThread()
+		// The network namespace of the host is the one of this thread,
+		// as the other threads (such as the main one, which can't exit)
+		// may have joined another one.
+		hostNs, err := os.Open("/proc/thread-self/ns/net")
+		if err != nil {
+			errCh <- err
+			return
+		}
+		defer hostNs.Close()
+		if err := unix.Setns(int(containerNs.Fd()), unix.CLONE_NEWNET); err != nil {
+			errCh <- os.NewSyscallError("setns", err)
+			return
+		}
+		// The interface is renamed by initialize, unless it failed
+		// before.
+		var link netlink.Link
+		if n.Name != "" && n.Name != n.HostInterfaceName {
+			link, err = netlink.LinkByName(n.Name)
+		}
+		if link == nil {
+			link, err = netlink.LinkByName(n.HostInterfaceName)
+		}
+		if err != nil {
+			errCh <- err
+			return
+		}
+		if name := link.Attrs().Name; name != n.HostInterfaceName {
+			// The interface gets its name on the host back.
+			if err := netlink.LinkSetDown(link); err != nil {
+				errCh <- err
+				return
+			}
+			if err := netlink.LinkSetName(link, n.HostInterfaceName); err != nil {
+				errCh <- fmt.Errorf("error renaming %s to %s: %w", name, n.HostInterfaceName, err)
+				return
+			}
+		}
+		errCh <- netlink.LinkSetNsFd(link, int(hostNs.Fd()))
+	}()
+	return <-errCh
+}
+
+func (d *netdev) initialize(n *network) error {
+	link, err := netlink.LinkByName(n.HostInterfaceName)
+	if err != nil {
+		return err
+	}
+	if n.Name != "" && n.Name != n.HostInterfaceName {
+		if err := netlink.LinkSetDown(link); err != nil {
+			return err
+		}
+		if err := netlink.LinkSetName(link, n.Name); err != nil {
+			return fmt.Errorf("error renaming %s to %s: %w", n.HostInterfaceName, n.Name, err)
+		}
+	} else {
+		n.Name = n.HostInterfaceName
+	}
+	return configureInterface(n)
+}
+
+func (d *netdev) attach(n *configs.Network) error {
+	return nil
+}
+
+func (d *netdev) detach(n *configs.Network) error {
+	return nil
+}
+
+// configureInterface sets the MAC address, MTU, addresses and gateways of the
+// interface n.Name inside the container, and brings it up.
+func configureInterface(n *network) error {
+	// Get the interface again after it was renamed, as the index changes.
+	link, err := netlink.LinkByName(n.Name)
+	if err != nil {
+		return err
+	}
+	if n.MacAddress != "" {
+		mac, err := net.ParseMAC(n.MacAddress)
+		if err != nil {
+			return err
+		}
+		if err := netlink.LinkSetHardwareAddr(link, mac); err != nil {
+			return err
+		}
+	}
+	if n.Mtu != 0 {
+		if err := netlink.LinkSetMTU(link, n.Mtu); err != nil {
+			return err
+		}
+	}
+	for _, a := range []string{n.Address, n.IPv6Address} {
+		if a == "" {
+			continue
+		}
+		addr, err := netlink.ParseAddr(a)
+		if err != nil {
+			return err
+		}
+		if err := netlink.AddrAdd(link, addr); err != nil {
+			return fmt.Errorf("error adding address %s to %s: %w", a, n.Name, err)
+		}
+	}
+	if err := netlink.LinkSetUp(link); err != nil {
+		return err
+	}
+	for _, g := range []string{n.Gateway, n.IPv6Gateway} {
+		if g == "" {
+			continue
+		}
+		gw := net.ParseIP(g)
+		if gw == nil {
+			return fmt.Errorf("invalid gateway %q", g)
+		}
+		if err := netlink.RouteAdd(&netlink.Route{
+			Scope:     netlink.SCOPE_UNIVERSE,
+			LinkIndex: link.Attrs().Index,
+			Gw:        gw,
+		}); err != nil {
+			return fmt.Errorf("error adding the default route via %s: %w", g, err)
+		}
+	}
+	return nil
+}
+
+// netBandwidthLimit returns the egress bandwidth limit to be used for the
+// networks, i.e. the lowest non-zero one, or 0 if there is none.
+func netBandwidthLimit(networks []*configs.Network) uint64 {
+	var limit uint64
+	for _, n := range networks {
+		if n.BandwidthLimit != 0 && (limit == 0 || n.BandwidthLimit < limit) {
+			limit = n.BandwidthLimit
+		}
+	}
+	return limit
+}
+
+// setNetBandwidthLimit sets the egress bandwidth limit of the processes in
+// the cgroup v2 cgroupPath, or removes it if limit is 0.
+func setNetBandwidthLimit(cgroupPath string, limit uint64) error {
+	if !cgroups.IsCgroup2UnifiedMode() {
+		return errors.New("network bandwidth limit requires cgroup v2")
+	}
+	dirFd, err := unix.Open(cgroupPath, unix.O_DIRECTORY|unix.O_RDONLY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return &os.PathError{Op: "open", Path: cgroupPath, Err: err}
+	}
+	defer unix.Close(dirFd) //nolint: errcheck
+	return ebpf.SetCgroupBandwidthLimit(dirFd, limit)
+}
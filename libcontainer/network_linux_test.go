@@ -0,0 +1,226 @@
+// +build linux
+
+package libcontainer
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"testing"
+
+	"github.com/opencontainers/runc/libcontainer/configs"
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+)
+
+func TestNetBandwidthLimit(t *testing.T) {
+	for _, tc := range []struct {
+		limits   []uint64
+		expected uint64
+	}{
+		{limits: nil, expected: 0},
+		{limits: []uint64{0}, expected: 0},
+		{limits: []uint64{1000}, expected: 1000},
+		{limits: []uint64{0, 2000, 1000}, expected: 1000},
+	} {
+		var networks []*configs.Network
+		for _, l := range tc.limits {
+			networks = append(networks, &configs.Network{Type: "loopback", BandwidthLimit: l})
+		}
+		if limit := netBandwidthLimit(networks); limit != tc.expected {
+			t.Errorf("%v: expected %d, got %d", tc.limits, tc.expected, limit)
+		}
+	}
+}
+
+// startInNetns starts a process in a new network namespace, whose pid is
+// returned along with a function to run fn in its network namespace.
+func startInNetns(t *testing.T) (*exec.Cmd, func(fn func() error) error) {
+	cmd := exec.Command("sleep", "30")
+	cmd.SysProcAttr = &unix.SysProcAttr{Cloneflags: unix.CLONE_NEWNET}
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	inNetns := func(fn func() error) error {
+		errCh := make(chan error, 1)
+		go func() {
+			// Never unlocked, so that the thread exits with the goroutine.
+			runtime.LockOSThread()
+			ns, err := os.Open(fmt.Sprintf("/proc/%d/ns/net", cmd.Process.Pid))
+			if err != nil {
+				errCh <- err
+				return
+			}
+			defer ns.Close()
+			if err := unix.Setns(int(ns.Fd()), unix.CLONE_NEWNET); err != nil {
+				errCh <- err
+				return
+			}
+			errCh <- fn()
+		}()
+		return <-errCh
+	}
+	return cmd, inNetns
+}
+
+func TestVethNetwork(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("test requires root")
+	}
+	cmd, inNetns := startInNetns(t)
+	defer cmd.Wait()         //nolint: errcheck
+	defer cmd.Process.Kill() //nolint: errcheck
+
+	n := &network{
+		Network: configs.Network{
+			Type:              "veth",
+			Name:              "eth0",
+			HostInterfaceName: "runc-test-veth",
+			Address:           "10.199.0.2/24",
+			Gateway:           "10.199.0.1",
+			Mtu:               1400,
+		},
+	}
+	v := &veth{}
+	if err := v.create(n, cmd.Process.Pid); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := netlink.LinkByName(n.HostInterfaceName); err != nil {
+		t.Fatalf("host end of the veth pair: %v", err)
+	}
+	err := inNetns(func() error {
+		if err := v.initialize(n); err != nil {
+			return err
+		}
+		link, err := netlink.LinkByName("eth0")
+		if err != nil {
+			return err
+		}
+		if mtu := link.Attrs().MTU; mtu != 1400 {
+			return fmt.Errorf("expected mtu 1400, got %d", mtu)
+		}
+		addrs, err := netlink.AddrList(link, netlink.FAMILY_V4)
+		if err != nil {
+			return err
+		}
+		if len(addrs) != 1 || addrs[0].IPNet.String() != "10.199.0.2/24" {
+			return fmt.Errorf("expected address 10.199.0.2/24, got %v", addrs)
+		}
+		routes, err := netlink.RouteList(link, netlink.FAMILY_V4)
+		if err != nil {
+			return err
+		}
+		for _, r := range routes {
+			if r.Dst == nil && r.Gw.String() == "10.199.0.1" {
+				return nil
+			}
+		}
+		return fmt.Errorf("expected a default route via 10.199.0.1, got %v", routes)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := v.remove(n, cmd.Process.Pid); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := netlink.LinkByName(n.HostInterfaceName); err == nil {
+		t.Fatal("expected the veth pair to be removed")
+	}
+}
+
+func TestNetdevNetworkRemove(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("test requires root")
+	}
+	cmd, inNetns := startInNetns(t)
+	defer cmd.Wait()         //nolint: errcheck
+	defer cmd.Process.Kill() //nolint: errcheck
+
+	pair := &netlink.Veth{
+		LinkAttrs: netlink.LinkAttrs{Name: "runc-test-a"},
+		PeerName:  "runc-test-b",
+	}
+	if err := netlink.LinkAdd(pair); err != nil {
+		t.Fatal(err)
+	}
+	defer netlink.LinkDel(pair) //nolint: errcheck
+
+	n := &network{
+		Network: configs.Network{
+			Type:              "netdev",
+			HostInterfaceName: "runc-test-b",
+		},
+	}
+	d := &netdev{}
+	if err := d.create(n, cmd.Process.Pid); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := netlink.LinkByName(n.HostInterfaceName); err == nil {
+		t.Fatal("expected the interface to be moved to the container")
+	}
+	err := inNetns(func() error {
+		_, err := netlink.LinkByName(n.HostInterfaceName)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := d.remove(n, cmd.Process.Pid); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := netlink.LinkByName(n.HostInterfaceName); err != nil {
+		t.Fatalf("expected the interface to be moved back to the host: %v", err)
+	}
+}
+
+func TestNetdevNetworkRemoveRenamed(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("test requires root")
+	}
+	cmd, inNetns := startInNetns(t)
+	defer cmd.Wait()         //nolint: errcheck
+	defer cmd.Process.Kill() //nolint: errcheck
+
+	pair := &netlink.Veth{
+		LinkAttrs: netlink.LinkAttrs{Name: "runc-test-a"},
+		PeerName:  "runc-test-b",
+	}
+	if err := netlink.LinkAdd(pair); err != nil {
+		t.Fatal(err)
+	}
+	defer netlink.LinkDel(pair) //nolint: errcheck
+
+	n := &network{
+		Network: configs.Network{
+			Type:              "netdev",
+			Name:              "eth1",
+			HostInterfaceName: "runc-test-b",
+		},
+	}
+	d := &netdev{}
+	if err := d.create(n, cmd.Process.Pid); err != nil {
+		t.Fatal(err)
+	}
+	err := inNetns(func() error {
+		if err := d.initialize(n); err != nil {
+			return err
+		}
+		_, err := netlink.LinkByName("eth1")
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The interface renamed in the container is moved back to the host,
+	// with its name on the host.
+	if err := d.remove(n, cmd.Process.Pid); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := netlink.LinkByName(n.HostInterfaceName); err != nil {
+		t.Fatalf("expected the interface to be moved back to the host: %v", err)
+	}
+}
@@ -3,15 +3,22 @@
 package libcontainer
 
 import (
-	"errors"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/opencontainers/runc/libcontainer/cgroups"
 	"golang.org/x/sys/unix"
 )
 
+// errMemoryControllerMissing is returned if the container has no cgroup v1
+// memory controller.
+var errMemoryControllerMissing = fmt.Errorf("memory controller missing: %w", cgroups.ErrV1NoController)
+
 type PressureLevel uint
 
 const (
@@ -20,15 +27,97 @@ const (
 	CriticalPressure
 )
 
-func registerMemoryEvent(cgDir string, evName string, arg string) (<-chan struct{}, error) {
+// PSITrigger is a pressure stall information (PSI) trigger, which fires when
+// the tasks of a cgroup are stalled on a resource for at least Threshold
+// within any Window. See https://www.kernel.org/doc/html/latest/accounting/psi.html.
+type PSITrigger struct {
+	// Resource is the resource to monitor: "cpu", "memory" or "io".
+	Resource string
+	// Full selects the "full" stall type (all the non-idle tasks stalled at
+	// once) instead of "some" (at least one task stalled).
+	Full bool
+	// Threshold is the stall time which fires the trigger.
+	Threshold time.Duration
+	// Window is the time window the stall time is tracked over. The kernel
+	// requires it to be between 500ms and 10s.
+	Window time.Duration
+}
+
+// ParsePSITrigger parses a PSI trigger in the form
+// <resource>=<some|full>,<threshold>/<window>, such as "memory=some,150ms/1s".
+func ParsePSITrigger(s string) (PSITrigger, error) {
+	var t PSITrigger
+	parts := strings.SplitN(s, "=", 2)
+	if len(parts) != 2 {
+		return t, fmt.Errorf("invalid PSI trigger %q: expected <resource>=<some|full>,<threshold>/<window>", s)
+	}
+	t.Resource = parts[0]
+	switch t.Resource {
+	case "cpu", "memory", "io":
+	default:
+		return t, fmt.Errorf("invalid PSI trigger %q: unknown resource %q", s, t.Resource)
+	}
+	parts = strings.SplitN(parts[1], ",", 2)
+	if len(parts) != 2 {
+		return t, fmt.Errorf("invalid PSI trigger %q: expected <resource>=<some|full>,<threshold>/<window>", s)
+	}
+	switch parts[0] {
+	case "some":
+	case "full":
+		t.Full = true
+	default:
+		return t, fmt.Errorf("invalid PSI trigger %q: unknown stall type %q", s, parts[0])
+	}
+	parts = strings.SplitN(parts[1], "/", 2)
+	if len(parts) != 2 {
+		return t, fmt.Errorf("invalid PSI trigger %q: expected <resource>=<some|full>,<threshold>/<window>", s)
+	}
+	var err error
+	if t.Threshold, err = time.ParseDuration(parts[0]); err != nil {
+		return t, fmt.Errorf("invalid PSI trigger %q: %w", s, err)
+	}
+	if t.Window, err = time.ParseDuration(parts[1]); err != nil {
+		return t, fmt.Errorf("invalid PSI trigger %q: %w", s, err)
+	}
+	if t.Threshold <= 0 || t.Threshold > t.Window {
+		return t, fmt.Errorf("invalid PSI trigger %q: threshold must be positive and not exceed the window", s)
+	}
+	return t, nil
+}
+
+// String returns t in the form accepted by ParsePSITrigger.
+func (t PSITrigger) String() string {
+	return fmt.Sprintf("%s=%s,%s/%s", t.Resource, t.stallType(), t.Threshold, t.Window)
+}
+
+func (t PSITrigger) stallType() string {
+	if t.Full {
+		return "full"
+	}
+	return "some"
+}
+
+// OOMKillEvent describes processes killed by the OOM killer in a container.
+type OOMKillEvent struct {
+	// Count is the number of OOM kills since the previous event.
+	Count uint64
+	// Total is the number of OOM kills since the container's cgroup was
+	// created.
+	Total uint64
+}
+
+// watchMemoryEvent registers an eventfd for evName (with an optional arg)
+// in cgDir, and calls fn every time the event fires. Once the cgroup is
+// removed or an error occurs, done is called.
+func watchMemoryEvent(cgDir, evName, arg string, fn, done func()) error {
 	evFile, err := os.Open(filepath.Join(cgDir, evName))
 	if err != nil {
-		return nil, err
+		return err
 	}
 	fd, err := unix.Eventfd(0, unix.EFD_CLOEXEC)
 	if err != nil {
 		evFile.Close()
-		return nil, err
+		return err
 	}
 
 	eventfd := os.NewFile(uintptr(fd), "eventfd")
@@ -38,14 +127,13 @@ func registerMemoryEvent(cgDir string, evName string, arg string) (<-chan struct
 	if err := ioutil.WriteFile(eventControlPath, []byte(data), 0700); err != nil {
 		eventfd.Close()
 		evFile.Close()
-		return nil, err
+		return err
 	}
-	ch := make(chan struct{})
 	go func() {
 		defer func() {
 			eventfd.Close()
 			evFile.Close()
-			close(ch)
+			done()
 		}()
 		buf := make([]byte, 8)
 		for {
@@ -57,9 +145,20 @@ func registerMemoryEvent(cgDir string, evName string, arg string) (<-chan struct
 			if _, err := os.Lstat(eventControlPath); os.IsNotExist(err) {
 				return
 			}
-			ch <- struct{}{}
+			fn()
 		}
 	}()
+	return nil
+}
+
+func registerMemoryEvent(cgDir string, evName string, arg string) (<-chan struct{}, error) {
+	ch := make(chan struct{})
+	err := watchMemoryEvent(cgDir, evName, arg,
+		func() { ch <- struct{}{} },
+		func() { close(ch) })
+	if err != nil {
+		return nil, err
+	}
 	return ch, nil
 }
 
@@ -67,15 +166,68 @@ func registerMemoryEvent(cgDir string, evName string, arg string) (<-chan struct
 // if process died without OOM this channel will be closed.
 func notifyOnOOM(dir string) (<-chan struct{}, error) {
 	if dir == "" {
-		return nil, errors.New("memory controller missing")
+		return nil, errMemoryControllerMissing
 	}
 
 	return registerMemoryEvent(dir, "memory.oom_control", "")
 }
 
+// getOOMKillCount returns the value of oom_kill key from the memory.oom_control
+// file in dir. The second return value is false if the key is not present
+// (kernel < 4.13).
+func getOOMKillCount(dir string) (uint64, bool, error) {
+	data, err := ioutil.ReadFile(filepath.Join(dir, "memory.oom_control"))
+	if err != nil {
+		return 0, false, err
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		kv := strings.Fields(line)
+		if len(kv) == 2 && kv[0] == "oom_kill" {
+			v, err := strconv.ParseUint(kv[1], 10, 64)
+			return v, err == nil, err
+		}
+	}
+	return 0, false, nil
+}
+
+// notifyOnOOMKill returns a channel on which an event is sent every time
+// the OOM killer kills a process in the memory cgroup dir. The channel is
+// closed once the cgroup is removed.
+//
+// On kernels which lack the oom_kill counter (< 4.13), the OOM notifications
+// can't be told apart from the kills, so no event is sent; NotifyOOM still
+// reports the OOM conditions.
+func notifyOnOOMKill(dir string) (<-chan OOMKillEvent, error) {
+	if dir == "" {
+		return nil, errMemoryControllerMissing
+	}
+	last, _, err := getOOMKillCount(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	ch := make(chan OOMKillEvent)
+	err = watchMemoryEvent(dir, "memory.oom_control", "",
+		func() {
+			total, ok, err := getOOMKillCount(dir)
+			if err != nil || !ok {
+				return
+			}
+			if total > last {
+				ch <- OOMKillEvent{Count: total - last, Total: total}
+				last = total
+			}
+		},
+		func() { close(ch) })
+	if err != nil {
+		return nil, err
+	}
+	return ch, nil
+}
+
 func notifyMemoryPressure(dir string, level PressureLevel) (<-chan struct{}, error) {
 	if dir == "" {
-		return nil, errors.New("memory controller missing")
+		return nil, errMemoryControllerMissing
 	}
 
 	if level > CriticalPressure {
@@ -121,3 +121,121 @@ func TestNotifyMemoryPressure(t *testing.T) {
 		testMemoryNotification(t, "memory.pressure_level", f, arg)
 	}
 }
+
+func TestNotifyOnOOMKill(t *testing.T) {
+	memoryPath, err := ioutil.TempDir("", "testmemnotification-oomkill")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(memoryPath)
+	evFile := filepath.Join(memoryPath, "memory.oom_control")
+	eventPath := filepath.Join(memoryPath, "cgroup.event_control")
+	if err := ioutil.WriteFile(evFile, []byte("oom_kill_disable 0\nunder_oom 0\noom_kill 1\n"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(eventPath, []byte{}, 0700); err != nil {
+		t.Fatal(err)
+	}
+	ch, err := notifyOnOOMKill(memoryPath)
+	if err != nil {
+		t.Fatal("expected no error, got:", err)
+	}
+
+	data, err := ioutil.ReadFile(eventPath)
+	if err != nil {
+		t.Fatal("couldn't read event control file:", err)
+	}
+	var eventFd, evFd int
+	if _, err := fmt.Sscanf(string(data), "%d %d", &eventFd, &evFd); err != nil {
+		t.Fatalf("invalid control data %q: %s", data, err)
+	}
+	efd, err := unix.Dup(eventFd)
+	if err != nil {
+		t.Fatal("unable to dup eventfd:", err)
+	}
+	defer unix.Close(efd)
+
+	buf := make([]byte, 8)
+	binary.LittleEndian.PutUint64(buf, 1)
+
+	// Three more processes were killed.
+	if err := ioutil.WriteFile(evFile, []byte("oom_kill_disable 0\nunder_oom 0\noom_kill 4\n"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := unix.Write(efd, buf); err != nil {
+		t.Fatal("unable to write to eventfd:", err)
+	}
+
+	select {
+	case ev := <-ch:
+		if ev.Count != 3 || ev.Total != 4 {
+			t.Fatalf("expected {Count:3 Total:4}, got %+v", ev)
+		}
+	case <-time.After(100 * time.Millisecond):
+		t.Fatal("no notification on channel after 100ms")
+	}
+
+	// Without the oom_kill counter, an OOM notification is not a kill.
+	if err := ioutil.WriteFile(evFile, []byte("oom_kill_disable 0\nunder_oom 0\n"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := unix.Write(efd, buf); err != nil {
+		t.Fatal("unable to write to eventfd:", err)
+	}
+	select {
+	case ev := <-ch:
+		t.Fatalf("expected no notification without the oom_kill counter, got %+v", ev)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// simulate cgroup removal
+	if err := os.RemoveAll(memoryPath); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := unix.Write(efd, buf); err != nil {
+		t.Fatal("unable to write to eventfd:", err)
+	}
+	select {
+	case _, ok := <-ch:
+		if ok {
+			t.Fatal("expected no notification to be triggered")
+		}
+	case <-time.After(100 * time.Millisecond):
+		t.Fatal("channel not closed after 100ms")
+	}
+}
+
+func TestParsePSITrigger(t *testing.T) {
+	valid := map[string]PSITrigger{
+		"memory=some,150ms/1s": {Resource: "memory", Threshold: 150 * time.Millisecond, Window: time.Second},
+		"io=full,1s/2s":        {Resource: "io", Full: true, Threshold: time.Second, Window: 2 * time.Second},
+	}
+	for s, expected := range valid {
+		trigger, err := ParsePSITrigger(s)
+		if err != nil {
+			t.Errorf("%s: %v", s, err)
+			continue
+		}
+		if trigger != expected {
+			t.Errorf("%s: expected %+v, got %+v", s, expected, trigger)
+		}
+		if trigger.String() != s {
+			t.Errorf("%s: got %s back", s, trigger)
+		}
+	}
+
+	for _, s := range []string{
+		"",
+		"memory",
+		"net=some,150ms/1s",
+		"memory=most,150ms/1s",
+		"memory=some,150ms",
+		"memory=some,150/1s",
+		"memory=some,2s/1s",
+		"memory=some,0s/1s",
+	} {
+		if _, err := ParsePSITrigger(s); err == nil {
+			t.Errorf("%q: expected an error", s)
+		}
+	}
+}
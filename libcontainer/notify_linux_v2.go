@@ -3,33 +3,39 @@
 package libcontainer
 
 import (
+	"fmt"
+	"os"
 	"path/filepath"
 	"unsafe"
 
+	"github.com/opencontainers/runc/libcontainer/cgroups/ebpf"
 	"github.com/opencontainers/runc/libcontainer/cgroups/fscommon"
+	"github.com/opencontainers/runc/libcontainer/devices"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 	"golang.org/x/sys/unix"
 )
 
-func registerMemoryEventV2(cgDir, evName, cgEvName string) (<-chan struct{}, error) {
+// watchMemoryEventsV2 calls fn every time the evName file in cgDir is
+// modified. Once the cgroup becomes unpopulated (as reported by cgEvName)
+// or an error occurs, done is called.
+func watchMemoryEventsV2(cgDir, evName, cgEvName string, fn, done func()) error {
 	fd, err := unix.InotifyInit()
 	if err != nil {
-		return nil, errors.Wrap(err, "unable to init inotify")
+		return errors.Wrap(err, "unable to init inotify")
 	}
 	// watching oom kill
 	evFd, err := unix.InotifyAddWatch(fd, filepath.Join(cgDir, evName), unix.IN_MODIFY)
 	if err != nil {
 		unix.Close(fd)
-		return nil, errors.Wrap(err, "unable to add inotify watch")
+		return errors.Wrap(err, "unable to add inotify watch")
 	}
 	// Because no `unix.IN_DELETE|unix.IN_DELETE_SELF` event for cgroup file system, so watching all process exited
 	cgFd, err := unix.InotifyAddWatch(fd, filepath.Join(cgDir, cgEvName), unix.IN_MODIFY)
 	if err != nil {
 		unix.Close(fd)
-		return nil, errors.Wrap(err, "unable to add inotify watch")
+		return errors.Wrap(err, "unable to add inotify watch")
 	}
-	ch := make(chan struct{})
 	go func() {
 		var (
 			buffer [unix.SizeofInotifyEvent + unix.PathMax + 1]byte
@@ -37,7 +43,7 @@ func registerMemoryEventV2(cgDir, evName, cgEvName string) (<-chan struct{}, err
 		)
 		defer func() {
 			unix.Close(fd)
-			close(ch)
+			done()
 		}()
 
 		for {
@@ -59,10 +65,7 @@ func registerMemoryEventV2(cgDir, evName, cgEvName string) (<-chan struct{}, err
 				}
 				switch int(rawEvent.Wd) {
 				case evFd:
-					oom, err := fscommon.GetValueByKey(cgDir, evName, "oom_kill")
-					if err != nil || oom > 0 {
-						ch <- struct{}{}
-					}
+					fn()
 				case cgFd:
 					pids, err := fscommon.GetValueByKey(cgDir, cgEvName, "populated")
 					if err != nil || pids == 0 {
@@ -72,6 +75,22 @@ func registerMemoryEventV2(cgDir, evName, cgEvName string) (<-chan struct{}, err
 			}
 		}
 	}()
+	return nil
+}
+
+func registerMemoryEventV2(cgDir, evName, cgEvName string) (<-chan struct{}, error) {
+	ch := make(chan struct{})
+	err := watchMemoryEventsV2(cgDir, evName, cgEvName,
+		func() {
+			oom, err := fscommon.GetValueByKey(cgDir, evName, "oom_kill")
+			if err != nil || oom > 0 {
+				ch <- struct{}{}
+			}
+		},
+		func() { close(ch) })
+	if err != nil {
+		return nil, err
+	}
 	return ch, nil
 }
 
@@ -80,3 +99,100 @@ func registerMemoryEventV2(cgDir, evName, cgEvName string) (<-chan struct{}, err
 func notifyOnOOMV2(path string) (<-chan struct{}, error) {
 	return registerMemoryEventV2(path, "memory.events", "cgroup.events")
 }
+
+// notifyOnOOMKillV2 returns a channel on which an event is sent every time
+// the OOM killer kills a process in the cgroup path. The channel is closed
+// once the cgroup becomes unpopulated.
+func notifyOnOOMKillV2(path string) (<-chan OOMKillEvent, error) {
+	last, err := fscommon.GetValueByKey(path, "memory.events", "oom_kill")
+	if err != nil {
+		return nil, err
+	}
+
+	ch := make(chan OOMKillEvent)
+	err = watchMemoryEventsV2(path, "memory.events", "cgroup.events",
+		func() {
+			total, err := fscommon.GetValueByKey(path, "memory.events", "oom_kill")
+			if err != nil {
+				return
+			}
+			if total > last {
+				ch <- OOMKillEvent{Count: total - last, Total: total}
+				last = total
+			}
+		},
+		func() { close(ch) })
+	if err != nil {
+		return nil, err
+	}
+	return ch, nil
+}
+
+// notifyOnPSI registers the PSI trigger t in cgDir, and returns a channel on
+// which an event is sent every time the trigger fires. The channel is closed
+// once the cgroup is removed.
+func notifyOnPSI(cgDir string, t PSITrigger) (<-chan struct{}, error) {
+	path := filepath.Join(cgDir, t.Resource+".pressure")
+	fd, err := unix.Open(path, unix.O_RDWR|unix.O_CLOEXEC|unix.O_NONBLOCK, 0)
+	if err != nil {
+		return nil, &os.PathError{Op: "open", Path: path, Err: err}
+	}
+	trigger := fmt.Sprintf("%s %d %d", t.stallType(), t.Threshold.Microseconds(), t.Window.Microseconds())
+	// The kernel expects the trigger to be NUL-terminated.
+	if _, err := unix.Write(fd, append([]byte(trigger), 0)); err != nil {
+		unix.Close(fd)
+		return nil, errors.Wrapf(err, "unable to register PSI trigger %q in %s", trigger, path)
+	}
+	ch := make(chan struct{})
+	go func() {
+		defer func() {
+			unix.Close(fd)
+			close(ch)
+		}()
+		fds := []unix.PollFd{{Fd: int32(fd), Events: unix.POLLPRI}}
+		for {
+			if _, err := unix.Poll(fds, -1); err != nil {
+				if errors.Is(err, unix.EINTR) {
+					continue
+				}
+				logrus.Warnf("unable to poll PSI trigger: %v", err)
+				return
+			}
+			// The pressure file reports an error once the cgroup is gone.
+			if fds[0].Revents&unix.POLLERR != 0 {
+				return
+			}
+			if fds[0].Revents&unix.POLLPRI != 0 {
+				ch <- struct{}{}
+			}
+		}
+	}()
+	return ch, nil
+}
+
+// DeviceDeniedEvent describes an access to a device denied to a process of a
+// container.
+type DeviceDeniedEvent struct {
+	// Pid is the pid of the process, in the initial pid namespace.
+	Pid         int
+	Type        devices.Type
+	Major       int64
+	Minor       int64
+	Permissions devices.Permissions
+}
+
+// notifyOnDeviceDenied returns a channel on which an event is sent every time
+// the device filter of the cgroup cgDir denies access to a device. The
+// channel is closed once the cgroup is removed.
+func notifyOnDeviceDenied(cgDir string) (<-chan DeviceDeniedEvent, error) {
+	ch := make(chan DeviceDeniedEvent)
+	err := ebpf.WatchDeniedDeviceAccesses(cgDir,
+		func(a ebpf.DeniedDeviceAccess) {
+			ch <- DeviceDeniedEvent(a)
+		},
+		func() { close(ch) })
+	if err != nil {
+		return nil, err
+	}
+	return ch, nil
+}
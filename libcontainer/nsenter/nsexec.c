@@ -93,6 +93,10 @@ struct nlconfig_t {
 	size_t uidmappath_len;
 	char *gidmappath;
 	size_t gidmappath_len;
+
+	/* Time namespace settings. */
+	char *timensoffset;
+	size_t timensoffset_len;
 };
 
 #define PANIC   "panic"
@@ -118,6 +122,7 @@ static int logfd = -1;
 #define ROOTLESS_EUID_ATTR	27287
 #define UIDMAPPATH_ATTR		27288
 #define GIDMAPPATH_ATTR		27289
+#define TIMENSOFFSET_ATTR	27290
 
 /*
  * Use the raw syscall for versions of glibc which don't include a function for
@@ -164,7 +169,8 @@ static void write_log(const char *level, const char *format, ...)
 	if (ret < 0)
 		goto out;
 
-	dprintf(logfd, "{\"level\":\"%s\", \"msg\": \"%s[%d]: %s\"}\n", level, stage, getpid(), message);
+	dprintf(logfd, "{\"level\":\"%s\", \"msg\": \"%s\", \"stage\": \"%s\", \"pid\": %d}\n", level, message, stage,
+		getpid());
 
 out:
 	free(message);
@@ -317,6 +323,9 @@ static void update_uidmap(const char *path, int pid, char *map, size_t map_len)
 	if (write_file(map, map_len, "/proc/%d/uid_map", pid) < 0) {
 		if (errno != EPERM)
 			bail("failed to update /proc/%d/uid_map", pid);
+		/* Without newuidmap, the mapping needs CAP_SETUID in our user namespace. */
+		if (path == NULL)
+			bail("failed to update /proc/%d/uid_map, and newuidmap is not available", pid);
 		write_log(DEBUG, "update /proc/%d/uid_map got -EPERM (trying %s)", pid, path);
 		if (try_mapping_tool(path, pid, map, map_len))
 			bail("failed to use newuid map on %d", pid);
@@ -332,6 +341,9 @@ static void update_gidmap(const char *path, int pid, char *map, size_t map_len)
 	if (write_file(map, map_len, "/proc/%d/gid_map", pid) < 0) {
 		if (errno != EPERM)
 			bail("failed to update /proc/%d/gid_map", pid);
+		/* Without newgidmap, the mapping needs CAP_SETGID in our user namespace. */
+		if (path == NULL)
+			bail("failed to update /proc/%d/gid_map, and newgidmap is not available", pid);
 		write_log(DEBUG, "update /proc/%d/gid_map got -EPERM (trying %s)", pid, path);
 		if (try_mapping_tool(path, pid, map, map_len))
 			bail("failed to use newgid map on %d", pid);
@@ -348,6 +360,16 @@ static void update_oom_score_adj(char *data, size_t len)
 		bail("failed to update /proc/self/oom_score_adj");
 }
 
+static void update_timens_offsets(char *data, size_t len)
+{
+	if (data == NULL || len <= 0)
+		return;
+
+	write_log(DEBUG, "update /proc/self/timens_offsets to '%s'", data);
+	if (write_file(data, len, "/proc/self/timens_offsets") < 0)
+		bail("failed to update /proc/self/timens_offsets");
+}
+
 /* A dummy function that just jumps to the given jumpval. */
 static int child_func(void *arg) __attribute__((noinline));
 static int child_func(void *arg)
@@ -422,6 +444,8 @@ static int nsflag(char *name)
 		return CLONE_NEWUSER;
 	else if (!strcmp(name, "uts"))
 		return CLONE_NEWUTS;
+	else if (!strcmp(name, "time"))
+		return CLONE_NEWTIME;
 
 	/* If we don't recognise a name, fallback to 0. */
 	return 0;
@@ -508,6 +532,10 @@ static void nl_parse(int fd, struct nlconfig_t *config)
 		case SETGROUP_ATTR:
 			config->is_setgroup = readint8(current);
 			break;
+		case TIMENSOFFSET_ATTR:
+			config->timensoffset = current;
+			config->timensoffset_len = payload_len;
+			break;
 		default:
 			bail("unknown netlink message type %d", nlattr->nla_type);
 		}
@@ -978,6 +1006,14 @@ void nsexec(void)
 			if (unshare(config.cloneflags & ~CLONE_NEWCGROUP) < 0)
 				bail("failed to unshare remaining namespaces (except cgroupns)");
 
+			/*
+			 * The clock offsets of a new time namespace have to be set before
+			 * any process enters it, which is stage-2 (the time namespace is
+			 * only entered by the children of the process which unshared it).
+			 */
+			if (config.cloneflags & CLONE_NEWTIME)
+				update_timens_offsets(config.timensoffset, config.timensoffset_len);
+
 			/*
 			 * TODO: What about non-namespace clone flags that we're dropping here?
 			 *
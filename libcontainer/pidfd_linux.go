@@ -0,0 +1,82 @@
+// +build linux
+
+package libcontainer
+
+import (
+	"errors"
+	"os"
+
+	"github.com/opencontainers/runc/libcontainer/system"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/sys/unix"
+)
+
+// openPidfd returns a pidfd referring to the process pid, provided that it
+// is still the process started at startTime (and not a process which got
+// the same pid after the original one exited). Checking the start time
+// after opening the pidfd makes sure that the pidfd refers to the right
+// process: if the pid has been reused in between, the original process is
+// gone anyway. It returns unix.ESRCH if the process does not exist.
+func openPidfd(pid int, startTime uint64) (int, error) {
+	fd, err := system.PidfdOpen(pid, 0)
+	if err != nil {
+		return -1, err
+	}
+	stat, err := system.Stat(pid)
+	if err != nil || stat.StartTime != startTime || stat.State == system.Zombie || stat.State == system.Dead {
+		unix.Close(fd)
+		return -1, unix.ESRCH
+	}
+	return fd, nil
+}
+
+// signalPid sends the signal s to the process pid started at startTime.
+// The signal is delivered using a pidfd, so it can't hit another process
+// which got the same pid. On kernels without pidfd support, it falls back
+// to kill(2).
+func signalPid(pid int, startTime uint64, s os.Signal) error {
+	sig, ok := s.(unix.Signal)
+	if !ok {
+		return errors.New("os: unsupported signal type")
+	}
+	fd, err := openPidfd(pid, startTime)
+	if err != nil {
+		if errors.Is(err, unix.ENOSYS) {
+			return unix.Kill(pid, sig)
+		}
+		return err
+	}
+	defer unix.Close(fd)
+	return system.PidfdSendSignal(fd, sig)
+}
+
+// notifyOnExit returns a channel which is closed once the process pid
+// started at startTime exits. The exit is detected by polling a pidfd, so
+// this works for processes which are not children of the current process,
+// but requires Linux 5.3+.
+func notifyOnExit(pid int, startTime uint64) (<-chan struct{}, error) {
+	fd, err := openPidfd(pid, startTime)
+	if err != nil {
+		return nil, err
+	}
+	ch := make(chan struct{})
+	go func() {
+		defer close(ch)
+		defer unix.Close(fd)
+		fds := []unix.PollFd{{Fd: int32(fd), Events: unix.POLLIN}}
+		for {
+			n, err := unix.Poll(fds, -1)
+			if errors.Is(err, unix.EINTR) {
+				continue
+			}
+			if err != nil {
+				logrus.Warnf("polling pidfd of process %d: %v", pid, err)
+				return
+			}
+			if n > 0 {
+				return
+			}
+		}
+	}()
+	return ch, nil
+}
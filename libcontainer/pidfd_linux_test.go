@@ -0,0 +1,55 @@
+// +build linux
+
+package libcontainer
+
+import (
+	"errors"
+	"os/exec"
+	"testing"
+	"time"
+
+	"github.com/opencontainers/runc/libcontainer/system"
+	"golang.org/x/sys/unix"
+)
+
+func TestSignalPidAndNotifyOnExit(t *testing.T) {
+	cmd := exec.Command("sleep", "30")
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer cmd.Process.Kill() //nolint: errcheck
+	pid := cmd.Process.Pid
+	stat, err := system.Stat(pid)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ch, err := notifyOnExit(pid, stat.StartTime)
+	if errors.Is(err, unix.ENOSYS) {
+		t.Skip("pidfd_open(2) not supported")
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A process with the same pid but another start time must not be
+	// signalled.
+	if err := signalPid(pid, stat.StartTime+1, unix.SIGKILL); !errors.Is(err, unix.ESRCH) {
+		t.Fatalf("expected ESRCH, got %v", err)
+	}
+	select {
+	case <-ch:
+		t.Fatal("unexpected exit notification")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	if err := signalPid(pid, stat.StartTime, unix.SIGKILL); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-ch:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no exit notification")
+	}
+	_ = cmd.Wait()
+}
@@ -25,7 +25,10 @@ type Process struct {
 	Env []string
 
 	// User will set the uid and gid of the executing process running inside the container
-	// local to the container's user and group configuration.
+	// local to the container's user and group configuration. It is either a uid or a user
+	// name, with an optional gid or group name, which are resolved against the /etc/passwd
+	// and /etc/group files of the container, along with the supplementary groups and the
+	// home directory (HOME, unless it is set in Env) of the user.
 	User string
 
 	// AdditionalGroups specifies the gids that should be added to supplementary groups
@@ -45,6 +48,9 @@ type Process struct {
 	Stderr io.Writer
 
 	// ExtraFiles specifies additional open files to be inherited by the container
+	//
+	// If $LISTEN_FDS is set in Env, for the socket activation protocol,
+	// $LISTEN_PID is set to the pid of the process in the container.
 	ExtraFiles []*os.File
 
 	// Initial sizings for the console
@@ -69,6 +75,25 @@ type Process struct {
 	// If Rlimits are not set, the container will inherit rlimits from the parent process
 	Rlimits []configs.Rlimit
 
+	// IOPriority specifies the I/O priority of the process. If it is not
+	// set, the I/O priority of the container is used.
+	IOPriority *configs.IOPriority
+
+	// OomScoreAdj specifies the oom_score_adj of the process. If it is not
+	// set, the oom_score_adj of the container is used.
+	OomScoreAdj *int
+
+	// Cgroup is the path, relative to the cgroup of the container, of the
+	// child cgroup to run the process in, which is created if it does not
+	// exist (e.g. "monitoring"). This only applies to the processes run in
+	// an existing container. If empty, the cgroup of the container is used.
+	// Child cgroups are only supported on cgroup v1.
+	Cgroup string
+
+	// CgroupResources, if set, are the limits set on the child cgroup
+	// Cgroup, on top of the ones of the container.
+	CgroupResources *configs.Resources
+
 	// ConsoleSocket provides the masterfd console.
 	ConsoleSocket *os.File
 
@@ -3,6 +3,7 @@
 package libcontainer
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -19,6 +20,7 @@ import (
 	"github.com/opencontainers/runc/libcontainer/intelrdt"
 	"github.com/opencontainers/runc/libcontainer/logs"
 	"github.com/opencontainers/runc/libcontainer/system"
+	"github.com/opencontainers/runc/libcontainer/trace"
 	"github.com/opencontainers/runc/libcontainer/utils"
 	"github.com/opencontainers/runtime-spec/specs-go"
 	"github.com/sirupsen/logrus"
@@ -33,8 +35,8 @@ type parentProcess interface {
 	// pid returns the pid for the running process.
 	pid() int
 
-	// start starts the process execution.
-	start() error
+	// start starts the process execution, giving up once ctx is done.
+	start(ctx context.Context) error
 
 	// send a SIGKILL to the process and wait for the exit.
 	terminate() error
@@ -72,6 +74,7 @@ type setnsProcess struct {
 	process         *Process
 	bootstrapData   io.Reader
 	initProcessPid  int
+	container       *linuxContainer
 }
 
 func (p *setnsProcess) startTime() (uint64, error) {
@@ -87,11 +90,17 @@ func (p *setnsProcess) signal(sig os.Signal) error {
 	return unix.Kill(p.pid(), s)
 }
 
-func (p *setnsProcess) start() (retErr error) {
+func (p *setnsProcess) start(ctx context.Context) (retErr error) {
 	defer p.messageSockPair.parent.Close()
+	// Shut down the pipe once ctx is done, so that waiting on the child
+	// fails, and the process is terminated.
+	defer afterDone(ctx, func() {
+		_ = unix.Shutdown(int(p.messageSockPair.parent.Fd()), unix.SHUT_RDWR)
+	})()
 	// get the "before" value of oom kill count
 	oom, _ := p.manager.OOMKillCount()
-	err := p.cmd.Start()
+	var err error
+	p.cmd, err = startInCgroup(p.cmd, p.cgroupPaths[""])
 	// close the write-side of the pipes (controlled by child)
 	p.messageSockPair.child.Close()
 	p.logFilePair.child.Close()
@@ -133,17 +142,22 @@ func (p *setnsProcess) start() (retErr error) {
 		if err := cgroups.EnterPid(p.cgroupPaths, p.pid()); err != nil && !p.rootlessCgroups {
 			// On cgroup v2 + nesting + domain controllers, EnterPid may fail with EBUSY.
 			// https://github.com/opencontainers/runc/issues/2356#issuecomment-621277643
-			// Try to join the cgroup of InitProcessPid.
-			if cgroups.IsCgroup2UnifiedMode() {
+			// Try to join the cgroup of InitProcessPid, unless a child
+			// cgroup was requested.
+			if cgroups.IsCgroup2UnifiedMode() && p.process.Cgroup == "" {
 				initProcCgroupFile := fmt.Sprintf("/proc/%d/cgroup", p.initProcessPid)
 				initCg, initCgErr := cgroups.ParseCgroupFile(initProcCgroupFile)
 				if initCgErr == nil {
 					if initCgPath, ok := initCg[""]; ok {
-						initCgDirpath := filepath.Join(fs2.UnifiedMountpoint, initCgPath)
-						logrus.Debugf("adding pid %d to cgroups %v failed (%v), attempting to join %q (obtained from %s)",
-							p.pid(), p.cgroupPaths, err, initCg, initCgDirpath)
-						// NOTE: initCgDirPath is not guaranteed to exist because we didn't pause the container.
-						err = cgroups.WriteCgroupProc(initCgDirpath, p.pid())
+						// The cgroup is seen in the cgroup namespace of runc,
+						// in which only a part of the hierarchy can be mounted.
+						if rel, relErr := cgroups.UnifiedRelPath(initCgPath); relErr == nil {
+							initCgDirpath := filepath.Join(fs2.UnifiedMountpoint, rel)
+							logrus.Debugf("adding pid %d to cgroups %v failed (%v), attempting to join %q (obtained from %s)",
+								p.pid(), p.cgroupPaths, err, initCg, initCgDirpath)
+							// NOTE: initCgDirPath is not guaranteed to exist because we didn't pause the container.
+							err = cgroups.WriteCgroupProc(initCgDirpath, p.pid())
+						}
 					}
 				}
 			}
@@ -166,6 +180,13 @@ func (p *setnsProcess) start() (retErr error) {
 	if err := setupRlimits(p.config.Rlimits, p.pid()); err != nil {
 		return newSystemErrorWithCause(err, "setting rlimits for process")
 	}
+	// The process has to run with the core scheduling cookie of the
+	// container, which it doesn't inherit as it is not forked from it.
+	if p.config.Config.SchedCore {
+		if err := system.SchedCoreShare(p.initProcessPid, p.pid()); err != nil {
+			return newSystemErrorWithCausef(err, "sharing core scheduling cookie with pid %d", p.pid())
+		}
+	}
 	if err := utils.WriteJSON(p.messageSockPair.parent, p.config); err != nil {
 		return newSystemErrorWithCause(err, "writing config to pipe")
 	}
@@ -178,9 +199,18 @@ func (p *setnsProcess) start() (retErr error) {
 		case procHooks:
 			// This shouldn't happen.
 			panic("unexpected procHooks in setns")
+		case procSeccomp:
+			s, err := p.container.currentOCIState()
+			if err != nil {
+				return err
+			}
+			if err := recvSeccompFd(p.messageSockPair.parent, p.config.Config, s, p.pid()); err != nil {
+				return newSystemErrorWithCause(err, "sending seccomp fd to seccomp agent")
+			}
 		default:
 			return newSystemError(errors.New("invalid JSON payload from child"))
 		}
+		return nil
 	})
 
 	if err := unix.Shutdown(int(p.messageSockPair.parent.Fd()), unix.SHUT_WR); err != nil {
@@ -326,15 +356,34 @@ func (p *initProcess) waitForChildExit(childPid int) error {
 	return nil
 }
 
-func (p *initProcess) start() (retErr error) {
+func (p *initProcess) start(ctx context.Context) (retErr error) {
 	defer p.messageSockPair.parent.Close() //nolint: errcheck
-	err := p.cmd.Start()
+	// Shut down the pipe once ctx is done, so that waiting on the child
+	// fails, and the process is terminated and its cgroup removed.
+	defer afterDone(ctx, func() {
+		_ = unix.Shutdown(int(p.messageSockPair.parent.Fd()), unix.SHUT_RDWR)
+	})()
+	// On cgroup v2, create the container cgroup in advance, if the cgroup
+	// manager can, so that init can be started right inside it.
+	var cgroupPath string
+	if cgroups.IsCgroup2UnifiedMode() && p.manager.CanCreateEmpty() {
+		if err := p.manager.ApplyContext(ctx, -1); err != nil {
+			logrus.Debugf("unable to create cgroup before starting init: %v", err)
+		} else {
+			cgroupPath = p.manager.Path("")
+		}
+	}
+	var err error
+	p.cmd, err = startInCgroup(p.cmd, cgroupPath)
 	p.process.ops = p
 	// close the write-side of the pipes (controlled by child)
 	_ = p.messageSockPair.child.Close()
 	_ = p.logFilePair.child.Close()
 	if err != nil {
 		p.process.ops = nil
+		if cgroupPath != "" {
+			_ = p.manager.Destroy()
+		}
 		return newSystemErrorWithCause(err, "starting init process command")
 	}
 
@@ -366,6 +415,11 @@ func (p *initProcess) start() (retErr error) {
 				logrus.WithError(werr).Warn()
 			}
 
+			// Remove the host interfaces given to the container while
+			// its network namespace is still there (it may also outlive
+			// init, if it was joined).
+			p.removeNetworkInterfaces()
+
 			// Terminate the process to ensure we can remove cgroups.
 			if err := ignoreTerminateErrors(p.terminate()); err != nil {
 				logrus.WithError(err).Warn("unable to terminate initProcess")
@@ -381,7 +435,12 @@ func (p *initProcess) start() (retErr error) {
 	// Do this before syncing with child so that no children can escape the
 	// cgroup. We don't need to worry about not doing this and not being root
 	// because we'd be using the rootless cgroup manager in that case.
-	if err := p.manager.Apply(p.pid()); err != nil {
+	// If init was started with CLONE_INTO_CGROUP, it is already in the
+	// cgroup, and this only does the remaining setup.
+	span := trace.Start("cgroup apply")
+	err = p.manager.ApplyContext(ctx, p.pid())
+	span.Finish()
+	if err != nil {
 		return newSystemErrorWithCause(err, "applying cgroup configuration for process")
 	}
 	if p.intelRdtManager != nil {
@@ -389,6 +448,10 @@ func (p *initProcess) start() (retErr error) {
 			return newSystemErrorWithCause(err, "applying Intel RDT configuration for process")
 		}
 	}
+	// The nsexec handshake goes from sending the bootstrap data to the exit
+	// of the first child, once the final child is in all the namespaces.
+	span = trace.Start("nsexec")
+	defer span.Finish()
 	if _, err := io.Copy(p.messageSockPair.parent, p.bootstrapData); err != nil {
 		return newSystemErrorWithCause(err, "copying bootstrap data to pipe")
 	}
@@ -422,10 +485,16 @@ func (p *initProcess) start() (retErr error) {
 	if err := p.waitForChildExit(childPid); err != nil {
 		return newSystemErrorWithCause(err, "waiting for our first child to exit")
 	}
+	span.Finish()
 
 	if err := p.createNetworkInterfaces(); err != nil {
 		return newSystemErrorWithCause(err, "creating network interfaces")
 	}
+	if limit := netBandwidthLimit(p.config.Config.Networks); limit != 0 {
+		if err := setNetBandwidthLimit(p.manager.Path(""), limit); err != nil {
+			return newSystemErrorWithCause(err, "setting network bandwidth limit")
+		}
+	}
 	if err := p.updateSpecState(); err != nil {
 		return newSystemErrorWithCause(err, "updating the spec state")
 	}
@@ -465,12 +534,10 @@ func (p *initProcess) start() (retErr error) {
 					// initProcessStartTime hasn't been set yet.
 					s.Pid = p.cmd.Process.Pid
 					s.Status = specs.StateCreating
-					hooks := p.config.Config.Hooks
-
-					if err := hooks[configs.Prestart].RunHooks(s); err != nil {
+					if err := p.container.runHooks(ctx, configs.Prestart, s); err != nil {
 						return err
 					}
-					if err := hooks[configs.CreateRuntime].RunHooks(s); err != nil {
+					if err := p.container.runHooks(ctx, configs.CreateRuntime, s); err != nil {
 						return err
 					}
 				}
@@ -520,12 +587,10 @@ func (p *initProcess) start() (retErr error) {
 				// initProcessStartTime hasn't been set yet.
 				s.Pid = p.cmd.Process.Pid
 				s.Status = specs.StateCreating
-				hooks := p.config.Config.Hooks
-
-				if err := hooks[configs.Prestart].RunHooks(s); err != nil {
+				if err := p.container.runHooks(ctx, configs.Prestart, s); err != nil {
 					return err
 				}
-				if err := hooks[configs.CreateRuntime].RunHooks(s); err != nil {
+				if err := p.container.runHooks(ctx, configs.CreateRuntime, s); err != nil {
 					return err
 				}
 			}
@@ -534,6 +599,18 @@ func (p *initProcess) start() (retErr error) {
 				return newSystemErrorWithCause(err, "writing syncT 'resume'")
 			}
 			sentResume = true
+		case procIDMappedMounts:
+			if err := sendIDMappedMounts(p.messageSockPair.parent, p.config.Config, p.pid()); err != nil {
+				return newSystemErrorWithCause(err, "sending idmapped mounts to init process")
+			}
+		case procSeccomp:
+			s, err := p.container.currentOCIState()
+			if err != nil {
+				return err
+			}
+			if err := recvSeccompFd(p.messageSockPair.parent, p.config.Config, s, p.pid()); err != nil {
+				return newSystemErrorWithCause(err, "sending seccomp fd to seccomp agent")
+			}
 		default:
 			return newSystemError(errors.New("invalid JSON payload from child"))
 		}
@@ -605,19 +682,38 @@ func (p *initProcess) createNetworkInterfaces() error {
 	for _, config := range p.config.Config.Networks {
 		strategy, err := getStrategy(config.Type)
 		if err != nil {
+			p.removeNetworkInterfaces()
 			return err
 		}
 		n := &network{
-			Network: *config,
+			Network:  *config,
+			stateDir: p.container.root,
 		}
 		if err := strategy.create(n, p.pid()); err != nil {
-			return err
+			p.removeNetworkInterfaces()
+			return fmt.Errorf("%s: %w", networkName(config), err)
 		}
 		p.config.Networks = append(p.config.Networks, n)
 	}
 	return nil
 }
 
+// removeNetworkInterfaces removes the network interfaces created so far, in
+// the reverse order, so that the host is left as it was.
+func (p *initProcess) removeNetworkInterfaces() {
+	for i := len(p.config.Networks) - 1; i >= 0; i-- {
+		n := p.config.Networks[i]
+		strategy, err := getStrategy(n.Type)
+		if err == nil {
+			err = strategy.remove(n, p.pid())
+		}
+		if err != nil {
+			logrus.Warnf("unable to remove %s: %v", networkName(&n.Network), err)
+		}
+	}
+	p.config.Networks = nil
+}
+
 func (p *initProcess) signal(sig os.Signal) error {
 	s, ok := sig.(unix.Signal)
 	if !ok {
@@ -700,6 +796,28 @@ func (p *Process) InitializeIO(rootuid, rootgid int) (i *IO, err error) {
 	return i, nil
 }
 
+// afterDone calls fn once ctx is done, unless the returned function is called
+// first, which waits for fn to return if it was called.
+func afterDone(ctx context.Context, fn func()) (stop func()) {
+	if ctx.Done() == nil {
+		return func() {}
+	}
+	stopped := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		select {
+		case <-ctx.Done():
+			fn()
+		case <-stopped:
+		}
+	}()
+	return func() {
+		close(stopped)
+		<-done
+	}
+}
+
 // initWaiter returns a channel to wait on for making sure
 // runc init has finished the initial setup.
 func initWaiter(r io.Reader) chan error {
@@ -724,3 +842,60 @@ func initWaiter(r io.Reader) chan error {
 
 	return ch
 }
+
+// startInCgroup starts cmd with the process placed directly into the cgroup
+// v2 dirPath using CLONE_INTO_CGROUP, so that it never runs (and allocates
+// memory) in the cgroup of its parent. If this is not possible (old kernel
+// or Go version, empty dirPath, no access to the cgroup), the process is
+// started in the usual way, and the caller is responsible for moving it to
+// the cgroup. As the failed cmd can't be reused, the cmd actually started
+// is returned.
+func startInCgroup(cmd *exec.Cmd, dirPath string) (*exec.Cmd, error) {
+	if dirPath == "" || !cgroups.IsCgroup2UnifiedMode() {
+		return cmd, cmd.Start()
+	}
+	fd, err := unix.Open(dirPath, unix.O_PATH|unix.O_DIRECTORY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		logrus.Debugf("unable to open cgroup %s: %v", dirPath, err)
+		return cmd, cmd.Start()
+	}
+	defer unix.Close(fd) //nolint: errcheck
+	if !setCgroupFD(cmd, fd) {
+		return cmd, cmd.Start()
+	}
+	err = cmd.Start()
+	if err == nil {
+		return cmd, nil
+	}
+	logrus.Debugf("starting process with CLONE_INTO_CGROUP failed (%v), retrying without it", err)
+	cmd = cloneCmd(cmd)
+	clearCgroupFD(cmd)
+	return cmd, cmd.Start()
+}
+
+// cloneCmd returns a copy of a cmd which failed to start, so that it can be
+// started again. All the fields set by runc are copied, but:
+//   - Process and ProcessState, which are those of the failed start and
+//     must not be set for the copy to be started;
+//   - the context of a cmd created by exec.CommandContext, which is not
+//     exported (runc uses exec.Command);
+//   - the fields added by later Go versions (Cancel, WaitDelay, Err), which
+//     runc does not use.
+// The slices (Args, Env, ExtraFiles) are shared with cmd.
+func cloneCmd(cmd *exec.Cmd) *exec.Cmd {
+	c := &exec.Cmd{
+		Path:       cmd.Path,
+		Args:       cmd.Args,
+		Env:        cmd.Env,
+		Dir:        cmd.Dir,
+		Stdin:      cmd.Stdin,
+		Stdout:     cmd.Stdout,
+		Stderr:     cmd.Stderr,
+		ExtraFiles: cmd.ExtraFiles,
+	}
+	if cmd.SysProcAttr != nil {
+		attr := *cmd.SysProcAttr
+		c.SysProcAttr = &attr
+	}
+	return c
+}
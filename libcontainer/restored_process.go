@@ -3,6 +3,7 @@
 package libcontainer
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"os/exec"
@@ -32,7 +33,7 @@ type restoredProcess struct {
 	fds              []string
 }
 
-func (p *restoredProcess) start() error {
+func (p *restoredProcess) start(_ context.Context) error {
 	return newGenericError(fmt.Errorf("restored process cannot be started"), SystemError)
 }
 
@@ -90,7 +91,7 @@ type nonChildProcess struct {
 	fds              []string
 }
 
-func (p *nonChildProcess) start() error {
+func (p *nonChildProcess) start(_ context.Context) error {
 	return newGenericError(fmt.Errorf("restored process cannot be started"), SystemError)
 }
 
@@ -111,11 +112,7 @@ func (p *nonChildProcess) startTime() (uint64, error) {
 }
 
 func (p *nonChildProcess) signal(s os.Signal) error {
-	proc, err := os.FindProcess(p.processPid)
-	if err != nil {
-		return err
-	}
-	return proc.Signal(s)
+	return signalPid(p.processPid, p.processStartTime, s)
 }
 
 func (p *nonChildProcess) externalDescriptors() []string {
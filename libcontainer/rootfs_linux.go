@@ -3,8 +3,9 @@
 package libcontainer
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"io"
 	"io/ioutil"
 	"os"
 	"os/exec"
@@ -20,6 +21,8 @@ import (
 	"github.com/opencontainers/runc/libcontainer/cgroups/fs2"
 	"github.com/opencontainers/runc/libcontainer/configs"
 	"github.com/opencontainers/runc/libcontainer/devices"
+	"github.com/opencontainers/runc/libcontainer/system"
+	"github.com/opencontainers/runc/libcontainer/trace"
 	"github.com/opencontainers/runc/libcontainer/userns"
 	"github.com/opencontainers/runc/libcontainer/utils"
 	libcontainerUtils "github.com/opencontainers/runc/libcontainer/utils"
@@ -37,6 +40,9 @@ type mountConfig struct {
 	cgroup2Path     string
 	rootlessCgroups bool
 	cgroupns        bool
+	// idmapped contains the detached idmapped mounts received from the
+	// parent, to be moved to their destinations.
+	idmapped map[*configs.Mount]*os.File
 }
 
 // needsSetupDev returns true if /dev needs to be set up.
@@ -52,9 +58,32 @@ func needsSetupDev(config *configs.Config) bool {
 // prepareRootfs sets up the devices, mount points, and filesystems for use
 // inside a new mount namespace. It doesn't set anything as ro. You must call
 // finalizeRootfs after this function to finish setting up the rootfs.
-func prepareRootfs(pipe io.ReadWriter, iConfig *initConfig) (err error) {
+func prepareRootfs(pipe *os.File, iConfig *initConfig) (err error) {
+	span := trace.Start("rootfs setup")
+	defer span.Finish()
 	config := iConfig.Config
-	if err := prepareRoot(config); err != nil {
+	mnts, err := recvIDMappedMounts(pipe, config)
+	if err != nil {
+		return newSystemErrorWithCause(err, "getting idmapped mounts")
+	}
+	defer func() {
+		for _, f := range mnts {
+			f.Close()
+		}
+	}()
+	var (
+		rootfsMount *os.File
+		idmapped    = make(map[*configs.Mount]*os.File)
+	)
+	for i, src := range idmapSources(config) {
+		if src.mount == nil {
+			rootfsMount = mnts[i]
+		} else {
+			idmapped[src.mount] = mnts[i]
+		}
+	}
+
+	if err := prepareRoot(config, rootfsMount); err != nil {
 		return newSystemErrorWithCause(err, "preparing rootfs")
 	}
 
@@ -64,6 +93,7 @@ func prepareRootfs(pipe io.ReadWriter, iConfig *initConfig) (err error) {
 		cgroup2Path:     iConfig.Cgroup2Path,
 		rootlessCgroups: iConfig.RootlessCgroups,
 		cgroupns:        config.Namespaces.Contains(configs.NEWCGROUP),
+		idmapped:        idmapped,
 	}
 	setupDev := needsSetupDev(config)
 	for _, m := range config.Mounts {
@@ -119,7 +149,7 @@ func prepareRootfs(pipe io.ReadWriter, iConfig *initConfig) (err error) {
 	s := iConfig.SpecState
 	s.Pid = unix.Getpid()
 	s.Status = specs.StateCreating
-	if err := iConfig.Config.Hooks[configs.CreateContainer].RunHooks(s); err != nil {
+	if _, err := runHookList(context.Background(), iConfig.Config.Hooks[configs.CreateContainer], configs.CreateContainer, s); err != nil {
 		return err
 	}
 
@@ -187,7 +217,7 @@ func prepareTmp(topTmpDir string) (string, error) {
 	if err != nil {
 		return "", err
 	}
-	if err := unix.Mount(tmpdir, tmpdir, "bind", unix.MS_BIND, ""); err != nil {
+	if err := mountTo(tmpdir, tmpdir, "bind", unix.MS_BIND, ""); err != nil {
 		return "", err
 	}
 	if err := unix.Mount("", tmpdir, "", uintptr(unix.MS_PRIVATE), ""); err != nil {
@@ -278,7 +308,7 @@ func mountCgroupV1(m *configs.Mount, c *mountConfig) error {
 					data = cgroups.CgroupNamePrefix + data
 					source = "systemd"
 				}
-				return unix.Mount(source, procfd, "cgroup", uintptr(flags), data)
+				return mountTo(source, procfd, "cgroup", uintptr(flags), data)
 			}); err != nil {
 				return err
 			}
@@ -310,9 +340,9 @@ func mountCgroupV2(m *configs.Mount, c *mountConfig) error {
 		return err
 	}
 	return utils.WithProcfd(c.root, m.Destination, func(procfd string) error {
-		if err := unix.Mount(m.Source, procfd, "cgroup2", uintptr(m.Flags), m.Data); err != nil {
+		if err := mountTo(m.Source, procfd, "cgroup2", uintptr(m.Flags), m.Data); err != nil {
 			// when we are in UserNS but CgroupNS is not unshared, we cannot mount cgroup2 (#2158)
-			if err == unix.EPERM || err == unix.EBUSY {
+			if errors.Is(err, unix.EPERM) || errors.Is(err, unix.EBUSY) {
 				src := fs2.UnifiedMountpoint
 				if c.cgroupns && c.cgroup2Path != "" {
 					// Emulate cgroupns by bind-mounting
@@ -320,8 +350,8 @@ func mountCgroupV2(m *configs.Mount, c *mountConfig) error {
 					// the whole /sys/fs/cgroup.
 					src = c.cgroup2Path
 				}
-				err = unix.Mount(src, procfd, "", uintptr(m.Flags)|unix.MS_BIND, "")
-				if err == unix.ENOENT && c.rootlessCgroups {
+				err = mountTo(src, procfd, "", uintptr(m.Flags)|unix.MS_BIND, "")
+				if errors.Is(err, unix.ENOENT) && c.rootlessCgroups {
 					err = nil
 				}
 			}
@@ -443,7 +473,12 @@ func mountToRootfs(m *configs.Mount, c *mountConfig) error {
 		if err := prepareBindMount(m, rootfs); err != nil {
 			return err
 		}
-		if err := mountPropagate(m, rootfs, mountLabel); err != nil {
+		if mnt := c.idmapped[m]; mnt != nil {
+			err = mountIDMapped(m, rootfs, mnt)
+		} else {
+			err = mountPropagate(m, rootfs, mountLabel)
+		}
+		if err != nil {
 			return err
 		}
 		// bind mount won't change mount options, we need remount to make mount options effective.
@@ -454,6 +489,11 @@ func mountToRootfs(m *configs.Mount, c *mountConfig) error {
 				return err
 			}
 		}
+		if m.RecAttr != nil {
+			if err := setRecAttr(m, rootfs); err != nil {
+				return err
+			}
+		}
 
 		if m.Relabel != "" {
 			if err := label.Validate(m.Relabel); err != nil {
@@ -664,7 +704,7 @@ func bindMountDeviceNode(rootfs, dest string, node *devices.Device) error {
 		_ = f.Close()
 	}
 	return utils.WithProcfd(rootfs, dest, func(procfd string) error {
-		return unix.Mount(node.Path, procfd, "bind", unix.MS_BIND, "")
+		return mountTo(node.Path, procfd, "bind", unix.MS_BIND, "")
 	})
 }
 
@@ -767,7 +807,9 @@ func rootfsParentMountPrivate(rootfs string) error {
 	return nil
 }
 
-func prepareRoot(config *configs.Config) error {
+// prepareRoot sets up the container root filesystem mount. If rootfsMount
+// is not nil, it is a detached idmapped mount of the root filesystem.
+func prepareRoot(config *configs.Config, rootfsMount *os.File) error {
 	flag := unix.MS_SLAVE | unix.MS_REC
 	if config.RootPropagation != 0 {
 		flag = config.RootPropagation
@@ -783,7 +825,10 @@ func prepareRoot(config *configs.Config) error {
 		return err
 	}
 
-	return unix.Mount(config.Rootfs, config.Rootfs, "bind", unix.MS_BIND|unix.MS_REC, "")
+	if rootfsMount != nil {
+		return moveMount(rootfsMount, config.Rootfs)
+	}
+	return mountTo(config.Rootfs, config.Rootfs, "bind", unix.MS_BIND|unix.MS_REC, "")
 }
 
 func setReadonly() error {
@@ -921,7 +966,7 @@ func msMoveRoot(rootfs string) error {
 			} else {
 				// If we have not privileges for umounting (e.g. rootless), then
 				// cover the path.
-				if err := unix.Mount("tmpfs", p, "tmpfs", 0, ""); err != nil {
+				if err := mountTo("tmpfs", p, "tmpfs", 0, ""); err != nil {
 					return err
 				}
 			}
@@ -964,7 +1009,7 @@ func createIfNotExists(path string, isDir bool) error {
 
 // readonlyPath will make a path read only.
 func readonlyPath(path string) error {
-	if err := unix.Mount(path, path, "", unix.MS_BIND|unix.MS_REC, ""); err != nil {
+	if err := mountTo(path, path, "", unix.MS_BIND|unix.MS_REC, ""); err != nil {
 		if os.IsNotExist(err) {
 			return nil
 		}
@@ -1018,9 +1063,9 @@ func remountReadonly(m *configs.Mount) error {
 // For files, maskPath bind mounts /dev/null over the top of the specified path.
 // For directories, maskPath mounts read-only tmpfs over the top of the specified path.
 func maskPath(path string, mountLabel string) error {
-	if err := unix.Mount("/dev/null", path, "", unix.MS_BIND, ""); err != nil && !os.IsNotExist(err) {
-		if err == unix.ENOTDIR {
-			return unix.Mount("tmpfs", path, "tmpfs", unix.MS_RDONLY, label.FormatMountLabel("", mountLabel))
+	if err := mountTo("/dev/null", path, "", unix.MS_BIND, ""); err != nil && !os.IsNotExist(err) {
+		if errors.Is(err, unix.ENOTDIR) {
+			return mountTo("tmpfs", path, "tmpfs", unix.MS_RDONLY, label.FormatMountLabel("", mountLabel))
 		}
 		return err
 	}
@@ -1040,6 +1085,18 @@ func remount(m *configs.Mount, rootfs string) error {
 	})
 }
 
+// setRecAttr applies the recursive mount attributes of m to the mount and
+// all its submounts.
+func setRecAttr(m *configs.Mount, rootfs string) error {
+	return utils.WithProcfd(rootfs, m.Destination, func(procfd string) error {
+		attr := &system.MountAttr{
+			AttrSet: m.RecAttr.AttrSet,
+			AttrClr: m.RecAttr.AttrClr,
+		}
+		return system.MountSetattr(unix.AT_FDCWD, procfd, system.AT_RECURSIVE, attr)
+	})
+}
+
 // Do the mount operation followed by additional mounts required to take care
 // of propagation flags. This will always be scoped inside the container rootfs.
 func mountPropagate(m *configs.Mount, rootfs string, mountLabel string) error {
@@ -1060,13 +1117,28 @@ func mountPropagate(m *configs.Mount, rootfs string, mountLabel string) error {
 	// inside the container with WithProcfd() -- mounting through a procfd
 	// mounts on the target.
 	if err := utils.WithProcfd(rootfs, m.Destination, func(procfd string) error {
-		return unix.Mount(m.Source, procfd, m.Device, uintptr(flags), data)
+		return mountTo(m.Source, procfd, m.Device, uintptr(flags), data)
 	}); err != nil {
 		return fmt.Errorf("mount through procfd: %w", err)
 	}
 	// We have to apply mount propagation flags in a separate WithProcfd() call
 	// because the previous call invalidates the passed procfd -- the mount
 	// target needs to be re-opened.
+	return setPropagation(m, rootfs)
+}
+
+// mountIDMapped moves the detached idmapped mount mnt to the destination of
+// m, and applies its propagation flags.
+func mountIDMapped(m *configs.Mount, rootfs string, mnt *os.File) error {
+	if err := utils.WithProcfd(rootfs, m.Destination, func(procfd string) error {
+		return moveMount(mnt, procfd)
+	}); err != nil {
+		return fmt.Errorf("move idmapped mount through procfd: %w", err)
+	}
+	return setPropagation(m, rootfs)
+}
+
+func setPropagation(m *configs.Mount, rootfs string) error {
 	if err := utils.WithProcfd(rootfs, m.Destination, func(procfd string) error {
 		for _, pflag := range m.PropagationFlags {
 			if err := unix.Mount("", procfd, "", uintptr(pflag), ""); err != nil {
@@ -0,0 +1,233 @@
+package libcontainer
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/opencontainers/runc/libcontainer/cgroups"
+	"github.com/opencontainers/runc/libcontainer/cgroups/fs"
+	"github.com/opencontainers/runc/libcontainer/cgroups/fs2"
+	"github.com/opencontainers/runc/libcontainer/cgroups/systemd"
+	"github.com/opencontainers/runc/libcontainer/configs"
+	"github.com/opencontainers/runc/libcontainer/devices"
+	"golang.org/x/sys/unix"
+)
+
+// The features of a rootless container which can be degraded.
+const (
+	// DegradedCgroupLimits is the degradation of the limits of a cgroup
+	// controller, which are not applied.
+	DegradedCgroupLimits = "cgroup limits"
+	// DegradedDevicesCgroup is the degradation of the devices cgroup, whose
+	// rules are not enforced.
+	DegradedDevicesCgroup = "devices cgroup"
+	// DegradedCgroupMount is the degradation of the cgroup mount, for which
+	// the cgroup hierarchy of the host is bind mounted.
+	DegradedCgroupMount = "cgroup mount"
+)
+
+// Degradation is a feature of a rootless container which runc can't set up
+// without privileges, and skips rather than failing.
+type Degradation struct {
+	// Feature is the degraded feature, one of the Degraded constants.
+	Feature string `json:"feature"`
+	// Controller is the cgroup controller whose limits are not applied,
+	// for DegradedCgroupLimits.
+	Controller string `json:"controller,omitempty"`
+	// Reason explains why the feature is degraded.
+	Reason string `json:"reason"`
+}
+
+func (d Degradation) String() string {
+	if d.Controller != "" {
+		return fmt.Sprintf("%s (%s): %s", d.Feature, d.Controller, d.Reason)
+	}
+	return d.Feature + ": " + d.Reason
+}
+
+// RootlessPreflight returns the features of the container of config which are
+// degraded as it is rootless, i.e. config.RootlessEUID or
+// config.RootlessCgroups is set, in the order of the Degraded constants. It
+// is meant to be called before the container is created, so that the caller
+// knows which protections the container won't get.
+func RootlessPreflight(config *configs.Config) ([]Degradation, error) {
+	var res []Degradation
+	if config.RootlessCgroups && config.Cgroups != nil && config.Cgroups.Paths == nil {
+		limits, err := degradedCgroupLimits(config.Cgroups)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, limits...)
+		if d := degradedDevicesCgroup(config); d != nil {
+			res = append(res, *d)
+		}
+	}
+	if (config.RootlessEUID || config.Namespaces.Contains(configs.NEWUSER)) &&
+		cgroups.IsCgroup2UnifiedMode() && !config.Namespaces.Contains(configs.NEWCGROUP) {
+		for _, m := range config.Mounts {
+			if m.Device == "cgroup" || m.Device == "cgroup2" {
+				res = append(res, Degradation{
+					Feature: DegradedCgroupMount,
+					Reason:  "cgroup2 can't be mounted in a user namespace without a cgroup namespace, the cgroup hierarchy of the host is bind mounted on " + m.Destination,
+				})
+				break
+			}
+		}
+	}
+	return res, nil
+}
+
+// degradedCgroupLimits returns the degradations of the limits of the
+// controllers set in c.Resources, for the rootless cgroup managers.
+func degradedCgroupLimits(c *configs.Cgroup) ([]Degradation, error) {
+	controllers := cgroups.RequiredControllers(c.Resources)
+	if len(controllers) == 0 {
+		return nil, nil
+	}
+	degraded := func(controller, reason string) Degradation {
+		return Degradation{Feature: DegradedCgroupLimits, Controller: controller, Reason: reason}
+	}
+	var res []Degradation
+
+	if !cgroups.IsCgroup2UnifiedMode() {
+		if c.Systemd {
+			for _, ctrl := range controllers {
+				res = append(res, degraded(ctrl, "the systemd cgroup driver does not support rootless containers with cgroup v1"))
+			}
+			return res, nil
+		}
+		paths, err := fs.Paths(c)
+		if err != nil {
+			return nil, err
+		}
+		for _, ctrl := range controllers {
+			path, ok := paths[ctrl]
+			if !ok {
+				res = append(res, degraded(ctrl, "the controller is not mounted"))
+			} else if dir, ok := cgroupWritable(path); !ok {
+				res = append(res, degraded(ctrl, "no write permission on "+dir))
+			}
+		}
+		return res, nil
+	}
+
+	var available []string
+	if c.Systemd {
+		delegated, err := systemd.DelegatedControllers()
+		if err != nil {
+			return nil, err
+		}
+		available = delegated
+	} else {
+		m, err := fs2.NewManager(c, "", true)
+		if err != nil {
+			return nil, err
+		}
+		dir, ok := cgroupWritable(m.Path(""))
+		if !ok {
+			for _, ctrl := range controllers {
+				res = append(res, degraded(ctrl, "no write permission on "+dir))
+			}
+			return res, nil
+		}
+		file := "cgroup.controllers"
+		if dir != m.Path("") && unix.Access(filepath.Join(dir, "cgroup.subtree_control"), unix.W_OK) != nil {
+			// The controllers can't be enabled for the new cgroup.
+			file = "cgroup.subtree_control"
+		}
+		data, err := ioutil.ReadFile(filepath.Join(dir, file))
+		if err != nil {
+			return nil, err
+		}
+		available = strings.Fields(string(data))
+	}
+	for _, ctrl := range controllers {
+		found := false
+		for _, a := range available {
+			if a == ctrl {
+				found = true
+				break
+			}
+		}
+		if !found {
+			res = append(res, degraded(ctrl, "the controller is not delegated to the user"))
+		}
+	}
+	return res, nil
+}
+
+// cgroupWritable returns whether the cgroup at path can be written to by the
+// current user if it exists, or else created in its closest existing
+// ancestor, returned along.
+func cgroupWritable(path string) (string, bool) {
+	dir := path
+	for {
+		if _, err := os.Stat(dir); err == nil {
+			break
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return dir, false
+		}
+		dir = parent
+	}
+	if dir == path {
+		return dir, unix.Access(filepath.Join(dir, "cgroup.procs"), unix.W_OK) == nil
+	}
+	return dir, unix.Access(dir, unix.W_OK) == nil
+}
+
+// degradedDevicesCgroup returns the degradation of the devices cgroup, if
+// there are device nodes in the container the device rules deny the access
+// to, as they are not enforced by the rootless cgroup managers.
+func degradedDevicesCgroup(config *configs.Config) *Degradation {
+	var denied []string
+	for _, d := range config.Devices {
+		if !devicesAllowed(config.Cgroups.Resources.Devices, d) {
+			denied = append(denied, d.Path)
+		}
+	}
+	for _, m := range config.Mounts {
+		if m.Device != "bind" {
+			continue
+		}
+		d, err := devices.DeviceFromPath(m.Source, "rwm")
+		if err != nil {
+			continue
+		}
+		if !devicesAllowed(config.Cgroups.Resources.Devices, d) {
+			denied = append(denied, m.Destination)
+		}
+	}
+	if len(denied) == 0 {
+		return nil
+	}
+	return &Degradation{
+		Feature: DegradedDevicesCgroup,
+		Reason:  "the device rules are not enforced, the access to " + strings.Join(denied, ", ") + " is not denied",
+	}
+}
+
+// devicesAllowed returns whether the rules, the last matching one of which
+// applies, allow some access to the device d.
+func devicesAllowed(rules []*devices.Rule, d *devices.Device) bool {
+	allowed := false
+	for _, r := range rules {
+		if r.Type != devices.WildcardDevice && r.Type != d.Type {
+			continue
+		}
+		if r.Type != devices.WildcardDevice &&
+			(r.Major != devices.Wildcard && r.Major != d.Major || r.Minor != devices.Wildcard && r.Minor != d.Minor) {
+			continue
+		}
+		if r.Allow {
+			allowed = true
+		} else if d.Permissions.Difference(r.Permissions).IsEmpty() {
+			allowed = false
+		}
+	}
+	return allowed
+}
@@ -0,0 +1,84 @@
+// +build linux
+
+package libcontainer
+
+import (
+	"testing"
+
+	"github.com/opencontainers/runc/libcontainer/configs"
+	"github.com/opencontainers/runc/libcontainer/devices"
+)
+
+func TestDevicesAllowed(t *testing.T) {
+	fuse := &devices.Device{
+		Rule: devices.Rule{Type: devices.CharDevice, Major: 10, Minor: 229, Permissions: "rwm"},
+	}
+	denyAll := &devices.Rule{Type: devices.WildcardDevice, Major: devices.Wildcard, Minor: devices.Wildcard, Permissions: "rwm"}
+	allowFuse := &devices.Rule{Type: devices.CharDevice, Major: 10, Minor: 229, Permissions: "rw", Allow: true}
+	allowChars := &devices.Rule{Type: devices.CharDevice, Major: devices.Wildcard, Minor: devices.Wildcard, Permissions: "m", Allow: true}
+	denyBlocks := &devices.Rule{Type: devices.BlockDevice, Major: devices.Wildcard, Minor: devices.Wildcard, Permissions: "rwm"}
+
+	for _, tc := range []struct {
+		name    string
+		rules   []*devices.Rule
+		allowed bool
+	}{
+		{name: "no rules"},
+		{name: "deny all", rules: []*devices.Rule{denyAll}},
+		{name: "allowed", rules: []*devices.Rule{denyAll, allowFuse}, allowed: true},
+		{name: "allowed by wildcard", rules: []*devices.Rule{denyAll, allowChars}, allowed: true},
+		{name: "denied after allowed", rules: []*devices.Rule{allowFuse, denyAll}},
+		{name: "other type denied", rules: []*devices.Rule{allowFuse, denyBlocks}, allowed: true},
+	} {
+		if allowed := devicesAllowed(tc.rules, fuse); allowed != tc.allowed {
+			t.Errorf("%s: expected allowed=%v, got %v", tc.name, tc.allowed, allowed)
+		}
+	}
+}
+
+func TestRootlessPreflightRootful(t *testing.T) {
+	config := &configs.Config{
+		Cgroups: &configs.Cgroup{
+			Resources: &configs.Resources{Memory: 1 << 20},
+		},
+	}
+	degradations, err := RootlessPreflight(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(degradations) != 0 {
+		t.Fatalf("expected no degradations for a rootful container, got %v", degradations)
+	}
+}
+
+func TestRootlessPreflightDevices(t *testing.T) {
+	config := &configs.Config{
+		RootlessCgroups: true,
+		Cgroups: &configs.Cgroup{
+			// Set the paths, so that the cgroup limits aren't checked.
+			Paths: map[string]string{},
+			Resources: &configs.Resources{
+				Devices: []*devices.Rule{
+					{Type: devices.WildcardDevice, Major: devices.Wildcard, Minor: devices.Wildcard, Permissions: "rwm"},
+				},
+			},
+		},
+		Devices: []*devices.Device{
+			{Rule: devices.Rule{Type: devices.CharDevice, Major: 10, Minor: 229, Permissions: "rwm"}, Path: "/dev/fuse"},
+		},
+	}
+	degradations, err := RootlessPreflight(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Paths being set, the devices cgroup isn't managed by runc either.
+	if len(degradations) != 0 {
+		t.Fatalf("expected no degradations, got %v", degradations)
+	}
+
+	config.Cgroups.Paths = nil
+	config.Cgroups.Resources.Memory = 0
+	if d := degradedDevicesCgroup(config); d == nil || d.Feature != DegradedDevicesCgroup {
+		t.Fatalf("expected the devices cgroup to be degraded, got %v", d)
+	}
+}
@@ -2,6 +2,7 @@ package seccomp
 
 import (
 	"fmt"
+	"sort"
 
 	"github.com/opencontainers/runc/libcontainer/configs"
 )
@@ -17,12 +18,13 @@ var operators = map[string]configs.Operator{
 }
 
 var actions = map[string]configs.Action{
-	"SCMP_ACT_KILL":  configs.Kill,
-	"SCMP_ACT_ERRNO": configs.Errno,
-	"SCMP_ACT_TRAP":  configs.Trap,
-	"SCMP_ACT_ALLOW": configs.Allow,
-	"SCMP_ACT_TRACE": configs.Trace,
-	"SCMP_ACT_LOG":   configs.Log,
+	"SCMP_ACT_KILL":   configs.Kill,
+	"SCMP_ACT_ERRNO":  configs.Errno,
+	"SCMP_ACT_TRAP":   configs.Trap,
+	"SCMP_ACT_ALLOW":  configs.Allow,
+	"SCMP_ACT_TRACE":  configs.Trace,
+	"SCMP_ACT_LOG":    configs.Log,
+	"SCMP_ACT_NOTIFY": configs.Notify,
 }
 
 var archs = map[string]string{
@@ -75,3 +77,33 @@ func ConvertStringToArch(in string) (string, error) {
 	}
 	return "", fmt.Errorf("string %s is not a valid arch for seccomp", in)
 }
+
+// KnownOperators returns the names of the supported comparison operators.
+func KnownOperators() []string {
+	res := make([]string, 0, len(operators))
+	for op := range operators {
+		res = append(res, op)
+	}
+	sort.Strings(res)
+	return res
+}
+
+// KnownActions returns the names of the supported rule match actions.
+func KnownActions() []string {
+	res := make([]string, 0, len(actions))
+	for act := range actions {
+		res = append(res, act)
+	}
+	sort.Strings(res)
+	return res
+}
+
+// KnownArchs returns the names of the supported architectures.
+func KnownArchs() []string {
+	res := make([]string, 0, len(archs))
+	for arch := range archs {
+		res = append(res, arch)
+	}
+	sort.Strings(res)
+	return res
+}
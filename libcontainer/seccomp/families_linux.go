@@ -0,0 +1,188 @@
+// +build linux
+
+package seccomp
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// The seccomp constants which are not defined by golang.org/x/sys/unix.
+const (
+	retKillProcess = 0x80000000
+	retErrno       = 0x00050000
+	retAllow       = 0x7fff0000
+
+	// offsetNr, offsetArch and offsetArgs are the offsets of the fields of
+	// struct seccomp_data.
+	offsetNr   = 0
+	offsetArch = 4
+	offsetArgs = 16
+
+	// sysSocketcallSocket is the socketcall(2) call number of socket(2).
+	sysSocketcallSocket = 1
+)
+
+// socketArch describes how socket(2) is called on an architecture.
+type socketArch struct {
+	// arch is the AUDIT_ARCH_* value of the architecture.
+	arch uint32
+	// socket are the numbers of socket(2).
+	socket []uint32
+	// socketcall is the number of socketcall(2), or 0 if there's none.
+	socketcall uint32
+}
+
+// socketArches are the architectures a process can make system calls with,
+// by GOARCH: the native one first, then the compat ones.
+var socketArches = map[string][]socketArch{
+	"amd64": {
+		// The second number is the one of the x32 ABI.
+		{arch: 0xc000003e, socket: []uint32{41, 0x40000000 | 41}},
+		{arch: 0x40000003, socket: []uint32{359}, socketcall: 102},
+	},
+	"386": {
+		{arch: 0x40000003, socket: []uint32{359}, socketcall: 102},
+	},
+	"arm64": {
+		{arch: 0xc00000b7, socket: []uint32{198}},
+		{arch: 0x40000028, socket: []uint32{281}},
+	},
+	"arm": {
+		{arch: 0x40000028, socket: []uint32{281}},
+	},
+	"ppc64le": {
+		{arch: 0xc0000015, socket: []uint32{326}, socketcall: 102},
+	},
+	"riscv64": {
+		{arch: 0xc00000f3, socket: []uint32{198}},
+	},
+	"s390x": {
+		{arch: 0x80000016, socket: []uint32{359}, socketcall: 102},
+		{arch: 0x00000016, socket: []uint32{359}, socketcall: 102},
+	},
+}
+
+// RestrictAddressFamilies installs a seccomp filter making socket(2) fail
+// with EAFNOSUPPORT for the address families other than the given ones. It is
+// stacked on the other filters of the process, if any, and does not require
+// libseccomp. As socketcall(2) passes the family in memory, which seccomp
+// can't read, the creation of sockets with socketcall(2) is always denied (the
+// C libraries use socket(2) where it is available). The system calls of an
+// unknown architecture kill the process.
+//
+// Without NO_NEW_PRIVS, this requires CAP_SYS_ADMIN.
+func RestrictAddressFamilies(families []int) error {
+	filter, err := addressFamiliesFilter(runtime.GOARCH, families)
+	if err != nil {
+		return err
+	}
+	prog := unix.SockFprog{
+		Len:    uint16(len(filter)),
+		Filter: &filter[0],
+	}
+	if err := unix.Prctl(unix.PR_SET_SECCOMP, unix.SECCOMP_MODE_FILTER, uintptr(unsafe.Pointer(&prog)), 0, 0); err != nil {
+		return fmt.Errorf("unable to restrict the address families: %w", err)
+	}
+	runtime.KeepAlive(filter)
+	return nil
+}
+
+// bpfInsn is an instruction of a classic BPF program, with symbolic jump
+// targets.
+type bpfInsn struct {
+	unix.SockFilter
+	jt, jf string
+}
+
+func stmt(code uint16, k uint32) bpfInsn {
+	return bpfInsn{SockFilter: unix.SockFilter{Code: code, K: k}}
+}
+
+func jeq(k uint32, jt, jf string) bpfInsn {
+	return bpfInsn{SockFilter: unix.SockFilter{Code: unix.BPF_JMP | unix.BPF_JEQ | unix.BPF_K, K: k}, jt: jt, jf: jf}
+}
+
+// addressFamiliesFilter returns the filter of RestrictAddressFamilies for
+// goarch.
+func addressFamiliesFilter(goarch string, families []int) ([]unix.SockFilter, error) {
+	arches, ok := socketArches[goarch]
+	if !ok {
+		return nil, fmt.Errorf("restricting the address families is not supported on %s", goarch)
+	}
+	// The family is an int, i.e. the low 32 bits of the first argument.
+	arg0 := uint32(offsetArgs)
+	if isBigEndian() {
+		arg0 += 4
+	}
+	load := func(off uint32) bpfInsn {
+		return stmt(unix.BPF_LD|unix.BPF_W|unix.BPF_ABS, off)
+	}
+	ret := func(k uint32) bpfInsn {
+		return stmt(unix.BPF_RET|unix.BPF_K, k)
+	}
+	var (
+		insns  []bpfInsn
+		names  = make(map[string]int)
+		define = func(name string) { names[name] = len(insns) }
+	)
+	insns = append(insns, load(offsetArch))
+	for i, a := range arches {
+		insns = append(insns, jeq(a.arch, fmt.Sprintf("arch%d", i), ""))
+	}
+	insns = append(insns, ret(retKillProcess))
+	for i, a := range arches {
+		define(fmt.Sprintf("arch%d", i))
+		insns = append(insns, load(offsetNr))
+		for _, nr := range a.socket {
+			insns = append(insns, jeq(nr, "family", ""))
+		}
+		if a.socketcall != 0 {
+			insns = append(insns, jeq(a.socketcall, "socketcall", ""))
+		}
+		insns = append(insns, ret(retAllow))
+	}
+	define("family")
+	insns = append(insns, load(arg0))
+	for _, f := range families {
+		insns = append(insns, jeq(uint32(f), "allow", ""))
+	}
+	insns = append(insns, ret(retErrno|uint32(unix.EAFNOSUPPORT)))
+	define("socketcall")
+	insns = append(insns, load(arg0), jeq(sysSocketcallSocket, "", "allow"))
+	insns = append(insns, ret(retErrno|uint32(unix.EAFNOSUPPORT)))
+	define("allow")
+	insns = append(insns, ret(retAllow))
+
+	filter := make([]unix.SockFilter, len(insns))
+	for i, insn := range insns {
+		jump := func(name string) (uint8, error) {
+			if name == "" {
+				return 0, nil
+			}
+			off := names[name] - (i + 1)
+			if off < 0 || off > 255 {
+				return 0, errors.New("too many address families")
+			}
+			return uint8(off), nil
+		}
+		filter[i] = insn.SockFilter
+		var err error
+		if filter[i].Jt, err = jump(insn.jt); err != nil {
+			return nil, err
+		}
+		if filter[i].Jf, err = jump(insn.jf); err != nil {
+			return nil, err
+		}
+	}
+	return filter, nil
+}
+
+func isBigEndian() bool {
+	x := uint16(1)
+	return *(*byte)(unsafe.Pointer(&x)) == 0
+}
@@ -0,0 +1,82 @@
+// +build linux
+
+package seccomp
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestAddressFamiliesFilter(t *testing.T) {
+	for goarch := range socketArches {
+		filter, err := addressFamiliesFilter(goarch, []int{unix.AF_UNIX, unix.AF_INET, unix.AF_INET6})
+		if err != nil {
+			t.Fatalf("%s: %v", goarch, err)
+		}
+		if filter[len(filter)-1].Code != unix.BPF_RET|unix.BPF_K || filter[len(filter)-1].K != retAllow {
+			t.Errorf("%s: expected the filter to end with the allow return, got %+v", goarch, filter[len(filter)-1])
+		}
+	}
+	if _, err := addressFamiliesFilter("mips", nil); err == nil {
+		t.Error("expected an error for an unsupported architecture")
+	}
+}
+
+func TestRestrictAddressFamilies(t *testing.T) {
+	if os.Getenv("RUNC_TEST_RESTRICT_FAMILIES") != "" {
+		restrictAddressFamiliesHelper()
+		return
+	}
+	if _, ok := socketArches[runtime.GOARCH]; !ok {
+		t.Skipf("not supported on %s", runtime.GOARCH)
+	}
+	// The filter can't be removed, so it is installed in a child process.
+	cmd := exec.Command(os.Args[0], "-test.run=^TestRestrictAddressFamilies$")
+	cmd.Env = append(os.Environ(), "RUNC_TEST_RESTRICT_FAMILIES=1")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("%v: %s", err, out)
+	}
+}
+
+func restrictAddressFamiliesHelper() {
+	// The filter only applies to the calling thread (and its children).
+	runtime.LockOSThread()
+	fail := func(format string, args ...interface{}) {
+		fmt.Fprintf(os.Stderr, format+"\n", args...)
+		os.Exit(1)
+	}
+	if err := unix.Prctl(unix.PR_SET_NO_NEW_PRIVS, 1, 0, 0, 0); err != nil {
+		fail("no new privs: %v", err)
+	}
+	if err := RestrictAddressFamilies([]int{unix.AF_UNIX, unix.AF_INET}); err != nil {
+		fail("%v", err)
+	}
+	for _, tc := range []struct {
+		family int
+		err    error
+	}{
+		{unix.AF_UNIX, nil},
+		{unix.AF_INET, nil},
+		{unix.AF_INET6, unix.EAFNOSUPPORT},
+		{unix.AF_NETLINK, unix.EAFNOSUPPORT},
+		{unix.AF_PACKET, unix.EAFNOSUPPORT},
+	} {
+		typ := unix.SOCK_DGRAM
+		if tc.family == unix.AF_PACKET || tc.family == unix.AF_NETLINK {
+			typ = unix.SOCK_RAW
+		}
+		fd, err := unix.Socket(tc.family, typ|unix.SOCK_CLOEXEC, 0)
+		if err == nil {
+			unix.Close(fd) //nolint: errcheck
+		}
+		if err != tc.err {
+			fail("socket(%d): expected %v, got %v", tc.family, tc.err, err)
+		}
+	}
+	os.Exit(0)
+}
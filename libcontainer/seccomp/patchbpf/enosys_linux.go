@@ -41,6 +41,19 @@ const uintptr_t C_SET_MODE_FILTER = SECCOMP_SET_MODE_FILTER;
 #endif
 const uintptr_t C_FILTER_FLAG_LOG = SECCOMP_FILTER_FLAG_LOG;
 
+#ifndef SECCOMP_FILTER_FLAG_NEW_LISTENER
+#	define SECCOMP_FILTER_FLAG_NEW_LISTENER (1UL << 3)
+#endif
+const uintptr_t C_FILTER_FLAG_NEW_LISTENER = SECCOMP_FILTER_FLAG_NEW_LISTENER;
+
+#ifndef SECCOMP_RET_USER_NOTIF
+#	define SECCOMP_RET_USER_NOTIF 0x7fc00000U
+#endif
+const uint32_t C_RET_USER_NOTIF = SECCOMP_RET_USER_NOTIF;
+
+// The placeholder for SECCOMP_RET_USER_NOTIF (see NotifyPlaceholder).
+const uint32_t C_ACT_TRACE_NOTIFY = SCMP_ACT_TRACE(0xffff);
+
 // We use the AUDIT_ARCH_* values because those are the ones used by the kernel
 // and SCMP_ARCH_* sometimes has fake values (such as SCMP_ARCH_X32). But we
 // use <seccomp.h> so we get libseccomp's fallback definitions of AUDIT_ARCH_*.
@@ -65,6 +78,17 @@ import "C"
 
 var retErrnoEnosys = uint32(C.C_ACT_ERRNO_ENOSYS)
 
+// NotifyPlaceholder is the return code of the SCMP_ACT_TRACE action used in
+// place of SCMP_ACT_NOTIFY (which is not supported by libseccomp-golang).
+// Such actions are replaced with SECCOMP_RET_USER_NOTIF when the filter is
+// patched.
+const NotifyPlaceholder int16 = -1
+
+var (
+	retTraceNotify = uint32(C.C_ACT_TRACE_NOTIFY)
+	retUserNotif   = uint32(C.C_RET_USER_NOTIF)
+)
+
 func isAllowAction(action configs.Action) bool {
 	switch action {
 	// Trace is considered an "allow" action because a good tracer should
@@ -551,6 +575,10 @@ func enosysPatchFilter(config *configs.Seccomp, filter *libseccomp.ScmpFilter) (
 		return nil, errors.Wrap(err, "disassembling original filter")
 	}
 
+	if config.IsNotifyUsed() {
+		patchNotify(program)
+	}
+
 	patch, err := generatePatch(config)
 	if err != nil {
 		return nil, errors.Wrap(err, "generating patch for filter")
@@ -570,6 +598,16 @@ func enosysPatchFilter(config *configs.Seccomp, filter *libseccomp.ScmpFilter) (
 	return fprog, nil
 }
 
+// patchNotify replaces the placeholder actions in program with
+// SECCOMP_RET_USER_NOTIF.
+func patchNotify(program []bpf.Instruction) {
+	for idx, insn := range program {
+		if ret, ok := insn.(bpf.RetConstant); ok && ret.Val == retTraceNotify {
+			program[idx] = bpf.RetConstant{Val: retUserNotif}
+		}
+	}
+}
+
 func filterFlags(filter *libseccomp.ScmpFilter) (flags uint, noNewPrivs bool, err error) {
 	// Ignore the error since pre-2.4 libseccomp is treated as API level 0.
 	apiLevel, _ := libseccomp.GetApi()
@@ -591,23 +629,28 @@ func filterFlags(filter *libseccomp.ScmpFilter) (flags uint, noNewPrivs bool, er
 	return
 }
 
-func sysSeccompSetFilter(flags uint, filter []unix.SockFilter) (err error) {
+func sysSeccompSetFilter(flags uint, filter []unix.SockFilter) (fd int, err error) {
 	fprog := unix.SockFprog{
 		Len:    uint16(len(filter)),
 		Filter: &filter[0],
 	}
+	fd = -1
 	// If no seccomp flags were requested we can use the old-school prctl(2).
 	if flags == 0 {
 		err = unix.Prctl(unix.PR_SET_SECCOMP,
 			unix.SECCOMP_MODE_FILTER,
 			uintptr(unsafe.Pointer(&fprog)), 0, 0)
 	} else {
-		_, _, errno := unix.RawSyscall(unix.SYS_SECCOMP,
+		r1, _, errno := unix.RawSyscall(unix.SYS_SECCOMP,
 			uintptr(C.C_SET_MODE_FILTER),
 			uintptr(flags), uintptr(unsafe.Pointer(&fprog)))
 		if errno != 0 {
 			err = errno
 		}
+		// With SECCOMP_FILTER_FLAG_NEW_LISTENER, the notify fd is returned.
+		if err == nil && flags&uint(C.C_FILTER_FLAG_NEW_LISTENER) != 0 {
+			fd = int(r1)
+		}
 	}
 	runtime.KeepAlive(filter)
 	runtime.KeepAlive(fprog)
@@ -618,18 +661,22 @@ func sysSeccompSetFilter(flags uint, filter []unix.SockFilter) (err error) {
 // been pre-configured with the set of rules in the seccomp config. It then
 // patches said filter to handle -ENOSYS in a much nicer manner than the
 // default libseccomp default action behaviour, and loads the patched filter
-// into the kernel for the current process.
-func PatchAndLoad(config *configs.Seccomp, filter *libseccomp.ScmpFilter) error {
+// into the kernel for the current process. If the Notify action is used, the
+// seccomp notify fd is returned; otherwise, the returned fd is -1.
+func PatchAndLoad(config *configs.Seccomp, filter *libseccomp.ScmpFilter) (int, error) {
 	// Generate a patched filter.
 	fprog, err := enosysPatchFilter(config, filter)
 	if err != nil {
-		return errors.Wrap(err, "patching filter")
+		return -1, errors.Wrap(err, "patching filter")
 	}
 
 	// Get the set of libseccomp flags set.
 	seccompFlags, noNewPrivs, err := filterFlags(filter)
 	if err != nil {
-		return errors.Wrap(err, "fetch seccomp filter flags")
+		return -1, errors.Wrap(err, "fetch seccomp filter flags")
+	}
+	if config.IsNotifyUsed() {
+		seccompFlags |= uint(C.C_FILTER_FLAG_NEW_LISTENER)
 	}
 
 	// Set no_new_privs if it was requested, though in runc we handle
@@ -637,13 +684,14 @@ func PatchAndLoad(config *configs.Seccomp, filter *libseccomp.ScmpFilter) error
 	if noNewPrivs {
 		logrus.Warnf("potentially misconfigured filter -- setting no_new_privs in seccomp path")
 		if err := unix.Prctl(unix.PR_SET_NO_NEW_PRIVS, 1, 0, 0, 0); err != nil {
-			return errors.Wrap(err, "enable no_new_privs bit")
+			return -1, errors.Wrap(err, "enable no_new_privs bit")
 		}
 	}
 
 	// Finally, load the filter.
-	if err := sysSeccompSetFilter(seccompFlags, fprog); err != nil {
-		return errors.Wrap(err, "loading seccomp filter")
+	fd, err := sysSeccompSetFilter(seccompFlags, fprog)
+	if err != nil {
+		return -1, errors.Wrap(err, "loading seccomp filter")
 	}
-	return nil
+	return fd, nil
 }
@@ -293,3 +293,43 @@ func TestDisassembleHugeFilterDoesNotHang(t *testing.T) {
 
 	// if we exit, we did not hang
 }
+
+func TestPatchNotify(t *testing.T) {
+	filter, err := libseccomp.NewFilter(libseccomp.ActAllow)
+	if err != nil {
+		t.Fatalf("failed to create seccomp filter: %v", err)
+	}
+	sysno, err := libseccomp.GetSyscallFromName("mount")
+	if err != nil {
+		t.Fatalf("failed to resolve syscall: %v", err)
+	}
+	if err := filter.AddRule(sysno, libseccomp.ActTrace.SetReturnCode(NotifyPlaceholder)); err != nil {
+		t.Fatalf("failed to add rule to filter: %v", err)
+	}
+	config := &configs.Seccomp{
+		DefaultAction: configs.Allow,
+		Syscalls:      []*configs.Syscall{{Name: "mount", Action: configs.Notify}},
+	}
+
+	fprog, err := enosysPatchFilter(config, filter)
+	if err != nil {
+		t.Fatalf("failed to patch filter: %v", err)
+	}
+	var found bool
+	for _, insn := range fprog {
+		raw := bpf.RawInstruction{Op: insn.Code, Jt: insn.Jt, Jf: insn.Jf, K: insn.K}
+		ret, ok := raw.Disassemble().(bpf.RetConstant)
+		if !ok {
+			continue
+		}
+		switch ret.Val {
+		case retTraceNotify:
+			t.Fatalf("placeholder action was not replaced")
+		case retUserNotif:
+			found = true
+		}
+	}
+	if !found {
+		t.Fatalf("no SECCOMP_RET_USER_NOTIF action in patched filter")
+	}
+}
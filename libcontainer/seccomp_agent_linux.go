@@ -0,0 +1,94 @@
+// +build linux
+
+package libcontainer
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+
+	"github.com/opencontainers/runc/libcontainer/configs"
+	"github.com/opencontainers/runc/libcontainer/utils"
+	"github.com/opencontainers/runtime-spec/specs-go"
+	"golang.org/x/sys/unix"
+)
+
+// syncParentSeccomp sends the seccomp notify fd to the parent, which passes
+// it on to the seccomp agent, and waits for the parent to be done with it.
+// The fd is closed afterwards, as it is not needed by the container process.
+// Nothing is done if seccompFd is -1 (i.e. SCMP_ACT_NOTIFY is not used).
+func syncParentSeccomp(pipe *os.File, seccompFd int) error {
+	if seccompFd == -1 {
+		return nil
+	}
+	defer unix.Close(seccompFd) //nolint: errcheck
+
+	if err := writeSync(pipe, procSeccomp); err != nil {
+		return err
+	}
+	// The fd can only be sent once the parent is ready to receive it, as
+	// it might otherwise be read (and discarded) along with the sync.
+	if err := readSync(pipe, procSeccompReady); err != nil {
+		return err
+	}
+	if err := utils.SendFd(pipe, "seccomp-notify", uintptr(seccompFd)); err != nil {
+		return err
+	}
+	return readSync(pipe, procSeccompDone)
+}
+
+// recvSeccompFd handles procSeccomp from the child: it receives the seccomp
+// notify fd over pipe, and sends it to the seccomp agent listening on the
+// configured listener path, along with the container process state.
+func recvSeccompFd(pipe *os.File, config *configs.Config, state *specs.State, pid int) error {
+	if config.Seccomp == nil || config.Seccomp.ListenerPath == "" {
+		return errors.New("seccomp notify fd received, but no listener path is configured")
+	}
+	if err := writeSync(pipe, procSeccompReady); err != nil {
+		return err
+	}
+	seccompFd, err := utils.RecvFd(pipe)
+	if err != nil {
+		return fmt.Errorf("receiving seccomp fd: %w", err)
+	}
+	defer seccompFd.Close()
+
+	procState := &specs.ContainerProcessState{
+		Version:  specs.Version,
+		Fds:      []string{specs.SeccompFdName},
+		Pid:      pid,
+		Metadata: config.Seccomp.ListenerMetadata,
+		State:    *state,
+	}
+	if err := sendContainerProcessState(config.Seccomp.ListenerPath, procState, seccompFd); err != nil {
+		return err
+	}
+	return writeSync(pipe, procSeccompDone)
+}
+
+// sendContainerProcessState sends the container process state, along with
+// the fds listed in it, to the seccomp agent listening on listenerPath, as
+// described by the OCI runtime spec.
+func sendContainerProcessState(listenerPath string, state *specs.ContainerProcessState, fds ...*os.File) error {
+	conn, err := net.Dial("unix", listenerPath)
+	if err != nil {
+		return fmt.Errorf("connecting to seccomp agent: %w", err)
+	}
+	defer conn.Close()
+
+	data, err := json.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("marshalling container process state: %w", err)
+	}
+	rawFds := make([]int, 0, len(fds))
+	for _, f := range fds {
+		rawFds = append(rawFds, int(f.Fd()))
+	}
+	oob := unix.UnixRights(rawFds...)
+	if _, _, err := conn.(*net.UnixConn).WriteMsgUnix(data, oob, nil); err != nil {
+		return fmt.Errorf("sending container process state to seccomp agent: %w", err)
+	}
+	return nil
+}
@@ -57,6 +57,14 @@ func (l *linuxSetnsInit) Init() error {
 			return err
 		}
 	}
+	// IOPRIO_CLASS_RT requires CAP_SYS_ADMIN, so this has to be done
+	// before finalizeNamespace drops the capabilities.
+	if err := setIOPriority(l.config.IOPriority); err != nil {
+		return err
+	}
+	if err := setupPersonality(l.config.Config); err != nil {
+		return err
+	}
 	if l.config.NoNewPrivileges {
 		if err := unix.Prctl(unix.PR_SET_NO_NEW_PRIVS, 1, 0, 0, 0); err != nil {
 			return err
@@ -66,11 +74,18 @@ func (l *linuxSetnsInit) Init() error {
 		return err
 	}
 	defer selinux.SetExecLabel("") //nolint: errcheck
+	if err := restrictAddressFamilies(l.config.Config); err != nil {
+		return err
+	}
 	// Without NoNewPrivileges seccomp is a privileged operation, so we need to
 	// do this before dropping capabilities; otherwise do it as late as possible
 	// just before execve so as few syscalls take place after it as possible.
 	if l.config.Config.Seccomp != nil && !l.config.NoNewPrivileges {
-		if err := seccomp.InitSeccomp(l.config.Config.Seccomp); err != nil {
+		seccompFd, err := seccomp.InitSeccomp(l.config.Config.Seccomp)
+		if err != nil {
+			return err
+		}
+		if err := syncParentSeccomp(l.pipe, seccompFd); err != nil {
 			return err
 		}
 	}
@@ -84,9 +99,13 @@ func (l *linuxSetnsInit) Init() error {
 	// place afterward (reducing the amount of syscalls that users need to
 	// enable in their seccomp profiles).
 	if l.config.Config.Seccomp != nil && l.config.NoNewPrivileges {
-		if err := seccomp.InitSeccomp(l.config.Config.Seccomp); err != nil {
+		seccompFd, err := seccomp.InitSeccomp(l.config.Config.Seccomp)
+		if err != nil {
 			return newSystemErrorWithCause(err, "init seccomp")
 		}
+		if err := syncParentSeccomp(l.pipe, seccompFd); err != nil {
+			return newSystemErrorWithCause(err, "sync seccomp")
+		}
 	}
 	logrus.Debugf("setns_init: about to exec")
 	// Close the log pipe fd so the parent's ForwardLogs can exit.
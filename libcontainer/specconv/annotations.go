@@ -0,0 +1,12 @@
+package specconv
+
+// Annotations of the spec to set up the network of the container with a
+// user-mode networking helper, either "pasta" or "slirp4netns", and the ports
+// it forwards from the host, as a JSON array of port forwards in the format
+// "[HOST_IP:]HOST_PORT:CONTAINER_PORT[/PROTOCOL]", such as "8080:80/tcp".
+// Without a helper, the ports are bound on the host and passed to the
+// container as listening sockets, so they must be the same in the container.
+const (
+	NetworkHelperAnnotation = "org.opencontainers.runc.network.helper"
+	NetworkPortsAnnotation  = "org.opencontainers.runc.network.ports"
+)
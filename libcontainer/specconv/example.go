@@ -3,6 +3,7 @@ package specconv
 import (
 	"os"
 	"path/filepath"
+	"runtime"
 	"strings"
 
 	"github.com/opencontainers/runc/libcontainer/cgroups"
@@ -228,3 +229,126 @@ func ToRootless(spec *specs.Spec) {
 	// Remove cgroup settings.
 	spec.Linux.Resources = nil
 }
+
+// ToSystemdCgroup adjusts the given spec file for the systemd cgroup driver,
+// by having systemd garbage collect the unit of the container even if it
+// failed, so that a container with the same name can be created again. This
+// requires systemd v236 or later.
+func ToSystemdCgroup(spec *specs.Spec) {
+	if spec.Annotations == nil {
+		spec.Annotations = make(map[string]string)
+	}
+	spec.Annotations["org.systemd.property.CollectMode"] = "'inactive-or-failed'"
+}
+
+// ToNetworkHelper converts the given spec file into one where the container
+// has its own network namespace, connected to the network of the host by the
+// user-mode networking helper, either pasta or slirp4netns. This also works in
+// rootless containers.
+func ToNetworkHelper(spec *specs.Spec, helper string) {
+	hasNetns := false
+	for _, ns := range spec.Linux.Namespaces {
+		if ns.Type == specs.NetworkNamespace {
+			hasNetns = true
+		}
+	}
+	if !hasNetns {
+		spec.Linux.Namespaces = append(spec.Linux.Namespaces, specs.LinuxNamespace{
+			Type: specs.NetworkNamespace,
+		})
+	}
+	if spec.Annotations == nil {
+		spec.Annotations = make(map[string]string)
+	}
+	spec.Annotations[NetworkHelperAnnotation] = helper
+}
+
+// seccompArchs are the architectures of the syscalls a process can make, by
+// the architecture of runc.
+var seccompArchs = map[string][]specs.Arch{
+	"386":      {specs.ArchX86},
+	"amd64":    {specs.ArchX86_64, specs.ArchX86, specs.ArchX32},
+	"arm":      {specs.ArchARM},
+	"arm64":    {specs.ArchAARCH64, specs.ArchARM},
+	"mips":     {specs.ArchMIPS},
+	"mipsle":   {specs.ArchMIPSEL},
+	"mips64":   {specs.ArchMIPS64, specs.ArchMIPS64N32, specs.ArchMIPS},
+	"mips64le": {specs.ArchMIPSEL64, specs.ArchMIPSEL64N32, specs.ArchMIPSEL},
+	"ppc64":    {specs.ArchPPC64, specs.ArchPPC},
+	"ppc64le":  {specs.ArchPPC64LE},
+	"s390x":    {specs.ArchS390X, specs.ArchS390},
+}
+
+// NativeSeccompArchs returns the architectures of the syscalls a process can
+// make, by the architecture of runc, or nil if they are unknown.
+func NativeSeccompArchs() []specs.Arch {
+	return seccompArchs[runtime.GOARCH]
+}
+
+// MinimalSeccomp returns a seccomp profile which allows all the syscalls but
+// the ones which are blocked by the default profiles of the container engines,
+// as they administer the host (kernel modules, swap, clock, reboot), bypass
+// the isolation of the container (mounts, namespaces, file handles, keyrings)
+// or expose the kernel to attacks (bpf, perf events, userfaultfd). They fail
+// with EPERM.
+func MinimalSeccomp() *specs.LinuxSeccomp {
+	return &specs.LinuxSeccomp{
+		DefaultAction: specs.ActAllow,
+		Architectures: NativeSeccompArchs(),
+		Syscalls: []specs.LinuxSyscall{
+			{
+				Names: []string{
+					"_sysctl",
+					"acct",
+					"add_key",
+					"bpf",
+					"clock_adjtime",
+					"clock_settime",
+					"create_module",
+					"delete_module",
+					"finit_module",
+					"fsconfig",
+					"fsmount",
+					"fsopen",
+					"fspick",
+					"get_kernel_syms",
+					"init_module",
+					"ioperm",
+					"iopl",
+					"kexec_file_load",
+					"kexec_load",
+					"keyctl",
+					"lookup_dcookie",
+					"mount",
+					"mount_setattr",
+					"move_mount",
+					"name_to_handle_at",
+					"nfsservctl",
+					"open_by_handle_at",
+					"open_tree",
+					"perf_event_open",
+					"pivot_root",
+					"query_module",
+					"quotactl",
+					"reboot",
+					"request_key",
+					"setns",
+					"settimeofday",
+					"stime",
+					"swapoff",
+					"swapon",
+					"syslog",
+					"umount",
+					"umount2",
+					"unshare",
+					"uselib",
+					"userfaultfd",
+					"ustat",
+					"vm86",
+					"vm86old",
+				},
+				Action: specs.ActErrno,
+			},
+		},
+	}
+}
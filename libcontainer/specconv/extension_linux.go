@@ -0,0 +1,127 @@
+// +build linux
+
+package specconv
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/opencontainers/runc/libcontainer/configs"
+)
+
+// Extension completes the config converted from opts.Spec by
+// CreateLibcontainerConfig, e.g. with the handling of custom annotations, or
+// of spec fields which are not known to the runtime-spec package, decoded
+// from opts.RawSpec.
+type Extension func(opts *CreateOpts, config *configs.Config) error
+
+// AnnotationHandler handles the annotation of the spec with the value, by
+// updating the config converted from opts.Spec.
+type AnnotationHandler func(value string, opts *CreateOpts, config *configs.Config) error
+
+type namedExtension struct {
+	name string
+	ext  Extension
+}
+
+var (
+	extensionsMu       sync.RWMutex
+	extensions         []namedExtension
+	annotationHandlers = make(map[string]AnnotationHandler)
+)
+
+// RegisterExtension registers the extension ext under name, to be run by
+// CreateLibcontainerConfig, in the order of registration. It is meant to be
+// called from the init function of the package providing the extension, and
+// panics if ext is nil or if name is already registered.
+func RegisterExtension(name string, ext Extension) {
+	extensionsMu.Lock()
+	defer extensionsMu.Unlock()
+	if ext == nil {
+		panic("specconv: nil extension " + name)
+	}
+	for _, e := range extensions {
+		if e.name == name {
+			panic("specconv: extension " + name + " registered twice")
+		}
+	}
+	extensions = append(extensions, namedExtension{name: name, ext: ext})
+}
+
+// RegisterAnnotationHandler registers h as the handler of the annotation
+// key, to be run by CreateLibcontainerConfig if the spec has the annotation.
+// It panics if h is nil or if key already has a handler. The annotations
+// handled by runc itself can't be handled differently, as the handlers are
+// run afterwards, but they can be handled in addition.
+func RegisterAnnotationHandler(key string, h AnnotationHandler) {
+	extensionsMu.Lock()
+	defer extensionsMu.Unlock()
+	if h == nil {
+		panic("specconv: nil handler of annotation " + key)
+	}
+	if _, ok := annotationHandlers[key]; ok {
+		panic("specconv: annotation " + key + " handled twice")
+	}
+	annotationHandlers[key] = h
+}
+
+// KnownAnnotations returns the annotations handled by CreateLibcontainerConfig
+// (the prefixes of the ones with a variable part end with "."), including the
+// ones with a registered handler, sorted.
+func KnownAnnotations() []string {
+	known := []string{
+		SystemdPropertyAnnotationPrefix,
+		PostCheckpointHooksAnnotation,
+		PreRestoreHooksAnnotation,
+		RootfsIDMapAnnotation,
+		ManagedOOMMemoryPressureAnnotation,
+		ManagedOOMMemoryPressureLimitAnnotation,
+		AllowedAddressFamiliesAnnotation,
+		NetworkHelperAnnotation,
+		NetworkPortsAnnotation,
+	}
+	extensionsMu.RLock()
+	for key := range annotationHandlers {
+		known = append(known, key)
+	}
+	extensionsMu.RUnlock()
+	sort.Strings(known)
+	return known
+}
+
+// runExtensions runs the handlers of the annotations of the spec, sorted by
+// key, then the registered extensions, and the extensions of opts.
+func runExtensions(opts *CreateOpts, config *configs.Config) error {
+	extensionsMu.RLock()
+	var keys []string
+	for key := range opts.Spec.Annotations {
+		if _, ok := annotationHandlers[key]; ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	handlers := make([]AnnotationHandler, len(keys))
+	for i, key := range keys {
+		handlers[i] = annotationHandlers[key]
+	}
+	exts := append([]namedExtension(nil), extensions...)
+	extensionsMu.RUnlock()
+
+	for i, h := range handlers {
+		if err := h(opts.Spec.Annotations[keys[i]], opts, config); err != nil {
+			return fmt.Errorf("annotation %s: %w", keys[i], err)
+		}
+	}
+	for _, e := range exts {
+		if err := e.ext(opts, config); err != nil {
+			return fmt.Errorf("extension %s: %w", e.name, err)
+		}
+	}
+	for _, ext := range opts.Extensions {
+		if err := ext(opts, config); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -5,11 +5,17 @@
 package specconv
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"net"
 	"os"
 	"path/filepath"
 	"regexp"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 
@@ -18,7 +24,9 @@ import (
 	"github.com/opencontainers/runc/libcontainer/cgroups"
 	"github.com/opencontainers/runc/libcontainer/configs"
 	"github.com/opencontainers/runc/libcontainer/devices"
+	"github.com/opencontainers/runc/libcontainer/intelrdt"
 	"github.com/opencontainers/runc/libcontainer/seccomp"
+	"github.com/opencontainers/runc/libcontainer/system"
 	libcontainerUtils "github.com/opencontainers/runc/libcontainer/utils"
 	"github.com/opencontainers/runtime-spec/specs-go"
 	"github.com/sirupsen/logrus"
@@ -26,6 +34,20 @@ import (
 	"golang.org/x/sys/unix"
 )
 
+// deviceFilterPinDir is the directory on bpffs under which the eBPF device
+// filter programs are pinned, if requested.
+const deviceFilterPinDir = "/sys/fs/bpf/runc"
+
+// deviceFilterPinPath returns the path the eBPF device filter program of the
+// container name, in the state root root, is pinned at.
+func deviceFilterPinPath(root, name string) string {
+	if root == "" {
+		return filepath.Join(deviceFilterPinDir, name)
+	}
+	sum := sha256.Sum256([]byte(root))
+	return filepath.Join(deviceFilterPinDir, hex.EncodeToString(sum[:8]), name)
+}
+
 var namespaceMapping = map[specs.LinuxNamespaceType]configs.NamespaceType{
 	specs.PIDNamespace:     configs.NEWPID,
 	specs.NetworkNamespace: configs.NEWNET,
@@ -34,8 +56,26 @@ var namespaceMapping = map[specs.LinuxNamespaceType]configs.NamespaceType{
 	specs.IPCNamespace:     configs.NEWIPC,
 	specs.UTSNamespace:     configs.NEWUTS,
 	specs.CgroupNamespace:  configs.NEWCGROUP,
+	timeNamespace:          configs.NEWTIME,
 }
 
+// KnownNamespaces returns the types of the namespaces supported by runc,
+// which are also available on the host.
+func KnownNamespaces() []string {
+	var res []string
+	for t, ns := range namespaceMapping {
+		if configs.IsNamespaceSupported(ns) {
+			res = append(res, string(t))
+		}
+	}
+	sort.Strings(res)
+	return res
+}
+
+// timeNamespace is the type of the time namespace, which is not known to the
+// vendored runtime-spec package yet.
+const timeNamespace specs.LinuxNamespaceType = "time"
+
 var mountPropagationMapping = map[string]int{
 	"rprivate":    unix.MS_PRIVATE | unix.MS_REC,
 	"private":     unix.MS_PRIVATE,
@@ -200,10 +240,66 @@ type CreateOpts struct {
 	Spec             *specs.Spec
 	RootlessEUID     bool
 	RootlessCgroups  bool
+	// CgroupRoot is the cgroup, relative to the root of the cgroup
+	// hierarchy mounted on /sys/fs/cgroup, in which the cgroup of the
+	// container is created when its path is relative, rather than in the
+	// cgroup of runc. It can't be used with the systemd cgroup driver.
+	CgroupRoot string
+	// PinDeviceFilter enables pinning of the eBPF device filter program
+	// (cgroup v2 only) under deviceFilterPinDir, using CgroupName as the
+	// file name.
+	PinDeviceFilter bool
+	// StateRoot is the directory of the states of the containers (runc
+	// --root). Unless empty, the device filter program is pinned under a
+	// directory named after a hash of it, so that containers with the same
+	// name in different state roots don't share their pin path.
+	StateRoot string
+	// DeviceFilterMap makes the eBPF device filter program (cgroup v2 only)
+	// consult a map of the allowed devices, rather than having the device
+	// rules in its instructions.
+	DeviceFilterMap bool
+	// DeviceFilterFailClosed makes the eBPF device filter program mandatory
+	// (see configs.Cgroup.DeviceFilterFailClosed).
+	DeviceFilterFailClosed bool
+	// AuditDevices makes the eBPF device filter program record the device
+	// accesses it denies (see configs.Cgroup.AuditDevices).
+	AuditDevices bool
+	// SchedCore creates a new core scheduling cookie for the container.
+	SchedCore bool
+	// TimeOffsets are the clock offsets of the time namespace, i.e.
+	// linux.timeOffsets of the spec, which is not known to the vendored
+	// runtime-spec package yet.
+	TimeOffsets map[string]configs.TimeOffset
+	// Scheduler are the scheduling attributes of the init process, i.e.
+	// process.scheduler of the spec, which is not known to the vendored
+	// runtime-spec package yet.
+	Scheduler *configs.Scheduler
+	// IOPriority is the I/O priority of the container's processes, i.e.
+	// process.ioPriority of the spec, which is not known to the vendored
+	// runtime-spec package yet.
+	IOPriority *configs.IOPriority
+	// MemoryPolicy is the NUMA memory policy of the init process, i.e.
+	// linux.memoryPolicy of the spec, which is not known to the vendored
+	// runtime-spec package yet.
+	MemoryPolicy *configs.MemoryPolicy
+	// Networks are the network interfaces to set up in the network
+	// namespace of the container, in addition to the loopback one, and
+	// Routes are the routes to add there, i.e. linux.networks and
+	// linux.routes, which are runc extensions of the spec.
+	Networks []*configs.Network
+	Routes   []*configs.Route
+	// RawSpec is the JSON of Spec, if available, for the extensions to
+	// decode the spec fields which are not known to the runtime-spec
+	// package.
+	RawSpec json.RawMessage
+	// Extensions complete the config, after the registered ones (see
+	// RegisterExtension).
+	Extensions []Extension
 }
 
 // CreateLibcontainerConfig creates a new libcontainer configuration from a
-// given specification and a cgroup name
+// given specification and a cgroup name. The config is completed by the
+// registered annotation handlers and extensions, and the ones of opts.
 func CreateLibcontainerConfig(opts *CreateOpts) (*configs.Config, error) {
 	// runc's cwd will always be the bundle path
 	rcwd, err := os.Getwd()
@@ -235,6 +331,7 @@ func CreateLibcontainerConfig(opts *CreateOpts) (*configs.Config, error) {
 		NoNewKeyring:    opts.NoNewKeyring,
 		RootlessEUID:    opts.RootlessEUID,
 		RootlessCgroups: opts.RootlessCgroups,
+		SchedCore:       opts.SchedCore,
 	}
 
 	for _, m := range spec.Mounts {
@@ -283,15 +380,26 @@ func CreateLibcontainerConfig(opts *CreateOpts) (*configs.Config, error) {
 				},
 			}
 		}
+		config.Networks = append(config.Networks, opts.Networks...)
+		config.Routes = opts.Routes
 		if config.Namespaces.Contains(configs.NEWUSER) {
 			if err := setupUserNamespace(spec, config); err != nil {
 				return nil, err
 			}
 		}
+		config.TimeOffsets = opts.TimeOffsets
+		config.MemoryPolicy = opts.MemoryPolicy
 		config.MaskPaths = spec.Linux.MaskedPaths
 		config.ReadonlyPaths = spec.Linux.ReadonlyPaths
 		config.MountLabel = spec.Linux.MountLabel
 		config.Sysctl = spec.Linux.Sysctl
+		if spec.Linux.Personality != nil {
+			personality, err := createPersonality(spec.Linux.Personality)
+			if err != nil {
+				return nil, err
+			}
+			config.Personality = personality
+		}
 		if spec.Linux.Seccomp != nil {
 			seccomp, err := SetupSeccomp(spec.Linux.Seccomp)
 			if err != nil {
@@ -302,16 +410,26 @@ func CreateLibcontainerConfig(opts *CreateOpts) (*configs.Config, error) {
 		if spec.Linux.IntelRdt != nil {
 			config.IntelRdt = &configs.IntelRdt{}
 			if spec.Linux.IntelRdt.L3CacheSchema != "" {
-				config.IntelRdt.L3CacheSchema = spec.Linux.IntelRdt.L3CacheSchema
+				// The runtime spec has no separate field for the L2 cache
+				// schema (yet), so its lines are taken from l3CacheSchema.
+				config.IntelRdt.L3CacheSchema, config.IntelRdt.L2CacheSchema = splitL2CacheSchema(spec.Linux.IntelRdt.L3CacheSchema)
 			}
 			if spec.Linux.IntelRdt.MemBwSchema != "" {
 				config.IntelRdt.MemBwSchema = spec.Linux.IntelRdt.MemBwSchema
 			}
+			// With no schema, the container only gets monitored, using
+			// whatever monitoring features are available.
+			if config.IntelRdt.L3CacheSchema == "" && config.IntelRdt.L2CacheSchema == "" && config.IntelRdt.MemBwSchema == "" {
+				config.IntelRdt.EnableCMT = intelrdt.IsCMTEnabled()
+				config.IntelRdt.EnableMBM = intelrdt.IsMBMEnabled()
+			}
 		}
 	}
 	if spec.Process != nil {
 		config.OomScoreAdj = spec.Process.OOMScoreAdj
 		config.NoNewPrivileges = spec.Process.NoNewPrivileges
+		config.Scheduler = opts.Scheduler
+		config.IOPriority = opts.IOPriority
 		config.Umask = spec.Process.User.Umask
 		if spec.Process.SelinuxLabel != "" {
 			config.ProcessLabel = spec.Process.SelinuxLabel
@@ -327,15 +445,48 @@ func CreateLibcontainerConfig(opts *CreateOpts) (*configs.Config, error) {
 		}
 	}
 	createHooks(spec, config)
+	if err := createAnnotationHooks(spec, config); err != nil {
+		return nil, err
+	}
+	if err := createAnnotationNetwork(spec, config); err != nil {
+		return nil, err
+	}
+	if err := createRootfsIDMapping(spec, config); err != nil {
+		return nil, err
+	}
+	if err := runExtensions(opts, config); err != nil {
+		return nil, err
+	}
 	config.Version = specs.Version
 	return config, nil
 }
 
+// splitL2CacheSchema splits the L2 cache schema lines (i.e. "L2:", "L2CODE:"
+// and "L2DATA:") from the l3CacheSchema of the runtime spec.
+func splitL2CacheSchema(schema string) (l3, l2 string) {
+	var l3Lines, l2Lines []string
+	for _, line := range strings.Split(schema, "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "":
+		case strings.HasPrefix(line, "L2"):
+			l2Lines = append(l2Lines, line)
+		default:
+			l3Lines = append(l3Lines, line)
+		}
+	}
+	return strings.Join(l3Lines, "\n"), strings.Join(l2Lines, "\n")
+}
+
 func createLibcontainerMount(cwd string, m specs.Mount) (*configs.Mount, error) {
 	if !filepath.IsAbs(m.Destination) {
 		return nil, fmt.Errorf("mount destination %s not absolute", m.Destination)
 	}
-	flags, pgflags, data, ext := parseMountOptions(m.Options)
+	options, idmap, err := parseIDMapOption(m.Options)
+	if err != nil {
+		return nil, fmt.Errorf("mount %s: %w", m.Destination, err)
+	}
+	flags, pgflags, data, ext, recAttr := parseMountOptions(options)
 	source := m.Source
 	device := m.Type
 	if flags&unix.MS_BIND != 0 {
@@ -355,9 +506,75 @@ func createLibcontainerMount(cwd string, m specs.Mount) (*configs.Mount, error)
 		Flags:            flags,
 		PropagationFlags: pgflags,
 		Extensions:       ext,
+		IDMapping:        idmap,
+		RecAttr:          recAttr,
 	}, nil
 }
 
+// parseIDMapOption extracts the "idmap" mount option from options. The
+// option can be either "idmap", to use the mappings of the container's user
+// namespace, or "idmap=uids=<mappings>;gids=<mappings>", where <mappings>
+// are "#"-separated "<containerID>-<hostID>-<size>" triplets.
+func parseIDMapOption(options []string) ([]string, *configs.MountIDMapping, error) {
+	var (
+		rest  = make([]string, 0, len(options))
+		idmap *configs.MountIDMapping
+	)
+	for _, o := range options {
+		if o != "idmap" && !strings.HasPrefix(o, "idmap=") {
+			rest = append(rest, o)
+			continue
+		}
+		idmap = &configs.MountIDMapping{}
+		if o == "idmap" {
+			continue
+		}
+		for _, kv := range strings.Split(strings.TrimPrefix(o, "idmap="), ";") {
+			parts := strings.SplitN(kv, "=", 2)
+			if len(parts) != 2 {
+				return nil, nil, fmt.Errorf("invalid idmap option %q", o)
+			}
+			maps, err := parseIDMappings(parts[1])
+			if err != nil {
+				return nil, nil, fmt.Errorf("invalid idmap option %q: %w", o, err)
+			}
+			switch parts[0] {
+			case "uids":
+				idmap.UIDMappings = maps
+			case "gids":
+				idmap.GIDMappings = maps
+			default:
+				return nil, nil, fmt.Errorf("invalid idmap option %q: unknown key %q", o, parts[0])
+			}
+		}
+	}
+	return rest, idmap, nil
+}
+
+func parseIDMappings(s string) ([]configs.IDMap, error) {
+	var maps []configs.IDMap
+	for _, m := range strings.Split(s, "#") {
+		parts := strings.Split(m, "-")
+		if len(parts) != 3 {
+			return nil, fmt.Errorf("invalid mapping %q", m)
+		}
+		var ids [3]int
+		for i, p := range parts {
+			v, err := strconv.Atoi(p)
+			if err != nil || v < 0 {
+				return nil, fmt.Errorf("invalid mapping %q", m)
+			}
+			ids[i] = v
+		}
+		maps = append(maps, configs.IDMap{
+			ContainerID: ids[0],
+			HostID:      ids[1],
+			Size:        ids[2],
+		})
+	}
+	return maps, nil
+}
+
 // systemd property name check: latin letters only, at least 3 of them
 var isValidName = regexp.MustCompile(`^[a-zA-Z]{3,}$`).MatchString
 
@@ -393,12 +610,16 @@ func convertSecToUSec(value dbus.Variant) (dbus.Variant, error) {
 	return dbus.MakeVariant(sec), nil
 }
 
+// SystemdPropertyAnnotationPrefix is the prefix of the annotations setting
+// the properties of the systemd unit of the container, such as
+// "org.systemd.property.TimeoutStopUSec".
+const SystemdPropertyAnnotationPrefix = "org.systemd.property."
+
 func initSystemdProps(spec *specs.Spec) ([]systemdDbus.Property, error) {
-	const keyPrefix = "org.systemd.property."
 	var sp []systemdDbus.Property
 
 	for k, v := range spec.Annotations {
-		name := strings.TrimPrefix(k, keyPrefix)
+		name := strings.TrimPrefix(k, SystemdPropertyAnnotationPrefix)
 		if len(name) == len(k) { // prefix not there
 			continue
 		}
@@ -432,9 +653,20 @@ func CreateCgroupConfig(opts *CreateOpts, defaultDevs []*devices.Device) (*confi
 	)
 
 	c := &configs.Cgroup{
+		Systemd:   useSystemdCgroup,
 		Resources: &configs.Resources{},
 	}
 
+	if opts.PinDeviceFilter {
+		c.DeviceFilterPinPath = deviceFilterPinPath(opts.StateRoot, name)
+	}
+	c.DeviceFilterMap = opts.DeviceFilterMap
+	c.DeviceFilterFailClosed = opts.DeviceFilterFailClosed
+	c.AuditDevices = opts.AuditDevices
+
+	if useSystemdCgroup && opts.CgroupRoot != "" {
+		return nil, errors.New("the cgroup root can't be set with the systemd cgroup driver")
+	}
 	if useSystemdCgroup {
 		sp, err := initSystemdProps(spec)
 		if err != nil {
@@ -442,6 +674,12 @@ func CreateCgroupConfig(opts *CreateOpts, defaultDevs []*devices.Device) (*confi
 		}
 		c.SystemdProps = sp
 	}
+	if err := createManagedOOM(spec, c.Resources); err != nil {
+		return nil, err
+	}
+	if err := createAllowedAddressFamilies(spec, c.Resources); err != nil {
+		return nil, err
+	}
 
 	if spec.Linux != nil && spec.Linux.CgroupsPath != "" {
 		if useSystemdCgroup {
@@ -472,6 +710,12 @@ func CreateCgroupConfig(opts *CreateOpts, defaultDevs []*devices.Device) (*confi
 			c.Name = name
 		}
 		c.Path = myCgroupPath
+		if opts.CgroupRoot != "" && !filepath.IsAbs(myCgroupPath) {
+			// Make the path absolute, i.e. not relative to the cgroup of
+			// runc, which can't be resolved in some nested containers.
+			c.Path = filepath.Join(libcontainerUtils.CleanPath("/"+opts.CgroupRoot), myCgroupPath, c.Name)
+			c.Name = ""
+		}
 	}
 
 	// In rootless containers, any attempt to make cgroup changes is likely to fail.
@@ -479,36 +723,11 @@ func CreateCgroupConfig(opts *CreateOpts, defaultDevs []*devices.Device) (*confi
 	if spec.Linux != nil {
 		r := spec.Linux.Resources
 		if r != nil {
-			for i, d := range spec.Linux.Resources.Devices {
-				var (
-					t     = "a"
-					major = int64(-1)
-					minor = int64(-1)
-				)
-				if d.Type != "" {
-					t = d.Type
-				}
-				if d.Major != nil {
-					major = *d.Major
-				}
-				if d.Minor != nil {
-					minor = *d.Minor
-				}
-				if d.Access == "" {
-					return nil, fmt.Errorf("device access at %d field cannot be empty", i)
-				}
-				dt, err := stringToCgroupDeviceRune(t)
-				if err != nil {
-					return nil, err
-				}
-				c.Resources.Devices = append(c.Resources.Devices, &devices.Rule{
-					Type:        dt,
-					Major:       major,
-					Minor:       minor,
-					Permissions: devices.Permissions(d.Access),
-					Allow:       d.Allow,
-				})
+			rules, err := CreateDeviceRules(r.Devices)
+			if err != nil {
+				return nil, err
 			}
+			c.Resources.Devices = append(c.Resources.Devices, rules...)
 			if r.Memory != nil {
 				if r.Memory.Limit != nil {
 					c.Resources.Memory = *r.Memory.Limit
@@ -613,6 +832,15 @@ func CreateCgroupConfig(opts *CreateOpts, defaultDevs []*devices.Device) (*confi
 					Limit:    l.Limit,
 				})
 			}
+			if len(r.Rdma) > 0 {
+				c.Resources.Rdma = make(map[string]configs.LinuxRdma, len(r.Rdma))
+				for k, v := range r.Rdma {
+					c.Resources.Rdma[k] = configs.LinuxRdma{
+						HcaHandles: v.HcaHandles,
+						HcaObjects: v.HcaObjects,
+					}
+				}
+			}
 			if r.Network != nil {
 				if r.Network.ClassID != nil {
 					c.Resources.NetClsClassid = *r.Network.ClassID
@@ -630,6 +858,16 @@ func CreateCgroupConfig(opts *CreateOpts, defaultDevs []*devices.Device) (*confi
 				for k, v := range r.Unified {
 					c.Resources.Unified[k] = v
 				}
+				// memory.oom.group has a typed field, so that it can be
+				// changed with runc update.
+				if v, ok := c.Resources.Unified["memory.oom.group"]; ok {
+					group, err := strconv.ParseBool(strings.TrimSpace(v))
+					if err != nil {
+						return nil, fmt.Errorf("invalid unified resource memory.oom.group value %q", v)
+					}
+					c.Resources.MemoryOOMGroup = &group
+					delete(c.Resources.Unified, "memory.oom.group")
+				}
 			}
 		}
 	}
@@ -641,6 +879,67 @@ func CreateCgroupConfig(opts *CreateOpts, defaultDevs []*devices.Device) (*confi
 	return c, nil
 }
 
+// CreateDeviceRules converts the device cgroup rules of the runtime spec.
+func CreateDeviceRules(devs []specs.LinuxDeviceCgroup) ([]*devices.Rule, error) {
+	rules := make([]*devices.Rule, 0, len(devs))
+	for i, d := range devs {
+		var (
+			t     = "a"
+			major = int64(-1)
+			minor = int64(-1)
+		)
+		if d.Type != "" {
+			t = d.Type
+		}
+		if d.Major != nil {
+			major = *d.Major
+		}
+		if d.Minor != nil {
+			minor = *d.Minor
+		}
+		if d.Access == "" {
+			return nil, fmt.Errorf("device access at %d field cannot be empty", i)
+		}
+		dt, err := stringToCgroupDeviceRune(t)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, &devices.Rule{
+			Type:        dt,
+			Major:       major,
+			Minor:       minor,
+			Permissions: devices.Permissions(d.Access),
+			Allow:       d.Allow,
+		})
+	}
+	return rules, nil
+}
+
+// DefaultDeviceRules returns the rules of the default allowed devices which
+// were appended to the device rules of the container config when it was
+// created (see CreateCgroupConfig). These have to be kept when the device
+// rules of a running container are replaced.
+func DefaultDeviceRules(config *configs.Config) []*devices.Rule {
+	var rules []*devices.Rule
+next:
+	for _, ad := range AllowedDevices {
+		if ad.Path != "" {
+			// The default device is only used if it was not
+			// overridden by a spec device with the same path,
+			// which has no permissions and is not allowed by
+			// itself (see createDevices).
+			for _, d := range config.Devices {
+				if d.Path == ad.Path && (d.Allow != ad.Allow || d.Permissions != ad.Permissions) {
+					continue next
+				}
+			}
+		}
+		rule := ad.Rule
+		rules = append(rules, &rule)
+	}
+	return rules
+}
+
 func stringToCgroupDeviceRune(s string) (devices.Type, error) {
 	switch s {
 	case "a":
@@ -724,6 +1023,21 @@ next:
 	return dedupedAllowDevs, nil
 }
 
+func createPersonality(p *specs.LinuxPersonality) (*configs.LinuxPersonality, error) {
+	// No personality flags are defined by the runtime spec.
+	if len(p.Flags) > 0 {
+		logrus.Warnf("ignoring unsupported personality flags %v", p.Flags)
+	}
+	switch p.Domain {
+	case specs.PerLinux:
+		return &configs.LinuxPersonality{Domain: configs.PerLinux}, nil
+	case specs.PerLinux32:
+		return &configs.LinuxPersonality{Domain: configs.PerLinux32}, nil
+	default:
+		return nil, fmt.Errorf("invalid personality domain %q", p.Domain)
+	}
+}
+
 func setupUserNamespace(spec *specs.Spec, config *configs.Config) error {
 	create := func(m specs.LinuxIDMapping) configs.IDMap {
 		return configs.IDMap{
@@ -756,9 +1070,11 @@ func setupUserNamespace(spec *specs.Spec, config *configs.Config) error {
 }
 
 // parseMountOptions parses the string and returns the flags, propagation
-// flags and any mount data that it contains.
-func parseMountOptions(options []string) (int, []int, string, int) {
+// flags, any mount data, extension flags and recursive mount attributes
+// that it contains.
+func parseMountOptions(options []string) (int, []int, string, int, *configs.MountRecAttr) {
 	var (
+		recAttr  *configs.MountRecAttr
 		flag     int
 		pgflag   []int
 		data     []string
@@ -818,6 +1134,19 @@ func parseMountOptions(options []string) (int, []int, string, int) {
 	}{
 		"tmpcopyup": {false, configs.EXT_COPYUP},
 	}
+	recAttrFlags := map[string]struct {
+		clear bool
+		flag  uint64
+	}{
+		"rro":     {false, system.MOUNT_ATTR_RDONLY},
+		"rrw":     {true, system.MOUNT_ATTR_RDONLY},
+		"rnosuid": {false, system.MOUNT_ATTR_NOSUID},
+		"rsuid":   {true, system.MOUNT_ATTR_NOSUID},
+		"rnodev":  {false, system.MOUNT_ATTR_NODEV},
+		"rdev":    {true, system.MOUNT_ATTR_NODEV},
+		"rnoexec": {false, system.MOUNT_ATTR_NOEXEC},
+		"rexec":   {true, system.MOUNT_ATTR_NOEXEC},
+	}
 	for _, o := range options {
 		// If the option does not exist in the flags table or the flag
 		// is not supported on the platform,
@@ -836,11 +1165,22 @@ func parseMountOptions(options []string) (int, []int, string, int) {
 			} else {
 				extFlags |= f.flag
 			}
+		} else if f, exists := recAttrFlags[o]; exists {
+			if recAttr == nil {
+				recAttr = &configs.MountRecAttr{}
+			}
+			if f.clear {
+				recAttr.AttrSet &= ^f.flag
+				recAttr.AttrClr |= f.flag
+			} else {
+				recAttr.AttrSet |= f.flag
+				recAttr.AttrClr &= ^f.flag
+			}
 		} else {
 			data = append(data, o)
 		}
 	}
-	return flag, pgflag, strings.Join(data, ","), extFlags
+	return flag, pgflag, strings.Join(data, ","), extFlags, recAttr
 }
 
 func SetupSeccomp(config *specs.LinuxSeccomp) (*configs.Seccomp, error) {
@@ -879,6 +1219,8 @@ func SetupSeccomp(config *specs.LinuxSeccomp) (*configs.Seccomp, error) {
 	}
 	newConfig.DefaultAction = newDefaultAction
 	newConfig.DefaultErrnoRet = config.DefaultErrnoRet
+	newConfig.ListenerPath = config.ListenerPath
+	newConfig.ListenerMetadata = config.ListenerMetadata
 
 	// Loop through all syscall blocks and convert them to libcontainer format
 	for _, call := range config.Syscalls {
@@ -947,6 +1289,37 @@ func createHooks(rspec *specs.Spec, config *configs.Config) {
 	}
 }
 
+// Annotations of the spec to set the non-standard postCheckpoint and
+// preRestore hooks, as a JSON array of hooks in the format of the spec.
+const (
+	PostCheckpointHooksAnnotation = "org.opencontainers.runc.hooks.postCheckpoint"
+	PreRestoreHooksAnnotation     = "org.opencontainers.runc.hooks.preRestore"
+)
+
+func createAnnotationHooks(rspec *specs.Spec, config *configs.Config) error {
+	for _, a := range []struct {
+		annotation string
+		name       configs.HookName
+	}{
+		{PostCheckpointHooksAnnotation, configs.PostCheckpoint},
+		{PreRestoreHooksAnnotation, configs.PreRestore},
+	} {
+		value, ok := rspec.Annotations[a.annotation]
+		if !ok {
+			continue
+		}
+		var hooks []specs.Hook
+		if err := json.Unmarshal([]byte(value), &hooks); err != nil {
+			return fmt.Errorf("invalid %s annotation: %w", a.annotation, err)
+		}
+		for _, h := range hooks {
+			cmd := createCommandHook(h)
+			config.Hooks[a.name] = append(config.Hooks[a.name], configs.NewCommandHook(cmd))
+		}
+	}
+	return nil
+}
+
 func createCommandHook(h specs.Hook) configs.Command {
 	cmd := configs.Command{
 		Path: h.Path,
@@ -959,3 +1332,166 @@ func createCommandHook(h specs.Hook) configs.Command {
 	}
 	return cmd
 }
+
+func createAnnotationNetwork(rspec *specs.Spec, config *configs.Config) error {
+	var forwards []configs.PortForward
+	if value, ok := rspec.Annotations[NetworkPortsAnnotation]; ok {
+		var ports []string
+		if err := json.Unmarshal([]byte(value), &ports); err != nil {
+			return fmt.Errorf("invalid %s annotation: %w", NetworkPortsAnnotation, err)
+		}
+		for _, p := range ports {
+			pf, err := ParsePortForward(p)
+			if err != nil {
+				return fmt.Errorf("invalid %s annotation: %w", NetworkPortsAnnotation, err)
+			}
+			forwards = append(forwards, pf)
+		}
+	}
+	helper, ok := rspec.Annotations[NetworkHelperAnnotation]
+	if !ok {
+		config.PortForwards = forwards
+		return nil
+	}
+	if helper != "pasta" && helper != "slirp4netns" {
+		return fmt.Errorf("invalid %s annotation %q: must be either pasta or slirp4netns", NetworkHelperAnnotation, helper)
+	}
+	if !config.Namespaces.Contains(configs.NEWNET) || config.Namespaces.PathOf(configs.NEWNET) != "" {
+		return fmt.Errorf("%s annotation requires a new network namespace", NetworkHelperAnnotation)
+	}
+	config.Networks = append(config.Networks, &configs.Network{
+		Type:         helper,
+		PortForwards: forwards,
+	})
+	return nil
+}
+
+// RootfsIDMapAnnotation is the annotation of the spec making the root
+// filesystem of the container an idmapped mount. Its value is either empty, to
+// use the mappings of the container's user namespace, or the mappings in the
+// format of the "idmap" mount option, "uids=<mappings>;gids=<mappings>".
+const RootfsIDMapAnnotation = "org.opencontainers.runc.rootfs.idmap"
+
+func createRootfsIDMapping(rspec *specs.Spec, config *configs.Config) error {
+	value, ok := rspec.Annotations[RootfsIDMapAnnotation]
+	if !ok {
+		return nil
+	}
+	option := "idmap"
+	if value != "" {
+		option += "=" + value
+	}
+	_, idmap, err := parseIDMapOption([]string{option})
+	if err != nil {
+		return fmt.Errorf("invalid %s annotation: %w", RootfsIDMapAnnotation, err)
+	}
+	config.RootfsIDMapping = idmap
+	return nil
+}
+
+// Annotations of the spec to configure systemd-oomd for the container, with
+// the systemd cgroup driver: the action on memory pressure ("auto" or "kill"),
+// and the memory pressure limit as a percentage, such as "60%".
+const (
+	ManagedOOMMemoryPressureAnnotation      = "org.opencontainers.runc.systemd.managedOOMMemoryPressure"
+	ManagedOOMMemoryPressureLimitAnnotation = "org.opencontainers.runc.systemd.managedOOMMemoryPressureLimit"
+)
+
+func createManagedOOM(rspec *specs.Spec, r *configs.Resources) error {
+	if value, ok := rspec.Annotations[ManagedOOMMemoryPressureAnnotation]; ok {
+		r.ManagedOOMMemoryPressure = value
+	}
+	if value, ok := rspec.Annotations[ManagedOOMMemoryPressureLimitAnnotation]; ok {
+		limit, err := cgroups.ParsePermyriad(value)
+		if err != nil {
+			return fmt.Errorf("invalid %s annotation: %w", ManagedOOMMemoryPressureLimitAnnotation, err)
+		}
+		r.ManagedOOMMemoryPressureLimit = &limit
+	}
+	return nil
+}
+
+// AllowedAddressFamiliesAnnotation is the annotation of the spec restricting
+// the address families of the sockets the container can create, as a comma
+// separated list of names (such as "AF_UNIX,AF_INET,AF_INET6") or numbers.
+const AllowedAddressFamiliesAnnotation = "org.opencontainers.runc.allowedAddressFamilies"
+
+// addressFamilies are the names of the address families accepted by
+// AllowedAddressFamiliesAnnotation.
+var addressFamilies = map[string]int{
+	"AF_UNIX":      unix.AF_UNIX,
+	"AF_INET":      unix.AF_INET,
+	"AF_INET6":     unix.AF_INET6,
+	"AF_NETLINK":   unix.AF_NETLINK,
+	"AF_PACKET":    unix.AF_PACKET,
+	"AF_BLUETOOTH": unix.AF_BLUETOOTH,
+	"AF_CAN":       unix.AF_CAN,
+	"AF_ALG":       unix.AF_ALG,
+	"AF_VSOCK":     unix.AF_VSOCK,
+	"AF_XDP":       unix.AF_XDP,
+}
+
+func createAllowedAddressFamilies(rspec *specs.Spec, r *configs.Resources) error {
+	value, ok := rspec.Annotations[AllowedAddressFamiliesAnnotation]
+	if !ok {
+		return nil
+	}
+	// An empty value allows no family at all.
+	r.AllowedAddressFamilies = []int{}
+	for _, name := range strings.Split(value, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		family, ok := addressFamilies[strings.ToUpper(name)]
+		if !ok {
+			var err error
+			if family, err = strconv.Atoi(name); err != nil {
+				return fmt.Errorf("invalid %s annotation: unknown address family %q", AllowedAddressFamiliesAnnotation, name)
+			}
+		}
+		r.AllowedAddressFamilies = append(r.AllowedAddressFamilies, family)
+	}
+	return nil
+}
+
+// ParsePortForward parses a port forward in the format
+// "[HOST_IP:]HOST_PORT:CONTAINER_PORT[/PROTOCOL]", where an IPv6 host address
+// is enclosed in brackets, and the protocol defaults to tcp.
+func ParsePortForward(s string) (configs.PortForward, error) {
+	pf := configs.PortForward{Protocol: "tcp"}
+	ports := s
+	if i := strings.LastIndexByte(ports, '/'); i != -1 {
+		pf.Protocol = ports[i+1:]
+		ports = ports[:i]
+	}
+	if pf.Protocol != "tcp" && pf.Protocol != "udp" {
+		return pf, fmt.Errorf("invalid protocol %q in port forward %q", pf.Protocol, s)
+	}
+	i := strings.LastIndexByte(ports, ':')
+	if i == -1 {
+		return pf, fmt.Errorf("invalid port forward %q", s)
+	}
+	hostPort, containerPort := ports[:i], ports[i+1:]
+	if j := strings.LastIndexByte(hostPort, ':'); j != -1 {
+		pf.HostIP = strings.TrimSuffix(strings.TrimPrefix(hostPort[:j], "["), "]")
+		hostPort = hostPort[j+1:]
+		if net.ParseIP(pf.HostIP) == nil {
+			return pf, fmt.Errorf("invalid host address %q in port forward %q", pf.HostIP, s)
+		}
+	}
+	for _, p := range []struct {
+		value string
+		port  *uint16
+	}{
+		{hostPort, &pf.HostPort},
+		{containerPort, &pf.ContainerPort},
+	} {
+		port, err := strconv.ParseUint(p.value, 10, 16)
+		if err != nil || port == 0 {
+			return pf, fmt.Errorf("invalid port %q in port forward %q", p.value, s)
+		}
+		*p.port = uint16(port)
+	}
+	return pf, nil
+}
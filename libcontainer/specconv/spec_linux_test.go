@@ -3,14 +3,21 @@
 package specconv
 
 import (
+	"encoding/json"
+	"errors"
 	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
 	"strings"
 	"testing"
+	"time"
 
 	dbus "github.com/godbus/dbus/v5"
 	"github.com/opencontainers/runc/libcontainer/configs"
 	"github.com/opencontainers/runc/libcontainer/configs/validate"
 	"github.com/opencontainers/runc/libcontainer/devices"
+	"github.com/opencontainers/runc/libcontainer/system"
 	"github.com/opencontainers/runtime-spec/specs-go"
 	"golang.org/x/sys/unix"
 )
@@ -217,6 +224,37 @@ func TestSetupSeccomp(t *testing.T) {
 
 }
 
+func TestSetupSeccompNotify(t *testing.T) {
+	conf := &specs.LinuxSeccomp{
+		DefaultAction:    "SCMP_ACT_ALLOW",
+		ListenerPath:     "/run/seccomp-agent.sock",
+		ListenerMetadata: "foo",
+		Syscalls: []specs.LinuxSyscall{
+			{
+				Names:  []string{"mount"},
+				Action: "SCMP_ACT_NOTIFY",
+			},
+		},
+	}
+	seccomp, err := SetupSeccomp(conf)
+	if err != nil {
+		t.Fatalf("Couldn't create Seccomp config: %v", err)
+	}
+
+	if seccomp.ListenerPath != conf.ListenerPath {
+		t.Errorf("Expected listener path %q, got %q", conf.ListenerPath, seccomp.ListenerPath)
+	}
+	if seccomp.ListenerMetadata != conf.ListenerMetadata {
+		t.Errorf("Expected listener metadata %q, got %q", conf.ListenerMetadata, seccomp.ListenerMetadata)
+	}
+	if seccomp.Syscalls[0].Action != configs.Notify {
+		t.Error("Wrong conversion for the mount syscall action")
+	}
+	if !seccomp.IsNotifyUsed() {
+		t.Error("Expected IsNotifyUsed to be true")
+	}
+}
+
 func TestLinuxCgroupWithMemoryResource(t *testing.T) {
 	cgroupsPath := "/user/cgroups/path/id"
 
@@ -354,6 +392,78 @@ func TestLinuxCgroupSystemdWithEmptyPath(t *testing.T) {
 	}
 }
 
+func TestLinuxCgroupPinDeviceFilter(t *testing.T) {
+	spec := &specs.Spec{}
+	spec.Linux = &specs.Linux{}
+
+	opts := &CreateOpts{
+		CgroupName: "ContainerID",
+		Spec:       spec,
+	}
+
+	cgroup, err := CreateCgroupConfig(opts, nil)
+	if err != nil {
+		t.Fatalf("Couldn't create Cgroup config: %v", err)
+	}
+	if cgroup.DeviceFilterPinPath != "" {
+		t.Errorf("Expected no DeviceFilterPinPath, got %s", cgroup.DeviceFilterPinPath)
+	}
+
+	opts.PinDeviceFilter = true
+	cgroup, err = CreateCgroupConfig(opts, nil)
+	if err != nil {
+		t.Fatalf("Couldn't create Cgroup config: %v", err)
+	}
+	expected := "/sys/fs/bpf/runc/ContainerID"
+	if cgroup.DeviceFilterPinPath != expected {
+		t.Errorf("Expected to have %s as DeviceFilterPinPath instead of %s", expected, cgroup.DeviceFilterPinPath)
+	}
+
+	// The pin path depends on the state root.
+	opts.StateRoot = "/run/runc"
+	cgroup, err = CreateCgroupConfig(opts, nil)
+	if err != nil {
+		t.Fatalf("Couldn't create Cgroup config: %v", err)
+	}
+	pinPath := cgroup.DeviceFilterPinPath
+	if filepath.Dir(filepath.Dir(pinPath)) != "/sys/fs/bpf/runc" || filepath.Base(pinPath) != "ContainerID" {
+		t.Errorf("Expected DeviceFilterPinPath to be /sys/fs/bpf/runc/<hash>/ContainerID, got %s", pinPath)
+	}
+	opts.StateRoot = "/run/user/1000/runc"
+	cgroup, err = CreateCgroupConfig(opts, nil)
+	if err != nil {
+		t.Fatalf("Couldn't create Cgroup config: %v", err)
+	}
+	if cgroup.DeviceFilterPinPath == pinPath {
+		t.Errorf("Expected another DeviceFilterPinPath than %s for another state root", pinPath)
+	}
+	opts.StateRoot = ""
+	if cgroup.DeviceFilterMap {
+		t.Error("Expected DeviceFilterMap to be disabled")
+	}
+
+	opts.DeviceFilterMap = true
+	cgroup, err = CreateCgroupConfig(opts, nil)
+	if err != nil {
+		t.Fatalf("Couldn't create Cgroup config: %v", err)
+	}
+	if !cgroup.DeviceFilterMap {
+		t.Error("Expected DeviceFilterMap to be enabled")
+	}
+	if cgroup.DeviceFilterFailClosed {
+		t.Error("Expected DeviceFilterFailClosed to be disabled")
+	}
+
+	opts.DeviceFilterFailClosed = true
+	cgroup, err = CreateCgroupConfig(opts, nil)
+	if err != nil {
+		t.Fatalf("Couldn't create Cgroup config: %v", err)
+	}
+	if !cgroup.DeviceFilterFailClosed {
+		t.Error("Expected DeviceFilterFailClosed to be enabled")
+	}
+}
+
 func TestLinuxCgroupSystemdWithInvalidPath(t *testing.T) {
 	cgroupsPath := "/user/cgroups/path/id"
 
@@ -415,6 +525,146 @@ func TestLinuxCgroupsPathNotSpecified(t *testing.T) {
 	}
 }
 
+func TestLinuxCgroupsPathWithCgroupRoot(t *testing.T) {
+	for _, tc := range []struct {
+		cgroupsPath string
+		expected    string
+	}{
+		{cgroupsPath: "", expected: "/ci/runner/ContainerID"},
+		{cgroupsPath: "user/id", expected: "/ci/runner/user/id"},
+		// Absolute paths are not relative to the cgroup root.
+		{cgroupsPath: "/user/id", expected: "/user/id"},
+	} {
+		spec := &specs.Spec{}
+		spec.Linux = &specs.Linux{
+			CgroupsPath: tc.cgroupsPath,
+		}
+		opts := &CreateOpts{
+			CgroupName: "ContainerID",
+			CgroupRoot: "ci/runner",
+			Spec:       spec,
+		}
+
+		cgroup, err := CreateCgroupConfig(opts, nil)
+		if err != nil {
+			t.Fatalf("Couldn't create Cgroup config: %v", err)
+		}
+		if cgroup.Path != tc.expected || cgroup.Name != "" {
+			t.Errorf("cgroupsPath %q: expected path %q, got path %q and name %q", tc.cgroupsPath, tc.expected, cgroup.Path, cgroup.Name)
+		}
+	}
+
+	opts := &CreateOpts{
+		CgroupName:       "ContainerID",
+		CgroupRoot:       "/ci/runner",
+		UseSystemdCgroup: true,
+		Spec:             &specs.Spec{},
+	}
+	if _, err := CreateCgroupConfig(opts, nil); err == nil {
+		t.Error("Expected an error with a cgroup root and the systemd cgroup driver")
+	}
+}
+
+func TestLinuxCgroupsUnifiedOOMGroup(t *testing.T) {
+	spec := &specs.Spec{}
+	spec.Linux = &specs.Linux{
+		Resources: &specs.LinuxResources{
+			Unified: map[string]string{
+				"memory.oom.group": "1\n",
+				"memory.high":      "max",
+			},
+		},
+	}
+	opts := &CreateOpts{
+		CgroupName: "ContainerID",
+		Spec:       spec,
+	}
+
+	cgroup, err := CreateCgroupConfig(opts, nil)
+	if err != nil {
+		t.Fatalf("Couldn't create Cgroup config: %v", err)
+	}
+	if g := cgroup.Resources.MemoryOOMGroup; g == nil || !*g {
+		t.Errorf("expected the memory OOM group to be set, got %v", g)
+	}
+	if _, ok := cgroup.Resources.Unified["memory.oom.group"]; ok {
+		t.Error("expected memory.oom.group to be removed from the unified resources")
+	}
+	if cgroup.Resources.Unified["memory.high"] != "max" {
+		t.Errorf("expected the other unified resources to be kept, got %v", cgroup.Resources.Unified)
+	}
+
+	spec.Linux.Resources.Unified["memory.oom.group"] = "yes"
+	if _, err := CreateCgroupConfig(opts, nil); err == nil {
+		t.Error("Expected an error with an invalid memory.oom.group value")
+	}
+}
+
+func TestLinuxCgroupsManagedOOM(t *testing.T) {
+	spec := &specs.Spec{
+		Annotations: map[string]string{
+			ManagedOOMMemoryPressureAnnotation:      "kill",
+			ManagedOOMMemoryPressureLimitAnnotation: "60.5%",
+		},
+	}
+	opts := &CreateOpts{
+		CgroupName:       "ContainerID",
+		UseSystemdCgroup: true,
+		Spec:             spec,
+	}
+
+	cgroup, err := CreateCgroupConfig(opts, nil)
+	if err != nil {
+		t.Fatalf("Couldn't create Cgroup config: %v", err)
+	}
+	if p := cgroup.Resources.ManagedOOMMemoryPressure; p != "kill" {
+		t.Errorf("expected the managed OOM memory pressure to be kill, got %q", p)
+	}
+	if l := cgroup.Resources.ManagedOOMMemoryPressureLimit; l == nil || *l != 6050 {
+		t.Errorf("expected the managed OOM memory pressure limit to be 6050, got %v", l)
+	}
+
+	spec.Annotations[ManagedOOMMemoryPressureLimitAnnotation] = "0.6"
+	if _, err := CreateCgroupConfig(opts, nil); err == nil {
+		t.Error("Expected an error with an invalid managed OOM memory pressure limit")
+	}
+}
+
+func TestLinuxCgroupsAllowedAddressFamilies(t *testing.T) {
+	spec := &specs.Spec{
+		Annotations: map[string]string{
+			AllowedAddressFamiliesAnnotation: "AF_UNIX, af_inet,10",
+		},
+	}
+	opts := &CreateOpts{
+		CgroupName: "ContainerID",
+		Spec:       spec,
+	}
+
+	cgroup, err := CreateCgroupConfig(opts, nil)
+	if err != nil {
+		t.Fatalf("Couldn't create Cgroup config: %v", err)
+	}
+	expected := []int{unix.AF_UNIX, unix.AF_INET, unix.AF_INET6}
+	if !reflect.DeepEqual(cgroup.Resources.AllowedAddressFamilies, expected) {
+		t.Errorf("expected the allowed address families to be %v, got %v", expected, cgroup.Resources.AllowedAddressFamilies)
+	}
+
+	spec.Annotations[AllowedAddressFamiliesAnnotation] = ""
+	cgroup, err = CreateCgroupConfig(opts, nil)
+	if err != nil {
+		t.Fatalf("Couldn't create Cgroup config: %v", err)
+	}
+	if f := cgroup.Resources.AllowedAddressFamilies; f == nil || len(f) != 0 {
+		t.Errorf("expected no address family to be allowed, got %v", f)
+	}
+
+	spec.Annotations[AllowedAddressFamiliesAnnotation] = "AF_INET,AF_FOO"
+	if _, err := CreateCgroupConfig(opts, nil); err == nil {
+		t.Error("Expected an error with an unknown address family")
+	}
+}
+
 func TestSpecconvExampleValidate(t *testing.T) {
 	spec := Example()
 	spec.Root.Path = "/"
@@ -441,6 +691,42 @@ func TestSpecconvExampleValidate(t *testing.T) {
 	}
 }
 
+func TestCreatePersonality(t *testing.T) {
+	testCases := []struct {
+		domain   specs.LinuxPersonalityDomain
+		expected int
+		isErr    bool
+	}{
+		{domain: specs.PerLinux, expected: configs.PerLinux},
+		{domain: specs.PerLinux32, expected: configs.PerLinux32},
+		{domain: "LINUX64", isErr: true},
+	}
+
+	for _, tc := range testCases {
+		spec := Example()
+		spec.Root.Path = "/"
+		spec.Linux.Personality = &specs.LinuxPersonality{Domain: tc.domain}
+
+		config, err := CreateLibcontainerConfig(&CreateOpts{
+			CgroupName: "ContainerID",
+			Spec:       spec,
+		})
+		if tc.isErr {
+			if err == nil {
+				t.Errorf("%s: expected error, got nil", tc.domain)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: couldn't create libcontainer config: %v", tc.domain, err)
+			continue
+		}
+		if config.Personality == nil || config.Personality.Domain != tc.expected {
+			t.Errorf("%s: expected personality domain %#x, got %+v", tc.domain, tc.expected, config.Personality)
+		}
+	}
+}
+
 func TestDupNamespaces(t *testing.T) {
 	spec := &specs.Spec{
 		Root: &specs.Root{
@@ -496,6 +782,41 @@ func TestNonZeroEUIDCompatibleSpecconvValidate(t *testing.T) {
 	}
 }
 
+func TestTemplatesSpecconvValidate(t *testing.T) {
+	spec := Example()
+	spec.Root.Path = "/"
+	ToSystemdCgroup(spec)
+	ToNetworkHelper(spec, "pasta")
+	spec.Linux.Seccomp = MinimalSeccomp()
+
+	config, err := CreateLibcontainerConfig(&CreateOpts{
+		CgroupName:       "ContainerID",
+		UseSystemdCgroup: true,
+		Spec:             spec,
+	})
+	if err != nil {
+		t.Fatalf("Couldn't create libcontainer config: %v", err)
+	}
+	if len(config.Cgroups.SystemdProps) != 1 || config.Cgroups.SystemdProps[0].Name != "CollectMode" {
+		t.Errorf("Expected the CollectMode systemd property, got %+v", config.Cgroups.SystemdProps)
+	}
+	if n := config.Networks; len(n) == 0 || n[len(n)-1].Type != "pasta" {
+		t.Errorf("Expected a pasta network, got %+v", n)
+	}
+	if config.Seccomp == nil || config.Seccomp.DefaultAction != configs.Allow || len(config.Seccomp.Syscalls) == 0 {
+		t.Errorf("Expected the minimal seccomp profile, got %+v", config.Seccomp)
+	}
+	for _, call := range config.Seccomp.Syscalls {
+		if call.Action != configs.Errno {
+			t.Errorf("Expected syscall %s to be blocked, got action %d", call.Name, call.Action)
+		}
+	}
+
+	if err := validate.New().Validate(config); err != nil {
+		t.Errorf("Expected specconv to produce valid container config: %v", err)
+	}
+}
+
 func TestInitSystemdProps(t *testing.T) {
 	type inT struct {
 		name, value string
@@ -746,3 +1067,416 @@ func TestCreateDevices(t *testing.T) {
 		t.Errorf("device /dev/ram0 not found in config devices; got %v", conf.Devices)
 	}
 }
+
+func TestDefaultDeviceRules(t *testing.T) {
+	spec := Example()
+	spec.Linux.Devices = []specs.LinuxDevice{
+		{
+			// This is purposely redundant with one of runc's default devices
+			Path:  "/dev/tty",
+			Type:  "c",
+			Major: 5,
+			Minor: 0,
+		},
+	}
+	spec.Linux.Resources = &specs.LinuxResources{
+		Devices: []specs.LinuxDeviceCgroup{
+			{Allow: false, Access: "rwm"},
+		},
+	}
+
+	conf := &configs.Config{}
+	defaultDevs, err := createDevices(spec, conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cgroup, err := CreateCgroupConfig(&CreateOpts{CgroupName: "ContainerID", Spec: spec}, defaultDevs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The default device rules must be the ones appended on creation.
+	rules := DefaultDeviceRules(conf)
+	if want := cgroup.Resources.Devices[1:]; !reflect.DeepEqual(rules, want) {
+		t.Errorf("expected default device rules %v, got %v", want, rules)
+	}
+	for _, rule := range rules {
+		if rule.Type == devices.CharDevice && rule.Major == 5 && rule.Minor == 0 {
+			t.Errorf("rule for the redundant /dev/tty device was not removed: %v", rule)
+		}
+	}
+}
+
+func TestCreateIDMappedMount(t *testing.T) {
+	m, err := createLibcontainerMount("/", specs.Mount{
+		Destination: "/data",
+		Source:      "/src",
+		Options:     []string{"rbind", "idmap=uids=0-1000-10#10-2000-1;gids=0-1000-11", "ro"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Device != "bind" || m.Flags != unix.MS_BIND|unix.MS_REC|unix.MS_RDONLY || m.Data != "" {
+		t.Fatalf("unexpected mount %+v", m)
+	}
+	if !m.IsIDMapped() {
+		t.Fatal("expected an idmapped mount")
+	}
+	expected := configs.MountIDMapping{
+		UIDMappings: []configs.IDMap{
+			{ContainerID: 0, HostID: 1000, Size: 10},
+			{ContainerID: 10, HostID: 2000, Size: 1},
+		},
+		GIDMappings: []configs.IDMap{
+			{ContainerID: 0, HostID: 1000, Size: 11},
+		},
+	}
+	if !reflect.DeepEqual(*m.IDMapping, expected) {
+		t.Errorf("expected %+v, got %+v", expected, *m.IDMapping)
+	}
+
+	m, err = createLibcontainerMount("/", specs.Mount{
+		Destination: "/data",
+		Source:      "/src",
+		Options:     []string{"bind", "idmap"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !m.IsIDMapped() || len(m.IDMapping.UIDMappings) != 0 || len(m.IDMapping.GIDMappings) != 0 {
+		t.Errorf("expected idmapped mount with no mappings, got %+v", m.IDMapping)
+	}
+
+	for _, opt := range []string{"idmap=uids", "idmap=uids=0-1", "idmap=uids=a-1-1", "idmap=foo=0-1-1"} {
+		if _, err := createLibcontainerMount("/", specs.Mount{
+			Destination: "/data",
+			Source:      "/src",
+			Options:     []string{"bind", opt},
+		}); err == nil {
+			t.Errorf("%q: expected error, got nil", opt)
+		}
+	}
+}
+
+func TestCreateRootfsIDMapping(t *testing.T) {
+	conf := &configs.Config{}
+	if err := createRootfsIDMapping(&specs.Spec{}, conf); err != nil {
+		t.Fatal(err)
+	}
+	if conf.RootfsIDMapping != nil {
+		t.Fatalf("expected no rootfs idmapping, got %+v", conf.RootfsIDMapping)
+	}
+
+	rspec := &specs.Spec{
+		Annotations: map[string]string{RootfsIDMapAnnotation: ""},
+	}
+	if err := createRootfsIDMapping(rspec, conf); err != nil {
+		t.Fatal(err)
+	}
+	if conf.RootfsIDMapping == nil || len(conf.RootfsIDMapping.UIDMappings) != 0 || len(conf.RootfsIDMapping.GIDMappings) != 0 {
+		t.Fatalf("expected a rootfs idmapping with no mappings, got %+v", conf.RootfsIDMapping)
+	}
+
+	rspec.Annotations[RootfsIDMapAnnotation] = "uids=0-1000-10;gids=0-2000-10"
+	if err := createRootfsIDMapping(rspec, conf); err != nil {
+		t.Fatal(err)
+	}
+	expected := configs.MountIDMapping{
+		UIDMappings: []configs.IDMap{{ContainerID: 0, HostID: 1000, Size: 10}},
+		GIDMappings: []configs.IDMap{{ContainerID: 0, HostID: 2000, Size: 10}},
+	}
+	if !reflect.DeepEqual(*conf.RootfsIDMapping, expected) {
+		t.Errorf("expected %+v, got %+v", expected, *conf.RootfsIDMapping)
+	}
+
+	rspec.Annotations[RootfsIDMapAnnotation] = "uids=0-1"
+	if err := createRootfsIDMapping(rspec, conf); err == nil {
+		t.Error("expected an error for invalid mappings")
+	}
+}
+
+func TestCreateRecAttrMount(t *testing.T) {
+	m, err := createLibcontainerMount("/", specs.Mount{
+		Destination: "/data",
+		Source:      "/src",
+		Options:     []string{"rbind", "rro", "rnosuid", "rexec"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Data != "" {
+		t.Errorf("expected no mount data, got %q", m.Data)
+	}
+	expected := configs.MountRecAttr{
+		AttrSet: system.MOUNT_ATTR_RDONLY | system.MOUNT_ATTR_NOSUID,
+		AttrClr: system.MOUNT_ATTR_NOEXEC,
+	}
+	if m.RecAttr == nil || *m.RecAttr != expected {
+		t.Errorf("expected %+v, got %+v", expected, m.RecAttr)
+	}
+
+	// The last option wins.
+	m, err = createLibcontainerMount("/", specs.Mount{
+		Destination: "/data",
+		Source:      "/src",
+		Options:     []string{"rbind", "rro", "rrw"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = configs.MountRecAttr{AttrClr: system.MOUNT_ATTR_RDONLY}
+	if m.RecAttr == nil || *m.RecAttr != expected {
+		t.Errorf("expected %+v, got %+v", expected, m.RecAttr)
+	}
+}
+
+func TestKnownNamespaces(t *testing.T) {
+	namespaces := KnownNamespaces()
+	if !sort.StringsAreSorted(namespaces) {
+		t.Errorf("namespaces are not sorted: %v", namespaces)
+	}
+	for _, ns := range namespaces {
+		if _, ok := namespaceMapping[specs.LinuxNamespaceType(ns)]; !ok {
+			t.Errorf("unknown namespace %q", ns)
+		}
+	}
+	// The mount namespace is always available.
+	found := false
+	for _, ns := range namespaces {
+		if ns == string(specs.MountNamespace) {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("mount namespace not found in %v", namespaces)
+	}
+}
+
+func TestKnownAnnotations(t *testing.T) {
+	annotations := KnownAnnotations()
+	if !sort.StringsAreSorted(annotations) {
+		t.Errorf("annotations are not sorted: %v", annotations)
+	}
+	found := false
+	for _, a := range annotations {
+		if a == RootfsIDMapAnnotation {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("annotation %s not found in %v", RootfsIDMapAnnotation, annotations)
+	}
+}
+
+func TestCreateAnnotationHooks(t *testing.T) {
+	rspec := &specs.Spec{
+		Annotations: map[string]string{
+			PostCheckpointHooksAnnotation: `[{"path": "/some/hook/path", "args": ["--some", "thing"], "timeout": 10}, {"path": "/some/hook2/path"}]`,
+			PreRestoreHooksAnnotation:     `[{"path": "/some/hook3/path"}]`,
+		},
+	}
+	conf := &configs.Config{Hooks: configs.Hooks{}}
+	if err := createAnnotationHooks(rspec, conf); err != nil {
+		t.Fatal(err)
+	}
+
+	postCheckpoint := conf.Hooks[configs.PostCheckpoint]
+	if len(postCheckpoint) != 2 {
+		t.Fatal("Expected 2 postCheckpoint hooks")
+	}
+	cmd := postCheckpoint[0].(configs.CommandHook)
+	if cmd.Path != "/some/hook/path" || *cmd.Timeout != 10*time.Second {
+		t.Errorf("Unexpected postCheckpoint hook %+v", cmd)
+	}
+	if len(conf.Hooks[configs.PreRestore]) != 1 {
+		t.Error("Expected 1 preRestore hook")
+	}
+
+	rspec.Annotations[PreRestoreHooksAnnotation] = `{"path": "/not/an/array"}`
+	if err := createAnnotationHooks(rspec, &configs.Config{Hooks: configs.Hooks{}}); err == nil {
+		t.Error("Expected error for an invalid annotation")
+	}
+}
+
+func TestParsePortForward(t *testing.T) {
+	for _, tc := range []struct {
+		value    string
+		expected configs.PortForward
+		isErr    bool
+	}{
+		{value: "8080:80", expected: configs.PortForward{Protocol: "tcp", HostPort: 8080, ContainerPort: 80}},
+		{value: "5353:53/udp", expected: configs.PortForward{Protocol: "udp", HostPort: 5353, ContainerPort: 53}},
+		{
+			value:    "127.0.0.1:8080:80/tcp",
+			expected: configs.PortForward{Protocol: "tcp", HostIP: "127.0.0.1", HostPort: 8080, ContainerPort: 80},
+		},
+		{
+			value:    "[::1]:8443:443",
+			expected: configs.PortForward{Protocol: "tcp", HostIP: "::1", HostPort: 8443, ContainerPort: 443},
+		},
+		{value: "80", isErr: true},
+		{value: "8080:80/sctp", isErr: true},
+		{value: "0:80", isErr: true},
+		{value: "8080:65536", isErr: true},
+		{value: "localhost:8080:80", isErr: true},
+	} {
+		pf, err := ParsePortForward(tc.value)
+		if tc.isErr {
+			if err == nil {
+				t.Errorf("%q: expected an error, got %+v", tc.value, pf)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", tc.value, err)
+			continue
+		}
+		if pf != tc.expected {
+			t.Errorf("%q: expected %+v, got %+v", tc.value, tc.expected, pf)
+		}
+		// The string of a port forward parses back to the same one.
+		if pf2, err := ParsePortForward(pf.String()); err != nil || pf2 != pf {
+			t.Errorf("%q: %q parsed to %+v (%v)", tc.value, pf.String(), pf2, err)
+		}
+	}
+}
+
+func TestCreateAnnotationNetwork(t *testing.T) {
+	rspec := &specs.Spec{
+		Annotations: map[string]string{
+			NetworkHelperAnnotation: "slirp4netns",
+			NetworkPortsAnnotation:  `["8080:80", "5353:53/udp"]`,
+		},
+	}
+	conf := &configs.Config{
+		Namespaces: configs.Namespaces{{Type: configs.NEWNET}},
+	}
+	if err := createAnnotationNetwork(rspec, conf); err != nil {
+		t.Fatal(err)
+	}
+	if len(conf.Networks) != 1 {
+		t.Fatalf("expected 1 network, got %d", len(conf.Networks))
+	}
+	n := conf.Networks[0]
+	if n.Type != "slirp4netns" || len(n.PortForwards) != 2 || n.PortForwards[1].Protocol != "udp" {
+		t.Errorf("unexpected network %+v", n)
+	}
+
+	// The host network namespace can't be set up by a helper.
+	if err := createAnnotationNetwork(rspec, &configs.Config{}); err == nil {
+		t.Error("expected an error without a network namespace")
+	}
+	rspec.Annotations[NetworkHelperAnnotation] = "vpnkit"
+	if err := createAnnotationNetwork(rspec, conf); err == nil {
+		t.Error("expected an error for an unknown helper")
+	}
+
+	// Without a helper, the ports are passed as sockets.
+	delete(rspec.Annotations, NetworkHelperAnnotation)
+	conf = &configs.Config{}
+	if err := createAnnotationNetwork(rspec, conf); err != nil {
+		t.Fatal(err)
+	}
+	if len(conf.Networks) != 0 || len(conf.PortForwards) != 2 || conf.PortForwards[0].HostPort != 8080 {
+		t.Errorf("unexpected networks %+v and port forwards %+v", conf.Networks, conf.PortForwards)
+	}
+}
+
+// saveExtensions lets a test register extensions and annotation handlers,
+// and returns a function restoring the previous ones, so that they don't run
+// in the other tests.
+func saveExtensions() func() {
+	extensionsMu.Lock()
+	defer extensionsMu.Unlock()
+	savedExtensions, savedHandlers := extensions, annotationHandlers
+	extensions = append([]namedExtension(nil), extensions...)
+	annotationHandlers = make(map[string]AnnotationHandler, len(savedHandlers))
+	for key, h := range savedHandlers {
+		annotationHandlers[key] = h
+	}
+	return func() {
+		extensionsMu.Lock()
+		defer extensionsMu.Unlock()
+		extensions, annotationHandlers = savedExtensions, savedHandlers
+	}
+}
+
+func TestCreateLibcontainerConfigExtensions(t *testing.T) {
+	defer saveExtensions()()
+
+	const annotation = "org.example.test.sysctl"
+	RegisterAnnotationHandler(annotation, func(value string, _ *CreateOpts, config *configs.Config) error {
+		if value == "" {
+			return errors.New("empty sysctl")
+		}
+		if config.Sysctl == nil {
+			config.Sysctl = make(map[string]string)
+		}
+		config.Sysctl["net.ipv4.ip_forward"] = value
+		return nil
+	})
+	var order []string
+	RegisterExtension("test-raw", func(opts *CreateOpts, config *configs.Config) error {
+		var raw struct {
+			Linux struct {
+				Experimental string `json:"experimental"`
+			} `json:"linux"`
+		}
+		if len(opts.RawSpec) > 0 {
+			if err := json.Unmarshal(opts.RawSpec, &raw); err != nil {
+				return err
+			}
+		}
+		order = append(order, "registered")
+		config.Labels = append(config.Labels, "experimental="+raw.Linux.Experimental)
+		return nil
+	})
+
+	spec := Example()
+	spec.Root.Path = "/"
+	spec.Annotations = map[string]string{annotation: "1"}
+	config, err := CreateLibcontainerConfig(&CreateOpts{
+		CgroupName: "ContainerID",
+		Spec:       spec,
+		RawSpec:    json.RawMessage(`{"linux": {"experimental": "on"}}`),
+		Extensions: []Extension{func(_ *CreateOpts, _ *configs.Config) error {
+			order = append(order, "opts")
+			return nil
+		}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.Sysctl["net.ipv4.ip_forward"] != "1" {
+		t.Errorf("expected the annotation to be handled, got sysctls %v", config.Sysctl)
+	}
+	if !reflect.DeepEqual(order, []string{"registered", "opts"}) {
+		t.Errorf("unexpected order of the extensions %q", order)
+	}
+	if l := config.Labels[len(config.Labels)-1]; l != "experimental=on" {
+		t.Errorf("expected the extension to decode the raw spec, got the label %q", l)
+	}
+
+	found := false
+	for _, a := range KnownAnnotations() {
+		if a == annotation {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("expected the annotation %s to be known", annotation)
+	}
+
+	spec.Annotations[annotation] = ""
+	_, err = CreateLibcontainerConfig(&CreateOpts{CgroupName: "ContainerID", Spec: spec})
+	if err == nil || !strings.Contains(err.Error(), annotation) {
+		t.Errorf("expected an error of the annotation handler, got %v", err)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("expected registering an extension twice to panic")
+		}
+	}()
+	RegisterExtension("test-raw", func(*CreateOpts, *configs.Config) error { return nil })
+}
@@ -3,6 +3,7 @@
 package libcontainer
 
 import (
+	"context"
 	"os"
 	"os/exec"
 	"runtime"
@@ -133,6 +134,36 @@ func (l *linuxStandardInit) Init() error {
 			return errors.Wrapf(err, "mask path %s", path)
 		}
 	}
+	// Real-time and deadline policies require CAP_SYS_NICE, so the scheduling
+	// attributes are set before finalizeNamespace drops the capabilities.
+	// They are inherited by the process across execve.
+	if s := l.config.Config.Scheduler; s != nil {
+		attr, err := s.ToSchedAttr()
+		if err != nil {
+			return errors.Wrap(err, "invalid scheduler")
+		}
+		if err := system.SchedSetattr(0, attr, 0); err != nil {
+			return errors.Wrap(err, "set scheduler")
+		}
+	}
+	// IOPRIO_CLASS_RT requires CAP_SYS_ADMIN, so it must be set before
+	// finalizeNamespace as well.
+	if err := setIOPriority(l.config.IOPriority); err != nil {
+		return err
+	}
+	// The memory policy is per thread, and this thread is the one doing
+	// the execve, so that the process and its children inherit it.
+	if err := setMemoryPolicy(l.config.Config.MemoryPolicy); err != nil {
+		return err
+	}
+	if l.config.Config.SchedCore {
+		if err := system.SchedCoreCreate(0); err != nil {
+			return errors.Wrap(err, "create core scheduling cookie")
+		}
+	}
+	if err := setupPersonality(l.config.Config); err != nil {
+		return errors.Wrap(err, "set personality")
+	}
 	pdeath, err := system.GetParentDeathSignal()
 	if err != nil {
 		return errors.Wrap(err, "get pdeath signal")
@@ -152,13 +183,20 @@ func (l *linuxStandardInit) Init() error {
 		return errors.Wrap(err, "set process label")
 	}
 	defer selinux.SetExecLabel("") //nolint: errcheck
+	if err := restrictAddressFamilies(l.config.Config); err != nil {
+		return errors.Wrap(err, "restrict address families")
+	}
 	// Without NoNewPrivileges seccomp is a privileged operation, so we need to
 	// do this before dropping capabilities; otherwise do it as late as possible
 	// just before execve so as few syscalls take place after it as possible.
 	if l.config.Config.Seccomp != nil && !l.config.NoNewPrivileges {
-		if err := seccomp.InitSeccomp(l.config.Config.Seccomp); err != nil {
+		seccompFd, err := seccomp.InitSeccomp(l.config.Config.Seccomp)
+		if err != nil {
 			return err
 		}
+		if err := syncParentSeccomp(l.pipe, seccompFd); err != nil {
+			return errors.Wrap(err, "sync seccomp")
+		}
 	}
 	if err := finalizeNamespace(l.config); err != nil {
 		return err
@@ -181,6 +219,20 @@ func (l *linuxStandardInit) Init() error {
 	if err != nil {
 		return err
 	}
+	// Set seccomp as close to execve as possible, so as few syscalls take
+	// place afterward (reducing the amount of syscalls that users need to
+	// enable in their seccomp profiles). However, this needs to be done
+	// before closing the pipe, as it is used to pass the seccomp notify fd
+	// to the parent.
+	if l.config.Config.Seccomp != nil && l.config.NoNewPrivileges {
+		seccompFd, err := seccomp.InitSeccomp(l.config.Config.Seccomp)
+		if err != nil {
+			return newSystemErrorWithCause(err, "init seccomp")
+		}
+		if err := syncParentSeccomp(l.pipe, seccompFd); err != nil {
+			return newSystemErrorWithCause(err, "sync seccomp")
+		}
+	}
 	// Close the pipe to signal that we have completed our init.
 	logrus.Debugf("init: closing the pipe to signal completion")
 	_ = l.pipe.Close()
@@ -208,19 +260,11 @@ func (l *linuxStandardInit) Init() error {
 	// since been resolved.
 	// https://github.com/torvalds/linux/blob/v4.9/fs/exec.c#L1290-L1318
 	_ = unix.Close(l.fifoFd)
-	// Set seccomp as close to execve as possible, so as few syscalls take
-	// place afterward (reducing the amount of syscalls that users need to
-	// enable in their seccomp profiles).
-	if l.config.Config.Seccomp != nil && l.config.NoNewPrivileges {
-		if err := seccomp.InitSeccomp(l.config.Config.Seccomp); err != nil {
-			return newSystemErrorWithCause(err, "init seccomp")
-		}
-	}
 
 	s := l.config.SpecState
 	s.Pid = unix.Getpid()
 	s.Status = specs.StateCreated
-	if err := l.config.Config.Hooks[configs.StartContainer].RunHooks(s); err != nil {
+	if _, err := runHookList(context.Background(), l.config.Config.Hooks[configs.StartContainer], configs.StartContainer, s); err != nil {
 		return err
 	}
 
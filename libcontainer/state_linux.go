@@ -3,12 +3,14 @@
 package libcontainer
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
 
 	"github.com/opencontainers/runc/libcontainer/configs"
 	"github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/opencontainers/selinux/go-selinux"
 	"github.com/sirupsen/logrus"
 	"golang.org/x/sys/unix"
 )
@@ -33,35 +35,45 @@ func (s *stateTransitionError) Error() string {
 
 type containerState interface {
 	transition(containerState) error
-	destroy() error
+	destroy(ctx context.Context) error
 	status() Status
 }
 
-func destroy(c *linuxContainer) error {
+func destroy(ctx context.Context, c *linuxContainer) error {
 	if !c.config.Namespaces.Contains(configs.NEWPID) ||
 		c.config.Namespaces.PathOf(configs.NEWPID) != "" {
 		if err := signalAllProcesses(c.cgroupManager, unix.SIGKILL); err != nil {
 			logrus.Warn(err)
 		}
 	}
-	err := c.cgroupManager.Destroy()
+	// The networking helpers are not in the cgroup of the container, as
+	// they are run by the user on the host side.
+	if err := stopNetworkHelpers(c); err != nil {
+		logrus.Warn(err)
+	}
+	err := c.cgroupManager.DestroyContext(ctx)
 	if c.intelRdtManager != nil {
 		if ierr := c.intelRdtManager.Destroy(); err == nil {
 			err = ierr
 		}
 	}
+	if serr := c.stateStore.Delete(c.id); err == nil {
+		err = serr
+	}
 	if rerr := os.RemoveAll(c.root); err == nil {
 		err = rerr
 	}
+	// Allow the MCS level of the container to be allocated again.
+	selinux.ReleaseLabel(c.config.ProcessLabel)
 	c.initProcess = nil
-	if herr := runPoststopHooks(c); err == nil {
+	if herr := runPoststopHooks(ctx, c); err == nil {
 		err = herr
 	}
 	c.state = &stoppedState{c: c}
 	return err
 }
 
-func runPoststopHooks(c *linuxContainer) error {
+func runPoststopHooks(ctx context.Context, c *linuxContainer) error {
 	hooks := c.config.Hooks
 	if hooks == nil {
 		return nil
@@ -73,7 +85,7 @@ func runPoststopHooks(c *linuxContainer) error {
 	}
 	s.Status = specs.StateStopped
 
-	if err := hooks[configs.Poststop].RunHooks(s); err != nil {
+	if err := hooks[configs.Poststop].RunHooksContext(ctx, s); err != nil {
 		return err
 	}
 
@@ -100,8 +112,8 @@ func (b *stoppedState) transition(s containerState) error {
 	return newStateTransitionError(b, s)
 }
 
-func (b *stoppedState) destroy() error {
-	return destroy(b.c)
+func (b *stoppedState) destroy(ctx context.Context) error {
+	return destroy(ctx, b.c)
 }
 
 // runningState represents a container that is currently running.
@@ -130,11 +142,11 @@ func (r *runningState) transition(s containerState) error {
 	return newStateTransitionError(r, s)
 }
 
-func (r *runningState) destroy() error {
+func (r *runningState) destroy(ctx context.Context) error {
 	if r.c.runType() == Running {
 		return newGenericError(fmt.Errorf("container is not destroyed"), ContainerNotStopped)
 	}
-	return destroy(r.c)
+	return destroy(ctx, r.c)
 }
 
 type createdState struct {
@@ -156,9 +168,9 @@ func (i *createdState) transition(s containerState) error {
 	return newStateTransitionError(i, s)
 }
 
-func (i *createdState) destroy() error {
+func (i *createdState) destroy(ctx context.Context) error {
 	_ = i.c.initProcess.signal(unix.SIGKILL)
-	return destroy(i.c)
+	return destroy(ctx, i.c)
 }
 
 // pausedState represents a container that is currently pause.  It cannot be destroyed in a
@@ -182,13 +194,13 @@ func (p *pausedState) transition(s containerState) error {
 	return newStateTransitionError(p, s)
 }
 
-func (p *pausedState) destroy() error {
+func (p *pausedState) destroy(ctx context.Context) error {
 	t := p.c.runType()
 	if t != Running && t != Created {
 		if err := p.c.cgroupManager.Freeze(configs.Thawed); err != nil {
 			return err
 		}
-		return destroy(p.c)
+		return destroy(ctx, p.c)
 	}
 	return newGenericError(fmt.Errorf("container is paused"), ContainerPaused)
 }
@@ -212,13 +224,13 @@ func (r *restoredState) transition(s containerState) error {
 	return newStateTransitionError(r, s)
 }
 
-func (r *restoredState) destroy() error {
+func (r *restoredState) destroy(ctx context.Context) error {
 	if _, err := os.Stat(filepath.Join(r.c.root, "checkpoint")); err != nil {
 		if !os.IsNotExist(err) {
 			return err
 		}
 	}
-	return destroy(r.c)
+	return destroy(ctx, r.c)
 }
 
 // loadedState is used whenever a container is restored, loaded, or setting additional
@@ -237,9 +249,9 @@ func (n *loadedState) transition(s containerState) error {
 	return nil
 }
 
-func (n *loadedState) destroy() error {
+func (n *loadedState) destroy(ctx context.Context) error {
 	if err := n.c.refreshState(); err != nil {
 		return err
 	}
-	return n.c.state.destroy()
+	return n.c.state.destroy(ctx)
 }
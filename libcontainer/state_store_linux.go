@@ -0,0 +1,203 @@
+// +build linux
+
+package libcontainer
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	securejoin "github.com/cyphar/filepath-securejoin"
+	"github.com/opencontainers/runc/libcontainer/utils"
+)
+
+// StateVersion is the version of the schema of the states persisted by a
+// StateStore, which is increased on any change of State. The states written
+// with a previous version are migrated when they are loaded (see
+// stateMigrations).
+const StateVersion = 1
+
+// StateCompatVersion is the oldest StateVersion able to load the states
+// written with the current one, which is increased (to StateVersion) on the
+// changes of State which can't be ignored by older versions. The fields added
+// without increasing it must be optional, since older versions drop them
+// when they save the state again.
+const StateCompatVersion = 1
+
+// stateMigrations are the migrations of the JSON encoding of the states,
+// indexed by the version they migrate from to the next one.
+var stateMigrations = map[int]func(fields map[string]json.RawMessage) error{}
+
+// StateStore persists the states of the containers of a factory.
+//
+// The default one, FileStateStore, stores them in the state.json file of
+// the directory of each container, and others can be set with the
+// WithStateStore option of the factory. The other files of the containers
+// (such as exec.fifo) are kept in their directories in any case.
+type StateStore interface {
+	// Load returns the state of the container with the given id, or an
+	// error for which errors.Is(err, os.ErrNotExist) is true if there is
+	// none.
+	Load(id string) (*State, error)
+
+	// Save replaces the state of the container with the given id. It must
+	// be atomic: if it fails, Load must return the previous state.
+	Save(id string, state *State) error
+
+	// Delete removes the state of the container with the given id, if any.
+	Delete(id string) error
+}
+
+// FileStateStore is a StateStore keeping the state of each container in the
+// state.json file of the container directory under Root.
+type FileStateStore struct {
+	Root string
+}
+
+func (s *FileStateStore) path(id string) (string, error) {
+	containerRoot, err := securejoin.SecureJoin(s.Root, id)
+	if err != nil {
+		return "", err
+	}
+	return securejoin.SecureJoin(containerRoot, stateFilename)
+}
+
+func (s *FileStateStore) Load(id string) (*State, error) {
+	path, err := s.path(id)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	data, err := ioutil.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
+	state, err := DecodeState(data)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decode %s: %w", path, err)
+	}
+	return state, nil
+}
+
+// Save writes the state to a temporary file, which is then renamed to
+// state.json, so that it is never partially written.
+func (s *FileStateStore) Save(id string, state *State) (retErr error) {
+	path, err := s.path(id)
+	if err != nil {
+		return err
+	}
+	tmpFile, err := ioutil.TempFile(filepath.Dir(path), "state-")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if retErr != nil {
+			tmpFile.Close()
+			os.Remove(tmpFile.Name())
+		}
+	}()
+
+	if err := utils.WriteJSON(tmpFile, state); err != nil {
+		return err
+	}
+	if err := tmpFile.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmpFile.Name(), path)
+}
+
+func (s *FileStateStore) Delete(id string) error {
+	path, err := s.path(id)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// DecodeState decodes the JSON encoding of a state, as written by the
+// FileStateStore, migrating it from the version it was written with.
+func DecodeState(data []byte) (*State, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	var version, compatVersion int
+	for k, v := range map[string]*int{
+		"state_version":        &version,
+		"state_compat_version": &compatVersion,
+	} {
+		if raw, ok := fields[k]; ok {
+			if err := json.Unmarshal(raw, v); err != nil {
+				return nil, fmt.Errorf("invalid %s: %w", k, err)
+			}
+		}
+	}
+	if err := checkStateVersion(version, compatVersion); err != nil {
+		return nil, err
+	}
+
+	if version < StateVersion {
+		// The states written before they were versioned have the
+		// schema of the version 1.
+		if version == 0 {
+			version = 1
+		}
+		for ; version < StateVersion; version++ {
+			if migrate := stateMigrations[version]; migrate != nil {
+				if err := migrate(fields); err != nil {
+					return nil, fmt.Errorf("unable to migrate the state from version %d: %w", version, err)
+				}
+			}
+		}
+		var err error
+		if data, err = json.Marshal(fields); err != nil {
+			return nil, err
+		}
+	}
+	var state *State
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, err
+	}
+	state.Version = version
+	return state, nil
+}
+
+// checkStateVersion returns an error if a state written with the given
+// versions can't be loaded.
+func checkStateVersion(version, compatVersion int) error {
+	if compatVersion > StateVersion {
+		return fmt.Errorf("the state was written by a newer version of runc (state version %d), which can't be loaded with state version %d", version, StateVersion)
+	}
+	return nil
+}
+
+// migrateState checks the version of a state loaded by a StateStore, and
+// upgrades it to the current StateVersion. The states which need migrations
+// of their JSON encoding must have been decoded with DecodeState.
+func migrateState(state *State) error {
+	if err := checkStateVersion(state.Version, state.CompatVersion); err != nil {
+		return err
+	}
+	version := state.Version
+	if version == 0 {
+		version = 1
+	}
+	for ; version < StateVersion; version++ {
+		if stateMigrations[version] != nil {
+			return fmt.Errorf("the state has version %d, and must be decoded with DecodeState to be migrated", state.Version)
+		}
+	}
+	if state.Version < StateVersion {
+		state.Version = StateVersion
+	}
+	return nil
+}
@@ -0,0 +1,185 @@
+package libcontainer
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/opencontainers/runc/libcontainer/configs"
+)
+
+func TestFileStateStore(t *testing.T) {
+	root, err := newTestRoot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root) //nolint: errcheck
+	s := &FileStateStore{Root: root}
+
+	if _, err := s.Load("1"); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected a not exist error, got %v", err)
+	}
+	if err := os.Mkdir(filepath.Join(root, "1"), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	state := &State{
+		BaseState: BaseState{ID: "1", InitProcessPid: 1024},
+		Version:   StateVersion,
+	}
+	if err := s.Save("1", state); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := s.Load("1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.InitProcessPid != 1024 || loaded.Version != StateVersion {
+		t.Fatalf("unexpected state %+v", loaded)
+	}
+	// No temporary file is left behind.
+	files, err := filepath.Glob(filepath.Join(root, "1", "*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 || filepath.Base(files[0]) != stateFilename {
+		t.Fatalf("expected only %s, got %v", stateFilename, files)
+	}
+
+	if err := s.Delete("1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Delete("1"); err != nil {
+		t.Fatalf("expected no error deleting a missing state, got %v", err)
+	}
+	if _, err := s.Load("1"); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected a not exist error, got %v", err)
+	}
+}
+
+func TestDecodeState(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		data    string
+		version int
+		fail    bool
+	}{
+		{
+			name:    "unversioned",
+			data:    `{"init_process_pid":1024}`,
+			version: 1,
+		},
+		{
+			name:    "current",
+			data:    `{"init_process_pid":1024,"state_version":1,"state_compat_version":1}`,
+			version: StateVersion,
+		},
+		{
+			// A state written by a newer runc, with an optional
+			// field unknown to this one.
+			name:    "newer compatible",
+			data:    `{"init_process_pid":1024,"state_version":1000,"state_compat_version":1,"new_field":true}`,
+			version: 1000,
+		},
+		{
+			name: "newer incompatible",
+			data: `{"init_process_pid":1024,"state_version":1000,"state_compat_version":1000}`,
+			fail: true,
+		},
+		{
+			name: "invalid version",
+			data: `{"init_process_pid":1024,"state_version":"1"}`,
+			fail: true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			state, err := DecodeState([]byte(tc.data))
+			if tc.fail {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if state.InitProcessPid != 1024 || state.Version != tc.version {
+				t.Fatalf("unexpected state %+v", state)
+			}
+		})
+	}
+}
+
+func TestMigrateState(t *testing.T) {
+	state := &State{}
+	if err := migrateState(state); err != nil {
+		t.Fatal(err)
+	}
+	if state.Version != StateVersion {
+		t.Fatalf("expected version %d, got %d", StateVersion, state.Version)
+	}
+	state.Version = StateVersion + 1
+	if err := migrateState(state); err != nil {
+		t.Fatalf("expected a newer compatible state to be loaded, got %v", err)
+	}
+	state.CompatVersion = StateVersion + 1
+	if err := migrateState(state); err == nil {
+		t.Fatal("expected an error for a newer incompatible state")
+	}
+}
+
+type memStateStore map[string]*State
+
+func (m memStateStore) Load(id string) (*State, error) {
+	s, ok := m[id]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	return s, nil
+}
+
+func (m memStateStore) Save(id string, s *State) error {
+	m[id] = s
+	return nil
+}
+
+func (m memStateStore) Delete(id string) error {
+	delete(m, id)
+	return nil
+}
+
+func TestFactoryWithStateStore(t *testing.T) {
+	root, err := newTestRoot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root) //nolint: errcheck
+	store := memStateStore{}
+	factory, err := New(root, Cgroupfs, WithStateStore(store))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = factory.Load("1")
+	if lerr, ok := err.(Error); !ok || lerr.Code() != ContainerNotExists {
+		t.Fatalf("expected ContainerNotExists error, got %v", err)
+	}
+
+	store["1"] = &State{
+		BaseState: BaseState{
+			ID:     "1",
+			Config: configs.Config{Rootfs: "/mycontainer/root"},
+		},
+	}
+	container, err := factory.Load("1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rootfs := container.Config().Rootfs; rootfs != "/mycontainer/root" {
+		t.Fatalf("expected rootfs %q, got %q", "/mycontainer/root", rootfs)
+	}
+	// The unversioned state was migrated when loaded.
+	if v := store["1"].Version; v != StateVersion {
+		t.Fatalf("expected the state to be migrated to version %d, got %d", StateVersion, v)
+	}
+}
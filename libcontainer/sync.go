@@ -22,12 +22,24 @@ type syncType string
 //
 // procReady   --> [final setup]
 //             <-- procRun
+//
+// procIDMappedMounts --> [create idmapped mounts]
+//                    <-- mount fds (one SCM_RIGHTS message per mount)
+//
+// procSeccomp --> [prepare to receive the seccomp fd]
+//             <-- procSeccompReady
+// seccomp fd  --> [send the fd to the seccomp agent]
+//             <-- procSeccompDone
 const (
-	procError  syncType = "procError"
-	procReady  syncType = "procReady"
-	procRun    syncType = "procRun"
-	procHooks  syncType = "procHooks"
-	procResume syncType = "procResume"
+	procError          syncType = "procError"
+	procReady          syncType = "procReady"
+	procRun            syncType = "procRun"
+	procHooks          syncType = "procHooks"
+	procResume         syncType = "procResume"
+	procIDMappedMounts syncType = "procIDMappedMounts"
+	procSeccomp        syncType = "procSeccomp"
+	procSeccompReady   syncType = "procSeccompReady"
+	procSeccompDone    syncType = "procSeccompDone"
 )
 
 type syncT struct {
@@ -0,0 +1,40 @@
+// +build linux
+
+package system
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// I/O scheduling classes and targets of ioprio_set(2), which are not yet
+// available from golang.org/x/sys/unix.
+const (
+	IOPRIO_CLASS_NONE = 0
+	IOPRIO_CLASS_RT   = 1
+	IOPRIO_CLASS_BE   = 2
+	IOPRIO_CLASS_IDLE = 3
+
+	IOPRIO_WHO_PROCESS = 1
+	IOPRIO_WHO_PGRP    = 2
+	IOPRIO_WHO_USER    = 3
+
+	ioprioClassShift = 13
+)
+
+// IoprioValue returns the I/O priority value of the given class and priority
+// (level), as used by ioprio_set(2).
+func IoprioValue(class, priority int) int {
+	return class<<ioprioClassShift | priority
+}
+
+// IoprioSet is a wrapper for ioprio_set(2). A who of 0 (with
+// IOPRIO_WHO_PROCESS) refers to the calling thread.
+func IoprioSet(which, who, ioprio int) error {
+	_, _, errno := unix.Syscall(unix.SYS_IOPRIO_SET, uintptr(which), uintptr(who), uintptr(ioprio))
+	if errno != 0 {
+		return os.NewSyscallError("ioprio_set", errno)
+	}
+	return nil
+}
@@ -3,6 +3,7 @@
 package system
 
 import (
+	"os"
 	"os/exec"
 	"unsafe"
 
@@ -84,6 +85,16 @@ func Setctty() error {
 	return nil
 }
 
+// SetLinuxPersonality sets the Linux execution domain (personality) of the
+// calling process.
+func SetLinuxPersonality(personality int) error {
+	_, _, errno := unix.Syscall(unix.SYS_PERSONALITY, uintptr(personality), 0, 0)
+	if errno != 0 {
+		return &os.SyscallError{Syscall: "set_personality", Err: errno}
+	}
+	return nil
+}
+
 // SetSubreaper sets the value i as the subreaper setting for the calling process
 func SetSubreaper(i int) error {
 	return unix.Prctl(unix.PR_SET_CHILD_SUBREAPER, uintptr(i), 0, 0, 0)
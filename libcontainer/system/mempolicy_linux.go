@@ -0,0 +1,44 @@
+// +build linux
+
+package system
+
+import (
+	"os"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// Memory policy modes and flags of set_mempolicy(2), which are not yet
+// available from golang.org/x/sys/unix.
+const (
+	MPOL_DEFAULT             = 0
+	MPOL_PREFERRED           = 1
+	MPOL_BIND                = 2
+	MPOL_INTERLEAVE          = 3
+	MPOL_LOCAL               = 4
+	MPOL_PREFERRED_MANY      = 5
+	MPOL_WEIGHTED_INTERLEAVE = 6
+
+	MPOL_F_NUMA_BALANCING = 1 << 13
+	MPOL_F_RELATIVE_NODES = 1 << 14
+	MPOL_F_STATIC_NODES   = 1 << 15
+)
+
+// SetMempolicy is a wrapper for set_mempolicy(2), which sets the memory
+// policy of the calling thread. The mode includes the mode flags, and the
+// nodemask is a bit mask of the memory nodes, which can be nil.
+func SetMempolicy(mode int, nodemask []uint64) error {
+	var ptr unsafe.Pointer
+	var maxnode uintptr
+	if len(nodemask) > 0 {
+		ptr = unsafe.Pointer(&nodemask[0])
+		// The kernel only reads maxnode-1 bits of the mask.
+		maxnode = uintptr(len(nodemask)*64 + 1)
+	}
+	_, _, errno := unix.Syscall(unix.SYS_SET_MEMPOLICY, uintptr(mode), uintptr(ptr), maxnode)
+	if errno != 0 {
+		return os.NewSyscallError("set_mempolicy", errno)
+	}
+	return nil
+}
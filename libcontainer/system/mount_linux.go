@@ -0,0 +1,164 @@
+// +build linux
+
+package system
+
+import (
+	"errors"
+	"os"
+	"sync"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// Flags and attributes of the new mount API (Linux 5.2+) which are not yet
+// available from golang.org/x/sys/unix.
+const (
+	OPEN_TREE_CLONE         = 0x1
+	OPEN_TREE_CLOEXEC       = unix.O_CLOEXEC
+	MOVE_MOUNT_F_EMPTY_PATH = 0x4
+	MOVE_MOUNT_T_EMPTY_PATH = 0x40
+	AT_RECURSIVE            = 0x8000
+
+	FSOPEN_CLOEXEC      = 0x1
+	FSMOUNT_CLOEXEC     = 0x1
+	FSCONFIG_SET_FLAG   = 0x0
+	FSCONFIG_SET_STRING = 0x1
+	FSCONFIG_CMD_CREATE = 0x6
+
+	MOUNT_ATTR_RDONLY      = 0x1
+	MOUNT_ATTR_NOSUID      = 0x2
+	MOUNT_ATTR_NODEV       = 0x4
+	MOUNT_ATTR_NOEXEC      = 0x8
+	MOUNT_ATTR_NOATIME     = 0x10
+	MOUNT_ATTR_STRICTATIME = 0x20
+	MOUNT_ATTR_NODIRATIME  = 0x80
+	MOUNT_ATTR_IDMAP       = 0x100000
+)
+
+// MountAttr is struct mount_attr, used by mount_setattr(2).
+type MountAttr struct {
+	AttrSet     uint64
+	AttrClr     uint64
+	Propagation uint64
+	UsernsFd    uint64
+}
+
+// OpenTree is a wrapper for open_tree(2).
+func OpenTree(dirfd int, path string, flags uint) (int, error) {
+	p, err := unix.BytePtrFromString(path)
+	if err != nil {
+		return -1, err
+	}
+	fd, _, errno := unix.Syscall(unix.SYS_OPEN_TREE, uintptr(dirfd), uintptr(unsafe.Pointer(p)), uintptr(flags))
+	if errno != 0 {
+		return -1, &os.PathError{Op: "open_tree", Path: path, Err: errno}
+	}
+	return int(fd), nil
+}
+
+// MoveMount is a wrapper for move_mount(2).
+func MoveMount(fromDirfd int, fromPath string, toDirfd int, toPath string, flags uint) error {
+	from, err := unix.BytePtrFromString(fromPath)
+	if err != nil {
+		return err
+	}
+	to, err := unix.BytePtrFromString(toPath)
+	if err != nil {
+		return err
+	}
+	_, _, errno := unix.Syscall6(unix.SYS_MOVE_MOUNT, uintptr(fromDirfd), uintptr(unsafe.Pointer(from)),
+		uintptr(toDirfd), uintptr(unsafe.Pointer(to)), uintptr(flags), 0)
+	if errno != 0 {
+		return &os.PathError{Op: "move_mount", Path: toPath, Err: errno}
+	}
+	return nil
+}
+
+// Fsopen is a wrapper for fsopen(2).
+func Fsopen(fsName string, flags uint) (int, error) {
+	p, err := unix.BytePtrFromString(fsName)
+	if err != nil {
+		return -1, err
+	}
+	fd, _, errno := unix.Syscall(unix.SYS_FSOPEN, uintptr(unsafe.Pointer(p)), uintptr(flags), 0)
+	if errno != 0 {
+		return -1, &os.PathError{Op: "fsopen", Path: fsName, Err: errno}
+	}
+	return int(fd), nil
+}
+
+// Fsconfig is a wrapper for fsconfig(2). The key and value are not passed
+// to the kernel if empty.
+func Fsconfig(fd int, cmd uint, key, value string) error {
+	var k, v *byte
+	if key != "" {
+		p, err := unix.BytePtrFromString(key)
+		if err != nil {
+			return err
+		}
+		k = p
+	}
+	if value != "" {
+		p, err := unix.BytePtrFromString(value)
+		if err != nil {
+			return err
+		}
+		v = p
+	}
+	_, _, errno := unix.Syscall6(unix.SYS_FSCONFIG, uintptr(fd), uintptr(cmd),
+		uintptr(unsafe.Pointer(k)), uintptr(unsafe.Pointer(v)), 0, 0)
+	if errno != 0 {
+		return &os.PathError{Op: "fsconfig", Path: key, Err: errno}
+	}
+	return nil
+}
+
+// Fsmount is a wrapper for fsmount(2).
+func Fsmount(fd int, flags, attrs uint) (int, error) {
+	mfd, _, errno := unix.Syscall(unix.SYS_FSMOUNT, uintptr(fd), uintptr(flags), uintptr(attrs))
+	if errno != 0 {
+		return -1, os.NewSyscallError("fsmount", errno)
+	}
+	return int(mfd), nil
+}
+
+// MountSetattr is a wrapper for mount_setattr(2).
+func MountSetattr(dirfd int, path string, flags uint, attr *MountAttr) error {
+	p, err := unix.BytePtrFromString(path)
+	if err != nil {
+		return err
+	}
+	_, _, errno := unix.Syscall6(unix.SYS_MOUNT_SETATTR, uintptr(dirfd), uintptr(unsafe.Pointer(p)),
+		uintptr(flags), uintptr(unsafe.Pointer(attr)), unsafe.Sizeof(*attr), 0)
+	if errno != 0 {
+		return &os.PathError{Op: "mount_setattr", Path: path, Err: errno}
+	}
+	return nil
+}
+
+var (
+	setattrOnce      sync.Once
+	setattrSupported bool
+)
+
+// IsMountSetattrSupported reports whether the kernel supports
+// mount_setattr(2) (Linux 5.12+).
+func IsMountSetattrSupported() bool {
+	setattrOnce.Do(func() {
+		// With an invalid fd, mount_setattr(2) fails with EBADF when the
+		// syscall is available, and with ENOSYS when it is not.
+		attr := MountAttr{AttrSet: MOUNT_ATTR_RDONLY}
+		err := MountSetattr(-1, "", unix.AT_EMPTY_PATH, &attr)
+		setattrSupported = !errors.Is(err, unix.ENOSYS)
+	})
+	return setattrSupported
+}
+
+// IsIDMappedMountSupported reports whether the kernel supports idmapped
+// mounts (Linux 5.12+). Note that a particular filesystem may still not
+// support them, in which case an attempt to create one fails with EINVAL.
+func IsIDMappedMountSupported() bool {
+	// Idmapped mounts were added along with mount_setattr(2).
+	return IsMountSetattrSupported()
+}
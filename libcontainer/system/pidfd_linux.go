@@ -0,0 +1,30 @@
+// +build linux
+
+package system
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// PidfdOpen is a wrapper for pidfd_open(2) (Linux 5.3+). It returns a file
+// descriptor referring to the process pid, which stays valid (and keeps
+// referring to the same process) even after pid is reused.
+func PidfdOpen(pid int, flags uint) (int, error) {
+	fd, _, errno := unix.Syscall(unix.SYS_PIDFD_OPEN, uintptr(pid), uintptr(flags), 0)
+	if errno != 0 {
+		return -1, os.NewSyscallError("pidfd_open", errno)
+	}
+	return int(fd), nil
+}
+
+// PidfdSendSignal is a wrapper for pidfd_send_signal(2) (Linux 5.1+), which
+// sends the signal sig to the process referred to by pidfd.
+func PidfdSendSignal(pidfd int, sig unix.Signal) error {
+	_, _, errno := unix.Syscall6(unix.SYS_PIDFD_SEND_SIGNAL, uintptr(pidfd), uintptr(sig), 0, 0, 0, 0)
+	if errno != 0 {
+		return os.NewSyscallError("pidfd_send_signal", errno)
+	}
+	return nil
+}
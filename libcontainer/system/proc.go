@@ -57,9 +57,22 @@ type Stat_t struct {
 	// State is the state of the process.
 	State State
 
+	// PPID is the parent process ID.
+	PPID uint
+
+	// UTime and STime are the times the process has been scheduled in user
+	// and kernel mode, in clock ticks.
+	UTime, STime uint64
+
+	// NumThreads is the number of threads of the process.
+	NumThreads int
+
 	// StartTime is the number of clock ticks after system boot (since
 	// Linux 2.6).
 	StartTime uint64
+
+	// RSS is the resident set size of the process, in pages.
+	RSS uint64
 }
 
 // Stat returns a Stat_t instance for the specified process.
@@ -98,6 +111,11 @@ func parseStat(data string) (stat Stat_t, err error) {
 	var state int
 	fmt.Sscanf(parts[3-3], "%c", &state) //nolint:staticcheck // "3-3" is more readable in this context.
 	stat.State = State(state)
+	fmt.Sscanf(parts[4-3], "%d", &stat.PPID)
+	fmt.Sscanf(parts[14-3], "%d", &stat.UTime)
+	fmt.Sscanf(parts[15-3], "%d", &stat.STime)
+	fmt.Sscanf(parts[20-3], "%d", &stat.NumThreads)
 	fmt.Sscanf(parts[22-3], "%d", &stat.StartTime)
+	fmt.Sscanf(parts[24-3], "%d", &stat.RSS)
 	return stat, nil
 }
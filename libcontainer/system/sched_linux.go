@@ -0,0 +1,102 @@
+// +build linux
+
+package system
+
+import (
+	"os"
+	"runtime"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// Scheduling policies and flags of sched_setattr(2) which are not yet
+// available from golang.org/x/sys/unix.
+const (
+	SCHED_OTHER    = 0x0
+	SCHED_FIFO     = 0x1
+	SCHED_RR       = 0x2
+	SCHED_BATCH    = 0x3
+	SCHED_IDLE     = 0x5
+	SCHED_DEADLINE = 0x6
+
+	SCHED_FLAG_RESET_ON_FORK  = 0x1
+	SCHED_FLAG_RECLAIM        = 0x2
+	SCHED_FLAG_DL_OVERRUN     = 0x4
+	SCHED_FLAG_KEEP_POLICY    = 0x8
+	SCHED_FLAG_KEEP_PARAMS    = 0x10
+	SCHED_FLAG_UTIL_CLAMP_MIN = 0x20
+	SCHED_FLAG_UTIL_CLAMP_MAX = 0x40
+)
+
+// Core scheduling operations of prctl(2), which are not yet available from
+// golang.org/x/sys/unix.
+const (
+	PR_SCHED_CORE            = 62
+	PR_SCHED_CORE_GET        = 0
+	PR_SCHED_CORE_CREATE     = 1
+	PR_SCHED_CORE_SHARE_TO   = 2
+	PR_SCHED_CORE_SHARE_FROM = 3
+
+	PIDTYPE_PID  = 0
+	PIDTYPE_TGID = 1
+)
+
+// SchedAttr is struct sched_attr, used by sched_setattr(2).
+type SchedAttr struct {
+	Size     uint32
+	Policy   uint32
+	Flags    uint64
+	Nice     int32
+	Priority uint32
+	Runtime  uint64
+	Deadline uint64
+	Period   uint64
+	UtilMin  uint32
+	UtilMax  uint32
+}
+
+// SchedSetattr is a wrapper for sched_setattr(2). A pid of 0 refers to the
+// calling thread.
+func SchedSetattr(pid int, attr *SchedAttr, flags uint) error {
+	attr.Size = uint32(unsafe.Sizeof(*attr))
+	_, _, errno := unix.Syscall(unix.SYS_SCHED_SETATTR, uintptr(pid), uintptr(unsafe.Pointer(attr)), uintptr(flags))
+	if errno != 0 {
+		return os.NewSyscallError("sched_setattr", errno)
+	}
+	return nil
+}
+
+// SchedCoreCreate creates a new core scheduling cookie for all the threads of
+// the process pid. A pid of 0 refers to the calling process.
+func SchedCoreCreate(pid int) error {
+	if err := unix.Prctl(PR_SCHED_CORE, PR_SCHED_CORE_CREATE, uintptr(pid), PIDTYPE_TGID, 0); err != nil {
+		return os.NewSyscallError("prctl PR_SCHED_CORE_CREATE", err)
+	}
+	return nil
+}
+
+// SchedCoreShare copies the core scheduling cookie of the process from to all
+// the threads of the process to.
+//
+// The kernel can only copy a cookie through the calling thread, so this is
+// done in a dedicated thread, which is terminated afterwards.
+func SchedCoreShare(from, to int) error {
+	errCh := make(chan error, 1)
+	go func() {
+		// The thread is intentionally never unlocked, so that it exits
+		// along with the goroutine instead of being reused with the
+		// cookie of the other process.
+		runtime.LockOSThread()
+		if err := unix.Prctl(PR_SCHED_CORE, PR_SCHED_CORE_SHARE_FROM, uintptr(from), PIDTYPE_PID, 0); err != nil {
+			errCh <- os.NewSyscallError("prctl PR_SCHED_CORE_SHARE_FROM", err)
+			return
+		}
+		if err := unix.Prctl(PR_SCHED_CORE, PR_SCHED_CORE_SHARE_TO, uintptr(to), PIDTYPE_TGID, 0); err != nil {
+			errCh <- os.NewSyscallError("prctl PR_SCHED_CORE_SHARE_TO", err)
+			return
+		}
+		errCh <- nil
+	}()
+	return <-errCh
+}
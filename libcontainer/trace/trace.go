@@ -0,0 +1,282 @@
+// Package trace implements a minimal tracer, which records the duration of
+// the major phases of the container lifecycle as spans, and exports them to
+// an OpenTelemetry collector using the OTLP/HTTP protocol (with JSON
+// encoding), see https://opentelemetry.io/docs/specs/otlp/.
+//
+// Tracing is disabled unless enabled with Init, in which case all the spans
+// are children of a single root span, covering the runc invocation. When
+// disabled, Start returns a nil *Span, the methods of which are no-ops.
+package trace
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// EndpointEnv is the environment variable with the base URL of the OTLP
+	// collector, to which "/v1/traces" is appended.
+	EndpointEnv = "OTEL_EXPORTER_OTLP_ENDPOINT"
+	// TracesEndpointEnv is the environment variable with the URL of the OTLP
+	// traces endpoint of the collector. It takes precedence over EndpointEnv.
+	TracesEndpointEnv = "OTEL_EXPORTER_OTLP_TRACES_ENDPOINT"
+	// TraceParentEnv is the environment variable with the W3C trace context
+	// (see https://www.w3.org/TR/trace-context/#traceparent-header) of the
+	// caller, so that the root span is made part of the caller's trace.
+	TraceParentEnv = "TRACEPARENT"
+)
+
+// exportTimeout is the maximum time Shutdown waits for the collector.
+const exportTimeout = 3 * time.Second
+
+// Span is a timed operation.
+type Span struct {
+	Name       string
+	Start      time.Time
+	End        time.Time
+	Attributes map[string]string
+
+	id       string
+	parentID string
+}
+
+var (
+	mu       sync.Mutex
+	enabled  bool
+	endpoint string
+	service  string
+	traceID  string
+	root     *Span
+	spans    []*Span
+	// forward, if set, is called for every ended span instead of recording
+	// it (in runc init, to pass the spans to the parent).
+	forward func(*Span)
+)
+
+// Init enables tracing if an OTLP endpoint is configured in the environment,
+// and starts the root span, named name. The spans are exported by Shutdown.
+func Init(serviceName, name string) error {
+	url := os.Getenv(TracesEndpointEnv)
+	if url == "" {
+		if base := os.Getenv(EndpointEnv); base != "" {
+			url = strings.TrimSuffix(base, "/") + "/v1/traces"
+		}
+	}
+	if url == "" {
+		return nil
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	var parentID string
+	if tp := os.Getenv(TraceParentEnv); tp != "" {
+		var err error
+		if traceID, parentID, err = parseTraceParent(tp); err != nil {
+			return err
+		}
+	} else {
+		traceID = randomID(16)
+	}
+	enabled = true
+	endpoint = url
+	service = serviceName
+	root = &Span{Name: name, Start: time.Now(), id: randomID(8), parentID: parentID}
+	return nil
+}
+
+// InitForwarding enables tracing, passing all the ended spans to fn.
+func InitForwarding(fn func(*Span)) {
+	mu.Lock()
+	defer mu.Unlock()
+	enabled = true
+	forward = fn
+}
+
+// Enabled returns whether tracing is enabled.
+func Enabled() bool {
+	mu.Lock()
+	defer mu.Unlock()
+	return enabled
+}
+
+// Start starts a new span, named name. It returns nil if tracing is
+// disabled.
+func Start(name string) *Span {
+	if !Enabled() {
+		return nil
+	}
+	return &Span{Name: name, Start: time.Now()}
+}
+
+// SetAttribute sets the attribute key of the span to value.
+func (s *Span) SetAttribute(key, value string) {
+	if s == nil {
+		return
+	}
+	if s.Attributes == nil {
+		s.Attributes = make(map[string]string)
+	}
+	s.Attributes[key] = value
+}
+
+// Finish ends the span. Calling it more than once has no effect.
+func (s *Span) Finish() {
+	if s == nil || !s.End.IsZero() {
+		return
+	}
+	s.End = time.Now()
+	Record(s)
+}
+
+// Record records the ended span s, which may come from another process.
+func Record(s *Span) {
+	mu.Lock()
+	defer mu.Unlock()
+	if !enabled {
+		return
+	}
+	if forward != nil {
+		forward(s)
+		return
+	}
+	spans = append(spans, s)
+}
+
+// Shutdown ends the root span, and exports all the recorded spans to the
+// collector.
+func Shutdown() error {
+	mu.Lock()
+	defer mu.Unlock()
+	if !enabled || root == nil {
+		return nil
+	}
+	enabled = false
+	root.End = time.Now()
+	all := append([]*Span{root}, spans...)
+	spans = nil
+
+	data, err := json.Marshal(otlpRequest(all))
+	if err != nil {
+		return err
+	}
+	client := &http.Client{Timeout: exportTimeout}
+	resp, err := client.Post(endpoint, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("exporting spans: %w", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("exporting spans: %s", resp.Status)
+	}
+	return nil
+}
+
+// parseTraceParent returns the trace and parent span IDs of a W3C
+// traceparent header.
+func parseTraceParent(tp string) (string, string, error) {
+	parts := strings.Split(tp, "-")
+	if len(parts) < 4 || len(parts[1]) != 32 || len(parts[2]) != 16 {
+		return "", "", fmt.Errorf("invalid %s %q", TraceParentEnv, tp)
+	}
+	for _, id := range parts[1:3] {
+		if _, err := hex.DecodeString(id); err != nil || strings.Trim(id, "0") == "" {
+			return "", "", fmt.Errorf("invalid %s %q", TraceParentEnv, tp)
+		}
+	}
+	return strings.ToLower(parts[1]), strings.ToLower(parts[2]), nil
+}
+
+func randomID(n int) string {
+	b := make([]byte, n)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// The types below are the subset of the OTLP JSON encoding used to export
+// the spans.
+
+type otlpTraces struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpAttribute `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID           string          `json:"traceId"`
+	SpanID            string          `json:"spanId"`
+	ParentSpanID      string          `json:"parentSpanId,omitempty"`
+	Name              string          `json:"name"`
+	Kind              int             `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []otlpAttribute `json:"attributes,omitempty"`
+}
+
+type otlpAttribute struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpValue struct {
+	StringValue string `json:"stringValue"`
+}
+
+// spanKindInternal is SPAN_KIND_INTERNAL.
+const spanKindInternal = 1
+
+func otlpRequest(all []*Span) *otlpTraces {
+	out := make([]otlpSpan, 0, len(all))
+	for _, s := range all {
+		id, parentID := s.id, s.parentID
+		if s != root {
+			id, parentID = randomID(8), root.id
+		}
+		span := otlpSpan{
+			TraceID:           traceID,
+			SpanID:            id,
+			ParentSpanID:      parentID,
+			Name:              s.Name,
+			Kind:              spanKindInternal,
+			StartTimeUnixNano: strconv.FormatInt(s.Start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(s.End.UnixNano(), 10),
+		}
+		for k, v := range s.Attributes {
+			span.Attributes = append(span.Attributes, otlpAttribute{Key: k, Value: otlpValue{StringValue: v}})
+		}
+		out = append(out, span)
+	}
+	return &otlpTraces{ResourceSpans: []otlpResourceSpans{{
+		Resource: otlpResource{Attributes: []otlpAttribute{
+			{Key: "service.name", Value: otlpValue{StringValue: service}},
+		}},
+		ScopeSpans: []otlpScopeSpans{{
+			Scope: otlpScope{Name: "github.com/opencontainers/runc/libcontainer/trace"},
+			Spans: out,
+		}},
+	}}}
+}
@@ -0,0 +1,96 @@
+package trace
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+func TestExport(t *testing.T) {
+	var req otlpTraces
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/traces" {
+			t.Errorf("unexpected path %q", r.URL.Path)
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Error(err)
+		}
+	}))
+	defer srv.Close()
+
+	const (
+		traceID  = "4bf92f3577b34da6a3ce929d0e0e4736"
+		parentID = "00f067aa0ba902b7"
+	)
+	os.Setenv(EndpointEnv, srv.URL+"/")
+	os.Setenv(TraceParentEnv, "00-"+traceID+"-"+parentID+"-01")
+	defer os.Unsetenv(EndpointEnv)
+	defer os.Unsetenv(TraceParentEnv)
+
+	if err := Init("runc", "runc run"); err != nil {
+		t.Fatal(err)
+	}
+	if !Enabled() {
+		t.Fatal("tracing not enabled")
+	}
+	span := Start("cgroup apply")
+	span.SetAttribute("cgroup.path", "/sys/fs/cgroup/test")
+	span.Finish()
+	span.Finish()
+	if err := Shutdown(); err != nil {
+		t.Fatal(err)
+	}
+	if Enabled() || Start("after shutdown") != nil {
+		t.Fatal("tracing still enabled after shutdown")
+	}
+
+	if len(req.ResourceSpans) != 1 || len(req.ResourceSpans[0].ScopeSpans) != 1 {
+		t.Fatalf("unexpected request %+v", req)
+	}
+	spans := req.ResourceSpans[0].ScopeSpans[0].Spans
+	if len(spans) != 2 {
+		t.Fatalf("expected 2 spans, got %+v", spans)
+	}
+	root, child := spans[0], spans[1]
+	if root.Name != "runc run" || root.TraceID != traceID || root.ParentSpanID != parentID {
+		t.Errorf("unexpected root span %+v", root)
+	}
+	if child.Name != "cgroup apply" || child.TraceID != traceID || child.ParentSpanID != root.SpanID {
+		t.Errorf("unexpected span %+v", child)
+	}
+	if len(child.Attributes) != 1 || child.Attributes[0].Value.StringValue != "/sys/fs/cgroup/test" {
+		t.Errorf("unexpected attributes %+v", child.Attributes)
+	}
+}
+
+func TestDisabled(t *testing.T) {
+	if err := Init("runc", "runc run"); err != nil {
+		t.Fatal(err)
+	}
+	span := Start("nothing")
+	if span != nil {
+		t.Fatal("expected a nil span")
+	}
+	// The methods of a nil span are no-ops.
+	span.SetAttribute("key", "value")
+	span.Finish()
+	if err := Shutdown(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestParseTraceParent(t *testing.T) {
+	for _, tp := range []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736",
+		"00-4bf92f3577b34da6a3ce929d0e0e473-00f067aa0ba902b7-01",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-xxf067aa0ba902b7-01",
+	} {
+		if _, _, err := parseTraceParent(tp); err == nil {
+			t.Errorf("%q: expected an error", tp)
+		}
+	}
+}
@@ -2,6 +2,7 @@ package user
 
 import (
 	"bufio"
+	"bytes"
 	"errors"
 	"fmt"
 	"io"
@@ -13,6 +14,12 @@ import (
 const (
 	minId = 0
 	maxId = 1<<31 - 1 //for 32-bit systems compatibility
+
+	// maxLineLen is the maximum length of a line of passwd- or
+	// group-formatted data. Longer lines, such as the ones of groups with
+	// huge member lists in dumps of LDAP directories, are skipped rather
+	// than failing the parsing of the whole file.
+	maxLineLen = 1 << 20
 )
 
 var (
@@ -97,6 +104,85 @@ func parseParts(parts []string, v ...interface{}) {
 	}
 }
 
+// scanLines calls fn for each line of r (without the line terminator) until
+// fn returns false. Lines longer than maxLineLen are skipped. The line is
+// only valid until fn returns.
+func scanLines(r io.Reader, fn func(line []byte) bool) error {
+	var (
+		br   = bufio.NewReader(r)
+		long []byte
+		skip bool
+	)
+	for {
+		frag, err := br.ReadSlice('\n')
+		if err == bufio.ErrBufferFull {
+			// The line does not fit in the buffer, accumulate it.
+			if !skip {
+				long = append(long, frag...)
+				skip = len(long) > maxLineLen
+			}
+			continue
+		}
+		line := frag
+		if len(long) != 0 {
+			line = append(long, frag...)
+		}
+		if !skip && len(line) <= maxLineLen {
+			line = bytes.TrimSuffix(line, []byte{'\n'})
+			line = bytes.TrimSuffix(line, []byte{'\r'})
+			if !fn(line) {
+				return nil
+			}
+		}
+		long, skip = long[:0], false
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+	}
+}
+
+// field returns the n-th (starting from 0) colon-separated field of line,
+// without parsing the other ones.
+func field(line []byte, n int) []byte {
+	for ; n > 0; n-- {
+		i := bytes.IndexByte(line, ':')
+		if i < 0 {
+			return nil
+		}
+		line = line[i+1:]
+	}
+	if i := bytes.IndexByte(line, ':'); i >= 0 {
+		line = line[:i]
+	}
+	return line
+}
+
+// fieldInt returns the n-th colon-separated field of line as a number, with
+// conversion errors ignored (like parseLine does).
+func fieldInt(line []byte, n int) int {
+	i, _ := strconv.Atoi(string(field(line, n)))
+	return i
+}
+
+// hasMember returns whether name is in the comma-separated list.
+func hasMember(list []byte, name string) bool {
+	for len(list) != 0 {
+		var m []byte
+		if i := bytes.IndexByte(list, ','); i >= 0 {
+			m, list = list[:i], list[i+1:]
+		} else {
+			m, list = list, nil
+		}
+		if string(m) == name {
+			return true
+		}
+	}
+	return false
+}
+
 func ParsePasswdFile(path string) ([]User, error) {
 	passwd, err := os.Open(path)
 	if err != nil {
@@ -124,36 +210,38 @@ func ParsePasswdFilter(r io.Reader, filter func(User) bool) ([]User, error) {
 		return nil, fmt.Errorf("nil source for passwd-formatted data")
 	}
 
-	var (
-		s   = bufio.NewScanner(r)
-		out = []User{}
-	)
-
-	for s.Scan() {
-		line := strings.TrimSpace(s.Text())
-		if line == "" {
-			continue
-		}
-
-		// see: man 5 passwd
-		//  name:password:UID:GID:GECOS:directory:shell
-		// Name:Pass:Uid:Gid:Gecos:Home:Shell
-		//  root:x:0:0:root:/root:/bin/bash
-		//  adm:x:3:4:adm:/var/adm:/bin/false
-		p := User{}
-		parseLine(line, &p.Name, &p.Pass, &p.Uid, &p.Gid, &p.Gecos, &p.Home, &p.Shell)
-
-		if filter == nil || filter(p) {
+	out := []User{}
+	err := scanLines(r, func(line []byte) bool {
+		if p, ok := parseUser(line); ok && (filter == nil || filter(p)) {
 			out = append(out, p)
 		}
-	}
-	if err := s.Err(); err != nil {
+		return true
+	})
+	if err != nil {
 		return nil, err
 	}
 
 	return out, nil
 }
 
+// parseUser parses a line of passwd-formatted data, returning false if the
+// line is blank.
+func parseUser(line []byte) (User, bool) {
+	line = bytes.TrimSpace(line)
+	if len(line) == 0 {
+		return User{}, false
+	}
+
+	// see: man 5 passwd
+	//  name:password:UID:GID:GECOS:directory:shell
+	// Name:Pass:Uid:Gid:Gecos:Home:Shell
+	//  root:x:0:0:root:/root:/bin/bash
+	//  adm:x:3:4:adm:/var/adm:/bin/false
+	p := User{}
+	parseLine(string(line), &p.Name, &p.Pass, &p.Uid, &p.Gid, &p.Gecos, &p.Home, &p.Shell)
+	return p, true
+}
+
 func ParseGroupFile(path string) ([]Group, error) {
 	group, err := os.Open(path)
 	if err != nil {
@@ -182,36 +270,37 @@ func ParseGroupFilter(r io.Reader, filter func(Group) bool) ([]Group, error) {
 		return nil, fmt.Errorf("nil source for group-formatted data")
 	}
 
-	var (
-		s   = bufio.NewScanner(r)
-		out = []Group{}
-	)
-
-	for s.Scan() {
-		text := s.Text()
-		if text == "" {
-			continue
-		}
-
-		// see: man 5 group
-		//  group_name:password:GID:user_list
-		// Name:Pass:Gid:List
-		//  root:x:0:root
-		//  adm:x:4:root,adm,daemon
-		p := Group{}
-		parseLine(text, &p.Name, &p.Pass, &p.Gid, &p.List)
-
-		if filter == nil || filter(p) {
+	out := []Group{}
+	err := scanLines(r, func(line []byte) bool {
+		if p, ok := parseGroup(line); ok && (filter == nil || filter(p)) {
 			out = append(out, p)
 		}
-	}
-	if err := s.Err(); err != nil {
+		return true
+	})
+	if err != nil {
 		return nil, err
 	}
 
 	return out, nil
 }
 
+// parseGroup parses a line of group-formatted data, returning false if the
+// line is empty.
+func parseGroup(line []byte) (Group, bool) {
+	if len(line) == 0 {
+		return Group{}, false
+	}
+
+	// see: man 5 group
+	//  group_name:password:GID:user_list
+	// Name:Pass:Gid:List
+	//  root:x:0:root
+	//  adm:x:4:root,adm,daemon
+	p := Group{}
+	parseLine(string(line), &p.Name, &p.Pass, &p.Gid, &p.List)
+	return p, true
+}
+
 type ExecUser struct {
 	Uid   int
 	Gid   int
@@ -287,27 +376,41 @@ func GetExecUser(userSpec string, defaults *ExecUser, passwd, group io.Reader) (
 	uidArg, uidErr := strconv.Atoi(userArg)
 	gidArg, gidErr := strconv.Atoi(groupArg)
 
-	// Find the matching user.
-	users, err := ParsePasswdFilter(passwd, func(u User) bool {
-		if userArg == "" {
-			// Default to current state of the user.
-			return u.Uid == user.Uid
-		}
-
-		if uidErr == nil {
-			// If the userArg is numeric, always treat it as a UID.
-			return uidArg == u.Uid
-		}
-
-		return u.Name == userArg
-	})
-
-	// If we can't find the user, we have to bail.
-	if err != nil && passwd != nil {
-		if userArg == "" {
-			userArg = strconv.Itoa(user.Uid)
+	// Find the matching user. Only the first matching entry is parsed, and
+	// the rest of the file is not read.
+	var users []User
+	if passwd != nil {
+		err := scanLines(passwd, func(line []byte) bool {
+			line = bytes.TrimSpace(line)
+			switch {
+			case userArg == "":
+				// Default to current state of the user.
+				if fieldInt(line, 2) != user.Uid {
+					return true
+				}
+			case uidErr == nil:
+				// If the userArg is numeric, always treat it as a UID.
+				if fieldInt(line, 2) != uidArg {
+					return true
+				}
+			default:
+				if string(field(line, 0)) != userArg {
+					return true
+				}
+			}
+			if u, ok := parseUser(line); ok {
+				users = append(users, u)
+				return false
+			}
+			return true
+		})
+		// If we can't find the user, we have to bail.
+		if err != nil {
+			if userArg == "" {
+				userArg = strconv.Itoa(user.Uid)
+			}
+			return nil, fmt.Errorf("unable to find user %s: %v", userArg, err)
 		}
-		return nil, fmt.Errorf("unable to find user %s: %v", userArg, err)
 	}
 
 	var matchedUserName string
@@ -338,27 +441,37 @@ func GetExecUser(userSpec string, defaults *ExecUser, passwd, group io.Reader) (
 	// On to the groups. If we matched a username, we need to do this because of
 	// the supplementary group IDs.
 	if groupArg != "" || matchedUserName != "" {
-		groups, err := ParseGroupFilter(group, func(g Group) bool {
-			// If the group argument isn't explicit, we'll just search for it.
-			if groupArg == "" {
-				// Check if user is a member of this group.
-				for _, u := range g.List {
-					if u == matchedUserName {
+		// Only the matching entries are parsed. If the group is explicit,
+		// the first match wins, so the rest of the file is not read.
+		var groups []Group
+		if group != nil {
+			err := scanLines(group, func(line []byte) bool {
+				switch {
+				case groupArg == "":
+					// If the group argument isn't explicit, we'll just search
+					// for the groups the user is a member of.
+					if !hasMember(field(line, 3), matchedUserName) {
+						return true
+					}
+				case gidErr == nil:
+					// If the groupArg is numeric, always treat it as a GID.
+					if fieldInt(line, 2) != gidArg {
+						return true
+					}
+				default:
+					if string(field(line, 0)) != groupArg {
 						return true
 					}
 				}
-				return false
-			}
-
-			if gidErr == nil {
-				// If the groupArg is numeric, always treat it as a GID.
-				return gidArg == g.Gid
+				if g, ok := parseGroup(line); ok {
+					groups = append(groups, g)
+					return groupArg == ""
+				}
+				return true
+			})
+			if err != nil {
+				return nil, fmt.Errorf("unable to find groups for spec %v: %v", matchedUserName, err)
 			}
-
-			return g.Name == groupArg
-		})
-		if err != nil && group != nil {
-			return nil, fmt.Errorf("unable to find groups for spec %v: %v", matchedUserName, err)
 		}
 
 		// Only start modifying user.Gid if it is in explicit form.
@@ -401,19 +514,39 @@ func GetExecUser(userSpec string, defaults *ExecUser, passwd, group io.Reader) (
 // or the given group data is nil, the id will be returned as-is
 // provided it is in the legal range.
 func GetAdditionalGroups(additionalGroups []string, group io.Reader) ([]int, error) {
+	gids, unknown, err := LookupAdditionalGroups(additionalGroups, group)
+	if err != nil {
+		return nil, err
+	}
+	if len(unknown) != 0 {
+		return nil, fmt.Errorf("Unable to find group %s", unknown[0])
+	}
+	return gids, nil
+}
+
+// LookupAdditionalGroups is like GetAdditionalGroups, except that the names
+// of the groups which cannot be found are returned rather than causing an
+// error. This allows callers to treat them as a warning, as such groups may
+// only be known to NSS modules on the host (such as LDAP), which are not
+// used here.
+func LookupAdditionalGroups(additionalGroups []string, group io.Reader) (gids []int, unknown []string, _ error) {
 	var groups = []Group{}
 	if group != nil {
-		var err error
-		groups, err = ParseGroupFilter(group, func(g Group) bool {
+		// Only parse the entries matching one of the groups.
+		err := scanLines(group, func(line []byte) bool {
+			name, gid := field(line, 0), strconv.Itoa(fieldInt(line, 2))
 			for _, ag := range additionalGroups {
-				if g.Name == ag || strconv.Itoa(g.Gid) == ag {
-					return true
+				if string(name) == ag || gid == ag {
+					if g, ok := parseGroup(line); ok {
+						groups = append(groups, g)
+					}
+					break
 				}
 			}
-			return false
+			return true
 		})
 		if err != nil {
-			return nil, fmt.Errorf("Unable to find additional groups %v: %v", additionalGroups, err)
+			return nil, nil, fmt.Errorf("Unable to find additional groups %v: %v", additionalGroups, err)
 		}
 	}
 
@@ -436,20 +569,21 @@ func GetAdditionalGroups(additionalGroups []string, group io.Reader) ([]int, err
 		if !found {
 			gid, err := strconv.ParseInt(ag, 10, 64)
 			if err != nil {
-				return nil, fmt.Errorf("Unable to find group %s", ag)
+				unknown = append(unknown, ag)
+				continue
 			}
 			// Ensure gid is inside gid range.
 			if gid < minId || gid > maxId {
-				return nil, ErrRange
+				return nil, nil, ErrRange
 			}
 			gidMap[int(gid)] = struct{}{}
 		}
 	}
-	gids := []int{}
+	gids = []int{}
 	for gid := range gidMap {
 		gids = append(gids, gid)
 	}
-	return gids, nil
+	return gids, unknown, nil
 }
 
 // GetAdditionalGroupsPath is a wrapper around GetAdditionalGroups
@@ -465,6 +599,18 @@ func GetAdditionalGroupsPath(additionalGroups []string, groupPath string) ([]int
 	return GetAdditionalGroups(additionalGroups, group)
 }
 
+// LookupAdditionalGroupsPath is like GetAdditionalGroupsPath, but uses
+// LookupAdditionalGroups.
+func LookupAdditionalGroupsPath(additionalGroups []string, groupPath string) ([]int, []string, error) {
+	var group io.Reader
+
+	if groupFile, err := os.Open(groupPath); err == nil {
+		group = groupFile
+		defer groupFile.Close()
+	}
+	return LookupAdditionalGroups(additionalGroups, group)
+}
+
 func ParseSubIDFile(path string) ([]SubID, error) {
 	subid, err := os.Open(path)
 	if err != nil {
@@ -97,6 +97,37 @@ this is just some garbage data
 	}
 }
 
+func TestUserParseGroupLongLine(t *testing.T) {
+	members := strings.Repeat("member,", maxLineLen/len("member,")+1)
+	groups, err := ParseGroupFilter(strings.NewReader(`root:x:0:root
+huge:x:1000:`+members+`
+adm:x:4:root,adm,daemon
+`), nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(groups) != 2 || groups[0].Name != "root" || groups[1].Name != "adm" {
+		t.Fatalf("Expected the root and adm groups only, got %+v", groups)
+	}
+}
+
+func TestGetExecUserLongLines(t *testing.T) {
+	// Lines longer than the buffer of the reader, but not than maxLineLen.
+	gecos := strings.Repeat("g", 100000)
+	members := strings.Repeat("member,", 20000)
+	passwd := strings.NewReader("root:x:0:0:" + gecos + ":/root:/bin/sh\nadm:x:42:43:" + gecos + ":/var/adm:/bin/false\n")
+	group := strings.NewReader("grp:x:1234:" + members + "adm\nroot:x:0:root\n")
+
+	execUser, err := GetExecUser("adm", nil, passwd, group)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := ExecUser{Uid: 42, Gid: 43, Sgids: []int{1234}, Home: "/var/adm"}
+	if !reflect.DeepEqual(*execUser, expected) {
+		t.Errorf("expected %+v, got %+v", expected, *execUser)
+	}
+}
+
 func TestValidGetExecUser(t *testing.T) {
 	const passwdContent = `
 root:x:0:0:root user:/root:/bin/bash
@@ -500,3 +531,21 @@ func TestGetAdditionalGroupsNumeric(t *testing.T) {
 		}
 	}
 }
+
+func TestLookupAdditionalGroups(t *testing.T) {
+	const groupContent = `
+root:x:0:root
+adm:x:43:
+`
+	gids, unknown, err := LookupAdditionalGroups([]string{"ldap-users", "adm", "1234", "ldap-admins"}, strings.NewReader(groupContent))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Ints(gids)
+	if !reflect.DeepEqual(gids, []int{43, 1234}) {
+		t.Errorf("expected gids [43 1234], got %v", gids)
+	}
+	if !reflect.DeepEqual(unknown, []string{"ldap-users", "ldap-admins"}) {
+		t.Errorf("expected unknown groups [ldap-users ldap-admins], got %v", unknown)
+	}
+}
@@ -0,0 +1,165 @@
+package libcontainer
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/opencontainers/runc/libcontainer/configs"
+	"github.com/opencontainers/runc/libcontainer/user"
+	"github.com/syndtr/gocapability/capability"
+)
+
+// maxIDMapRanges is the maximum number of ranges of the uid_map and gid_map
+// files, since Linux 4.15.
+const maxIDMapRanges = 340
+
+// idMapWriter describes who writes an ID mapping file of the user namespace
+// of a container, which decides the mappings the kernel permits.
+type idMapWriter struct {
+	// kind is the kind of the IDs mapped, "uid" or "gid".
+	kind string
+	// id is the effective ID of runc.
+	id int
+	// capable is whether runc has CAP_SETUID (CAP_SETGID) in its user
+	// namespace, allowing it to map any ID mapped in it.
+	capable bool
+	// single is whether a mapping of the effective ID alone is permitted
+	// without capabilities.
+	single bool
+	// tool is the path of newuidmap (newgidmap), used to map the IDs
+	// delegated to the user when the mapping can't be written directly.
+	tool string
+}
+
+// checkIDMappings returns an error if the mappings of the user namespace of
+// the container of config can't be set up, rather than letting the write to
+// the uid_map or gid_map file fail with a bare EPERM or EINVAL. The mappings
+// are written directly when runc has CAP_SETUID (CAP_SETGID) in its user
+// namespace, so that newuidmap and newgidmap are only required without it.
+func checkIDMappings(config *configs.Config, newuidmapPath, newgidmapPath string) error {
+	caps, err := capability.NewPid2(0)
+	if err != nil {
+		return err
+	}
+	if err := caps.Load(); err != nil {
+		return err
+	}
+	if !config.RootlessEUID {
+		// The mapping tools are only used for rootless containers.
+		newuidmapPath, newgidmapPath = "", ""
+	}
+	if len(config.UidMappings) > 0 {
+		current, err := user.CurrentProcessUIDMap()
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		w := idMapWriter{
+			kind:    "uid",
+			id:      os.Geteuid(),
+			capable: caps.Get(capability.EFFECTIVE, capability.CAP_SETUID),
+			single:  true,
+			tool:    newuidmapPath,
+		}
+		if err := w.check(config.UidMappings, current); err != nil {
+			return err
+		}
+	}
+	if len(config.GidMappings) > 0 {
+		current, err := user.CurrentProcessGIDMap()
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		w := idMapWriter{
+			kind:    "gid",
+			id:      os.Getegid(),
+			capable: caps.Get(capability.EFFECTIVE, capability.CAP_SETGID),
+			// The kernel requires setgroups(2) to be denied, which is
+			// only done for rootless containers.
+			single: config.RootlessEUID,
+			tool:   newgidmapPath,
+		}
+		if err := w.check(config.GidMappings, current); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// check returns an error if the mappings are invalid, or are not permitted
+// for w, with current the mappings of the user namespace of runc.
+func (w idMapWriter) check(mappings []configs.IDMap, current []user.IDMap) error {
+	if len(mappings) > maxIDMapRanges {
+		return fmt.Errorf("too many %s mappings: %d, the maximum is %d", w.kind, len(mappings), maxIDMapRanges)
+	}
+	for i, m := range mappings {
+		if m.Size <= 0 || m.ContainerID < 0 || m.HostID < 0 {
+			return fmt.Errorf("invalid %s mapping %s", w.kind, formatIDMap(m))
+		}
+		for _, o := range mappings[:i] {
+			if overlaps(m.ContainerID, m.Size, o.ContainerID, o.Size) {
+				return fmt.Errorf("the container %ss of the mappings %s and %s overlap", w.kind, formatIDMap(o), formatIDMap(m))
+			}
+			if overlaps(m.HostID, m.Size, o.HostID, o.Size) {
+				return fmt.Errorf("the host %ss of the mappings %s and %s overlap", w.kind, formatIDMap(o), formatIDMap(m))
+			}
+		}
+		if current != nil && !idRangeMapped(int64(m.HostID), int64(m.Size), current) {
+			return fmt.Errorf("the host %ss of the mapping %s are not all mapped in the user namespace of runc, which maps %s",
+				w.kind, formatIDMap(m), formatCurrentIDMap(current))
+		}
+	}
+
+	if w.capable || w.tool != "" {
+		return nil
+	}
+	if w.single && len(mappings) == 1 && mappings[0].Size == 1 && mappings[0].HostID == w.id {
+		return nil
+	}
+	capName, tool := "CAP_SETUID", "newuidmap"
+	if w.kind == "gid" {
+		capName, tool = "CAP_SETGID", "newgidmap"
+	}
+	if !w.single {
+		return fmt.Errorf("the %s mappings require %s in the user namespace of runc", w.kind, capName)
+	}
+	return fmt.Errorf("mapping the %ss other than the effective %s %d alone requires either %s in the user namespace of runc, or %s to be installed",
+		w.kind, w.kind, w.id, capName, tool)
+}
+
+func overlaps(a, aSize, b, bSize int) bool {
+	return a < b+bSize && b < a+aSize
+}
+
+// idRangeMapped returns whether all the IDs from id to id+size-1 are mapped by
+// the ranges.
+func idRangeMapped(id, size int64, ranges []user.IDMap) bool {
+	sorted := append([]user.IDMap(nil), ranges...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].ID < sorted[j].ID })
+	end := id + size
+	for _, r := range sorted {
+		if id >= end {
+			break
+		}
+		if id >= r.ID && id < r.ID+r.Count {
+			id = r.ID + r.Count
+		}
+	}
+	return id >= end
+}
+
+func formatIDMap(m configs.IDMap) string {
+	return fmt.Sprintf("%d:%d:%d", m.ContainerID, m.HostID, m.Size)
+}
+
+func formatCurrentIDMap(ranges []user.IDMap) string {
+	if len(ranges) == 0 {
+		return "no IDs"
+	}
+	var s []string
+	for _, r := range ranges {
+		s = append(s, fmt.Sprintf("%d-%d", r.ID, r.ID+r.Count-1))
+	}
+	return strings.Join(s, ", ")
+}
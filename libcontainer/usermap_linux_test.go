@@ -0,0 +1,91 @@
+// +build linux
+
+package libcontainer
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/opencontainers/runc/libcontainer/configs"
+	"github.com/opencontainers/runc/libcontainer/user"
+)
+
+func TestIDMapWriterCheck(t *testing.T) {
+	current := []user.IDMap{
+		{ID: 0, ParentID: 1000, Count: 1},
+		{ID: 1, ParentID: 100000, Count: 65536},
+	}
+	single := []configs.IDMap{{ContainerID: 0, HostID: 1000, Size: 1}}
+	multi := []configs.IDMap{
+		{ContainerID: 0, HostID: 0, Size: 1},
+		{ContainerID: 1, HostID: 1, Size: 65536},
+	}
+
+	for _, tc := range []struct {
+		name     string
+		w        idMapWriter
+		mappings []configs.IDMap
+		current  []user.IDMap
+		err      string
+	}{
+		{
+			name:     "single mapping of the effective uid",
+			w:        idMapWriter{kind: "uid", id: 1000, single: true},
+			mappings: single,
+		},
+		{
+			name:     "single gid mapping with setgroups allowed",
+			w:        idMapWriter{kind: "gid", id: 1000},
+			mappings: single,
+			err:      "require CAP_SETGID",
+		},
+		{
+			name:     "multiple ranges without capabilities",
+			w:        idMapWriter{kind: "uid", id: 1000, single: true},
+			mappings: multi,
+			err:      "requires either CAP_SETUID in the user namespace of runc, or newuidmap",
+		},
+		{
+			name:     "multiple ranges with capabilities",
+			w:        idMapWriter{kind: "uid", capable: true},
+			mappings: multi,
+			current:  current,
+		},
+		{
+			name:     "multiple ranges with the mapping tool",
+			w:        idMapWriter{kind: "uid", id: 1000, single: true, tool: "/usr/bin/newuidmap"},
+			mappings: multi,
+		},
+		{
+			name:     "ranges exceeding the current mappings",
+			w:        idMapWriter{kind: "uid", capable: true},
+			mappings: []configs.IDMap{{ContainerID: 0, HostID: 0, Size: 65538}},
+			current:  current,
+			err:      "are not all mapped in the user namespace of runc, which maps 0-0, 1-65536",
+		},
+		{
+			name: "overlapping ranges",
+			w:    idMapWriter{kind: "uid", capable: true},
+			mappings: []configs.IDMap{
+				{ContainerID: 0, HostID: 0, Size: 10},
+				{ContainerID: 5, HostID: 100, Size: 10},
+			},
+			err: "the container uids of the mappings 0:0:10 and 5:100:10 overlap",
+		},
+		{
+			name:     "empty range",
+			w:        idMapWriter{kind: "uid", capable: true},
+			mappings: []configs.IDMap{{ContainerID: 0, HostID: 0, Size: 0}},
+			err:      "invalid uid mapping 0:0:0",
+		},
+	} {
+		err := tc.w.check(tc.mappings, tc.current)
+		if tc.err == "" {
+			if err != nil {
+				t.Errorf("%s: unexpected error: %v", tc.name, err)
+			}
+		} else if err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Errorf("%s: expected an error containing %q, got %v", tc.name, tc.err, err)
+		}
+	}
+}
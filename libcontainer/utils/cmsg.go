@@ -19,6 +19,7 @@ package utils
  */
 
 import (
+	"errors"
 	"fmt"
 	"os"
 
@@ -35,10 +36,27 @@ const MaxNameLen = 4096
 // so sizeof(fd) = 4.
 var oobSpace = unix.CmsgSpace(4)
 
+// ConsoleAttachRequest is the message sent, without any file descriptor, by
+// runc attach over a new connection to the console socket of a container, to
+// request a terminal to the container. A console socket receiver supporting
+// it replies with the master of a terminal, using SendFd; this can be a new
+// terminal, which the receiver multiplexes with the one of the container.
+const ConsoleAttachRequest = "runc-console-attach"
+
 // RecvFd waits for a file descriptor to be sent over the given AF_UNIX
 // socket. The file name of the remote file descriptor will be recreated
 // locally (it is sent as non-auxiliary data in the same payload).
 func RecvFd(socket *os.File) (*os.File, error) {
+	file, _, err := RecvFdOrMessage(socket)
+	if err == nil && file == nil {
+		err = errors.New("recvfd: no file descriptor received")
+	}
+	return file, err
+}
+
+// RecvFdOrMessage is like RecvFd, except that if a message is sent without
+// any file descriptor, it is returned as msg (with a nil file).
+func RecvFdOrMessage(socket *os.File) (file *os.File, msg string, err error) {
 	// For some reason, unix.Recvmsg uses the length rather than the capacity
 	// when passing the msg_controllen and other attributes to recvmsg.  So we
 	// have to actually set the length.
@@ -48,36 +66,46 @@ func RecvFd(socket *os.File) (*os.File, error) {
 	sockfd := socket.Fd()
 	n, oobn, _, _, err := unix.Recvmsg(int(sockfd), name, oob, 0)
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
 
-	if n >= MaxNameLen || oobn != oobSpace {
-		return nil, fmt.Errorf("recvfd: incorrect number of bytes read (n=%d oobn=%d)", n, oobn)
+	if n >= MaxNameLen || (oobn != 0 && oobn != oobSpace) {
+		return nil, "", fmt.Errorf("recvfd: incorrect number of bytes read (n=%d oobn=%d)", n, oobn)
 	}
 
 	// Truncate.
 	name = name[:n]
 	oob = oob[:oobn]
+	if oobn == 0 {
+		return nil, string(name), nil
+	}
 
+	fd, err := parseFd(oob)
+	if err != nil {
+		return nil, "", err
+	}
+	return os.NewFile(fd, string(name)), "", nil
+}
+
+// parseFd returns the file descriptor of the socket control message oob.
+func parseFd(oob []byte) (uintptr, error) {
 	scms, err := unix.ParseSocketControlMessage(oob)
 	if err != nil {
-		return nil, err
+		return 0, err
 	}
 	if len(scms) != 1 {
-		return nil, fmt.Errorf("recvfd: number of SCMs is not 1: %d", len(scms))
+		return 0, fmt.Errorf("recvfd: number of SCMs is not 1: %d", len(scms))
 	}
 	scm := scms[0]
 
 	fds, err := unix.ParseUnixRights(&scm)
 	if err != nil {
-		return nil, err
+		return 0, err
 	}
 	if len(fds) != 1 {
-		return nil, fmt.Errorf("recvfd: number of fds is not 1: %d", len(fds))
+		return 0, fmt.Errorf("recvfd: number of fds is not 1: %d", len(fds))
 	}
-	fd := uintptr(fds[0])
-
-	return os.NewFile(fd, string(name)), nil
+	return uintptr(fds[0]), nil
 }
 
 // SendFd sends a file descriptor over the given AF_UNIX socket. In
@@ -0,0 +1,45 @@
+package utils
+
+import (
+	"os"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestRecvFdOrMessage(t *testing.T) {
+	fds, err := unix.Socketpair(unix.AF_UNIX, unix.SOCK_STREAM|unix.SOCK_CLOEXEC, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	local := os.NewFile(uintptr(fds[0]), "local")
+	defer local.Close()
+	remote := os.NewFile(uintptr(fds[1]), "remote")
+	defer remote.Close()
+
+	if _, err := remote.Write([]byte(ConsoleAttachRequest)); err != nil {
+		t.Fatal(err)
+	}
+	file, msg, err := RecvFdOrMessage(local)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if file != nil || msg != ConsoleAttachRequest {
+		t.Fatalf("expected message %q, got %q (file %v)", ConsoleAttachRequest, msg, file)
+	}
+
+	if err := SendFd(remote, "stdin", os.Stdin.Fd()); err != nil {
+		t.Fatal(err)
+	}
+	file, msg, err = RecvFdOrMessage(local)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if file == nil || msg != "" {
+		t.Fatalf("expected a file, got message %q", msg)
+	}
+	defer file.Close()
+	if file.Name() != "stdin" {
+		t.Fatalf("expected file name %q, got %q", "stdin", file.Name())
+	}
+}
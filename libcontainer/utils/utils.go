@@ -157,9 +157,14 @@ func SearchLabels(labels []string, query string) string {
 	return ""
 }
 
+// ConsoleSocketLabel is the label recording the path of the console socket
+// of a container, see ConsoleAttachRequest. It is reserved for runc, the
+// annotations of the spec can't use it.
+const ConsoleSocketLabel = "org.opencontainers.runc.internal.consoleSocket"
+
 // Annotations returns the bundle path and user defined annotations from the
 // libcontainer state.  We need to remove the bundle because that is a label
-// added by libcontainer.
+// added by libcontainer, as well as the console socket, added by runc.
 func Annotations(labels []string) (bundle string, userAnnotations map[string]string) {
 	userAnnotations = make(map[string]string)
 	for _, l := range labels {
@@ -167,9 +172,11 @@ func Annotations(labels []string) (bundle string, userAnnotations map[string]str
 		if len(parts) < 2 {
 			continue
 		}
-		if parts[0] == "bundle" {
+		switch parts[0] {
+		case "bundle":
 			bundle = parts[1]
-		} else {
+		case ConsoleSocketLabel:
+		default:
 			userAnnotations[parts[0]] = parts[1]
 		}
 	}
@@ -30,6 +30,18 @@ func TestSearchLabels(t *testing.T) {
 	}
 }
 
+func TestAnnotations(t *testing.T) {
+	labels := []string{"console-socket=/user", "bundle=/bundle", ConsoleSocketLabel + "=/run/sock"}
+	bundle, annotations := Annotations(labels)
+	if bundle != "/bundle" {
+		t.Errorf("expected bundle /bundle, got %q", bundle)
+	}
+	// The labels of runc are not annotations of the user.
+	if len(annotations) != 1 || annotations["console-socket"] != "/user" {
+		t.Errorf("expected the console-socket annotation only, got %v", annotations)
+	}
+}
+
 func TestResolveRootfs(t *testing.T) {
 	dir := "rootfs"
 	if err := os.Mkdir(dir, 0600); err != nil {
@@ -5,22 +5,25 @@ package main
 import (
 	"errors"
 	"fmt"
-	"io/ioutil"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
 	"syscall"
 	"text/tabwriter"
+	"text/template"
 	"time"
 
 	"encoding/json"
 
 	"github.com/opencontainers/runc/libcontainer"
+	"github.com/opencontainers/runc/libcontainer/configs"
 	"github.com/opencontainers/runc/libcontainer/user"
 	"github.com/opencontainers/runc/libcontainer/utils"
 	"github.com/urfave/cli"
 )
 
-const formatOptions = `table or json`
+const formatOptions = `table, json or a Go template`
 
 // containerState represents the platform agnostic pieces relating to a
 // running container's status and state
@@ -43,6 +46,8 @@ type containerState struct {
 	Annotations map[string]string `json:"annotations,omitempty"`
 	// The owner of the state directory (the owner of the container).
 	Owner string `json:"owner"`
+	// Hooks are the results of the hooks run by runc (only set by runc state).
+	Hooks []configs.HookResult `json:"hooks,omitempty"`
 }
 
 var listCommand = cli.Command{
@@ -59,7 +64,13 @@ To list containers created via the default "--root":
 
 EXAMPLE 2:
 To list containers created using a non-default value for "--root":
-       # runc --root value list`,
+       # runc --root value list
+
+EXAMPLE 3:
+To list the IDs and bundles of the running and paused containers, from the
+most recently created one:
+       # runc list --filter status=running --filter status=paused \
+               --sort created --format '{{.ID}} {{.Bundle}}'`,
 	Flags: []cli.Flag{
 		cli.StringFlag{
 			Name:  "format, f",
@@ -70,11 +81,39 @@ To list containers created using a non-default value for "--root":
 			Name:  "quiet, q",
 			Usage: "display only container IDs",
 		},
+		cli.StringSliceFlag{
+			Name:  "filter",
+			Usage: "only list the containers matching the filter: status=<status>, annotation=<key>[=<value>] or bundle=<path prefix> (the containers must match one of the filters with each key)",
+		},
+		cli.StringFlag{
+			Name:  "sort",
+			Value: "id",
+			Usage: "sort the containers by id, pid, status, bundle, owner or created (most recent first)",
+		},
 	},
 	Action: func(context *cli.Context) error {
 		if err := checkArgs(context, 0, exactArgs); err != nil {
 			return err
 		}
+		var tmpl *template.Template
+		switch format := context.String("format"); format {
+		case "table", "json":
+		default:
+			// Don't take a misspelled format for a template.
+			if !strings.Contains(format, "{{") {
+				return errors.New("invalid format option")
+			}
+			var err error
+			tmpl, err = template.New("").Funcs(template.FuncMap{
+				"json": func(v interface{}) (string, error) {
+					b, err := json.Marshal(v)
+					return string(b), err
+				},
+			}).Parse(format + "\n")
+			if err != nil {
+				return fmt.Errorf("invalid format option: %w", err)
+			}
+		}
 		s, err := getContainers(context)
 		if err != nil {
 			return err
@@ -108,13 +147,88 @@ To list containers created using a non-default value for "--root":
 				return err
 			}
 		default:
-			return errors.New("invalid format option")
+			for _, item := range s {
+				if err := tmpl.Execute(os.Stdout, item); err != nil {
+					return err
+				}
+			}
 		}
 		return nil
 	},
 }
 
+// listFilter holds the --filter values of runc list by key. The containers
+// must match one of the values of each key.
+type listFilter map[string][]string
+
+func parseListFilter(filters []string) (listFilter, error) {
+	f := listFilter{}
+	for _, filter := range filters {
+		kv := strings.SplitN(filter, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("invalid filter %q: expected key=value", filter)
+		}
+		switch kv[0] {
+		case "status":
+			switch kv[1] {
+			case libcontainer.Created.String(), libcontainer.Running.String(), libcontainer.Pausing.String(), libcontainer.Paused.String(), libcontainer.Stopped.String():
+			default:
+				return nil, fmt.Errorf("invalid filter %q: unknown status", filter)
+			}
+		case "annotation", "bundle":
+		default:
+			return nil, fmt.Errorf("invalid filter %q: unknown key %q", filter, kv[0])
+		}
+		f[kv[0]] = append(f[kv[0]], kv[1])
+	}
+	return f, nil
+}
+
+func (f listFilter) match(s *containerState) bool {
+	for key, values := range f {
+		matched := false
+		for _, value := range values {
+			switch key {
+			case "status":
+				matched = s.Status == value
+			case "bundle":
+				matched = strings.HasPrefix(s.Bundle, value)
+			case "annotation":
+				kv := strings.SplitN(value, "=", 2)
+				v, ok := s.Annotations[kv[0]]
+				matched = ok && (len(kv) == 1 || v == kv[1])
+			}
+			if matched {
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	return true
+}
+
+// listSortKeys are the --sort keys of runc list, with the order they sort
+// the containers in.
+var listSortKeys = map[string]func(a, b *containerState) bool{
+	"id":      func(a, b *containerState) bool { return a.ID < b.ID },
+	"pid":     func(a, b *containerState) bool { return a.InitProcessPid < b.InitProcessPid },
+	"status":  func(a, b *containerState) bool { return a.Status < b.Status },
+	"bundle":  func(a, b *containerState) bool { return a.Bundle < b.Bundle },
+	"owner":   func(a, b *containerState) bool { return a.Owner < b.Owner },
+	"created": func(a, b *containerState) bool { return a.Created.After(b.Created) },
+}
+
 func getContainers(context *cli.Context) ([]containerState, error) {
+	filter, err := parseListFilter(context.StringSlice("filter"))
+	if err != nil {
+		return nil, err
+	}
+	less, ok := listSortKeys[context.String("sort")]
+	if !ok {
+		return nil, fmt.Errorf("invalid sort key %q", context.String("sort"))
+	}
 	factory, err := loadFactory(context)
 	if err != nil {
 		return nil, err
@@ -124,53 +238,65 @@ func getContainers(context *cli.Context) ([]containerState, error) {
 	if err != nil {
 		return nil, err
 	}
-	list, err := ioutil.ReadDir(absRoot)
+
+	containers, err := factory.List(nil)
 	if err != nil {
-		fatal(err)
+		return nil, err
 	}
-
 	var s []containerState
-	for _, item := range list {
-		if item.IsDir() {
-			// This cast is safe on Linux.
-			stat := item.Sys().(*syscall.Stat_t)
-			owner, err := user.LookupUid(int(stat.Uid))
-			if err != nil {
-				owner.Name = fmt.Sprintf("#%d", stat.Uid)
-			}
-
-			container, err := factory.Load(item.Name())
-			if err != nil {
-				fmt.Fprintf(os.Stderr, "load container %s: %v\n", item.Name(), err)
-				continue
-			}
-			containerStatus, err := container.Status()
-			if err != nil {
-				fmt.Fprintf(os.Stderr, "status for %s: %v\n", item.Name(), err)
-				continue
-			}
-			state, err := container.State()
-			if err != nil {
-				fmt.Fprintf(os.Stderr, "state for %s: %v\n", item.Name(), err)
-				continue
-			}
-			pid := state.BaseState.InitProcessPid
-			if containerStatus == libcontainer.Stopped {
-				pid = 0
-			}
-			bundle, annotations := utils.Annotations(state.Config.Labels)
-			s = append(s, containerState{
-				Version:        state.BaseState.Config.Version,
-				ID:             state.BaseState.ID,
-				InitProcessPid: pid,
-				Status:         containerStatus.String(),
-				Bundle:         bundle,
-				Rootfs:         state.BaseState.Config.Rootfs,
-				Created:        state.BaseState.Created,
-				Annotations:    annotations,
-				Owner:          owner.Name,
-			})
+	for _, container := range containers {
+		item, err := newContainerState(container, absRoot)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			continue
+		}
+		if filter.match(item) {
+			s = append(s, *item)
 		}
 	}
+	sort.SliceStable(s, func(i, j int) bool {
+		return less(&s[i], &s[j])
+	})
 	return s, nil
 }
+
+// newContainerState returns the state of the container listed by runc list,
+// the directory of which is in root.
+func newContainerState(container libcontainer.Container, root string) (*containerState, error) {
+	id := container.ID()
+	fi, err := os.Stat(filepath.Join(root, id))
+	if err != nil {
+		return nil, fmt.Errorf("owner of %s: %w", id, err)
+	}
+	// This cast is safe on Linux.
+	stat := fi.Sys().(*syscall.Stat_t)
+	owner, err := user.LookupUid(int(stat.Uid))
+	if err != nil {
+		owner.Name = fmt.Sprintf("#%d", stat.Uid)
+	}
+
+	containerStatus, err := container.Status()
+	if err != nil {
+		return nil, fmt.Errorf("status for %s: %w", id, err)
+	}
+	state, err := container.State()
+	if err != nil {
+		return nil, fmt.Errorf("state for %s: %w", id, err)
+	}
+	pid := state.BaseState.InitProcessPid
+	if containerStatus == libcontainer.Stopped {
+		pid = 0
+	}
+	bundle, annotations := utils.Annotations(state.Config.Labels)
+	return &containerState{
+		Version:        state.BaseState.Config.Version,
+		ID:             state.BaseState.ID,
+		InitProcessPid: pid,
+		Status:         containerStatus.String(),
+		Bundle:         bundle,
+		Rootfs:         state.BaseState.Config.Rootfs,
+		Created:        state.BaseState.Created,
+		Annotations:    annotations,
+		Owner:          owner.Name,
+	}, nil
+}
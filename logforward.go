@@ -0,0 +1,253 @@
+// +build linux
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strconv"
+	"sync"
+
+	"github.com/docker/go-units"
+	"github.com/opencontainers/runc/libcontainer"
+	"github.com/urfave/cli"
+	"golang.org/x/sys/unix"
+)
+
+// stdioLogs are the files to which the stdout and stderr of a container are
+// written instead of the ones of runc (see runc run --stdout and --stderr).
+type stdioLogs struct {
+	stdout, stderr string
+	// maxSize is the size (in bytes) from which the files are rotated, or
+	// 0 if they are never rotated.
+	maxSize int64
+	// maxFiles is the number of rotated files kept for each of them.
+	maxFiles int
+}
+
+// newStdioLogs returns the stdio logs set in the context, or nil if there
+// are none.
+func newStdioLogs(context *cli.Context) (*stdioLogs, error) {
+	l := &stdioLogs{
+		stdout:   context.String("stdout"),
+		stderr:   context.String("stderr"),
+		maxFiles: context.Int("stdio-max-files"),
+	}
+	if l.stdout == "" && l.stderr == "" {
+		return nil, nil
+	}
+	if l.stdout != "" && l.stdout == l.stderr {
+		return nil, fmt.Errorf("--stdout and --stderr must be different files")
+	}
+	if l.maxFiles < 0 {
+		return nil, fmt.Errorf("invalid --stdio-max-files %d", l.maxFiles)
+	}
+	if s := context.String("stdio-max-size"); s != "" {
+		size, err := units.RAMInBytes(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --stdio-max-size: %w", err)
+		}
+		l.maxSize = size
+	}
+	return l, nil
+}
+
+// writers returns the writers for the stdout and stderr of the container
+// (defaulting to the ones of runc), and the closers of the files among them.
+func (l *stdioLogs) writers() (stdout, stderr io.Writer, closers []io.Closer, err error) {
+	stdout, stderr = os.Stdout, os.Stderr
+	if l == nil {
+		return stdout, stderr, nil, nil
+	}
+	for _, s := range []struct {
+		path string
+		w    *io.Writer
+	}{{l.stdout, &stdout}, {l.stderr, &stderr}} {
+		if s.path == "" {
+			continue
+		}
+		f, err := openRotatingFile(s.path, l.maxSize, l.maxFiles)
+		if err != nil {
+			for _, c := range closers {
+				_ = c.Close()
+			}
+			return nil, nil, nil, err
+		}
+		*s.w = f
+		closers = append(closers, f)
+	}
+	return stdout, stderr, closers, nil
+}
+
+// startForwarder starts a runc forward-stdio process writing the stdout
+// and/or stderr of the process to the files, so that they outlive runc when
+// it detaches from the container. The write ends of the pipes to the
+// forwarder are added to the post start closers of t.
+func (l *stdioLogs) startForwarder(process *libcontainer.Process, t *tty) error {
+	var (
+		args  = []string{"forward-stdio", "--max-size", strconv.FormatInt(l.maxSize, 10), "--max-files", strconv.Itoa(l.maxFiles)}
+		files []*os.File
+	)
+	defer func() {
+		for _, f := range files {
+			_ = f.Close()
+		}
+	}()
+	for _, s := range []struct {
+		name, path string
+		w          *io.Writer
+	}{{"stdout", l.stdout, &process.Stdout}, {"stderr", l.stderr, &process.Stderr}} {
+		if s.path == "" {
+			continue
+		}
+		r, w, err := os.Pipe()
+		if err != nil {
+			return err
+		}
+		files = append(files, r)
+		t.postStart = append(t.postStart, w)
+		*s.w = w
+		args = append(args, "--"+s.name, s.path)
+	}
+
+	cmd := exec.Command("/proc/self/exe", args...)
+	cmd.ExtraFiles = files
+	// Don't let the forwarder be killed with the session of runc.
+	cmd.SysProcAttr = &unix.SysProcAttr{Setsid: true}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("unable to start the stdio forwarder: %w", err)
+	}
+	return cmd.Process.Release()
+}
+
+var forwardStdioCommand = cli.Command{
+	Name:   "forward-stdio",
+	Usage:  "forward the stdio of a detached container to files (do not call it outside of runc)",
+	Hidden: true,
+	Flags: []cli.Flag{
+		cli.StringFlag{Name: "stdout"},
+		cli.StringFlag{Name: "stderr"},
+		cli.Int64Flag{Name: "max-size"},
+		cli.IntFlag{Name: "max-files"},
+	},
+	Action: func(context *cli.Context) error {
+		l := &stdioLogs{
+			stdout:   context.String("stdout"),
+			stderr:   context.String("stderr"),
+			maxSize:  context.Int64("max-size"),
+			maxFiles: context.Int("max-files"),
+		}
+		stdout, stderr, closers, err := l.writers()
+		if err != nil {
+			return err
+		}
+		// The pipes are passed in order, starting from fd 3.
+		var wg sync.WaitGroup
+		fd := uintptr(3)
+		for _, s := range []struct {
+			path string
+			w    io.Writer
+		}{{l.stdout, stdout}, {l.stderr, stderr}} {
+			if s.path == "" {
+				continue
+			}
+			wg.Add(1)
+			go func(w io.Writer, r *os.File) {
+				defer wg.Done()
+				forward(w, r)
+			}(s.w, os.NewFile(fd, s.path))
+			fd++
+		}
+		wg.Wait()
+		for _, c := range closers {
+			_ = c.Close()
+		}
+		return nil
+	},
+}
+
+// forward copies r to w until r is closed. If w fails, the rest of r is
+// discarded, so that the container does not get EPIPE.
+func forward(w io.Writer, r io.ReadCloser) {
+	if _, err := io.Copy(w, r); err != nil {
+		_, _ = io.Copy(ioutil.Discard, r)
+	}
+	_ = r.Close()
+}
+
+// rotatingFile is a file which is rotated once it would grow beyond maxSize
+// bytes (if not 0), keeping maxFiles previous files, named path.1 (the most
+// recent one), path.2 and so on.
+type rotatingFile struct {
+	path     string
+	maxSize  int64
+	maxFiles int
+
+	file *os.File
+	size int64
+}
+
+func openRotatingFile(path string, maxSize int64, maxFiles int) (*rotatingFile, error) {
+	r := &rotatingFile{path: path, maxSize: maxSize, maxFiles: maxFiles}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *rotatingFile) open() error {
+	f, err := os.OpenFile(r.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	st, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	r.file, r.size = f, st.Size()
+	return nil
+}
+
+func (r *rotatingFile) Write(p []byte) (int, error) {
+	if r.maxSize > 0 && r.size > 0 && r.size+int64(len(p)) > r.maxSize {
+		if err := r.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := r.file.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+func (r *rotatingFile) rotate() error {
+	if err := r.file.Close(); err != nil {
+		return err
+	}
+	if r.maxFiles == 0 {
+		if err := os.Remove(r.path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return r.open()
+	}
+	for i := r.maxFiles - 1; i > 0; i-- {
+		if err := os.Rename(r.name(i), r.name(i+1)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	if err := os.Rename(r.path, r.name(1)); err != nil {
+		return err
+	}
+	return r.open()
+}
+
+func (r *rotatingFile) name(i int) string {
+	return r.path + "." + strconv.Itoa(i)
+}
+
+func (r *rotatingFile) Close() error {
+	return r.file.Close()
+}
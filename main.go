@@ -9,6 +9,7 @@ import (
 
 	"github.com/opencontainers/runc/libcontainer/logs"
 	"github.com/opencontainers/runc/libcontainer/seccomp"
+	"github.com/opencontainers/runc/libcontainer/trace"
 	"github.com/opencontainers/runtime-spec/specs-go"
 
 	"github.com/sirupsen/logrus"
@@ -107,18 +108,41 @@ func main() {
 			Name:  "systemd-cgroup",
 			Usage: "enable systemd cgroup support, expects cgroupsPath to be of form \"slice:prefix:name\" for e.g. \"system.slice:runc:434234\"",
 		},
+		cli.StringFlag{
+			Name:  "cgroup-root",
+			Usage: "cgroup, relative to the cgroup filesystem mounted on /sys/fs/cgroup, to create the cgroups of the containers with a relative cgroupsPath in (default: the cgroup of runc; not supported with --systemd-cgroup)",
+		},
 		cli.StringFlag{
 			Name:  "rootless",
 			Value: "auto",
 			Usage: "ignore cgroup permission errors ('true', 'false', or 'auto')",
 		},
+		cli.BoolFlag{
+			Name:  "pin-device-filter",
+			Usage: "pin the eBPF device filter program of a container under /sys/fs/bpf/runc/<root-hash>/<container-id> (cgroup v2 only)",
+		},
+		cli.BoolFlag{
+			Name:  "device-filter-map",
+			Usage: "use an eBPF device filter program consulting a map of the allowed devices, updated in place by 'runc update' (cgroup v2 only)",
+		},
+		cli.BoolFlag{
+			Name:  "device-filter-fail-closed",
+			Usage: "fail if the eBPF device filter program of a container can't be installed, even if rootless, and never leave the container without a device filter (cgroup v2 only)",
+		},
+		cli.BoolFlag{
+			Name:  "audit-devices",
+			Usage: "record the device accesses denied to a container, reported by 'runc events' (cgroup v2, or v1 with the unified hierarchy)",
+		},
 	}
 	app.Commands = []cli.Command{
+		attachCommand,
 		checkpointCommand,
 		createCommand,
 		deleteCommand,
 		eventsCommand,
 		execCommand,
+		featuresCommand,
+		forwardStdioCommand,
 		initCommand,
 		killCommand,
 		listCommand,
@@ -130,6 +154,7 @@ func main() {
 		specCommand,
 		startCommand,
 		stateCommand,
+		topCommand,
 		updateCommand,
 	}
 	app.Before = func(context *cli.Context) error {
@@ -153,7 +178,20 @@ func main() {
 		if args := context.Args(); args != nil && args.First() == "init" {
 			return nil
 		}
-		return logs.ConfigureLogging(createLogConfig(context))
+		if err := logs.ConfigureLogging(createLogConfig(context)); err != nil {
+			return err
+		}
+		// Tag all the log entries of this invocation, including the ones
+		// forwarded from runc init, so that they can be correlated.
+		logs.AddFields(logrus.Fields{"op": newOperationID()})
+		if err := trace.Init("runc", "runc "+context.Args().First()); err != nil {
+			logrus.Warnf("unable to enable tracing: %v", err)
+		}
+		return nil
+	}
+	app.After = func(context *cli.Context) error {
+		shutdownTracing()
+		return nil
 	}
 
 	// If the command returns an error, cli takes upon itself to print
@@ -196,3 +234,16 @@ func createLogConfig(context *cli.Context) logs.Config {
 
 	return config
 }
+
+func shutdownTracing() {
+	if err := trace.Shutdown(); err != nil {
+		logrus.Warnf("unable to export traces: %v", err)
+	}
+}
+
+// exitWithStatus exits with the given status. As app.After is not run when a command
+// exits on its own, the traces are exported first.
+func exitWithStatus(status int) {
+	shutdownTracing()
+	os.Exit(status)
+}
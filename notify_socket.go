@@ -20,6 +20,9 @@ type notifySocket struct {
 	socket     *net.UnixConn
 	host       string
 	socketPath string
+	// watchdog is the one of runc, if any, which the container takes over
+	// by sending WATCHDOG=1.
+	watchdog *watchdog
 }
 
 func newNotifySocket(context *cli.Context, notifySocketHost string, id string) *notifySocket {
@@ -40,6 +43,9 @@ func newNotifySocket(context *cli.Context, notifySocketHost string, id string) *
 }
 
 func (s *notifySocket) Close() error {
+	if s.socket == nil {
+		return nil
+	}
 	return s.socket.Close()
 }
 
@@ -54,6 +60,14 @@ func (s *notifySocket) setupSpec(context *cli.Context, spec *specs.Spec) error {
 	}
 	spec.Mounts = append(spec.Mounts, mount)
 	spec.Process.Env = append(spec.Process.Env, "NOTIFY_SOCKET="+pathInContainer)
+	// The watchdog keep-alives of the container are forwarded as long as
+	// runc runs in the foreground, so it is then told about the watchdog of
+	// the unit. WATCHDOG_PID is left out, as the keep-alives are sent by
+	// runc, on behalf of the container.
+	usec := os.Getenv("WATCHDOG_USEC")
+	if usec != "" && context.Command.Name == "run" && !context.Bool("detach") {
+		spec.Process.Env = append(spec.Process.Env, "WATCHDOG_USEC="+usec)
+	}
 	return nil
 }
 
@@ -94,15 +108,23 @@ func notifySocketStart(context *cli.Context, notifySocketHost, id string) (*noti
 	return notifySocket, nil
 }
 
+// waitForContainer forwards the notifications of the container started by
+// runc start until it is ready, as runc exits then.
 func (n *notifySocket) waitForContainer(container libcontainer.Container) error {
 	s, err := container.State()
 	if err != nil {
 		return err
 	}
-	return n.run(s.InitProcessPid)
+	return n.run(s.InitProcessPid, s.InitProcessPid, true)
 }
 
-func (n *notifySocket) run(pid1 int) error {
+// run forwards the notifications sent by the container to the notify socket
+// of the host, with MAINPID set to mainPid along with READY=1. If untilReady
+// is true, it returns once READY=1 has been forwarded; otherwise it keeps
+// forwarding them, such as the watchdog keep-alives (WATCHDOG=1) and STATUS,
+// until the socket is closed. It also returns once the process pid1 has
+// exited, if it is not 0.
+func (n *notifySocket) run(pid1, mainPid int, untilReady bool) error {
 	if n.socket == nil {
 		return nil
 	}
@@ -111,62 +133,91 @@ func (n *notifySocket) run(pid1 int) error {
 	if err != nil {
 		return err
 	}
+	defer client.Close()
 
 	ticker := time.NewTicker(time.Millisecond * 100)
 	defer ticker.Stop()
 
-	fileChan := make(chan []byte)
+	done := make(chan struct{})
+	defer close(done)
+	msgs := make(chan []byte)
 	go func() {
+		defer close(msgs)
 		for {
 			buf := make([]byte, 4096)
 			r, err := n.socket.Read(buf)
 			if err != nil {
 				return
 			}
-			got := buf[0:r]
-			// systemd-ready sends a single datagram with the state string as payload,
-			// so we don't need to worry about partial messages.
-			for _, line := range bytes.Split(got, []byte{'\n'}) {
-				if bytes.HasPrefix(got, []byte("READY=")) {
-					fileChan <- line
-					return
-				}
+			select {
+			case msgs <- buf[:r]:
+			case <-done:
+				return
 			}
-
 		}
 	}()
 
 	for {
 		select {
 		case <-ticker.C:
+			if pid1 == 0 {
+				continue
+			}
 			_, err := os.Stat(filepath.Join("/proc", strconv.Itoa(pid1)))
 			if err != nil {
 				return nil
 			}
-		case b := <-fileChan:
-			var out bytes.Buffer
-			_, err = out.Write(b)
-			if err != nil {
-				return err
+		case b, ok := <-msgs:
+			if !ok {
+				return nil
 			}
-
-			_, err = out.Write([]byte{'\n'})
-			if err != nil {
-				return err
+			msg, ready := notifyMessage(b)
+			if n.watchdog != nil && bytes.Contains(append([]byte{'\n'}, msg...), []byte("\nWATCHDOG=1\n")) {
+				n.watchdog.delegate()
 			}
-
-			_, err = client.Write(out.Bytes())
-			if err != nil {
-				return err
+			if ready {
+				// now we can inform systemd of the pid to monitor
+				msg = append(msg, "MAINPID="+strconv.Itoa(mainPid)+"\n"...)
 			}
-
-			// now we can inform systemd to use pid1 as the pid to monitor
-			newPid := "MAINPID=" + strconv.Itoa(pid1)
-			_, err := client.Write([]byte(newPid + "\n"))
-			if err != nil {
-				return err
+			if len(msg) > 0 {
+				if _, err := client.Write(msg); err != nil {
+					return err
+				}
+			}
+			if ready && untilReady {
+				return nil
 			}
-			return nil
 		}
 	}
 }
+
+// notifyMessage returns the lines of a notification of the container to be
+// forwarded to the host, and whether it has READY=1. The main pid is set by
+// runc, and the messages sent along with file descriptors (such as
+// FDSTORE=1) are dropped, as those are not forwarded.
+func notifyMessage(b []byte) ([]byte, bool) {
+	var (
+		out   bytes.Buffer
+		ready bool
+	)
+	// sd_notify sends a single datagram with the state string as payload,
+	// so we don't need to worry about partial messages.
+	for _, line := range bytes.Split(b, []byte{'\n'}) {
+		if len(line) == 0 {
+			continue
+		}
+		key := line
+		if i := bytes.IndexByte(line, '='); i != -1 {
+			key = line[:i]
+		}
+		switch string(key) {
+		case "MAINPID", "FDSTORE", "FDSTOREREMOVE", "FDNAME", "FDPOLL", "BARRIER":
+			continue
+		case "READY":
+			ready = ready || string(line) == "READY=1"
+		}
+		out.Write(line)
+		out.WriteByte('\n')
+	}
+	return out.Bytes(), ready
+}
@@ -3,10 +3,19 @@
 package main
 
 import (
+	gocontext "context"
+	"errors"
+	"fmt"
+
+	"github.com/opencontainers/runc/libcontainer/cgroups"
 	"github.com/sirupsen/logrus"
 	"github.com/urfave/cli"
 )
 
+// pauseTimeoutStatus is the exit status of runc pause if the container could
+// not be paused in time (and was resumed). This is the status of timeout(1).
+const pauseTimeoutStatus = 124
+
 var pauseCommand = cli.Command{
 	Name:  "pause",
 	Usage: "pause suspends all processes inside the container",
@@ -16,7 +25,22 @@ Where "<container-id>" is the name for the instance of the container to be
 paused. `,
 	Description: `The pause command suspends all processes in the instance of the container.
 
-Use runc list to identify instances of containers and their current status.`,
+Use runc list to identify instances of containers and their current status.
+
+Processes in an uninterruptible sleep can't be suspended, in which case the
+container is resumed, and pause fails after the --timeout, with exit status
+124. With --signal, the processes are sent the given signal, and suspending
+them is retried once, before failing.`,
+	Flags: []cli.Flag{
+		cli.DurationFlag{
+			Name:  "timeout",
+			Usage: "maximum time to wait for all the processes to be suspended (0 for the default)",
+		},
+		cli.StringFlag{
+			Name:  "signal",
+			Usage: "signal to send to the processes of the container if they can't all be suspended, before retrying",
+		},
+	},
 	Action: func(context *cli.Context) error {
 		if err := checkArgs(context, 1, exactArgs); err != nil {
 			return err
@@ -28,11 +52,34 @@ Use runc list to identify instances of containers and their current status.`,
 		if rootlessCg {
 			logrus.Warnf("runc pause may fail if you don't have the full access to cgroups")
 		}
+		ctx := gocontext.Background()
+		if timeout := context.Duration("timeout"); timeout > 0 {
+			var cancel gocontext.CancelFunc
+			ctx, cancel = gocontext.WithTimeout(ctx, timeout)
+			defer cancel()
+		}
+		var opts *cgroups.FreezeOptions
+		if s := context.String("signal"); s != "" {
+			sig, err := parseSignal(s)
+			if err != nil {
+				return err
+			}
+			opts = &cgroups.FreezeOptions{Signal: sig}
+		}
 		container, err := getContainer(context)
 		if err != nil {
 			return err
 		}
-		return container.Pause()
+		if err := container.PauseContext(ctx, opts); err != nil {
+			if errors.Is(err, cgroups.ErrFreezing) {
+				return &exitError{
+					status: pauseTimeoutStatus,
+					err:    fmt.Errorf("unable to pause the container, which was resumed (some of its processes may be in an uninterruptible sleep): %w", err),
+				}
+			}
+			return err
+		}
+		return nil
 	},
 }
 
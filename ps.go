@@ -3,18 +3,43 @@
 package main
 
 import (
+	"bufio"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"strconv"
 	"strings"
 
+	"github.com/opencontainers/runc/libcontainer"
+	"github.com/opencontainers/runc/libcontainer/cgroups"
+	"github.com/opencontainers/runc/libcontainer/cgroups/fs2"
+	"github.com/opencontainers/runc/libcontainer/system"
 	"github.com/sirupsen/logrus"
 	"github.com/urfave/cli"
 )
 
+// psProcess is a process of a container, as output by runc ps --format
+// json-full.
+type psProcess struct {
+	PID  int    `json:"pid"`
+	PPID int    `json:"ppid"`
+	Comm string `json:"comm"`
+	// Cgroup is the cgroup of the process, in the unified hierarchy on
+	// cgroup v2, or in the one of the devices controller (which runc always
+	// uses) on cgroup v1.
+	Cgroup string `json:"cgroup"`
+	// Exec is whether the process was started by runc exec (or is one of
+	// the descendants of such a process), rather than being the init of the
+	// container or one of its descendants.
+	Exec bool `json:"exec"`
+	// Threads are the ids of the threads of the process in the threaded
+	// cgroups of cgroup v2, by cgroup.
+	Threads map[string][]int `json:"threads,omitempty"`
+}
+
 var psCommand = cli.Command{
 	Name:      "ps",
 	Usage:     "ps displays the processes running inside a container",
@@ -23,7 +48,7 @@ var psCommand = cli.Command{
 		cli.StringFlag{
 			Name:  "format, f",
 			Value: "table",
-			Usage: `select one of: ` + formatOptions,
+			Usage: `select one of: table, json or json-full`,
 		},
 	},
 	Action: func(context *cli.Context) error {
@@ -48,19 +73,36 @@ var psCommand = cli.Command{
 			return err
 		}
 
+		// [1:] is to remove command name, ex:
+		// context.Args(): [container_id ps_arg1 ps_arg2 ...]
+		// psArgs:         [ps_arg1 ps_arg2 ...]
+		//
+		psArgs := context.Args()[1:]
+		// Allow to separate the ps options with "--".
+		if len(psArgs) > 0 && psArgs[0] == "--" {
+			psArgs = psArgs[1:]
+		}
+
 		switch context.String("format") {
 		case "table":
 		case "json":
+			if len(psArgs) > 0 {
+				return errors.New("ps options can't be used with the json format")
+			}
 			return json.NewEncoder(os.Stdout).Encode(pids)
+		case "json-full":
+			if len(psArgs) > 0 {
+				return errors.New("ps options can't be used with the json-full format")
+			}
+			processes, err := getPsProcesses(container, pids)
+			if err != nil {
+				return err
+			}
+			return json.NewEncoder(os.Stdout).Encode(processes)
 		default:
 			return errors.New("invalid format option")
 		}
 
-		// [1:] is to remove command name, ex:
-		// context.Args(): [container_id ps_arg1 ps_arg2 ...]
-		// psArgs:         [ps_arg1 ps_arg2 ...]
-		//
-		psArgs := context.Args()[1:]
 		if len(psArgs) == 0 {
 			psArgs = []string{"-ef"}
 		}
@@ -72,7 +114,7 @@ var psCommand = cli.Command{
 		}
 
 		lines := strings.Split(string(output), "\n")
-		pidIndex, err := getPidIndex(lines[0])
+		pidIndex, pidEnd, err := getPidIndex(lines[0])
 		if err != nil {
 			return err
 		}
@@ -82,10 +124,9 @@ var psCommand = cli.Command{
 			if len(line) == 0 {
 				continue
 			}
-			fields := strings.Fields(line)
-			p, err := strconv.Atoi(fields[pidIndex])
+			p, err := getPid(line, pidIndex, pidEnd)
 			if err != nil {
-				return fmt.Errorf("unexpected pid '%s': %s", fields[pidIndex], err)
+				return err
 			}
 
 			for _, pid := range pids {
@@ -100,15 +141,155 @@ var psCommand = cli.Command{
 	SkipArgReorder: true,
 }
 
-func getPidIndex(title string) (int, error) {
+// getPidIndex returns the index of the PID field in the header of the output
+// of ps, and the offset of its end.
+func getPidIndex(title string) (index, end int, err error) {
 	titles := strings.Fields(title)
 
-	pidIndex := -1
+	offset := 0
 	for i, name := range titles {
+		offset = strings.Index(title[offset:], name) + offset + len(name)
 		if name == "PID" {
-			return i, nil
+			return i, offset, nil
+		}
+	}
+
+	return -1, -1, errors.New("couldn't find PID field in ps output")
+}
+
+// getPid returns the pid of a line of the output of ps. The pids are aligned
+// to the right of the PID title, which allows to find them even after the
+// fields containing spaces (such as the one of lstart), which can't be
+// counted.
+func getPid(line string, pidIndex, pidEnd int) (int, error) {
+	if pidEnd <= len(line) && (pidEnd == len(line) || line[pidEnd] == ' ') {
+		start := pidEnd
+		for start > 0 && line[start-1] >= '0' && line[start-1] <= '9' {
+			start--
+		}
+		if start < pidEnd && (start == 0 || line[start-1] == ' ') {
+			return strconv.Atoi(line[start:pidEnd])
 		}
 	}
+	// The columns were shifted by a field wider than its title.
+	fields := strings.Fields(line)
+	if pidIndex >= len(fields) {
+		return 0, fmt.Errorf("unexpected ps output line %q", line)
+	}
+	p, err := strconv.Atoi(fields[pidIndex])
+	if err != nil {
+		return 0, fmt.Errorf("unexpected pid '%s': %s", fields[pidIndex], err)
+	}
+	return p, nil
+}
 
-	return pidIndex, errors.New("couldn't find PID field in ps output")
+// getPsProcesses returns the details of the processes of the container with
+// the given pids. The processes which exited in the meantime are skipped.
+func getPsProcesses(container libcontainer.Container, pids []int) ([]psProcess, error) {
+	state, err := container.State()
+	if err != nil {
+		return nil, err
+	}
+	processes := make([]psProcess, 0, len(pids))
+	index := make(map[int]int, len(pids))
+	for _, pid := range pids {
+		stat, err := system.Stat(pid)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, err
+		}
+		paths, err := cgroups.ParseCgroupFile("/proc/" + strconv.Itoa(pid) + "/cgroup")
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, err
+		}
+		cgroup := paths[""]
+		if !cgroups.IsCgroup2UnifiedMode() {
+			cgroup = paths["devices"]
+		}
+		index[pid] = len(processes)
+		processes = append(processes, psProcess{
+			PID:    pid,
+			PPID:   int(stat.PPID),
+			Comm:   stat.Name,
+			Cgroup: cgroup,
+		})
+	}
+
+	for i := range processes {
+		processes[i].Exec = !inInitTree(processes, index, i, state.InitProcessPid)
+	}
+
+	if !cgroups.IsCgroup2UnifiedMode() {
+		return processes, nil
+	}
+	threads, err := cgroups.GetAllThreads(state.CgroupPaths[""])
+	if err != nil {
+		return nil, err
+	}
+	for dir, tids := range threads {
+		rel, err := filepath.Rel(fs2.UnifiedMountpoint, dir)
+		if err != nil {
+			return nil, err
+		}
+		cgroup := "/" + rel
+		for _, tid := range tids {
+			tgid, err := getTgid(tid)
+			if err != nil {
+				// The thread exited in the meantime.
+				continue
+			}
+			if i, ok := index[tgid]; ok {
+				p := &processes[i]
+				if p.Threads == nil {
+					p.Threads = make(map[string][]int)
+				}
+				p.Threads[cgroup] = append(p.Threads[cgroup], tid)
+			}
+		}
+	}
+	return processes, nil
+}
+
+// inInitTree returns whether the i-th process is the init of the container,
+// or one of its descendants.
+func inInitTree(processes []psProcess, index map[int]int, i, initPid int) bool {
+	// The ancestors of the processes started by runc exec leave the
+	// container at the process started by runc, the parent of which is
+	// outside of it. The number of iterations is bounded in case of pid
+	// reuse.
+	for n := 0; n <= len(processes); n++ {
+		if processes[i].PID == initPid {
+			return true
+		}
+		j, ok := index[processes[i].PPID]
+		if !ok {
+			return false
+		}
+		i = j
+	}
+	return false
+}
+
+// getTgid returns the id of the thread group (the process) of a thread.
+func getTgid(tid int) (int, error) {
+	f, err := os.Open("/proc/" + strconv.Itoa(tid) + "/status")
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		if v := strings.TrimPrefix(s.Text(), "Tgid:"); v != s.Text() {
+			return strconv.Atoi(strings.TrimSpace(v))
+		}
+	}
+	if err := s.Err(); err != nil {
+		return 0, err
+	}
+	return 0, fmt.Errorf("no Tgid in the status of thread %d", tid)
 }
@@ -0,0 +1,175 @@
+// +build linux
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/docker/go-units"
+	"github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/urfave/cli"
+)
+
+// resourceFlags are the options setting the resources of the container, in
+// the format of the resources section of the spec, shared by runc update and
+// runc restore. They are converted by setResources.
+var resourceFlags = []cli.Flag{
+	cli.IntFlag{
+		Name:  "blkio-weight",
+		Usage: "Specifies per cgroup weight, range is from 10 to 1000",
+	},
+	cli.StringFlag{
+		Name:  "cpu-period",
+		Usage: "CPU CFS period to be used for hardcapping (in usecs). 0 to use system default",
+	},
+	cli.StringFlag{
+		Name:  "cpu-quota",
+		Usage: "CPU CFS hardcap limit (in usecs). Allowed cpu time in a given period",
+	},
+	cli.StringFlag{
+		Name:  "cpu-share",
+		Usage: "CPU shares (relative weight vs. other containers)",
+	},
+	cli.StringFlag{
+		Name:  "cpu-rt-period",
+		Usage: "CPU realtime period to be used for hardcapping (in usecs). 0 to use system default",
+	},
+	cli.StringFlag{
+		Name:  "cpu-rt-runtime",
+		Usage: "CPU realtime hardcap limit (in usecs). Allowed cpu time in a given period",
+	},
+	cli.StringFlag{
+		Name:  "cpuset-cpus",
+		Usage: "CPU(s) to use",
+	},
+	cli.StringFlag{
+		Name:  "cpuset-mems",
+		Usage: "Memory node(s) to use",
+	},
+	cli.StringFlag{
+		Name:  "kernel-memory",
+		Usage: "(obsoleted; do not use)",
+	},
+	cli.StringFlag{
+		Name:  "kernel-memory-tcp",
+		Usage: "(obsoleted; do not use)",
+	},
+	cli.StringFlag{
+		Name:  "memory",
+		Usage: "Memory limit (in bytes)",
+	},
+	cli.StringFlag{
+		Name:  "memory-reservation",
+		Usage: "Memory reservation or soft_limit (in bytes)",
+	},
+	cli.StringFlag{
+		Name:  "memory-swap",
+		Usage: "Total memory usage (memory + swap); set '-1' to enable unlimited swap",
+	},
+	cli.IntFlag{
+		Name:  "pids-limit",
+		Usage: "Maximum number of pids allowed in the container",
+	},
+}
+
+// decodeResources decodes the resources section of a spec from the file
+// path, or from the standard input if path is "-", into r.
+func decodeResources(path string, r *specs.LinuxResources) error {
+	f := os.Stdin
+	if path != "-" {
+		var err error
+		f, err = os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+	}
+	if err := json.NewDecoder(f).Decode(r); err != nil {
+		return fmt.Errorf("invalid resources: %w", err)
+	}
+	return nil
+}
+
+// setResources sets the resources of r given with the resourceFlags options,
+// leaving the other ones as they are.
+func setResources(context *cli.Context, r *specs.LinuxResources) error {
+	if r.CPU == nil {
+		r.CPU = &specs.LinuxCPU{}
+	}
+	if r.Memory == nil {
+		r.Memory = &specs.LinuxMemory{}
+	}
+
+	if val := context.Int("blkio-weight"); val != 0 {
+		if r.BlockIO == nil {
+			r.BlockIO = &specs.LinuxBlockIO{}
+		}
+		r.BlockIO.Weight = u16Ptr(uint16(val))
+	}
+	if val := context.String("cpuset-cpus"); val != "" {
+		r.CPU.Cpus = val
+	}
+	if val := context.String("cpuset-mems"); val != "" {
+		r.CPU.Mems = val
+	}
+	for _, pair := range []struct {
+		opt  string
+		dest **uint64
+	}{
+		{"cpu-period", &r.CPU.Period},
+		{"cpu-rt-period", &r.CPU.RealtimePeriod},
+		{"cpu-share", &r.CPU.Shares},
+	} {
+		if val := context.String(pair.opt); val != "" {
+			v, err := strconv.ParseUint(val, 10, 64)
+			if err != nil {
+				return fmt.Errorf("invalid value for %s: %s", pair.opt, err)
+			}
+			*pair.dest = &v
+		}
+	}
+	for _, pair := range []struct {
+		opt  string
+		dest **int64
+	}{
+		{"cpu-quota", &r.CPU.Quota},
+		{"cpu-rt-runtime", &r.CPU.RealtimeRuntime},
+	} {
+		if val := context.String(pair.opt); val != "" {
+			v, err := strconv.ParseInt(val, 10, 64)
+			if err != nil {
+				return fmt.Errorf("invalid value for %s: %s", pair.opt, err)
+			}
+			*pair.dest = &v
+		}
+	}
+	for _, pair := range []struct {
+		opt  string
+		dest **int64
+	}{
+		{"memory", &r.Memory.Limit},
+		{"memory-swap", &r.Memory.Swap},
+		{"kernel-memory", &r.Memory.Kernel},
+		{"kernel-memory-tcp", &r.Memory.KernelTCP},
+		{"memory-reservation", &r.Memory.Reservation},
+	} {
+		if val := context.String(pair.opt); val != "" {
+			v := int64(-1)
+			if val != "-1" {
+				var err error
+				v, err = units.RAMInBytes(val)
+				if err != nil {
+					return fmt.Errorf("invalid value for %s: %s", pair.opt, err)
+				}
+			}
+			*pair.dest = &v
+		}
+	}
+	if context.IsSet("pids-limit") {
+		r.Pids = &specs.LinuxPids{Limit: int64(context.Int("pids-limit"))}
+	}
+	return nil
+}
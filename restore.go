@@ -3,10 +3,12 @@
 package main
 
 import (
+	"errors"
 	"os"
 
 	"github.com/opencontainers/runc/libcontainer"
 	"github.com/opencontainers/runc/libcontainer/userns"
+	"github.com/opencontainers/runtime-spec/specs-go"
 	"github.com/sirupsen/logrus"
 	"github.com/urfave/cli"
 )
@@ -19,8 +21,27 @@ var restoreCommand = cli.Command{
 Where "<container-id>" is the name for the instance of the container to be
 restored.`,
 	Description: `Restores the saved state of the container instance that was previously saved
-using the runc checkpoint command.`,
-	Flags: []cli.Flag{
+using the runc checkpoint command.
+
+By default, the network namespace of the container is restored empty, as runc
+doesn't manage network devices. With --veth-pair or --macvlan, the network
+devices of the namespace are restored, with the given veth peers or macvlan
+lower devices in the host. With --netns, the container is restored into an
+existing network namespace, such as one set up by CNI, which requires the
+container to have been checkpointed with --external-netns (or with a network
+namespace path in its config).
+
+The external resources and mounts of the checkpoint are given with
+--external and --ext-mount, or the annotations described in
+runc-checkpoint(8). The source of a bind mount can be changed on restore
+with --ext-mount PATH=SOURCE.
+
+The resources of the container can be changed on restore, for a host with a
+different capacity, with --resources, which replaces the resources section of
+the spec (except the device rules, unless given), and the other resource
+options, which are set on the cgroup of the container before its processes
+are restored.`,
+	Flags: append([]cli.Flag{
 		cli.StringFlag{
 			Name:  "console-socket",
 			Value: "",
@@ -91,7 +112,41 @@ using the runc checkpoint command.`,
 			Name:  "lazy-pages",
 			Usage: "use userfaultfd to lazily restore memory pages",
 		},
-	},
+		cli.StringFlag{
+			Name:  "page-server",
+			Value: "",
+			Usage: "ADDRESS:PORT of the page server to fetch the memory pages from (with --lazy-pages)",
+		},
+		cli.IntFlag{
+			Name:  "stream-fd",
+			Value: -1,
+			Usage: "read the checkpoint images from this FD using criu-image-streamer",
+		},
+		cli.StringSliceFlag{
+			Name:  "veth-pair",
+			Usage: "restore a veth with its peer in the host, as CONTAINER_IF=HOST_IF",
+		},
+		cli.StringSliceFlag{
+			Name:  "macvlan",
+			Usage: "restore an external macvlan, as CONTAINER_IF=HOST_IF",
+		},
+		cli.StringFlag{
+			Name:  "netns",
+			Usage: "restore into the existing network namespace at this path",
+		},
+		cli.StringSliceFlag{
+			Name:  "external",
+			Usage: "an external resource, in the format of criu --external",
+		},
+		cli.StringSliceFlag{
+			Name:  "ext-mount",
+			Usage: "restore the external bind mount at this container path, as PATH=SOURCE",
+		},
+		cli.StringFlag{
+			Name:  "resources, r",
+			Usage: "path to a file with the resources section to restore the container with, instead of the one of the spec (- for stdin)",
+		},
+	}, resourceFlags...),
 	Action: func(context *cli.Context) error {
 		if err := checkArgs(context, 1, exactArgs); err != nil {
 			return err
@@ -105,7 +160,20 @@ using the runc checkpoint command.`,
 		if err != nil {
 			return err
 		}
+		if err := setRestoreResources(context, spec); err != nil {
+			return err
+		}
 		options := criuOptions(context)
+		if context.String("page-server") != "" && !options.LazyPages {
+			return errors.New("--page-server requires --lazy-pages")
+		}
+		setPageServer(context, options)
+		if err := setNetworkOpts(context, options); err != nil {
+			return err
+		}
+		if err := setExternalOpts(context, options, spec.Annotations); err != nil {
+			return err
+		}
 		if err := setEmptyNsMask(context, options); err != nil {
 			return err
 		}
@@ -115,7 +183,7 @@ using the runc checkpoint command.`,
 		}
 		// exit with the container's exit status so any external supervisor is
 		// notified of the exit with the correct exit status.
-		os.Exit(status)
+		exitWithStatus(status)
 		return nil
 	},
 }
@@ -126,6 +194,11 @@ func criuOptions(context *cli.Context) *libcontainer.CriuOpts {
 		fatal(err)
 	}
 
+	var stream *os.File
+	if fd := context.Int("stream-fd"); fd != -1 {
+		stream = os.NewFile(uintptr(fd), "stream")
+	}
+
 	return &libcontainer.CriuOpts{
 		ImagesDirectory:         imagePath,
 		WorkDirectory:           context.String("work-path"),
@@ -139,5 +212,31 @@ func criuOptions(context *cli.Context) *libcontainer.CriuOpts {
 		AutoDedup:               context.Bool("auto-dedup"),
 		LazyPages:               context.Bool("lazy-pages"),
 		StatusFd:                context.Int("status-fd"),
+		Stream:                  stream,
+	}
+}
+
+// setRestoreResources overrides the resources of spec with the ones given on
+// the command line, so that they are set on the cgroup of the container
+// before its processes are restored.
+func setRestoreResources(context *cli.Context, spec *specs.Spec) error {
+	if spec.Linux == nil {
+		spec.Linux = &specs.Linux{}
+	}
+	if in := context.String("resources"); in != "" {
+		var r specs.LinuxResources
+		if err := decodeResources(in, &r); err != nil {
+			return err
+		}
+		// Keep the device rules of the spec unless new ones are given,
+		// as the devices of the container are not expected to change.
+		if r.Devices == nil && spec.Linux.Resources != nil {
+			r.Devices = spec.Linux.Resources.Devices
+		}
+		spec.Linux.Resources = &r
+	}
+	if spec.Linux.Resources == nil {
+		spec.Linux.Resources = &specs.LinuxResources{}
 	}
+	return setResources(context, spec.Linux.Resources)
 }
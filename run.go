@@ -2,11 +2,7 @@
 
 package main
 
-import (
-	"os"
-
-	"github.com/urfave/cli"
-)
+import "github.com/urfave/cli"
 
 // default action is to start a container
 var runCommand = cli.Command{
@@ -57,10 +53,39 @@ command(s) that get executed on start, edit the args parameter of the spec. See
 			Name:  "no-new-keyring",
 			Usage: "do not create a new session keyring for the container.  This will cause the container to inherit the calling processes session key",
 		},
+		cli.BoolFlag{
+			Name:  "sched-core",
+			Usage: "create a new core scheduling cookie for the container, so that no other tasks run on the SMT siblings of the cores it runs on",
+		},
+		cli.BoolFlag{
+			Name:  "selinux-mcs",
+			Usage: "allocate a unique SELinux MCS level to the container, if the spec has no process label",
+		},
 		cli.IntFlag{
 			Name:  "preserve-fds",
 			Usage: "Pass N additional file descriptors to the container (stdio + $LISTEN_FDS + N in total)",
 		},
+		cli.StringFlag{
+			Name:  "stdout",
+			Usage: "write the stdout of the container to the given file instead of the one of runc",
+		},
+		cli.StringFlag{
+			Name:  "stderr",
+			Usage: "write the stderr of the container to the given file instead of the one of runc",
+		},
+		cli.StringFlag{
+			Name:  "stdio-max-size",
+			Usage: "rotate the --stdout and --stderr files once they reach the given size (e.g. 10M)",
+		},
+		cli.IntFlag{
+			Name:  "stdio-max-files",
+			Value: 5,
+			Usage: "number of rotated --stdout and --stderr files to keep",
+		},
+		cli.StringSliceFlag{
+			Name:  "device",
+			Usage: "inject the CDI device with the given fully qualified name (e.g. vendor.com/gpu=gpu0) into the container",
+		},
 	},
 	Action: func(context *cli.Context) error {
 		if err := checkArgs(context, 1, exactArgs); err != nil {
@@ -69,6 +94,9 @@ command(s) that get executed on start, edit the args parameter of the spec. See
 		if err := revisePidFile(context); err != nil {
 			return err
 		}
+		if err := reviseStdioLogs(context); err != nil {
+			return err
+		}
 		spec, err := setupSpec(context)
 		if err != nil {
 			return err
@@ -77,7 +105,7 @@ command(s) that get executed on start, edit the args parameter of the spec. See
 		if err == nil {
 			// exit with the container's exit status so any external supervisor is
 			// notified of the exit with the correct exit status.
-			os.Exit(status)
+			exitWithStatus(status)
 		}
 		return err
 	},
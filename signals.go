@@ -66,11 +66,13 @@ func (h *signalHandler) forward(process *libcontainer.Process, tty *tty, detach
 
 	if h.notifySocket != nil {
 		if detach {
-			_ = h.notifySocket.run(pid1)
+			_ = h.notifySocket.run(pid1, pid1, true)
 			return 0, nil
 		}
-		_ = h.notifySocket.run(os.Getpid())
-		go func() { _ = h.notifySocket.run(0) }()
+		// The notifications are forwarded for as long as runc runs, with
+		// runc as the main pid.
+		go func() { _ = h.notifySocket.run(0, os.Getpid(), false) }()
+		defer h.notifySocket.Close()
 	}
 
 	// Perform the initial tty resize. Always ignore errors resizing because
@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"os/exec"
 
 	"github.com/opencontainers/runc/libcontainer/configs"
 	"github.com/opencontainers/runc/libcontainer/specconv"
@@ -65,7 +66,31 @@ generate a proper rootless spec file.
 
 Note that --rootless is not needed when you execute runc as the root in a user namespace
 created by an unprivileged user.
+
+TEMPLATES:
+  The --template option selects the starter file to generate:
+
+  default          the starter file described above
+  rootless         a starter file for a rootless container, as with --rootless
+  rootless-netns   a starter file for a rootless container with its own network
+                   namespace, connected to the network of the host by pasta or
+                   slirp4netns, whichever is installed
+
+  The --cgroup-driver option adjusts the file for the cgroup driver the
+container is run with. The systemd cgroup driver is used by running the
+container with "runc --systemd-cgroup run", and is the default of this option
+in that case: "runc --systemd-cgroup spec". The unit of the container is then
+garbage collected by systemd even if the container failed, which requires
+systemd v236 or later.
+
+  The --seccomp option adds a seccomp profile: "minimal" allows all the
+syscalls but the ones administering the host, bypassing the isolation of the
+container, or often used to attack the kernel, such as mount, setns, bpf or
+kexec_load, which fail with EPERM.
 `,
+	Subcommands: []cli.Command{
+		specValidateCommand,
+	},
 	Flags: []cli.Flag{
 		cli.StringFlag{
 			Name:  "bundle, b",
@@ -76,16 +101,28 @@ created by an unprivileged user.
 			Name:  "rootless",
 			Usage: "generate a configuration for a rootless container",
 		},
+		cli.StringFlag{
+			Name:  "template",
+			Value: "default",
+			Usage: "the configuration to generate: default, rootless or rootless-netns",
+		},
+		cli.StringFlag{
+			Name:  "cgroup-driver",
+			Usage: "the cgroup driver to generate the configuration for: cgroupfs or systemd (default: systemd with --systemd-cgroup, cgroupfs otherwise)",
+		},
+		cli.StringFlag{
+			Name:  "seccomp",
+			Value: "none",
+			Usage: "the seccomp profile to add to the configuration: none or minimal",
+		},
 	},
 	Action: func(context *cli.Context) error {
 		if err := checkArgs(context, 0, exactArgs); err != nil {
 			return err
 		}
-		spec := specconv.Example()
-
-		rootless := context.Bool("rootless")
-		if rootless {
-			specconv.ToRootless(spec)
+		spec, err := specTemplate(context)
+		if err != nil {
+			return err
 		}
 
 		checkNoFile := func(name string) error {
@@ -115,6 +152,61 @@ created by an unprivileged user.
 	},
 }
 
+// specTemplate returns the spec selected by the template, cgroup-driver,
+// seccomp and rootless options of the spec command.
+func specTemplate(context *cli.Context) (*specs.Spec, error) {
+	spec := specconv.Example()
+
+	template := context.String("template")
+	switch template {
+	case "default":
+		if context.Bool("rootless") {
+			specconv.ToRootless(spec)
+		}
+	case "rootless":
+		specconv.ToRootless(spec)
+	case "rootless-netns":
+		specconv.ToRootless(spec)
+		helper := ""
+		for _, h := range []string{"pasta", "slirp4netns"} {
+			if _, err := exec.LookPath(h); err == nil {
+				helper = h
+				break
+			}
+		}
+		if helper == "" {
+			return nil, fmt.Errorf("template %s requires pasta or slirp4netns to be installed", template)
+		}
+		specconv.ToNetworkHelper(spec, helper)
+	default:
+		return nil, fmt.Errorf("unknown template %q", template)
+	}
+
+	driver := context.String("cgroup-driver")
+	if driver == "" {
+		driver = "cgroupfs"
+		if context.GlobalBool("systemd-cgroup") {
+			driver = "systemd"
+		}
+	}
+	switch driver {
+	case "cgroupfs":
+	case "systemd":
+		specconv.ToSystemdCgroup(spec)
+	default:
+		return nil, fmt.Errorf("unknown cgroup driver %q", driver)
+	}
+
+	switch profile := context.String("seccomp"); profile {
+	case "none":
+	case "minimal":
+		spec.Linux.Seccomp = specconv.MinimalSeccomp()
+	default:
+		return nil, fmt.Errorf("unknown seccomp profile %q", profile)
+	}
+	return spec, nil
+}
+
 // loadSpec loads the specification from the provided path.
 func loadSpec(cPath string) (spec *specs.Spec, err error) {
 	cf, err := os.Open(cPath)
@@ -132,6 +224,80 @@ func loadSpec(cPath string) (spec *specs.Spec, err error) {
 	return spec, validateProcessSpec(spec.Process)
 }
 
+// processExtensions are the fields of the process specification which are
+// not known to the vendored runtime-spec package yet.
+type processExtensions struct {
+	// Scheduler are the scheduling attributes of the process.
+	Scheduler *configs.Scheduler `json:"scheduler"`
+	// IOPriority is the I/O priority of the process.
+	IOPriority *configs.IOPriority `json:"ioPriority"`
+}
+
+// specExtensions are the fields of the specification which are not known to
+// the vendored runtime-spec package yet.
+type specExtensions struct {
+	// Process are the extensions of the process (process).
+	Process processExtensions
+	// TimeOffsets are the clock offsets of the time namespace
+	// (linux.timeOffsets).
+	TimeOffsets map[string]configs.TimeOffset
+	// MemoryPolicy is the NUMA memory policy of the init process
+	// (linux.memoryPolicy).
+	MemoryPolicy *configs.MemoryPolicy
+	// Networks are the network interfaces (linux.networks) and Routes are
+	// the routes (linux.routes) to set up in the network namespace.
+	Networks []*configs.Network
+	Routes   []*configs.Route
+	// Raw is the JSON of the specification.
+	Raw json.RawMessage
+}
+
+// loadSpecExtensions loads the specExtensions from the specification file at
+// cPath.
+func loadSpecExtensions(cPath string) (*specExtensions, error) {
+	data, err := ioutil.ReadFile(cPath)
+	if err != nil {
+		return nil, err
+	}
+	var spec struct {
+		Process *processExtensions `json:"process"`
+		Linux   *struct {
+			TimeOffsets  map[string]configs.TimeOffset `json:"timeOffsets"`
+			MemoryPolicy *configs.MemoryPolicy         `json:"memoryPolicy"`
+			Networks     []*configs.Network            `json:"networks"`
+			Routes       []*configs.Route              `json:"routes"`
+		} `json:"linux"`
+	}
+	if err := json.Unmarshal(data, &spec); err != nil {
+		return nil, err
+	}
+	ext := &specExtensions{Raw: data}
+	if spec.Process != nil {
+		ext.Process = *spec.Process
+	}
+	if spec.Linux != nil {
+		ext.TimeOffsets = spec.Linux.TimeOffsets
+		ext.MemoryPolicy = spec.Linux.MemoryPolicy
+		ext.Networks = spec.Linux.Networks
+		ext.Routes = spec.Linux.Routes
+	}
+	return ext, nil
+}
+
+// loadProcessExtensions loads the processExtensions from the process
+// specification file at path, as used by runc exec --process.
+func loadProcessExtensions(path string) (*processExtensions, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var ext processExtensions
+	if err := json.Unmarshal(data, &ext); err != nil {
+		return nil, err
+	}
+	return &ext, nil
+}
+
 func createLibContainerRlimit(rlimit specs.POSIXRlimit) (configs.Rlimit, error) {
 	rl, err := strToRlimit(rlimit.Type)
 	if err != nil {
@@ -0,0 +1,311 @@
+// +build linux
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/opencontainers/runc/libcontainer"
+	"github.com/opencontainers/runc/libcontainer/apparmor"
+	"github.com/opencontainers/runc/libcontainer/cgroups"
+	"github.com/opencontainers/runc/libcontainer/configs"
+	"github.com/opencontainers/runc/libcontainer/configs/validate"
+	"github.com/opencontainers/runc/libcontainer/specconv"
+	"github.com/opencontainers/runc/types/validation"
+	"github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/urfave/cli"
+)
+
+var specValidateCommand = cli.Command{
+	Name:  "validate",
+	Usage: "validate the specification file of a bundle",
+	ArgsUsage: `[bundle]
+
+Where "[bundle]" is the path to the bundle directory, the current directory by
+default.`,
+	Description: `The validate command checks the specification file named "` + specConfig + `" of the
+bundle, and reports the problems found as JSON, each with a severity:
+
+  error     the creation of a container from the bundle would fail
+  warning   the container would not behave exactly as specified
+
+Besides the structure of the specification and the checks runc performs when
+creating a container, the specification is checked against the host: the
+namespaces supported by the kernel, the cgroup controllers available, and the
+seccomp support of runc and of the architecture of the host.
+
+The command exits with an error if any error is found.`,
+	Action: func(context *cli.Context) error {
+		if err := checkArgs(context, 1, maxArgs); err != nil {
+			return err
+		}
+		bundle := context.Args().First()
+		if bundle == "" {
+			bundle = "."
+		}
+		bundle, err := filepath.Abs(bundle)
+		if err != nil {
+			return err
+		}
+		if err := os.Chdir(bundle); err != nil {
+			return err
+		}
+		report := validation.Report{
+			Bundle:   bundle,
+			Valid:    true,
+			Findings: validateSpec(context, filepath.Base(bundle)),
+		}
+		for _, f := range report.Findings {
+			if f.Severity == validation.Error {
+				report.Valid = false
+			}
+		}
+
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "    ")
+		if err := enc.Encode(report); err != nil {
+			return err
+		}
+		if !report.Valid {
+			return fmt.Errorf("%s of bundle %s is not valid", specConfig, bundle)
+		}
+		return nil
+	},
+}
+
+// validateSpec returns the findings of the specification file in the current
+// directory, for a container named id.
+func validateSpec(context *cli.Context, id string) []validation.Finding {
+	findings := []validation.Finding{}
+	add := func(sev validation.Severity, check, field, format string, args ...interface{}) {
+		findings = append(findings, validation.Finding{
+			Severity: sev,
+			Check:    check,
+			Field:    field,
+			Message:  fmt.Sprintf(format, args...),
+		})
+	}
+
+	data, err := ioutil.ReadFile(specConfig)
+	if err != nil {
+		add(validation.Error, "schema", "", "%v", err)
+		return findings
+	}
+	var spec *specs.Spec
+	if err := json.Unmarshal(data, &spec); err != nil {
+		add(validation.Error, "schema", "", "invalid JSON: %v", err)
+		return findings
+	}
+	if spec == nil {
+		add(validation.Error, "schema", "", "the specification is empty")
+		return findings
+	}
+	if !validateSpecSchema(spec, add) {
+		// The conversion can't be done without the required fields.
+		return findings
+	}
+
+	if err := injectCDIDevices(context, spec); err != nil {
+		add(validation.Error, "cdi", "annotations", "%v", err)
+	}
+	ext, err := loadSpecExtensions(specConfig)
+	if err != nil {
+		add(validation.Error, "schema", "", "%v", err)
+		return findings
+	}
+	// The global --rootless option is shadowed by the one of runc spec.
+	global := context
+	for global.Parent() != nil {
+		global = global.Parent()
+	}
+	rootlessCg, err := shouldUseRootlessCgroupManager(global)
+	if err != nil {
+		add(validation.Error, "rootless", "", "%v", err)
+		return findings
+	}
+	config, err := specconv.CreateLibcontainerConfig(createOpts(context, id, spec, rootlessCg, ext))
+	if err != nil {
+		add(validation.Error, "conversion", "", "%v", err)
+		return findings
+	}
+	for _, f := range validate.Validate(config) {
+		add(validation.Error, f.Check, "", "%v", f.Err)
+	}
+
+	validateSpecHost(context, spec, config, add)
+	return findings
+}
+
+// findingFunc adds a finding about the field of the specification.
+type findingFunc func(sev validation.Severity, check, field, format string, args ...interface{})
+
+// validateSpecSchema checks the structure of the specification, as required
+// by the runtime-spec, and returns whether it has the fields required by its
+// conversion.
+func validateSpecSchema(spec *specs.Spec, add findingFunc) bool {
+	ok := true
+	fail := func(field, format string, args ...interface{}) {
+		add(validation.Error, "schema", field, format, args...)
+	}
+	required := func(field, format string, args ...interface{}) {
+		fail(field, format, args...)
+		ok = false
+	}
+
+	if spec.Version == "" {
+		fail("ociVersion", "ociVersion is required")
+	} else if major, minor, err := parseSpecVersion(spec.Version); err != nil {
+		fail("ociVersion", "%v", err)
+	} else if major != specs.VersionMajor {
+		fail("ociVersion", "version %s is not supported, runc supports version %d", spec.Version, specs.VersionMajor)
+	} else if minor > specs.VersionMinor {
+		add(validation.Warning, "schema", "ociVersion", "version %s is newer than the version %s supported by runc, the newer fields are ignored", spec.Version, specs.Version)
+	}
+
+	if spec.Root == nil || spec.Root.Path == "" {
+		required("root.path", "root.path is required")
+	}
+	if err := validateProcessSpec(spec.Process); err != nil {
+		required("process", "%v", err)
+	}
+	if spec.Linux == nil {
+		required("linux", "linux is required on Linux")
+	}
+	for i, m := range spec.Mounts {
+		field := fmt.Sprintf("mounts[%d].destination", i)
+		if !filepath.IsAbs(m.Destination) {
+			required(field, "destination %q is not an absolute path", m.Destination)
+		}
+	}
+	if spec.Hooks != nil {
+		for _, hooks := range []struct {
+			name  string
+			hooks []specs.Hook
+		}{
+			{"prestart", spec.Hooks.Prestart},
+			{"createRuntime", spec.Hooks.CreateRuntime},
+			{"createContainer", spec.Hooks.CreateContainer},
+			{"startContainer", spec.Hooks.StartContainer},
+			{"poststart", spec.Hooks.Poststart},
+			{"poststop", spec.Hooks.Poststop},
+		} {
+			for i, h := range hooks.hooks {
+				if !filepath.IsAbs(h.Path) {
+					fail(fmt.Sprintf("hooks.%s[%d].path", hooks.name, i), "hook path %q is not an absolute path", h.Path)
+				}
+			}
+		}
+	}
+	return ok
+}
+
+// parseSpecVersion returns the major and minor versions of the ociVersion v,
+// a SemVer such as "1.0.2-dev".
+func parseSpecVersion(v string) (int, int, error) {
+	parts := strings.SplitN(strings.SplitN(v, "-", 2)[0], ".", 3)
+	if len(parts) != 3 {
+		return 0, 0, fmt.Errorf("invalid version %q, it is not a SemVer", v)
+	}
+	var nums [3]int
+	for i, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 0 {
+			return 0, 0, fmt.Errorf("invalid version %q, it is not a SemVer", v)
+		}
+		nums[i] = n
+	}
+	return nums[0], nums[1], nil
+}
+
+// validateSpecHost checks that the host supports the features required by the
+// specification and its config.
+func validateSpecHost(context *cli.Context, spec *specs.Spec, config *configs.Config, add findingFunc) {
+	for _, ns := range config.Namespaces {
+		if !configs.IsNamespaceSupported(ns.Type) {
+			add(validation.Error, "namespaces", "linux.namespaces", "the kernel does not support %s namespaces", configs.NsName(ns.Type))
+		}
+	}
+
+	if controllers := cgroups.RequiredControllers(config.Cgroups.Resources); len(controllers) > 0 {
+		available := make(map[string]bool)
+		for _, c := range cgroupFeatures(context).Controllers {
+			available[c] = true
+		}
+		// The rootless cgroup managers ignore the controllers they can't
+		// use.
+		sev := validation.Error
+		if config.RootlessCgroups {
+			sev = validation.Warning
+		}
+		for _, c := range controllers {
+			if !available[c] {
+				field, ok := controllerFields[c]
+				if !ok {
+					field = "linux.resources"
+				}
+				add(sev, "controllers", field, "the %s cgroup controller is not available on the host", c)
+			}
+		}
+	}
+
+	if s := spec.Linux.Seccomp; s != nil {
+		if !seccompFeatures().Enabled {
+			add(validation.Error, "seccomp", "linux.seccomp", "runc is built without seccomp support")
+		}
+		if native := hostSeccompArchs(); native != nil {
+			for i, arch := range s.Architectures {
+				if !native[arch] {
+					add(validation.Warning, "seccomp", fmt.Sprintf("linux.seccomp.architectures[%d]", i), "the processes of the container can't use the syscalls of %s on the host, its rules are unused", arch)
+				}
+			}
+		}
+	}
+
+	if spec.Process.ApparmorProfile != "" && !apparmor.IsEnabled() {
+		add(validation.Error, "apparmor", "process.apparmorProfile", "AppArmor is not enabled on the host")
+	}
+
+	degradations, err := libcontainer.RootlessPreflight(config)
+	if err != nil {
+		add(validation.Warning, "rootless", "", "unable to check the rootless degradations: %v", err)
+	}
+	for _, d := range degradations {
+		add(validation.Warning, "rootless", "", "%s", d)
+	}
+}
+
+// controllerFields are the fields of the specification setting the resources
+// of the cgroup controllers, by controller.
+var controllerFields = map[string]string{
+	"memory":   "linux.resources.memory",
+	"cpu":      "linux.resources.cpu",
+	"cpuset":   "linux.resources.cpu",
+	"pids":     "linux.resources.pids",
+	"blkio":    "linux.resources.blockIO",
+	"io":       "linux.resources.blockIO",
+	"hugetlb":  "linux.resources.hugepageLimits",
+	"rdma":     "linux.resources.rdma",
+	"net_cls":  "linux.resources.network.classID",
+	"net_prio": "linux.resources.network.priorities",
+}
+
+// hostSeccompArchs returns the seccomp architectures of the syscalls which can
+// be made on the host (see specconv.NativeSeccompArchs), or nil if they are
+// unknown.
+func hostSeccompArchs() map[specs.Arch]bool {
+	archs := specconv.NativeSeccompArchs()
+	if archs == nil {
+		return nil
+	}
+	res := make(map[specs.Arch]bool, len(archs))
+	for _, a := range archs {
+		res[a] = true
+	}
+	return res
+}
@@ -0,0 +1,44 @@
+#!/usr/bin/env bats
+
+load helpers
+
+function setup() {
+	requires root apparmor
+	setup_busybox
+}
+
+function teardown() {
+	teardown_bundle
+	apparmor_parser --remove runc-test-profile 2>/dev/null || true
+}
+
+@test "runc run [apparmor profile file from bundle]" {
+	cat >profile <<EOF
+#include <tunables/global>
+
+profile runc-test-profile flags=(attach_disconnected,mediate_deleted) {
+  #include <abstractions/base>
+
+  file,
+  capability,
+  network,
+  deny /tmp/denied w,
+}
+EOF
+	update_config '.annotations += {"org.opencontainers.runc.apparmor.profile-file": "profile"}
+		| .process.args = ["sh", "-c", "cat /proc/self/attr/current; touch /tmp/denied"]'
+
+	runc run test_apparmor
+	[ "$status" -ne 0 ]
+	[[ "${lines[0]}" == "runc-test-profile (enforce)" ]]
+	[[ "${output}" == *"Permission denied"* ]]
+}
+
+@test "runc run [apparmor profile file from bundle, no profile]" {
+	echo "# no profile here" >profile
+	update_config '.annotations += {"org.opencontainers.runc.apparmor.profile-file": "profile"}'
+
+	runc run test_apparmor
+	[ "$status" -ne 0 ]
+	[[ "${output}" == *"no AppArmor profile is defined in profile"* ]]
+}
@@ -304,6 +304,97 @@ function simple_cr() {
 	ip netns del "$ns_name"
 }
 
+@test "checkpoint --external-netns and restore --netns" {
+	if ! "${CRIU}" check --feature external_net_ns; then
+		skip "this criu does not support external network namespaces"
+	fi
+
+	runc run -d --console-socket "$CONSOLE_SOCKET" test_busybox
+	[ "$status" -eq 0 ]
+
+	testcontainer test_busybox running
+
+	# the network namespace created by runc is dumped as an external one
+	runc --criu "$CRIU" checkpoint --external-netns --work-path ./work-dir test_busybox
+	grep -B 5 Error ./work-dir/dump.log || true
+	[ "$status" -eq 0 ]
+
+	testcontainer test_busybox checkpointed
+
+	# create the network namespace to restore the container into
+	tmp=$(mktemp)
+	rm -f "$tmp"
+	ns_name=$(basename "$tmp")
+	ip netns add "$ns_name"
+	ns_path=/var/run/netns/$ns_name
+	# shellcheck disable=SC2012
+	ns_inode=$(ls -iL "$ns_path" | awk '{ print $1 }')
+
+	runc --criu "$CRIU" restore -d --netns "$ns_path" --work-path ./work-dir --console-socket "$CONSOLE_SOCKET" test_busybox
+	grep -B 5 Error ./work-dir/restore.log || true
+	[ "$status" -eq 0 ]
+
+	testcontainer test_busybox running
+
+	pid=$(__runc state test_busybox | jq '.pid')
+	ns_inode_new=$(readlink /proc/"$pid"/ns/net | sed -e 's/.*\[\(.*\)\]/\1/')
+	[ "$ns_inode" -eq "$ns_inode_new" ]
+
+	runc delete --force test_busybox
+	ip netns del "$ns_name"
+}
+
+@test "restore --macvlan (bad value)" {
+	runc restore --macvlan eth0 test_busybox
+	[ "$status" -ne 0 ]
+	[[ "${output}" == *"must be CONTAINER_IF=HOST_IF"* ]]
+}
+
+@test "restore --ext-mount (relative path)" {
+	runc restore --ext-mount data=/srv/data test_busybox
+	[ "$status" -ne 0 ]
+	[[ "${output}" == *"the container path must be absolute"* ]]
+}
+
+@test "restore (bad external annotation)" {
+	update_config '.annotations["org.opencontainers.runc.checkpoint.external"] = "unix"'
+	runc restore test_busybox
+	[ "$status" -ne 0 ]
+	[[ "${output}" == *"invalid org.opencontainers.runc.checkpoint.external annotation"* ]]
+}
+
+@test "checkpoint and restore with --memory and --pids-limit" {
+	set_cgroups_path
+
+	runc run -d --console-socket "$CONSOLE_SOCKET" test_busybox
+	[ "$status" -eq 0 ]
+
+	testcontainer test_busybox running
+
+	runc --criu "$CRIU" checkpoint --work-path ./work-dir test_busybox
+	grep -B 5 Error ./work-dir/dump.log || true
+	[ "$status" -eq 0 ]
+
+	runc --criu "$CRIU" restore -d --memory 64M --pids-limit 42 --work-path ./work-dir --console-socket "$CONSOLE_SOCKET" test_busybox
+	grep -B 5 Error ./work-dir/restore.log || true
+	[ "$status" -eq 0 ]
+
+	testcontainer test_busybox running
+
+	check_cgroup_value "pids.max" 42
+	if [ "$CGROUP_UNIFIED" = "yes" ]; then
+		check_cgroup_value "memory.max" 67108864
+	else
+		check_cgroup_value "memory.limit_in_bytes" 67108864
+	fi
+}
+
+@test "restore --memory (bad value)" {
+	runc restore --memory 64X test_busybox
+	[ "$status" -ne 0 ]
+	[[ "${output}" == *"invalid value for memory"* ]]
+}
+
 @test "checkpoint and restore with container specific CRIU config" {
 	tmp=$(mktemp /tmp/runc-criu-XXXXXX.conf)
 	# This is the file we write to /etc/criu/default.conf
@@ -54,6 +54,33 @@ function teardown() {
 	[[ "${output}" == *'Operation not permitted'* ]]
 }
 
+@test "runc update [device cgroup allow rw char device]" {
+	requires root
+
+	update_config ' .linux.resources.devices = [{"allow": false, "access": "rwm"}]
+			| .linux.devices = [{"path": "/dev/kmsg", "type": "c", "major": 1, "minor": 11}]
+			| .process.args |= ["sh"]'
+
+	runc run -d --console-socket "$CONSOLE_SOCKET" test_update_allow
+	[ "$status" -eq 0 ]
+
+	runc exec test_update_allow sh -c 'head -n 1 /dev/kmsg'
+	[ "$status" -eq 1 ]
+	[[ "${output}" == *'Operation not permitted'* ]]
+
+	runc update -r - test_update_allow <<EOF
+{"devices": [{"allow": false, "access": "rwm"}, {"allow": true, "type": "c", "major": 1, "minor": 11, "access": "rw"}]}
+EOF
+	[ "$status" -eq 0 ]
+
+	runc exec test_update_allow sh -c 'head -n 1 /dev/kmsg'
+	[ "$status" -eq 0 ]
+
+	# The default devices are still allowed.
+	runc exec test_update_allow sh -c 'echo >/dev/null'
+	[ "$status" -eq 0 ]
+}
+
 @test "runc run [device cgroup allow rw char device]" {
 	requires root
 
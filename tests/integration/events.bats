@@ -58,6 +58,26 @@ function test_events() {
 	[[ "$output" == *"data"* ]]
 }
 
+@test "events --stats --device-stats-plugin" {
+	# XXX: currently cgroups require root containers.
+	requires root
+	init_cgroup_paths
+
+	cat >plugin.sh <<'EOF'
+#!/bin/sh
+cat >/dev/null
+echo '[{"path": "/dev/null", "major": 1, "minor": 3, "metrics": {"opens": 7}}]'
+EOF
+	chmod +x plugin.sh
+
+	runc run -d --console-socket "$CONSOLE_SOCKET" test_busybox
+	[ "$status" -eq 0 ]
+
+	runc events --stats --device-stats-plugin "$(pwd)/plugin.sh" test_busybox
+	[ "$status" -eq 0 ]
+	[ "$(echo "${lines[0]}" | jq -c '.data.devices')" = '[{"provider":"plugin.sh","path":"/dev/null","major":1,"minor":3,"metrics":{"opens":7}}]' ]
+}
+
 @test "events --interval default" {
 	test_events
 }
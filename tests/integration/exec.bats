@@ -109,6 +109,24 @@ function teardown() {
 	[[ "${output}" == "uid=1000 gid=1000"* ]]
 }
 
+@test "runc exec --user-from-image" {
+	# --user can't work in rootless containers that don't have idmap.
+	[[ "$ROOTLESS" -ne 0 ]] && requires rootless_idmap
+
+	# run busybox detached
+	runc run -d --console-socket "$CONSOLE_SOCKET" test_busybox
+	[ "$status" -eq 0 ]
+
+	runc exec --user-from-image --user nobody test_busybox sh -c 'id -u; echo $HOME'
+	[ "$status" -eq 0 ]
+
+	[[ "${lines[0]}" == "65534" ]]
+	[[ "${lines[1]}" == "/home" ]]
+
+	runc exec --user-from-image --user nosuchuser test_busybox true
+	[ "$status" -ne 0 ]
+}
+
 @test "runc exec --additional-gids" {
 	requires root
 
@@ -137,6 +155,34 @@ function teardown() {
 	[[ "${output}" == "hello" ]]
 }
 
+@test "runc exec --cgroup" {
+	requires root cgroups_v1
+	set_cgroups_path
+
+	runc run -d --console-socket "$CONSOLE_SOCKET" test_busybox
+	[ "$status" -eq 0 ]
+
+	runc exec -d --cgroup monitoring --cgroup-memory 32M test_busybox sleep 1000
+	[ "$status" -eq 0 ]
+
+	REL_CGROUPS_PATH="$REL_CGROUPS_PATH/monitoring"
+	check_cgroup_value "memory.limit_in_bytes" 33554432
+
+	runc exec --cgroup-memory 32M test_busybox true
+	[ "$status" -ne 0 ]
+}
+
+@test "runc exec --cgroup [v2]" {
+	requires root cgroups_v2
+
+	runc run -d --console-socket "$CONSOLE_SOCKET" test_busybox
+	[ "$status" -eq 0 ]
+
+	runc exec --cgroup monitoring test_busybox true
+	[ "$status" -ne 0 ]
+	[[ "$output" == *"only supported on cgroup v1"* ]]
+}
+
 function check_exec_debug() {
 	[[ "$*" == *"nsexec container setup"* ]]
 	[[ "$*" == *"child process in init()"* ]]
@@ -353,6 +353,11 @@ function requires() {
 				skip_me=1
 			fi
 			;;
+		apparmor)
+			if [ ! -e /sys/kernel/security/apparmor ] || ! command -v apparmor_parser >/dev/null; then
+				skip_me=1
+			fi
+			;;
 		smp)
 			local cpu_count=$(grep -c '^processor' /proc/cpuinfo)
 			if [ "$cpu_count" -lt 2 ]; then
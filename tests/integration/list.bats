@@ -53,3 +53,30 @@ function teardown() {
 	[[ "${lines[0]}" == *[,][\{]"\"ociVersion\""[:]"\""*[0-9][\.]*[0-9][\.]*[0-9]*"\""[,]"\"id\""[:]"\"test_box2\""[,]"\"pid\""[:]*[0-9][,]"\"status\""[:]*"\"running\""[,]"\"bundle\""[:]*$bundle*[,]"\"rootfs\""[:]"\""*"\""[,]"\"created\""[:]*[0-9]*[\}]* ]]
 	[[ "${lines[0]}" == *[,][\{]"\"ociVersion\""[:]"\""*[0-9][\.]*[0-9][\.]*[0-9]*"\""[,]"\"id\""[:]"\"test_box3\""[,]"\"pid\""[:]*[0-9][,]"\"status\""[:]*"\"running\""[,]"\"bundle\""[:]*$bundle*[,]"\"rootfs\""[:]"\""*"\""[,]"\"created\""[:]*[0-9]*[\}][\]] ]]
 }
+
+@test "list --filter --sort --format" {
+	bundle=$(pwd)
+	update_config '.annotations = {"group": "a"}'
+	ROOT=$ALT_ROOT runc run -d --console-socket "$CONSOLE_SOCKET" test_box1
+	[ "$status" -eq 0 ]
+	ROOT=$ALT_ROOT runc run -d --console-socket "$CONSOLE_SOCKET" test_box2
+	[ "$status" -eq 0 ]
+	update_config '.annotations = {"group": "b"}'
+	ROOT=$ALT_ROOT runc create --console-socket "$CONSOLE_SOCKET" test_box3
+	[ "$status" -eq 0 ]
+
+	ROOT=$ALT_ROOT runc list --filter status=running -q
+	[ "$status" -eq 0 ]
+	[ "$output" = $'test_box1\ntest_box2' ]
+
+	ROOT=$ALT_ROOT runc list --filter annotation=group=b --filter bundle="$bundle" -q
+	[ "$status" -eq 0 ]
+	[ "$output" = "test_box3" ]
+
+	ROOT=$ALT_ROOT runc list --sort created --format '{{.ID}} {{.Status}}'
+	[ "$status" -eq 0 ]
+	[ "$output" = $'test_box3 created\ntest_box2 running\ntest_box1 running' ]
+
+	ROOT=$ALT_ROOT runc list --filter status=bogus
+	[ "$status" -ne 0 ]
+}
@@ -43,6 +43,39 @@ function teardown() {
 	[[ ${lines[0]} =~ [0-9]+ ]]
 }
 
+@test "ps -f json-full" {
+	# ps is not supported, it requires cgroups
+	requires root
+
+	runc run -d --console-socket "$CONSOLE_SOCKET" test_busybox
+	[ "$status" -eq 0 ]
+
+	runc ps -f json-full test_busybox
+	[ "$status" -eq 0 ]
+
+	pid=$(__runc state test_busybox | jq '.pid')
+	[ "$(echo "$output" | jq ".[] | select(.pid == $pid) | .exec")" = "false" ]
+	[ "$(echo "$output" | jq -r ".[] | select(.pid == $pid) | .comm")" = "sh" ]
+}
+
+@test "ps -f json-full with exec" {
+	# ps is not supported, it requires cgroups
+	requires root
+
+	runc run -d --console-socket "$CONSOLE_SOCKET" test_busybox
+	[ "$status" -eq 0 ]
+
+	runc exec -d test_busybox sleep 1000
+	[ "$status" -eq 0 ]
+
+	runc ps -f json-full test_busybox
+	[ "$status" -eq 0 ]
+	[ "$(echo "$output" | jq -r '.[] | select(.comm == "sleep") | .exec')" = "true" ]
+
+	runc ps -f json-full test_busybox -ef
+	[ "$status" -ne 0 ]
+}
+
 @test "ps -e -x" {
 	# ps is not supported, it requires cgroups
 	requires root
@@ -38,3 +38,35 @@ function teardown() {
 
 	./validate "$SCHEMA" config.json
 }
+
+@test "runc spec validate" {
+	runc spec validate
+	[ "$status" -eq 0 ]
+	[[ "$output" == *'"valid": true'* ]]
+
+	runc spec validate "$(pwd)"
+	[ "$status" -eq 0 ]
+}
+
+@test "runc spec validate [invalid spec]" {
+	update_config '.ociVersion = "2.0.0" | .hooks.prestart = [{"path": "hook"}]'
+
+	runc spec validate
+	[ "$status" -ne 0 ]
+	[[ "$output" == *'"field": "ociVersion"'* ]]
+	[[ "$output" == *'"field": "hooks.prestart[0].path"'* ]]
+	[[ "$output" == *'"severity": "error"'* ]]
+}
+
+@test "runc spec --template --cgroup-driver --seccomp" {
+	mkdir template
+	runc spec --bundle template --cgroup-driver systemd --seccomp minimal
+	[ "$status" -eq 0 ]
+	[ "$(jq -r '.linux.seccomp.defaultAction' template/config.json)" = "SCMP_ACT_ALLOW" ]
+	[ "$(jq -r '.annotations["org.systemd.property.CollectMode"]' template/config.json)" = "'inactive-or-failed'" ]
+
+	rm template/config.json
+	runc spec --bundle template --template unknown
+	[ "$status" -ne 0 ]
+	[[ "$output" == *"unknown template"* ]]
+}
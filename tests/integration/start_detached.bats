@@ -68,3 +68,18 @@ function teardown() {
 
 	[[ "$(cat pid.txt)" == $(__runc state test_busybox | jq '.pid') ]]
 }
+
+@test "runc run detached --stdout with rotation" {
+	update_config ' (.. | select(.terminal? != null)) .terminal |= false
+			| .process.args |= ["sh", "-c", "for i in 1 2 3 4 5; do echo line$i; sleep 0.1; done"]'
+
+	runc run -d --stdout out.log --stdio-max-size 10 --stdio-max-files 2 test_busybox
+	[ "$status" -eq 0 ]
+
+	wait_for_container 15 1 test_busybox stopped
+	# The forwarder exits once the container closed its stdout.
+	retry 10 0.5 [ "$(cat out.log)" = "line5" ]
+	[ "$(cat out.log.1)" = "line4" ]
+	[ "$(cat out.log.2)" = "line3" ]
+	[ ! -e out.log.3 ]
+}
@@ -0,0 +1,39 @@
+#!/usr/bin/env bats
+
+load helpers
+
+function setup() {
+	setup_busybox
+}
+
+function teardown() {
+	teardown_bundle
+}
+
+@test "top" {
+	# top requires cgroups
+	requires root
+
+	runc run -d --console-socket "$CONSOLE_SOCKET" test_busybox
+	[ "$status" -eq 0 ]
+
+	runc top --interval 100ms test_busybox
+	[ "$status" -eq 0 ]
+	[[ ${lines[0]} =~ CPU:\ +[0-9.]+%\ +MEMORY:\ +.*PIDS:\ +[0-9]+ ]]
+	[[ ${lines[1]} =~ PID\ +COMM\ +%CPU\ +RSS\ +THREADS\ +FDS ]]
+	[[ ${lines[2]} =~ [0-9]+\ +sh\ + ]]
+}
+
+@test "top -f json" {
+	# top requires cgroups
+	requires root
+
+	runc run -d --console-socket "$CONSOLE_SOCKET" test_busybox
+	[ "$status" -eq 0 ]
+
+	runc top -f json --interval 100ms test_busybox
+	[ "$status" -eq 0 ]
+	pid=$(__runc state test_busybox | jq '.pid')
+	[ "$(echo "$output" | jq -r ".processes[] | select(.pid == $pid) | .comm")" = "sh" ]
+	[ "$(echo "$output" | jq ".processes[] | select(.pid == $pid) | .threads")" -eq 1 ]
+}
@@ -608,12 +608,14 @@ EOF
 	cat "$CONTAINER_OUTPUT"
 	[ "$status" -eq 0 ]
 
-	# Trigger an update. This update doesn't actually change the device rules,
-	# but it will trigger the devices cgroup code to reapply the current rules.
-	# We trigger the update a few times to make sure we hit the race.
-	for _ in {1..12}; do
-		# TODO: Update "runc update" so we can change the device rules.
-		runc update --pids-limit 30 test_update
+	# Trigger an update of the device rules, which makes the devices cgroup
+	# code reapply the rules. /dev/null is allowed by default, so writes to it
+	# should never fail. We trigger the update a few times to make sure we hit
+	# the race.
+	for minor in {1..12}; do
+		runc update -r - test_update <<EOF
+{"devices": [{"allow": false, "access": "rwm"}, {"allow": true, "type": "c", "major": 1, "minor": $minor, "access": "r"}]}
+EOF
 		[ "$status" -eq 0 ]
 	done
 
@@ -652,11 +654,8 @@ EOF
 @test "runc update replaces devices cgroup program" {
 	[[ "$ROOTLESS" -ne 0 ]] && requires rootless_cgroup
 
-	# Unfortunately we can't update device rules directly with runc ("runc
-	# update" doesn't support it, and adding support would require ironing out
-	# some long-standing design issues with device configuration). So instead
-	# we just run "runc update" many times, relying on the fact that runc will
-	# re-apply devices cgroup rules on each runc update.
+	# Run "runc update" many times, changing the device rules every time so
+	# that runc re-applies the devices cgroup rules.
 	#
 	# In the past runc would not delete old cgroupv2 eBPF programs, so this
 	# test ensures that once we go past the program limit (64 stacked programs
@@ -666,11 +665,27 @@ EOF
 	runc run -d --console-socket "$CONSOLE_SOCKET" test_update
 	[ "$status" -eq 0 ]
 
-	for new_limit in $(seq 300); do
-		runc update --pids-limit "$((2 * new_limit))" test_update
+	for minor in $(seq 300); do
+		runc update -r - test_update <<EOF
+{"devices": [{"allow": false, "access": "rwm"}, {"allow": true, "type": "c", "major": 1, "minor": $minor, "access": "r"}]}
+EOF
 		[ "$status" -eq 0 ]
 	done
 
 	# The container should still be running.
 	testcontainer test_update running
 }
+
+@test "update --memory-reclaim with --resources" {
+	[[ "$ROOTLESS" -ne 0 ]] && requires rootless_cgroup
+
+	runc run -d --console-socket "$CONSOLE_SOCKET" test_update
+	[ "$status" -eq 0 ]
+
+	# --memory-reclaim is not ignored along with --resources.
+	runc update --memory-reclaim 0 -r - test_update <<EOF
+{}
+EOF
+	[ "$status" -ne 0 ]
+	[[ "$output" == *"invalid value for memory-reclaim"* ]]
+}
@@ -0,0 +1,202 @@
+// +build linux
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	units "github.com/docker/go-units"
+	"github.com/opencontainers/runc/libcontainer"
+	"github.com/opencontainers/runc/libcontainer/system"
+	"github.com/urfave/cli"
+)
+
+// clockTicks is the number of clock ticks per second of the times in
+// /proc/<pid>/stat, which is 100 on all the architectures supported by
+// runc (the value of sysconf(_SC_CLK_TCK) can't be read without cgo).
+const clockTicks = 100
+
+// topProcess is the resource usage of a process of a container, as output by
+// runc top.
+type topProcess struct {
+	PID  int    `json:"pid"`
+	Comm string `json:"comm"`
+	// CPU is the percentage of a CPU used by the process during the
+	// sampling interval.
+	CPU float64 `json:"cpu_percent"`
+	// RSS is the resident set size of the process, in bytes.
+	RSS     uint64 `json:"rss"`
+	Threads int    `json:"threads"`
+	// FDs is the number of file descriptors open by the process, or -1 if
+	// they can't be read.
+	FDs int `json:"fds"`
+}
+
+// topSnapshot is the resource usage of a container, as output by runc top.
+type topSnapshot struct {
+	// CPU is the percentage of a CPU used by the container during the
+	// sampling interval.
+	CPU float64 `json:"cpu_percent"`
+	// Memory is the memory usage of the container (of its cgroup), in
+	// bytes.
+	Memory    uint64       `json:"memory"`
+	Pids      uint64       `json:"pids"`
+	Processes []topProcess `json:"processes"`
+}
+
+var topCommand = cli.Command{
+	Name:  "top",
+	Usage: "display the resource usage of a container and of its processes",
+	ArgsUsage: `<container-id>
+
+Where "<container-id>" is the name for the instance of the container.`,
+	Description: `The top command samples the resource usage of the container (of its cgroup)
+and of each of its processes twice, separated by the --interval, and displays
+the CPU usage during the interval, the memory usage, and the numbers of
+threads and of open file descriptors, from the process using the most CPU.`,
+	Flags: []cli.Flag{
+		cli.DurationFlag{
+			Name:  "interval",
+			Value: time.Second,
+			Usage: "time between the samples of the CPU usage",
+		},
+		cli.StringFlag{
+			Name:  "format, f",
+			Value: "table",
+			Usage: `select one of: table or json`,
+		},
+	},
+	Action: func(context *cli.Context) error {
+		if err := checkArgs(context, 1, exactArgs); err != nil {
+			return err
+		}
+		interval := context.Duration("interval")
+		if interval <= 0 {
+			return errors.New("interval must be greater than 0")
+		}
+		format := context.String("format")
+		if format != "table" && format != "json" {
+			return errors.New("invalid format option")
+		}
+		container, err := getContainer(context)
+		if err != nil {
+			return err
+		}
+		status, err := container.Status()
+		if err != nil {
+			return err
+		}
+		if status == libcontainer.Stopped {
+			return errors.New("container is stopped")
+		}
+		snapshot, err := getTopSnapshot(container, interval)
+		if err != nil {
+			return err
+		}
+
+		if format == "json" {
+			return json.NewEncoder(os.Stdout).Encode(snapshot)
+		}
+		fmt.Printf("CPU: %.1f%%   MEMORY: %s   PIDS: %d\n\n", snapshot.CPU, units.BytesSize(float64(snapshot.Memory)), snapshot.Pids)
+		w := tabwriter.NewWriter(os.Stdout, 6, 1, 3, ' ', 0)
+		fmt.Fprint(w, "PID\tCOMM\t%CPU\tRSS\tTHREADS\tFDS\n")
+		for _, p := range snapshot.Processes {
+			fds := strconv.Itoa(p.FDs)
+			if p.FDs < 0 {
+				fds = "-"
+			}
+			fmt.Fprintf(w, "%d\t%s\t%.1f\t%s\t%d\t%s\n", p.PID, p.Comm, p.CPU, units.BytesSize(float64(p.RSS)), p.Threads, fds)
+		}
+		return w.Flush()
+	},
+}
+
+// getTopSnapshot samples the resource usage of the container twice,
+// separated by interval.
+func getTopSnapshot(container libcontainer.Container, interval time.Duration) (*topSnapshot, error) {
+	stats, err := container.Stats()
+	if err != nil {
+		return nil, err
+	}
+	pids, err := container.Processes()
+	if err != nil {
+		return nil, err
+	}
+	start := time.Now()
+	before := make(map[int]system.Stat_t, len(pids))
+	for _, pid := range pids {
+		if stat, err := system.Stat(pid); err == nil {
+			before[pid] = stat
+		}
+	}
+
+	time.Sleep(interval)
+
+	stats2, err := container.Stats()
+	if err != nil {
+		return nil, err
+	}
+	pids, err = container.Processes()
+	if err != nil {
+		return nil, err
+	}
+	elapsed := time.Since(start)
+
+	snapshot := &topSnapshot{Processes: []topProcess{}}
+	if cg := stats2.CgroupStats; cg != nil {
+		snapshot.Memory = cg.MemoryStats.Usage.Usage
+		snapshot.Pids = cg.PidsStats.Current
+		if stats.CgroupStats != nil {
+			usage := cg.CpuStats.CpuUsage.TotalUsage - stats.CgroupStats.CpuStats.CpuUsage.TotalUsage
+			snapshot.CPU = cpuPercent(float64(usage), elapsed)
+		}
+	}
+	pageSize := uint64(os.Getpagesize())
+	for _, pid := range pids {
+		stat, err := system.Stat(pid)
+		if err != nil {
+			// The process exited in the meantime.
+			continue
+		}
+		ticks := stat.UTime + stat.STime
+		// The processes started during the interval are accounted from
+		// their start.
+		if prev, ok := before[pid]; ok && prev.StartTime == stat.StartTime {
+			ticks -= prev.UTime + prev.STime
+		}
+		fds := -1
+		if entries, err := ioutil.ReadDir("/proc/" + strconv.Itoa(pid) + "/fd"); err == nil {
+			fds = len(entries)
+		}
+		snapshot.Processes = append(snapshot.Processes, topProcess{
+			PID:     pid,
+			Comm:    stat.Name,
+			CPU:     cpuPercent(float64(ticks)*float64(time.Second)/clockTicks, elapsed),
+			RSS:     stat.RSS * pageSize,
+			Threads: stat.NumThreads,
+			FDs:     fds,
+		})
+	}
+	sort.SliceStable(snapshot.Processes, func(i, j int) bool {
+		a, b := snapshot.Processes[i], snapshot.Processes[j]
+		if a.CPU != b.CPU {
+			return a.CPU > b.CPU
+		}
+		return a.PID < b.PID
+	})
+	return snapshot, nil
+}
+
+// cpuPercent returns the percentage of a CPU used by usage nanoseconds of
+// CPU time during elapsed.
+func cpuPercent(usage float64, elapsed time.Duration) float64 {
+	return usage / float64(elapsed) * 100
+}
@@ -33,17 +33,24 @@ func (t *tty) copyIO(w io.Writer, r io.ReadCloser) {
 
 // setup pipes for the process so that advanced features like c/r are able to easily checkpoint
 // and restore the process's IO without depending on a host specific path or device
-func setupProcessPipes(p *libcontainer.Process, rootuid, rootgid int) (*tty, error) {
+func setupProcessPipes(p *libcontainer.Process, rootuid, rootgid int, logs *stdioLogs) (*tty, error) {
+	stdout, stderr, logClosers, err := logs.writers()
+	if err != nil {
+		return nil, err
+	}
 	i, err := p.InitializeIO(rootuid, rootgid)
 	if err != nil {
+		for _, c := range logClosers {
+			_ = c.Close()
+		}
 		return nil, err
 	}
 	t := &tty{
-		closers: []io.Closer{
+		closers: append([]io.Closer{
 			i.Stdin,
 			i.Stdout,
 			i.Stderr,
-		},
+		}, logClosers...),
 	}
 	// add the process's io to the post start closers if they support close
 	for _, cc := range []interface{}{
@@ -60,8 +67,8 @@ func setupProcessPipes(p *libcontainer.Process, rootuid, rootgid int) (*tty, err
 		_ = i.Stdin.Close()
 	}()
 	t.wg.Add(2)
-	go t.copyIO(os.Stdout, i.Stdout)
-	go t.copyIO(os.Stderr, i.Stderr)
+	go t.copyIO(stdout, i.Stdout)
+	go t.copyIO(stderr, i.Stderr)
 	return t, nil
 }
 
@@ -9,6 +9,40 @@ type Event struct {
 	Data interface{} `json:"data,omitempty"`
 }
 
+// Pressure is the data of a "pressure" event, describing the PSI trigger
+// which fired.
+type Pressure struct {
+	// Resource is the stalled resource: "cpu", "memory" or "io".
+	Resource string `json:"resource"`
+	// Type is the stall type: "some" or "full".
+	Type string `json:"type"`
+	// Threshold is the stall time of the trigger, in microseconds.
+	Threshold uint64 `json:"threshold"`
+	// Window is the time window of the trigger, in microseconds.
+	Window uint64 `json:"window"`
+}
+
+// OOMKill is the data of an "oom_kill" event.
+type OOMKill struct {
+	// Count is the number of processes killed since the previous event.
+	Count uint64 `json:"count"`
+	// Total is the number of processes killed since the container started.
+	Total uint64 `json:"total,omitempty"`
+}
+
+// DeviceDenied is the data of a "device_denied" event, describing an access
+// to a device denied to a process of the container.
+type DeviceDenied struct {
+	// Pid is the pid of the process, in the initial pid namespace.
+	Pid int `json:"pid"`
+	// Type is the device type: "c" or "b".
+	Type  string `json:"type"`
+	Major int64  `json:"major"`
+	Minor int64  `json:"minor"`
+	// Access is the denied access: a combination of "r", "w" and "m".
+	Access string `json:"access"`
+}
+
 // stats is the runc specific stats structure for stability when encoding and decoding stats.
 type Stats struct {
 	CPU               Cpu                 `json:"cpu"`
@@ -16,15 +50,49 @@ type Stats struct {
 	Memory            Memory              `json:"memory"`
 	Pids              Pids                `json:"pids"`
 	Blkio             Blkio               `json:"blkio"`
+	Rdma              Rdma                `json:"rdma,omitempty"`
 	Hugetlb           map[string]Hugetlb  `json:"hugetlb"`
+	Misc              map[string]Misc     `json:"misc,omitempty"`
 	IntelRdt          IntelRdt            `json:"intel_rdt"`
 	NetworkInterfaces []*NetworkInterface `json:"network_interfaces"`
+	Devices           []DeviceStats       `json:"devices,omitempty"`
 }
 
 type Hugetlb struct {
 	Usage   uint64 `json:"usage,omitempty"`
 	Max     uint64 `json:"max,omitempty"`
 	Failcnt uint64 `json:"failcnt"`
+	// Usage, maximum usage and number of failures of the reservations.
+	RsvdUsage   uint64 `json:"rsvd_usage,omitempty"`
+	RsvdMax     uint64 `json:"rsvd_max,omitempty"`
+	RsvdFailcnt uint64 `json:"rsvd_failcnt,omitempty"`
+}
+
+type RdmaEntry struct {
+	Device     string `json:"device,omitempty"`
+	HcaHandles uint32 `json:"hca_handles,omitempty"`
+	HcaObjects uint32 `json:"hca_objects,omitempty"`
+}
+
+type Rdma struct {
+	RdmaLimit   []RdmaEntry `json:"rdma_limit,omitempty"`
+	RdmaCurrent []RdmaEntry `json:"rdma_current,omitempty"`
+}
+
+type Misc struct {
+	Usage  uint64 `json:"usage,omitempty"`
+	Limit  uint64 `json:"limit,omitempty"`
+	Events uint64 `json:"events,omitempty"`
+}
+
+// DeviceStats are the stats of a device of the container, such as a GPU,
+// contributed by a device stats provider.
+type DeviceStats struct {
+	Provider string            `json:"provider,omitempty"`
+	Path     string            `json:"path,omitempty"`
+	Major    int64             `json:"major"`
+	Minor    int64             `json:"minor"`
+	Metrics  map[string]uint64 `json:"metrics,omitempty"`
 }
 
 type BlkioEntry struct {
@@ -43,6 +111,7 @@ type Blkio struct {
 	IoMergedRecursive       []BlkioEntry `json:"ioMergedRecursive,omitempty"`
 	IoTimeRecursive         []BlkioEntry `json:"ioTimeRecursive,omitempty"`
 	SectorsRecursive        []BlkioEntry `json:"sectorsRecursive,omitempty"`
+	PSI                     *PSIStats    `json:"psi,omitempty"`
 }
 
 type Pids struct {
@@ -66,9 +135,28 @@ type CpuUsage struct {
 	User         uint64   `json:"user"`
 }
 
+type PSIData struct {
+	Avg10  float64 `json:"avg10"`
+	Avg60  float64 `json:"avg60"`
+	Avg300 float64 `json:"avg300"`
+	Total  uint64  `json:"total"`
+}
+
+type PSIStats struct {
+	Some PSIData `json:"some,omitempty"`
+	Full PSIData `json:"full,omitempty"`
+}
+
+type Burst struct {
+	BurstsPeriods uint64 `json:"burstsPeriods,omitempty"`
+	BurstTime     uint64 `json:"burstTime,omitempty"`
+}
+
 type Cpu struct {
 	Usage      CpuUsage   `json:"usage,omitempty"`
 	Throttling Throttling `json:"throttling,omitempty"`
+	Burst      Burst      `json:"burst,omitempty"`
+	PSI        *PSIStats  `json:"psi,omitempty"`
 }
 
 type CPUSet struct {
@@ -83,6 +171,9 @@ type CPUSet struct {
 	MemoryPressure        uint64   `json:"memory_pressure"`
 	SchedLoadBalance      uint64   `json:"sched_load_balance"`
 	SchedRelaxDomainLevel int64    `json:"sched_relax_domain_level"`
+	Partition             string   `json:"partition,omitempty"`
+	EffectiveCPUs         []uint16 `json:"effective_cpus,omitempty"`
+	EffectiveMems         []uint16 `json:"effective_mems,omitempty"`
 }
 
 type MemoryEntry struct {
@@ -93,12 +184,36 @@ type MemoryEntry struct {
 }
 
 type Memory struct {
-	Cache     uint64            `json:"cache,omitempty"`
-	Usage     MemoryEntry       `json:"usage,omitempty"`
-	Swap      MemoryEntry       `json:"swap,omitempty"`
-	Kernel    MemoryEntry       `json:"kernel,omitempty"`
-	KernelTCP MemoryEntry       `json:"kernelTCP,omitempty"`
-	Raw       map[string]uint64 `json:"raw,omitempty"`
+	Cache       uint64            `json:"cache,omitempty"`
+	Usage       MemoryEntry       `json:"usage,omitempty"`
+	Swap        MemoryEntry       `json:"swap,omitempty"`
+	SwapOnly    MemoryEntry       `json:"swapOnly,omitempty"`
+	Zswap       MemoryEntry       `json:"zswap,omitempty"`
+	Kernel      MemoryEntry       `json:"kernel,omitempty"`
+	KernelTCP   MemoryEntry       `json:"kernelTCP,omitempty"`
+	Raw         map[string]uint64 `json:"raw,omitempty"`
+	PSI         *PSIStats         `json:"psi,omitempty"`
+	Events      *MemoryEvents     `json:"events,omitempty"`
+	EventsLocal *MemoryEvents     `json:"eventsLocal,omitempty"`
+	// NUMA is the memory usage by NUMA node id.
+	NUMA map[uint8]MemoryNUMA `json:"numa,omitempty"`
+}
+
+// MemoryNUMA is the memory usage on a NUMA node, in pages.
+type MemoryNUMA struct {
+	Total       uint64 `json:"total"`
+	Anon        uint64 `json:"anon"`
+	File        uint64 `json:"file"`
+	Unevictable uint64 `json:"unevictable"`
+}
+
+// MemoryEvents are the counters of memory.events (or memory.events.local).
+type MemoryEvents struct {
+	Low     uint64 `json:"low"`
+	High    uint64 `json:"high"`
+	Max     uint64 `json:"max"`
+	Oom     uint64 `json:"oom"`
+	OomKill uint64 `json:"oomKill"`
 }
 
 type L3CacheInfo struct {
@@ -107,6 +222,12 @@ type L3CacheInfo struct {
 	NumClosids uint64 `json:"num_closids,omitempty"`
 }
 
+type L2CacheInfo struct {
+	CbmMask    string `json:"cbm_mask,omitempty"`
+	MinCbmBits uint64 `json:"min_cbm_bits,omitempty"`
+	NumClosids uint64 `json:"num_closids,omitempty"`
+}
+
 type MemBwInfo struct {
 	BandwidthGran uint64 `json:"bandwidth_gran,omitempty"`
 	DelayLinear   uint64 `json:"delay_linear,omitempty"`
@@ -124,6 +245,15 @@ type IntelRdt struct {
 	// The L3 cache schema in 'container_id' group
 	L3CacheSchema string `json:"l3_cache_schema,omitempty"`
 
+	// The read-only L2 cache information
+	L2CacheInfo *L2CacheInfo `json:"l2_cache_info,omitempty"`
+
+	// The read-only L2 cache schema in root
+	L2CacheSchemaRoot string `json:"l2_cache_schema_root,omitempty"`
+
+	// The L2 cache schema in 'container_id' group
+	L2CacheSchema string `json:"l2_cache_schema,omitempty"`
+
 	// The read-only memory bandwidth information
 	MemBwInfo *MemBwInfo `json:"mem_bw_info,omitempty"`
 
@@ -0,0 +1,79 @@
+// Package features provides the JSON structure of the output of
+// "runc features", which reports the capabilities of the runc binary and of
+// the host, so that higher level engines don't have to guess them from the
+// runc version.
+package features
+
+// Features is the output of "runc features".
+type Features struct {
+	// OCIVersionMin is the minimum OCI runtime spec version supported.
+	OCIVersionMin string `json:"ociVersionMin,omitempty"`
+	// OCIVersionMax is the maximum OCI runtime spec version supported.
+	OCIVersionMax string `json:"ociVersionMax,omitempty"`
+	// Version is the runc version.
+	Version string `json:"version,omitempty"`
+	// Hooks are the names of the supported hooks.
+	Hooks []string `json:"hooks,omitempty"`
+	// Annotations are the annotations recognized by runc. The ones ending
+	// with "." or "/" are prefixes.
+	Annotations []string `json:"annotations,omitempty"`
+	// Linux is the Linux specific information.
+	Linux *Linux `json:"linux,omitempty"`
+}
+
+// Linux is the Linux specific part of Features.
+type Linux struct {
+	// Namespaces are the namespaces supported by both runc and the kernel.
+	Namespaces []string `json:"namespaces,omitempty"`
+	// Capabilities are the capabilities known to runc.
+	Capabilities []string `json:"capabilities,omitempty"`
+	Cgroup       *Cgroup  `json:"cgroup,omitempty"`
+	Seccomp      *Seccomp `json:"seccomp,omitempty"`
+	// IDMappedMounts is true if the kernel supports idmapped mounts.
+	IDMappedMounts bool        `json:"idmappedMounts"`
+	Checkpoint     *Checkpoint `json:"checkpoint,omitempty"`
+	AppArmor       *Enabled    `json:"apparmor,omitempty"`
+	SELinux        *Enabled    `json:"selinux,omitempty"`
+	IntelRdt       *Enabled    `json:"intelRdt,omitempty"`
+}
+
+// Cgroup describes the cgroup support of the host.
+type Cgroup struct {
+	// Version is the cgroup version (1 or 2) of the host.
+	Version int `json:"version"`
+	// Controllers are the controllers available on the host (or, in
+	// rootless mode on cgroup v2, delegated to the user by systemd, if
+	// known).
+	Controllers []string `json:"controllers,omitempty"`
+	// Systemd is true if the systemd cgroup driver is supported, that is if
+	// the host is booted with systemd.
+	Systemd bool `json:"systemd"`
+}
+
+// Seccomp describes the seccomp support of the runc binary.
+type Seccomp struct {
+	// Enabled is true if runc was built with seccomp support.
+	Enabled bool `json:"enabled"`
+	// LibseccompVersion is the version of libseccomp runc is linked
+	// against.
+	LibseccompVersion string `json:"libseccompVersion,omitempty"`
+	// Actions are the supported actions, such as "SCMP_ACT_ALLOW".
+	Actions []string `json:"actions,omitempty"`
+	// Operators are the supported operators, such as "SCMP_CMP_EQ".
+	Operators []string `json:"operators,omitempty"`
+	// Archs are the supported architectures, such as "SCMP_ARCH_X86_64".
+	Archs []string `json:"archs,omitempty"`
+}
+
+// Checkpoint describes the checkpoint/restore support.
+type Checkpoint struct {
+	// Enabled is true if CRIU is available.
+	Enabled bool `json:"enabled"`
+	// CriuVersion is the version of CRIU, such as 31600 for 3.16.
+	CriuVersion int `json:"criuVersion,omitempty"`
+}
+
+// Enabled describes whether a feature is enabled on the host.
+type Enabled struct {
+	Enabled bool `json:"enabled"`
+}
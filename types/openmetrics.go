@@ -0,0 +1,259 @@
+package types
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// MetricsPrefix is the prefix of the names of the metrics written by
+// WriteOpenMetrics.
+const MetricsPrefix = "runc_container_"
+
+// WriteOpenMetrics writes the stats of the container id to w in the
+// OpenMetrics text format (see https://openmetrics.io), so that they can be
+// scraped by Prometheus and compatible collectors. All the samples have an
+// "id" label set to the container id.
+func WriteOpenMetrics(w io.Writer, id string, s *Stats) error {
+	m := &metricsWriter{w: bufio.NewWriter(w), id: id}
+	if s == nil {
+		s = &Stats{}
+	}
+
+	m.family("cpu_usage_seconds", "counter", "seconds", "Total CPU time consumed.")
+	m.sample("cpu_usage_seconds_total", nsToSeconds(s.CPU.Usage.Total))
+	m.family("cpu_user_seconds", "counter", "seconds", "CPU time consumed in user mode.")
+	m.sample("cpu_user_seconds_total", nsToSeconds(s.CPU.Usage.User))
+	m.family("cpu_kernel_seconds", "counter", "seconds", "CPU time consumed in kernel mode.")
+	m.sample("cpu_kernel_seconds_total", nsToSeconds(s.CPU.Usage.Kernel))
+	m.family("cpu_periods", "counter", "", "Number of elapsed CFS enforcement periods.")
+	m.sample("cpu_periods_total", uintValue(s.CPU.Throttling.Periods))
+	m.family("cpu_throttled_periods", "counter", "", "Number of throttled CFS periods.")
+	m.sample("cpu_throttled_periods_total", uintValue(s.CPU.Throttling.ThrottledPeriods))
+	m.family("cpu_throttled_seconds", "counter", "seconds", "Total time throttled by CFS.")
+	m.sample("cpu_throttled_seconds_total", nsToSeconds(s.CPU.Throttling.ThrottledTime))
+
+	m.family("memory_usage_bytes", "gauge", "bytes", "Current memory usage.")
+	m.sample("memory_usage_bytes", uintValue(s.Memory.Usage.Usage))
+	if s.Memory.Usage.Max != 0 {
+		m.family("memory_max_usage_bytes", "gauge", "bytes", "Maximum recorded memory usage.")
+		m.sample("memory_max_usage_bytes", uintValue(s.Memory.Usage.Max))
+	}
+	if limit := s.Memory.Usage.Limit; limit != 0 && limit != math.MaxUint64 {
+		m.family("memory_limit_bytes", "gauge", "bytes", "Memory limit.")
+		m.sample("memory_limit_bytes", uintValue(limit))
+	}
+	m.family("memory_cache_bytes", "gauge", "bytes", "Page cache memory usage.")
+	m.sample("memory_cache_bytes", uintValue(s.Memory.Cache))
+	m.family("memory_swap_usage_bytes", "gauge", "bytes", "Current memory plus swap usage.")
+	m.sample("memory_swap_usage_bytes", uintValue(s.Memory.Swap.Usage))
+	if e := s.Memory.Events; e != nil {
+		m.family("memory_events", "counter", "", "Number of memory events, by type.")
+		m.sample("memory_events_total", uintValue(e.Low), "type", "low")
+		m.sample("memory_events_total", uintValue(e.High), "type", "high")
+		m.sample("memory_events_total", uintValue(e.Max), "type", "max")
+		m.sample("memory_events_total", uintValue(e.Oom), "type", "oom")
+		m.sample("memory_events_total", uintValue(e.OomKill), "type", "oom_kill")
+	}
+
+	if len(s.Memory.NUMA) > 0 {
+		nodes := make([]int, 0, len(s.Memory.NUMA))
+		for n := range s.Memory.NUMA {
+			nodes = append(nodes, int(n))
+		}
+		sort.Ints(nodes)
+		m.family("memory_numa_pages", "gauge", "", "Memory usage in pages, by NUMA node and type.")
+		for _, n := range nodes {
+			u := s.Memory.NUMA[uint8(n)]
+			node := strconv.Itoa(n)
+			m.sample("memory_numa_pages", uintValue(u.Anon), "node", node, "type", "anon")
+			m.sample("memory_numa_pages", uintValue(u.File), "node", node, "type", "file")
+			m.sample("memory_numa_pages", uintValue(u.Unevictable), "node", node, "type", "unevictable")
+		}
+	}
+
+	m.family("pids_current", "gauge", "", "Number of processes.")
+	m.sample("pids_current", uintValue(s.Pids.Current))
+	if s.Pids.Limit != 0 {
+		m.family("pids_limit", "gauge", "", "Maximum number of processes.")
+		m.sample("pids_limit", uintValue(s.Pids.Limit))
+	}
+
+	m.blkio("blkio_service_bytes", "bytes", "Number of bytes transferred to and from block devices.", s.Blkio.IoServiceBytesRecursive)
+	m.blkio("blkio_serviced", "", "Number of I/O operations on block devices.", s.Blkio.IoServicedRecursive)
+
+	psi := []struct {
+		resource string
+		stats    *PSIStats
+	}{
+		{"cpu", s.CPU.PSI},
+		{"memory", s.Memory.PSI},
+		{"io", s.Blkio.PSI},
+	}
+	first := true
+	for _, p := range psi {
+		if p.stats == nil {
+			continue
+		}
+		if first {
+			m.family("pressure_stalled_seconds", "counter", "seconds", "Total time stalled on a resource, by resource and stall type (PSI).")
+			first = false
+		}
+		m.sample("pressure_stalled_seconds_total", usToSeconds(p.stats.Some.Total), "resource", p.resource, "type", "some")
+		m.sample("pressure_stalled_seconds_total", usToSeconds(p.stats.Full.Total), "resource", p.resource, "type", "full")
+	}
+
+	if len(s.Hugetlb) > 0 {
+		sizes := make([]string, 0, len(s.Hugetlb))
+		for size := range s.Hugetlb {
+			sizes = append(sizes, size)
+		}
+		sort.Strings(sizes)
+		m.family("hugetlb_usage_bytes", "gauge", "bytes", "Current huge pages usage, by page size.")
+		for _, size := range sizes {
+			m.sample("hugetlb_usage_bytes", uintValue(s.Hugetlb[size].Usage), "pagesize", size)
+		}
+		rsvd := false
+		for _, h := range s.Hugetlb {
+			rsvd = rsvd || h.RsvdUsage != 0
+		}
+		if rsvd {
+			m.family("hugetlb_rsvd_usage_bytes", "gauge", "bytes", "Current huge pages reservations, by page size.")
+			for _, size := range sizes {
+				m.sample("hugetlb_rsvd_usage_bytes", uintValue(s.Hugetlb[size].RsvdUsage), "pagesize", size)
+			}
+		}
+	}
+
+	if len(s.NetworkInterfaces) > 0 {
+		net := []struct {
+			name, unit, help string
+			value            func(*NetworkInterface) uint64
+		}{
+			{"network_receive_bytes", "bytes", "Number of bytes received, by interface.", func(i *NetworkInterface) uint64 { return i.RxBytes }},
+			{"network_receive_packets", "", "Number of packets received, by interface.", func(i *NetworkInterface) uint64 { return i.RxPackets }},
+			{"network_receive_errors", "", "Number of receive errors, by interface.", func(i *NetworkInterface) uint64 { return i.RxErrors }},
+			{"network_receive_dropped", "", "Number of received packets dropped, by interface.", func(i *NetworkInterface) uint64 { return i.RxDropped }},
+			{"network_transmit_bytes", "bytes", "Number of bytes transmitted, by interface.", func(i *NetworkInterface) uint64 { return i.TxBytes }},
+			{"network_transmit_packets", "", "Number of packets transmitted, by interface.", func(i *NetworkInterface) uint64 { return i.TxPackets }},
+			{"network_transmit_errors", "", "Number of transmit errors, by interface.", func(i *NetworkInterface) uint64 { return i.TxErrors }},
+			{"network_transmit_dropped", "", "Number of transmitted packets dropped, by interface.", func(i *NetworkInterface) uint64 { return i.TxDropped }},
+		}
+		for _, n := range net {
+			m.family(n.name, "counter", n.unit, n.help)
+			for _, iface := range s.NetworkInterfaces {
+				m.sample(n.name+"_total", uintValue(n.value(iface)), "interface", iface.Name)
+			}
+		}
+	}
+
+	if len(s.Devices) > 0 {
+		var names []string
+		seen := make(map[string]bool)
+		for _, d := range s.Devices {
+			for name := range d.Metrics {
+				if !seen[name] {
+					seen[name] = true
+					names = append(names, name)
+				}
+			}
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			family := "device_" + metricName(name)
+			m.family(family, "unknown", "", "Device metric "+name+" reported by a device stats provider, by device.")
+			for _, d := range s.Devices {
+				if v, ok := d.Metrics[name]; ok {
+					device := strconv.FormatInt(d.Major, 10) + ":" + strconv.FormatInt(d.Minor, 10)
+					m.sample(family, uintValue(v), "provider", d.Provider, "device", device, "path", d.Path)
+				}
+			}
+		}
+	}
+
+	m.printf("# EOF\n")
+	if m.err != nil {
+		return m.err
+	}
+	return m.w.Flush()
+}
+
+type metricsWriter struct {
+	w   *bufio.Writer
+	id  string
+	err error
+}
+
+func (m *metricsWriter) printf(format string, args ...interface{}) {
+	if m.err == nil {
+		_, m.err = fmt.Fprintf(m.w, format, args...)
+	}
+}
+
+// family writes the metadata of the metric family name.
+func (m *metricsWriter) family(name, typ, unit, help string) {
+	name = MetricsPrefix + name
+	m.printf("# TYPE %s %s\n", name, typ)
+	if unit != "" {
+		m.printf("# UNIT %s %s\n", name, unit)
+	}
+	m.printf("# HELP %s %s\n", name, help)
+}
+
+// sample writes a sample of the metric name, with the given label names
+// and values (in addition to the container id).
+func (m *metricsWriter) sample(name, value string, labels ...string) {
+	var b strings.Builder
+	b.WriteString(`id="` + escapeLabelValue(m.id) + `"`)
+	for i := 0; i+1 < len(labels); i += 2 {
+		b.WriteString("," + labels[i] + `="` + escapeLabelValue(labels[i+1]) + `"`)
+	}
+	m.printf("%s%s{%s} %s\n", MetricsPrefix, name, b.String(), value)
+}
+
+func (m *metricsWriter) blkio(name, unit, help string, entries []BlkioEntry) {
+	if len(entries) == 0 {
+		return
+	}
+	m.family(name, "counter", unit, help)
+	for _, e := range entries {
+		if e.Op == "" || strings.EqualFold(e.Op, "Total") {
+			continue
+		}
+		device := strconv.FormatUint(e.Major, 10) + ":" + strconv.FormatUint(e.Minor, 10)
+		m.sample(name+"_total", uintValue(e.Value), "device", device, "op", strings.ToLower(e.Op))
+	}
+}
+
+// metricName returns name with the characters not allowed in metric names
+// replaced by underscores.
+func metricName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r == '_' {
+			return r
+		}
+		return '_'
+	}, name)
+}
+
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabelValue(v string) string {
+	return labelValueEscaper.Replace(v)
+}
+
+func uintValue(v uint64) string {
+	return strconv.FormatUint(v, 10)
+}
+
+func nsToSeconds(ns uint64) string {
+	return strconv.FormatFloat(float64(ns)/1e9, 'g', -1, 64)
+}
+
+func usToSeconds(us uint64) string {
+	return strconv.FormatFloat(float64(us)/1e6, 'g', -1, 64)
+}
@@ -0,0 +1,63 @@
+package types
+
+import (
+	"bytes"
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestWriteOpenMetrics(t *testing.T) {
+	s := &Stats{
+		NetworkInterfaces: []*NetworkInterface{{Name: "eth0", RxBytes: 42}},
+	}
+	s.CPU.Usage.Total = 1500000000
+	s.Memory.Usage = MemoryEntry{Usage: 4096, Limit: math.MaxUint64}
+	s.Memory.Events = &MemoryEvents{OomKill: 2}
+	s.Memory.NUMA = map[uint8]MemoryNUMA{1: {Total: 12, Anon: 10, File: 2}}
+	s.Pids.Current = 3
+	s.Blkio.IoServiceBytesRecursive = []BlkioEntry{
+		{Major: 8, Minor: 0, Op: "Read", Value: 512},
+		{Major: 8, Minor: 0, Op: "Total", Value: 512},
+	}
+	s.Memory.PSI = &PSIStats{Some: PSIData{Total: 250000}}
+	s.Hugetlb = map[string]Hugetlb{"2MB": {Usage: 2097152, RsvdUsage: 4194304}, "1GB": {}}
+	s.Devices = []DeviceStats{
+		{Provider: "nvidia", Path: "/dev/nvidia0", Major: 195, Minor: 0, Metrics: map[string]uint64{"utilization.percent": 87}},
+	}
+
+	var b bytes.Buffer
+	if err := WriteOpenMetrics(&b, `my"ctr`, s); err != nil {
+		t.Fatal(err)
+	}
+	out := b.String()
+	for _, line := range []string{
+		"# TYPE runc_container_cpu_usage_seconds counter",
+		"# UNIT runc_container_cpu_usage_seconds seconds",
+		`runc_container_cpu_usage_seconds_total{id="my\"ctr"} 1.5`,
+		`runc_container_memory_usage_bytes{id="my\"ctr"} 4096`,
+		`runc_container_memory_events_total{id="my\"ctr",type="oom_kill"} 2`,
+		`runc_container_memory_numa_pages{id="my\"ctr",node="1",type="anon"} 10`,
+		`runc_container_pids_current{id="my\"ctr"} 3`,
+		`runc_container_blkio_service_bytes_total{id="my\"ctr",device="8:0",op="read"} 512`,
+		`runc_container_pressure_stalled_seconds_total{id="my\"ctr",resource="memory",type="some"} 0.25`,
+		`runc_container_network_receive_bytes_total{id="my\"ctr",interface="eth0"} 42`,
+		`runc_container_hugetlb_usage_bytes{id="my\"ctr",pagesize="2MB"} 2097152`,
+		`runc_container_hugetlb_rsvd_usage_bytes{id="my\"ctr",pagesize="1GB"} 0`,
+		`runc_container_hugetlb_rsvd_usage_bytes{id="my\"ctr",pagesize="2MB"} 4194304`,
+		"# TYPE runc_container_device_utilization_percent unknown",
+		`runc_container_device_utilization_percent{id="my\"ctr",provider="nvidia",device="195:0",path="/dev/nvidia0"} 87`,
+	} {
+		if !strings.Contains(out, line+"\n") {
+			t.Errorf("expected line %q in output:\n%s", line, out)
+		}
+	}
+	for _, name := range []string{"memory_limit_bytes", "pids_limit", `op="total"`} {
+		if strings.Contains(out, name) {
+			t.Errorf("unexpected %s in output:\n%s", name, out)
+		}
+	}
+	if !strings.HasSuffix(out, "\n# EOF\n") {
+		t.Errorf("expected output to end with # EOF:\n%s", out)
+	}
+}
@@ -0,0 +1,40 @@
+// Package validation provides the JSON structure of the output of
+// "runc spec validate", which reports the problems found in the specification
+// of a bundle before a container is created from it.
+package validation
+
+// Severity is the severity of a Finding.
+type Severity string
+
+const (
+	// Error is the severity of the problems which make the creation of a
+	// container from the bundle fail.
+	Error Severity = "error"
+	// Warning is the severity of the problems which don't make the creation
+	// fail, but which may make the container behave differently than what
+	// the specification asks for.
+	Warning Severity = "warning"
+)
+
+// Report is the output of "runc spec validate".
+type Report struct {
+	// Bundle is the absolute path of the bundle.
+	Bundle string `json:"bundle"`
+	// Valid is true if none of the findings is an error.
+	Valid bool `json:"valid"`
+	// Findings are the problems found, in the order of the checks.
+	Findings []Finding `json:"findings"`
+}
+
+// Finding is a problem found in the specification.
+type Finding struct {
+	Severity Severity `json:"severity"`
+	// Check is the name of the check which found the problem, such as
+	// "schema", "namespaces" or "controllers".
+	Check string `json:"check"`
+	// Field is the path of the field of the specification the problem is
+	// about, such as "linux.namespaces[2].type", if known.
+	Field string `json:"field,omitempty"`
+	// Message describes the problem.
+	Message string `json:"message"`
+}
@@ -3,20 +3,24 @@
 package main
 
 import (
-	"encoding/json"
 	"errors"
 	"fmt"
 	"os"
 	"strconv"
+	"strings"
 
 	"github.com/opencontainers/runc/libcontainer/cgroups"
 	"github.com/sirupsen/logrus"
 
 	"github.com/docker/go-units"
+	"github.com/opencontainers/runc/libcontainer"
+	"github.com/opencontainers/runc/libcontainer/cgroups/fs2"
 	"github.com/opencontainers/runc/libcontainer/configs"
 	"github.com/opencontainers/runc/libcontainer/intelrdt"
+	"github.com/opencontainers/runc/libcontainer/specconv"
 	"github.com/opencontainers/runtime-spec/specs-go"
 	"github.com/urfave/cli"
+	"golang.org/x/sys/unix"
 )
 
 func i64Ptr(i int64) *int64   { return &i }
@@ -27,7 +31,7 @@ var updateCommand = cli.Command{
 	Name:      "update",
 	Usage:     "update container resource constraints",
 	ArgsUsage: `<container-id>`,
-	Flags: []cli.Flag{
+	Flags: append([]cli.Flag{
 		cli.StringFlag{
 			Name:  "resources, r",
 			Value: "",
@@ -52,79 +56,101 @@ The accepted format is as follow (unchanged values can be omitted):
   },
   "blockIO": {
     "weight": 0
+  },
+  "devices": [
+    {"allow": false, "access": "rwm"},
+    {"allow": true, "type": "c", "major": 195, "minor": 0, "access": "rw"}
+  ],
+  "unified": {
+    "memory.high": "1073741824"
   }
 }
 
-Note: if data is to be read from a file or the standard input, all
-other options are ignored.
+If "devices" is specified, it replaces the device access rules of the
+container (the default devices, such as /dev/null, are always allowed).
+The "unified" keys (cgroup v2 only) are added to those of the container.
+
+Note: if data is to be read from a file or the standard input, the
+options setting the resources of this format are ignored.
 `,
 		},
 
-		cli.IntFlag{
-			Name:  "blkio-weight",
-			Usage: "Specifies per cgroup weight, range is from 10 to 1000",
-		},
-		cli.StringFlag{
-			Name:  "cpu-period",
-			Usage: "CPU CFS period to be used for hardcapping (in usecs). 0 to use system default",
-		},
 		cli.StringFlag{
-			Name:  "cpu-quota",
-			Usage: "CPU CFS hardcap limit (in usecs). Allowed cpu time in a given period",
+			Name:  "cpu-burst",
+			Usage: "CPU CFS burst limit (in usecs). Allowed accumulated cpu time in excess of the quota",
 		},
 		cli.StringFlag{
-			Name:  "cpu-share",
-			Usage: "CPU shares (relative weight vs. other containers)",
+			Name:  "cpu-idle",
+			Usage: "Set to 1 to make the container SCHED_IDLE, or to 0 to reset it (cgroup v2 only)",
 		},
 		cli.StringFlag{
-			Name:  "cpu-rt-period",
-			Usage: "CPU realtime period to be used for hardcapping (in usecs). 0 to use system default",
+			Name:  "cpuset-partition",
+			Usage: "Type of the cpuset partition: 'member', 'root' or 'isolated' (cgroup v2 only)",
 		},
 		cli.StringFlag{
-			Name:  "cpu-rt-runtime",
-			Usage: "CPU realtime hardcap limit (in usecs). Allowed cpu time in a given period",
+			Name:  "memory-reclaim",
+			Usage: "Amount of memory to proactively reclaim from the container (in bytes), without changing its limits (cgroup v2 only)",
 		},
 		cli.StringFlag{
-			Name:  "cpuset-cpus",
-			Usage: "CPU(s) to use",
+			Name:  "memory-swap-high",
+			Usage: "Swap usage throttle limit (in bytes), excluding memory; set '-1' to remove it (cgroup v2 only)",
 		},
 		cli.StringFlag{
-			Name:  "cpuset-mems",
-			Usage: "Memory node(s) to use",
+			Name:  "memory-zswap-max",
+			Usage: "Maximum size of the zswap pool (in bytes); set '0' to disable zswap, or '-1' to remove the limit (cgroup v2 only)",
 		},
 		cli.StringFlag{
-			Name:  "kernel-memory",
-			Usage: "(obsoleted; do not use)",
+			Name:  "memory-zswap-writeback",
+			Usage: "Whether the pages evicted from zswap are written back to swap: 'true' or 'false' (cgroup v2 only)",
 		},
 		cli.StringFlag{
-			Name:  "kernel-memory-tcp",
-			Usage: "(obsoleted; do not use)",
+			Name:  "memory-oom-group",
+			Usage: "Whether the OOM killer kills all the processes of the container together: 'true' or 'false' (cgroup v2 only)",
 		},
 		cli.StringFlag{
-			Name:  "memory",
-			Usage: "Memory limit (in bytes)",
+			Name:  "managed-oom-memory-pressure",
+			Usage: "Action of systemd-oomd when the memory pressure of the container exceeds its limit: 'auto' or 'kill' (systemd cgroup driver on cgroup v2 only)",
 		},
 		cli.StringFlag{
-			Name:  "memory-reservation",
-			Usage: "Memory reservation or soft_limit (in bytes)",
-		},
-		cli.StringFlag{
-			Name:  "memory-swap",
-			Usage: "Total memory usage (memory + swap); set '-1' to enable unlimited swap",
-		},
-		cli.IntFlag{
-			Name:  "pids-limit",
-			Usage: "Maximum number of pids allowed in the container",
+			Name:  "managed-oom-memory-pressure-limit",
+			Usage: "Memory pressure limit of systemd-oomd for the container, as a percentage (e.g. '60%'); set '0%' to use the default of systemd-oomd (systemd cgroup driver on cgroup v2 only)",
 		},
 		cli.StringFlag{
 			Name:  "l3-cache-schema",
 			Usage: "The string of Intel RDT/CAT L3 cache schema",
 		},
+		cli.StringFlag{
+			Name:  "l2-cache-schema",
+			Usage: "The string of Intel RDT/CAT L2 cache schema",
+		},
 		cli.StringFlag{
 			Name:  "mem-bw-schema",
 			Usage: "The string of Intel RDT/MBA memory bandwidth schema",
 		},
-	},
+		cli.StringFlag{
+			Name:  "net-bandwidth",
+			Usage: "Egress network bandwidth limit (in bytes per second), or 0 to remove it (cgroup v2 only)",
+		},
+		cli.StringSliceFlag{
+			Name:  "add-port",
+			Value: &cli.StringSlice{},
+			Usage: "Forward a port of the host to the container, as [HOST_IP:]HOST_PORT:CONTAINER_PORT[/PROTOCOL] (slirp4netns network only); can be repeated",
+		},
+		cli.StringSliceFlag{
+			Name:  "remove-port",
+			Value: &cli.StringSlice{},
+			Usage: "Stop forwarding a port of the host to the container, in the format of --add-port; can be repeated",
+		},
+		cli.StringSliceFlag{
+			Name:  "rlimit",
+			Value: &cli.StringSlice{},
+			Usage: "Set an rlimit of the container's init process, as TYPE=SOFT[:HARD] (e.g. RLIMIT_NOFILE=1024:4096); can be repeated",
+		},
+		cli.BoolFlag{
+			Name:  "dry-run",
+			Usage: "check the unified cgroup keys against the cgroup of the container and list those which can't be set, without updating anything",
+		},
+	}, resourceFlags...),
 	Action: func(context *cli.Context) error {
 		if err := checkArgs(context, 1, exactArgs); err != nil {
 			return err
@@ -161,94 +187,25 @@ other options are ignored.
 
 		config := container.Config()
 
-		if in := context.String("resources"); in != "" {
-			var (
-				f   *os.File
-				err error
-			)
-			switch in {
-			case "-":
-				f = os.Stdin
-			default:
-				f, err = os.Open(in)
-				if err != nil {
-					return err
-				}
-			}
-			err = json.NewDecoder(f).Decode(&r)
+		// The reclaim is not a resource, so it is done with --resources
+		// too.
+		var reclaim int64
+		if val := context.String("memory-reclaim"); val != "" {
+			reclaim, err = units.RAMInBytes(val)
 			if err != nil {
-				return err
-			}
-		} else {
-			if val := context.Int("blkio-weight"); val != 0 {
-				r.BlockIO.Weight = u16Ptr(uint16(val))
+				return fmt.Errorf("invalid value for memory-reclaim: %s", err)
 			}
-			if val := context.String("cpuset-cpus"); val != "" {
-				r.CPU.Cpus = val
-			}
-			if val := context.String("cpuset-mems"); val != "" {
-				r.CPU.Mems = val
+			if reclaim <= 0 {
+				return errors.New("invalid value for memory-reclaim: must be positive")
 			}
+		}
 
-			for _, pair := range []struct {
-				opt  string
-				dest *uint64
-			}{
-
-				{"cpu-period", r.CPU.Period},
-				{"cpu-rt-period", r.CPU.RealtimePeriod},
-				{"cpu-share", r.CPU.Shares},
-			} {
-				if val := context.String(pair.opt); val != "" {
-					var err error
-					*pair.dest, err = strconv.ParseUint(val, 10, 64)
-					if err != nil {
-						return fmt.Errorf("invalid value for %s: %s", pair.opt, err)
-					}
-				}
-			}
-			for _, pair := range []struct {
-				opt  string
-				dest *int64
-			}{
-
-				{"cpu-quota", r.CPU.Quota},
-				{"cpu-rt-runtime", r.CPU.RealtimeRuntime},
-			} {
-				if val := context.String(pair.opt); val != "" {
-					var err error
-					*pair.dest, err = strconv.ParseInt(val, 10, 64)
-					if err != nil {
-						return fmt.Errorf("invalid value for %s: %s", pair.opt, err)
-					}
-				}
-			}
-			for _, pair := range []struct {
-				opt  string
-				dest *int64
-			}{
-				{"memory", r.Memory.Limit},
-				{"memory-swap", r.Memory.Swap},
-				{"kernel-memory", r.Memory.Kernel},
-				{"kernel-memory-tcp", r.Memory.KernelTCP},
-				{"memory-reservation", r.Memory.Reservation},
-			} {
-				if val := context.String(pair.opt); val != "" {
-					var v int64
-
-					if val != "-1" {
-						v, err = units.RAMInBytes(val)
-						if err != nil {
-							return fmt.Errorf("invalid value for %s: %s", pair.opt, err)
-						}
-					} else {
-						v = -1
-					}
-					*pair.dest = v
-				}
+		if in := context.String("resources"); in != "" {
+			if err := decodeResources(in, &r); err != nil {
+				return err
 			}
-
-			r.Pids.Limit = int64(context.Int("pids-limit"))
+		} else if err := setResources(context, &r); err != nil {
+			return err
 		}
 
 		if *r.Memory.Kernel != 0 || *r.Memory.KernelTCP != 0 {
@@ -285,6 +242,22 @@ other options are ignored.
 			}
 		}
 
+		if val := context.String("cpu-burst"); val != "" {
+			burst, err := strconv.ParseUint(val, 10, 64)
+			if err != nil {
+				return fmt.Errorf("invalid value for cpu-burst: %s", err)
+			}
+			config.Cgroups.Resources.CpuBurst = &burst
+		}
+
+		if val := context.String("cpu-idle"); val != "" {
+			idle, err := strconv.ParseInt(val, 10, 64)
+			if err != nil || (idle != 0 && idle != 1) {
+				return fmt.Errorf("invalid value for cpu-idle: %q (must be 0 or 1)", val)
+			}
+			config.Cgroups.Resources.CPUIdle = &idle
+		}
+
 		config.Cgroups.Resources.CpuShares = *r.CPU.Shares
 		//CpuWeight is used for cgroupv2 and should be converted
 		config.Cgroups.Resources.CpuWeight = cgroups.ConvertCPUSharesToCgroupV2Value(*r.CPU.Shares)
@@ -298,18 +271,98 @@ other options are ignored.
 		config.Cgroups.Resources.PidsLimit = r.Pids.Limit
 		config.Cgroups.Resources.Unified = r.Unified
 
+		// Update the cpuset partition.
+		if val := context.String("cpuset-partition"); val != "" {
+			if !cgroups.IsCgroup2UnifiedMode() {
+				return errors.New("cpuset-partition is only supported on cgroup v2")
+			}
+			switch val {
+			case "member", "root", "isolated":
+			default:
+				return fmt.Errorf("invalid value for cpuset-partition: %q", val)
+			}
+			config.Cgroups.Resources.CpusetPartition = val
+		}
+
+		// Update the swap-only and zswap limits.
+		if err := updateSwapLimits(context, config.Cgroups.Resources); err != nil {
+			return err
+		}
+
+		// Update the OOM group.
+		if val := context.String("memory-oom-group"); val != "" {
+			if !cgroups.IsCgroup2UnifiedMode() {
+				return errors.New("memory-oom-group is only supported on cgroup v2")
+			}
+			v, err := strconv.ParseBool(val)
+			if err != nil {
+				return fmt.Errorf("invalid value for memory-oom-group: %s", err)
+			}
+			config.Cgroups.Resources.MemoryOOMGroup = &v
+		}
+
+		// Update the systemd-oomd settings.
+		if context.IsSet("managed-oom-memory-pressure") || context.IsSet("managed-oom-memory-pressure-limit") {
+			if !config.Cgroups.Systemd || !cgroups.IsCgroup2UnifiedMode() {
+				return errors.New("systemd-oomd settings are only supported with the systemd cgroup driver on cgroup v2")
+			}
+		}
+		if val := context.String("managed-oom-memory-pressure"); val != "" {
+			if val != "auto" && val != "kill" {
+				return fmt.Errorf("invalid value for managed-oom-memory-pressure: %q", val)
+			}
+			config.Cgroups.Resources.ManagedOOMMemoryPressure = val
+		}
+		if val := context.String("managed-oom-memory-pressure-limit"); val != "" {
+			v, err := cgroups.ParsePermyriad(val)
+			if err != nil {
+				return fmt.Errorf("invalid value for managed-oom-memory-pressure-limit: %s", err)
+			}
+			config.Cgroups.Resources.ManagedOOMMemoryPressureLimit = &v
+		}
+
+		// Update the device rules. Rules for the default devices are
+		// appended as they were on container creation.
+		if r.Devices != nil {
+			rules, err := specconv.CreateDeviceRules(r.Devices)
+			if err != nil {
+				return err
+			}
+			config.Cgroups.Resources.Devices = append(rules, specconv.DefaultDeviceRules(&config)...)
+		}
+
+		// Update the unified (cgroup v2) resources.
+		if len(r.Unified) > 0 {
+			if !cgroups.IsCgroup2UnifiedMode() {
+				return cgroups.ErrV1NoUnified
+			}
+			unified := make(map[string]string, len(config.Cgroups.Resources.Unified)+len(r.Unified))
+			for k, v := range config.Cgroups.Resources.Unified {
+				unified[k] = v
+			}
+			for k, v := range r.Unified {
+				unified[k] = v
+			}
+			config.Cgroups.Resources.Unified = unified
+		}
+
 		// Update Intel RDT
 		l3CacheSchema := context.String("l3-cache-schema")
+		l2CacheSchema := context.String("l2-cache-schema")
 		memBwSchema := context.String("mem-bw-schema")
 		if l3CacheSchema != "" && !intelrdt.IsCATEnabled() {
 			return errors.New("Intel RDT/CAT: l3 cache schema is not enabled")
 		}
 
+		if l2CacheSchema != "" && !intelrdt.IsL2CATEnabled() {
+			return errors.New("Intel RDT/CAT: l2 cache schema is not enabled")
+		}
+
 		if memBwSchema != "" && !intelrdt.IsMBAEnabled() {
 			return errors.New("Intel RDT/MBA: memory bandwidth schema is not enabled")
 		}
 
-		if l3CacheSchema != "" || memBwSchema != "" {
+		if l3CacheSchema != "" || l2CacheSchema != "" || memBwSchema != "" {
 			// If intelRdt is not specified in original configuration, we just don't
 			// Apply() to create intelRdt group or attach tasks for this container.
 			// In update command, we could re-enable through IntelRdtManager.Apply()
@@ -326,9 +379,225 @@ other options are ignored.
 				}
 			}
 			config.IntelRdt.L3CacheSchema = l3CacheSchema
+			config.IntelRdt.L2CacheSchema = l2CacheSchema
 			config.IntelRdt.MemBwSchema = memBwSchema
 		}
 
-		return container.Set(config)
+		// Update the network bandwidth limit
+		if val := context.String("net-bandwidth"); val != "" {
+			if !cgroups.IsCgroup2UnifiedMode() {
+				return errors.New("net-bandwidth is only supported on cgroup v2")
+			}
+			limit, err := units.RAMInBytes(val)
+			if err != nil {
+				return fmt.Errorf("invalid value for net-bandwidth: %s", err)
+			}
+			if limit < 0 {
+				return errors.New("invalid value for net-bandwidth: must not be negative")
+			}
+			if len(config.Networks) == 0 {
+				return errors.New("unable to set network bandwidth limit: no networks configured for the container")
+			}
+			for _, n := range config.Networks {
+				n.BandwidthLimit = uint64(limit)
+			}
+		}
+
+		// Update the ports forwarded by the networking helper.
+		if add, remove := context.StringSlice("add-port"), context.StringSlice("remove-port"); len(add) > 0 || len(remove) > 0 {
+			if err := updatePortForwards(&config, add, remove); err != nil {
+				return err
+			}
+		}
+
+		// Update the rlimits of the init process.
+		for _, val := range context.StringSlice("rlimit") {
+			rl, err := parseRlimit(val)
+			if err != nil {
+				return err
+			}
+			config.Rlimits = setRlimit(config.Rlimits, rl)
+		}
+
+		if context.Bool("dry-run") {
+			return checkUnified(container, config.Cgroups.Resources.Unified)
+		}
+
+		if err := container.Set(config); err != nil {
+			return err
+		}
+		if reclaim != 0 {
+			return container.ReclaimMemory(uint64(reclaim))
+		}
+		return nil
 	},
 }
+
+// checkUnified reports the keys of unified which can't be set in the cgroup
+// of the container.
+func checkUnified(container libcontainer.Container, unified map[string]string) error {
+	if len(unified) == 0 {
+		return nil
+	}
+	if !cgroups.IsCgroup2UnifiedMode() {
+		return cgroups.ErrV1NoUnified
+	}
+	state, err := container.State()
+	if err != nil {
+		return err
+	}
+	errs := fs2.CheckUnified(state.CgroupPaths[""], unified)
+	for _, err := range errs {
+		fmt.Fprintln(os.Stderr, err)
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("%d of %d unified resources can't be set", len(errs), len(unified))
+	}
+	return nil
+}
+
+// updateSwapLimits sets the swap-only and zswap limits of r from the
+// options of context.
+func updateSwapLimits(context *cli.Context, r *configs.Resources) error {
+	opts := []string{"memory-swap-high", "memory-zswap-max", "memory-zswap-writeback"}
+	for _, opt := range opts {
+		if context.String(opt) != "" && !cgroups.IsCgroup2UnifiedMode() {
+			return fmt.Errorf("%s is only supported on cgroup v2", opt)
+		}
+	}
+	parse := func(opt, val string) (int64, error) {
+		if val == "-1" {
+			return -1, nil
+		}
+		v, err := units.RAMInBytes(val)
+		if err != nil {
+			return 0, fmt.Errorf("invalid value for %s: %s", opt, err)
+		}
+		return v, nil
+	}
+	if val := context.String("memory-swap-high"); val != "" {
+		v, err := parse("memory-swap-high", val)
+		if err != nil {
+			return err
+		}
+		r.MemorySwapHigh = v
+	}
+	if val := context.String("memory-zswap-max"); val != "" {
+		v, err := parse("memory-zswap-max", val)
+		if err != nil {
+			return err
+		}
+		r.MemoryZswapMax = &v
+	}
+	if val := context.String("memory-zswap-writeback"); val != "" {
+		v, err := strconv.ParseBool(val)
+		if err != nil {
+			return fmt.Errorf("invalid value for memory-zswap-writeback: %s", err)
+		}
+		r.MemoryZswapWriteback = &v
+	}
+	return nil
+}
+
+// parseRlimit parses an rlimit in the TYPE=SOFT[:HARD] format. The hard
+// limit defaults to the soft limit, and both can be set to "unlimited".
+func parseRlimit(val string) (configs.Rlimit, error) {
+	parts := strings.SplitN(val, "=", 2)
+	if len(parts) != 2 {
+		return configs.Rlimit{}, fmt.Errorf("invalid rlimit %q: must be TYPE=SOFT[:HARD]", val)
+	}
+	typ, err := strToRlimit(parts[0])
+	if err != nil {
+		return configs.Rlimit{}, err
+	}
+	limits := strings.SplitN(parts[1], ":", 2)
+	soft, err := parseRlimitValue(limits[0])
+	if err != nil {
+		return configs.Rlimit{}, fmt.Errorf("invalid rlimit %q: %w", val, err)
+	}
+	hard := soft
+	if len(limits) == 2 {
+		if hard, err = parseRlimitValue(limits[1]); err != nil {
+			return configs.Rlimit{}, fmt.Errorf("invalid rlimit %q: %w", val, err)
+		}
+	}
+	if soft > hard {
+		return configs.Rlimit{}, fmt.Errorf("invalid rlimit %q: the soft limit is greater than the hard limit", val)
+	}
+	return configs.Rlimit{Type: typ, Soft: soft, Hard: hard}, nil
+}
+
+func parseRlimitValue(val string) (uint64, error) {
+	if val == "unlimited" {
+		return unix.RLIM_INFINITY, nil
+	}
+	return strconv.ParseUint(val, 10, 64)
+}
+
+// setRlimit returns a copy of rlimits, with the rlimit of the same type as
+// rl replaced by rl, or rl appended if there is none. A copy is needed as
+// rlimits is shared with the current config of the container.
+func setRlimit(rlimits []configs.Rlimit, rl configs.Rlimit) []configs.Rlimit {
+	out := make([]configs.Rlimit, 0, len(rlimits)+1)
+	found := false
+	for _, r := range rlimits {
+		if r.Type == rl.Type {
+			r = rl
+			found = true
+		}
+		out = append(out, r)
+	}
+	if !found {
+		out = append(out, rl)
+	}
+	return out
+}
+
+// updatePortForwards removes and adds the ports forwarded by the pasta or
+// slirp4netns network of config. The network is copied, as it is shared with
+// the configuration of the container, which Set compares it with.
+func updatePortForwards(config *configs.Config, add, remove []string) error {
+	networks := make([]*configs.Network, len(config.Networks))
+	var helper *configs.Network
+	for i, n := range config.Networks {
+		if n.Type == "pasta" || n.Type == "slirp4netns" {
+			cp := *n
+			helper = &cp
+			n = helper
+		}
+		networks[i] = n
+	}
+	if helper == nil {
+		return errors.New("unable to update port forwards: no pasta or slirp4netns network configured for the container")
+	}
+	forwards := append([]configs.PortForward(nil), helper.PortForwards...)
+next:
+	for _, val := range remove {
+		pf, err := specconv.ParsePortForward(val)
+		if err != nil {
+			return err
+		}
+		for i, f := range forwards {
+			if f == pf {
+				forwards = append(forwards[:i], forwards[i+1:]...)
+				continue next
+			}
+		}
+		return fmt.Errorf("port %s is not forwarded", pf)
+	}
+	for _, val := range add {
+		pf, err := specconv.ParsePortForward(val)
+		if err != nil {
+			return err
+		}
+		for _, f := range forwards {
+			if f.Protocol == pf.Protocol && f.HostIP == pf.HostIP && f.HostPort == pf.HostPort {
+				return fmt.Errorf("port %s is already forwarded", f)
+			}
+		}
+		forwards = append(forwards, pf)
+	}
+	helper.PortForwards = forwards
+	config.Networks = networks
+	return nil
+}
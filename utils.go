@@ -1,12 +1,16 @@
 package main
 
 import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
 
+	"github.com/opencontainers/runc/libcontainer/logs"
 	"github.com/opencontainers/runtime-spec/specs-go"
 
 	"github.com/sirupsen/logrus"
@@ -22,6 +26,17 @@ const (
 func checkArgs(context *cli.Context, expected, checkType int) error {
 	var err error
 	cmdName := context.Command.Name
+	showHelp := func() error {
+		return cli.ShowCommandHelp(context, cmdName)
+	}
+	if cmdName == "" {
+		// The action of a command with subcommands, such as spec, is run
+		// as the one of an app named after the command.
+		cmdName = context.App.Name[strings.LastIndex(context.App.Name, " ")+1:]
+		showHelp = func() error {
+			return cli.ShowAppHelp(context)
+		}
+	}
 	switch checkType {
 	case exactArgs:
 		if context.NArg() != expected {
@@ -39,7 +54,7 @@ func checkArgs(context *cli.Context, expected, checkType int) error {
 
 	if err != nil {
 		fmt.Printf("Incorrect Usage.\n\n")
-		_ = cli.ShowCommandHelp(context, cmdName)
+		_ = showHelp()
 		return err
 	}
 	return nil
@@ -50,8 +65,23 @@ func logrusToStderr() bool {
 	return ok && l.Fd() == os.Stderr.Fd()
 }
 
+// exitError is an error for which runc exits with a specific status, rather
+// than 1.
+type exitError struct {
+	status int
+	err    error
+}
+
+func (e *exitError) Error() string {
+	return e.err.Error()
+}
+
+func (e *exitError) Unwrap() error {
+	return e.err
+}
+
 // fatal prints the error's details if it is a libcontainer specific error type
-// then exits the program with an exit status of 1.
+// then exits the program with an exit status of 1, or the one of an exitError.
 func fatal(err error) {
 	// make sure the error is written to the logger
 	logrus.Error(err)
@@ -61,6 +91,10 @@ func fatal(err error) {
 		fmt.Fprintln(os.Stderr, err)
 	}
 
+	var e *exitError
+	if errors.As(err, &e) {
+		os.Exit(e.status)
+	}
 	os.Exit(1)
 }
 
@@ -94,6 +128,25 @@ func revisePidFile(context *cli.Context) error {
 	return context.Set("pid-file", pidFile)
 }
 
+// reviseStdioLogs converts the --stdout and --stderr files to absolute paths,
+// so that they are relative to the right directory after chdir to bundle.
+func reviseStdioLogs(context *cli.Context) error {
+	for _, name := range []string{"stdout", "stderr"} {
+		path := context.String(name)
+		if path == "" {
+			continue
+		}
+		path, err := filepath.Abs(path)
+		if err != nil {
+			return err
+		}
+		if err := context.Set(name, path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // reviseRootDir convert the root to absolute path
 func reviseRootDir(context *cli.Context) error {
 	root := context.GlobalString("root")
@@ -117,3 +170,18 @@ func parseBoolOrAuto(s string) (*bool, error) {
 	b, err := strconv.ParseBool(s)
 	return &b, err
 }
+
+// newOperationID returns a random ID for the current runc invocation.
+func newOperationID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return strconv.Itoa(os.Getpid())
+	}
+	return hex.EncodeToString(b)
+}
+
+// setLogContainerID tags all the subsequent log entries with the container
+// id.
+func setLogContainerID(id string) {
+	logs.AddFields(logrus.Fields{"container": id})
+}
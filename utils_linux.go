@@ -1,3 +1,4 @@
+//go:build linux
 // +build linux
 
 package main
@@ -9,11 +10,15 @@ import (
 	"os/exec"
 	"path/filepath"
 	"strconv"
+	"strings"
 
 	"github.com/opencontainers/runc/libcontainer"
+	"github.com/opencontainers/runc/libcontainer/apparmor"
+	"github.com/opencontainers/runc/libcontainer/cdi"
 	"github.com/opencontainers/runc/libcontainer/cgroups/systemd"
 	"github.com/opencontainers/runc/libcontainer/configs"
 	"github.com/opencontainers/runc/libcontainer/specconv"
+	"github.com/opencontainers/runc/libcontainer/trace"
 	"github.com/opencontainers/runc/libcontainer/utils"
 	"github.com/opencontainers/runtime-spec/specs-go"
 	selinux "github.com/opencontainers/selinux/go-selinux"
@@ -38,21 +43,19 @@ func loadFactory(context *cli.Context) (libcontainer.Factory, error) {
 	// We default to cgroupfs, and can only use systemd if the system is a
 	// systemd box.
 	cgroupManager := libcontainer.Cgroupfs
-	rootlessCg, err := shouldUseRootlessCgroupManager(context)
-	if err != nil {
-		return nil, err
-	}
-	if rootlessCg {
-		cgroupManager = libcontainer.RootlessCgroupfs
-	}
 	if context.GlobalBool("systemd-cgroup") {
 		if !systemd.IsRunningSystemd() {
 			return nil, errors.New("systemd cgroup flag passed, but systemd support for managing cgroups is not available")
 		}
 		cgroupManager = libcontainer.SystemdCgroups
-		if rootlessCg {
-			cgroupManager = libcontainer.RootlessSystemdCgroups
-		}
+	}
+	var rootlessCgroups func(*libcontainer.LinuxFactory) error
+	rootlessCg, err := shouldUseRootlessCgroupManager(context)
+	if err != nil {
+		return nil, err
+	}
+	if rootlessCg {
+		rootlessCgroups = libcontainer.WithRootlessCgroups
 	}
 
 	intelRdtManager := libcontainer.IntelRdtFs
@@ -69,10 +72,22 @@ func loadFactory(context *cli.Context) (libcontainer.Factory, error) {
 		newgidmap = ""
 	}
 
-	return libcontainer.New(abs, cgroupManager, intelRdtManager,
-		libcontainer.CriuPath(context.GlobalString("criu")),
+	var selinuxMCS func(*libcontainer.LinuxFactory) error
+	if context.Bool("selinux-mcs") {
+		selinuxMCS = libcontainer.SELinuxMCS
+	}
+
+	var deviceStats []libcontainer.DeviceStatsProvider
+	for _, path := range context.StringSlice("device-stats-plugin") {
+		deviceStats = append(deviceStats, &libcontainer.CommandDeviceStatsProvider{Path: path})
+	}
+
+	return libcontainer.New(abs, cgroupManager, rootlessCgroups, intelRdtManager,
+		libcontainer.WithCriuPath(context.GlobalString("criu")),
 		libcontainer.NewuidmapPath(newuidmap),
-		libcontainer.NewgidmapPath(newgidmap))
+		libcontainer.NewgidmapPath(newgidmap),
+		selinuxMCS,
+		libcontainer.WithDeviceStatsProviders(deviceStats...))
 }
 
 // getContainer returns the specified container instance by loading it from state
@@ -82,6 +97,7 @@ func getContainer(context *cli.Context) (libcontainer.Container, error) {
 	if id == "" {
 		return nil, errEmptyID
 	}
+	setLogContainerID(id)
 	factory, err := loadFactory(context)
 	if err != nil {
 		return nil, err
@@ -136,6 +152,10 @@ func newProcess(p specs.Process, init bool, logLevel string) (*libcontainer.Proc
 		}
 		lp.Rlimits = append(lp.Rlimits, rl)
 	}
+	// The oom_score_adj of the init process is the one of the container.
+	if !init {
+		lp.OomScoreAdj = p.OOMScoreAdj
+	}
 	return lp, nil
 }
 
@@ -146,7 +166,7 @@ func destroy(container libcontainer.Container) {
 }
 
 // setupIO modifies the given process config according to the options.
-func setupIO(process *libcontainer.Process, rootuid, rootgid int, createTTY, detach bool, sockpath string) (*tty, error) {
+func setupIO(process *libcontainer.Process, rootuid, rootgid int, createTTY, detach bool, sockpath string, logs *stdioLogs) (*tty, error) {
 	if createTTY {
 		process.Stdin = nil
 		process.Stdout = nil
@@ -192,9 +212,16 @@ func setupIO(process *libcontainer.Process, rootuid, rootgid int, createTTY, det
 		if err := inheritStdio(process); err != nil {
 			return nil, err
 		}
-		return &tty{}, nil
+		t := &tty{}
+		if logs != nil {
+			if err := logs.startForwarder(process, t); err != nil {
+				_ = t.Close()
+				return nil, err
+			}
+		}
+		return t, nil
 	}
-	return setupProcessPipes(process, rootuid, rootgid)
+	return setupProcessPipes(process, rootuid, rootgid, logs)
 }
 
 // createPidFile creates a file with the processes pid inside it atomically
@@ -221,23 +248,79 @@ func createPidFile(path string, process *libcontainer.Process) error {
 	return os.Rename(tmpName, path)
 }
 
+// createOpts returns the options of the conversion of spec into the config
+// of the container id, as given on the command line. They are shared by the
+// commands creating a container and runc spec validate, so that the latter
+// checks the config the former would create.
+func createOpts(context *cli.Context, id string, spec *specs.Spec, rootlessCg bool, ext *specExtensions) *specconv.CreateOpts {
+	return &specconv.CreateOpts{
+		CgroupName:             id,
+		UseSystemdCgroup:       context.GlobalBool("systemd-cgroup"),
+		CgroupRoot:             context.GlobalString("cgroup-root"),
+		NoPivotRoot:            context.Bool("no-pivot"),
+		NoNewKeyring:           context.Bool("no-new-keyring"),
+		Spec:                   spec,
+		RootlessEUID:           os.Geteuid() != 0,
+		RootlessCgroups:        rootlessCg,
+		PinDeviceFilter:        context.GlobalBool("pin-device-filter"),
+		StateRoot:              context.GlobalString("root"),
+		DeviceFilterMap:        context.GlobalBool("device-filter-map"),
+		DeviceFilterFailClosed: context.GlobalBool("device-filter-fail-closed"),
+		AuditDevices:           context.GlobalBool("audit-devices"),
+		SchedCore:              context.Bool("sched-core"),
+		TimeOffsets:            ext.TimeOffsets,
+		Scheduler:              ext.Process.Scheduler,
+		IOPriority:             ext.Process.IOPriority,
+		MemoryPolicy:           ext.MemoryPolicy,
+		Networks:               ext.Networks,
+		Routes:                 ext.Routes,
+		RawSpec:                ext.Raw,
+	}
+}
+
 func createContainer(context *cli.Context, id string, spec *specs.Spec) (libcontainer.Container, error) {
 	rootlessCg, err := shouldUseRootlessCgroupManager(context)
 	if err != nil {
 		return nil, err
 	}
-	config, err := specconv.CreateLibcontainerConfig(&specconv.CreateOpts{
-		CgroupName:       id,
-		UseSystemdCgroup: context.GlobalBool("systemd-cgroup"),
-		NoPivotRoot:      context.Bool("no-pivot"),
-		NoNewKeyring:     context.Bool("no-new-keyring"),
-		Spec:             spec,
-		RootlessEUID:     os.Geteuid() != 0,
-		RootlessCgroups:  rootlessCg,
-	})
+	if err := injectCDIDevices(context, spec); err != nil {
+		return nil, err
+	}
+	if err := loadAppArmorProfile(spec); err != nil {
+		return nil, err
+	}
+	ext, err := loadSpecExtensions(specConfig)
+	if err != nil {
+		return nil, err
+	}
+	// The annotations end up in the labels of the container, along with
+	// the ones of runc.
+	if _, ok := spec.Annotations[utils.ConsoleSocketLabel]; ok {
+		return nil, fmt.Errorf("annotation %s is reserved for runc", utils.ConsoleSocketLabel)
+	}
+	span := trace.Start("spec conversion")
+	config, err := specconv.CreateLibcontainerConfig(createOpts(context, id, spec, rootlessCg, ext))
+	span.Finish()
 	if err != nil {
 		return nil, err
 	}
+	// Record the console socket, so that runc attach can request more
+	// terminals to the container from its receiver.
+	if sock := context.String("console-socket"); sock != "" {
+		if sock, err = filepath.Abs(sock); err != nil {
+			return nil, err
+		}
+		config.Labels = append(config.Labels, utils.ConsoleSocketLabel+"="+sock)
+	}
+	// Tell the user about the protections a rootless container doesn't
+	// get, rather than silently skipping them.
+	degradations, err := libcontainer.RootlessPreflight(config)
+	if err != nil {
+		logrus.Warnf("unable to check the rootless degradations: %v", err)
+	}
+	for _, d := range degradations {
+		logrus.Warnf("rootless: %s", d)
+	}
 
 	factory, err := loadFactory(context)
 	if err != nil {
@@ -246,12 +329,57 @@ func createContainer(context *cli.Context, id string, spec *specs.Spec) (libcont
 	return factory.Create(id, config)
 }
 
+// injectCDIDevices injects the CDI devices requested with --device, or with
+// annotations of the spec, into the spec.
+func injectCDIDevices(context *cli.Context, spec *specs.Spec) error {
+	names := append(cdi.AnnotationDevices(spec.Annotations), context.StringSlice("device")...)
+	if len(names) == 0 {
+		return nil
+	}
+	registry, err := cdi.Load()
+	if err != nil {
+		return err
+	}
+	return registry.InjectDevices(spec, names...)
+}
+
+// appArmorProfileFileAnnotation is the annotation of the spec to set the path
+// (relative to the bundle) of an AppArmor profile file, which is loaded before
+// the container is created.
+const appArmorProfileFileAnnotation = "org.opencontainers.runc.apparmor.profile-file"
+
+// loadAppArmorProfile loads the AppArmor profile file requested with the
+// annotation of the spec, if any. Unless process.apparmorProfile is set, the
+// (first) profile defined in the file is applied to the container.
+func loadAppArmorProfile(spec *specs.Spec) error {
+	path := spec.Annotations[appArmorProfileFileAnnotation]
+	if path == "" {
+		return nil
+	}
+	if !apparmor.IsEnabled() {
+		return fmt.Errorf("can't load AppArmor profile file %s: AppArmor is not enabled on the host", path)
+	}
+	// runc's cwd is the bundle, so relative paths are resolved against it.
+	names, err := apparmor.LoadProfile(path)
+	if err != nil {
+		return err
+	}
+	if spec.Process.ApparmorProfile == "" {
+		if len(names) == 0 {
+			return fmt.Errorf("no AppArmor profile is defined in %s", path)
+		}
+		spec.Process.ApparmorProfile = names[0]
+	}
+	return nil
+}
+
 type runner struct {
 	init            bool
 	enableSubreaper bool
 	shouldDestroy   bool
 	detach          bool
 	listenFDs       []*os.File
+	listenFDNames   []string
 	preserveFDs     int
 	pidFile         string
 	consoleSocket   string
@@ -260,6 +388,14 @@ type runner struct {
 	notifySocket    *notifySocket
 	criuOpts        *libcontainer.CriuOpts
 	logLevel        string
+	ioPriority      *configs.IOPriority
+	subCgroup       string
+	// subCgroupResources are the limits of the child cgroup subCgroup.
+	subCgroupResources *configs.Resources
+	stdioLogs          *stdioLogs
+	// user, if set, is the user of the process, as a name or uid with an
+	// optional group name or gid, resolved by init in the container.
+	user string
 }
 
 func (r *runner) run(config *specs.Process) (int, error) {
@@ -276,11 +412,50 @@ func (r *runner) run(config *specs.Process) (int, error) {
 	if err != nil {
 		return -1, err
 	}
-	if len(r.listenFDs) > 0 {
-		process.Env = append(process.Env, "LISTEN_FDS="+strconv.Itoa(len(r.listenFDs)), "LISTEN_PID=1")
-		process.ExtraFiles = append(process.ExtraFiles, r.listenFDs...)
+	process.IOPriority = r.ioPriority
+	process.Cgroup = r.subCgroup
+	process.CgroupResources = r.subCgroupResources
+	if r.user != "" {
+		process.User = r.user
+	}
+	listenFDs, listenFDNames := r.listenFDs, r.listenFDNames
+	// The ports forwarded without a networking helper are passed to the
+	// container after the sockets given to runc.
+	if r.init && r.action != CT_ACT_RESTORE {
+		forwards := r.container.Config().PortForwards
+		var sockets []*os.File
+		sockets, err = listenPortForwards(forwards)
+		if err != nil {
+			return -1, err
+		}
+		defer func() {
+			for _, s := range sockets {
+				s.Close()
+			}
+		}()
+		if len(sockets) > 0 {
+			if len(listenFDNames) == 0 {
+				for range listenFDs {
+					listenFDNames = append(listenFDNames, "unknown")
+				}
+			}
+			listenFDs = append(listenFDs[:len(listenFDs):len(listenFDs)], sockets...)
+			for _, pf := range forwards {
+				listenFDNames = append(listenFDNames, fmt.Sprintf("%s-%d", pf.Protocol, pf.HostPort))
+			}
+		}
+	}
+	// LISTEN_PID is set by runc init, to the pid of the process in the
+	// container.
+	if len(listenFDs) > 0 {
+		process.Env = append(process.Env, "LISTEN_FDS="+strconv.Itoa(len(listenFDs)))
+		if len(listenFDNames) > 0 {
+			process.Env = append(process.Env, "LISTEN_FDNAMES="+strings.Join(listenFDNames, ":"))
+		}
+		process.ExtraFiles = append(process.ExtraFiles, listenFDs...)
 	}
-	baseFd := 3 + len(process.ExtraFiles)
+	// The preserved fds follow those inherited for socket activation.
+	baseFd := 3 + len(r.listenFDs)
 	for i := baseFd; i < baseFd+r.preserveFDs; i++ {
 		_, err = os.Stat("/proc/self/fd/" + strconv.Itoa(i))
 		if err != nil {
@@ -303,7 +478,7 @@ func (r *runner) run(config *specs.Process) (int, error) {
 	// with detaching containers, and then we get a tty after the container has
 	// started.
 	handler := newSignalHandler(r.enableSubreaper, r.notifySocket)
-	tty, err := setupIO(process, rootuid, rootgid, config.Terminal, detach, r.consoleSocket)
+	tty, err := setupIO(process, rootuid, rootgid, config.Terminal, detach, r.consoleSocket, r.stdioLogs)
 	if err != nil {
 		return -1, err
 	}
@@ -336,6 +511,23 @@ func (r *runner) run(config *specs.Process) (int, error) {
 			return -1, err
 		}
 	}
+	// Keep the systemd watchdog alive while the container runs in the
+	// foreground.
+	if r.init && !detach {
+		var wd *watchdog
+		wd, err = newWatchdog(r.container)
+		if err != nil {
+			r.terminate(process)
+			return -1, err
+		}
+		if wd != nil {
+			if r.notifySocket != nil {
+				r.notifySocket.watchdog = wd
+			}
+			go wd.run()
+			defer wd.stop()
+		}
+	}
 	status, err := handler.forward(process, tty, detach)
 	if err != nil {
 		r.terminate(process)
@@ -369,6 +561,9 @@ func (r *runner) checkTerminal(config *specs.Process) error {
 	if (!detach || !config.Terminal) && r.consoleSocket != "" {
 		return errors.New("cannot use console socket if runc will not detach or allocate tty")
 	}
+	if config.Terminal && r.stdioLogs != nil {
+		return errors.New("cannot forward the stdio of the container to files if a tty is allocated")
+	}
 	return nil
 }
 
@@ -399,11 +594,63 @@ const (
 	CT_ACT_RESTORE
 )
 
+// inheritedListenFDs returns the sockets passed to runc with the socket
+// activation protocol, if any, along with their names if it was given some.
+func inheritedListenFDs() ([]*os.File, []string) {
+	if os.Getenv("LISTEN_FDS") == "" {
+		return nil, nil
+	}
+	files := activation.Files(false)
+	if len(files) == 0 || os.Getenv("LISTEN_FDNAMES") == "" {
+		return files, nil
+	}
+	names := strings.Split(os.Getenv("LISTEN_FDNAMES"), ":")
+	for len(names) < len(files) {
+		names = append(names, "unknown")
+	}
+	return files, names[:len(files)]
+}
+
+// listenPortForwards binds the ports of the host passed to the container as
+// sockets, and returns their files.
+func listenPortForwards(forwards []configs.PortForward) ([]*os.File, error) {
+	var files []*os.File
+	for _, pf := range forwards {
+		var (
+			f   *os.File
+			err error
+		)
+		addr := net.JoinHostPort(pf.HostIP, strconv.Itoa(int(pf.HostPort)))
+		if pf.Protocol == "udp" {
+			var conn net.PacketConn
+			if conn, err = net.ListenPacket("udp", addr); err == nil {
+				f, err = conn.(*net.UDPConn).File()
+				conn.Close()
+			}
+		} else {
+			var l net.Listener
+			if l, err = net.Listen("tcp", addr); err == nil {
+				f, err = l.(*net.TCPListener).File()
+				l.Close()
+			}
+		}
+		if err != nil {
+			for _, f := range files {
+				f.Close()
+			}
+			return nil, errors.Wrapf(err, "unable to bind port forward %s", pf)
+		}
+		files = append(files, f)
+	}
+	return files, nil
+}
+
 func startContainer(context *cli.Context, spec *specs.Spec, action CtAct, criuOpts *libcontainer.CriuOpts) (int, error) {
 	id := context.Args().First()
 	if id == "" {
 		return -1, errEmptyID
 	}
+	setLogContainerID(id)
 
 	notifySocket := newNotifySocket(context, os.Getenv("NOTIFY_SOCKET"), id)
 	if notifySocket != nil {
@@ -429,21 +676,24 @@ func startContainer(context *cli.Context, spec *specs.Spec, action CtAct, criuOp
 	}
 
 	// Support on-demand socket activation by passing file descriptors into the container init process.
-	listenFDs := []*os.File{}
-	if os.Getenv("LISTEN_FDS") != "" {
-		listenFDs = activation.Files(false)
-	}
+	listenFDs, listenFDNames := inheritedListenFDs()
 
 	logLevel := "info"
 	if context.GlobalBool("debug") {
 		logLevel = "debug"
 	}
 
+	stdio, err := newStdioLogs(context)
+	if err != nil {
+		return -1, err
+	}
+
 	r := &runner{
 		enableSubreaper: !context.Bool("no-subreaper"),
 		shouldDestroy:   true,
 		container:       container,
 		listenFDs:       listenFDs,
+		listenFDNames:   listenFDNames,
 		notifySocket:    notifySocket,
 		consoleSocket:   context.String("console-socket"),
 		detach:          context.Bool("detach"),
@@ -453,6 +703,7 @@ func startContainer(context *cli.Context, spec *specs.Spec, action CtAct, criuOp
 		criuOpts:        criuOpts,
 		init:            true,
 		logLevel:        logLevel,
+		stdioLogs:       stdio,
 	}
 	return r.run(spec.Process)
 }
@@ -0,0 +1,120 @@
+// +build linux
+
+package main
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/opencontainers/runc/libcontainer"
+	"github.com/sirupsen/logrus"
+)
+
+// watchdog keeps the watchdog of the systemd unit running runc in the
+// foreground alive, for as long as the container is healthy: its init process
+// is alive, and its cgroup is populated. It stops once the container keeps
+// the watchdog alive on its own (see notifySocket).
+type watchdog struct {
+	container libcontainer.Container
+	interval  time.Duration
+	client    *net.UnixConn
+
+	delegateOnce sync.Once
+	delegated    chan struct{}
+	stopOnce     sync.Once
+	stopped      chan struct{}
+}
+
+// newWatchdog returns the watchdog of the container, or nil if the watchdog
+// of the unit is not enabled for runc ($WATCHDOG_USEC).
+func newWatchdog(container libcontainer.Container) (*watchdog, error) {
+	usec := os.Getenv("WATCHDOG_USEC")
+	host := os.Getenv("NOTIFY_SOCKET")
+	if usec == "" || host == "" {
+		return nil, nil
+	}
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return nil, nil
+	}
+	interval, err := parseWatchdogUsec(usec)
+	if err != nil {
+		logrus.Warnf("ignoring invalid WATCHDOG_USEC: %v", err)
+		return nil, nil
+	}
+	client, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: host, Net: "unixgram"})
+	if err != nil {
+		return nil, err
+	}
+	return &watchdog{
+		container: container,
+		interval:  interval,
+		client:    client,
+		delegated: make(chan struct{}),
+		stopped:   make(chan struct{}),
+	}, nil
+}
+
+// parseWatchdogUsec parses the watchdog interval of $WATCHDOG_USEC, in
+// microseconds.
+func parseWatchdogUsec(usec string) (time.Duration, error) {
+	interval, err := strconv.ParseUint(usec, 10, 64)
+	if err != nil || interval == 0 || interval > uint64(math.MaxInt64/time.Microsecond) {
+		return 0, fmt.Errorf("invalid interval %q", usec)
+	}
+	return time.Duration(interval) * time.Microsecond, nil
+}
+
+// run keeps the watchdog alive, by notifying it at half its interval as
+// recommended by sd_watchdog_enabled(3), until the watchdog is stopped or
+// delegated to the container, or the container is stopped.
+func (w *watchdog) run() {
+	defer w.client.Close()
+	ticker := time.NewTicker(w.interval / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.stopped:
+			return
+		case <-w.delegated:
+			logrus.Debug("the watchdog is kept alive by the container")
+			return
+		case <-ticker.C:
+			if status, err := w.container.Status(); err == nil && status == libcontainer.Stopped {
+				logrus.Debug("container is stopped, no longer notifying the watchdog")
+				return
+			}
+			if !w.healthy() {
+				logrus.Debug("container is unhealthy, not notifying the watchdog")
+				continue
+			}
+			if _, err := w.client.Write([]byte("WATCHDOG=1\n")); err != nil {
+				logrus.Warnf("unable to notify the watchdog: %v", err)
+			}
+		}
+	}
+}
+
+// healthy returns whether the init process of the container is alive, and
+// its cgroup has processes.
+func (w *watchdog) healthy() bool {
+	status, err := w.container.Status()
+	if err != nil || status == libcontainer.Stopped {
+		return false
+	}
+	pids, err := w.container.Processes()
+	return err == nil && len(pids) > 0
+}
+
+// delegate stops keeping the watchdog alive, as the container does so.
+func (w *watchdog) delegate() {
+	w.delegateOnce.Do(func() { close(w.delegated) })
+}
+
+func (w *watchdog) stop() {
+	w.stopOnce.Do(func() { close(w.stopped) })
+}
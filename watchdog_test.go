@@ -0,0 +1,159 @@
+// +build linux
+
+package main
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/opencontainers/runc/libcontainer"
+)
+
+func TestParseWatchdogUsec(t *testing.T) {
+	for _, tc := range []struct {
+		usec     string
+		interval time.Duration
+		invalid  bool
+	}{
+		{usec: "1000000", interval: time.Second},
+		{usec: "1", interval: time.Microsecond},
+		{usec: "", invalid: true},
+		{usec: "0", invalid: true},
+		{usec: "-1", invalid: true},
+		{usec: "1s", invalid: true},
+		{usec: "18446744073709551615", invalid: true},
+	} {
+		interval, err := parseWatchdogUsec(tc.usec)
+		if tc.invalid {
+			if err == nil {
+				t.Errorf("%q: expected an error, got %v", tc.usec, interval)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", tc.usec, err)
+		} else if interval != tc.interval {
+			t.Errorf("%q: expected %v, got %v", tc.usec, tc.interval, interval)
+		}
+	}
+}
+
+// fakeContainer is a container whose status is set by the test.
+type fakeContainer struct {
+	libcontainer.Container
+
+	mu     sync.Mutex
+	status libcontainer.Status
+}
+
+func (c *fakeContainer) Status() (libcontainer.Status, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.status, nil
+}
+
+func (c *fakeContainer) Processes() ([]int, error) {
+	return []int{1}, nil
+}
+
+func (c *fakeContainer) setStatus(status libcontainer.Status) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.status = status
+}
+
+// setenv sets the environment variable key, and returns a function restoring
+// its previous value.
+func setenv(t *testing.T, key, value string) func() {
+	old, ok := os.LookupEnv(key)
+	if err := os.Setenv(key, value); err != nil {
+		t.Fatal(err)
+	}
+	return func() {
+		if ok {
+			os.Setenv(key, old)
+		} else {
+			os.Unsetenv(key)
+		}
+	}
+}
+
+func TestWatchdogStopsWithContainer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "runc-watchdog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	addr := &net.UnixAddr{Name: filepath.Join(dir, "notify.sock"), Net: "unixgram"}
+	socket, err := net.ListenUnixgram("unixgram", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer socket.Close()
+
+	defer setenv(t, "NOTIFY_SOCKET", addr.Name)()
+	defer setenv(t, "WATCHDOG_USEC", "20000")()
+	defer setenv(t, "WATCHDOG_PID", "")()
+	container := &fakeContainer{status: libcontainer.Running}
+	wd, err := newWatchdog(container)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if wd == nil {
+		t.Fatal("expected the watchdog to be enabled")
+	}
+	done := make(chan struct{})
+	go func() {
+		wd.run()
+		close(done)
+	}()
+	defer wd.stop()
+
+	// The watchdog is notified while the container is running.
+	buf := make([]byte, 64)
+	if err := socket.SetReadDeadline(time.Now().Add(5 * time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	n, err := socket.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg := string(buf[:n]); msg != "WATCHDOG=1\n" {
+		t.Fatalf("expected a watchdog notification, got %q", msg)
+	}
+
+	// It stops once the container is stopped.
+	container.setStatus(libcontainer.Stopped)
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the watchdog is still notified after the container stopped")
+	}
+}
+
+func TestWatchdogDisabled(t *testing.T) {
+	for _, env := range []map[string]string{
+		{"NOTIFY_SOCKET": "", "WATCHDOG_USEC": "20000"},
+		{"NOTIFY_SOCKET": "/nonexistent", "WATCHDOG_USEC": ""},
+		{"NOTIFY_SOCKET": "/nonexistent", "WATCHDOG_USEC": "0"},
+		{"NOTIFY_SOCKET": "/nonexistent", "WATCHDOG_USEC": "20000", "WATCHDOG_PID": "1"},
+	} {
+		restore := []func(){setenv(t, "WATCHDOG_PID", "")}
+		for k, v := range env {
+			restore = append(restore, setenv(t, k, v))
+		}
+		wd, err := newWatchdog(&fakeContainer{})
+		if err != nil || wd != nil {
+			t.Errorf("%v: expected no watchdog, got %v, %v", env, wd, err)
+		}
+		for i := len(restore) - 1; i >= 0; i-- {
+			restore[i]()
+		}
+	}
+}